@@ -5,6 +5,7 @@ import (
 	"math"
 
 	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func AlignTo(ptr, alignment uint32) (uint32, error) {
@@ -41,6 +42,9 @@ func Alignment(t types.ValType) (uint32, error) {
 	case types.String:
 		return 4, nil
 	case types.List:
+		if _, fixed := vt.Length(); fixed {
+			return Alignment(vt.Type())
+		}
 		return 4, nil
 	case types.Record:
 		return AlignmentRecord(vt)
@@ -52,8 +56,10 @@ func Alignment(t types.ValType) (uint32, error) {
 		return 4, nil
 	case types.Borrow:
 		return 4, nil
+	case types.Stream, types.Future, types.ErrorContext:
+		return 4, nil
 	}
-	return 0, types.TrapWith("Alignment: unable to align type %T", t)
+	return 0, types.TrapWith(trap.TypeMismatch, "Alignment: unable to align type %T", t)
 }
 
 func AlignmentRecord(r types.Record) (uint32, error) {
@@ -0,0 +1,266 @@
+package io_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/stretchr/testify/require"
+)
+
+// AsyncContext reserves the first 64 bytes of memory for fixed buffers
+func AsyncContext() *types.CallContext {
+	heap := NewHeap(128)
+	heap.LastAlloc = 64
+	return Context(CanonicalOptions(Memory(heap.Memory), Realloc(heap.ReAllocate)))
+}
+
+func Unpack(packed uint64) (uint32, uint32) {
+	return uint32(packed), uint32(packed >> 32)
+}
+
+func TestStreamCopy(t *testing.T) {
+	cx := AsyncContext()
+	packed, err := io.CanonStreamNew(cx.Instance, types.NewStream(U8(), nil))
+	require.NoError(t, err)
+	ri, wi := Unpack(packed)
+
+	copy(cx.Options.Memory.Bytes()[0:], []byte{1, 2, 3})
+
+	result, err := io.CanonStreamWrite(cx, wi, 0, 3, true)
+	require.NoError(t, err)
+	require.Equal(t, types.Blocked, result)
+
+	result, err = io.CanonStreamRead(cx, ri, 16, 2, true)
+	require.NoError(t, err)
+	require.Equal(t, types.PackCopyResult(types.CopyCompleted, 2), result)
+	require.Equal(t, []byte{1, 2}, cx.Options.Memory.Bytes()[16:18])
+
+	si, err := io.CanonWaitableSetNew(cx.Instance)
+	require.NoError(t, err)
+	require.NoError(t, io.CanonWaitableJoin(cx.Instance, wi, si))
+
+	code, err := io.CanonWaitableSetPoll(cx, si, 32)
+	require.NoError(t, err)
+	require.Equal(t, uint32(types.EventStreamWrite), code)
+	index, err := io.LoadUInt32(cx, 32)
+	require.NoError(t, err)
+	require.Equal(t, wi, index)
+	payload, err := io.LoadUInt32(cx, 36)
+	require.NoError(t, err)
+	require.Equal(t, types.PackCopyResult(types.CopyCompleted, 2), payload)
+
+	code, err = io.CanonWaitableSetPoll(cx, si, 32)
+	require.NoError(t, err)
+	require.Equal(t, uint32(types.EventNone), code)
+
+	require.Error(t, io.CanonWaitableSetDrop(cx.Instance, si))
+	require.NoError(t, io.CanonWaitableJoin(cx.Instance, wi, 0))
+	require.NoError(t, io.CanonWaitableSetDrop(cx.Instance, si))
+}
+
+func TestStreamHost(t *testing.T) {
+	cx := AsyncContext()
+	shared := types.NewSharedStream(U32())
+	flat, err := io.LowerFlat(cx, shared, types.NewStream(U32(), nil))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(flat))
+	ri := flat[0].Value().(uint32)
+
+	var writeResult []types.CopyResult
+	err = shared.Write(io.NewHostReadableBuffer(uint32(7), uint32(8)), func(result types.CopyResult) {
+		writeResult = append(writeResult, result)
+	})
+	require.NoError(t, err)
+
+	result, err := io.CanonStreamRead(cx, ri, 0, 4, false)
+	require.NoError(t, err)
+	require.Equal(t, types.PackCopyResult(types.CopyCompleted, 2), result)
+	require.Equal(t, []types.CopyResult{types.CopyCompleted}, writeResult)
+	require.Equal(t, []byte{7, 0, 0, 0, 8, 0, 0, 0}, cx.Options.Memory.Bytes()[0:8])
+
+	shared.Drop()
+	result, err = io.CanonStreamRead(cx, ri, 0, 4, false)
+	require.NoError(t, err)
+	require.Equal(t, types.PackCopyResult(types.CopyDropped, 0), result)
+
+	_, err = io.CanonStreamRead(cx, ri, 0, 4, false)
+	require.Error(t, err)
+	require.NoError(t, io.CanonStreamCloseReadable(cx.Instance, ri))
+}
+
+func TestStreamCancelAndClose(t *testing.T) {
+	cx := AsyncContext()
+	packed, err := io.CanonStreamNew(cx.Instance, types.NewStream(nil, nil))
+	require.NoError(t, err)
+	ri, wi := Unpack(packed)
+
+	result, err := io.CanonStreamRead(cx, ri, 0, 1, true)
+	require.NoError(t, err)
+	require.Equal(t, types.Blocked, result)
+
+	require.Error(t, io.CanonStreamCloseReadable(cx.Instance, ri))
+
+	result, err = io.CanonStreamCancelRead(cx, ri, true)
+	require.NoError(t, err)
+	require.Equal(t, types.PackCopyResult(types.CopyCancelled, 0), result)
+
+	result, err = io.CanonStreamWrite(cx, wi, 0, 5, true)
+	require.NoError(t, err)
+	require.Equal(t, types.Blocked, result)
+
+	require.NoError(t, io.CanonStreamCloseReadable(cx.Instance, ri))
+
+	w, err := cx.Instance.Table.GetWaitable(wi)
+	require.NoError(t, err)
+	event, ok := w.TakeEvent()
+	require.True(t, ok)
+	require.Equal(t, types.Event{Code: types.EventStreamWrite, Index: wi, Payload: types.PackCopyResult(types.CopyDropped, 0)}, event)
+
+	require.NoError(t, io.CanonStreamCloseWritable(cx.Instance, wi))
+	_, err = cx.Instance.Table.Get(wi)
+	require.Error(t, err)
+}
+
+func TestStreamSyncDeadlock(t *testing.T) {
+	cx := AsyncContext()
+	packed, err := io.CanonStreamNew(cx.Instance, types.NewStream(U8(), nil))
+	require.NoError(t, err)
+	ri, _ := Unpack(packed)
+
+	_, err = io.CanonStreamRead(cx, ri, 0, 1, false)
+	require.Error(t, err)
+}
+
+func TestFuture(t *testing.T) {
+	cx := AsyncContext()
+	packed, err := io.CanonFutureNew(cx.Instance, types.NewFuture(String()))
+	require.NoError(t, err)
+	ri, wi := Unpack(packed)
+
+	result, err := io.CanonFutureRead(cx, ri, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, types.Blocked, result)
+
+	require.NoError(t, io.Store(cx, "hello", String(), 8))
+	result, err = io.CanonFutureWrite(cx, wi, 8, false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(types.CopyCompleted), result)
+
+	v, err := io.Load(cx, String(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "hello", v)
+
+	_, err = io.CanonFutureWrite(cx, wi, 8, true)
+	require.Error(t, err)
+	_, err = io.CanonFutureRead(cx, ri, 0, true)
+	require.Error(t, err)
+
+	require.NoError(t, io.CanonFutureCloseReadable(cx.Instance, ri))
+	require.NoError(t, io.CanonFutureCloseWritable(cx.Instance, wi))
+}
+
+func TestErrorContext(t *testing.T) {
+	cx := AsyncContext()
+	copy(cx.Options.Memory.Bytes()[0:], "oops")
+
+	i, err := io.CanonErrorContextNew(cx, 0, 4)
+	require.NoError(t, err)
+	require.NoError(t, io.CanonErrorContextDebugMessage(cx, i, 8))
+
+	message, err := io.Load(cx, String(), 8)
+	require.NoError(t, err)
+	require.Equal(t, "oops", message)
+
+	lifted, err := io.LiftFlat(cx, values.NewIterator(values.U32(i)), types.NewErrorContext())
+	require.NoError(t, err)
+	require.Equal(t, &types.ErrorContextElem{DebugMessage: "oops"}, lifted)
+
+	require.NoError(t, io.CanonErrorContextDrop(cx.Instance, i))
+	require.Error(t, io.CanonErrorContextDrop(cx.Instance, i))
+}
+
+func TestLiftAsync(t *testing.T) {
+	cx := AsyncContext()
+	inst := cx.Instance
+	opts := cx.Options
+	ft := FuncType([]types.ValType{U32()}, []types.ValType{U32()})
+
+	var ri, wi, si uint32
+	var task *types.Task
+	var results []any
+
+	callee := func(ctx context.Context, args any) (any, error) {
+		require.Equal(t, []any{values.U32(41)}, args)
+		packed, err := io.CanonFutureNew(inst, types.NewFuture(U32()))
+		if err != nil {
+			return nil, err
+		}
+		ri, wi = Unpack(packed)
+		si, err = io.CanonWaitableSetNew(inst)
+		if err != nil {
+			return nil, err
+		}
+		if err := io.CanonWaitableJoin(inst, ri, si); err != nil {
+			return nil, err
+		}
+		result, err := io.CanonFutureRead(cx, ri, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		require.Equal(t, types.Blocked, result)
+		return []any{values.U32(uint32(types.CallbackWait) | si<<4)}, nil
+	}
+	callback := func(ctx context.Context, args any) (any, error) {
+		require.Equal(t, []any{
+			values.U32(uint32(types.EventFutureRead)),
+			values.U32(ri),
+			values.U32(uint32(types.CopyCompleted)),
+		}, args)
+		v, err := io.LoadUInt32(cx, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := io.CanonTaskReturn(task.Context, []any{values.U32(v + 1)}); err != nil {
+			return nil, err
+		}
+		return []any{values.U32(uint32(types.CallbackExit))}, nil
+	}
+
+	io.CanonBackpressureSet(inst, true)
+	task, err := io.CanonLiftAsync(context.Background(), opts, inst, callee, callback, ft, []any{uint32(41)}, func(vs []any) {
+		results = vs
+	})
+	require.NoError(t, err)
+	require.Equal(t, types.TaskPending, task.State)
+
+	progressed, err := io.Step(inst)
+	require.NoError(t, err)
+	require.False(t, progressed)
+
+	io.CanonBackpressureSet(inst, false)
+	require.NoError(t, io.Run(inst))
+	require.Equal(t, types.TaskWaiting, task.State)
+	require.Nil(t, results)
+
+	require.NoError(t, io.StoreUInt32(cx, 42, 4))
+	result, err := io.CanonFutureWrite(cx, wi, 4, false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(types.CopyCompleted), result)
+
+	require.NoError(t, io.Run(inst))
+	require.Equal(t, types.TaskDone, task.State)
+	require.Equal(t, []any{uint32(43)}, results)
+	require.Empty(t, inst.Tasks)
+}
+
+func TestLiftAsyncExitWithoutReturn(t *testing.T) {
+	cx := AsyncContext()
+	callee := func(ctx context.Context, args any) (any, error) {
+		return []any{values.U32(uint32(types.CallbackExit))}, nil
+	}
+	_, err := io.CanonLiftAsync(context.Background(), cx.Options, cx.Instance, callee, nil, FuncType(nil, nil), nil, nil)
+	require.Error(t, err)
+}
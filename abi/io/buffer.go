@@ -0,0 +1,158 @@
+package io
+
+import (
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// GuestBuffer is a range of elements in the memory of a component instance used as the source
+// or destination of a stream or future copy. A nil element type copies no bytes.
+type GuestBuffer struct {
+	cx       *types.CallContext
+	t        types.ValType
+	ptr      uint32
+	length   uint32
+	progress uint32
+}
+
+func NewGuestBuffer(cx *types.CallContext, t types.ValType, ptr uint32, length uint32) (*GuestBuffer, error) {
+	if t != nil && length > 0 {
+		alignment, err := Alignment(t)
+		if err != nil {
+			return nil, err
+		}
+		aligned, err := AlignTo(ptr, alignment)
+		if err != nil {
+			return nil, err
+		}
+		if ptr != aligned {
+			return nil, types.TrapWith(trap.UnalignedPointer, "ptr %d not aligned to %d", ptr, alignment)
+		}
+		size, err := Size(t)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(ptr)+uint64(length)*uint64(size) > uint64(cx.Options.Memory.Len()) {
+			return nil, types.TrapWith(trap.OutOfBoundsMemory, "buffer of %d elements at ptr %d exceeds len(memory) %d", length, ptr, cx.Options.Memory.Len())
+		}
+	}
+	return &GuestBuffer{
+		cx:     cx,
+		t:      t,
+		ptr:    ptr,
+		length: length,
+	}, nil
+}
+
+func (b *GuestBuffer) Remain() uint32 {
+	return b.length - b.progress
+}
+
+func (b *GuestBuffer) Progress() uint32 {
+	return b.progress
+}
+
+func (b *GuestBuffer) Read(n uint32) ([]any, error) {
+	if n > b.Remain() {
+		return nil, types.TrapWith(trap.OutOfBoundsMemory, "read of %d elements exceeds remaining %d", n, b.Remain())
+	}
+	vs := make([]any, n)
+	if b.t != nil {
+		size, err := Size(b.t)
+		if err != nil {
+			return nil, err
+		}
+		for i := range vs {
+			v, err := Load(b.cx, b.t, b.ptr+(b.progress+uint32(i))*size)
+			if err != nil {
+				return nil, err
+			}
+			vs[i] = v
+		}
+	}
+	b.progress += n
+	return vs, nil
+}
+
+func (b *GuestBuffer) Write(vs []any) error {
+	n := uint32(len(vs))
+	if n > b.Remain() {
+		return types.TrapWith(trap.OutOfBoundsMemory, "write of %d elements exceeds remaining %d", n, b.Remain())
+	}
+	if b.t != nil {
+		size, err := Size(b.t)
+		if err != nil {
+			return err
+		}
+		for i, v := range vs {
+			err := Store(b.cx, v, b.t, b.ptr+(b.progress+uint32(i))*size)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	b.progress += n
+	return nil
+}
+
+// HostReadableBuffer lets the host write values into a stream or future
+type HostReadableBuffer struct {
+	values   []any
+	progress uint32
+}
+
+func NewHostReadableBuffer(vs ...any) *HostReadableBuffer {
+	return &HostReadableBuffer{
+		values: vs,
+	}
+}
+
+func (b *HostReadableBuffer) Remain() uint32 {
+	return uint32(len(b.values)) - b.progress
+}
+
+func (b *HostReadableBuffer) Progress() uint32 {
+	return b.progress
+}
+
+func (b *HostReadableBuffer) Read(n uint32) ([]any, error) {
+	if n > b.Remain() {
+		return nil, types.TrapWith(trap.OutOfBoundsMemory, "read of %d elements exceeds remaining %d", n, b.Remain())
+	}
+	vs := b.values[b.progress : b.progress+n]
+	b.progress += n
+	return vs, nil
+}
+
+// HostWritableBuffer lets the host read up to a fixed number of values from a stream or future
+type HostWritableBuffer struct {
+	values []any
+	length uint32
+}
+
+func NewHostWritableBuffer(length uint32) *HostWritableBuffer {
+	return &HostWritableBuffer{
+		length: length,
+	}
+}
+
+func (b *HostWritableBuffer) Remain() uint32 {
+	return b.length - uint32(len(b.values))
+}
+
+func (b *HostWritableBuffer) Progress() uint32 {
+	return uint32(len(b.values))
+}
+
+func (b *HostWritableBuffer) Write(vs []any) error {
+	if uint32(len(vs)) > b.Remain() {
+		return types.TrapWith(trap.OutOfBoundsMemory, "write of %d elements exceeds remaining %d", len(vs), b.Remain())
+	}
+	b.values = append(b.values, vs...)
+	return nil
+}
+
+// Values returns the values written so far
+func (b *HostWritableBuffer) Values() []any {
+	return b.values
+}
@@ -1,6 +1,11 @@
 package io
 
-import "github.com/patrickhuber/go-wasm/abi/types"
+import (
+	"context"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/trap"
+)
 
 func CanonResourceNew(inst *types.ComponentInstance, rt types.ResourceType, rep uint32) (any, error) {
 	h := &types.HandleElem{
@@ -18,7 +23,14 @@ func CanonResourceRep(inst *types.ComponentInstance, rt types.ResourceType, rep
 	return uint32(h.Rep), nil
 }
 
-func CanonResourceDrop(inst *types.ComponentInstance, rt types.ResourceType, i uint32) error {
+// CanonResourceDrop removes the handle i. Dropping an owned handle runs the destructor of the resource,
+// a destructor implemented by another instance is entered through that instance and traps if it is
+// already on the call stack. Dropping a borrowed handle ends the borrow in the call that lent it.
+// The destructor is called with ctx.
+func CanonResourceDrop(ctx context.Context, inst *types.ComponentInstance, rt types.ResourceType, i uint32) error {
+	if !inst.MayLeave {
+		return types.TrapWith(trap.CannotLeave, "ComponentInstance MayLeave must be true")
+	}
 	h, err := inst.Handles.Remove(rt, i)
 	if err != nil {
 		return err
@@ -26,11 +38,22 @@ func CanonResourceDrop(inst *types.ComponentInstance, rt types.ResourceType, i u
 	if !h.Own {
 		return nil
 	}
-	if inst != rt.Impl() && !rt.Impl().MayEnter {
-		return types.TrapWith("ComponentInstance != ResourceType.Impl and ResourceType.Impl.MayEnter == false")
+	impl := rt.Impl()
+	if impl == nil || impl == inst {
+		return destroy(ctx, rt, h.Rep)
+	}
+	if !impl.MayEnter {
+		return types.TrapWith(trap.CannotEnter, "ComponentInstance != ResourceType.Impl and ResourceType.Impl.MayEnter == false")
 	}
-	if rt.DTor() != nil {
-		rt.DTor()(h.Rep)
+	// the dropping instance is suspended while the destructor runs so it can not be reentered
+	inst.MayEnter = false
+	defer func() { inst.MayEnter = true }()
+	return destroy(ctx, rt, h.Rep)
+}
+
+func destroy(ctx context.Context, rt types.ResourceType, rep uint32) error {
+	if rt.DTor() == nil {
+		return nil
 	}
-	return nil
+	return rt.DTor()(ctx, rep)
 }
@@ -0,0 +1,352 @@
+package io
+
+import (
+	"context"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/internal/collections"
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// CanonLiftAsync calls an export lifted with the async callback ABI.
+// The callee returns a packed callback code after which events are delivered through callback
+// until the task exits. Results are passed to onReturn when the task calls task.return.
+// While the instance applies backpressure the task is deferred and started by Step.
+func CanonLiftAsync(
+	ctx context.Context,
+	opts *types.CanonicalOptions,
+	inst *types.ComponentInstance,
+	callee func(context.Context, any) (any, error),
+	callback func(context.Context, any) (any, error),
+	ft types.FuncType,
+	args []any,
+	onReturn func([]any)) (*types.Task, error) {
+
+	if !inst.MayEnter {
+		return nil, types.TrapWith(trap.CannotEnter, "ComponentInstance MayEnter must be true")
+	}
+
+	task := &types.Task{
+		FuncType: ft,
+		OnReturn: onReturn,
+	}
+	cx := &types.CallContext{
+		Context:  ctx,
+		Options:  opts,
+		Instance: inst,
+		Task:     task,
+	}
+	task.Context = cx
+	task.Callback = func(e types.Event) (uint32, error) {
+		return callCore(ctx, callback, []any{
+			values.U32(uint32(e.Code)),
+			values.U32(e.Index),
+			values.U32(e.Payload),
+		})
+	}
+	task.Start = func() error {
+		inst.MayLeave = false
+		flatArgs, err := LowerValues(cx, MaxFlatParams, args, ft.ParamTypes(), nil)
+		inst.MayLeave = true
+		if err != nil {
+			return err
+		}
+
+		task.State = types.TaskRunning
+		inst.Tasks = append(inst.Tasks, task)
+
+		code, err := callCore(ctx, callee, flatArgs)
+		if err != nil {
+			return err
+		}
+		return handleCallbackCode(task, code)
+	}
+
+	if inst.Backpressure || len(inst.Pending) > 0 {
+		task.State = types.TaskPending
+		inst.Pending = append(inst.Pending, task)
+		return task, nil
+	}
+	return task, task.Start()
+}
+
+// Step starts pending tasks if backpressure was released and delivers one event to every
+// waiting task that is able to make progress. It reports whether any task made progress.
+func Step(inst *types.ComponentInstance) (bool, error) {
+	progressed := false
+	for !inst.Backpressure && len(inst.Pending) > 0 {
+		task := inst.Pending[0]
+		inst.Pending = inst.Pending[1:]
+		if err := task.Start(); err != nil {
+			return true, err
+		}
+		progressed = true
+	}
+
+	tasks := append([]*types.Task(nil), inst.Tasks...)
+	for _, task := range tasks {
+		if task.State != types.TaskWaiting {
+			continue
+		}
+		event, ok := nextEvent(task)
+		if !ok {
+			continue
+		}
+		progressed = true
+		if task.Set != nil {
+			task.Set.NumWaiting--
+			task.Set = nil
+		}
+		task.State = types.TaskRunning
+		code, err := task.Callback(event)
+		if err != nil {
+			return true, err
+		}
+		if err := handleCallbackCode(task, code); err != nil {
+			return true, err
+		}
+	}
+	return progressed, nil
+}
+
+// Run steps the instance until no task is able to make progress
+func Run(inst *types.ComponentInstance) error {
+	for {
+		progressed, err := Step(inst)
+		if err != nil {
+			return err
+		}
+		if !progressed {
+			return nil
+		}
+	}
+}
+
+func nextEvent(task *types.Task) (types.Event, bool) {
+	switch task.Code {
+	case types.CallbackYield:
+		return types.Event{Code: types.EventNone}, true
+	case types.CallbackWait:
+		return task.Set.Poll()
+	case types.CallbackPoll:
+		if e, ok := task.Set.Poll(); ok {
+			return e, true
+		}
+		return types.Event{Code: types.EventNone}, true
+	}
+	return types.Event{}, false
+}
+
+func handleCallbackCode(task *types.Task, packed uint32) error {
+	inst := task.Context.Instance
+	code := types.CallbackCode(packed & 0xf)
+	switch code {
+	case types.CallbackExit:
+		if !task.Returned {
+			return types.TrapWith(trap.InvalidState, "task exited without calling task.return")
+		}
+		task.State = types.TaskDone
+		for i, t := range inst.Tasks {
+			if t == task {
+				inst.Tasks = append(inst.Tasks[:i], inst.Tasks[i+1:]...)
+				break
+			}
+		}
+		return task.Context.ExitCall()
+	case types.CallbackYield:
+		task.Code = code
+	case types.CallbackWait, types.CallbackPoll:
+		set, err := types.TableGet[*types.WaitableSet](&inst.Table, packed>>4)
+		if err != nil {
+			return err
+		}
+		set.NumWaiting++
+		task.Code = code
+		task.Set = set
+	default:
+		return types.TrapWith(trap.InvalidState, "unsupported callback code %d", code)
+	}
+	task.State = types.TaskWaiting
+	return nil
+}
+
+// callCore calls a core function that returns a single i32
+func callCore(ctx context.Context, f func(context.Context, any) (any, error), args []any) (uint32, error) {
+	result, err := f(ctx, args)
+	if err != nil {
+		return 0, err
+	}
+	results, ok := result.([]any)
+	if !ok {
+		return 0, types.NewCastError(result, "[]any")
+	}
+	vs, err := toValues(results)
+	if err != nil {
+		return 0, err
+	}
+	return LiftFlatU32(values.NewIterator(vs...))
+}
+
+func toValues(vs []any) ([]values.Value, error) {
+	return collections.Select(vs, func(source any) (values.Value, error) {
+		v, ok := source.(values.Value)
+		if !ok {
+			return nil, types.NewCastError(source, "values.Value")
+		}
+		return v, nil
+	})
+}
+
+// wait steps the other tasks of the instance until ready reports true
+func wait(inst *types.ComponentInstance, ready func() bool) error {
+	for !ready() {
+		progressed, err := Step(inst)
+		if err != nil {
+			return err
+		}
+		if !progressed {
+			return types.TrapWith(trap.Deadlock, "deadlock: no task is able to make progress")
+		}
+	}
+	return nil
+}
+
+// CanonTaskReturn lifts the results of the current task and passes them to the caller
+func CanonTaskReturn(cx *types.CallContext, flatArgs []any) error {
+	task := cx.Task
+	if task == nil {
+		return types.TrapWith(trap.InvalidState, "task.return called outside of an async task")
+	}
+	if task.Returned {
+		return types.TrapWith(trap.InvalidState, "task.return called more than once")
+	}
+	vs, err := toValues(flatArgs)
+	if err != nil {
+		return err
+	}
+	results, err := LiftValues(cx, MaxFlatParams, values.NewIterator(vs...), task.FuncType.ResultTypes())
+	if err != nil {
+		return err
+	}
+	task.Returned = true
+	if task.OnReturn != nil {
+		task.OnReturn(results)
+	}
+	return nil
+}
+
+// CanonBackpressureSet enables or disables backpressure. Deferred tasks start on the next Step.
+func CanonBackpressureSet(inst *types.ComponentInstance, enabled bool) {
+	inst.Backpressure = enabled
+}
+
+// CanonYield lets the other tasks of the instance make progress
+func CanonYield(cx *types.CallContext) error {
+	_, err := Step(cx.Instance)
+	return err
+}
+
+func CanonWaitableSetNew(inst *types.ComponentInstance) (uint32, error) {
+	return inst.Table.Add(&types.WaitableSet{})
+}
+
+// CanonWaitableSetWait blocks until a member of the set has an event. The event index and payload
+// are stored at ptr and the event code is returned.
+func CanonWaitableSetWait(cx *types.CallContext, si uint32, ptr uint32) (uint32, error) {
+	set, err := types.TableGet[*types.WaitableSet](&cx.Instance.Table, si)
+	if err != nil {
+		return 0, err
+	}
+	set.NumWaiting++
+	err = wait(cx.Instance, set.HasPendingEvent)
+	set.NumWaiting--
+	if err != nil {
+		return 0, err
+	}
+	e, _ := set.Poll()
+	return storeEvent(cx, e, ptr)
+}
+
+// CanonWaitableSetPoll is the non-blocking form of CanonWaitableSetWait. It returns EventNone
+// if no member of the set has an event.
+func CanonWaitableSetPoll(cx *types.CallContext, si uint32, ptr uint32) (uint32, error) {
+	set, err := types.TableGet[*types.WaitableSet](&cx.Instance.Table, si)
+	if err != nil {
+		return 0, err
+	}
+	e, ok := set.Poll()
+	if !ok {
+		e = types.Event{Code: types.EventNone}
+	}
+	return storeEvent(cx, e, ptr)
+}
+
+func CanonWaitableSetDrop(inst *types.ComponentInstance, si uint32) error {
+	set, err := types.TableGet[*types.WaitableSet](&inst.Table, si)
+	if err != nil {
+		return err
+	}
+	if err := set.Drop(); err != nil {
+		return err
+	}
+	_, err = inst.Table.Remove(si)
+	return err
+}
+
+// CanonWaitableJoin moves waitable wi into set si. Index 0 removes the waitable from its set.
+func CanonWaitableJoin(inst *types.ComponentInstance, wi uint32, si uint32) error {
+	w, err := inst.Table.GetWaitable(wi)
+	if err != nil {
+		return err
+	}
+	if si == 0 {
+		w.Join(nil)
+		return nil
+	}
+	set, err := types.TableGet[*types.WaitableSet](&inst.Table, si)
+	if err != nil {
+		return err
+	}
+	w.Join(set)
+	return nil
+}
+
+func storeEvent(cx *types.CallContext, e types.Event, ptr uint32) (uint32, error) {
+	if ptr%SizeOfU32 != 0 {
+		return 0, types.TrapWith(trap.UnalignedPointer, "ptr %d not aligned to %d", ptr, SizeOfU32)
+	}
+	if uint64(ptr)+2*uint64(SizeOfU32) > uint64(cx.Options.Memory.Len()) {
+		return 0, types.TrapWith(trap.OutOfBoundsMemory, "ptr %d + 8 is greater than len(memory) %d", ptr, cx.Options.Memory.Len())
+	}
+	if err := StoreUInt32(cx, e.Index, ptr); err != nil {
+		return 0, err
+	}
+	if err := StoreUInt32(cx, e.Payload, ptr+SizeOfU32); err != nil {
+		return 0, err
+	}
+	return uint32(e.Code), nil
+}
+
+// CanonErrorContextNew creates an error-context with the debug message stored at ptr
+func CanonErrorContextNew(cx *types.CallContext, ptr uint32, taggedCodeUnits uint32) (uint32, error) {
+	message, err := LoadStringFromRange(cx, ptr, taggedCodeUnits)
+	if err != nil {
+		return 0, err
+	}
+	return cx.Instance.Table.Add(&types.ErrorContextElem{DebugMessage: message})
+}
+
+// CanonErrorContextDebugMessage stores the debug message of error-context i as a string at ptr
+func CanonErrorContextDebugMessage(cx *types.CallContext, i uint32, ptr uint32) error {
+	e, err := types.TableGet[*types.ErrorContextElem](&cx.Instance.Table, i)
+	if err != nil {
+		return err
+	}
+	return Store(cx, e.DebugMessage, types.NewString(), ptr)
+}
+
+func CanonErrorContextDrop(inst *types.ComponentInstance, i uint32) error {
+	_, err := types.TableRemove[*types.ErrorContextElem](&inst.Table, i)
+	return err
+}
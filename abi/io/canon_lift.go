@@ -1,30 +1,34 @@
 package io
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/patrickhuber/go-wasm/abi/kind"
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
 	"github.com/patrickhuber/go-wasm/internal/collections"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func CanonLift(
+	ctx context.Context,
 	opts *types.CanonicalOptions,
 	inst *types.ComponentInstance,
-	callee func(any) (any, error),
+	callee func(context.Context, any) (any, error),
 	ft types.FuncType,
 	args []any,
 	maxFlatParams int,
-	maxFlatResults int) ([]any, types.PostReturnFunc, error) {
+	maxFlatResults int) ([]any, func() error, error) {
 
 	if !inst.MayEnter {
-		return nil, nil, types.TrapWith("ComponentInstance MayEnter must be true")
+		return nil, nil, types.TrapWith(trap.CannotEnter, "ComponentInstance MayEnter must be true")
 	}
 	if !inst.MayLeave {
 		return nil, nil, fmt.Errorf("ComponentInstance MayLeave must be true")
 	}
 	cx := &types.CallContext{
+		Context:  ctx,
 		Options:  opts,
 		Instance: inst,
 	}
@@ -38,7 +42,7 @@ func CanonLift(
 
 	inst.MayLeave = true
 
-	flatResults, err := callee(flatArgs)
+	flatResults, err := callee(ctx, flatArgs)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -64,13 +68,13 @@ func CanonLift(
 		return nil, nil, err
 	}
 
-	postResult := func() {
+	postResult := func() error {
 		if opts.PostReturn != nil {
-			// python code has this set as:
-			// opts.PostReturn(flatResults)
-			opts.PostReturn()
+			if err := opts.PostReturn(ctx, results); err != nil {
+				return err
+			}
 		}
-		cx.ExitCall()
+		return cx.ExitCall()
 	}
 
 	return lifted, postResult, nil
@@ -113,7 +117,7 @@ func LiftValues(cx *types.CallContext, maxFlat int, vi values.ValueIterator, ts
 	}
 
 	if ptr != aligned {
-		return nil, types.TrapWith("ptr %d not aligned to %d", ptr, aligned)
+		return nil, types.TrapWith(trap.UnalignedPointer, "ptr %d not aligned to %d", ptr, aligned)
 	}
 
 	size, err := Size(tupleType)
@@ -122,22 +126,8 @@ func LiftValues(cx *types.CallContext, maxFlat int, vi values.ValueIterator, ts
 	}
 
 	if ptr+size > uint32(cx.Options.Memory.Len()) {
-		return nil, types.TrapWith("ptr %d + offset %d is greater than len(memory) %d", ptr, size, cx.Options.Memory.Len())
+		return nil, types.TrapWith(trap.OutOfBoundsMemory, "ptr %d + offset %d is greater than len(memory) %d", ptr, size, cx.Options.Memory.Len())
 	}
 
-	load, err := Load(cx, tupleType, ptr)
-	if err != nil {
-		return nil, err
-	}
-
-	m, ok := load.(map[string]any)
-	if !ok {
-		return nil, types.NewCastError(load, "map[string]any")
-	}
-
-	values := []any{}
-	for _, v := range m {
-		values = append(values, v)
-	}
-	return values, nil
+	return LoadTuple(cx, ptr, ts)
 }
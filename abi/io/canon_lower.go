@@ -1,19 +1,21 @@
 package io
 
 import (
+	"context"
 	"fmt"
-	"strconv"
 
 	"github.com/patrickhuber/go-wasm/abi/kind"
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
 	"github.com/patrickhuber/go-wasm/internal/collections"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func CanonLower(
+	ctx context.Context,
 	opts *types.CanonicalOptions,
 	inst *types.ComponentInstance,
-	callee func([]any) ([]any, types.PostReturnFunc, error),
+	callee func(context.Context, []any) ([]any, func() error, error),
 	callingImport bool,
 	ft types.FuncType,
 	flatArgs []any,
@@ -21,11 +23,12 @@ func CanonLower(
 	maxFlatResults int) ([]any, error) {
 
 	cx := &types.CallContext{
+		Context:  ctx,
 		Options:  opts,
 		Instance: inst,
 	}
 	if !inst.MayLeave {
-		return nil, types.TrapWith("CanonLower : ComponentInstance MayEnter must be true")
+		return nil, types.TrapWith(trap.CannotEnter, "CanonLower : ComponentInstance MayEnter must be true")
 	}
 	if !inst.MayEnter {
 		return nil, fmt.Errorf("CanonLower : ComponentInstance MayLeave must be true")
@@ -41,13 +44,19 @@ func CanonLower(
 		return nil, err
 	}
 
+	// the instance can not be reentered until the import returns
+	if callingImport {
+		inst.MayEnter = false
+		defer func() { inst.MayEnter = true }()
+	}
+
 	vi := values.NewIterator(args...)
 	lifted, err := LiftValues(cx, maxFlatParams, vi, ft.ParamTypes())
 	if err != nil {
 		return nil, err
 	}
 
-	results, postReturn, err := callee(lifted)
+	results, postReturn, err := callee(ctx, lifted)
 	if err != nil {
 		return nil, err
 	}
@@ -59,11 +68,11 @@ func CanonLower(
 	}
 	inst.MayLeave = true
 
-	postReturn()
-	cx.ExitCall()
-
-	if callingImport {
-		inst.MayEnter = true
+	if err := postReturn(); err != nil {
+		return nil, err
+	}
+	if err := cx.ExitCall(); err != nil {
+		return nil, err
 	}
 	return flatResults, nil
 }
@@ -93,10 +102,6 @@ func LowerValues(cx *types.CallContext, maxFlat int, vs []any, ts []types.ValTyp
 
 func LowerValuesToTuple(ts []types.ValType, vs []any, outParam values.ValueIterator, cx *types.CallContext) ([]any, error) {
 	tupleType := types.NewTuple(ts...)
-	tupleValue := map[string]any{}
-	for i, v := range vs {
-		tupleValue[strconv.Itoa(i)] = v
-	}
 
 	alignment, err := Alignment(tupleType)
 	if err != nil {
@@ -108,13 +113,16 @@ func LowerValuesToTuple(ts []types.ValType, vs []any, outParam values.ValueItera
 		return nil, err
 	}
 
+	// the pointer is returned when the caller allocates, otherwise the callee
+	// passed the pointer as an out param and nothing is returned
 	var ptr uint32
+	var flatVals []any
 	if outParam == nil {
-		ptr, err = cx.Options.Realloc(0, 0, alignment, size)
+		ptr, err = cx.Options.Realloc(cx.Context, 0, 0, alignment, size)
 		if err != nil {
 			return nil, err
 		}
-
+		flatVals = []any{values.U32(ptr)}
 	} else {
 		p, err := outParam.Next(kind.U32)
 		if err != nil {
@@ -136,5 +144,8 @@ func LowerValuesToTuple(ts []types.ValType, vs []any, outParam values.ValueItera
 	if ptr+size > uint32(cx.Options.Memory.Len()) {
 		return nil, fmt.Errorf("ptr %d is greater than memory size %d", ptr+size, cx.Options.Memory.Len())
 	}
-	return []any{ptr}, nil
+	if err := StoreTuple(cx, vs, ptr, ts); err != nil {
+		return nil, err
+	}
+	return flatVals, nil
 }
@@ -0,0 +1,237 @@
+package io
+
+import (
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// CanonStreamNew creates a stream and returns the readable end index in the low
+// and the writable end index in the high 32 bits
+func CanonStreamNew(inst *types.ComponentInstance, t types.Stream) (uint64, error) {
+	shared := types.NewSharedStream(t.Element())
+	ri, err := inst.Table.Add(&types.ReadableStreamEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	if err != nil {
+		return 0, err
+	}
+	wi, err := inst.Table.Add(&types.WritableStreamEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(ri) | uint64(wi)<<32, nil
+}
+
+// CanonStreamRead reads up to n elements into the buffer at ptr. It returns the packed
+// copy result or types.Blocked if async is set and no writer is ready.
+func CanonStreamRead(cx *types.CallContext, i uint32, ptr uint32, n uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.ReadableStreamEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	buffer, err := NewGuestBuffer(cx, e.Shared.Element(), ptr, n)
+	if err != nil {
+		return 0, err
+	}
+	return copyEnd(cx, &e.CopyEnd, i, types.EventStreamRead, buffer, false, async, func(onCopyDone types.OnCopyDone) error {
+		return e.Shared.Read(buffer, onCopyDone)
+	})
+}
+
+// CanonStreamWrite writes up to n elements from the buffer at ptr. It returns the packed
+// copy result or types.Blocked if async is set and no reader is ready.
+func CanonStreamWrite(cx *types.CallContext, i uint32, ptr uint32, n uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.WritableStreamEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	buffer, err := NewGuestBuffer(cx, e.Shared.Element(), ptr, n)
+	if err != nil {
+		return 0, err
+	}
+	return copyEnd(cx, &e.CopyEnd, i, types.EventStreamWrite, buffer, false, async, func(onCopyDone types.OnCopyDone) error {
+		return e.Shared.Write(buffer, onCopyDone)
+	})
+}
+
+func CanonStreamCancelRead(cx *types.CallContext, i uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.ReadableStreamEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	return cancelCopy(cx, &e.CopyEnd, async)
+}
+
+func CanonStreamCancelWrite(cx *types.CallContext, i uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.WritableStreamEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	return cancelCopy(cx, &e.CopyEnd, async)
+}
+
+func CanonStreamCloseReadable(inst *types.ComponentInstance, i uint32) error {
+	e, err := types.TableGet[*types.ReadableStreamEnd](&inst.Table, i)
+	if err != nil {
+		return err
+	}
+	return closeEnd(inst, &e.CopyEnd, i)
+}
+
+func CanonStreamCloseWritable(inst *types.ComponentInstance, i uint32) error {
+	e, err := types.TableGet[*types.WritableStreamEnd](&inst.Table, i)
+	if err != nil {
+		return err
+	}
+	return closeEnd(inst, &e.CopyEnd, i)
+}
+
+// CanonFutureNew creates a future and returns the readable end index in the low
+// and the writable end index in the high 32 bits
+func CanonFutureNew(inst *types.ComponentInstance, t types.Future) (uint64, error) {
+	shared := types.NewSharedStream(t.Element())
+	ri, err := inst.Table.Add(&types.ReadableFutureEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	if err != nil {
+		return 0, err
+	}
+	wi, err := inst.Table.Add(&types.WritableFutureEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(ri) | uint64(wi)<<32, nil
+}
+
+// CanonFutureRead reads the value of the future into ptr. It returns the copy result
+// or types.Blocked if async is set and the value has not been written.
+func CanonFutureRead(cx *types.CallContext, i uint32, ptr uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.ReadableFutureEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	buffer, err := NewGuestBuffer(cx, e.Shared.Element(), ptr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return copyEnd(cx, &e.CopyEnd, i, types.EventFutureRead, buffer, true, async, func(onCopyDone types.OnCopyDone) error {
+		return e.Shared.Read(buffer, onCopyDone)
+	})
+}
+
+// CanonFutureWrite writes the value at ptr to the future. It returns the copy result
+// or types.Blocked if async is set and the value has not been read.
+func CanonFutureWrite(cx *types.CallContext, i uint32, ptr uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.WritableFutureEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	buffer, err := NewGuestBuffer(cx, e.Shared.Element(), ptr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return copyEnd(cx, &e.CopyEnd, i, types.EventFutureWrite, buffer, true, async, func(onCopyDone types.OnCopyDone) error {
+		return e.Shared.Write(buffer, onCopyDone)
+	})
+}
+
+func CanonFutureCancelRead(cx *types.CallContext, i uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.ReadableFutureEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	return cancelCopy(cx, &e.CopyEnd, async)
+}
+
+func CanonFutureCancelWrite(cx *types.CallContext, i uint32, async bool) (uint32, error) {
+	e, err := types.TableGet[*types.WritableFutureEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return 0, err
+	}
+	return cancelCopy(cx, &e.CopyEnd, async)
+}
+
+func CanonFutureCloseReadable(inst *types.ComponentInstance, i uint32) error {
+	e, err := types.TableGet[*types.ReadableFutureEnd](&inst.Table, i)
+	if err != nil {
+		return err
+	}
+	return closeEnd(inst, &e.CopyEnd, i)
+}
+
+func CanonFutureCloseWritable(inst *types.ComponentInstance, i uint32) error {
+	e, err := types.TableGet[*types.WritableFutureEnd](&inst.Table, i)
+	if err != nil {
+		return err
+	}
+	return closeEnd(inst, &e.CopyEnd, i)
+}
+
+// copyEnd starts a copy on end i. The event raised when the copy finishes is returned
+// directly if it finishes before copyEnd returns.
+func copyEnd(
+	cx *types.CallContext,
+	e *types.CopyEnd,
+	i uint32,
+	code types.EventCode,
+	buffer types.Buffer,
+	future bool,
+	async bool,
+	copy func(types.OnCopyDone) error) (uint32, error) {
+
+	if e.Copying {
+		return 0, types.TrapWith(trap.InvalidState, "end %d is already copying", i)
+	}
+	if e.Done {
+		return 0, types.TrapWith(trap.InvalidState, "end %d is done", i)
+	}
+	e.Copying = true
+	onCopyDone := func(result types.CopyResult) {
+		e.Copying = false
+		payload := types.PackCopyResult(result, buffer.Progress())
+		if future {
+			payload = uint32(result)
+			if result == types.CopyCompleted {
+				e.Done = true
+			}
+		}
+		if result == types.CopyDropped {
+			e.Done = true
+		}
+		e.SetEvent(types.Event{Code: code, Index: i, Payload: payload})
+	}
+	if err := copy(onCopyDone); err != nil {
+		return 0, err
+	}
+	return complete(cx, &e.Waitable, async)
+}
+
+func cancelCopy(cx *types.CallContext, e *types.CopyEnd, async bool) (uint32, error) {
+	if !e.Copying && !e.HasPendingEvent() {
+		return 0, types.TrapWith(trap.InvalidState, "no copy to cancel")
+	}
+	if e.Copying {
+		e.Shared.Cancel()
+	}
+	return complete(cx, &e.Waitable, async)
+}
+
+// complete returns the payload of the pending event of w. Synchronous callers wait for the event.
+func complete(cx *types.CallContext, w *types.Waitable, async bool) (uint32, error) {
+	if !w.HasPendingEvent() {
+		if async {
+			return types.Blocked, nil
+		}
+		if err := wait(cx.Instance, w.HasPendingEvent); err != nil {
+			return 0, err
+		}
+	}
+	e, _ := w.TakeEvent()
+	return e.Payload, nil
+}
+
+func closeEnd(inst *types.ComponentInstance, e *types.CopyEnd, i uint32) error {
+	if e.Copying {
+		return types.TrapWith(trap.InvalidState, "end %d cannot be closed while copying", i)
+	}
+	e.Shared.Drop()
+	e.Join(nil)
+	_, err := inst.Table.Remove(i)
+	return err
+}
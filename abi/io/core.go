@@ -0,0 +1,287 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/abi/kind"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	abivalues "github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/patrickhuber/go-wasm/values"
+)
+
+// CoreOptions names the exports of a core module instance that back a set of canonical options.
+// An empty Realloc or PostReturn leaves the corresponding option unset.
+type CoreOptions struct {
+	Memory         string
+	Realloc        string
+	PostReturn     string
+	StringEncoding encoding.Encoding
+}
+
+// CoreAddresses are the store addresses of the core items that back a set of canonical options.
+// A nil Memory, Realloc or PostReturn leaves the corresponding option unset.
+type CoreAddresses struct {
+	Memory         *address.Memory
+	Realloc        *address.Function
+	PostReturn     *address.Function
+	StringEncoding encoding.Encoding
+}
+
+// NewCanonicalOptions returns canonical options whose memory, realloc and post-return
+// are the exports of the instantiated module m. Realloc and post-return call into the
+// guest, and the memory follows the guest memory when it grows.
+func NewCanonicalOptions(m *runtime.ModuleInstance, core CoreOptions) (*types.CanonicalOptions, error) {
+	memory, err := exportOf[*address.Memory](m, "memory", core.Memory)
+	if err != nil {
+		return nil, err
+	}
+	addrs := CoreAddresses{
+		Memory:         memory,
+		StringEncoding: core.StringEncoding,
+	}
+	if core.Realloc != "" {
+		realloc, err := exportOf[address.Function](m, "realloc", core.Realloc)
+		if err != nil {
+			return nil, err
+		}
+		addrs.Realloc = &realloc
+	}
+	if core.PostReturn != "" {
+		postReturn, err := exportOf[address.Function](m, "post-return", core.PostReturn)
+		if err != nil {
+			return nil, err
+		}
+		addrs.PostReturn = &postReturn
+	}
+	return NewStoreCanonicalOptions(m.Store(), addrs)
+}
+
+func exportOf[T address.ExternalValue](m *runtime.ModuleInstance, option, name string) (T, error) {
+	var zero T
+	export, ok := m.GetExport(name)
+	if !ok {
+		return zero, fmt.Errorf("%s export '%s' not found", option, name)
+	}
+	value, ok := export.Value.(T)
+	if !ok {
+		return zero, fmt.Errorf("%s export '%s' is a %T", option, name, export.Value)
+	}
+	return value, nil
+}
+
+// NewStoreCanonicalOptions returns canonical options backed by the core items at the given
+// addresses of store. Realloc and post-return call into the guest, and the memory follows
+// the guest memory when it grows.
+func NewStoreCanonicalOptions(store *runtime.Store, core CoreAddresses) (*types.CanonicalOptions, error) {
+	opts := &types.CanonicalOptions{
+		Memory:         &bytes.Buffer{},
+		StringEncoding: core.StringEncoding,
+	}
+	if core.Memory != nil {
+		if int(core.Memory.Address) >= len(store.Mems) {
+			return nil, fmt.Errorf("memory address %d out of range", core.Memory.Address)
+		}
+		rebind(store, opts, core.Memory)
+	}
+	if core.Realloc != nil {
+		if int(*core.Realloc) >= len(store.Funcs) {
+			return nil, fmt.Errorf("realloc address %d out of range", *core.Realloc)
+		}
+		realloc := *core.Realloc
+		opts.Realloc = func(ctx context.Context, originalPtr, originalSize, alignment, newSize uint32) (uint32, error) {
+			results, err := invoke(ctx, store, opts, core.Memory, realloc,
+				values.I32Const(originalPtr),
+				values.I32Const(originalSize),
+				values.I32Const(alignment),
+				values.I32Const(newSize))
+			if err != nil {
+				return 0, err
+			}
+			if len(results) != 1 {
+				return 0, types.TrapWith(trap.TypeMismatch, "realloc returned %d values", len(results))
+			}
+			ptr, ok := results[0].(values.I32Const)
+			if !ok {
+				return 0, types.NewCastError(results[0], "values.I32Const")
+			}
+			aligned, err := AlignTo(uint32(ptr), alignment)
+			if err != nil {
+				return 0, err
+			}
+			if uint32(ptr) != aligned {
+				return 0, types.TrapWith(trap.UnalignedPointer, "realloc returned ptr %d not aligned to %d", ptr, alignment)
+			}
+			if uint64(ptr)+uint64(newSize) > uint64(opts.Memory.Len()) {
+				return 0, types.TrapWith(trap.OutOfBoundsMemory, "realloc returned ptr %d + size %d out of bounds", ptr, newSize)
+			}
+			return uint32(ptr), nil
+		}
+	}
+	if core.PostReturn != nil {
+		if int(*core.PostReturn) >= len(store.Funcs) {
+			return nil, fmt.Errorf("post-return address %d out of range", *core.PostReturn)
+		}
+		postReturn := *core.PostReturn
+		opts.PostReturn = func(ctx context.Context, flatResults []any) error {
+			args, err := toCore(flatResults)
+			if err != nil {
+				return err
+			}
+			_, err = invoke(ctx, store, opts, core.Memory, postReturn, args...)
+			return err
+		}
+	}
+	return opts, nil
+}
+
+// CoreFunc returns a callee for CanonLift that invokes the exported function name of m
+// with the flat arguments and returns its flat results. opts is rebound to the exported
+// memory after the call.
+func CoreFunc(m *runtime.ModuleInstance, opts *types.CanonicalOptions, memory, name string) func(context.Context, any) (any, error) {
+	return func(ctx context.Context, args any) (any, error) {
+		addr, err := exportOf[address.Function](m, "function", name)
+		if err != nil {
+			return nil, err
+		}
+		mem, err := exportOf[*address.Memory](m, "memory", memory)
+		if err != nil {
+			return nil, err
+		}
+		return StoreFunc(m.Store(), opts, mem, addr)(ctx, args)
+	}
+}
+
+// StoreFunc returns a callee for CanonLift that invokes the function at addr with the flat
+// arguments and returns its flat results. opts is rebound to memory after the call.
+func StoreFunc(store *runtime.Store, opts *types.CanonicalOptions, memory *address.Memory, addr address.Function) func(context.Context, any) (any, error) {
+	return func(ctx context.Context, args any) (any, error) {
+		flatArgs, ok := args.([]any)
+		if !ok {
+			return nil, types.NewCastError(args, "[]any")
+		}
+		coreArgs, err := toCore(flatArgs)
+		if err != nil {
+			return nil, err
+		}
+		results, err := invoke(ctx, store, opts, memory, addr, coreArgs...)
+		if err != nil {
+			return nil, err
+		}
+		return fromCore(results)
+	}
+}
+
+// AllocLowered adds a host function to store that lowers the component function callee
+// with canon lower. Core arguments are lifted from opts and the results lowered into it.
+// callee receives the context of the Invoke that called the host function.
+// see https://github.com/WebAssembly/component-model/blob/main/design/mvp/CanonicalABI.md#canon-lower
+func AllocLowered(
+	store *runtime.Store,
+	opts *types.CanonicalOptions,
+	memory *address.Memory,
+	inst *types.ComponentInstance,
+	callee func(context.Context, []any) ([]any, func() error, error),
+	ft types.FuncType) (address.Function, error) {
+
+	flat, err := FlattenFuncTypeLower(ft, MaxFlatParams, MaxFlatResults)
+	if err != nil {
+		return 0, err
+	}
+	coreType := api.FuncType{
+		Parameters: api.ResultType{Types: coreTypes(flat.Params())},
+		Returns:    api.ResultType{Types: coreTypes(flat.Results())},
+	}
+	return store.AllocHostFunction(coreType, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+		// the guest may have grown its memory since the options were last bound
+		if memory != nil {
+			rebind(store, opts, memory)
+		}
+		flatArgs, err := fromCore(args)
+		if err != nil {
+			return nil, err
+		}
+		flatResults, err := CanonLower(ctx, opts, inst, callee, true, ft, flatArgs, MaxFlatParams, MaxFlatResults)
+		if err != nil {
+			return nil, err
+		}
+		return toCore(flatResults)
+	}), nil
+}
+
+func coreTypes(kinds []kind.Kind) []api.ValType {
+	ts := []api.ValType{}
+	for _, k := range kinds {
+		switch k {
+		case kind.U32:
+			ts = append(ts, api.I32Type)
+		case kind.U64:
+			ts = append(ts, api.I64Type)
+		case kind.Float32:
+			ts = append(ts, api.F32Type)
+		case kind.Float64:
+			ts = append(ts, api.F64Type)
+		}
+	}
+	return ts
+}
+
+// invoke calls the guest with ctx and rebinds the options memory in case the guest grew it
+func invoke(ctx context.Context, store *runtime.Store, opts *types.CanonicalOptions, memory *address.Memory, addr address.Function, args ...values.Value) ([]values.Value, error) {
+	results, err := store.Invoke(ctx, addr, args...)
+	if err != nil {
+		return nil, err
+	}
+	if memory != nil {
+		rebind(store, opts, memory)
+	}
+	return results, nil
+}
+
+func rebind(store *runtime.Store, opts *types.CanonicalOptions, memory *address.Memory) {
+	*opts.Memory = *bytes.NewBuffer(store.Mems[memory.Address].Data)
+}
+
+func toCore(flat []any) ([]values.Value, error) {
+	var vs []values.Value
+	for _, f := range flat {
+		switch v := f.(type) {
+		case abivalues.U32:
+			vs = append(vs, values.I32Const(v))
+		case abivalues.U64:
+			vs = append(vs, values.I64Const(v))
+		case abivalues.Float32:
+			vs = append(vs, values.F32Const(v))
+		case abivalues.Float64:
+			vs = append(vs, values.F64Const(v))
+		default:
+			return nil, types.NewCastError(f, "values.Value")
+		}
+	}
+	return vs, nil
+}
+
+func fromCore(vs []values.Value) ([]any, error) {
+	flat := []any{}
+	for _, value := range vs {
+		switch v := value.(type) {
+		case values.I32Const:
+			flat = append(flat, abivalues.U32(v))
+		case values.I64Const:
+			flat = append(flat, abivalues.U64(v))
+		case values.F32Const:
+			flat = append(flat, abivalues.Float32(v))
+		case values.F64Const:
+			flat = append(flat, abivalues.Float64(v))
+		default:
+			return nil, types.NewCastError(value, "numeric value")
+		}
+	}
+	return flat, nil
+}
@@ -0,0 +1,142 @@
+package io_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/runtime"
+	corevalues "github.com/patrickhuber/go-wasm/values"
+	"github.com/stretchr/testify/require"
+)
+
+// GuestModule has a bump allocating cabi_realloc, a function returning 42 and a post-return
+// function that records its argument at address 0
+func GuestModule() *api.Module {
+	i32 := func(n int) []api.ValType {
+		ts := []api.ValType{}
+		for i := 0; i < n; i++ {
+			ts = append(ts, api.I32Type)
+		}
+		return ts
+	}
+	return &api.Module{
+		Types: []*api.FuncType{
+			{Parameters: api.ResultType{Types: i32(4)}, Returns: api.ResultType{Types: i32(1)}},
+			{Returns: api.ResultType{Types: i32(1)}},
+			{Parameters: api.ResultType{Types: i32(1)}},
+		},
+		Funcs: []*api.Func{
+			{
+				Type:   0,
+				Locals: i32(1),
+				Body: &api.Expression{Instructions: []api.Instruction{
+					// ptr = (bump + align - 1) & -align
+					api.GlobalGet{Index: 0},
+					api.LocalGet{Index: 2},
+					api.I32Add{},
+					api.I32Const(1),
+					api.I32Sub{},
+					api.I32Const(0),
+					api.LocalGet{Index: 2},
+					api.I32Sub{},
+					api.I32And{},
+					api.LocalTee{Index: 4},
+					api.LocalGet{Index: 3},
+					api.I32Add{},
+					api.GlobalSet{Index: 0},
+					// copy the original allocation
+					api.LocalGet{Index: 0},
+					&api.If{Instructions: []api.Instruction{
+						api.LocalGet{Index: 4},
+						api.LocalGet{Index: 0},
+						api.LocalGet{Index: 1},
+						&api.MemoryCopy{},
+					}},
+					api.LocalGet{Index: 4},
+				}},
+			},
+			{
+				Type: 1,
+				Body: &api.Expression{Instructions: []api.Instruction{api.I32Const(42)}},
+			},
+			{
+				Type: 2,
+				Body: &api.Expression{Instructions: []api.Instruction{
+					api.I32Const(0),
+					api.LocalGet{Index: 0},
+					&api.Int32Store{},
+				}},
+			},
+		},
+		Mems:    []api.Mem{{Limits: api.Limits{Min: 1}}},
+		Globals: []api.Global{{Mutable: api.Var, Value: api.I32Type, Init: &api.Expression{Instructions: []api.Instruction{api.I32Const(16)}}}},
+		Exports: []api.Export{
+			{Name: "memory", Description: &api.MemExportDescription{MemIdx: 0}},
+			{Name: "bump", Description: &api.GlobalExportDescription{GlobalIdx: 0}},
+			{Name: "cabi_realloc", Description: &api.FuncExportDescription{FuncIdx: 0}},
+			{Name: "f", Description: &api.FuncExportDescription{FuncIdx: 1}},
+			{Name: "cabi_post_f", Description: &api.FuncExportDescription{FuncIdx: 2}},
+		},
+	}
+}
+
+func GuestOptions(t *testing.T) (*runtime.ModuleInstance, *types.CanonicalOptions) {
+	m, err := runtime.NewModuleInstance(&runtime.Store{}, GuestModule())
+	require.NoError(t, err)
+	opts, err := io.NewCanonicalOptions(m, io.CoreOptions{
+		Memory:         "memory",
+		Realloc:        "cabi_realloc",
+		PostReturn:     "cabi_post_f",
+		StringEncoding: encoding.UTF8,
+	})
+	require.NoError(t, err)
+	return m, opts
+}
+
+func TestCoreRealloc(t *testing.T) {
+	m, opts := GuestOptions(t)
+
+	hostImport := func(ctx context.Context, args []any) ([]any, func() error, error) {
+		return []any{"hello"}, func() error { return nil }, nil
+	}
+	ft := FuncType(nil, []types.ValType{String()})
+	flat, err := io.CanonLower(context.Background(), opts, Instance(), hostImport, false, ft, nil, 16, 16)
+	require.NoError(t, err)
+	require.Equal(t, []any{values.U32(16), values.U32(5)}, flat)
+
+	mem, err := m.Memory("memory")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(mem.Data[16:21]))
+
+	bump, err := m.Global("bump")
+	require.NoError(t, err)
+	require.Equal(t, corevalues.I32Const(21), bump.Value)
+}
+
+func TestCorePostReturn(t *testing.T) {
+	m, opts := GuestOptions(t)
+
+	ft := FuncType(nil, []types.ValType{U32()})
+	results, postReturn, err := io.CanonLift(context.Background(), opts, Instance(), io.CoreFunc(m, opts, "memory", "f"), ft, nil, 16, 1)
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(42)}, results)
+
+	mem, err := m.Memory("memory")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 0}, mem.Data[0:4])
+
+	require.NoError(t, postReturn())
+	require.Equal(t, []byte{42, 0, 0, 0}, mem.Data[0:4])
+}
+
+func TestCoreOptionsMissingExport(t *testing.T) {
+	m, err := runtime.NewModuleInstance(&runtime.Store{}, GuestModule())
+	require.NoError(t, err)
+	_, err = io.NewCanonicalOptions(m, io.CoreOptions{Memory: "memory", Realloc: "malloc"})
+	require.Error(t, err)
+}
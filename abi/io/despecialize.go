@@ -17,12 +17,6 @@ func Despecialize(t types.ValType) types.ValType {
 			})
 		}
 		return types.NewRecord(fields...)
-	case types.Union:
-		cases := []types.Case{}
-		for i, typ := range vt.Types() {
-			cases = append(cases, types.Case{Label: strconv.Itoa(i), Type: typ})
-		}
-		return types.NewVariant(cases...)
 	case types.Enum:
 		cases := []types.Case{}
 		for _, label := range vt.Labels() {
@@ -7,6 +7,14 @@ import (
 	"github.com/patrickhuber/go-wasm/abi/types"
 )
 
+// MaxFlatParams is the number of core parameters a function receives before its
+// parameters are passed through memory
+const MaxFlatParams = 16
+
+// MaxFlatResults is the number of core results a synchronous function returns before
+// results are passed through memory
+const MaxFlatResults = 1
+
 func FlattenTypes(ts []types.ValType) ([]kind.Kind, error) {
 	flat := []kind.Kind{}
 	for _, t := range ts {
@@ -37,7 +45,7 @@ func FlattenType(t types.ValType) ([]kind.Kind, error) {
 	case types.String:
 		return []kind.Kind{kind.U32, kind.U32}, nil
 	case types.List:
-		return []kind.Kind{kind.U32, kind.U32}, nil
+		return FlattenList(vt)
 	case types.Record:
 		return FlattenRecord(vt)
 	case types.Variant:
@@ -51,10 +59,35 @@ func FlattenType(t types.ValType) ([]kind.Kind, error) {
 		return flat, nil
 	case types.Own, types.Borrow:
 		return []kind.Kind{kind.U32}, nil
+	case types.Stream, types.Future, types.ErrorContext:
+		return []kind.Kind{kind.U32}, nil
 	}
 	return nil, fmt.Errorf("flatten_type: unable to match type %T", t)
 }
 
+// FlattenList flattens a fixed-size list to the flat types of its elements repeated length times.
+// Flattening stops once there are more flat types than MaxFlatParams, the caller passes such a
+// list through memory so only the count matters. Elements that flatten to nothing yield nothing
+// regardless of length.
+func FlattenList(l types.List) ([]kind.Kind, error) {
+	length, fixed := l.Length()
+	if !fixed {
+		return []kind.Kind{kind.U32, kind.U32}, nil
+	}
+	flattened, err := FlattenType(l.Type())
+	if err != nil {
+		return nil, err
+	}
+	flat := []kind.Kind{}
+	if len(flattened) == 0 {
+		return flat, nil
+	}
+	for i := uint32(0); i < length && len(flat) <= MaxFlatParams; i++ {
+		flat = append(flat, flattened...)
+	}
+	return flat, nil
+}
+
 func FlattenRecord(r types.Record) ([]kind.Kind, error) {
 	flat := []kind.Kind{}
 	for _, f := range r.Fields() {
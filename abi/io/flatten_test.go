@@ -1,6 +1,7 @@
 package io_test
 
 import (
+	"math"
 	"testing"
 
 	"github.com/patrickhuber/go-wasm/abi/io"
@@ -26,6 +27,12 @@ func TestFlatten(t *testing.T) {
 		{"p8_pf32_pf64_rtup_f32_f32", FuncType(params, []types.ValType{Tuple(Float32(), Float32())}), paramKinds, []kind.Kind{kind.Float32, kind.Float32}},
 		{"p8_pf32_pf64_rf32_rf32", FuncType(params, []types.ValType{Float32(), Float32()}), paramKinds, []kind.Kind{kind.Float32, kind.Float32}},
 
+		{"plist_f32x2", FuncType([]types.ValType{FixedList(Float32(), 2)}, []types.ValType{}), []kind.Kind{kind.Float32, kind.Float32}, []kind.Kind{}},
+		{"plist_u8x17", FuncType([]types.ValType{FixedList(U8(), 17)}, []types.ValType{}), Repeat(kind.U32, 17), []kind.Kind{}},
+		{"p8_pf32_pf64_rlist_u8x1", FuncType(params, []types.ValType{FixedList(U8(), 1)}), paramKinds, []kind.Kind{kind.U32}},
+		{"plist_u8x4294967295", FuncType([]types.ValType{FixedList(U8(), math.MaxUint32)}, []types.ValType{}), Repeat(kind.U32, 17), []kind.Kind{}},
+		{"plist_emptyx4294967295", FuncType([]types.ValType{FixedList(Record(), math.MaxUint32)}, []types.ValType{}), []kind.Kind{}, []kind.Kind{}},
+		{"rlist_u8x4294967295", FuncType([]types.ValType{}, []types.ValType{FixedList(U8(), math.MaxUint32)}), []kind.Kind{}, Repeat(kind.U32, 17)},
 		{"pu8x17", FuncType(Repeat[types.ValType](U8(), 17), []types.ValType{}), Repeat(kind.U32, 17), []kind.Kind{}},
 		{"pu8x17_rtup_u8_u8", FuncType(Repeat[types.ValType](U8(), 17), []types.ValType{Tuple(U8(), U8())}), Repeat(kind.U32, 17), Repeat(kind.U32, 2)},
 	}
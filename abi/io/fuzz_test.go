@@ -0,0 +1,323 @@
+package io_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// Source turns fuzzer input into choices. Once the input runs out every choice is zero,
+// which always picks the smallest type or value so generation terminates.
+type Source struct {
+	data []byte
+}
+
+func (s *Source) Byte() byte {
+	if len(s.data) == 0 {
+		return 0
+	}
+	b := s.data[0]
+	s.data = s.data[1:]
+	return b
+}
+
+func (s *Source) Intn(n int) int {
+	return int(s.Byte()) % n
+}
+
+func (s *Source) Uint64() uint64 {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = s.Byte()
+	}
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+func (s *Source) Encoding() encoding.Encoding {
+	encodings := []encoding.Encoding{encoding.UTF8, encoding.UTF16, encoding.Latin1Utf16}
+	return encodings[s.Intn(len(encodings))]
+}
+
+func labels(n int) []string {
+	ls := make([]string, n)
+	for i := range ls {
+		ls[i] = "l" + strconv.Itoa(i)
+	}
+	return ls
+}
+
+// GenType generates a type tree no deeper than depth
+func (s *Source) GenType(depth int) types.ValType {
+	primitives := []func() types.ValType{
+		func() types.ValType { return Bool() },
+		func() types.ValType { return S8() },
+		func() types.ValType { return U8() },
+		func() types.ValType { return S16() },
+		func() types.ValType { return U16() },
+		func() types.ValType { return S32() },
+		func() types.ValType { return U32() },
+		func() types.ValType { return S64() },
+		func() types.ValType { return U64() },
+		func() types.ValType { return Float32() },
+		func() types.ValType { return Float64() },
+		func() types.ValType { return Char() },
+		func() types.ValType { return String() },
+		func() types.ValType { return Enum(labels(1 + s.Intn(300))...) },
+		func() types.ValType { return Flags(labels(s.Intn(70))...) },
+	}
+	compounds := []func() types.ValType{
+		func() types.ValType { return List(s.GenType(depth - 1)) },
+		func() types.ValType { return FixedList(s.GenType(depth-1), uint32(1+s.Intn(4))) },
+		func() types.ValType { return Option(s.GenType(depth - 1)) },
+		func() types.ValType { return Result(s.genOptionalType(depth-1), s.genOptionalType(depth-1)) },
+		func() types.ValType {
+			var fields []types.Field
+			for i, label := range labels(s.Intn(4)) {
+				fields = append(fields, Field(label, s.GenType(depth-1-i%2)))
+			}
+			return Record(fields...)
+		},
+		func() types.ValType {
+			var ts []types.ValType
+			for i := 1 + s.Intn(4); i > 0; i-- {
+				ts = append(ts, s.GenType(depth-1))
+			}
+			return Tuple(ts...)
+		},
+		func() types.ValType {
+			var cases []types.Case
+			for _, label := range labels(1 + s.Intn(4)) {
+				cases = append(cases, Case(label, s.genOptionalType(depth-1)))
+			}
+			return Variant(cases...)
+		},
+	}
+	choice := s.Intn(len(primitives) + len(compounds))
+	if choice < len(primitives) || depth <= 0 {
+		return primitives[choice%len(primitives)]()
+	}
+	return compounds[choice-len(primitives)]()
+}
+
+func (s *Source) genOptionalType(depth int) types.ValType {
+	if s.Intn(3) == 0 {
+		return nil
+	}
+	return s.GenType(depth)
+}
+
+// GenValue generates a value of type t in the representation returned by lifting
+func (s *Source) GenValue(t types.ValType) any {
+	switch vt := t.(type) {
+	case types.Bool:
+		return s.Intn(2) == 1
+	case types.S8:
+		return int8(s.Byte())
+	case types.U8:
+		return s.Byte()
+	case types.S16:
+		return int16(s.Uint64())
+	case types.U16:
+		return uint16(s.Uint64())
+	case types.S32:
+		return int32(s.Uint64())
+	case types.U32:
+		return uint32(s.Uint64())
+	case types.S64:
+		return int64(s.Uint64())
+	case types.U64:
+		return s.Uint64()
+	case types.F32:
+		// NaNs are canonicalized so they do not round trip bit for bit
+		f := math.Float32frombits(uint32(s.Uint64()))
+		if f != f {
+			return float32(0)
+		}
+		return f
+	case types.F64:
+		f := math.Float64frombits(s.Uint64())
+		if math.IsNaN(f) {
+			return float64(0)
+		}
+		return f
+	case types.Char:
+		return s.genChar()
+	case types.String:
+		runes := make([]rune, s.Intn(8))
+		for i := range runes {
+			runes[i] = s.genChar()
+		}
+		return string(runes)
+	case types.Enum:
+		return map[string]any{vt.Labels()[s.Intn(len(vt.Labels()))]: nil}
+	case types.Flags:
+		flags := map[string]any{}
+		for _, label := range vt.Labels() {
+			flags[label] = s.Intn(2) == 1
+		}
+		return flags
+	case types.List:
+		// empty lists lift as nil
+		var list []any
+		n := s.Intn(4)
+		if length, fixed := vt.Length(); fixed {
+			n = int(length)
+		}
+		for i := n; i > 0; i-- {
+			list = append(list, s.GenValue(vt.Type()))
+		}
+		return list
+	case types.Option:
+		if s.Intn(2) == 0 {
+			return map[string]any{"none": nil}
+		}
+		return map[string]any{"some": s.GenValue(vt.Type())}
+	case types.Result:
+		if s.Intn(2) == 0 {
+			return map[string]any{"ok": s.genOptionalValue(vt.Ok())}
+		}
+		return map[string]any{"error": s.genOptionalValue(vt.Error())}
+	case types.Record:
+		record := types.RecordValue{}
+		for _, field := range vt.Fields() {
+			record = append(record, types.FieldValue{Label: field.Label, Value: s.GenValue(field.Type)})
+		}
+		return record
+	case types.Tuple:
+		tuple := []any{}
+		for _, t := range vt.Types() {
+			tuple = append(tuple, s.GenValue(t))
+		}
+		return tuple
+	case types.Variant:
+		c := vt.Cases()[s.Intn(len(vt.Cases()))]
+		return map[string]any{c.Label: s.genOptionalValue(c.Type)}
+	}
+	panic(fmt.Sprintf("unsupported type %T", t))
+}
+
+func (s *Source) genOptionalValue(t types.ValType) any {
+	if t == nil {
+		return nil
+	}
+	return s.GenValue(t)
+}
+
+func (s *Source) genChar() rune {
+	// bias towards ascii and latin1 so the latin1 encoding paths are exercised
+	switch s.Intn(3) {
+	case 0:
+		return rune(0x20 + s.Intn(0x5f))
+	case 1:
+		return rune(s.Byte())
+	}
+	r := rune(s.Uint64() % 0x110000)
+	if r >= 0xd800 && r <= 0xdfff {
+		return 0xfffd
+	}
+	return r
+}
+
+func FuzzingContext(enc encoding.Encoding) *types.CallContext {
+	heap := NewHeap(1 << 16)
+	return Context(CanonicalOptions(Memory(heap.Memory), Realloc(heap.ReAllocate), Encoding(enc)))
+}
+
+func AddSeeds(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{12, 2, 'h', 'i', 0, 0})
+	f.Add([]byte{0, 15, 2, 3, 1, 2, 3, 4, 5, 6, 7, 8})
+	f.Add([]byte{1, 20, 0, 3, 16, 6, 1, 12, 5, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	f.Add([]byte{2, 17, 1, 18, 19, 2, 4, 1, 3, 14, 65, 1, 0, 2, 1, 1, 1})
+	f.Add([]byte{0, 19, 2, 10, 13, 3, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+}
+
+func FuzzStoreLoad(f *testing.F) {
+	AddSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := &Source{data: data}
+		cx := FuzzingContext(s.Encoding())
+		vt := s.GenType(3)
+		v := s.GenValue(vt)
+
+		alignment, err := io.Alignment(vt)
+		require.NoError(t, err)
+		size, err := io.Size(vt)
+		require.NoError(t, err)
+		require.Zero(t, size%alignment, "size %d is not a multiple of alignment %d", size, alignment)
+
+		ptr, err := cx.Options.Realloc(context.Background(), 0, 0, alignment, size)
+		require.NoError(t, err)
+		require.NoError(t, io.Store(cx, v, vt, ptr))
+
+		got, err := io.Load(cx, vt, ptr)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	})
+}
+
+func FuzzLowerLiftFlat(f *testing.F) {
+	AddSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := &Source{data: data}
+		cx := FuzzingContext(s.Encoding())
+		vt := s.GenType(3)
+		v := s.GenValue(vt)
+
+		flat, err := io.LowerFlat(cx, v, vt)
+		require.NoError(t, err)
+
+		flatTypes, err := io.FlattenType(vt)
+		require.NoError(t, err)
+		require.Equal(t, len(flatTypes), len(flat))
+		for i, k := range flatTypes {
+			require.Equal(t, k, flat[i].Kind(), "flat value %d", i)
+		}
+
+		got, err := io.LiftFlat(cx, values.NewIterator(flat...), vt)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	})
+}
+
+func FuzzLowerValues(f *testing.F) {
+	AddSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := &Source{data: data}
+		cx := FuzzingContext(s.Encoding())
+		maxFlat := s.Intn(io.MaxFlatParams + 1)
+		var ts []types.ValType
+		var vs []any
+		for i := 1 + s.Intn(4); i > 0; i-- {
+			vt := s.GenType(2)
+			ts = append(ts, vt)
+			vs = append(vs, s.GenValue(vt))
+		}
+
+		flat, err := io.LowerValues(cx, maxFlat, vs, ts, nil)
+		require.NoError(t, err)
+
+		flatTypes, err := io.FlattenTypes(ts)
+		require.NoError(t, err)
+		if len(flatTypes) > maxFlat {
+			require.Equal(t, 1, len(flat), "spilled values lower to a single pointer")
+		}
+
+		flatValues := make([]values.Value, len(flat))
+		for i, fv := range flat {
+			flatValues[i] = fv.(values.Value)
+		}
+		got, err := io.LiftValues(cx, maxFlat, values.NewIterator(flatValues...), ts)
+		require.NoError(t, err)
+		require.Equal(t, vs, got)
+	})
+}
@@ -1,6 +1,7 @@
 package io_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/patrickhuber/go-wasm/abi/kind"
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/trap"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,20 +19,21 @@ func TestHandles(t *testing.T) {
 		MaxFlatParams  = 16
 	)
 	var dtorValue uint32
-	dtor := func(x uint32) {
+	dtor := func(ctx context.Context, x uint32) error {
 		dtorValue = x
+		return nil
 	}
 	inst := Instance()
 	rt := types.NewResourceType(dtor, Instance())
 	rt2 := types.NewResourceType(dtor, inst)
 	opts := Options()
-	hostImport := func(args []any) ([]any, types.PostReturnFunc, error) {
+	hostImport := func(ctx context.Context, args []any) ([]any, func() error, error) {
 		require.Equal(t, 2, len(args), "args")
 		require.Equal(t, uint32(42), args[0])
 		require.Equal(t, uint32(44), args[1])
-		return []any{uint32(45)}, func() {}, nil
+		return []any{uint32(45)}, func() error { return nil }, nil
 	}
-	coreWasm := func(val any) (any, error) {
+	coreWasm := func(ctx context.Context, val any) (any, error) {
 		args, ok := val.([]any)
 		if !ok {
 			return nil, fmt.Errorf("args must be an array")
@@ -77,7 +80,7 @@ func TestHandles(t *testing.T) {
 			values.U32(0),
 			values.U32(2),
 		}
-		results, err := io.CanonLower(opts, inst, hostImport, true, hostFunctionType, args, MaxFlatParams, MaxFlatResults)
+		results, err := io.CanonLower(ctx, opts, inst, hostImport, true, hostFunctionType, args, MaxFlatParams, MaxFlatResults)
 		if err != nil {
 			return nil, err
 		}
@@ -91,7 +94,7 @@ func TestHandles(t *testing.T) {
 		require.Equal(t, rep, uint32(45))
 
 		dtorValue = 0
-		err = io.CanonResourceDrop(inst, rt, 0)
+		err = io.CanonResourceDrop(context.Background(), inst, rt, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -110,7 +113,7 @@ func TestHandles(t *testing.T) {
 		require.Equal(t, 0, len(inst.Handles.Table(rt).Free))
 
 		dtorValue = 0
-		err = io.CanonResourceDrop(inst, rt, 2)
+		err = io.CanonResourceDrop(context.Background(), inst, rt, 2)
 		if err != nil {
 			return nil, err
 		}
@@ -133,7 +136,7 @@ func TestHandles(t *testing.T) {
 			Own(rt),
 			Own(rt)})
 	args := []any{uint32(42), uint32(43), uint32(44), uint32(13)}
-	got, _, err := io.CanonLift(opts, inst, coreWasm, ft, args, MaxFlatParams, MaxFlatResults)
+	got, _, err := io.CanonLift(context.Background(), opts, inst, coreWasm, ft, args, MaxFlatParams, MaxFlatResults)
 	require.Nil(t, err)
 
 	require.Equal(t, 3, len(got))
@@ -146,3 +149,129 @@ func TestHandles(t *testing.T) {
 	}
 	require.Equal(t, 4, len(inst.Handles.Table(rt).Free))
 }
+
+func TestHandleTableReuse(t *testing.T) {
+	rt := types.NewResourceType(nil, Instance())
+	table := &types.HandleTable{}
+	for rep := uint32(0); rep < 3; rep++ {
+		_, err := table.Add(&types.HandleElem{Rep: rep, Own: true})
+		require.NoError(t, err)
+	}
+	for _, i := range []uint32{0, 2} {
+		_, err := table.Remove(rt, i)
+		require.NoError(t, err)
+	}
+	for _, expected := range []uint32{2, 0, 3} {
+		i, err := table.Add(&types.HandleElem{Own: true})
+		require.NoError(t, err)
+		require.Equal(t, expected, i)
+	}
+	_, err := table.Remove(rt, 4)
+	require.Error(t, err)
+}
+
+func TestBorrowScope(t *testing.T) {
+	rt := types.NewResourceType(nil, Instance())
+	ft := FuncType([]types.ValType{Borrow(rt)}, nil)
+	tests := []struct {
+		name string
+		drop bool
+	}{
+		{"dropped", true},
+		{"leaked", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inst := Instance()
+			callee := func(ctx context.Context, args any) (any, error) {
+				i := args.([]any)[0].(values.Value).Value().(uint32)
+				rep, err := io.CanonResourceRep(inst, rt, i)
+				require.NoError(t, err)
+				require.Equal(t, uint32(42), rep)
+				if test.drop {
+					if err := io.CanonResourceDrop(ctx, inst, rt, i); err != nil {
+						return nil, err
+					}
+				}
+				return []any{}, nil
+			}
+			_, post, err := io.CanonLift(context.Background(), Options(), inst, callee, ft, []any{uint32(42)}, 16, 16)
+			require.NoError(t, err)
+			err = post()
+			if test.drop {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, "borrow count")
+			require.ErrorIs(t, err, &trap.Trap{Code: trap.OutstandingBorrow})
+		})
+	}
+}
+
+func TestLiftOwnBorrowed(t *testing.T) {
+	inst := Instance()
+	rt := types.NewResourceType(nil, Instance())
+	i, err := inst.Handles.Add(rt, &types.HandleElem{Rep: 42, Scope: &types.CallContext{}})
+	require.NoError(t, err)
+	_, err = io.LiftOwn(&types.CallContext{Instance: inst}, i, Own(rt))
+	require.ErrorContains(t, err, "borrowed")
+	require.ErrorIs(t, err, &trap.Trap{Code: trap.InvalidHandle})
+	require.Len(t, inst.Handles.Live(), 1)
+}
+
+func TestResourceDropReentrancy(t *testing.T) {
+	inst := Instance()
+	impl := Instance()
+	var dropped []uint32
+	rt := types.NewResourceType(func(ctx context.Context, rep uint32) error {
+		// the destructor runs in impl while the dropping instance is suspended
+		require.False(t, inst.MayEnter)
+		require.True(t, impl.MayEnter)
+		dropped = append(dropped, rep)
+		return nil
+	}, impl)
+
+	for _, rep := range []uint32{42, 43} {
+		_, err := io.CanonResourceNew(inst, rt, rep)
+		require.NoError(t, err)
+	}
+
+	impl.MayEnter = false
+	err := io.CanonResourceDrop(context.Background(), inst, rt, 0)
+	require.ErrorContains(t, err, "MayEnter")
+	require.ErrorIs(t, err, &trap.Trap{Code: trap.CannotEnter})
+
+	impl.MayEnter = true
+	require.NoError(t, io.CanonResourceDrop(context.Background(), inst, rt, 1))
+	require.True(t, inst.MayEnter)
+	require.Equal(t, []uint32{43}, dropped)
+
+	inst.MayLeave = false
+	_, err = io.CanonResourceNew(inst, rt, 44)
+	require.NoError(t, err)
+	err = io.CanonResourceDrop(context.Background(), inst, rt, 1)
+	require.ErrorContains(t, err, "MayLeave")
+	require.ErrorIs(t, err, &trap.Trap{Code: trap.CannotLeave})
+}
+
+func TestLiveHandles(t *testing.T) {
+	inst := Instance()
+	first := types.NewResourceType(nil, inst)
+	second := types.NewResourceType(nil, inst)
+	for _, rt := range []types.ResourceType{first, second} {
+		for rep := uint32(0); rep < 2; rep++ {
+			_, err := io.CanonResourceNew(inst, rt, rep)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, io.CanonResourceDrop(context.Background(), inst, first, 0))
+	require.NoError(t, io.CanonResourceDrop(context.Background(), inst, second, 1))
+
+	live := inst.Handles.Live()
+	require.Len(t, live, 2)
+	require.Equal(t, first, live[0].ResourceType)
+	require.Equal(t, uint32(1), live[0].Index)
+	require.Equal(t, uint32(1), live[0].Handle.Rep)
+	require.Equal(t, second, live[1].ResourceType)
+	require.Equal(t, uint32(0), live[1].Index)
+}
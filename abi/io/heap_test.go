@@ -2,6 +2,7 @@ package io_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
@@ -23,7 +24,7 @@ func NewHeap(size int) *Heap {
 	}
 }
 
-func (h *Heap) ReAllocate(originalPtr, originalSize, alignment, newSize uint32) (uint32, error) {
+func (h *Heap) ReAllocate(ctx context.Context, originalPtr, originalSize, alignment, newSize uint32) (uint32, error) {
 	if originalPtr != 0 && newSize < originalSize {
 		return io.AlignTo(originalPtr, alignment)
 	}
@@ -56,7 +57,7 @@ func TestHeap(t *testing.T) {
 		bytes    []byte
 	}
 	tests := []test{
-		{"list_record", List(Record()), []any{map[string]any{}, map[string]any{}, map[string]any{}}, []any{uint32(0), uint32(3)}, []byte{}},
+		{"list_record", List(Record()), []any{types.RecordValue{}, types.RecordValue{}, types.RecordValue{}}, []any{uint32(0), uint32(3)}, []byte{}},
 		{"list_bool", List(Bool()), []any{true, false, true}, []any{uint32(0), uint32(3)}, []byte{1, 0, 1}},
 		{"list_bool", List(Bool()), []any{true, false, true}, []any{uint32(0), uint32(3)}, []byte{1, 0, 2}},
 		{"list_bool", List(Bool()), []any{true, false, true}, []any{uint32(3), uint32(3)}, []byte{0xff, 0xff, 0xff, 1, 0, 1}},
@@ -79,10 +80,10 @@ func TestHeap(t *testing.T) {
 		{"list_tuple_u8_u16_u8_u32", List(Tuple(U8(), U16(), U8(), U32())), []any{NewTuple(byte(6), uint16(7), byte(8), uint32(9)), NewTuple(byte(4), uint16(5), byte(6), uint32(7))}, []any{uint32(0), uint32(2)}, []byte{6, 0xff, 7, 0, 8, 0xff, 0xff, 0xff, 9, 0, 0, 0, 4, 0xff, 5, 0, 6, 0xff, 0xff, 0xff, 7, 0, 0, 0}},
 		{"list_tuple_u16_u8", List(Tuple(U16(), U8())), []any{NewTuple(uint16(6), uint8(7)), NewTuple(uint16(8), uint8(9))}, []any{uint32(0), uint32(2)}, []byte{6, 0, 7, 0x0ff, 8, 0, 9, 0xff}},
 		{"list_tuple_tuple_u16_u8_u8", List(Tuple(Tuple(U16(), U8()), U8())), []any{NewTuple(NewTuple(uint16(4), uint8(5)), uint8(6)), NewTuple(NewTuple(uint16(7), uint8(8)), uint8(9))}, []any{uint32(0), uint32(2)}, []byte{4, 0, 5, 0xff, 6, 0xff, 7, 0, 8, 0xff, 9, 0xff}},
-		{"list_union_record_u8_tuple_u8_u16", List(Union(Record(), U8(), Tuple(U8(), U16()))), []any{map[string]any{"0": map[string]any{}}, map[string]any{"1": byte(42)}, map[string]any{"2": NewTuple(byte(6), uint16(7))}}, []any{uint32(0), uint32(3)}, []byte{0, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 0xff, 42, 0xff, 0xff, 0xff, 2, 0xff, 6, 0xff, 7, 0}},
-		{"list_union_u32_u8", List(Union(U32(), U8())), []any{map[string]any{"0": uint32(256)}, map[string]any{"1": uint8(42)}}, []any{uint32(0), uint32(2)}, []byte{0, 0xff, 0xff, 0xff, 0, 1, 0, 0, 1, 0xff, 0xff, 0xff, 42, 0xff, 0xff, 0xff}},
-		{"list_tuple_union_u8_tuple_u16_u8_u8", List(Tuple(Union(U8(), Tuple(U16(), U8())), U8())), []any{NewTuple(map[string]any{"1": NewTuple(uint16(5), uint8(6))}, uint8(7)), NewTuple(map[string]any{"0": uint8(8)}, uint8(9))}, []any{uint32(0), uint32(2)}, []byte{1, 0xff, 5, 0, 6, 0xff, 7, 0xff, 0, 0xff, 8, 0xff, 0xff, 0xff, 9, 0xff}},
-		{"list_union_u8", List(Union(U8())), []any{map[string]any{"0": uint8(6)}, map[string]any{"0": uint8(7)}, map[string]any{"0": uint8(8)}}, []any{uint32(0), uint32(3)}, []byte{0, 6, 0, 7, 0, 8}},
+		{"list_variant_record_u8_tuple_u8_u16", List(Variant(Case("0", Record()), Case("1", U8()), Case("2", Tuple(U8(), U16())))), []any{map[string]any{"0": types.RecordValue{}}, map[string]any{"1": byte(42)}, map[string]any{"2": NewTuple(byte(6), uint16(7))}}, []any{uint32(0), uint32(3)}, []byte{0, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 0xff, 42, 0xff, 0xff, 0xff, 2, 0xff, 6, 0xff, 7, 0}},
+		{"list_variant_u32_u8", List(Variant(Case("0", U32()), Case("1", U8()))), []any{map[string]any{"0": uint32(256)}, map[string]any{"1": uint8(42)}}, []any{uint32(0), uint32(2)}, []byte{0, 0xff, 0xff, 0xff, 0, 1, 0, 0, 1, 0xff, 0xff, 0xff, 42, 0xff, 0xff, 0xff}},
+		{"list_tuple_variant_u8_tuple_u16_u8_u8", List(Tuple(Variant(Case("0", U8()), Case("1", Tuple(U16(), U8()))), U8())), []any{NewTuple(map[string]any{"1": NewTuple(uint16(5), uint8(6))}, uint8(7)), NewTuple(map[string]any{"0": uint8(8)}, uint8(9))}, []any{uint32(0), uint32(2)}, []byte{1, 0xff, 5, 0, 6, 0xff, 7, 0xff, 0, 0xff, 8, 0xff, 0xff, 0xff, 9, 0xff}},
+		{"list_variant_u8", List(Variant(Case("0", U8()))), []any{map[string]any{"0": uint8(6)}, map[string]any{"0": uint8(7)}, map[string]any{"0": uint8(8)}}, []any{uint32(0), uint32(3)}, []byte{0, 6, 0, 7, 0, 8}},
 		{"list_flags", List(Flags()), []any{map[string]any{}, map[string]any{}, map[string]any{}}, []any{uint32(0), uint32(3)}, []byte{}},
 		{"list_tuple_flags_u8", List(Tuple(Flags(), U8())), []any{NewTuple(map[string]any{}, uint8(42)), NewTuple(map[string]any{}, uint8(43)), NewTuple(map[string]any{}, uint8(44))}, []any{uint32(0), uint32(3)}, []byte{42, 43, 44}},
 		{"list_flags", List(Flags("a", "b")), []any{map[string]any{"a": false, "b": false}, map[string]any{"a": false, "b": true}, map[string]any{"a": true, "b": true}}, []any{uint32(0), uint32(3)}, []byte{0, 2, 3}},
@@ -93,6 +94,9 @@ func TestHeap(t *testing.T) {
 		{"list_flags", List(Flags(Apply(Range(0, 17), strconv.Itoa)...)), Cross(Apply(Range(0, 17), strconv.Itoa), []any{true, false}), []any{uint32(0), uint32(2)}, []byte{0xff, 0xff, 0x3, 0, 0, 0, 0, 0}},
 		{"list_flags", List(Flags(Apply(Range(0, 33), strconv.Itoa)...)), Cross(Apply(Range(0, 33), strconv.Itoa), []any{true, false}), []any{uint32(0), uint32(2)}, []byte{0xff, 0xff, 0xff, 0xff, 0x1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
 		{"list_flags", List(Flags(Apply(Range(0, 33), strconv.Itoa)...)), Cross(Apply(Range(0, 33), strconv.Itoa), []any{true, false}), []any{uint32(0), uint32(2)}, []byte{0xff, 0xff, 0xff, 0xff, 0x3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"list_fixed_list_u16", List(FixedList(U16(), 2)), []any{[]any{uint16(1), uint16(2)}, []any{uint16(3), uint16(4)}}, []any{uint32(0), uint32(2)}, []byte{1, 0, 2, 0, 3, 0, 4, 0}},
+		{"list_tuple_u8_fixed_list_u32", List(Tuple(U8(), FixedList(U32(), 2))), []any{NewTuple(uint8(7), []any{uint32(8), uint32(9)})}, []any{uint32(0), uint32(1)}, []byte{7, 0xff, 0xff, 0xff, 8, 0, 0, 0, 9, 0, 0, 0}},
+		{"list_fixed_list_string", List(FixedList(String(), 1)), []any{[]any{"hi"}}, []any{uint32(0), uint32(1)}, []byte{8, 0, 0, 0, 2, 0, 0, 0, byte('h'), byte('i')}},
 
 		// {"", nil, []any{}, []any{}, []byte{}},
 	}
@@ -104,12 +108,8 @@ func TestHeap(t *testing.T) {
 	}
 }
 
-func NewTuple(values ...any) map[string]any {
-	m := map[string]any{}
-	for i, value := range values {
-		m[strconv.Itoa(i)] = value
-	}
-	return m
+func NewTuple(values ...any) []any {
+	return values
 }
 
 func testHeap(t *testing.T, vt types.ValType, expect any, args []any, bytes []byte) {
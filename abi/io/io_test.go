@@ -14,6 +14,7 @@ import (
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
 	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/trap"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,12 +26,12 @@ func Test(t *testing.T) {
 		v          any
 	}
 	tests := []testCase{
-		{"record", Record(), []any{}, map[string]any{}},
+		{"record", Record(), []any{}, types.RecordValue{}},
 		{"record", Record(Field("x", U8()), Field("y", U16()), Field("z", U32())),
-			[]any{uint32(1), uint32(2), uint32(3)}, map[string]any{"x": uint8(1), "y": uint16(2), "z": uint32(3)}},
+			[]any{uint32(1), uint32(2), uint32(3)}, types.RecordValue{{Label: "x", Value: uint8(1)}, {Label: "y", Value: uint16(2)}, {Label: "z", Value: uint32(3)}}},
 		{"tuple", Tuple(
 			Tuple(U8(), U8()),
-			U8()), []any{uint32(1), uint32(2), uint32(3)}, map[string]any{"0": map[string]any{"0": uint8(1), "1": uint8(2)}, "1": uint8(3)}},
+			U8()), []any{uint32(1), uint32(2), uint32(3)}, []any{[]any{uint8(1), uint8(2)}, uint8(3)}},
 		{"flags", Flags(), []any{}, map[string]any{}},
 		{"flags", Flags("a", "b"), []any{uint32(0)}, map[string]any{"a": false, "b": false}},
 		{"flags", Flags("a", "b"), []any{uint32(2)}, map[string]any{"a": false, "b": true}},
@@ -41,22 +42,26 @@ func Test(t *testing.T) {
 		{"variant", Variant(Case("x", U8()), Case("y", Float32()), Case("z", nil)), []any{uint32(0), uint32(256)}, map[string]any{"x": uint8(0)}},
 		{"variant", Variant(Case("x", U8()), Case("y", Float32()), Case("z", nil)), []any{uint32(1), uint32(0x4048f5c3)}, map[string]any{"y": float32(3.140000104904175)}},
 		{"variant", Variant(Case("x", U8()), Case("y", Float32()), Case("z", nil)), []any{uint32(2), uint32(0xffffffff)}, map[string]any{"z": nil}},
-		{"union", Union(U32(), U64()), []any{uint32(0), uint64(42)}, map[string]any{"0": uint32(42)}},
-		{"union", Union(U32(), U64()), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": uint32(0)}},
-		{"union", Union(U32(), U64()), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
-		{"union", Union(Float32(), U64()), []any{uint32(0), uint64(0x4048f5c3)}, map[string]any{"0": float32(3.140000104904175)}},
-		{"union", Union(Float32(), U64()), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": float32(0)}},
-		{"union", Union(Float32(), U64()), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
-		{"union", Union(Float64(), U64()), []any{uint32(0), uint64(0x40091EB851EB851F)}, map[string]any{"0": float64(3.14)}},
-		{"union", Union(Float64(), U64()), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": float64(1.69759663277e-313)}},
-		{"union", Union(Float64(), U64()), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
-		{"union", Union(U8()), []any{uint32(0), uint32(42)}, map[string]any{"0": uint8(42)}},
-		{"union", Union(U8()), []any{uint32(1), uint32(256)}, nil},
-		{"union", Union(U8()), []any{uint32(0), uint32(256)}, map[string]any{"0": uint8(0)}},
+		{"variant", Variant(Case("0", U32()), Case("1", U64())), []any{uint32(0), uint64(42)}, map[string]any{"0": uint32(42)}},
+		{"variant", Variant(Case("0", U32()), Case("1", U64())), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": uint32(0)}},
+		{"variant", Variant(Case("0", U32()), Case("1", U64())), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
+		{"variant", Variant(Case("0", Float32()), Case("1", U64())), []any{uint32(0), uint64(0x4048f5c3)}, map[string]any{"0": float32(3.140000104904175)}},
+		{"variant", Variant(Case("0", Float32()), Case("1", U64())), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": float32(0)}},
+		{"variant", Variant(Case("0", Float32()), Case("1", U64())), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
+		{"variant", Variant(Case("0", Float64()), Case("1", U64())), []any{uint32(0), uint64(0x40091EB851EB851F)}, map[string]any{"0": float64(3.14)}},
+		{"variant", Variant(Case("0", Float64()), Case("1", U64())), []any{uint32(0), uint64(1 << 35)}, map[string]any{"0": float64(1.69759663277e-313)}},
+		{"variant", Variant(Case("0", Float64()), Case("1", U64())), []any{uint32(1), uint64(1 << 35)}, map[string]any{"1": uint64(1 << 35)}},
+		{"variant", Variant(Case("0", U8())), []any{uint32(0), uint32(42)}, map[string]any{"0": uint8(42)}},
+		{"variant", Variant(Case("0", U8())), []any{uint32(1), uint32(256)}, nil},
+		{"variant", Variant(Case("0", U8())), []any{uint32(0), uint32(256)}, map[string]any{"0": uint8(0)}},
 		{"option", Option(Float32()), []any{uint32(0), float32(3.14)}, map[string]any{"none": nil}},
 		{"option", Option(Float32()), []any{uint32(1), float32(3.14)}, map[string]any{"some": float32(3.14)}},
 		{"result", Result(U8(), U32()), []any{uint32(0), uint32(42)}, map[string]any{"ok": uint8(42)}},
 		{"result", Result(U8(), U32()), []any{uint32(1), uint32(1000)}, map[string]any{"error": uint32(1000)}},
+		{"fixed_list", FixedList(U8(), 0), []any{}, []any{}},
+		{"fixed_list", FixedList(U8(), 3), []any{uint32(1), uint32(2), uint32(3)}, []any{uint8(1), uint8(2), uint8(3)}},
+		{"fixed_list", FixedList(Tuple(U8(), Float32()), 2), []any{uint32(1), float32(1.5), uint32(2), float32(2.5)}, []any{NewTuple(uint8(1), float32(1.5)), NewTuple(uint8(2), float32(2.5))}},
+		{"fixed_list", FixedList(FixedList(U16(), 2), 2), []any{uint32(1), uint32(2), uint32(3), uint32(4)}, []any{[]any{uint16(1), uint16(2)}, []any{uint16(3), uint16(4)}}},
 	}
 	vt := Variant(
 		Case("w", U8()),
@@ -79,6 +84,24 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestLowerRecordFieldOrder(t *testing.T) {
+	rt := Record(Field("x", U8()), Field("y", U8()))
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"swapped", types.RecordValue{{Label: "y", Value: uint8(2)}, {Label: "x", Value: uint8(1)}}},
+		{"missing", types.RecordValue{{Label: "x", Value: uint8(1)}}},
+		{"map", map[string]any{"x": uint8(1), "y": uint8(2)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := io.LowerFlat(Context(), test.v, rt)
+			require.Error(t, err)
+		})
+	}
+}
+
 func TestWithLower(t *testing.T) {
 	type testCase struct {
 		name       string
@@ -246,10 +269,6 @@ func CaseWith(label string, val types.ValType, refines string) types.Case {
 	return types.NewCaseRefines(label, val, refines)
 }
 
-func Union(valTypes ...types.ValType) types.Union {
-	return types.NewUnion(valTypes...)
-}
-
 func Option(valType types.ValType) types.Option {
 	return types.NewOption(valType)
 }
@@ -273,6 +292,10 @@ func List(vt types.ValType) types.List {
 	return types.NewList(vt)
 }
 
+func FixedList(vt types.ValType, length uint32) types.List {
+	return types.NewFixedList(vt, length)
+}
+
 func FuncType(params []types.ValType, results []types.ValType) types.FuncType {
 	toParameters := func(valTypes []types.ValType) []types.Parameter {
 		parameters := []types.Parameter{}
@@ -378,7 +401,7 @@ func test(t types.ValType, valsToLift []any, v any,
 	}
 
 	if vi.Index() != vi.Length() {
-		return types.TrapWith("value iterator index %d exceeds length %d", vi.Index(), vi.Length())
+		return types.TrapWith(trap.TypeMismatch, "value iterator index %d exceeds length %d", vi.Index(), vi.Length())
 	}
 	if !reflect.DeepEqual(got, v) {
 		return fmt.Errorf("initial lift_flat() expected %v but got %v", v, got)
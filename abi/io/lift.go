@@ -6,13 +6,21 @@ import (
 	"github.com/patrickhuber/go-wasm/abi/kind"
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func LiftOwn(cx *types.CallContext, i uint32, own types.Own) (uint32, error) {
-	h, err := cx.Instance.Handles.Remove(own.ResourceType(), i)
+	h, err := cx.Instance.Handles.Get(own.ResourceType(), i)
 	if err != nil {
 		return 0, err
 	}
+	// borrowed handles are scoped to the call that lent them and can not be transferred
+	if !h.Own {
+		return 0, types.TrapWith(trap.InvalidHandle, "handle %d is borrowed and can not be lifted as owned", i)
+	}
+	if _, err := cx.Instance.Handles.Remove(own.ResourceType(), i); err != nil {
+		return 0, err
+	}
 	return h.Rep, nil
 }
 
@@ -21,11 +29,54 @@ func LiftBorrow(cx *types.CallContext, i uint32, borrow types.Borrow) (uint32, e
 	if err != nil {
 		return 0, err
 	}
-	cx.LiftBorrowFrom(h)
+	// only owned handles are lent, a borrowed handle is already kept alive by its own lender
+	if h.Own {
+		cx.LiftBorrowFrom(h)
+	}
 	return h.Rep, nil
 }
 
+// LiftStream transfers the readable end i out of the instance table
+func LiftStream(cx *types.CallContext, i uint32) (*types.SharedStream, error) {
+	e, err := types.TableGet[*types.ReadableStreamEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return nil, err
+	}
+	return liftCopyEnd(cx, &e.CopyEnd, i)
+}
+
+// LiftFuture transfers the readable end i out of the instance table
+func LiftFuture(cx *types.CallContext, i uint32) (*types.SharedStream, error) {
+	e, err := types.TableGet[*types.ReadableFutureEnd](&cx.Instance.Table, i)
+	if err != nil {
+		return nil, err
+	}
+	return liftCopyEnd(cx, &e.CopyEnd, i)
+}
+
+func liftCopyEnd(cx *types.CallContext, e *types.CopyEnd, i uint32) (*types.SharedStream, error) {
+	if e.Copying {
+		return nil, types.TrapWith(trap.InvalidState, "end %d cannot be transferred while copying", i)
+	}
+	if e.Done {
+		return nil, types.TrapWith(trap.InvalidState, "end %d cannot be transferred when done", i)
+	}
+	e.Join(nil)
+	if _, err := cx.Instance.Table.Remove(i); err != nil {
+		return nil, err
+	}
+	return e.Shared, nil
+}
+
+func LiftErrorContext(cx *types.CallContext, i uint32) (*types.ErrorContextElem, error) {
+	return types.TableGet[*types.ErrorContextElem](&cx.Instance.Table, i)
+}
+
 func LiftFlat(cx *types.CallContext, vi values.ValueIterator, t types.ValType) (any, error) {
+	// tuples are flattened like records but their values are kept in order
+	if tuple, ok := t.(types.Tuple); ok {
+		return LiftFlatTuple(cx, vi, tuple.Types())
+	}
 	t = Despecialize(t)
 	switch vt := t.(type) {
 	case types.Bool:
@@ -55,6 +106,9 @@ func LiftFlat(cx *types.CallContext, vi values.ValueIterator, t types.ValType) (
 	case types.String:
 		return LiftFlatString(cx, vi)
 	case types.List:
+		if length, fixed := vt.Length(); fixed {
+			return LiftFlatFixedList(cx, vi, vt.Type(), length)
+		}
 		return LiftFlatList(cx, vi, vt.Type())
 	case types.Record:
 		return LiftFlatRecord(cx, vi, vt.Fields())
@@ -69,7 +123,7 @@ func LiftFlat(cx *types.CallContext, vi values.ValueIterator, t types.ValType) (
 		}
 		i, ok := v.(uint32)
 		if !ok {
-			return nil, types.TrapWith("unable to cast %T to uint32", v)
+			return nil, types.TrapWith(trap.TypeMismatch, "unable to cast %T to uint32", v)
 		}
 		return LiftOwn(cx, i, vt)
 	case types.Borrow:
@@ -81,9 +135,27 @@ func LiftFlat(cx *types.CallContext, vi values.ValueIterator, t types.ValType) (
 
 		i, ok := v.(uint32)
 		if !ok {
-			return nil, types.TrapWith("unable to cast %T to uint32", v)
+			return nil, types.TrapWith(trap.TypeMismatch, "unable to cast %T to uint32", v)
 		}
 		return LiftBorrow(cx, i, vt)
+	case types.Stream:
+		i, err := LiftFlatU32(vi)
+		if err != nil {
+			return nil, err
+		}
+		return LiftStream(cx, i)
+	case types.Future:
+		i, err := LiftFlatU32(vi)
+		if err != nil {
+			return nil, err
+		}
+		return LiftFuture(cx, i)
+	case types.ErrorContext:
+		i, err := LiftFlatU32(vi)
+		if err != nil {
+			return nil, err
+		}
+		return LiftErrorContext(cx, i)
 	}
 	return nil, fmt.Errorf("LiftFlat: unable to match type %T", t)
 }
@@ -243,6 +315,18 @@ func LiftFlatList(cx *types.CallContext, vi values.ValueIterator, t types.ValTyp
 	return LoadListFromRange(cx, ptr, length, t)
 }
 
+func LiftFlatFixedList(cx *types.CallContext, vi values.ValueIterator, t types.ValType, length uint32) (any, error) {
+	list := []any{}
+	for i := uint32(0); i < length; i++ {
+		element, err := LiftFlat(cx, vi, t)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, element)
+	}
+	return list, nil
+}
+
 func LiftFlatString(cx *types.CallContext, vi values.ValueIterator) (any, error) {
 	ptr, err := LiftFlatU32(vi)
 	if err != nil {
@@ -255,18 +339,32 @@ func LiftFlatString(cx *types.CallContext, vi values.ValueIterator) (any, error)
 	return LoadStringFromRange(cx, ptr, packedLength)
 }
 
-func LiftFlatRecord(cx *types.CallContext, vi values.ValueIterator, fields []types.Field) (any, error) {
-	record := map[string]any{}
+// LiftFlatRecord lifts the fields of a record in field order
+func LiftFlatRecord(cx *types.CallContext, vi values.ValueIterator, fields []types.Field) (types.RecordValue, error) {
+	record := make(types.RecordValue, 0, len(fields))
 	for _, f := range fields {
 		value, err := LiftFlat(cx, vi, f.Type)
 		if err != nil {
 			return nil, err
 		}
-		record[f.Label] = value
+		record = append(record, types.FieldValue{Label: f.Label, Value: value})
 	}
 	return record, nil
 }
 
+// LiftFlatTuple lifts the values of a tuple in order
+func LiftFlatTuple(cx *types.CallContext, vi values.ValueIterator, ts []types.ValType) ([]any, error) {
+	tuple := make([]any, 0, len(ts))
+	for _, t := range ts {
+		value, err := LiftFlat(cx, vi, t)
+		if err != nil {
+			return nil, err
+		}
+		tuple = append(tuple, value)
+	}
+	return tuple, nil
+}
+
 func LiftFlatVariant(cx *types.CallContext, vi values.ValueIterator, variant types.Variant) (any, error) {
 	flatTypes, err := FlattenType(variant)
 	if err != nil {
@@ -294,7 +392,7 @@ func LiftFlatVariant(cx *types.CallContext, vi values.ValueIterator, variant typ
 	}
 
 	if int(u32CaseIndex) >= len(variant.Cases()) {
-		return nil, types.TrapWith("case index %d exceeds bounds of cases %d", u32CaseIndex, len(variant.Cases()))
+		return nil, types.TrapWith(trap.InvalidDiscriminant, "case index %d exceeds bounds of cases %d", u32CaseIndex, len(variant.Cases()))
 	}
 
 	c := variant.Cases()[u32CaseIndex]
@@ -323,20 +421,17 @@ func LiftFlatVariant(cx *types.CallContext, vi values.ValueIterator, variant typ
 }
 
 func LiftFlatFlags(vi values.ValueIterator, f types.Flags) (any, error) {
-	var flat uint64 = 0
-	shift := 0
-	numFlags := NumI32Flags(f.Labels())
-	for i := 0; i < int(numFlags); i++ {
+	words := make([]uint32, NumI32Flags(f.Labels()))
+	for i := range words {
 		next, err := vi.Next(kind.U32)
 		if err != nil {
 			return nil, err
 		}
 		u32Next, ok := next.(uint32)
 		if !ok {
-			return nil, types.NewCastError(next, "int32")
+			return nil, types.NewCastError(next, "uint32")
 		}
-		flat |= (uint64(u32Next) << shift)
-		shift += 32
+		words[i] = u32Next
 	}
-	return UnpackFlagsFromInt(flat, f.Labels()), nil
+	return UnpackFlags(words, f.Labels()), nil
 }
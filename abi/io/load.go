@@ -8,9 +8,14 @@ import (
 
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func Load(cx *types.CallContext, t types.ValType, ptr uint32) (any, error) {
+	// tuples are laid out like records but their values are kept in order
+	if tuple, ok := t.(types.Tuple); ok {
+		return LoadTuple(cx, ptr, tuple.Types())
+	}
 	t = Despecialize(t)
 
 	switch vt := t.(type) {
@@ -41,6 +46,9 @@ func Load(cx *types.CallContext, t types.ValType, ptr uint32) (any, error) {
 	case types.String:
 		return LoadString(cx, ptr)
 	case types.List:
+		if length, fixed := vt.Length(); fixed {
+			return LoadListFromRange(cx, ptr, length, vt.Type())
+		}
 		return LoadList(cx, ptr, vt.Type())
 	case types.Record:
 		return LoadRecord(cx, ptr, vt.Fields())
@@ -60,6 +68,24 @@ func Load(cx *types.CallContext, t types.ValType, ptr uint32) (any, error) {
 			return nil, err
 		}
 		return LiftBorrow(cx, i, vt)
+	case types.Stream:
+		i, err := LoadUInt32(cx, ptr)
+		if err != nil {
+			return nil, err
+		}
+		return LiftStream(cx, i)
+	case types.Future:
+		i, err := LoadUInt32(cx, ptr)
+		if err != nil {
+			return nil, err
+		}
+		return LiftFuture(cx, i)
+	case types.ErrorContext:
+		i, err := LoadUInt32(cx, ptr)
+		if err != nil {
+			return nil, err
+		}
+		return LiftErrorContext(cx, i)
 	}
 	return nil, fmt.Errorf("unrecognized type %T", t)
 }
@@ -86,10 +112,10 @@ func LoadChar(cx *types.CallContext, ptr uint32, t types.ValType) (any, error) {
 
 func ConvertU32ToRune(u32 uint32) (rune, error) {
 	if u32 >= 0x110000 {
-		return 0, types.TrapWith("u32 %d >= 0x110000", u32)
+		return 0, types.TrapWith(trap.InvalidChar, "u32 %d >= 0x110000", u32)
 	}
 	if 0xd800 <= u32 && u32 <= 0xdfff {
-		return 0, types.TrapWith(" 0xd800 <= %d <= 0xdfff", u32)
+		return 0, types.TrapWith(trap.InvalidChar, " 0xd800 <= %d <= 0xdfff", u32)
 	}
 	return rune(u32), nil
 }
@@ -241,11 +267,11 @@ func LoadStringFromRange(cx *types.CallContext, ptr, taggedCodeUnits uint32) (st
 	}
 
 	if ptr != align {
-		return "", types.TrapWith("error aligning ptr %d to %d", ptr, uint32(codec.Alignment()))
+		return "", types.TrapWith(trap.UnalignedPointer, "error aligning ptr %d to %d", ptr, uint32(codec.Alignment()))
 	}
 
 	if ptr+byteLength > uint32(cx.Options.Memory.Len()) {
-		return "", types.TrapWith("destination %d > memory size %d", ptr+byteLength, cx.Options.Memory.Len())
+		return "", types.TrapWith(trap.OutOfBoundsMemory, "destination %d > memory size %d", ptr+byteLength, cx.Options.Memory.Len())
 	}
 
 	buf := cx.Options.Memory.Bytes()[ptr : ptr+byteLength]
@@ -276,7 +302,7 @@ func LoadListFromRange(cx *types.CallContext, ptr uint32, length uint32, element
 		return nil, err
 	}
 	if ptr != align {
-		return nil, types.TrapWith("unable to align ptr %d with %d", ptr, alignment)
+		return nil, types.TrapWith(trap.UnalignedPointer, "unable to align ptr %d with %d", ptr, alignment)
 	}
 
 	size, err := Size(elementType)
@@ -284,7 +310,7 @@ func LoadListFromRange(cx *types.CallContext, ptr uint32, length uint32, element
 		return nil, err
 	}
 	if ptr+length*size > uint32(cx.Options.Memory.Len()) {
-		return nil, types.TrapWith("destination size %d is greater than memory size %d", ptr+length*size, cx.Options.Memory.Len())
+		return nil, types.TrapWith(trap.OutOfBoundsMemory, "destination size %d is greater than memory size %d", ptr+length*size, cx.Options.Memory.Len())
 	}
 	var list []any
 	var i uint32 = 0
@@ -298,10 +324,28 @@ func LoadListFromRange(cx *types.CallContext, ptr uint32, length uint32, element
 	return list, nil
 }
 
-func LoadRecord(cx *types.CallContext, ptr uint32, fields []types.Field) (map[string]any, error) {
-	record := map[string]any{}
-	for _, field := range fields {
-		alignment, err := Alignment(field.Type)
+// LoadRecord loads the fields of a record at ptr in field order
+func LoadRecord(cx *types.CallContext, ptr uint32, fields []types.Field) (types.RecordValue, error) {
+	ts := make([]types.ValType, len(fields))
+	for i, field := range fields {
+		ts[i] = field.Type
+	}
+	vs, err := LoadTuple(cx, ptr, ts)
+	if err != nil {
+		return nil, err
+	}
+	record := make(types.RecordValue, len(fields))
+	for i, field := range fields {
+		record[i] = types.FieldValue{Label: field.Label, Value: vs[i]}
+	}
+	return record, nil
+}
+
+// LoadTuple loads the fields laid out like a record at ptr and returns them in field order
+func LoadTuple(cx *types.CallContext, ptr uint32, ts []types.ValType) ([]any, error) {
+	vs := make([]any, 0, len(ts))
+	for _, t := range ts {
+		alignment, err := Alignment(t)
 		if err != nil {
 			return nil, err
 		}
@@ -309,18 +353,18 @@ func LoadRecord(cx *types.CallContext, ptr uint32, fields []types.Field) (map[st
 		if err != nil {
 			return nil, err
 		}
-		val, err := Load(cx, field.Type, ptr)
+		val, err := Load(cx, t, ptr)
 		if err != nil {
 			return nil, err
 		}
-		record[field.Label] = val
-		size, err := Size(field.Type)
+		vs = append(vs, val)
+		size, err := Size(t)
 		if err != nil {
 			return nil, err
 		}
 		ptr += size
 	}
-	return record, nil
+	return vs, nil
 }
 
 // LoadVariant loads the variant from the context at the ptr
@@ -353,7 +397,7 @@ func LoadVariant(cx *types.CallContext, ptr uint32, v types.Variant) (map[string
 
 	ptr += discSize
 	if u32CaseIndex >= uint32(len(v.Cases())) {
-		return nil, types.TrapWith("case index %d is outside the bounds of the case index length %d", u32CaseIndex, len(v.Cases()))
+		return nil, types.TrapWith(trap.InvalidDiscriminant, "case index %d is outside the bounds of the case index length %d", u32CaseIndex, len(v.Cases()))
 	}
 
 	c := v.Cases()[u32CaseIndex]
@@ -413,40 +457,40 @@ func LoadFlags(cx *types.CallContext, ptr uint32, flags types.Flags) (map[string
 		return nil, err
 	}
 
-	i, err := LoadIntWithSize(cx, ptr, size, false)
-	if err != nil {
-		return nil, err
+	// flags up to 32 labels are a single integer of the flag size, more labels are a sequence of u32
+	words := make([]uint32, NumI32Flags(flags.Labels()))
+	if size == 0 {
+		return map[string]any{}, nil
 	}
-
-	var ui uint64 = 0
-	switch size {
-	case 1:
-		ui = uint64(i.(uint8))
-	case 2:
-		ui = uint64(i.(uint16))
-	case 4:
-		ui = uint64(i.(uint32))
-	case 8:
-		ui = i.(uint64)
-	}
-	flagMap := map[string]any{}
-	for _, label := range flags.Labels() {
-		v := ui & 1
-		b := false
-		if v > 0 {
-			b = true
+	if size <= 4 {
+		i, err := LoadIntWithSize(cx, ptr, size, false)
+		if err != nil {
+			return nil, err
+		}
+		switch v := i.(type) {
+		case uint8:
+			words[0] = uint32(v)
+		case uint16:
+			words[0] = uint32(v)
+		case uint32:
+			words[0] = v
+		}
+		return UnpackFlags(words, flags.Labels()), nil
+	}
+	for i := range words {
+		words[i], err = LoadUInt32(cx, ptr+uint32(4*i))
+		if err != nil {
+			return nil, err
 		}
-		flagMap[label] = b
-		ui >>= 1
 	}
-	return flagMap, nil
+	return UnpackFlags(words, flags.Labels()), nil
 }
 
-func UnpackFlagsFromInt(i uint64, labels []string) map[string]any {
+// UnpackFlags maps each label to its bit in the packed words
+func UnpackFlags(words []uint32, labels []string) map[string]any {
 	unpacked := map[string]any{}
-	for _, label := range labels {
-		unpacked[label] = (i&1 == 1)
-		i >>= 1
+	for i, label := range labels {
+		unpacked[label] = words[i/32]>>(i%32)&1 == 1
 	}
 	return unpacked
 }
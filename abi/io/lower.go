@@ -8,9 +8,14 @@ import (
 	"github.com/patrickhuber/go-wasm/abi/kind"
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 func LowerFlat(cx *types.CallContext, v any, t types.ValType) ([]values.Value, error) {
+	// tuples are flattened like records but their values are kept in order
+	if tuple, ok := t.(types.Tuple); ok {
+		return LowerFlatTuple(cx, v, tuple.Types())
+	}
 	t = Despecialize(t)
 	switch vt := t.(type) {
 	case types.Bool:
@@ -40,6 +45,9 @@ func LowerFlat(cx *types.CallContext, v any, t types.ValType) ([]values.Value, e
 	case types.String:
 		return LowerString(cx, v)
 	case types.List:
+		if length, fixed := vt.Length(); fixed {
+			return LowerFlatFixedList(cx, v, vt.Type(), length)
+		}
 		return LowerFlatList(cx, v, vt.Type())
 	case types.Record:
 		return LowerFlatRecord(cx, v, vt)
@@ -59,6 +67,12 @@ func LowerFlat(cx *types.CallContext, v any, t types.ValType) ([]values.Value, e
 			return nil, err
 		}
 		return []values.Value{values.U32(borrow)}, nil
+	case types.Stream, types.Future, types.ErrorContext:
+		i, err := LowerAsync(cx, v, vt)
+		if err != nil {
+			return nil, err
+		}
+		return []values.Value{values.U32(i)}, nil
 	}
 	return nil, fmt.Errorf("LowerFlat: unable to match type %T", t)
 }
@@ -203,14 +217,33 @@ func LowerFlatList(cx *types.CallContext, v any, t types.ValType) ([]values.Valu
 	}, nil
 }
 
-func LowerFlatRecord(cx *types.CallContext, v any, r types.Record) ([]values.Value, error) {
+func LowerFlatFixedList(cx *types.CallContext, v any, t types.ValType, length uint32) ([]values.Value, error) {
+	slice, err := ToSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(slice)) != length {
+		return nil, types.TrapWith(trap.TypeMismatch, "list has %d elements, expected %d", len(slice), length)
+	}
 	var flat []values.Value
-	vMap, ok := v.(map[string]any)
-	if !ok {
-		return nil, types.NewCastError(v, "map[string]any")
+	for _, element := range slice {
+		f, err := LowerFlat(cx, element, t)
+		if err != nil {
+			return nil, err
+		}
+		flat = append(flat, f...)
 	}
-	for _, field := range r.Fields() {
-		lowerFields, err := LowerFlat(cx, vMap[field.Label], field.Type)
+	return flat, nil
+}
+
+func LowerFlatRecord(cx *types.CallContext, v any, r types.Record) ([]values.Value, error) {
+	vs, err := ToRecordValues(v, r)
+	if err != nil {
+		return nil, err
+	}
+	var flat []values.Value
+	for i, field := range r.Fields() {
+		lowerFields, err := LowerFlat(cx, vs[i], field.Type)
 		if err != nil {
 			return nil, err
 		}
@@ -219,24 +252,38 @@ func LowerFlatRecord(cx *types.CallContext, v any, r types.Record) ([]values.Val
 	return flat, nil
 }
 
+// LowerFlatTuple lowers the values of a tuple in order
+func LowerFlatTuple(cx *types.CallContext, v any, ts []types.ValType) ([]values.Value, error) {
+	vs, err := ToSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) != len(ts) {
+		return nil, fmt.Errorf("LowerFlatTuple: have %d values, want %d", len(vs), len(ts))
+	}
+	var flat []values.Value
+	for i, t := range ts {
+		lowered, err := LowerFlat(cx, vs[i], t)
+		if err != nil {
+			return nil, err
+		}
+		flat = append(flat, lowered...)
+	}
+	return flat, nil
+}
+
 func LowerFlatFlags(cx *types.CallContext, v any, f types.Flags) ([]values.Value, error) {
 	vMap, ok := v.(map[string]any)
 	if !ok {
 		return nil, types.NewCastError(v, "map[string]any")
 	}
-	packed, err := PackFlagsIntoInt(vMap, f)
+	words, err := PackFlags(vMap, f)
 	if err != nil {
 		return nil, err
 	}
 	var flat []values.Value
-	numFlags := NumI32Flags(f.Labels())
-	for i := 0; i < int(numFlags); i++ {
-		u32 := values.U32(packed & 0xffffffff)
-		flat = append(flat, u32)
-		packed >>= 32
-	}
-	if packed != 0 {
-		return nil, fmt.Errorf("invalid flag value")
+	for _, word := range words {
+		flat = append(flat, values.U32(word))
 	}
 	return flat, nil
 }
@@ -269,6 +316,31 @@ func LowerBorrow(cx *types.CallContext, rep any, t types.Borrow) (uint32, error)
 	return cx.Instance.Handles.Add(t.ResourceType(), h)
 }
 
+// LowerAsync adds a readable stream end, readable future end or error-context to the instance table
+func LowerAsync(cx *types.CallContext, v any, t types.ValType) (uint32, error) {
+	switch t.(type) {
+	case types.Stream:
+		shared, ok := v.(*types.SharedStream)
+		if !ok {
+			return 0, types.NewCastError(v, "*types.SharedStream")
+		}
+		return cx.Instance.Table.Add(&types.ReadableStreamEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	case types.Future:
+		shared, ok := v.(*types.SharedStream)
+		if !ok {
+			return 0, types.NewCastError(v, "*types.SharedStream")
+		}
+		return cx.Instance.Table.Add(&types.ReadableFutureEnd{CopyEnd: types.CopyEnd{Shared: shared}})
+	case types.ErrorContext:
+		e, ok := v.(*types.ErrorContextElem)
+		if !ok {
+			return 0, types.NewCastError(v, "*types.ErrorContextElem")
+		}
+		return cx.Instance.Table.Add(e)
+	}
+	return 0, fmt.Errorf("LowerAsync: unable to match type %T", t)
+}
+
 func LowerFlatVariant(cx *types.CallContext, v any, variant types.Variant) ([]values.Value, error) {
 	caseIndex, caseValue, err := MatchCase(v, variant.Cases())
 	if err != nil {
@@ -0,0 +1,349 @@
+package io_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// Reference holds the outputs recorded from the component-model reference definitions by testdata/reference.py
+type Reference struct {
+	Seed       int             `json:"seed"`
+	MemorySize int             `json:"memorySize"`
+	Cases      []ReferenceCase `json:"cases"`
+}
+
+type ReferenceCase struct {
+	Type     any                      `json:"type"`
+	Value    any                      `json:"value"`
+	Encoding string                   `json:"encoding"`
+	Ptr      uint32                   `json:"ptr"`
+	Memory   string                   `json:"memory"`
+	Flat     []map[string]json.Number `json:"flat"`
+}
+
+func TestReference(t *testing.T) {
+	f, err := os.Open("testdata/reference.json")
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("testdata/reference.json has not been recorded, run testdata/reference.py with the component-model submodule")
+	}
+	require.NoError(t, err)
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	var reference Reference
+	require.NoError(t, decoder.Decode(&reference))
+
+	for i, c := range reference.Cases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			vt, err := DecodeType(c.Type)
+			require.NoError(t, err)
+			v, err := DecodeValue(vt, c.Value)
+			require.NoError(t, err)
+			enc, err := DecodeEncoding(c.Encoding)
+			require.NoError(t, err)
+
+			// store must lay out the value byte for byte like the reference
+			heap := NewHeap(reference.MemorySize)
+			cx := Context(CanonicalOptions(Memory(heap.Memory), Realloc(heap.ReAllocate), Encoding(enc)))
+			alignment, err := io.Alignment(vt)
+			require.NoError(t, err)
+			size, err := io.Size(vt)
+			require.NoError(t, err)
+			ptr, err := heap.ReAllocate(context.Background(), 0, 0, alignment, size)
+			require.NoError(t, err)
+			require.Equal(t, c.Ptr, ptr)
+			require.NoError(t, io.Store(cx, v, vt, ptr))
+			require.Equal(t, c.Memory, hex.EncodeToString(heap.Memory.Bytes()[:heap.LastAlloc]))
+
+			got, err := io.Load(cx, vt, ptr)
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+
+			// lowering must produce the same core values
+			heap = NewHeap(reference.MemorySize)
+			cx = Context(CanonicalOptions(Memory(heap.Memory), Realloc(heap.ReAllocate), Encoding(enc)))
+			flat, err := io.LowerFlat(cx, v, vt)
+			require.NoError(t, err)
+			expected, err := DecodeFlat(c.Flat)
+			require.NoError(t, err)
+			require.Equal(t, expected, flat)
+
+			got, err = io.LiftFlat(cx, values.NewIterator(flat...), vt)
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+		})
+	}
+}
+
+func DecodeEncoding(name string) (encoding.Encoding, error) {
+	switch name {
+	case "utf8":
+		return encoding.UTF8, nil
+	case "utf16":
+		return encoding.UTF16, nil
+	case "latin1+utf16":
+		return encoding.Latin1Utf16, nil
+	}
+	return encoding.None, fmt.Errorf("unknown encoding %s", name)
+}
+
+// DecodeType reads the json type representation written by testdata/reference.py
+func DecodeType(raw any) (types.ValType, error) {
+	switch t := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		primitives := map[string]types.ValType{
+			"bool": Bool(), "s8": S8(), "u8": U8(), "s16": S16(), "u16": U16(),
+			"s32": S32(), "u32": U32(), "s64": S64(), "u64": U64(),
+			"f32": Float32(), "f64": Float64(), "char": Char(), "string": String(),
+		}
+		vt, ok := primitives[t]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", t)
+		}
+		return vt, nil
+	case map[string]any:
+		for key, body := range t {
+			switch key {
+			case "enum":
+				return Enum(decodeLabels(body)...), nil
+			case "flags":
+				return Flags(decodeLabels(body)...), nil
+			case "list":
+				elem, err := DecodeType(body)
+				if err != nil {
+					return nil, err
+				}
+				return List(elem), nil
+			case "fixed-list":
+				m, _ := body.(map[string]any)
+				elem, err := DecodeType(m["type"])
+				if err != nil {
+					return nil, err
+				}
+				length, err := m["length"].(json.Number).Int64()
+				if err != nil {
+					return nil, err
+				}
+				return FixedList(elem, uint32(length)), nil
+			case "option":
+				elem, err := DecodeType(body)
+				if err != nil {
+					return nil, err
+				}
+				return Option(elem), nil
+			case "result":
+				m, _ := body.(map[string]any)
+				ok, err := DecodeType(m["ok"])
+				if err != nil {
+					return nil, err
+				}
+				e, err := DecodeType(m["error"])
+				if err != nil {
+					return nil, err
+				}
+				return Result(ok, e), nil
+			case "record":
+				var fields []types.Field
+				for _, f := range body.([]any) {
+					m := f.(map[string]any)
+					ft, err := DecodeType(m["type"])
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, Field(m["label"].(string), ft))
+				}
+				return Record(fields...), nil
+			case "tuple":
+				var ts []types.ValType
+				for _, e := range body.([]any) {
+					et, err := DecodeType(e)
+					if err != nil {
+						return nil, err
+					}
+					ts = append(ts, et)
+				}
+				return Tuple(ts...), nil
+			case "variant":
+				var cases []types.Case
+				for _, c := range body.([]any) {
+					m := c.(map[string]any)
+					ct, err := DecodeType(m["type"])
+					if err != nil {
+						return nil, err
+					}
+					cases = append(cases, Case(m["label"].(string), ct))
+				}
+				return Variant(cases...), nil
+			}
+			return nil, fmt.Errorf("unknown type %s", key)
+		}
+	}
+	return nil, fmt.Errorf("unable to decode type %v", raw)
+}
+
+func decodeLabels(raw any) []string {
+	var labels []string
+	for _, l := range raw.([]any) {
+		labels = append(labels, l.(string))
+	}
+	return labels
+}
+
+// DecodeValue converts the json value representation to the representation used by lifting
+func DecodeValue(t types.ValType, raw any) (any, error) {
+	switch vt := t.(type) {
+	case types.Bool:
+		return raw.(bool), nil
+	case types.S8, types.S16, types.S32, types.S64:
+		i, err := raw.(json.Number).Int64()
+		if err != nil {
+			return nil, err
+		}
+		switch t.(type) {
+		case types.S8:
+			return int8(i), nil
+		case types.S16:
+			return int16(i), nil
+		case types.S32:
+			return int32(i), nil
+		}
+		return i, nil
+	case types.U8, types.U16, types.U32, types.U64, types.F32, types.F64, types.Char:
+		u, err := strconv.ParseUint(raw.(json.Number).String(), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch t.(type) {
+		case types.U8:
+			return uint8(u), nil
+		case types.U16:
+			return uint16(u), nil
+		case types.U32:
+			return uint32(u), nil
+		case types.F32:
+			return math.Float32frombits(uint32(u)), nil
+		case types.F64:
+			return math.Float64frombits(u), nil
+		case types.Char:
+			return rune(u), nil
+		}
+		return u, nil
+	case types.String:
+		return raw.(string), nil
+	case types.Flags:
+		flags := map[string]any{}
+		for _, label := range vt.Labels() {
+			flags[label] = false
+		}
+		for _, label := range raw.([]any) {
+			flags[label.(string)] = true
+		}
+		return flags, nil
+	case types.List:
+		var list []any
+		for _, e := range raw.([]any) {
+			v, err := DecodeValue(vt.Type(), e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case types.Record:
+		m := raw.(map[string]any)
+		record := types.RecordValue{}
+		for _, f := range vt.Fields() {
+			v, err := DecodeValue(f.Type, m[f.Label])
+			if err != nil {
+				return nil, err
+			}
+			record = append(record, types.FieldValue{Label: f.Label, Value: v})
+		}
+		return record, nil
+	case types.Tuple:
+		tuple := []any{}
+		for i, e := range raw.([]any) {
+			v, err := DecodeValue(vt.Types()[i], e)
+			if err != nil {
+				return nil, err
+			}
+			tuple = append(tuple, v)
+		}
+		return tuple, nil
+	case types.Enum, types.Option, types.Result, types.Variant:
+		m := raw.(map[string]any)
+		label := m["case"].(string)
+		var payload types.ValType
+		switch vt := t.(type) {
+		case types.Option:
+			payload = vt.Type()
+		case types.Result:
+			payload = vt.Ok()
+			if label == "error" {
+				payload = vt.Error()
+			}
+		case types.Variant:
+			for _, c := range vt.Cases() {
+				if c.Label == label {
+					payload = c.Type
+				}
+			}
+		}
+		if m["value"] == nil {
+			return map[string]any{label: nil}, nil
+		}
+		v, err := DecodeValue(payload, m["value"])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{label: v}, nil
+	}
+	return nil, fmt.Errorf("unable to decode value of type %T", t)
+}
+
+// DecodeFlat converts the recorded core values, floats are recorded as their bits
+func DecodeFlat(flat []map[string]json.Number) ([]values.Value, error) {
+	var vs []values.Value
+	for _, f := range flat {
+		for k, n := range f {
+			u, err := strconv.ParseUint(n.String(), 10, 64)
+			if err != nil {
+				// i32 and i64 values may be recorded as negative numbers
+				i, err := n.Int64()
+				if err != nil {
+					return nil, err
+				}
+				u = uint64(i)
+			}
+			switch k {
+			case "i32":
+				vs = append(vs, values.U32(uint32(u)))
+			case "i64":
+				vs = append(vs, values.U64(u))
+			case "f32":
+				vs = append(vs, values.Float32(math.Float32frombits(uint32(u))))
+			case "f64":
+				vs = append(vs, values.Float64(math.Float64frombits(u)))
+			default:
+				return nil, fmt.Errorf("unknown core value type %s", k)
+			}
+		}
+	}
+	return vs, nil
+}
@@ -1,6 +1,7 @@
 package io_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -35,13 +36,13 @@ func RoundTripTest(t *testing.T, typ types.ValType, v any) {
 	const MaxFlatResults = 16
 	const MaxFlatParams = 16
 	ft := FuncType([]types.ValType{typ}, []types.ValType{typ})
-	callee := func(val any) (any, error) { return val, nil }
+	callee := func(ctx context.Context, val any) (any, error) { return val, nil }
 
 	calleeHeap := NewHeap(1000)
 	calleeOpts := Options(Memory(calleeHeap.Memory), Realloc(calleeHeap.ReAllocate))
 	calleeInst := Instance()
-	liftedCallee := func(args []any) ([]any, types.PostReturnFunc, error) {
-		return io.CanonLift(calleeOpts, calleeInst, callee, ft, args, MaxFlatParams, MaxFlatResults)
+	liftedCallee := func(ctx context.Context, args []any) ([]any, func() error, error) {
+		return io.CanonLift(ctx, calleeOpts, calleeInst, callee, ft, args, MaxFlatParams, MaxFlatResults)
 	}
 
 	callerHeap := NewHeap(1000)
@@ -53,7 +54,7 @@ func RoundTripTest(t *testing.T, typ types.ValType, v any) {
 	require.Nil(t, err)
 	args := Select(flatArgs, func(vt values.Value) any { return vt })
 
-	flatResults, err := io.CanonLower(callerOpts, callerInst, liftedCallee, true, ft, args, MaxFlatParams, MaxFlatResults)
+	flatResults, err := io.CanonLower(context.Background(), callerOpts, callerInst, liftedCallee, true, ft, args, MaxFlatParams, MaxFlatResults)
 	require.Nil(t, err)
 
 	results, err := collections.Select(flatResults, Cast[any, values.Value])
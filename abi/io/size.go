@@ -35,7 +35,9 @@ func Size(vt types.ValType) (uint32, error) {
 		return SizeOfU64, nil
 	case types.Char:
 		return SizeOfChar, nil
-	case types.List, types.String:
+	case types.List:
+		return SizeList(t)
+	case types.String:
 		return 8, nil
 	case types.Record:
 		return SizeRecord(t)
@@ -45,10 +47,27 @@ func Size(vt types.ValType) (uint32, error) {
 		return SizeFlags(t)
 	case types.Own, types.Borrow:
 		return 4, nil
+	case types.Stream, types.Future, types.ErrorContext:
+		return 4, nil
 	}
 	return 0, fmt.Errorf("size: unable to match type %T", vt)
 }
 
+func SizeList(l types.List) (uint32, error) {
+	length, fixed := l.Length()
+	if !fixed {
+		return 8, nil
+	}
+	size, err := Size(l.Type())
+	if err != nil {
+		return 0, err
+	}
+	if uint64(length)*uint64(size) > math.MaxUint32 {
+		return 0, fmt.Errorf("size: list of %d elements of size %d exceeds the address space", length, size)
+	}
+	return length * size, nil
+}
+
 func SizeRecord(r types.Record) (uint32, error) {
 	var s uint32 = 0
 	for _, f := range r.Fields() {
@@ -0,0 +1,92 @@
+package io_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/values"
+	"github.com/stretchr/testify/require"
+)
+
+const MaxFlatResults = 1
+
+func SpillContext() *types.CallContext {
+	heap := NewHeap(256)
+	return Context(CanonicalOptions(Memory(heap.Memory), Realloc(heap.ReAllocate)))
+}
+
+func TestLiftValuesSpill(t *testing.T) {
+	type test struct {
+		name string
+		ts   []types.ValType
+		vs   []any
+	}
+	tests := []test{
+		{"scalars", []types.ValType{U8(), U64(), U16(), Float32(), S8()}, []any{uint8(1), uint64(2), uint16(3), float32(4.5), int8(-5)}},
+		{"strings", []types.ValType{String(), String(), String()}, []any{"a", "bc", "def"}},
+		{"records", []types.ValType{Record(Field("x", U32())), Tuple(U8(), Bool()), List(U16())}, []any{
+			types.RecordValue{{Label: "x", Value: uint32(1)}},
+			[]any{uint8(2), true},
+			[]any{uint16(3), uint16(4)},
+		}},
+		// more fields than MaxFlatResults spill to memory and keep the declared field order
+		{"record_fields", []types.ValType{Record(Field("z", U8()), Field("a", String()), Field("m", U32()), Field("b", Bool()))}, []any{
+			types.RecordValue{{Label: "z", Value: uint8(1)}, {Label: "a", Value: "x"}, {Label: "m", Value: uint32(2)}, {Label: "b", Value: true}},
+		}},
+		{"many", Repeat[types.ValType](U32(), 17), Apply(Range(0, 17), func(i int) any { return uint32(i) })},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cx := SpillContext()
+			flat, err := io.LowerValues(cx, MaxFlatResults, test.vs, test.ts, nil)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(flat))
+
+			// lift repeatedly so an order that depends on map iteration would show up
+			for i := 0; i < 10; i++ {
+				vs, err := io.LiftValues(cx, MaxFlatResults, values.NewIterator(flat[0].(values.Value)), test.ts)
+				require.NoError(t, err)
+				require.Equal(t, test.vs, vs)
+			}
+		})
+	}
+}
+
+func TestCanonLiftSpill(t *testing.T) {
+	cx := SpillContext()
+	ts := []types.ValType{U8(), String(), U64()}
+	expected := []any{uint8(7), "spill", uint64(1 << 40)}
+
+	callee := func(ctx context.Context, args any) (any, error) {
+		return io.LowerValues(cx, MaxFlatResults, expected, ts, nil)
+	}
+	ft := FuncType(nil, ts)
+	results, postReturn, err := io.CanonLift(context.Background(), cx.Options, cx.Instance, callee, ft, nil, 16, MaxFlatResults)
+	require.NoError(t, err)
+	require.Equal(t, expected, results)
+	require.NoError(t, postReturn())
+}
+
+func TestCanonLowerSpill(t *testing.T) {
+	cx := SpillContext()
+	ts := []types.ValType{U32(), String(), Bool()}
+	expected := []any{uint32(9), "out", true}
+
+	hostImport := func(ctx context.Context, args []any) ([]any, func() error, error) {
+		return expected, func() error { return nil }, nil
+	}
+	// the caller passes the out param pointer after the flat params
+	ptr, err := cx.Options.Realloc(context.Background(), 0, 0, 4, 16)
+	require.NoError(t, err)
+
+	ft := FuncType(nil, ts)
+	flat, err := io.CanonLower(context.Background(), cx.Options, cx.Instance, hostImport, false, ft, []any{values.U32(ptr)}, 16, MaxFlatResults)
+	require.NoError(t, err)
+	require.Empty(t, flat)
+
+	vs, err := io.LoadTuple(cx, ptr, ts)
+	require.NoError(t, err)
+	require.Equal(t, expected, vs)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/patrickhuber/go-wasm/abi/types"
 	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/trap"
 	"golang.org/x/text/encoding/charmap"
 )
 
@@ -15,6 +16,14 @@ func Store(c *types.CallContext, val any, t types.ValType, ptr uint32) error {
 		return err
 	}
 
+	// tuples are laid out like records but their values are kept in order
+	if tuple, ok := t.(types.Tuple); ok {
+		vs, err := ToSlice(val)
+		if err != nil {
+			return err
+		}
+		return StoreTuple(c, vs, ptr, tuple.Types())
+	}
 	t = Despecialize(t)
 	switch vt := t.(type) {
 	case types.Bool:
@@ -60,6 +69,9 @@ func Store(c *types.CallContext, val any, t types.ValType, ptr uint32) error {
 		}
 		return StoreString(c, s, ptr)
 	case types.List:
+		if length, fixed := vt.Length(); fixed {
+			return StoreFixedList(c, val, ptr, vt.Type(), length)
+		}
 		return StoreList(c, val, ptr, vt.Type())
 	case types.Record:
 		return StoreRecord(c, val, ptr, vt)
@@ -67,8 +79,14 @@ func Store(c *types.CallContext, val any, t types.ValType, ptr uint32) error {
 		return StoreVariant(c, val, ptr, vt)
 	case types.Flags:
 		return StoreFlags(c, val, ptr, vt)
+	case types.Stream, types.Future, types.ErrorContext:
+		i, err := LowerAsync(c, val, vt)
+		if err != nil {
+			return err
+		}
+		return StoreUInt32(c, i, ptr)
 	}
-	return types.TrapWith("Store: unrecognized type %T", t)
+	return types.TrapWith(trap.TypeMismatch, "Store: unrecognized type %T", t)
 }
 
 func StoreValidate(c *types.CallContext, t types.ValType, ptr uint32) error {
@@ -276,7 +294,7 @@ func StoreStringDynamic(
 	dstAlignment := uint32(codec.Alignment())
 	lenEncoded := uint32(len(encoded))
 
-	ptr, err := cx.Options.Realloc(0, 0, dstAlignment, lenEncoded)
+	ptr, err := cx.Options.Realloc(cx.Context, 0, 0, dstAlignment, lenEncoded)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -292,9 +310,9 @@ func StoreStringCopy(cx *types.CallContext, src string, srcCodeUnits uint32, dst
 
 	dstByteLength := dstCodeUnitSize * srcCodeUnits
 	if dstByteLength > types.MaxStringByteLength {
-		return 0, 0, types.TrapWith("destination byte length %d is greater than max string byte length %d", dstByteLength, types.MaxStringByteLength)
+		return 0, 0, types.TrapWith(trap.LengthOverflow, "destination byte length %d is greater than max string byte length %d", dstByteLength, types.MaxStringByteLength)
 	}
-	ptr, err := cx.Options.Realloc(0, 0, dstAlignment, dstByteLength)
+	ptr, err := cx.Options.Realloc(cx.Context, 0, 0, dstAlignment, dstByteLength)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -303,10 +321,10 @@ func StoreStringCopy(cx *types.CallContext, src string, srcCodeUnits uint32, dst
 		return 0, 0, err
 	}
 	if ptr != align {
-		return 0, 0, types.TrapWith("ptr %d is not aligned to destination %d", ptr, dstAlignment)
+		return 0, 0, types.TrapWith(trap.UnalignedPointer, "ptr %d is not aligned to destination %d", ptr, dstAlignment)
 	}
 	if ptr+dstByteLength > uint32(cx.Options.Memory.Len()) {
-		return 0, 0, types.TrapWith("array size %d is greater than the memory size %d", ptr+dstByteLength, cx.Options.Memory.Len())
+		return 0, 0, types.TrapWith(trap.OutOfBoundsMemory, "array size %d is greater than the memory size %d", ptr+dstByteLength, cx.Options.Memory.Len())
 	}
 
 	encoded, err := encoding.EncodeString(dstEncoding, src)
@@ -325,10 +343,10 @@ func StoreUtf8ToUtf16(cx *types.CallContext, src string, srcCodeUnits uint32) (u
 	worstCaseSize := 2 * srcCodeUnits
 
 	if worstCaseSize > types.MaxStringByteLength {
-		return 0, 0, types.TrapWith("worst case size %d is greater than max string byte length %d", worstCaseSize, types.MaxStringByteLength)
+		return 0, 0, types.TrapWith(trap.LengthOverflow, "worst case size %d is greater than max string byte length %d", worstCaseSize, types.MaxStringByteLength)
 	}
 
-	ptr, err := cx.Options.Realloc(0, 0, 2, worstCaseSize)
+	ptr, err := cx.Options.Realloc(cx.Context, 0, 0, 2, worstCaseSize)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -338,11 +356,11 @@ func StoreUtf8ToUtf16(cx *types.CallContext, src string, srcCodeUnits uint32) (u
 		return 0, 0, err
 	}
 	if ptr != align {
-		return 0, 0, types.TrapWith("ptr %d is not alinged to 2", ptr)
+		return 0, 0, types.TrapWith(trap.UnalignedPointer, "ptr %d is not alinged to 2", ptr)
 	}
 
 	if ptr+worstCaseSize > uint32(cx.Options.Memory.Len()) {
-		return 0, 0, types.TrapWith("worst case size %d is greater than memory size %d", ptr+worstCaseSize, cx.Options.Memory.Len())
+		return 0, 0, types.TrapWith(trap.OutOfBoundsMemory, "worst case size %d is greater than memory size %d", ptr+worstCaseSize, cx.Options.Memory.Len())
 	}
 
 	encoded, err := encoding.EncodeString(encoding.NewUTF16(), src)
@@ -356,7 +374,7 @@ func StoreUtf8ToUtf16(cx *types.CallContext, src string, srcCodeUnits uint32) (u
 
 	if len(encoded) < int(worstCaseSize) {
 
-		ptr, err = cx.Options.Realloc(ptr, worstCaseSize, 2, uint32(len(encoded)))
+		ptr, err = cx.Options.Realloc(cx.Context, ptr, worstCaseSize, 2, uint32(len(encoded)))
 		if err != nil {
 			return 0, 0, err
 		}
@@ -365,11 +383,11 @@ func StoreUtf8ToUtf16(cx *types.CallContext, src string, srcCodeUnits uint32) (u
 			return 0, 0, err
 		}
 		if ptr != align {
-			return 0, 0, types.TrapWith("ptr %d could not be aligned to 2", ptr)
+			return 0, 0, types.TrapWith(trap.UnalignedPointer, "ptr %d could not be aligned to 2", ptr)
 		}
 
 		if hiPtr > uint32(cx.Options.Memory.Len()) {
-			return 0, 0, types.TrapWith("ptr %d is greater than memory size %d", hiPtr, cx.Options.Memory.Len())
+			return 0, 0, types.TrapWith(trap.OutOfBoundsMemory, "ptr %d is greater than memory size %d", hiPtr, cx.Options.Memory.Len())
 		}
 	}
 
@@ -389,6 +407,28 @@ func StoreList(cx *types.CallContext, v any, ptr uint32, elementType types.ValTy
 	return StoreUInt32(cx, length, ptr+4)
 }
 
+// StoreFixedList stores the elements of a list<T, N> inline at ptr
+func StoreFixedList(cx *types.CallContext, v any, ptr uint32, elementType types.ValType, length uint32) error {
+	slice, err := ToSlice(v)
+	if err != nil {
+		return err
+	}
+	if uint32(len(slice)) != length {
+		return types.TrapWith(trap.TypeMismatch, "list has %d elements, expected %d", len(slice), length)
+	}
+	size, err := Size(elementType)
+	if err != nil {
+		return err
+	}
+	for i, element := range slice {
+		err = Store(cx, element, elementType, ptr+uint32(i)*size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func StoreListIntoRange(cx *types.CallContext, v any, elementType types.ValType) (uint32, uint32, error) {
 	slice, err := ToSlice(v)
 	if err != nil {
@@ -402,7 +442,7 @@ func StoreListIntoRange(cx *types.CallContext, v any, elementType types.ValType)
 
 	byteLengthInt := len(slice) * int(size)
 	if byteLengthInt >= math.MaxInt {
-		return 0, 0, types.TrapWith("byte length %d exceeds max of %d", byteLengthInt, math.MaxInt)
+		return 0, 0, types.TrapWith(trap.LengthOverflow, "byte length %d exceeds max of %d", byteLengthInt, math.MaxInt)
 	}
 	byteLength := uint32(byteLengthInt)
 
@@ -411,7 +451,7 @@ func StoreListIntoRange(cx *types.CallContext, v any, elementType types.ValType)
 		return 0, 0, err
 	}
 
-	ptr, err := cx.Options.Realloc(0, 0, alignment, byteLength)
+	ptr, err := cx.Options.Realloc(cx.Context, 0, 0, alignment, byteLength)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -421,11 +461,11 @@ func StoreListIntoRange(cx *types.CallContext, v any, elementType types.ValType)
 		return 0, 0, err
 	}
 	if ptr != align {
-		return 0, 0, types.TrapWith("ptr %d not aligned to %d", ptr, alignment)
+		return 0, 0, types.TrapWith(trap.UnalignedPointer, "ptr %d not aligned to %d", ptr, alignment)
 	}
 
 	if ptr+byteLength > uint32(cx.Options.Memory.Len()) {
-		return 0, 0, types.TrapWith("ptr %d exceeds mememory size %d", ptr+byteLength, cx.Options.Memory.Len())
+		return 0, 0, types.TrapWith(trap.OutOfBoundsMemory, "ptr %d exceeds mememory size %d", ptr+byteLength, cx.Options.Memory.Len())
 	}
 
 	for i, element := range slice {
@@ -448,13 +488,46 @@ func ToSlice(val any) ([]any, error) {
 	}
 }
 
+// ToRecordValues returns the field values of val in the field order of r. The fields of val
+// must have the labels of r in the same order.
+func ToRecordValues(val any, r types.Record) ([]any, error) {
+	record, ok := val.(types.RecordValue)
+	if !ok {
+		return nil, types.NewCastError(val, "types.RecordValue")
+	}
+	fields := r.Fields()
+	if len(record) != len(fields) {
+		return nil, fmt.Errorf("record has %d fields, want %d", len(record), len(fields))
+	}
+	vs := make([]any, len(fields))
+	for i, f := range fields {
+		if record[i].Label != f.Label {
+			return nil, fmt.Errorf("record field %d is %q, want %q", i, record[i].Label, f.Label)
+		}
+		vs[i] = record[i].Value
+	}
+	return vs, nil
+}
+
 func StoreRecord(cx *types.CallContext, val any, ptr uint32, r types.Record) error {
-	valMap, err := ToMapStringAny(val)
+	vs, err := ToRecordValues(val, r)
 	if err != nil {
 		return err
 	}
-	for _, f := range r.Fields() {
-		alignment, err := Alignment(f.Type)
+	ts := make([]types.ValType, len(r.Fields()))
+	for i, f := range r.Fields() {
+		ts[i] = f.Type
+	}
+	return StoreTuple(cx, vs, ptr, ts)
+}
+
+// StoreTuple stores the values in order laid out like a record at ptr
+func StoreTuple(cx *types.CallContext, vs []any, ptr uint32, ts []types.ValType) error {
+	if len(vs) != len(ts) {
+		return fmt.Errorf("StoreTuple: have %d values, want %d", len(vs), len(ts))
+	}
+	for i, t := range ts {
+		alignment, err := Alignment(t)
 		if err != nil {
 			return err
 		}
@@ -464,12 +537,12 @@ func StoreRecord(cx *types.CallContext, val any, ptr uint32, r types.Record) err
 			return err
 		}
 
-		err = Store(cx, valMap[f.Label], f.Type, ptr)
+		err = Store(cx, vs[i], t, ptr)
 		if err != nil {
 			return err
 		}
 
-		size, err := Size(f.Type)
+		size, err := Size(t)
 		if err != nil {
 			return err
 		}
@@ -513,8 +586,11 @@ func StoreVariant(cx *types.CallContext, val any, ptr uint32, v types.Variant) e
 }
 
 func StoreFlags(c *types.CallContext, val any, ptr uint32, f types.Flags) error {
-	vMap := val.(map[string]any)
-	i, err := PackFlagsIntoInt(vMap, f)
+	vMap, err := ToMapStringAny(val)
+	if err != nil {
+		return err
+	}
+	words, err := PackFlags(vMap, f)
 	if err != nil {
 		return err
 	}
@@ -522,7 +598,18 @@ func StoreFlags(c *types.CallContext, val any, ptr uint32, f types.Flags) error
 	if err != nil {
 		return err
 	}
-	return StoreInt(c, i, ptr, size, false)
+	if size <= 4 {
+		if size == 0 {
+			return nil
+		}
+		return StoreInt(c, uint64(words[0]), ptr, size, false)
+	}
+	for i, word := range words {
+		if err := StoreUInt32(c, word, ptr+uint32(4*i)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func ToMapStringAny(val any) (map[string]any, error) {
@@ -533,22 +620,18 @@ func ToMapStringAny(val any) (map[string]any, error) {
 	return nil, types.NewCastError(val, "map[string]any")
 }
 
-func PackFlagsIntoInt(v map[string]any, flags types.Flags) (uint64, error) {
-	var packed uint64 = 0
-	shift := 0
-	for _, label := range flags.Labels() {
+// PackFlags packs the flag values into u32 words in label order
+func PackFlags(v map[string]any, flags types.Flags) ([]uint32, error) {
+	words := make([]uint32, NumI32Flags(flags.Labels()))
+	for i, label := range flags.Labels() {
 		val := v[label]
 		b, ok := val.(bool)
 		if !ok {
-			return 0, types.NewCastError(val, "bool")
+			return nil, types.NewCastError(val, "bool")
 		}
-		var i uint64 = 0
 		if b {
-			i = 1
+			words[i/32] |= 1 << (i % 32)
 		}
-		packed |= i << shift
-		shift += 1
 	}
-
-	return packed, nil
+	return words, nil
 }
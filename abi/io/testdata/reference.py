@@ -0,0 +1,260 @@
+#!/usr/bin/env python3
+"""Records canonical ABI outputs of the component-model reference definitions.
+
+The cases are written to reference.json next to this script and replayed by
+TestReference in abi/io. Run it from any directory with the component-model
+submodule checked out:
+
+    git submodule update --init submodules/github.com/WebAssembly/component-model
+    python3 abi/io/testdata/reference.py [--seed N] [--count N]
+
+Every case records a type, a value, the flattened core values from lower_flat
+and the linear memory after store. The allocator mirrors the Heap used by the
+go tests so pointers and padding line up byte for byte.
+"""
+
+import argparse
+import json
+import os
+import random
+import struct
+import sys
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+REFERENCE = os.path.join(HERE, '..', '..', '..', 'submodules', 'github.com', 'WebAssembly',
+                         'component-model', 'design', 'mvp', 'canonical-abi')
+sys.path.insert(0, REFERENCE)
+
+import definitions as d  # noqa: E402
+
+MEMORY_SIZE = 1 << 16
+ENCODINGS = ['utf8', 'utf16', 'latin1+utf16']
+PRIMITIVES = ['bool', 's8', 'u8', 's16', 'u16', 's32', 'u32', 's64', 'u64', 'f32', 'f64', 'char', 'string']
+
+
+class Heap:
+    """Bump allocator matching Heap.ReAllocate in heap_test.go"""
+
+    def __init__(self, size):
+        self.memory = bytearray(size)
+        self.last_alloc = 0
+
+    def realloc(self, original_ptr, original_size, alignment, new_size):
+        if original_ptr != 0 and new_size < original_size:
+            return d.align_to(original_ptr, alignment)
+        ret = d.align_to(self.last_alloc, alignment)
+        self.last_alloc = ret + new_size
+        if self.last_alloc > len(self.memory):
+            raise MemoryError('out of memory')
+        self.memory[ret:ret + original_size] = self.memory[original_ptr:original_ptr + original_size]
+        return ret
+
+
+def context(heap, encoding):
+    opts = d.CanonicalOptions()
+    opts.memory = heap.memory
+    opts.string_encoding = encoding
+    opts.realloc = heap.realloc
+    return d.LiftLowerContext(opts, d.ComponentInstance())
+
+
+def labels(n):
+    return ['l' + str(i) for i in range(n)]
+
+
+def gen_type(rng, depth):
+    choices = PRIMITIVES + ['enum', 'flags']
+    if depth > 0:
+        choices += ['list', 'fixed-list', 'option', 'result', 'record', 'tuple', 'variant']
+    kind = rng.choice(choices)
+    if kind in PRIMITIVES:
+        return kind
+    if kind == 'enum':
+        return {'enum': labels(rng.randint(1, 300))}
+    if kind == 'flags':
+        return {'flags': labels(rng.randint(1, 32))}
+    if kind == 'list':
+        return {'list': gen_type(rng, depth - 1)}
+    if kind == 'fixed-list':
+        return {'fixed-list': {'type': gen_type(rng, depth - 1), 'length': rng.randint(1, 4)}}
+    if kind == 'option':
+        return {'option': gen_type(rng, depth - 1)}
+    if kind == 'result':
+        return {'result': {'ok': gen_optional_type(rng, depth - 1), 'error': gen_optional_type(rng, depth - 1)}}
+    if kind == 'record':
+        return {'record': [{'label': label, 'type': gen_type(rng, depth - 1)} for label in labels(rng.randint(1, 4))]}
+    if kind == 'tuple':
+        return {'tuple': [gen_type(rng, depth - 1) for _ in range(rng.randint(1, 4))]}
+    return {'variant': [{'label': label, 'type': gen_optional_type(rng, depth - 1)} for label in labels(rng.randint(1, 4))]}
+
+
+def gen_optional_type(rng, depth):
+    if rng.randrange(3) == 0:
+        return None
+    return gen_type(rng, depth)
+
+
+def gen_char(rng):
+    c = rng.choice([rng.randrange(0x20, 0x7f), rng.randrange(0x100), rng.randrange(0x110000)])
+    if 0xd800 <= c <= 0xdfff:
+        c = 0xfffd
+    return c
+
+
+def gen_float(rng, fmt):
+    while True:
+        bits = rng.getrandbits(32 if fmt == '<f' else 64)
+        f = struct.unpack(fmt, bits.to_bytes(4 if fmt == '<f' else 8, 'little'))[0]
+        if f == f:
+            return bits
+
+
+def gen_value(rng, t):
+    """Generates a value in the json representation read by reference_test.go"""
+    if t == 'bool':
+        return rng.random() < 0.5
+    if t in ('s8', 's16', 's32', 's64'):
+        bits = int(t[1:])
+        return rng.randrange(-(1 << (bits - 1)), 1 << (bits - 1))
+    if t in ('u8', 'u16', 'u32', 'u64'):
+        return rng.randrange(1 << int(t[1:]))
+    if t == 'f32':
+        return gen_float(rng, '<f')
+    if t == 'f64':
+        return gen_float(rng, '<d')
+    if t == 'char':
+        return gen_char(rng)
+    if t == 'string':
+        return ''.join(chr(gen_char(rng)) for _ in range(rng.randrange(8)))
+    if 'enum' in t:
+        return {'case': rng.choice(t['enum']), 'value': None}
+    if 'flags' in t:
+        return [label for label in t['flags'] if rng.random() < 0.5]
+    if 'list' in t:
+        return [gen_value(rng, t['list']) for _ in range(rng.randrange(4))]
+    if 'fixed-list' in t:
+        return [gen_value(rng, t['fixed-list']['type']) for _ in range(t['fixed-list']['length'])]
+    if 'option' in t:
+        if rng.random() < 0.5:
+            return {'case': 'none', 'value': None}
+        return {'case': 'some', 'value': gen_value(rng, t['option'])}
+    if 'result' in t:
+        label = rng.choice(['ok', 'error'])
+        payload = t['result'][label]
+        return {'case': label, 'value': None if payload is None else gen_value(rng, payload)}
+    if 'record' in t:
+        return {f['label']: gen_value(rng, f['type']) for f in t['record']}
+    if 'tuple' in t:
+        return [gen_value(rng, e) for e in t['tuple']]
+    c = rng.choice(t['variant'])
+    return {'case': c['label'], 'value': None if c['type'] is None else gen_value(rng, c['type'])}
+
+
+def to_reference_type(t):
+    simple = {
+        'bool': d.BoolType, 's8': d.S8Type, 'u8': d.U8Type, 's16': d.S16Type, 'u16': d.U16Type,
+        's32': d.S32Type, 'u32': d.U32Type, 's64': d.S64Type, 'u64': d.U64Type,
+        'f32': d.F32Type, 'f64': d.F64Type, 'char': d.CharType, 'string': d.StringType,
+    }
+    if t is None:
+        return None
+    if isinstance(t, str):
+        return simple[t]()
+    if 'enum' in t:
+        return d.EnumType(t['enum'])
+    if 'flags' in t:
+        return d.FlagsType(t['flags'])
+    if 'list' in t:
+        return d.ListType(to_reference_type(t['list']))
+    if 'fixed-list' in t:
+        return d.ListType(to_reference_type(t['fixed-list']['type']), t['fixed-list']['length'])
+    if 'option' in t:
+        return d.OptionType(to_reference_type(t['option']))
+    if 'result' in t:
+        return d.ResultType(to_reference_type(t['result']['ok']), to_reference_type(t['result']['error']))
+    if 'record' in t:
+        return d.RecordType([d.FieldType(f['label'], to_reference_type(f['type'])) for f in t['record']])
+    if 'tuple' in t:
+        return d.TupleType([to_reference_type(e) for e in t['tuple']])
+    return d.VariantType([d.CaseType(c['label'], to_reference_type(c['type'])) for c in t['variant']])
+
+
+def to_reference_value(t, v):
+    """Converts the json representation to the values the reference definitions operate on"""
+    if t == 'f32':
+        return struct.unpack('<f', v.to_bytes(4, 'little'))[0]
+    if t == 'f64':
+        return struct.unpack('<d', v.to_bytes(8, 'little'))[0]
+    if t == 'char':
+        return chr(v)
+    if t == 'string':
+        return (v, 'utf8', len(v.encode('utf-8')))
+    if isinstance(t, str):
+        return v
+    if 'flags' in t:
+        return {label: label in v for label in t['flags']}
+    if 'list' in t:
+        return [to_reference_value(t['list'], e) for e in v]
+    if 'fixed-list' in t:
+        return [to_reference_value(t['fixed-list']['type'], e) for e in v]
+    if 'record' in t:
+        return {f['label']: to_reference_value(f['type'], v[f['label']]) for f in t['record']}
+    if 'tuple' in t:
+        return {str(i): to_reference_value(e, v[i]) for i, e in enumerate(t['tuple'])}
+    payload = None
+    if v['value'] is not None:
+        payload = to_reference_value(case_type(t, v['case']), v['value'])
+    return {v['case']: payload}
+
+
+def case_type(t, label):
+    if 'option' in t:
+        return t['option']
+    if 'result' in t:
+        return t['result'][label]
+    return next(c['type'] for c in t['variant'] if c['label'] == label)
+
+
+def flat_value(kind, v):
+    if kind == 'f32':
+        return {kind: int.from_bytes(struct.pack('<f', v), 'little')}
+    if kind == 'f64':
+        return {kind: int.from_bytes(struct.pack('<d', v), 'little')}
+    return {kind: v}
+
+
+def record(rng):
+    t = gen_type(rng, 3)
+    v = gen_value(rng, t)
+    encoding = rng.choice(ENCODINGS)
+    rt = to_reference_type(t)
+    rv = to_reference_value(t, v)
+
+    heap = Heap(MEMORY_SIZE)
+    cx = context(heap, encoding)
+    ptr = heap.realloc(0, 0, d.alignment(rt), d.elem_size(rt))
+    d.store(cx, rv, rt, ptr)
+    memory = bytes(heap.memory[:heap.last_alloc]).hex()
+
+    heap = Heap(MEMORY_SIZE)
+    cx = context(heap, encoding)
+    flat = [flat_value(k, f) for k, f in zip(d.flatten_type(rt), d.lower_flat(cx, rv, rt))]
+
+    return {'type': t, 'value': v, 'encoding': encoding, 'ptr': ptr, 'memory': memory, 'flat': flat}
+
+
+def main():
+    parser = argparse.ArgumentParser(description=__doc__.splitlines()[0])
+    parser.add_argument('--seed', type=int, default=0)
+    parser.add_argument('--count', type=int, default=200)
+    args = parser.parse_args()
+
+    rng = random.Random(args.seed)
+    cases = [record(rng) for _ in range(args.count)]
+    with open(os.path.join(HERE, 'reference.json'), 'w') as f:
+        json.dump({'seed': args.seed, 'memorySize': MEMORY_SIZE, 'cases': cases}, f, indent=1)
+        f.write('\n')
+
+
+if __name__ == '__main__':
+    main()
@@ -0,0 +1,857 @@
+// package marshal converts between Go values and the values exchanged by abi/io.
+//
+// The mapping follows the wit type passed to Marshal and Unmarshal:
+//
+//   - bool, integers, floats, char and string map to the Go kinds of the same name
+//   - list maps to slices and arrays
+//   - record maps to structs, maps with string keys and types.RecordValue. Fields are matched by the `wit`
+//     tag or the kebab case of the field name
+//   - tuple maps to structs with one exported field per element, slices and arrays
+//   - flags maps to structs of bool fields and map[string]bool
+//   - enum maps to integer kinds holding the case index and string kinds holding the label
+//   - option maps to pointers and the Option of github.com/patrickhuber/go-types
+//   - result maps to the Result of github.com/patrickhuber/go-types, the error is a *ResultError,
+//     a string error type uses the message of the error and other error types the error value
+//   - variant maps to structs with one pointer field per case. Exactly one field is set.
+//   - own and borrow map to integer kinds holding the representation
+//   - stream and future map to *types.SharedStream, error-context to *types.ErrorContextElem
+//
+// Values of type any are passed through unchanged. The reflect package is unable to create go-types
+// options and results, so Unmarshal stores them through the destinations returned by OptionOf and ResultOf.
+package marshal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+)
+
+// Marshal converts the Go value v into the representation Store and LowerFlat expect for t
+func Marshal(t types.ValType, v any) (any, error) {
+	return marshal(t, reflect.ValueOf(v))
+}
+
+// Unmarshal converts the representation returned by Load and LiftFlat for t into the Go value v points to
+func Unmarshal(t types.ValType, data any, v any) error {
+	if target, ok := v.(target); ok {
+		return target.unmarshal(t, data)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unmarshal: expected a non nil pointer, found %T", v)
+	}
+	return unmarshal(t, data, rv.Elem())
+}
+
+// indirect reports whether pointers to values of t are followed. Options use nil pointers for none
+// and streams, futures and error contexts are pointers themselves.
+func indirect(t types.ValType) bool {
+	switch t.(type) {
+	case types.Option, types.Stream, types.Future, types.ErrorContext:
+		return false
+	}
+	return true
+}
+
+func marshal(t types.ValType, rv reflect.Value) (any, error) {
+	for rv.Kind() == reflect.Interface && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("marshal: unable to marshal nil as %s", name(t))
+	}
+	if indirect(t) && rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("marshal: unable to marshal nil pointer as %s", name(t))
+		}
+		return marshal(t, rv.Elem())
+	}
+
+	switch vt := t.(type) {
+	case types.Bool:
+		if rv.Kind() != reflect.Bool {
+			return nil, mismatch(t, rv)
+		}
+		return rv.Bool(), nil
+	case types.U8:
+		u, err := unsigned(t, rv, math.MaxUint8)
+		return uint8(u), err
+	case types.U16:
+		u, err := unsigned(t, rv, math.MaxUint16)
+		return uint16(u), err
+	case types.U32:
+		u, err := unsigned(t, rv, math.MaxUint32)
+		return uint32(u), err
+	case types.U64:
+		return unsigned(t, rv, math.MaxUint64)
+	case types.S8:
+		i, err := signed(t, rv, math.MinInt8, math.MaxInt8)
+		return int8(i), err
+	case types.S16:
+		i, err := signed(t, rv, math.MinInt16, math.MaxInt16)
+		return int16(i), err
+	case types.S32:
+		i, err := signed(t, rv, math.MinInt32, math.MaxInt32)
+		return int32(i), err
+	case types.S64:
+		return signed(t, rv, math.MinInt64, math.MaxInt64)
+	case types.F32:
+		if !isFloat(rv) {
+			return nil, mismatch(t, rv)
+		}
+		return float32(rv.Float()), nil
+	case types.F64:
+		if !isFloat(rv) {
+			return nil, mismatch(t, rv)
+		}
+		return rv.Float(), nil
+	case types.Char:
+		i, err := signed(t, rv, 0, utf8.MaxRune)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.ValidRune(rune(i)) {
+			return nil, fmt.Errorf("marshal: %d is not a valid char", i)
+		}
+		return rune(i), nil
+	case types.String:
+		if rv.Kind() != reflect.String {
+			return nil, mismatch(t, rv)
+		}
+		return rv.String(), nil
+	case types.List:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, mismatch(t, rv)
+		}
+		if length, fixed := vt.Length(); fixed && rv.Len() != int(length) {
+			return nil, fmt.Errorf("marshal: unable to convert %d elements to list<%s, %d>", rv.Len(), name(vt.Type()), length)
+		}
+		list := make([]any, rv.Len())
+		for i := range list {
+			v, err := marshal(vt.Type(), rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	case types.Record:
+		return marshalRecord(vt, rv)
+	case types.Tuple:
+		return marshalTuple(vt, rv)
+	case types.Flags:
+		return marshalFlags(vt, rv)
+	case types.Enum:
+		return marshalEnum(vt, rv)
+	case types.Option:
+		return marshalOption(vt, rv)
+	case types.Result:
+		return marshalResult(vt, rv)
+	case types.Variant:
+		return marshalVariant(vt, rv)
+	case types.Own, types.Borrow:
+		u, err := unsigned(t, rv, math.MaxUint32)
+		return uint32(u), err
+	case types.Stream, types.Future:
+		shared, ok := rv.Interface().(*types.SharedStream)
+		if !ok {
+			return nil, mismatch(t, rv)
+		}
+		return shared, nil
+	case types.ErrorContext:
+		e, ok := rv.Interface().(*types.ErrorContextElem)
+		if !ok {
+			return nil, mismatch(t, rv)
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("marshal: unsupported type %T", t)
+}
+
+func marshalRecord(r types.Record, rv reflect.Value) (any, error) {
+	record := make(types.RecordValue, 0, len(r.Fields()))
+	for _, f := range r.Fields() {
+		field, err := lookup(r, rv, f.Label)
+		if err != nil {
+			return nil, err
+		}
+		v, err := marshal(f.Type, field)
+		if err != nil {
+			return nil, err
+		}
+		record = append(record, types.FieldValue{Label: f.Label, Value: v})
+	}
+	return record, nil
+}
+
+func marshalTuple(t types.Tuple, rv reflect.Value) (any, error) {
+	elements, err := positional(t, rv, len(t.Types()))
+	if err != nil {
+		return nil, err
+	}
+	tuple := make([]any, 0, len(elements))
+	for i, et := range t.Types() {
+		v, err := marshal(et, elements[i])
+		if err != nil {
+			return nil, err
+		}
+		tuple = append(tuple, v)
+	}
+	return tuple, nil
+}
+
+func marshalFlags(f types.Flags, rv reflect.Value) (any, error) {
+	flags := map[string]any{}
+	for _, label := range f.Labels() {
+		field, err := lookup(f, rv, label)
+		if err != nil {
+			return nil, err
+		}
+		if field.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("marshal: flag %s must be a bool, found %s", label, field.Type())
+		}
+		flags[label] = field.Bool()
+	}
+	return flags, nil
+}
+
+func marshalEnum(e types.Enum, rv reflect.Value) (any, error) {
+	labels := e.Labels()
+	if rv.Kind() == reflect.String {
+		for _, label := range labels {
+			if label == rv.String() {
+				return map[string]any{label: nil}, nil
+			}
+		}
+		return nil, fmt.Errorf("marshal: %q is not a case of %s", rv.String(), name(e))
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("marshal: %s has no cases", name(e))
+	}
+	i, err := unsigned(e, rv, uint64(len(labels)-1))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{labels[i]: nil}, nil
+}
+
+func marshalOption(o types.Option, rv reflect.Value) (any, error) {
+	switch {
+	case rv.Kind() == reflect.Pointer:
+		if rv.IsNil() {
+			return map[string]any{"none": nil}, nil
+		}
+		rv = rv.Elem()
+	case rv.Type().Implements(optionalType):
+		if !rv.Interface().(optional).IsSome() {
+			return map[string]any{"none": nil}, nil
+		}
+		rv = rv.MethodByName("Unwrap").Call(nil)[0]
+	default:
+		return nil, mismatch(o, rv)
+	}
+	v, err := marshal(o.Type(), rv)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"some": v}, nil
+}
+
+func marshalResult(r types.Result, rv reflect.Value) (any, error) {
+	var label string
+	var v any
+	var err error
+	if !rv.Type().Implements(fallibleType) {
+		return nil, mismatch(r, rv)
+	}
+	if rv.Interface().(fallible).IsOk() {
+		label = "ok"
+		if r.Ok() != nil {
+			v, err = marshal(r.Ok(), rv.MethodByName("Unwrap").Call(nil)[0])
+		}
+	} else {
+		label = "error"
+		v, err = marshalError(r.Error(), rv.MethodByName("Deconstruct").Call(nil)[1])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{label: v}, nil
+}
+
+// marshalError converts the error of a result to the payload of t. The payload of a *ResultError is its value,
+// a string payload is the message of other errors and other payloads are marshaled from the error value.
+func marshalError(t types.ValType, rv reflect.Value) (any, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if rv.IsNil() {
+		return nil, fmt.Errorf("marshal: unable to marshal a nil error as %s", name(t))
+	}
+	err := rv.Interface().(error)
+	var resultError *ResultError
+	if errors.As(err, &resultError) {
+		return marshal(t, reflect.ValueOf(resultError.Value))
+	}
+	if _, ok := t.(types.String); ok {
+		return err.Error(), nil
+	}
+	return marshal(t, rv)
+}
+
+func marshalVariant(variant types.Variant, rv reflect.Value) (any, error) {
+	if rv.Kind() != reflect.Struct {
+		return nil, mismatch(variant, rv)
+	}
+	var match map[string]any
+	for _, c := range variant.Cases() {
+		field, err := lookup(variant, rv, c.Label)
+		if err != nil {
+			return nil, err
+		}
+		if field.Kind() != reflect.Pointer {
+			return nil, fmt.Errorf("marshal: case %s must be a pointer, found %s", c.Label, field.Type())
+		}
+		if field.IsNil() {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("marshal: more than one case of %s is set", name(variant))
+		}
+		var v any
+		if c.Type != nil {
+			v, err = marshal(c.Type, field.Elem())
+			if err != nil {
+				return nil, err
+			}
+		}
+		match = map[string]any{c.Label: v}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("marshal: no case of %s is set", name(variant))
+	}
+	return match, nil
+}
+
+func unmarshal(t types.ValType, data any, rv reflect.Value) error {
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		if data == nil {
+			rv.SetZero()
+			return nil
+		}
+		rv.Set(reflect.ValueOf(data))
+		return nil
+	}
+	if indirect(t) && rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshal(t, data, rv.Elem())
+	}
+
+	switch vt := t.(type) {
+	case types.Bool:
+		b, ok := data.(bool)
+		if !ok || rv.Kind() != reflect.Bool {
+			return unmarshalMismatch(t, data, rv)
+		}
+		rv.SetBool(b)
+		return nil
+	case types.U8, types.U16, types.U32, types.U64, types.S8, types.S16, types.S32, types.S64, types.Char, types.Own, types.Borrow:
+		return unmarshalInt(t, data, rv)
+	case types.F32, types.F64:
+		dv := reflect.ValueOf(data)
+		if !isFloat(dv) || !isFloat(rv) {
+			return unmarshalMismatch(t, data, rv)
+		}
+		rv.SetFloat(dv.Float())
+		return nil
+	case types.String:
+		s, ok := data.(string)
+		if !ok || rv.Kind() != reflect.String {
+			return unmarshalMismatch(t, data, rv)
+		}
+		rv.SetString(s)
+		return nil
+	case types.List:
+		list, ok := data.([]any)
+		if !ok {
+			return unmarshalMismatch(t, data, rv)
+		}
+		if length, fixed := vt.Length(); fixed && len(list) != int(length) {
+			return fmt.Errorf("unmarshal: expected %d elements of list<%s, %d>, found %d", length, name(vt.Type()), length, len(list))
+		}
+		return unmarshalElements(t, list, func(int) types.ValType { return vt.Type() }, rv)
+	case types.Record:
+		return unmarshalRecord(vt, data, rv)
+	case types.Tuple:
+		return unmarshalTuple(vt, data, rv)
+	case types.Flags:
+		return unmarshalFlags(vt, data, rv)
+	case types.Enum:
+		return unmarshalEnum(vt, data, rv)
+	case types.Option:
+		return unmarshalOption(vt, data, rv)
+	case types.Result:
+		// go-types results are only unmarshaled with ResultOf
+		return unmarshalMismatch(vt, data, rv)
+	case types.Variant:
+		return unmarshalVariant(vt, data, rv)
+	case types.Stream, types.Future, types.ErrorContext:
+		dv := reflect.ValueOf(data)
+		if !dv.IsValid() || !dv.Type().AssignableTo(rv.Type()) {
+			return unmarshalMismatch(t, data, rv)
+		}
+		rv.Set(dv)
+		return nil
+	}
+	return fmt.Errorf("unmarshal: unsupported type %T", t)
+}
+
+func unmarshalInt(t types.ValType, data any, rv reflect.Value) error {
+	dv := reflect.ValueOf(data)
+	switch {
+	case isSigned(dv) && isSigned(rv):
+		if rv.OverflowInt(dv.Int()) {
+			return unmarshalOverflow(t, data, rv)
+		}
+		rv.SetInt(dv.Int())
+	case isSigned(dv) && isUnsigned(rv):
+		if dv.Int() < 0 || rv.OverflowUint(uint64(dv.Int())) {
+			return unmarshalOverflow(t, data, rv)
+		}
+		rv.SetUint(uint64(dv.Int()))
+	case isUnsigned(dv) && isUnsigned(rv):
+		if rv.OverflowUint(dv.Uint()) {
+			return unmarshalOverflow(t, data, rv)
+		}
+		rv.SetUint(dv.Uint())
+	case isUnsigned(dv) && isSigned(rv):
+		if dv.Uint() > math.MaxInt64 || rv.OverflowInt(int64(dv.Uint())) {
+			return unmarshalOverflow(t, data, rv)
+		}
+		rv.SetInt(int64(dv.Uint()))
+	default:
+		return unmarshalMismatch(t, data, rv)
+	}
+	return nil
+}
+
+// unmarshalElements stores the elements of a list or tuple in a slice or array
+func unmarshalElements(t types.ValType, elements []any, typeOf func(int) types.ValType, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Slice:
+		rv.Set(reflect.MakeSlice(rv.Type(), len(elements), len(elements)))
+	case reflect.Array:
+		if rv.Len() != len(elements) {
+			return fmt.Errorf("unmarshal: unable to store %d elements of %s in %s", len(elements), name(t), rv.Type())
+		}
+	default:
+		return unmarshalMismatch(t, elements, rv)
+	}
+	for i, element := range elements {
+		if err := unmarshal(typeOf(i), element, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalRecord(r types.Record, data any, rv reflect.Value) error {
+	record, ok := data.(types.RecordValue)
+	if !ok {
+		return unmarshalMismatch(r, data, rv)
+	}
+	if err := prepare(r, rv); err != nil {
+		return err
+	}
+	for _, f := range r.Fields() {
+		v, _ := record.Get(f.Label)
+		if err := store(r, rv, f.Label, func(field reflect.Value) error {
+			return unmarshal(f.Type, v, field)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalTuple(t types.Tuple, data any, rv reflect.Value) error {
+	elements, ok := data.([]any)
+	if !ok || len(elements) != len(t.Types()) {
+		return unmarshalMismatch(t, data, rv)
+	}
+	if rv.Kind() != reflect.Struct {
+		return unmarshalElements(t, elements, func(i int) types.ValType { return t.Types()[i] }, rv)
+	}
+	fields, err := positional(t, rv, len(elements))
+	if err != nil {
+		return err
+	}
+	for i, element := range elements {
+		if err := unmarshal(t.Types()[i], element, fields[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalFlags(f types.Flags, data any, rv reflect.Value) error {
+	flags, ok := data.(map[string]any)
+	if !ok {
+		return unmarshalMismatch(f, data, rv)
+	}
+	if err := prepare(f, rv); err != nil {
+		return err
+	}
+	for _, label := range f.Labels() {
+		if err := store(f, rv, label, func(field reflect.Value) error {
+			return unmarshal(types.NewBool(), flags[label], field)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalEnum(e types.Enum, data any, rv reflect.Value) error {
+	label, _, err := single(e, data)
+	if err != nil {
+		return err
+	}
+	if rv.Kind() == reflect.String {
+		rv.SetString(label)
+		return nil
+	}
+	for i, l := range e.Labels() {
+		if l == label {
+			return unmarshalInt(e, uint64(i), rv)
+		}
+	}
+	return fmt.Errorf("unmarshal: %q is not a case of %s", label, name(e))
+}
+
+func unmarshalOption(o types.Option, data any, rv reflect.Value) error {
+	label, v, err := single(o, data)
+	if err != nil {
+		return err
+	}
+	switch {
+	case rv.Kind() == reflect.Pointer:
+		if label == "none" {
+			rv.SetZero()
+			return nil
+		}
+		target := reflect.New(rv.Type().Elem())
+		if err := unmarshal(o.Type(), v, target.Elem()); err != nil {
+			return err
+		}
+		rv.Set(target)
+		return nil
+	}
+	return unmarshalMismatch(o, data, rv)
+}
+
+func unmarshalVariant(variant types.Variant, data any, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct {
+		return unmarshalMismatch(variant, data, rv)
+	}
+	label, v, err := single(variant, data)
+	if err != nil {
+		return err
+	}
+	rv.SetZero()
+	for _, c := range variant.Cases() {
+		if c.Label != label {
+			continue
+		}
+		field, err := lookup(variant, rv, c.Label)
+		if err != nil {
+			return err
+		}
+		if field.Kind() != reflect.Pointer {
+			return fmt.Errorf("unmarshal: case %s must be a pointer, found %s", c.Label, field.Type())
+		}
+		target := reflect.New(field.Type().Elem())
+		if c.Type != nil {
+			if err := unmarshal(c.Type, v, target.Elem()); err != nil {
+				return err
+			}
+		}
+		field.Set(target)
+		return nil
+	}
+	return fmt.Errorf("unmarshal: %q is not a case of %s", label, name(variant))
+}
+
+// single returns the case label and payload of a lifted variant. Refinements appended to the label are removed.
+func single(t types.ValType, data any) (string, any, error) {
+	m, ok := data.(map[string]any)
+	if !ok || len(m) != 1 {
+		return "", nil, fmt.Errorf("unmarshal: expected a single case of %s, found %v", name(t), data)
+	}
+	var label string
+	var v any
+	for label, v = range m {
+	}
+	label, _, _ = strings.Cut(label, "|")
+	return label, v, nil
+}
+
+// lookup returns the struct field or map entry for label
+func lookup(t types.ValType, rv reflect.Value, label string) (reflect.Value, error) {
+	if rv.Type() == reflect.TypeOf(types.RecordValue{}) && rv.CanInterface() {
+		record := rv.Interface().(types.RecordValue)
+		for i := range record {
+			if record[i].Label == label {
+				return reflect.ValueOf(&record[i].Value).Elem(), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("marshal: record value has no field for %s label %s", name(t), label)
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		if i, ok := fieldIndex(rv.Type(), label); ok {
+			return rv.Field(i), nil
+		}
+		return reflect.Value{}, fmt.Errorf("marshal: %s has no field for %s label %s", rv.Type(), name(t), label)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		v := rv.MapIndex(reflect.ValueOf(label).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return reflect.Value{}, fmt.Errorf("marshal: map has no entry for %s label %s", name(t), label)
+		}
+		return v, nil
+	}
+	return reflect.Value{}, mismatch(t, rv)
+}
+
+// prepare allocates nil maps before labels are stored
+func prepare(t types.ValType, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+		return nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		return nil
+	}
+	return fmt.Errorf("unmarshal: unable to store %s in %s", name(t), rv.Type())
+}
+
+// store calls set with the struct field or a new map entry for label
+func store(t types.ValType, rv reflect.Value, label string, set func(reflect.Value) error) error {
+	if rv.Kind() == reflect.Map {
+		v := reflect.New(rv.Type().Elem()).Elem()
+		if err := set(v); err != nil {
+			return err
+		}
+		rv.SetMapIndex(reflect.ValueOf(label).Convert(rv.Type().Key()), v)
+		return nil
+	}
+	i, ok := fieldIndex(rv.Type(), label)
+	if !ok {
+		return fmt.Errorf("unmarshal: %s has no field for %s label %s", rv.Type(), name(t), label)
+	}
+	return set(rv.Field(i))
+}
+
+// positional returns the elements of a tuple held in a struct, slice or array
+func positional(t types.ValType, rv reflect.Value, n int) ([]reflect.Value, error) {
+	var elements []reflect.Value
+	switch rv.Kind() {
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).IsExported() {
+				elements = append(elements, rv.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elements = append(elements, rv.Index(i))
+		}
+	default:
+		return nil, mismatch(t, rv)
+	}
+	if len(elements) != n {
+		return nil, fmt.Errorf("marshal: %s has %d elements, expected %d", rv.Type(), len(elements), n)
+	}
+	return elements, nil
+}
+
+// fieldIndex finds the exported field tagged with label or, without a tag, whose name is label in kebab case
+func fieldIndex(st reflect.Type, label string) (int, bool) {
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, ok := field.Tag.Lookup("wit")
+		if ok && tag == label {
+			return i, true
+		}
+		if !ok && kebab(field.Name) == label {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// kebab converts a Go identifier to a wit label. Acronyms are kept together so HTTPServer becomes http-server.
+func kebab(s string) string {
+	runes := []rune(s)
+	var builder strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if i > 0 && (prevLower || nextLower) {
+				builder.WriteRune('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func unsigned(t types.ValType, rv reflect.Value, max uint64) (uint64, error) {
+	var u uint64
+	switch {
+	case isUnsigned(rv):
+		u = rv.Uint()
+	case isSigned(rv):
+		if rv.Int() < 0 {
+			return 0, fmt.Errorf("marshal: %d overflows %s", rv.Int(), name(t))
+		}
+		u = uint64(rv.Int())
+	default:
+		return 0, mismatch(t, rv)
+	}
+	if u > max {
+		return 0, fmt.Errorf("marshal: %d overflows %s", u, name(t))
+	}
+	return u, nil
+}
+
+func signed(t types.ValType, rv reflect.Value, min int64, max int64) (int64, error) {
+	var i int64
+	switch {
+	case isSigned(rv):
+		i = rv.Int()
+	case isUnsigned(rv):
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("marshal: %d overflows %s", rv.Uint(), name(t))
+		}
+		i = int64(rv.Uint())
+	default:
+		return 0, mismatch(t, rv)
+	}
+	if i < min || i > max {
+		return 0, fmt.Errorf("marshal: %d overflows %s", i, name(t))
+	}
+	return i, nil
+}
+
+func isSigned(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUnsigned(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isFloat(rv reflect.Value) bool {
+	return rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64
+}
+
+func mismatch(t types.ValType, rv reflect.Value) error {
+	return fmt.Errorf("marshal: unable to marshal %s as %s", rv.Type(), name(t))
+}
+
+func unmarshalMismatch(t types.ValType, data any, rv reflect.Value) error {
+	return fmt.Errorf("unmarshal: unable to unmarshal %T as %s into %s", data, name(t), rv.Type())
+}
+
+func unmarshalOverflow(t types.ValType, data any, rv reflect.Value) error {
+	return fmt.Errorf("unmarshal: %v of %s overflows %s", data, name(t), rv.Type())
+}
+
+// name returns the wit name of the kind of t for error messages
+func name(t types.ValType) string {
+	switch t.(type) {
+	case types.Bool:
+		return "bool"
+	case types.U8:
+		return "u8"
+	case types.U16:
+		return "u16"
+	case types.U32:
+		return "u32"
+	case types.U64:
+		return "u64"
+	case types.S8:
+		return "s8"
+	case types.S16:
+		return "s16"
+	case types.S32:
+		return "s32"
+	case types.S64:
+		return "s64"
+	case types.F32:
+		return "f32"
+	case types.F64:
+		return "f64"
+	case types.Char:
+		return "char"
+	case types.String:
+		return "string"
+	case types.List:
+		return "list"
+	case types.Record:
+		return "record"
+	case types.Tuple:
+		return "tuple"
+	case types.Flags:
+		return "flags"
+	case types.Enum:
+		return "enum"
+	case types.Option:
+		return "option"
+	case types.Result:
+		return "result"
+	case types.Variant:
+		return "variant"
+	case types.Own:
+		return "own"
+	case types.Borrow:
+		return "borrow"
+	case types.Stream:
+		return "stream"
+	case types.Future:
+		return "future"
+	case types.ErrorContext:
+		return "error-context"
+	}
+	return fmt.Sprintf("%T", t)
+}
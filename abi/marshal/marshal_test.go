@@ -0,0 +1,274 @@
+package marshal_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	gotypes "github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/marshal"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+type Color uint8
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+type Point struct {
+	X int32
+	Y int32
+}
+
+type Person struct {
+	FirstName string
+	Age       uint8 `wit:"years"`
+	Nickname  *string
+	Favorite  Color
+	Scores    []float64
+	Location  Point
+	Pair      struct {
+		Key   string
+		Value bool
+	}
+}
+
+type Permissions struct {
+	Read    bool
+	Write   bool
+	Execute bool `wit:"exec"`
+}
+
+type Shape struct {
+	Circle *float32
+	Square *struct {
+		Side uint32
+	}
+	Empty *struct{}
+}
+
+func TestMarshal(t *testing.T) {
+	nickname := "al"
+	pointType := types.NewRecord(
+		types.Field{Label: "x", Type: types.NewS32()},
+		types.Field{Label: "y", Type: types.NewS32()})
+	personType := types.NewRecord(
+		types.Field{Label: "first-name", Type: types.NewString()},
+		types.Field{Label: "years", Type: types.NewU8()},
+		types.Field{Label: "nickname", Type: types.NewOption(types.NewString())},
+		types.Field{Label: "favorite", Type: types.NewEnum("red", "green", "blue")},
+		types.Field{Label: "scores", Type: types.NewList(types.NewF64())},
+		types.Field{Label: "location", Type: pointType},
+		types.Field{Label: "pair", Type: types.NewTuple(types.NewString(), types.NewBool())})
+	radius := float32(1.5)
+
+	type test struct {
+		name     string
+		t        types.ValType
+		value    any
+		expected any
+	}
+	tests := []test{
+		{"u8", types.NewU8(), 42, uint8(42)},
+		{"s16", types.NewS16(), int64(-2), int16(-2)},
+		{"f32", types.NewF32(), 1.5, float32(1.5)},
+		{"char", types.NewChar(), 'x', 'x'},
+		{"string", types.NewString(), "hello", "hello"},
+		{"list", types.NewList(types.NewU16()), []uint16{1, 2}, []any{uint16(1), uint16(2)}},
+		{"bytes", types.NewList(types.NewU8()), []byte("hi"), []any{uint8('h'), uint8('i')}},
+		{"array", types.NewList(types.NewBool()), [2]bool{true, false}, []any{true, false}},
+		{"fixed_list", types.NewFixedList(types.NewU8(), 3), [3]uint8{1, 2, 3}, []any{uint8(1), uint8(2), uint8(3)}},
+		{
+			"record",
+			personType,
+			Person{FirstName: "alice", Age: 30, Nickname: &nickname, Favorite: Blue, Scores: []float64{1}, Location: Point{X: 1, Y: -1}},
+			types.RecordValue{
+				{Label: "first-name", Value: "alice"},
+				{Label: "years", Value: uint8(30)},
+				{Label: "nickname", Value: map[string]any{"some": "al"}},
+				{Label: "favorite", Value: map[string]any{"blue": nil}},
+				{Label: "scores", Value: []any{float64(1)}},
+				{Label: "location", Value: types.RecordValue{{Label: "x", Value: int32(1)}, {Label: "y", Value: int32(-1)}}},
+				{Label: "pair", Value: []any{"", false}},
+			},
+		},
+		{"record_map", pointType, map[string]int{"x": 1, "y": 2}, types.RecordValue{{Label: "x", Value: int32(1)}, {Label: "y", Value: int32(2)}}},
+		{"tuple_slice", types.NewTuple(types.NewU32(), types.NewU32()), []uint32{1, 2}, []any{uint32(1), uint32(2)}},
+		{
+			"flags",
+			types.NewFlags("read", "write", "exec"),
+			Permissions{Read: true, Execute: true},
+			map[string]any{"read": true, "write": false, "exec": true},
+		},
+		{"flags_map", types.NewFlags("a", "b"), map[string]bool{"a": true, "b": false}, map[string]any{"a": true, "b": false}},
+		{"enum_label", types.NewEnum("red", "green"), "green", map[string]any{"green": nil}},
+		{"option_pointer_none", types.NewOption(types.NewString()), (*string)(nil), map[string]any{"none": nil}},
+		{
+			"variant_payload",
+			types.NewVariant(types.NewCase("circle", types.NewF32()), types.NewCase("square", types.NewRecord(types.Field{Label: "side", Type: types.NewU32()})), types.NewCase("empty", nil)),
+			Shape{Circle: &radius},
+			map[string]any{"circle": float32(1.5)},
+		},
+		{
+			"variant_empty",
+			types.NewVariant(types.NewCase("circle", types.NewF32()), types.NewCase("square", types.NewRecord(types.Field{Label: "side", Type: types.NewU32()})), types.NewCase("empty", nil)),
+			Shape{Empty: &struct{}{}},
+			map[string]any{"empty": nil},
+		},
+		{"own", types.NewOwn(types.NewResourceType(nil, nil)), 7, uint32(7)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := marshal.Marshal(test.t, test.value)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, actual)
+
+			target := reflect.New(reflect.TypeOf(test.value))
+			err = marshal.Unmarshal(test.t, actual, target.Interface())
+			require.NoError(t, err)
+			require.Equal(t, test.value, target.Elem().Interface())
+		})
+	}
+}
+
+type Failure struct {
+	Code uint32
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("failure %d", f.Code)
+}
+
+func TestMarshalGoTypes(t *testing.T) {
+	failure := types.NewRecord(types.Field{Label: "code", Type: types.NewU32()})
+	type test struct {
+		name     string
+		t        types.ValType
+		value    any
+		expected any
+	}
+	tests := []test{
+		{"option_some", types.NewOption(types.NewU32()), option.Some(3), map[string]any{"some": uint32(3)}},
+		{"option_none", types.NewOption(types.NewU32()), option.None[int](), map[string]any{"none": nil}},
+		{"option_field", types.NewRecord(types.Field{Label: "value", Type: types.NewOption(types.NewString())}),
+			struct{ Value gotypes.Option[string] }{option.Some("a")}, types.RecordValue{{Label: "value", Value: map[string]any{"some": "a"}}}},
+		{"result_ok", types.NewResult(types.NewU32(), types.NewString()), result.Ok(1), map[string]any{"ok": uint32(1)}},
+		{"result_ok_empty", types.NewResult(nil, types.NewString()), result.Ok(struct{}{}), map[string]any{"ok": nil}},
+		{"result_error_message", types.NewResult(nil, types.NewString()), result.Errorf[struct{}]("bad"), map[string]any{"error": "bad"}},
+		{"result_error_empty", types.NewResult(types.NewU32(), nil), result.Errorf[int]("bad"), map[string]any{"error": nil}},
+		{"result_error_value", types.NewResult(nil, failure), result.Error[struct{}](Failure{Code: 2}), map[string]any{"error": types.RecordValue{{Label: "code", Value: uint32(2)}}}},
+		{"result_error_payload", types.NewResult(nil, failure), result.Error[struct{}](&marshal.ResultError{Value: types.RecordValue{{Label: "code", Value: uint32(3)}}}), map[string]any{"error": types.RecordValue{{Label: "code", Value: uint32(3)}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := marshal.Marshal(test.t, test.value)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, actual)
+		})
+	}
+
+	var o gotypes.Option[uint32]
+	require.NoError(t, marshal.Unmarshal(types.NewOption(types.NewU32()), map[string]any{"some": uint32(3)}, marshal.OptionOf(&o)))
+	require.Equal(t, option.Some[uint32](3), o)
+	require.NoError(t, marshal.Unmarshal(types.NewOption(types.NewU32()), map[string]any{"none": nil}, marshal.OptionOf(&o)))
+	require.Equal(t, option.None[uint32](), o)
+
+	var r gotypes.Result[Point]
+	pointType := types.NewRecord(types.Field{Label: "x", Type: types.NewS32()}, types.Field{Label: "y", Type: types.NewS32()})
+	resultType := types.NewResult(pointType, failure)
+	require.NoError(t, marshal.Unmarshal(resultType, map[string]any{"ok": types.RecordValue{{Label: "x", Value: int32(1)}, {Label: "y", Value: int32(2)}}}, marshal.ResultOf(&r)))
+	require.Equal(t, result.Ok(Point{X: 1, Y: 2}), r)
+
+	payload := map[string]any{"error": types.RecordValue{{Label: "code", Value: uint32(4)}}}
+	require.NoError(t, marshal.Unmarshal(resultType, payload, marshal.ResultOf(&r)))
+	_, err := r.Deconstruct()
+	var resultError *marshal.ResultError
+	require.ErrorAs(t, err, &resultError)
+	require.Equal(t, types.RecordValue{{Label: "code", Value: uint32(4)}}, resultError.Value)
+	// the error payload marshals back unchanged
+	actual, err := marshal.Marshal(resultType, r)
+	require.NoError(t, err)
+	require.Equal(t, payload, actual)
+
+	require.Error(t, marshal.Unmarshal(types.NewU32(), uint32(1), marshal.OptionOf(&o)))
+	require.Error(t, marshal.Unmarshal(resultType, payload, &r))
+}
+
+func TestMarshalFail(t *testing.T) {
+	type test struct {
+		name  string
+		t     types.ValType
+		value any
+	}
+	tests := []test{
+		{"u8_overflow", types.NewU8(), 256},
+		{"u32_negative", types.NewU32(), -1},
+		{"string_from_int", types.NewString(), 1},
+		{"char_surrogate", types.NewChar(), 0xD800},
+		{"enum_index", types.NewEnum("a"), 1},
+		{"record_missing_field", types.NewRecord(types.Field{Label: "z", Type: types.NewU8()}), Point{}},
+		{"tuple_length", types.NewTuple(types.NewU8()), Point{}},
+		{"fixed_list_length", types.NewFixedList(types.NewU8(), 3), []uint8{1, 2}},
+		{"variant_none_set", types.NewVariant(types.NewCase("circle", types.NewF32())), struct{ Circle *float32 }{}},
+		{"nil", types.NewU8(), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := marshal.Marshal(test.t, test.value)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestUnmarshalFail(t *testing.T) {
+	var u8 uint8
+	require.Error(t, marshal.Unmarshal(types.NewU16(), uint16(300), &u8))
+	require.Error(t, marshal.Unmarshal(types.NewU8(), uint8(1), u8))
+	var s string
+	require.Error(t, marshal.Unmarshal(types.NewString(), 1, &s))
+	var list []uint8
+	require.Error(t, marshal.Unmarshal(types.NewFixedList(types.NewU8(), 2), []any{uint8(1)}, &list))
+}
+
+func TestUnmarshalRefinement(t *testing.T) {
+	variant := types.NewVariant(types.NewCase("circle", types.NewF32()), types.NewCaseRefines("round", types.NewF32(), "circle"))
+	var shape struct {
+		Circle *float32
+		Round  *float32
+	}
+	require.NoError(t, marshal.Unmarshal(variant, map[string]any{"round|circle": float32(2)}, &shape))
+	require.Nil(t, shape.Circle)
+	require.Equal(t, float32(2), *shape.Round)
+}
+
+func TestMarshalStoreLoad(t *testing.T) {
+	cx := &types.CallContext{
+		Options: &types.CanonicalOptions{
+			Memory:         bytes.NewBuffer(make([]byte, 16)),
+			StringEncoding: encoding.UTF8,
+		},
+	}
+	pointType := types.NewRecord(
+		types.Field{Label: "x", Type: types.NewS32()},
+		types.Field{Label: "y", Type: types.NewS32()})
+
+	v, err := marshal.Marshal(pointType, Point{X: 3, Y: -4})
+	require.NoError(t, err)
+	require.NoError(t, io.Store(cx, v, pointType, 0))
+
+	loaded, err := io.Load(cx, pointType, 0)
+	require.NoError(t, err)
+
+	var point Point
+	require.NoError(t, marshal.Unmarshal(pointType, loaded, &point))
+	require.Equal(t, Point{X: 3, Y: -4}, point)
+}
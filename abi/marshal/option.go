@@ -0,0 +1,116 @@
+package marshal
+
+import (
+	"fmt"
+	"reflect"
+
+	gotypes "github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/abi/types"
+)
+
+// optional is the part of the go-types Option interface that does not depend on the value type.
+// The value of an optional is read with its Unwrap method.
+type optional interface {
+	IsSome() bool
+	IsNone() bool
+}
+
+// fallible is the part of the go-types Result interface that does not depend on the value type.
+// The value of a fallible is read with its Unwrap method and the error with its Deconstruct method.
+type fallible interface {
+	IsOk() bool
+	IsError(err ...error) bool
+}
+
+var (
+	optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+	fallibleType = reflect.TypeOf((*fallible)(nil)).Elem()
+)
+
+// ResultError is the error of a result unmarshaled with ResultOf. Value is the error payload in the
+// representation of abi/io, nil when the result has no error type. Marshal uses Value as the payload.
+type ResultError struct {
+	Value any
+}
+
+func (e *ResultError) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	if e.Value == nil {
+		return "result error"
+	}
+	return fmt.Sprint(e.Value)
+}
+
+// target is a destination of Unmarshal that sets a value the reflect package is unable to create
+type target interface {
+	unmarshal(t types.ValType, data any) error
+}
+
+type optionTarget[T any] struct {
+	option *gotypes.Option[T]
+}
+
+// OptionOf returns a destination for Unmarshal that stores a wit option into o. The reflect package
+// is unable to create a go-types Option, so nested options are unmarshaled into pointers instead.
+func OptionOf[T any](o *gotypes.Option[T]) any {
+	return &optionTarget[T]{option: o}
+}
+
+func (target *optionTarget[T]) unmarshal(t types.ValType, data any) error {
+	o, ok := t.(types.Option)
+	if !ok {
+		return fmt.Errorf("unmarshal: unable to unmarshal %s into %T", name(t), *target.option)
+	}
+	label, v, err := single(o, data)
+	if err != nil {
+		return err
+	}
+	if label == "none" {
+		*target.option = option.None[T]()
+		return nil
+	}
+	var value T
+	if err := unmarshal(o.Type(), v, reflect.ValueOf(&value).Elem()); err != nil {
+		return err
+	}
+	*target.option = option.Some(value)
+	return nil
+}
+
+type resultTarget[T any] struct {
+	result *gotypes.Result[T]
+}
+
+// ResultOf returns a destination for Unmarshal that stores a wit result into r. The error case is a
+// *ResultError holding the error payload. The reflect package is unable to create a go-types Result,
+// so results can only be unmarshaled with ResultOf.
+func ResultOf[T any](r *gotypes.Result[T]) any {
+	return &resultTarget[T]{result: r}
+}
+
+func (target *resultTarget[T]) unmarshal(t types.ValType, data any) error {
+	r, ok := t.(types.Result)
+	if !ok {
+		return fmt.Errorf("unmarshal: unable to unmarshal %s into %T", name(t), *target.result)
+	}
+	label, v, err := single(r, data)
+	if err != nil {
+		return err
+	}
+	if label == "error" {
+		*target.result = result.Error[T](&ResultError{Value: v})
+		return nil
+	}
+	var value T
+	if r.Ok() != nil {
+		if err := unmarshal(r.Ok(), v, reflect.ValueOf(&value).Elem()); err != nil {
+			return err
+		}
+	}
+	*target.result = result.Ok(value)
+	return nil
+}
@@ -2,13 +2,16 @@ package types
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/patrickhuber/go-wasm/encoding"
 )
 
 // ReallocFunc defines a memory reallocation signature
-type ReallocFunc func(originalPtr, originalSize, alignment, newSize uint32) (ptr uint32, err error)
-type PostReturnFunc func()
+type ReallocFunc func(ctx context.Context, originalPtr, originalSize, alignment, newSize uint32) (ptr uint32, err error)
+
+// PostReturnFunc is called with the flat results of a lifted call once the caller has finished reading them
+type PostReturnFunc func(ctx context.Context, flatResults []any) error
 
 type CanonicalOptions struct {
 	Memory         *bytes.Buffer
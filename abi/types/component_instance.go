@@ -4,4 +4,12 @@ type ComponentInstance struct {
 	MayEnter bool
 	MayLeave bool
 	Handles  HandleTables
+	// Table holds the waitables, waitable sets and error contexts
+	Table Table
+	// Backpressure defers new async calls until it is released
+	Backpressure bool
+	// Tasks are the started async tasks that have not exited
+	Tasks []*Task
+	// Pending are the async tasks deferred by backpressure
+	Pending []*Task
 }
@@ -1,10 +1,19 @@
 package types
 
+import (
+	"context"
+
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
 type CallContext struct {
+	// Context is the context of the call, realloc and post-return are called with it
+	Context     context.Context
 	Options     *CanonicalOptions
 	Instance    *ComponentInstance
 	Lenders     []*HandleElem
 	BorrowCount int
+	Task        *Task // nil for synchronous calls
 }
 
 func (cx *CallContext) LiftBorrowFrom(lendingHandle *HandleElem) {
@@ -22,7 +31,7 @@ func (cx *CallContext) AddBorrowCountToTable() {
 
 func (cx *CallContext) ExitCall() error {
 	if cx.BorrowCount != 0 {
-		return TrapWith("borrow count != 0")
+		return TrapWith(trap.OutstandingBorrow, "borrow count != 0")
 	}
 	for _, h := range cx.Lenders {
 		h.LendCount -= 1
@@ -0,0 +1,22 @@
+package types
+
+// ErrorContext is an immutable, non-deterministic value carrying debugging information about an error
+type ErrorContext interface {
+	ValType
+	errorContext()
+}
+
+type ErrorContextImpl struct {
+	ValTypeImpl
+}
+
+func (*ErrorContextImpl) errorContext() {}
+
+func NewErrorContext() ErrorContext {
+	return &ErrorContextImpl{}
+}
+
+// ErrorContextElem is the value of an error-context held in a component instance table
+type ErrorContextElem struct {
+	DebugMessage string
+}
@@ -0,0 +1,25 @@
+package types
+
+// Future is a stream of exactly one value. A nil element is a future without a payload.
+type Future interface {
+	ValType
+	Element() ValType
+	future()
+}
+
+type FutureImpl struct {
+	ValTypeImpl
+	element ValType
+}
+
+func (*FutureImpl) future() {}
+
+func (f *FutureImpl) Element() ValType {
+	return f.element
+}
+
+func NewFuture(element ValType) Future {
+	return &FutureImpl{
+		element: element,
+	}
+}
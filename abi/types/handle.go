@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/patrickhuber/go-wasm/internal/collections/stack"
+	"github.com/patrickhuber/go-wasm/trap"
 )
 
 type HandleElem struct {
@@ -38,11 +39,11 @@ func (ht *HandleTable) Add(handle *HandleElem) (uint32, error) {
 
 func (ht *HandleTable) Get(i uint32) (*HandleElem, error) {
 	if i >= uint32(len(ht.Array)) {
-		return nil, TrapWith("index is greater than handle table length")
+		return nil, TrapWith(trap.InvalidHandle, "index is greater than handle table length")
 	}
 	handle := ht.Array[i]
 	if handle == nil {
-		return nil, TrapWith("handle %d is nil", i)
+		return nil, TrapWith(trap.InvalidHandle, "handle %d is nil", i)
 	}
 	return handle, nil
 }
@@ -56,10 +57,10 @@ func (ht *HandleTable) Remove(rt ResourceType, i uint32) (*HandleElem, error) {
 
 	// open handles?
 	if h.LendCount != 0 {
-		return nil, TrapWith("handle table end count != 0")
+		return nil, TrapWith(trap.OutstandingBorrow, "handle table end count != 0")
 	}
 	ht.Array[i] = nil
-	ht.Free = stack.Push(ht.Free, uint32(len(ht.Free)))
+	ht.Free = stack.Push(ht.Free, i)
 	if h.Scope != nil {
 		h.Scope.RemoveBorrowFromTable()
 	}
@@ -68,6 +69,8 @@ func (ht *HandleTable) Remove(rt ResourceType, i uint32) (*HandleElem, error) {
 
 type HandleTables struct {
 	ResourceTypeToTable map[ResourceType]*HandleTable
+	// order holds the resource types in the order their tables were created
+	order []ResourceType
 }
 
 func (ht *HandleTables) Table(rt ResourceType) *HandleTable {
@@ -75,10 +78,32 @@ func (ht *HandleTables) Table(rt ResourceType) *HandleTable {
 	if !ok {
 		t = &HandleTable{}
 		ht.ResourceTypeToTable[rt] = t
+		ht.order = append(ht.order, rt)
 	}
 	return t
 }
 
+// LiveHandle is a handle that has not been dropped or transferred out of its table
+type LiveHandle struct {
+	ResourceType ResourceType
+	Index        uint32
+	Handle       *HandleElem
+}
+
+// Live returns the handles still held by the tables. Handles left at instance teardown
+// are leaks, owned handles were never dropped and their destructors never ran.
+func (ht *HandleTables) Live() []LiveHandle {
+	var live []LiveHandle
+	for _, rt := range ht.order {
+		for i, h := range ht.ResourceTypeToTable[rt].Array {
+			if h != nil {
+				live = append(live, LiveHandle{ResourceType: rt, Index: uint32(i), Handle: h})
+			}
+		}
+	}
+	return live
+}
+
 func (ht *HandleTables) Add(rt ResourceType, handle *HandleElem) (uint32, error) {
 	return ht.Table(rt).Add(handle)
 }
@@ -3,12 +3,16 @@ package types
 type List interface {
 	ValType
 	Type() ValType
+	// Length returns the length of a fixed-size list<T, N>, ok is false for dynamic lists
+	Length() (length uint32, ok bool)
 	list()
 }
 
 type ListImpl struct {
 	ValTypeImpl
-	val ValType
+	val    ValType
+	length uint32
+	fixed  bool
 }
 
 func (*ListImpl) list() {}
@@ -17,8 +21,21 @@ func (l *ListImpl) Type() ValType {
 	return l.val
 }
 
+func (l *ListImpl) Length() (uint32, bool) {
+	return l.length, l.fixed
+}
+
 func NewList(val ValType) List {
 	return &ListImpl{
 		val: val,
 	}
 }
+
+// NewFixedList returns the list<T, N> type with exactly length elements
+func NewFixedList(val ValType, length uint32) List {
+	return &ListImpl{
+		val:    val,
+		length: length,
+		fixed:  true,
+	}
+}
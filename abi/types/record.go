@@ -27,3 +27,22 @@ func NewRecord(fields ...Field) Record {
 		fields: fields,
 	}
 }
+
+// FieldValue is the value of a record field
+type FieldValue struct {
+	Label string
+	Value any
+}
+
+// RecordValue is the value of a record with its fields in the order of the record type
+type RecordValue []FieldValue
+
+// Get returns the value of the field with the label
+func (r RecordValue) Get(label string) (any, bool) {
+	for _, f := range r {
+		if f.Label == label {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
@@ -1,5 +1,7 @@
 package types
 
+import "context"
+
 type ResourceType interface {
 	Type
 	resourcetype()
@@ -7,7 +9,8 @@ type ResourceType interface {
 	Impl() *ComponentInstance
 }
 
-type DTorFunc func(uint32)
+// DTorFunc is called with the representation of an owned resource when its handle is dropped
+type DTorFunc func(ctx context.Context, rep uint32) error
 
 type ResourceTypeImpl struct {
 	TypeImpl
@@ -1,9 +1,14 @@
 package types
 
+import (
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
 type Stream interface {
 	ValType
 	Element() ValType
 	End() ValType
+	stream()
 }
 
 type StreamImpl struct {
@@ -12,6 +17,8 @@ type StreamImpl struct {
 	end     ValType
 }
 
+func (*StreamImpl) stream() {}
+
 // Element implements Stream.
 func (s *StreamImpl) Element() ValType {
 	return s.element
@@ -28,3 +35,189 @@ func NewStream(element ValType, end ValType) Stream {
 		end:     end,
 	}
 }
+
+// CopyResult is the outcome of a stream or future copy
+type CopyResult uint32
+
+const (
+	CopyCompleted CopyResult = iota
+	CopyDropped
+	CopyCancelled
+)
+
+// Blocked is returned by asynchronous built-ins that were unable to complete immediately.
+// The result is delivered later as an event.
+const Blocked uint32 = 0xffff_ffff
+
+// PackCopyResult packs the result and the number of elements copied into an event payload
+func PackCopyResult(result CopyResult, progress uint32) uint32 {
+	return uint32(result) | progress<<4
+}
+
+// Buffer is one side of a stream or future copy
+type Buffer interface {
+	Remain() uint32
+	Progress() uint32
+}
+
+// ReadableBuffer is the source of a copy
+type ReadableBuffer interface {
+	Buffer
+	Read(n uint32) ([]any, error)
+}
+
+// WritableBuffer is the destination of a copy
+type WritableBuffer interface {
+	Buffer
+	Write(vs []any) error
+}
+
+// OnCopyDone is called once when a read or write completes, is cancelled or the other end is dropped
+type OnCopyDone func(result CopyResult)
+
+// SharedStream is the state shared by the readable and writable end of a stream or future.
+// At most one read or write is pending at a time; the next opposite operation copies
+// into or out of it and completes both.
+type SharedStream struct {
+	element           ValType
+	pendingBuffer     Buffer
+	pendingOnCopyDone OnCopyDone
+	dropped           bool
+}
+
+func NewSharedStream(element ValType) *SharedStream {
+	return &SharedStream{
+		element: element,
+	}
+}
+
+// Element returns the element type or nil for streams and futures without a payload
+func (s *SharedStream) Element() ValType {
+	return s.element
+}
+
+func (s *SharedStream) Dropped() bool {
+	return s.dropped
+}
+
+func (s *SharedStream) Read(dst WritableBuffer, onCopyDone OnCopyDone) error {
+	if s.dropped {
+		onCopyDone(CopyDropped)
+		return nil
+	}
+	if s.pendingBuffer == nil {
+		s.setPending(dst, onCopyDone)
+		return nil
+	}
+	src, ok := s.pendingBuffer.(ReadableBuffer)
+	if !ok {
+		return TrapWith(trap.InvalidState, "stream already has a pending read")
+	}
+	if src.Remain() == 0 {
+		s.resetAndNotifyPending(CopyCompleted)
+		s.setPending(dst, onCopyDone)
+		return nil
+	}
+	if dst.Remain() > 0 {
+		if err := transfer(src, dst); err != nil {
+			return err
+		}
+		s.resetAndNotifyPending(CopyCompleted)
+	}
+	onCopyDone(CopyCompleted)
+	return nil
+}
+
+func (s *SharedStream) Write(src ReadableBuffer, onCopyDone OnCopyDone) error {
+	if s.dropped {
+		onCopyDone(CopyDropped)
+		return nil
+	}
+	if s.pendingBuffer == nil {
+		s.setPending(src, onCopyDone)
+		return nil
+	}
+	dst, ok := s.pendingBuffer.(WritableBuffer)
+	if !ok {
+		return TrapWith(trap.InvalidState, "stream already has a pending write")
+	}
+	if dst.Remain() == 0 {
+		s.resetAndNotifyPending(CopyCompleted)
+		s.setPending(src, onCopyDone)
+		return nil
+	}
+	if src.Remain() > 0 {
+		if err := transfer(src, dst); err != nil {
+			return err
+		}
+		s.resetAndNotifyPending(CopyCompleted)
+	}
+	onCopyDone(CopyCompleted)
+	return nil
+}
+
+// Cancel completes the pending read or write with CopyCancelled
+func (s *SharedStream) Cancel() {
+	if s.pendingBuffer != nil {
+		s.resetAndNotifyPending(CopyCancelled)
+	}
+}
+
+// Drop closes the stream. A pending read or write completes with CopyDropped.
+func (s *SharedStream) Drop() {
+	if s.dropped {
+		return
+	}
+	s.dropped = true
+	if s.pendingBuffer != nil {
+		s.resetAndNotifyPending(CopyDropped)
+	}
+}
+
+func (s *SharedStream) setPending(buffer Buffer, onCopyDone OnCopyDone) {
+	s.pendingBuffer = buffer
+	s.pendingOnCopyDone = onCopyDone
+}
+
+func (s *SharedStream) resetAndNotifyPending(result CopyResult) {
+	onCopyDone := s.pendingOnCopyDone
+	s.pendingBuffer = nil
+	s.pendingOnCopyDone = nil
+	onCopyDone(result)
+}
+
+func transfer(src ReadableBuffer, dst WritableBuffer) error {
+	n := src.Remain()
+	if dst.Remain() < n {
+		n = dst.Remain()
+	}
+	vs, err := src.Read(n)
+	if err != nil {
+		return err
+	}
+	return dst.Write(vs)
+}
+
+// CopyEnd is the state of one end of a stream or future held in a component instance table
+type CopyEnd struct {
+	Waitable
+	Shared  *SharedStream
+	Copying bool
+	Done    bool
+}
+
+type ReadableStreamEnd struct {
+	CopyEnd
+}
+
+type WritableStreamEnd struct {
+	CopyEnd
+}
+
+type ReadableFutureEnd struct {
+	CopyEnd
+}
+
+type WritableFutureEnd struct {
+	CopyEnd
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"github.com/patrickhuber/go-wasm/internal/collections/stack"
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// MaxTableLength is the maximum number of elements a component instance table may hold
+const MaxTableLength = 1 << 28
+
+// Table holds the waitables, waitable sets and error contexts of a component instance.
+// Index 0 is reserved so built-ins can use it as a null index.
+type Table struct {
+	Array []any
+	Free  []uint32
+}
+
+func (t *Table) Add(e any) (uint32, error) {
+	if len(t.Array) == 0 {
+		t.Array = append(t.Array, nil)
+	}
+	free, i, ok := stack.Pop(t.Free)
+	t.Free = free
+	if ok {
+		t.Array[i] = e
+		return i, nil
+	}
+	if len(t.Array) >= MaxTableLength {
+		return 0, TrapWith(trap.LengthOverflow, "table length exceeds %d", MaxTableLength)
+	}
+	i = uint32(len(t.Array))
+	t.Array = append(t.Array, e)
+	return i, nil
+}
+
+func (t *Table) Get(i uint32) (any, error) {
+	if i == 0 || i >= uint32(len(t.Array)) {
+		return nil, TrapWith(trap.InvalidHandle, "table index %d is out of bounds", i)
+	}
+	e := t.Array[i]
+	if e == nil {
+		return nil, TrapWith(trap.InvalidHandle, "table element %d is nil", i)
+	}
+	return e, nil
+}
+
+func (t *Table) Remove(i uint32) (any, error) {
+	e, err := t.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	t.Array[i] = nil
+	t.Free = stack.Push(t.Free, i)
+	return e, nil
+}
+
+// GetWaitable returns the waitable embedded in the stream, future or subtask at index i
+func (t *Table) GetWaitable(i uint32) (*Waitable, error) {
+	e, err := t.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	w, ok := e.(interface{ waitable() *Waitable })
+	if !ok {
+		return nil, TrapWith(trap.InvalidHandle, "table element %d of type %T is not a waitable", i, e)
+	}
+	return w.waitable(), nil
+}
+
+// TableGet returns the element at index i and traps if it is not a T
+func TableGet[T any](t *Table, i uint32) (T, error) {
+	var zero T
+	e, err := t.Get(i)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := e.(T)
+	if !ok {
+		return zero, TrapWith(trap.InvalidHandle, "table element %d of type %T is not a %T", i, e, zero)
+	}
+	return typed, nil
+}
+
+// TableRemove removes the element at index i and traps if it is not a T
+func TableRemove[T any](t *Table, i uint32) (T, error) {
+	typed, err := TableGet[T](t, i)
+	if err != nil {
+		return typed, err
+	}
+	_, err = t.Remove(i)
+	return typed, err
+}
@@ -0,0 +1,44 @@
+package types
+
+// CallbackCode is the low nibble of the value returned by an async lifted export and its callback.
+// The remaining bits hold the waitable set index for CallbackWait and CallbackPoll.
+type CallbackCode uint32
+
+const (
+	CallbackExit CallbackCode = iota
+	CallbackYield
+	CallbackWait
+	CallbackPoll
+)
+
+type TaskState int
+
+const (
+	// TaskPending tasks are waiting for backpressure to be released
+	TaskPending TaskState = iota
+	// TaskRunning tasks are executing their export or callback
+	TaskRunning
+	// TaskWaiting tasks are suspended until their Code is satisfied
+	TaskWaiting
+	// TaskDone tasks have exited
+	TaskDone
+)
+
+// CallbackFunc delivers an event to a task and returns the packed callback code
+type CallbackFunc func(e Event) (uint32, error)
+
+// Task is a single call to an async lifted export
+type Task struct {
+	Context  *CallContext
+	FuncType FuncType
+	State    TaskState
+	Returned bool
+	// OnReturn receives the lifted results passed to task.return
+	OnReturn func(results []any)
+	// Start runs the export once the task is no longer pending
+	Start    func() error
+	Callback CallbackFunc
+	// Code and Set describe what a waiting task is waiting for
+	Code CallbackCode
+	Set  *WaitableSet
+}
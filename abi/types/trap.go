@@ -1,18 +1,15 @@
 package types
 
-import "fmt"
+import (
+	"github.com/patrickhuber/go-wasm/trap"
+)
 
-type trap struct{}
-
-func (t *trap) Error() string {
-	return ""
-}
+// Trap returns a trap without a code, errors.Is(err, Trap()) is true for every trap
 func Trap() error {
-	return &trap{}
+	return &trap.Trap{}
 }
 
-func TrapWith(message string, args ...any) error {
-	err := Trap()
-	args = append(args, err)
-	return fmt.Errorf(message+" %w", args...)
+// TrapWith returns a trap with the code and the formatted message, a %w verb sets the cause of the trap
+func TrapWith(code trap.Code, message string, args ...any) error {
+	return trap.New(code, message, args...)
 }
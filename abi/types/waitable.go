@@ -0,0 +1,118 @@
+package types
+
+import (
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// EventCode identifies the kind of event delivered to a waiting task
+type EventCode uint32
+
+const (
+	EventNone EventCode = iota
+	EventSubtask
+	EventStreamRead
+	EventStreamWrite
+	EventFutureRead
+	EventFutureWrite
+	EventTaskCancelled
+)
+
+// Event is delivered to a task when one of the waitables it waits on makes progress.
+// Index is the table index of the waitable and Payload the event specific result.
+type Event struct {
+	Code    EventCode
+	Index   uint32
+	Payload uint32
+}
+
+// Waitable is embedded in every table element a task can wait on
+type Waitable struct {
+	event *Event
+	set   *WaitableSet
+}
+
+func (w *Waitable) waitable() *Waitable {
+	return w
+}
+
+// SetEvent records the pending event, replacing any event that has not been delivered yet
+func (w *Waitable) SetEvent(e Event) {
+	w.event = &e
+}
+
+func (w *Waitable) HasPendingEvent() bool {
+	return w.event != nil
+}
+
+// TakeEvent removes and returns the pending event
+func (w *Waitable) TakeEvent() (Event, bool) {
+	if w.event == nil {
+		return Event{}, false
+	}
+	e := *w.event
+	w.event = nil
+	return e, true
+}
+
+// Set returns the waitable set the waitable has joined or nil
+func (w *Waitable) Set() *WaitableSet {
+	return w.set
+}
+
+// Join moves the waitable into set. A nil set removes the waitable from its current set.
+func (w *Waitable) Join(set *WaitableSet) {
+	if w.set != nil {
+		elems := w.set.elems[:0]
+		for _, e := range w.set.elems {
+			if e != w {
+				elems = append(elems, e)
+			}
+		}
+		w.set.elems = elems
+	}
+	w.set = set
+	if set != nil {
+		set.elems = append(set.elems, w)
+	}
+}
+
+// WaitableSet groups waitables so a task can wait on any of them
+type WaitableSet struct {
+	elems      []*Waitable
+	NumWaiting int
+}
+
+// Len returns the number of waitables in the set
+func (s *WaitableSet) Len() int {
+	return len(s.elems)
+}
+
+// Poll takes the pending event of the first waitable that has one
+func (s *WaitableSet) Poll() (Event, bool) {
+	for _, w := range s.elems {
+		if e, ok := w.TakeEvent(); ok {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+func (s *WaitableSet) HasPendingEvent() bool {
+	for _, w := range s.elems {
+		if w.HasPendingEvent() {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop traps if the set still has members or a task is waiting on it
+func (s *WaitableSet) Drop() error {
+	if len(s.elems) > 0 {
+		return TrapWith(trap.InvalidState, "waitable set has %d members", len(s.elems))
+	}
+	if s.NumWaiting > 0 {
+		return TrapWith(trap.InvalidState, "waitable set has %d waiting tasks", s.NumWaiting)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package wave
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/patrickhuber/go-wasm/diagnostic"
+)
+
+type kind int
+
+const (
+	eof kind = iota
+	punctuation
+	label
+	number
+	char
+	str
+)
+
+type token struct {
+	kind kind
+	// text is the source text of the token, for char and string tokens it is the unescaped contents
+	text string
+	// escaped is true for labels written with a leading '%'
+	escaped bool
+	span    diagnostic.Span
+}
+
+func (t *token) String() string {
+	switch t.kind {
+	case eof:
+		return "end of input"
+	case char:
+		return strconv.QuoteRune([]rune(t.text)[0])
+	case str:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+type lexer struct {
+	input    string
+	position diagnostic.Position
+	peeked   *token
+}
+
+func (l *lexer) errorf(span diagnostic.Span, format string, args ...any) error {
+	d := diagnostic.New(span, format, args...)
+	d.Source = l.input
+	return d
+}
+
+func (l *lexer) peek() (*token, error) {
+	if l.peeked == nil {
+		tok, err := l.scan()
+		if err != nil {
+			return nil, err
+		}
+		l.peeked = tok
+	}
+	return l.peeked, nil
+}
+
+func (l *lexer) next() (*token, error) {
+	tok, err := l.peek()
+	l.peeked = nil
+	return tok, err
+}
+
+func (l *lexer) rest() string {
+	return l.input[l.position.Offset:]
+}
+
+func (l *lexer) advance(n int) string {
+	text := l.rest()[:n]
+	l.position = l.position.Advance(text)
+	return text
+}
+
+func (l *lexer) skip() {
+	for {
+		rest := l.rest()
+		switch {
+		case rest == "":
+			return
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			l.advance(end)
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			l.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) scan() (*token, error) {
+	l.skip()
+	start := l.position
+	rest := l.rest()
+	tok := &token{}
+	switch {
+	case rest == "":
+		tok.kind = eof
+	case strings.ContainsRune("()[]{},:", rune(rest[0])):
+		tok.kind = punctuation
+		tok.text = l.advance(1)
+	case rest[0] == '\'':
+		text, err := l.quoted('\'')
+		if err != nil {
+			return nil, err
+		}
+		if utf8.RuneCountInString(text) != 1 {
+			return nil, l.errorf(diagnostic.Span{Start: start, End: l.position}, "char literal must contain exactly one character")
+		}
+		tok.kind = char
+		tok.text = text
+	case rest[0] == '"':
+		text, err := l.quoted('"')
+		if err != nil {
+			return nil, err
+		}
+		tok.kind = str
+		tok.text = text
+	case rest[0] == '-' || isDigit(rest[0]):
+		tok.kind = number
+		tok.text = l.advance(l.span(func(b byte) bool {
+			return isDigit(b) || isLetter(b) || b == '.' || b == '-' || b == '+'
+		}))
+	case rest[0] == '%' || isLetter(rest[0]):
+		tok.kind = label
+		if rest[0] == '%' {
+			tok.escaped = true
+			l.advance(1)
+		}
+		tok.text = l.advance(l.span(func(b byte) bool {
+			return isDigit(b) || isLetter(b) || b == '-'
+		}))
+		if tok.text == "" {
+			return nil, l.errorf(diagnostic.Span{Start: start, End: l.position}, "expected a label after '%%'")
+		}
+	default:
+		r, size := utf8.DecodeRuneInString(rest)
+		end := start.Advance(rest[:size])
+		return nil, l.errorf(diagnostic.Span{Start: start, End: end}, "unexpected character %q", r)
+	}
+	tok.span = diagnostic.Span{Start: start, End: l.position}
+	return tok, nil
+}
+
+// span returns the length of the prefix of the remaining input that matches
+func (l *lexer) span(match func(byte) bool) int {
+	rest := l.rest()
+	i := 0
+	for i < len(rest) && match(rest[i]) {
+		i++
+	}
+	return i
+}
+
+// quoted reads a char or string literal and returns the unescaped contents
+func (l *lexer) quoted(quote byte) (string, error) {
+	start := l.position
+	l.advance(1)
+	var builder strings.Builder
+	for {
+		rest := l.rest()
+		if rest == "" || rest[0] == '\n' {
+			return "", l.errorf(diagnostic.Span{Start: start, End: l.position}, "unterminated literal")
+		}
+		if rest[0] == quote {
+			l.advance(1)
+			return builder.String(), nil
+		}
+		if rest[0] != '\\' {
+			_, size := utf8.DecodeRuneInString(rest)
+			builder.WriteString(l.advance(size))
+			continue
+		}
+		escapeStart := l.position
+		if len(rest) < 2 {
+			return "", l.errorf(diagnostic.Span{Start: start, End: l.position}, "unterminated literal")
+		}
+		switch rest[1] {
+		case '\'', '"', '\\':
+			builder.WriteByte(rest[1])
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'u':
+			end := strings.IndexByte(rest, '}')
+			if !strings.HasPrefix(rest[2:], "{") || end < 0 {
+				return "", l.errorf(diagnostic.Span{Start: escapeStart, End: escapeStart.Advance(rest[:2])}, "expected '{' after '\\u'")
+			}
+			code, err := strconv.ParseUint(rest[3:end], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", l.errorf(diagnostic.Span{Start: escapeStart, End: escapeStart.Advance(rest[:end+1])}, "invalid unicode escape %s", rest[:end+1])
+			}
+			builder.WriteRune(rune(code))
+			l.advance(end + 1)
+			continue
+		default:
+			return "", l.errorf(diagnostic.Span{Start: escapeStart, End: escapeStart.Advance(rest[:2])}, "invalid escape %s", rest[:2])
+		}
+		l.advance(2)
+	}
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,456 @@
+// package wave reads and writes component values in the WebAssembly Value Encoding
+// https://github.com/bytecodealliance/wasm-tools/tree/main/crates/wasm-wave
+//
+// Values use the representation of abi/io: records are a types.RecordValue in field order,
+// variants, enums, options and results are a map with a single case label, flags map every
+// label to a bool and lists and tuples are []any.
+package wave
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/diagnostic"
+)
+
+// keywords must be written with a leading '%' when they are used as labels
+var keywords = map[string]bool{
+	"true":  true,
+	"false": true,
+	"some":  true,
+	"none":  true,
+	"ok":    true,
+	"err":   true,
+	"inf":   true,
+	"nan":   true,
+}
+
+// Parse reads the wave text of a value of type t
+func Parse(input string, t types.ValType) (any, error) {
+	p := &parser{lexer: &lexer{input: input}}
+	v, err := p.value(t)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := p.lexer.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind != eof {
+		return nil, p.unexpected(tok, "end of input")
+	}
+	return v, nil
+}
+
+type parser struct {
+	lexer *lexer
+}
+
+func (p *parser) unexpected(tok *token, expected ...string) error {
+	d := diagnostic.New(tok.span, "unexpected %s", tok)
+	d.Source = p.lexer.input
+	d.Expected = expected
+	return d
+}
+
+func (p *parser) errorf(tok *token, format string, args ...any) error {
+	return p.lexer.errorf(tok.span, format, args...)
+}
+
+// accept consumes the punctuation when it is next
+func (p *parser) accept(punct string) (bool, error) {
+	tok, err := p.lexer.peek()
+	if err != nil {
+		return false, err
+	}
+	if tok.kind != punctuation || tok.text != punct {
+		return false, nil
+	}
+	_, err = p.lexer.next()
+	return true, err
+}
+
+func (p *parser) expect(punct string) error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	if tok.kind != punctuation || tok.text != punct {
+		return p.unexpected(tok, "'"+punct+"'")
+	}
+	return nil
+}
+
+// sequence parses elements separated by commas up to the closing punctuation, a trailing comma is allowed
+func (p *parser) sequence(close string, element func() error) error {
+	for {
+		done, err := p.accept(close)
+		if err != nil || done {
+			return err
+		}
+		if err := element(); err != nil {
+			return err
+		}
+		comma, err := p.accept(",")
+		if err != nil {
+			return err
+		}
+		if !comma {
+			return p.expect(close)
+		}
+	}
+}
+
+func (p *parser) label() (*token, error) {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind != label {
+		return nil, p.unexpected(tok, "label")
+	}
+	return tok, nil
+}
+
+func (p *parser) value(t types.ValType) (any, error) {
+	switch vt := t.(type) {
+	case types.Bool:
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == label && !tok.escaped && (tok.text == "true" || tok.text == "false") {
+			return tok.text == "true", nil
+		}
+		return nil, p.unexpected(tok, "'true'", "'false'")
+	case types.S8, types.S16, types.S32, types.S64, types.U8, types.U16, types.U32, types.U64:
+		return p.integer(t)
+	case types.F32:
+		f, err := p.float(32)
+		return float32(f), err
+	case types.F64:
+		return p.float(64)
+	case types.Char:
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != char {
+			return nil, p.unexpected(tok, "char")
+		}
+		return []rune(tok.text)[0], nil
+	case types.String:
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != str {
+			return nil, p.unexpected(tok, "string")
+		}
+		return tok.text, nil
+	case types.List:
+		open, err := p.lexer.peek()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		var list []any
+		err = p.sequence("]", func() error {
+			v, err := p.value(vt.Type())
+			list = append(list, v)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if length, fixed := vt.Length(); fixed && uint32(len(list)) != length {
+			return nil, p.errorf(open, "expected %d list elements, found %d", length, len(list))
+		}
+		return list, nil
+	case types.Tuple:
+		return p.tuple(vt)
+	case types.Record:
+		return p.record(vt)
+	case types.Flags:
+		return p.flags(vt)
+	case types.Enum:
+		return p.cases(func(label string) (types.ValType, bool) {
+			for _, l := range vt.Labels() {
+				if l == label {
+					return nil, true
+				}
+			}
+			return nil, false
+		})
+	case types.Option:
+		return p.keywordCases([]string{"none", "some"}, []string{"none", "some"}, func(label string) types.ValType {
+			if label == "some" {
+				return vt.Type()
+			}
+			return nil
+		})
+	case types.Result:
+		return p.keywordCases([]string{"ok", "err"}, []string{"ok", "error"}, func(label string) types.ValType {
+			if label == "ok" {
+				return vt.Ok()
+			}
+			return vt.Error()
+		})
+	case types.Variant:
+		return p.cases(func(label string) (types.ValType, bool) {
+			for _, c := range vt.Cases() {
+				if c.Label == label {
+					return c.Type, true
+				}
+			}
+			return nil, false
+		})
+	}
+	return nil, fmt.Errorf("wave: unsupported type %T", t)
+}
+
+func (p *parser) integer(t types.ValType) (any, error) {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind != number {
+		return nil, p.unexpected(tok, "integer")
+	}
+	parseInt := func(bits int) (int64, error) {
+		i, err := strconv.ParseInt(tok.text, 10, bits)
+		if err != nil {
+			return 0, p.errorf(tok, "invalid s%d %s", bits, tok.text)
+		}
+		return i, nil
+	}
+	parseUint := func(bits int) (uint64, error) {
+		u, err := strconv.ParseUint(tok.text, 10, bits)
+		if err != nil {
+			return 0, p.errorf(tok, "invalid u%d %s", bits, tok.text)
+		}
+		return u, nil
+	}
+	switch t.(type) {
+	case types.S8:
+		i, err := parseInt(8)
+		return int8(i), err
+	case types.S16:
+		i, err := parseInt(16)
+		return int16(i), err
+	case types.S32:
+		i, err := parseInt(32)
+		return int32(i), err
+	case types.S64:
+		return parseInt(64)
+	case types.U8:
+		u, err := parseUint(8)
+		return uint8(u), err
+	case types.U16:
+		u, err := parseUint(16)
+		return uint16(u), err
+	case types.U32:
+		u, err := parseUint(32)
+		return uint32(u), err
+	}
+	return parseUint(64)
+}
+
+func (p *parser) float(bits int) (float64, error) {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case tok.kind == label && !tok.escaped && tok.text == "nan":
+		return math.NaN(), nil
+	case tok.kind == label && !tok.escaped && tok.text == "inf":
+		return math.Inf(1), nil
+	case tok.kind == number && tok.text == "-inf":
+		return math.Inf(-1), nil
+	case tok.kind != number:
+		return 0, p.unexpected(tok, "number")
+	}
+	f, err := strconv.ParseFloat(tok.text, bits)
+	if err != nil {
+		return 0, p.errorf(tok, "invalid f%d %s", bits, tok.text)
+	}
+	return f, nil
+}
+
+func (p *parser) tuple(t types.Tuple) (any, error) {
+	open, err := p.lexer.peek()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	tuple := []any{}
+	err = p.sequence(")", func() error {
+		i := len(tuple)
+		if i >= len(t.Types()) {
+			tok, _ := p.lexer.peek()
+			return p.errorf(tok, "tuple has %d elements", len(t.Types()))
+		}
+		v, err := p.value(t.Types()[i])
+		tuple = append(tuple, v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tuple) != len(t.Types()) {
+		return nil, p.errorf(open, "expected %d tuple elements, found %d", len(t.Types()), len(tuple))
+	}
+	return tuple, nil
+}
+
+func (p *parser) record(t types.Record) (any, error) {
+	open, err := p.lexer.peek()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	record := map[string]any{}
+	// {:} is the record with every field omitted
+	empty, err := p.accept(":")
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		err = p.expect("}")
+	} else {
+		err = p.sequence("}", func() error {
+			tok, err := p.label()
+			if err != nil {
+				return err
+			}
+			field, ok := findField(t, tok.text)
+			if !ok {
+				return p.errorf(tok, "unknown field '%s'", tok.text)
+			}
+			if _, ok := record[field.Label]; ok {
+				return p.errorf(tok, "duplicate field '%s'", tok.text)
+			}
+			if err := p.expect(":"); err != nil {
+				return err
+			}
+			v, err := p.value(field.Type)
+			record[field.Label] = v
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	// option fields may be omitted and default to none
+	ordered := make(types.RecordValue, 0, len(t.Fields()))
+	for _, field := range t.Fields() {
+		v, ok := record[field.Label]
+		if !ok {
+			if _, ok := field.Type.(types.Option); !ok {
+				return nil, p.errorf(open, "missing field '%s'", field.Label)
+			}
+			v = map[string]any{"none": nil}
+		}
+		ordered = append(ordered, types.FieldValue{Label: field.Label, Value: v})
+	}
+	return ordered, nil
+}
+
+func findField(t types.Record, label string) (types.Field, bool) {
+	for _, field := range t.Fields() {
+		if field.Label == label {
+			return field, true
+		}
+	}
+	return types.Field{}, false
+}
+
+func (p *parser) flags(t types.Flags) (any, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	flags := map[string]any{}
+	for _, l := range t.Labels() {
+		flags[l] = false
+	}
+	err := p.sequence("}", func() error {
+		tok, err := p.label()
+		if err != nil {
+			return err
+		}
+		set, ok := flags[tok.text]
+		if !ok {
+			return p.errorf(tok, "unknown flag '%s'", tok.text)
+		}
+		if set.(bool) {
+			return p.errorf(tok, "duplicate flag '%s'", tok.text)
+		}
+		flags[tok.text] = true
+		return nil
+	})
+	return flags, err
+}
+
+// cases parses `label` or `label(payload)` for variants and enums
+func (p *parser) cases(lookup func(string) (types.ValType, bool)) (any, error) {
+	tok, err := p.label()
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := lookup(tok.text)
+	if !ok {
+		return nil, p.errorf(tok, "unknown case '%s'", tok.text)
+	}
+	return p.payload(tok, tok.text, payload)
+}
+
+// keywordCases parses the unescaped keyword cases of options and results, each keyword maps to the case label at the same index
+func (p *parser) keywordCases(keywords []string, labels []string, payload func(string) types.ValType) (any, error) {
+	tok, err := p.label()
+	if err != nil {
+		return nil, err
+	}
+	for i, keyword := range keywords {
+		if !tok.escaped && tok.text == keyword {
+			return p.payload(tok, labels[i], payload(keyword))
+		}
+	}
+	expected := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		expected[i] = "'" + keyword + "'"
+	}
+	return nil, p.unexpected(tok, expected...)
+}
+
+func (p *parser) payload(tok *token, label string, t types.ValType) (any, error) {
+	open, err := p.accept("(")
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		if open {
+			return nil, p.errorf(tok, "case '%s' has no payload", tok.text)
+		}
+		return map[string]any{label: nil}, nil
+	}
+	if !open {
+		return nil, p.errorf(tok, "case '%s' requires a payload", tok.text)
+	}
+	v, err := p.value(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return map[string]any{label: v}, nil
+}
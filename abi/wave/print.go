@@ -0,0 +1,318 @@
+package wave
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+)
+
+// Print writes the wave text of the value v of type t
+func Print(writer io.Writer, v any, t types.ValType) error {
+	p := &printer{writer: writer}
+	p.value(v, t)
+	return p.err
+}
+
+// String returns the wave text of the value v of type t
+func String(v any, t types.ValType) (string, error) {
+	var builder strings.Builder
+	err := Print(&builder, v, t)
+	return builder.String(), err
+}
+
+type printer struct {
+	writer io.Writer
+	err    error
+}
+
+func (p *printer) write(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.writer, format, args...)
+}
+
+func (p *printer) fail(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	p.err = fmt.Errorf("wave: "+format, args...)
+}
+
+func (p *printer) value(v any, t types.ValType) {
+	switch vt := t.(type) {
+	case types.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			p.fail("expected bool, found %T", v)
+			return
+		}
+		p.write("%t", b)
+	case types.S8, types.S16, types.S32, types.S64:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			p.write("%d", rv.Int())
+		default:
+			p.fail("expected signed integer, found %T", v)
+		}
+	case types.U8, types.U16, types.U32, types.U64:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			p.write("%d", rv.Uint())
+		default:
+			p.fail("expected unsigned integer, found %T", v)
+		}
+	case types.F32:
+		f, ok := v.(float32)
+		if !ok {
+			p.fail("expected float32, found %T", v)
+			return
+		}
+		p.float(float64(f), 32)
+	case types.F64:
+		f, ok := v.(float64)
+		if !ok {
+			p.fail("expected float64, found %T", v)
+			return
+		}
+		p.float(f, 64)
+	case types.Char:
+		r, ok := v.(rune)
+		if !ok {
+			p.fail("expected rune, found %T", v)
+			return
+		}
+		p.write("'%s'", escape(string(r), '\''))
+	case types.String:
+		s, ok := v.(string)
+		if !ok {
+			p.fail("expected string, found %T", v)
+			return
+		}
+		p.write("\"%s\"", escape(s, '"'))
+	case types.List:
+		list, ok := v.([]any)
+		if !ok && v != nil {
+			p.fail("expected []any, found %T", v)
+			return
+		}
+		p.write("[")
+		for i, e := range list {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.value(e, vt.Type())
+		}
+		p.write("]")
+	case types.Tuple:
+		tuple, ok := v.([]any)
+		if !ok {
+			p.fail("expected []any, found %T", v)
+			return
+		}
+		if len(tuple) != len(vt.Types()) {
+			p.fail("expected %d tuple elements, found %d", len(vt.Types()), len(tuple))
+			return
+		}
+		p.write("(")
+		for i, et := range vt.Types() {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.value(tuple[i], et)
+		}
+		p.write(")")
+	case types.Record:
+		p.record(v, vt)
+	case types.Flags:
+		flags, ok := p.fields(v)
+		if !ok {
+			return
+		}
+		p.write("{")
+		first := true
+		for _, l := range vt.Labels() {
+			set, _ := flags[l].(bool)
+			if !set {
+				continue
+			}
+			if !first {
+				p.write(", ")
+			}
+			first = false
+			p.write("%s", Label(l))
+		}
+		p.write("}")
+	case types.Enum:
+		label, _, ok := p.single(v)
+		if ok {
+			p.write("%s", Label(label))
+		}
+	case types.Option:
+		label, payload, ok := p.single(v)
+		if !ok {
+			return
+		}
+		switch label {
+		case "none":
+			p.write("none")
+		case "some":
+			p.write("some(")
+			p.value(payload, vt.Type())
+			p.write(")")
+		default:
+			p.fail("invalid option case '%s'", label)
+		}
+	case types.Result:
+		label, payload, ok := p.single(v)
+		if !ok {
+			return
+		}
+		switch label {
+		case "ok":
+			p.payload("ok", payload, vt.Ok())
+		case "error":
+			p.payload("err", payload, vt.Error())
+		default:
+			p.fail("invalid result case '%s'", label)
+		}
+	case types.Variant:
+		label, payload, ok := p.single(v)
+		if !ok {
+			return
+		}
+		for _, c := range vt.Cases() {
+			if c.Label == label {
+				p.payload(Label(label), payload, c.Type)
+				return
+			}
+		}
+		p.fail("invalid variant case '%s'", label)
+	default:
+		p.fail("unsupported type %T", t)
+	}
+}
+
+func (p *printer) float(f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		p.write("nan")
+	case math.IsInf(f, 1):
+		p.write("inf")
+	case math.IsInf(f, -1):
+		p.write("-inf")
+	default:
+		p.write("%s", strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
+
+func (p *printer) record(v any, t types.Record) {
+	record, ok := v.(types.RecordValue)
+	if !ok {
+		p.fail("expected types.RecordValue, found %T", v)
+		return
+	}
+	// option fields that are none are omitted
+	var fields []types.Field
+	for _, field := range t.Fields() {
+		fv, ok := record.Get(field.Label)
+		if !ok {
+			p.fail("missing field '%s'", field.Label)
+			return
+		}
+		if _, option := field.Type.(types.Option); option {
+			if m, ok := fv.(map[string]any); ok {
+				if _, none := m["none"]; none && len(m) == 1 {
+					continue
+				}
+			}
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		p.write("{:}")
+		return
+	}
+	p.write("{")
+	for i, field := range fields {
+		if i > 0 {
+			p.write(", ")
+		}
+		fv, _ := record.Get(field.Label)
+		p.write("%s: ", Label(field.Label))
+		p.value(fv, field.Type)
+	}
+	p.write("}")
+}
+
+func (p *printer) payload(label string, payload any, t types.ValType) {
+	p.write("%s", label)
+	if t == nil {
+		return
+	}
+	p.write("(")
+	p.value(payload, t)
+	p.write(")")
+}
+
+func (p *printer) fields(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		p.fail("expected map[string]any, found %T", v)
+	}
+	return m, ok
+}
+
+// single returns the case of a variant like value, lifted labels may carry a '|' separated refinement
+func (p *printer) single(v any) (string, any, bool) {
+	m, ok := p.fields(v)
+	if !ok {
+		return "", nil, false
+	}
+	if len(m) != 1 {
+		p.fail("expected a single case, found %d", len(m))
+		return "", nil, false
+	}
+	for label, payload := range m {
+		label, _, _ = strings.Cut(label, "|")
+		return label, payload, true
+	}
+	return "", nil, false
+}
+
+// Label returns the wave text of a label, keywords are escaped with '%'
+func Label(label string) string {
+	if keywords[label] {
+		return "%" + label
+	}
+	return label
+}
+
+func escape(s string, quote rune) string {
+	var builder strings.Builder
+	for _, r := range s {
+		switch {
+		case r == quote || r == '\\':
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r == '\t':
+			builder.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&builder, `\u{%x}`, r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,169 @@
+package wave_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/abi/wave"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	type test struct {
+		name  string
+		text  string
+		t     types.ValType
+		value any
+	}
+	tests := []test{
+		{"true", "true", types.NewBool(), true},
+		{"false", "false", types.NewBool(), false},
+		{"s8", "-128", types.NewS8(), int8(-128)},
+		{"s16", "-300", types.NewS16(), int16(-300)},
+		{"s32", "-1", types.NewS32(), int32(-1)},
+		{"s64", "-9223372036854775808", types.NewS64(), int64(math.MinInt64)},
+		{"u8", "255", types.NewU8(), uint8(255)},
+		{"u16", "65535", types.NewU16(), uint16(65535)},
+		{"u32", "4294967295", types.NewU32(), uint32(math.MaxUint32)},
+		{"u64", "18446744073709551615", types.NewU64(), uint64(math.MaxUint64)},
+		{"f32", "1.5", types.NewF32(), float32(1.5)},
+		{"f64", "-0.1", types.NewF64(), float64(-0.1)},
+		{"f64 exponent", "1e+100", types.NewF64(), float64(1e100)},
+		{"inf", "inf", types.NewF64(), math.Inf(1)},
+		{"negative inf", "-inf", types.NewF32(), float32(math.Inf(-1))},
+		{"char", "'x'", types.NewChar(), 'x'},
+		{"char escape", `'\''`, types.NewChar(), '\''},
+		{"char unicode", "'☃'", types.NewChar(), '☃'},
+		{"string", `"hello"`, types.NewString(), "hello"},
+		{"string escapes", `"a\"b\\c\n\t\u{0}"`, types.NewString(), "a\"b\\c\n\t\x00"},
+		{"list", "[1, 2, 3]", types.NewList(types.NewU8()), []any{uint8(1), uint8(2), uint8(3)}},
+		{"empty list", "[]", types.NewList(types.NewU8()), []any(nil)},
+		{"fixed list", "[1, 2]", types.NewFixedList(types.NewU8(), 2), []any{uint8(1), uint8(2)}},
+		{"tuple", `(1, "a")`, types.NewTuple(types.NewU32(), types.NewString()), []any{uint32(1), "a"}},
+		{"record", `{name: "x", tags: [a, b]}`,
+			types.NewRecord(
+				types.Field{Label: "name", Type: types.NewString()},
+				types.Field{Label: "tags", Type: types.NewList(types.NewEnum("a", "b"))}),
+			types.RecordValue{{Label: "name", Value: "x"}, {Label: "tags", Value: []any{map[string]any{"a": nil}, map[string]any{"b": nil}}}}},
+		{"record option omitted", "{a: 1}",
+			types.NewRecord(
+				types.Field{Label: "a", Type: types.NewU8()},
+				types.Field{Label: "b", Type: types.NewOption(types.NewU8())}),
+			types.RecordValue{{Label: "a", Value: uint8(1)}, {Label: "b", Value: map[string]any{"none": nil}}}},
+		{"record empty", "{:}",
+			types.NewRecord(types.Field{Label: "a", Type: types.NewOption(types.NewU8())}),
+			types.RecordValue{{Label: "a", Value: map[string]any{"none": nil}}}},
+		{"enum", "green", types.NewEnum("red", "green"), map[string]any{"green": nil}},
+		{"enum keyword", "%none", types.NewEnum("none", "some"), map[string]any{"none": nil}},
+		{"variant", "v(7)", types.NewVariant(types.NewCase("v", types.NewU8()), types.NewCase("w", nil)), map[string]any{"v": uint8(7)}},
+		{"variant no payload", "w", types.NewVariant(types.NewCase("v", types.NewU8()), types.NewCase("w", nil)), map[string]any{"w": nil}},
+		{"some", "some(1)", types.NewOption(types.NewU8()), map[string]any{"some": uint8(1)}},
+		{"none", "none", types.NewOption(types.NewU8()), map[string]any{"none": nil}},
+		{"nested option", "some(none)", types.NewOption(types.NewOption(types.NewU8())), map[string]any{"some": map[string]any{"none": nil}}},
+		{"ok", `ok("x")`, types.NewResult(types.NewString(), nil), map[string]any{"ok": "x"}},
+		{"ok no payload", "ok", types.NewResult(nil, types.NewString()), map[string]any{"ok": nil}},
+		{"err", "err(1)", types.NewResult(nil, types.NewU8()), map[string]any{"error": uint8(1)}},
+		{"flags", "{read, write}", types.NewFlags("read", "write", "exec"), map[string]any{"read": true, "write": true, "exec": false}},
+		{"flags empty", "{}", types.NewFlags("read"), map[string]any{"read": false}},
+		{"flags keyword", "{%true}", types.NewFlags("true"), map[string]any{"true": true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := wave.Parse(test.text, test.t)
+			require.NoError(t, err)
+			require.Equal(t, test.value, v)
+
+			text, err := wave.String(test.value, test.t)
+			require.NoError(t, err)
+			require.Equal(t, test.text, text)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	type test struct {
+		name  string
+		text  string
+		t     types.ValType
+		value any
+	}
+	tests := []test{
+		{"whitespace and comments", " [ 1 , // one\n 2, ] ", types.NewList(types.NewU8()), []any{uint8(1), uint8(2)}},
+		{"field order", `{b: 2, a: 1}`,
+			types.NewRecord(
+				types.Field{Label: "a", Type: types.NewU8()},
+				types.Field{Label: "b", Type: types.NewU8()}),
+			types.RecordValue{{Label: "a", Value: uint8(1)}, {Label: "b", Value: uint8(2)}}},
+		{"escaped label", "%red", types.NewEnum("red"), map[string]any{"red": nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := wave.Parse(test.text, test.t)
+			require.NoError(t, err)
+			require.Equal(t, test.value, v)
+		})
+	}
+}
+
+func TestParseNaN(t *testing.T) {
+	v, err := wave.Parse("nan", types.NewF32())
+	require.NoError(t, err)
+	require.True(t, math.IsNaN(float64(v.(float32))))
+
+	text, err := wave.String(v, types.NewF32())
+	require.NoError(t, err)
+	require.Equal(t, "nan", text)
+}
+
+func TestParseFail(t *testing.T) {
+	type test struct {
+		name    string
+		text    string
+		t       types.ValType
+		message string
+	}
+	tests := []test{
+		{"overflow", "256", types.NewU8(), "1:1: invalid u8 256"},
+		{"negative unsigned", "-1", types.NewU32(), "1:1: invalid u32 -1"},
+		{"trailing", "1 2", types.NewU8(), "1:3: unexpected '2'"},
+		{"missing field", "{a: 1}",
+			types.NewRecord(
+				types.Field{Label: "a", Type: types.NewU8()},
+				types.Field{Label: "b", Type: types.NewU8()}),
+			"1:1: missing field 'b'"},
+		{"unknown field", "{c: 1}", types.NewRecord(types.Field{Label: "a", Type: types.NewU8()}), "1:2: unknown field 'c'"},
+		{"duplicate field", "{a: 1, a: 2}", types.NewRecord(types.Field{Label: "a", Type: types.NewU8()}), "1:8: duplicate field 'a'"},
+		{"unknown case", "blue", types.NewEnum("red"), "1:1: unknown case 'blue'"},
+		{"missing payload", "some", types.NewOption(types.NewU8()), "1:1: case 'some' requires a payload"},
+		{"unexpected payload", "none(1)", types.NewOption(types.NewU8()), "1:1: case 'none' has no payload"},
+		{"escaped keyword", "%some(1)", types.NewOption(types.NewU8()), "expected one of 'none', 'some'"},
+		{"tuple length", "(1)", types.NewTuple(types.NewU8(), types.NewU8()), "1:1: expected 2 tuple elements, found 1"},
+		{"unterminated string", `"abc`, types.NewString(), "1:1: unterminated literal"},
+		{"char length", "'ab'", types.NewChar(), "1:1: char literal must contain exactly one character"},
+		{"unknown flag", "{x}", types.NewFlags("read"), "1:2: unknown flag 'x'"},
+		{"fixed list length", "[1]", types.NewFixedList(types.NewU8(), 2), "1:1: expected 2 list elements, found 1"},
+		{"unclosed list", "[1, 2", types.NewList(types.NewU8()), "1:6: unexpected end of input"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := wave.Parse(test.text, test.t)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.message)
+		})
+	}
+}
+
+func TestPrintRefinedCase(t *testing.T) {
+	vt := types.NewVariant(types.NewCase("a", nil), types.NewCase("b", types.NewU8()))
+	text, err := wave.String(map[string]any{"b|a": uint8(1)}, vt)
+	require.NoError(t, err)
+	require.Equal(t, "b(1)", text)
+}
+
+func TestPrintFail(t *testing.T) {
+	_, err := wave.String("x", types.NewU8())
+	require.Error(t, err)
+	_, err = wave.String(map[string]any{"maybe": nil}, types.NewOption(types.NewU8()))
+	require.Error(t, err)
+}
@@ -0,0 +1,523 @@
+package api
+
+// the component model structures mirror the component binary format
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/Binary.md
+
+type ComponentSection interface {
+	componentSection()
+}
+
+// CustomSection is a named section with opaque data
+type CustomSection struct {
+	Name string
+	Data []byte
+}
+
+func (*CustomSection) componentSection() {}
+
+// RawSection is a component section that is preserved as bytes without being decoded
+type RawSection struct {
+	ID   uint8
+	Data []byte
+}
+
+func (*RawSection) componentSection() {}
+
+// CoreModuleSection is a core module embedded in the component
+type CoreModuleSection struct {
+	Module *Module
+}
+
+func (*CoreModuleSection) componentSection() {}
+
+type CoreInstanceSection struct {
+	Instances []CoreInstance
+}
+
+func (*CoreInstanceSection) componentSection() {}
+
+type TypeSection struct {
+	Types []DefType
+}
+
+func (*TypeSection) componentSection() {}
+
+type AliasSection struct {
+	Aliases []Alias
+}
+
+func (*AliasSection) componentSection() {}
+
+type ImportSection struct {
+	Imports []ComponentImport
+}
+
+func (*ImportSection) componentSection() {}
+
+type ExportSection struct {
+	Exports []ComponentExport
+}
+
+func (*ExportSection) componentSection() {}
+
+// NestedComponentSection is a component defined inside of another component
+type NestedComponentSection struct {
+	Component *Component
+}
+
+func (*NestedComponentSection) componentSection() {}
+
+type InstanceSection struct {
+	Instances []ComponentInstance
+}
+
+func (*InstanceSection) componentSection() {}
+
+type CanonSection struct {
+	Funcs []CanonicalFunction
+}
+
+func (*CanonSection) componentSection() {}
+
+type ComponentImport struct {
+	Name string
+	Desc ExternDesc
+}
+
+type ComponentExport struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+	// Desc is the optional type ascription of the export
+	Desc ExternDesc
+}
+
+// Sort is the kind of item an index refers to
+type Sort int
+
+const (
+	CoreFuncSort Sort = iota
+	CoreTableSort
+	CoreMemorySort
+	CoreGlobalSort
+	CoreTypeSort
+	CoreModuleSort
+	CoreInstanceSort
+	FuncSort
+	ValueSort
+	TypeSort
+	ComponentSort
+	InstanceSort
+)
+
+type Alias struct {
+	Sort   Sort
+	Target AliasTarget
+}
+
+type AliasTarget interface {
+	aliasTarget()
+}
+
+// ExportAlias aliases the export of a component instance
+type ExportAlias struct {
+	Instance uint32
+	Name     string
+}
+
+func (*ExportAlias) aliasTarget() {}
+
+// CoreExportAlias aliases the export of a core instance
+type CoreExportAlias struct {
+	Instance uint32
+	Name     string
+}
+
+func (*CoreExportAlias) aliasTarget() {}
+
+// OuterAlias aliases an item from an enclosing component or type. Count is the number of enclosing scopes to traverse.
+type OuterAlias struct {
+	Count uint32
+	Index uint32
+}
+
+func (*OuterAlias) aliasTarget() {}
+
+type ExternDesc interface {
+	externDesc()
+}
+
+type CoreModuleExternDesc struct {
+	Type uint32
+}
+
+func (*CoreModuleExternDesc) externDesc() {}
+
+type FuncExternDesc struct {
+	Type uint32
+}
+
+func (*FuncExternDesc) externDesc() {}
+
+type ValueExternDesc struct {
+	Type ComponentValType
+}
+
+func (*ValueExternDesc) externDesc() {}
+
+type TypeExternDesc struct {
+	Bound TypeBound
+}
+
+func (*TypeExternDesc) externDesc() {}
+
+type ComponentExternDesc struct {
+	Type uint32
+}
+
+func (*ComponentExternDesc) externDesc() {}
+
+type InstanceExternDesc struct {
+	Type uint32
+}
+
+func (*InstanceExternDesc) externDesc() {}
+
+type TypeBound interface {
+	typeBound()
+}
+
+// EqBound declares a type equal to the type at Type
+type EqBound struct {
+	Type uint32
+}
+
+func (*EqBound) typeBound() {}
+
+// SubResourceBound declares a fresh abstract resource type
+type SubResourceBound struct{}
+
+func (*SubResourceBound) typeBound() {}
+
+// DefType is a component level type definition
+type DefType interface {
+	defType()
+}
+
+// ComponentValType is either a PrimValType or a TypeIndexValType
+type ComponentValType interface {
+	componentValType()
+}
+
+type PrimValType int
+
+func (PrimValType) componentValType() {}
+func (PrimValType) defType()          {}
+
+const (
+	BoolType PrimValType = iota
+	S8Type
+	U8Type
+	S16Type
+	U16Type
+	S32Type
+	U32Type
+	S64Type
+	U64Type
+	Float32Type
+	Float64Type
+	CharType
+	StringType
+	ErrorContextType
+)
+
+// TypeIndexValType refers to a type defined in the type index space
+type TypeIndexValType uint32
+
+func (TypeIndexValType) componentValType() {}
+
+type LabelValType struct {
+	Label string
+	Type  ComponentValType
+}
+
+type RecordType struct {
+	Fields []LabelValType
+}
+
+func (*RecordType) defType() {}
+
+type VariantType struct {
+	Cases []VariantCase
+}
+
+func (*VariantType) defType() {}
+
+type VariantCase struct {
+	Label string
+	// Type is nil when the case has no payload
+	Type ComponentValType
+}
+
+type ListType struct {
+	Element ComponentValType
+}
+
+func (*ListType) defType() {}
+
+type TupleType struct {
+	Types []ComponentValType
+}
+
+func (*TupleType) defType() {}
+
+type FlagsType struct {
+	Labels []string
+}
+
+func (*FlagsType) defType() {}
+
+type EnumType struct {
+	Labels []string
+}
+
+func (*EnumType) defType() {}
+
+type OptionType struct {
+	Type ComponentValType
+}
+
+func (*OptionType) defType() {}
+
+// ResultValType is the component result type. Ok and Error are nil when absent.
+type ResultValType struct {
+	Ok    ComponentValType
+	Error ComponentValType
+}
+
+func (*ResultValType) defType() {}
+
+type OwnType struct {
+	Type uint32
+}
+
+func (*OwnType) defType() {}
+
+type BorrowType struct {
+	Type uint32
+}
+
+func (*BorrowType) defType() {}
+
+// StreamType is the stream type. Element is nil when absent.
+type StreamType struct {
+	Element ComponentValType
+}
+
+func (*StreamType) defType() {}
+
+// FutureType is the future type. Element is nil when absent.
+type FutureType struct {
+	Element ComponentValType
+}
+
+func (*FutureType) defType() {}
+
+type ComponentFuncType struct {
+	Params []LabelValType
+	// Result is the single unnamed result, nil when the function has no result or has named results
+	Result ComponentValType
+	// NamedResults are the named results of the function
+	NamedResults []LabelValType
+}
+
+func (*ComponentFuncType) defType() {}
+
+type ComponentType struct {
+	Declarations []Declaration
+}
+
+func (*ComponentType) defType() {}
+
+type InstanceType struct {
+	Declarations []Declaration
+}
+
+func (*InstanceType) defType() {}
+
+// ResourceType is a resource defined by the component. Dtor is the optional destructor function index.
+type ResourceType struct {
+	Rep  ValType
+	Dtor *uint32
+}
+
+func (*ResourceType) defType() {}
+
+// Declaration is an item in a component or instance type
+type Declaration interface {
+	declaration()
+}
+
+type TypeDeclaration struct {
+	Type DefType
+}
+
+func (*TypeDeclaration) declaration() {}
+
+type AliasDeclaration struct {
+	Alias Alias
+}
+
+func (*AliasDeclaration) declaration() {}
+
+// ImportDeclaration is only valid in component types
+type ImportDeclaration struct {
+	Name string
+	Desc ExternDesc
+}
+
+func (*ImportDeclaration) declaration() {}
+
+type ExportDeclaration struct {
+	Name string
+	Desc ExternDesc
+}
+
+func (*ExportDeclaration) declaration() {}
+
+// ComponentInstance is an entry in the instance section
+type ComponentInstance interface {
+	componentInstance()
+}
+
+// InstantiateInstance instantiates the component at Component with the given arguments
+type InstantiateInstance struct {
+	Component uint32
+	Args      []InstantiateArg
+}
+
+func (*InstantiateInstance) componentInstance() {}
+
+type InstantiateArg struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+}
+
+// ExportsInstance creates an instance from a list of existing items
+type ExportsInstance struct {
+	Exports []InlineExport
+}
+
+func (*ExportsInstance) componentInstance() {}
+
+type InlineExport struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+}
+
+// CoreInstance is an entry in the core instance section
+type CoreInstance interface {
+	coreInstance()
+}
+
+// CoreInstantiateInstance instantiates the core module at Module. Each argument supplies the imports of one module name.
+type CoreInstantiateInstance struct {
+	Module uint32
+	Args   []CoreInstantiateArg
+}
+
+func (*CoreInstantiateInstance) coreInstance() {}
+
+type CoreInstantiateArg struct {
+	Name     string
+	Instance uint32
+}
+
+// CoreExportsInstance creates a core instance from a list of existing core items
+type CoreExportsInstance struct {
+	Exports []CoreInlineExport
+}
+
+func (*CoreExportsInstance) coreInstance() {}
+
+// CoreInlineExport names a core item, Sort is one of the core sorts
+type CoreInlineExport struct {
+	Name  string
+	Sort  Sort
+	Index uint32
+}
+
+// CanonicalFunction is an entry in the canon section
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/Binary.md#canonical-definitions
+type CanonicalFunction interface {
+	canonicalFunction()
+}
+
+// CanonLift lifts the core function at CoreFunc to a component function of type Type
+type CanonLift struct {
+	CoreFunc uint32
+	Options  []CanonOption
+	Type     uint32
+}
+
+func (*CanonLift) canonicalFunction() {}
+
+// CanonLower lowers the component function at Func to a core function
+type CanonLower struct {
+	Func    uint32
+	Options []CanonOption
+}
+
+func (*CanonLower) canonicalFunction() {}
+
+type CanonResourceNew struct {
+	Resource uint32
+}
+
+func (*CanonResourceNew) canonicalFunction() {}
+
+type CanonResourceDrop struct {
+	Resource uint32
+}
+
+func (*CanonResourceDrop) canonicalFunction() {}
+
+type CanonResourceRep struct {
+	Resource uint32
+}
+
+func (*CanonResourceRep) canonicalFunction() {}
+
+type CanonOption interface {
+	canonOption()
+}
+
+type StringEncodingOption int
+
+func (StringEncodingOption) canonOption() {}
+
+const (
+	UTF8Encoding StringEncodingOption = iota
+	UTF16Encoding
+	Latin1UTF16Encoding
+)
+
+type MemoryOption struct {
+	Memory uint32
+}
+
+func (*MemoryOption) canonOption() {}
+
+type ReallocOption struct {
+	Func uint32
+}
+
+func (*ReallocOption) canonOption() {}
+
+type PostReturnOption struct {
+	Func uint32
+}
+
+func (*PostReturnOption) canonOption() {}
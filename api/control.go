@@ -47,7 +47,7 @@ type If struct {
 func (*If) instruction() {}
 
 type Else struct {
-	Instructions Instruction
+	Instructions []Instruction
 }
 
 type Branch struct {
@@ -0,0 +1,52 @@
+package api
+
+// the structures of the custom sections produced by toolchains
+// https://webassembly.github.io/spec/core/appendix/custom.html
+// https://github.com/WebAssembly/tool-conventions
+
+// NameSection holds the names of the custom section "name" by index, the maps are nil when the
+// section does not have the subsection for the names. Labels are indexed by the position of the
+// block, loop or if in the function.
+type NameSection struct {
+	Module  string
+	Funcs   map[FuncIndex]string
+	Locals  map[FuncIndex]map[LocalIndex]string
+	Labels  map[FuncIndex]map[uint32]string
+	Types   map[TypeIndex]string
+	Tables  map[TableIndex]string
+	Mems    map[MemoryIndex]string
+	Globals map[GlobalIndex]string
+	Elems   map[ElementIndex]string
+	Datas   map[DataIndex]string
+}
+
+// Func returns the name of the function at index or an empty string when it has no name
+func (n *NameSection) Func(index FuncIndex) string {
+	if n == nil {
+		return ""
+	}
+	return n.Funcs[index]
+}
+
+// Producers holds the custom section "producers", the fields are language, processed-by and sdk
+type Producers struct {
+	Fields []ProducersField
+}
+
+type ProducersField struct {
+	Name   string
+	Values []ProducerValue
+}
+
+type ProducerValue struct {
+	Name    string
+	Version string
+}
+
+// TargetFeature is an entry of the custom section "target_features". Prefix is '+' when the module
+// uses the feature, '-' when the module must not be linked with modules that use it and '=' when
+// every linked module must use it.
+type TargetFeature struct {
+	Prefix byte
+	Name   string
+}
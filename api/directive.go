@@ -1,5 +1,7 @@
 package api
 
+import "sync"
+
 type Directive interface {
 	directive()
 }
@@ -30,11 +32,17 @@ type Module struct {
 	Start   Start
 	Imports []Import
 	Exports []Export
+	// Customs are the custom sections of the module in the order they appear
+	Customs []*CustomSection
+	// Names are the names of the custom section "name" or nil when the module does not have a valid one
+	Names *NameSection
 }
 
 func (*Module) directive() {}
 
-type Component struct{}
+type Component struct {
+	Sections []ComponentSection
+}
 
 func (*Component) directive() {}
 
@@ -43,16 +51,86 @@ type FuncType struct {
 	Returns    ResultType
 }
 
+// Func is a function defined by a module. A decoder may defer setting Locals and Body until Load is called,
+// binary.LazyCode does. Code that reads Locals or Body of a module it did not build calls Load first, it
+// returns nil without doing anything for functions that were built directly or decoded eagerly.
 type Func struct {
-	Type   TypeIndex
+	Type TypeIndex
+	// Locals and Body are nil until Load returns for a function with a loader
 	Locals []ValType
 	Body   *Expression
+	// Offsets holds the position of each instruction of the body in the binary module, the instructions
+	// of blocks follow the block in the order they appear in the code. It is nil when the function was
+	// not decoded with offsets.
+	Offsets []int
+	loader  *loader
+}
+
+type loader struct {
+	once sync.Once
+	load func(*Func) error
+	err  error
+}
+
+// SetLoader defers setting Locals and Body to the first call of Load
+func (f *Func) SetLoader(load func(*Func) error) {
+	f.loader = &loader{load: load}
+}
+
+// Load sets Locals and Body of a function with a loader and returns the error of the loader.
+// The loader runs once, concurrent calls wait for it to finish. Functions without a loader are loaded.
+func (f *Func) Load() error {
+	if f.loader == nil {
+		return nil
+	}
+	f.loader.once.Do(func() {
+		f.loader.err = f.loader.load(f)
+	})
+	return f.loader.err
 }
 
 type Mem struct {
+	Limits Limits
+	// Shared memories can be accessed by several threads, they require a maximum
+	Shared bool
+}
+
+// Import is resolved against the external values supplied at instantiation.
+// Imported items precede the items defined by the module in their index space.
+type Import struct {
+	Module      string
+	Name        string
+	Description ImportDescription
+}
+
+type ImportDescription interface {
+	importDescription()
+}
+
+type FuncImportDescription struct {
+	TypeIdx TypeIndex
+}
+
+func (*FuncImportDescription) importDescription() {}
+
+type MemImportDescription struct {
+	Mem Mem
 }
 
-type Import struct{}
+func (*MemImportDescription) importDescription() {}
+
+type GlobalImportDescription struct {
+	Global Global
+}
+
+func (*GlobalImportDescription) importDescription() {}
+
+type TableImportDescription struct {
+	Table Table
+}
+
+func (*TableImportDescription) importDescription() {}
+
 type Export struct {
 	Name        string
 	Description ExportDescription
@@ -66,6 +144,31 @@ type FuncExportDescription struct {
 
 func (*FuncExportDescription) exportDescription() {}
 
+type MemExportDescription struct {
+	MemIdx MemoryIndex
+}
+
+func (*MemExportDescription) exportDescription() {}
+
+type GlobalExportDescription struct {
+	GlobalIdx GlobalIndex
+}
+
+func (*GlobalExportDescription) exportDescription() {}
+
+type TableExportDescription struct {
+	TableIdx TableIndex
+}
+
+func (*TableExportDescription) exportDescription() {}
+
 type Start struct{}
 type Data struct{}
-type Elem struct{}
+
+// Elem is an active element segment. Instantiation writes references to the functions in Init
+// into Table starting at the offset computed by the constant expression Offset.
+type Elem struct {
+	Table  TableIndex
+	Offset *Expression
+	Init   []FuncIndex
+}
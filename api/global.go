@@ -10,6 +10,8 @@ const (
 type Global struct {
 	Mutable Mutable
 	Value   ValType
+	// Init is the constant expression evaluated at instantiation
+	Init *Expression
 }
 
 // external implements External interface
@@ -1,6 +1,8 @@
 package api
 
+import "github.com/patrickhuber/go-types"
+
 type Limits struct {
-	Min I32
-	Max I32
+	Min uint32
+	Max types.Option[uint32]
 }
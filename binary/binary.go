@@ -8,13 +8,42 @@ const ComponentVersion uint16 = 0x0a
 type SectionID uint8
 
 const (
-	CustomSectionID   SectionID = 0
-	TypeSectionID     SectionID = 1
-	FunctionSectionID SectionID = 3
-	ExportSectionID   SectionID = 7
-	CodeSectionID     SectionID = 10
+	CustomSectionID    SectionID = 0
+	TypeSectionID      SectionID = 1
+	ImportSectionID    SectionID = 2
+	FunctionSectionID  SectionID = 3
+	TableSectionID     SectionID = 4
+	MemorySectionID    SectionID = 5
+	GlobalSectionID    SectionID = 6
+	ExportSectionID    SectionID = 7
+	StartSectionID     SectionID = 8
+	ElementSectionID   SectionID = 9
+	CodeSectionID      SectionID = 10
+	DataSectionID      SectionID = 11
+	DataCountSectionID SectionID = 12
+	TagSectionID       SectionID = 13
 )
 
+// component section ids
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/Binary.md#component-definitions
+const (
+	ComponentCustomSectionID       SectionID = 0
+	ComponentCoreModuleSectionID   SectionID = 1
+	ComponentCoreInstanceSectionID SectionID = 2
+	ComponentCoreTypeSectionID     SectionID = 3
+	ComponentComponentSectionID    SectionID = 4
+	ComponentInstanceSectionID     SectionID = 5
+	ComponentAliasSectionID        SectionID = 6
+	ComponentTypeSectionID         SectionID = 7
+	ComponentCanonSectionID        SectionID = 8
+	ComponentStartSectionID        SectionID = 9
+	ComponentImportSectionID       SectionID = 10
+	ComponentExportSectionID       SectionID = 11
+	ComponentValueSectionID        SectionID = 12
+)
+
+const ComponentLayer uint16 = 0x01
+
 type Section struct {
 	ID   SectionID
 	Data []byte
@@ -26,6 +55,13 @@ const I32 ValType = 0x7f
 const I64 ValType = 0x7e
 const F32 ValType = 0x7d
 const F64 ValType = 0x7c
+const V128 ValType = 0x7b
+
+// reference type encodings
+const (
+	FuncRefType   byte = 0x70
+	ExternRefType byte = 0x6f
+)
 
 type ExportKind byte
 
@@ -33,3 +69,12 @@ const FuncExportKind ExportKind = 0x00
 const TableExportKind ExportKind = 0x01
 const MemoryExportKind ExportKind = 0x02
 const GlobalExportKind ExportKind = 0x03
+
+// limits encodings
+const (
+	LimitsMinCode    byte = 0x00
+	LimitsMinMaxCode byte = 0x01
+	// the threads proposal marks shared memories and the memory64 proposal marks memories indexed by i64
+	LimitsSharedFlag   byte = 0x02
+	LimitsMemory64Flag byte = 0x04
+)
@@ -0,0 +1,133 @@
+package binary
+
+import "github.com/patrickhuber/go-wasm/api"
+
+// component type encodings
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/Binary.md#type-definitions
+const (
+	RecordTypeCode    byte = 0x72
+	VariantTypeCode   byte = 0x71
+	ListTypeCode      byte = 0x70
+	TupleTypeCode     byte = 0x6f
+	FlagsTypeCode     byte = 0x6e
+	EnumTypeCode      byte = 0x6d
+	OptionTypeCode    byte = 0x6b
+	ResultTypeCode    byte = 0x6a
+	OwnTypeCode       byte = 0x69
+	BorrowTypeCode    byte = 0x68
+	StreamTypeCode    byte = 0x66
+	FutureTypeCode    byte = 0x65
+	FuncTypeCode      byte = 0x40
+	ComponentTypeCode byte = 0x41
+	InstanceTypeCode  byte = 0x42
+	ResourceTypeCode  byte = 0x3f
+)
+
+var primValTypeCodes = map[api.PrimValType]byte{
+	api.BoolType:         0x7f,
+	api.S8Type:           0x7e,
+	api.U8Type:           0x7d,
+	api.S16Type:          0x7c,
+	api.U16Type:          0x7b,
+	api.S32Type:          0x7a,
+	api.U32Type:          0x79,
+	api.S64Type:          0x78,
+	api.U64Type:          0x77,
+	api.Float32Type:      0x76,
+	api.Float64Type:      0x75,
+	api.CharType:         0x74,
+	api.StringType:       0x73,
+	api.ErrorContextType: 0x64,
+}
+
+var primValTypes = invert(primValTypeCodes)
+
+// sorts are encoded as a single byte, core sorts are prefixed with 0x00
+var sortCodes = map[api.Sort]byte{
+	api.FuncSort:      0x01,
+	api.ValueSort:     0x02,
+	api.TypeSort:      0x03,
+	api.ComponentSort: 0x04,
+	api.InstanceSort:  0x05,
+}
+
+var sorts = invert(sortCodes)
+
+var coreSortCodes = map[api.Sort]byte{
+	api.CoreFuncSort:     0x00,
+	api.CoreTableSort:    0x01,
+	api.CoreMemorySort:   0x02,
+	api.CoreGlobalSort:   0x03,
+	api.CoreTypeSort:     0x10,
+	api.CoreModuleSort:   0x11,
+	api.CoreInstanceSort: 0x12,
+}
+
+var coreSorts = invert(coreSortCodes)
+
+// declaration codes for component and instance types
+const (
+	CoreTypeDeclarationCode byte = 0x00
+	TypeDeclarationCode     byte = 0x01
+	AliasDeclarationCode    byte = 0x02
+	ImportDeclarationCode   byte = 0x03
+	ExportDeclarationCode   byte = 0x04
+)
+
+// extern desc codes
+const (
+	CoreModuleExternDescCode byte = 0x00
+	FuncExternDescCode       byte = 0x01
+	ValueExternDescCode      byte = 0x02
+	TypeExternDescCode       byte = 0x03
+	ComponentExternDescCode  byte = 0x04
+	InstanceExternDescCode   byte = 0x05
+)
+
+// alias target codes
+const (
+	ExportAliasCode     byte = 0x00
+	CoreExportAliasCode byte = 0x01
+	OuterAliasCode      byte = 0x02
+)
+
+// instance codes
+const (
+	InstantiateInstanceCode byte = 0x00
+	ExportsInstanceCode     byte = 0x01
+)
+
+// canonical function codes
+const (
+	CanonLiftCode         byte = 0x00
+	CanonLowerCode        byte = 0x01
+	CanonResourceNewCode  byte = 0x02
+	CanonResourceDropCode byte = 0x03
+	CanonResourceRepCode  byte = 0x04
+)
+
+// canonical option codes
+const (
+	UTF8OptionCode        byte = 0x00
+	UTF16OptionCode       byte = 0x01
+	Latin1UTF16OptionCode byte = 0x02
+	MemoryOptionCode      byte = 0x03
+	ReallocOptionCode     byte = 0x04
+	PostReturnOptionCode  byte = 0x05
+)
+
+var stringEncodingCodes = map[api.StringEncodingOption]byte{
+	api.UTF8Encoding:        UTF8OptionCode,
+	api.UTF16Encoding:       UTF16OptionCode,
+	api.Latin1UTF16Encoding: Latin1UTF16OptionCode,
+}
+
+var stringEncodings = invert(stringEncodingCodes)
+
+func invert[K comparable, V comparable](m map[K]V) map[V]K {
+	inverted := map[V]K{}
+	for k, v := range m {
+		inverted[v] = k
+	}
+	return inverted
+}
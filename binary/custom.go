@@ -0,0 +1,278 @@
+package binary
+
+import (
+	"io"
+	"slices"
+
+	"github.com/patrickhuber/go-wasm/api"
+)
+
+// the custom sections produced by toolchains
+// https://webassembly.github.io/spec/core/appendix/custom.html
+// https://github.com/WebAssembly/tool-conventions
+const (
+	NameCustomSection           = "name"
+	ProducersCustomSection      = "producers"
+	TargetFeaturesCustomSection = "target_features"
+)
+
+// the subsections of the name section, the subsections after the function names are from the extended name section proposal
+const (
+	ModuleNameSubsection byte = iota
+	FuncNameSubsection
+	LocalNameSubsection
+	LabelNameSubsection
+	TypeNameSubsection
+	TableNameSubsection
+	MemoryNameSubsection
+	GlobalNameSubsection
+	ElemNameSubsection
+	DataNameSubsection
+)
+
+// DecodeNameSection decodes the data of the custom section "name", the offsets of errors are relative to data.
+// Subsections must appear in order, subsections this package does not know are skipped.
+func DecodeNameSection(data []byte) (*api.NameSection, error) {
+	d := &decoder{data: data, end: len(data)}
+	names := &api.NameSection{}
+	last := -1
+	for d.pos < len(data) {
+		offset := d.pos
+		id, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if int(id) <= last {
+			return nil, d.malformed(offset, "out of order name subsection")
+		}
+		last = int(id)
+		size, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		d.end = d.pos + size
+		switch id {
+		case ModuleNameSubsection:
+			names.Module, err = d.name()
+		case FuncNameSubsection:
+			names.Funcs, err = nameMap[api.FuncIndex](d)
+		case LocalNameSubsection:
+			names.Locals, err = indirectNameMap[api.FuncIndex, api.LocalIndex](d)
+		case LabelNameSubsection:
+			names.Labels, err = indirectNameMap[api.FuncIndex, uint32](d)
+		case TypeNameSubsection:
+			names.Types, err = nameMap[api.TypeIndex](d)
+		case TableNameSubsection:
+			names.Tables, err = nameMap[api.TableIndex](d)
+		case MemoryNameSubsection:
+			names.Mems, err = nameMap[api.MemoryIndex](d)
+		case GlobalNameSubsection:
+			names.Globals, err = nameMap[api.GlobalIndex](d)
+		case ElemNameSubsection:
+			names.Elems, err = nameMap[api.ElementIndex](d)
+		case DataNameSubsection:
+			names.Datas, err = nameMap[api.DataIndex](d)
+		default:
+			d.pos = d.end
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d.pos != d.end {
+			return nil, d.malformed(d.pos, "name subsection size mismatch")
+		}
+		d.end = len(data)
+	}
+	return names, nil
+}
+
+// nameMap reads a vector of indices and names, the indices must be in increasing order
+func nameMap[K ~uint32](d *decoder) (map[K]string, error) {
+	names := map[K]string{}
+	err := indices(d, func(index uint32) error {
+		name, err := d.name()
+		names[K(index)] = name
+		return err
+	})
+	return names, err
+}
+
+// indirectNameMap reads a vector of indices and name maps, the indices must be in increasing order
+func indirectNameMap[K, V ~uint32](d *decoder) (map[K]map[V]string, error) {
+	names := map[K]map[V]string{}
+	err := indices(d, func(index uint32) error {
+		inner, err := nameMap[V](d)
+		names[K(index)] = inner
+		return err
+	})
+	return names, err
+}
+
+// indices reads a vector of increasing indices, each followed by the item read by read
+func indices(d *decoder, read func(uint32) error) error {
+	n, _, err := d.count()
+	if err != nil {
+		return err
+	}
+	var previous uint32
+	for i := uint32(0); i < n; i++ {
+		offset := d.pos
+		index, err := d.u32()
+		if err != nil {
+			return err
+		}
+		if i > 0 && index <= previous {
+			return d.malformed(offset, "out of order name index")
+		}
+		previous = index
+		if err := read(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeProducersSection decodes the data of the custom section "producers"
+func DecodeProducersSection(data []byte) (*api.Producers, error) {
+	d := &decoder{data: data, end: len(data)}
+	fields, err := decodeSlice(d, func(d *decoder) (api.ProducersField, error) {
+		var field api.ProducersField
+		var err error
+		if field.Name, err = d.name(); err != nil {
+			return field, err
+		}
+		field.Values, err = decodeSlice(d, func(d *decoder) (api.ProducerValue, error) {
+			var value api.ProducerValue
+			var err error
+			if value.Name, err = d.name(); err != nil {
+				return value, err
+			}
+			value.Version, err = d.name()
+			return value, err
+		})
+		return field, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != d.end {
+		return nil, d.malformed(d.pos, "section size mismatch")
+	}
+	return &api.Producers{Fields: fields}, nil
+}
+
+// DecodeTargetFeaturesSection decodes the data of the custom section "target_features"
+func DecodeTargetFeaturesSection(data []byte) ([]api.TargetFeature, error) {
+	d := &decoder{data: data, end: len(data)}
+	features, err := decodeSlice(d, func(d *decoder) (api.TargetFeature, error) {
+		var feature api.TargetFeature
+		offset := d.pos
+		prefix, err := d.byte()
+		if err != nil {
+			return feature, err
+		}
+		if prefix != '+' && prefix != '-' && prefix != '=' {
+			return feature, d.malformed(offset, "malformed target feature prefix")
+		}
+		feature.Prefix = prefix
+		feature.Name, err = d.name()
+		return feature, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != d.end {
+		return nil, d.malformed(d.pos, "section size mismatch")
+	}
+	return features, nil
+}
+
+// names sets the names of a module when the custom section is a valid name section. Errors in custom
+// sections do not make a module malformed so an invalid name section is only kept as a custom section.
+func names(module *api.Module, custom *api.CustomSection) {
+	if custom.Name != NameCustomSection {
+		return
+	}
+	if names, err := DecodeNameSection(custom.Data); err == nil {
+		module.Names = names
+	}
+}
+
+// WriteNameSection writes the data of the custom section "name", the subsections of nil maps are omitted
+func WriteNameSection(writer io.Writer, names *api.NameSection) error {
+	if names.Module != "" {
+		err := WriteSection(writer, SectionID(ModuleNameSubsection), func(w io.Writer) error {
+			return WriteString(w, names.Module)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	subsections := []struct {
+		id    byte
+		write func(io.Writer) error
+	}{
+		{FuncNameSubsection, nameMapWriter(names.Funcs)},
+		{LocalNameSubsection, indirectNameMapWriter(names.Locals)},
+		{LabelNameSubsection, indirectNameMapWriter(names.Labels)},
+		{TypeNameSubsection, nameMapWriter(names.Types)},
+		{TableNameSubsection, nameMapWriter(names.Tables)},
+		{MemoryNameSubsection, nameMapWriter(names.Mems)},
+		{GlobalNameSubsection, nameMapWriter(names.Globals)},
+		{ElemNameSubsection, nameMapWriter(names.Elems)},
+		{DataNameSubsection, nameMapWriter(names.Datas)},
+	}
+	for _, subsection := range subsections {
+		if subsection.write == nil {
+			continue
+		}
+		// subsections are encoded like sections
+		if err := WriteSection(writer, SectionID(subsection.id), subsection.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nameMapWriter returns a function that writes the names or nil when names is nil
+func nameMapWriter[K ~uint32](names map[K]string) func(io.Writer) error {
+	if names == nil {
+		return nil
+	}
+	return func(w io.Writer) error {
+		return writeNameMap(w, names)
+	}
+}
+
+func indirectNameMapWriter[K, V ~uint32](names map[K]map[V]string) func(io.Writer) error {
+	if names == nil {
+		return nil
+	}
+	return func(w io.Writer) error {
+		return writeVector(w, sortedKeys(names), func(w io.Writer, index K) error {
+			if err := WriteLebU128(w, uint32(index)); err != nil {
+				return err
+			}
+			return writeNameMap(w, names[index])
+		})
+	}
+}
+
+// writeNameMap writes the names in the order of their indices
+func writeNameMap[K ~uint32](w io.Writer, names map[K]string) error {
+	return writeVector(w, sortedKeys(names), func(w io.Writer, index K) error {
+		if err := WriteLebU128(w, uint32(index)); err != nil {
+			return err
+		}
+		return WriteString(w, names[index])
+	})
+}
+
+func sortedKeys[K ~uint32, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package binary_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameSectionRoundTrip(t *testing.T) {
+	names := &api.NameSection{
+		Module:  "example",
+		Funcs:   map[api.FuncIndex]string{0: "add", 2: "main"},
+		Locals:  map[api.FuncIndex]map[api.LocalIndex]string{0: {0: "x", 1: "y"}, 2: {}},
+		Labels:  map[api.FuncIndex]map[uint32]string{2: {0: "done", 1: "next"}},
+		Types:   map[api.TypeIndex]string{0: "binary"},
+		Tables:  map[api.TableIndex]string{0: "table"},
+		Mems:    map[api.MemoryIndex]string{0: "memory"},
+		Globals: map[api.GlobalIndex]string{1: "counter"},
+		Elems:   map[api.ElementIndex]string{0: "elems"},
+		Datas:   map[api.DataIndex]string{0: "data"},
+	}
+	var data bytes.Buffer
+	require.NoError(t, binary.WriteNameSection(&data, names))
+	decoded, err := binary.DecodeNameSection(data.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, names, decoded)
+
+	// the names of a module are written as a custom section and set by both readers
+	var buf bytes.Buffer
+	err = binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: &api.Module{Names: names},
+	})
+	require.NoError(t, err)
+	document, err := binary.Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	read := document.Directive.(*api.Module)
+	require.Equal(t, names, read.Names)
+	require.Equal(t, []*api.CustomSection{{Name: "name", Data: data.Bytes()}}, read.Customs)
+
+	module, _, err := binary.DecodeModule(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, names, module.Names)
+}
+
+func TestDecodeNameSectionFail(t *testing.T) {
+	type test struct {
+		name    string
+		data    []byte
+		message string
+	}
+	tests := []test{
+		{"order", []byte{0x01, 0x01, 0x00, 0x00, 0x01, 0x00}, "malformed module at offset 0x3: out of order name subsection"},
+		{"index", []byte{0x01, 0x07, 0x02, 0x01, 0x01, 'a', 0x00, 0x01, 'b'}, "malformed module at offset 0x6: out of order name index"},
+		{"size", []byte{0x00, 0x03, 0x01, 'a', 0x00}, "malformed module at offset 0x4: name subsection size mismatch"},
+		{"end", []byte{0x00, 0x02, 0x05, 'a'}, "malformed module at offset 0x2: length out of bounds"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := binary.DecodeNameSection(test.data)
+			require.EqualError(t, err, test.message)
+		})
+	}
+}
+
+func TestDecodeInvalidNameSection(t *testing.T) {
+	// errors in custom sections do not make a module malformed
+	data := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x00, 0x07, 0x04, 'n', 'a', 'm', 'e', 0x01, 0x05}
+	module, _, err := binary.DecodeModule(data)
+	require.NoError(t, err)
+	require.Nil(t, module.Names)
+	require.Equal(t, []*api.CustomSection{{Name: "name", Data: []byte{0x01, 0x05}}}, module.Customs)
+}
+
+func TestDecodeProducersSection(t *testing.T) {
+	data := []byte{
+		0x02,
+		0x08, 'l', 'a', 'n', 'g', 'u', 'a', 'g', 'e', 0x01, 0x04, 'R', 'u', 's', 't', 0x00,
+		0x0c, 'p', 'r', 'o', 'c', 'e', 's', 's', 'e', 'd', '-', 'b', 'y', 0x01, 0x05, 'r', 'u', 's', 't', 'c', 0x04, '1', '.', '7', '0',
+	}
+	producers, err := binary.DecodeProducersSection(data)
+	require.NoError(t, err)
+	require.Equal(t, &api.Producers{Fields: []api.ProducersField{
+		{Name: "language", Values: []api.ProducerValue{{Name: "Rust"}}},
+		{Name: "processed-by", Values: []api.ProducerValue{{Name: "rustc", Version: "1.70"}}},
+	}}, producers)
+
+	_, err = binary.DecodeProducersSection(append(data, 0x00))
+	require.EqualError(t, err, "malformed module at offset 0x2a: section size mismatch")
+}
+
+func TestDecodeTargetFeaturesSection(t *testing.T) {
+	data := []byte{0x02, '+', 0x04, 's', 'i', 'm', 'd', '-', 0x07, 'a', 't', 'o', 'm', 'i', 'c', 's'}
+	features, err := binary.DecodeTargetFeaturesSection(data)
+	require.NoError(t, err)
+	require.Equal(t, []api.TargetFeature{{Prefix: '+', Name: "simd"}, {Prefix: '-', Name: "atomics"}}, features)
+
+	_, err = binary.DecodeTargetFeaturesSection([]byte{0x01, '*', 0x00})
+	require.EqualError(t, err, "malformed module at offset 0x1: malformed target feature prefix")
+}
@@ -0,0 +1,942 @@
+package binary
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/leb128"
+	"github.com/patrickhuber/go-wasm/opcode"
+)
+
+// MalformedError reports input that does not follow the binary format. Message is the message
+// the spec tests expect from assert_malformed and Offset is the position of the malformed item.
+type MalformedError struct {
+	Offset  int
+	Message string
+	// Err is the error of the LEB128 decoder for malformed integers
+	Err error
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("malformed module at offset 0x%x: %s", e.Offset, e.Message)
+}
+
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidError reports a well formed module that refers to items that do not exist.
+// Message is the message the spec tests expect from assert_invalid.
+type InvalidError struct {
+	Offset  int
+	Message string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid module at offset 0x%x: %s", e.Offset, e.Message)
+}
+
+// UnsupportedError reports a module that uses an enabled proposal, or the part of a proposal, that the
+// decoder does not implement. Proposals that are not enabled fail with a MalformedError instead. Valid
+// instructions the decoder does not implement also fail with an UnsupportedError.
+type UnsupportedError struct {
+	Offset  int
+	Message string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported module at offset 0x%x: %s", e.Offset, e.Message)
+}
+
+// SectionOffset is the location of a section. Offset is the position of the section id,
+// the contents of the section are data[Start:End].
+type SectionOffset struct {
+	ID     SectionID
+	Offset int
+	Start  int
+	End    int
+}
+
+// BodyOffset is the location of a function body. The locals and instructions of the body are
+// data[Start:End] and Instructions holds the position of each instruction of the function body.
+type BodyOffset struct {
+	Start        int
+	End          int
+	Instructions []int
+}
+
+// Offsets are the positions of the items of a decoded module, relative to the start of the input
+type Offsets struct {
+	Sections []SectionOffset
+	// Bodies holds the body of each function defined by the module
+	Bodies []BodyOffset
+}
+
+// MaxLocals is the largest number of locals of a function. The format allows up to 2^32-1 locals,
+// functions are limited further because each local is expanded in api.Func.
+const MaxLocals = 50000
+
+// sectionOrder is the position of each non custom section in a module, sections must appear in increasing order
+var sectionOrder = map[SectionID]int{
+	TypeSectionID:      1,
+	ImportSectionID:    2,
+	FunctionSectionID:  3,
+	TableSectionID:     4,
+	MemorySectionID:    5,
+	TagSectionID:       6,
+	GlobalSectionID:    7,
+	ExportSectionID:    8,
+	StartSectionID:     9,
+	ElementSectionID:   10,
+	DataCountSectionID: 11,
+	CodeSectionID:      12,
+	DataSectionID:      13,
+}
+
+// CodeDecoding selects when and how function bodies are decoded
+type CodeDecoding int
+
+const (
+	// EagerCode decodes function bodies in order before DecodeModule returns
+	EagerCode CodeDecoding = iota
+	// ParallelCode decodes function bodies from several goroutines before DecodeModule returns
+	ParallelCode
+	// LazyCode decodes a function body on the first call of api.Func.Load, Locals and Body of the
+	// function are nil until then. The Instructions of a BodyOffset are set when its body is loaded
+	// and errors in a body are returned by Load.
+	LazyCode
+)
+
+// DecodeOptions controls the decoding of the code section and the proposals a module may use
+type DecodeOptions struct {
+	Code CodeDecoding
+	// Parallelism is the number of goroutines used by ParallelCode, GOMAXPROCS when zero
+	Parallelism int
+	// Features enables proposals, the use of a proposal that is not enabled is malformed
+	Features config.Features
+}
+
+// DecodeModule decodes a binary module, including its preamble, from data. Unlike ReadModule it checks that
+// sections appear in order and that each section and function body consumes exactly its declared size.
+// Custom section data refers to data instead of being copied, a valid name section also sets the Names of
+// the module. Sections that have no representation in api.Module are checked for their size and skipped.
+func DecodeModule(data []byte) (*api.Module, *Offsets, error) {
+	return DecodeModuleOptions(data, DecodeOptions{})
+}
+
+// DecodeModuleOptions decodes a binary module like DecodeModule with the function bodies decoded as set by options.
+// The indices used by instructions are validated when a body is decoded. For LazyCode, data must not be modified
+// until every function has been loaded.
+func DecodeModuleOptions(data []byte, options DecodeOptions) (*api.Module, *Offsets, error) {
+	d := &decoder{data: data, end: len(data), options: options}
+	if err := d.preamble(); err != nil {
+		return nil, nil, err
+	}
+	module := &api.Module{}
+	offsets := &Offsets{}
+	last := 0
+	code := false
+	for d.pos < len(data) {
+		offset := d.pos
+		id, err := d.byte()
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := d.length()
+		if err != nil {
+			return nil, nil, err
+		}
+		section := SectionOffset{ID: SectionID(id), Offset: offset, Start: d.pos, End: d.pos + size}
+		if section.ID != CustomSectionID {
+			order, ok := sectionOrder[section.ID]
+			if !ok {
+				return nil, nil, d.malformed(offset, "malformed section id")
+			}
+			if order <= last {
+				return nil, nil, d.malformed(offset, "unexpected content after last section")
+			}
+			last = order
+		}
+		if section.ID == TagSectionID {
+			return nil, nil, d.unsupported(offset, d.options.Features.ExceptionHandling, "exceptions", "tags are")
+		}
+		d.end = section.End
+		if err := d.section(module, offsets, section); err != nil {
+			return nil, nil, err
+		}
+		if d.pos != d.end {
+			return nil, nil, d.malformed(d.pos, "section size mismatch")
+		}
+		d.end = len(data)
+		code = code || section.ID == CodeSectionID
+		offsets.Sections = append(offsets.Sections, section)
+	}
+	if !code && len(module.Funcs) > 0 {
+		return nil, nil, d.malformed(d.pos, "function and code section have inconsistent lengths")
+	}
+	return module, offsets, nil
+}
+
+// decoder reads the binary format from data. Reads past end fail, end is the end of the section
+// or function body being decoded.
+type decoder struct {
+	data    []byte
+	pos     int
+	end     int
+	options DecodeOptions
+}
+
+func (d *decoder) malformed(offset int, message string) error {
+	return &MalformedError{Offset: offset, Message: message}
+}
+
+func (d *decoder) invalid(offset int, message string) error {
+	return &InvalidError{Offset: offset, Message: message}
+}
+
+// feature reports the use of a proposal at offset when it is not enabled
+func (d *decoder) feature(offset int, enabled bool, proposal string) error {
+	if enabled {
+		return nil
+	}
+	return d.malformed(offset, proposal+" support is not enabled")
+}
+
+// unsupported reports the use of a part of a proposal the decoder does not implement, what names the part.
+// The error is the error of feature when the proposal is not enabled.
+func (d *decoder) unsupported(offset int, enabled bool, proposal string, what string) error {
+	if err := d.feature(offset, enabled, proposal); err != nil {
+		return err
+	}
+	return &UnsupportedError{Offset: offset, Message: what + " not supported"}
+}
+
+// unexpectedEnd reports a read past the end of the input or past the end of the current section or function
+func (d *decoder) unexpectedEnd() error {
+	if d.end < len(d.data) {
+		return d.malformed(d.end, "unexpected end of section or function")
+	}
+	return d.malformed(d.end, "unexpected end")
+}
+
+func (d *decoder) preamble() error {
+	if len(d.data) < len(Magic) || string(d.data[:len(Magic)]) != string(Magic) {
+		return d.malformed(0, "magic header not detected")
+	}
+	if len(d.data) < 8 {
+		return d.malformed(len(d.data), "unexpected end")
+	}
+	version := binary.LittleEndian.Uint16(d.data[4:])
+	layer := binary.LittleEndian.Uint16(d.data[6:])
+	if version != ModuleVersion || layer != 0 {
+		return d.malformed(4, "unknown binary version")
+	}
+	d.pos = 8
+	return nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= d.end {
+		return 0, d.unexpectedEnd()
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) u32() (uint32, error) {
+	value, n, err := leb128.DecodeUnsignedSlice(d.data[d.pos:d.end], 32)
+	if err != nil {
+		return 0, d.integer(err)
+	}
+	d.pos += n
+	return uint32(value), nil
+}
+
+func (d *decoder) s32() (int32, error) {
+	value, n, err := leb128.DecodeSignedSlice(d.data[d.pos:d.end], 32)
+	if err != nil {
+		return 0, d.integer(err)
+	}
+	d.pos += n
+	return int32(value), nil
+}
+
+func (d *decoder) integer(err error) error {
+	if errors.Is(err, leb128.ErrUnexpectedEnd) {
+		return d.unexpectedEnd()
+	}
+	return &MalformedError{Offset: d.pos, Message: err.Error(), Err: err}
+}
+
+// length reads a byte length that must fit in the current section or function
+func (d *decoder) length() (int, error) {
+	offset := d.pos
+	n, err := d.u32()
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n) > uint64(d.end-d.pos) {
+		return 0, d.malformed(offset, "length out of bounds")
+	}
+	return int(n), nil
+}
+
+// count reads the length of a vector. Each item takes at least one byte so the capacity is
+// limited by the remaining bytes rather than trusting the declared count.
+func (d *decoder) count() (uint32, int, error) {
+	n, err := d.u32()
+	if err != nil {
+		return 0, 0, err
+	}
+	capacity := d.end - d.pos
+	if uint64(n) < uint64(capacity) {
+		capacity = int(n)
+	}
+	return n, capacity, nil
+}
+
+func (d *decoder) name() (string, error) {
+	offset := d.pos
+	n, err := d.length()
+	if err != nil {
+		return "", err
+	}
+	b := d.data[d.pos : d.pos+n]
+	if !utf8.Valid(b) {
+		return "", d.malformed(offset, "malformed UTF-8 encoding")
+	}
+	d.pos += n
+	return string(b), nil
+}
+
+// decodeVector reads a vector, an empty vector is nil like readVector
+func decodeVector[T any](d *decoder, read func(*decoder) (T, error)) ([]T, error) {
+	n, capacity, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	var items []T
+	if n > 0 {
+		items = make([]T, 0, capacity)
+	}
+	for i := uint32(0); i < n; i++ {
+		item, err := read(d)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// decodeSlice reads a vector, an empty vector is an empty slice like ReadFuncTypes
+func decodeSlice[T any](d *decoder, read func(*decoder) (T, error)) ([]T, error) {
+	items, err := decodeVector(d, read)
+	if items == nil && err == nil {
+		items = []T{}
+	}
+	return items, err
+}
+
+func (d *decoder) section(module *api.Module, offsets *Offsets, section SectionOffset) error {
+	var err error
+	switch section.ID {
+	case CustomSectionID:
+		var name string
+		name, err = d.name()
+		if err == nil {
+			custom := &api.CustomSection{Name: name, Data: d.data[d.pos:d.end:d.end]}
+			module.Customs = append(module.Customs, custom)
+			names(module, custom)
+			d.pos = d.end
+		}
+	case TypeSectionID:
+		module.Types, err = decodeSlice(d, (*decoder).funcType)
+	case ImportSectionID:
+		module.Imports, err = decodeVector(d, (*decoder).importEntry)
+		if err == nil {
+			err = d.memories(module, section.Start)
+		}
+	case FunctionSectionID:
+		module.Funcs, err = decodeSlice(d, func(d *decoder) (*api.Func, error) {
+			index, err := d.u32()
+			return &api.Func{Type: api.TypeIndex(index)}, err
+		})
+	case TableSectionID:
+		module.Tables, err = decodeVector(d, (*decoder).table)
+	case MemorySectionID:
+		module.Mems, err = decodeVector(d, (*decoder).mem)
+		if err == nil {
+			err = d.memories(module, section.Start)
+		}
+	case GlobalSectionID:
+		module.Globals, err = decodeVector(d, (*decoder).global)
+	case ExportSectionID:
+		module.Exports, err = decodeSlice(d, (*decoder).export)
+	case ElementSectionID:
+		module.Elems, err = decodeVector(d, (*decoder).elem)
+	case CodeSectionID:
+		offsets.Bodies, err = d.code(module)
+	default:
+		// the section is valid but has no representation in the module
+		d.pos = d.end
+	}
+	return err
+}
+
+// memories checks that a module without the multi-memory proposal has at most one memory
+func (d *decoder) memories(module *api.Module, offset int) error {
+	n := len(module.Mems)
+	for _, imp := range module.Imports {
+		if _, ok := imp.Description.(*api.MemImportDescription); ok {
+			n++
+		}
+	}
+	if n > 1 && !d.options.Features.MultiMemory {
+		return d.invalid(offset, "multiple memories")
+	}
+	return nil
+}
+
+func (d *decoder) funcType() (*api.FuncType, error) {
+	offset := d.pos
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case 0x4e, 0x4f, 0x50, 0x5e, 0x5f:
+		// recursive, sub, array and struct types
+		return nil, d.unsupported(offset, d.options.Features.GC, "gc", "gc types are")
+	}
+	if b != 0x60 {
+		return nil, d.malformed(offset, "malformed function type")
+	}
+	parameters, err := decodeSlice(d, (*decoder).valType)
+	if err != nil {
+		return nil, err
+	}
+	results, err := decodeSlice(d, (*decoder).valType)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FuncType{Parameters: api.ResultType{Types: parameters}, Returns: api.ResultType{Types: results}}, nil
+}
+
+func (d *decoder) valType() (api.ValType, error) {
+	offset := d.pos
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch ValType(b) {
+	case I32:
+		return api.I32Type, nil
+	case I64:
+		return api.I64Type, nil
+	case F32:
+		return api.F32Type, nil
+	case F64:
+		return api.F64Type, nil
+	case V128:
+		if err := d.feature(offset, d.options.Features.SIMD, "simd"); err != nil {
+			return nil, err
+		}
+		return api.V128Type, nil
+	case 0x63, 0x64, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x71, 0x72, 0x73:
+		// typed and abstract references
+		return nil, d.unsupported(offset, d.options.Features.GC, "gc", "typed references are")
+	case 0x69:
+		return nil, d.unsupported(offset, d.options.Features.ExceptionHandling, "exceptions", "exnref is")
+	}
+	return nil, d.malformed(offset, "malformed value type")
+}
+
+func (d *decoder) importEntry() (api.Import, error) {
+	var imp api.Import
+	var err error
+	if imp.Module, err = d.name(); err != nil {
+		return imp, err
+	}
+	if imp.Name, err = d.name(); err != nil {
+		return imp, err
+	}
+	offset := d.pos
+	kind, err := d.byte()
+	if err != nil {
+		return imp, err
+	}
+	switch ExportKind(kind) {
+	case FuncExportKind:
+		index, err := d.u32()
+		imp.Description = &api.FuncImportDescription{TypeIdx: api.TypeIndex(index)}
+		return imp, err
+	case TableExportKind:
+		table, err := d.table()
+		imp.Description = &api.TableImportDescription{Table: table}
+		return imp, err
+	case MemoryExportKind:
+		mem, err := d.mem()
+		imp.Description = &api.MemImportDescription{Mem: mem}
+		return imp, err
+	case GlobalExportKind:
+		global, err := d.globalType()
+		imp.Description = &api.GlobalImportDescription{Global: global}
+		return imp, err
+	}
+	return imp, d.malformed(offset, "malformed import kind")
+}
+
+func (d *decoder) table() (api.Table, error) {
+	offset := d.pos
+	code, err := d.byte()
+	if err != nil {
+		return api.Table{}, err
+	}
+	var reference api.Reference
+	switch code {
+	case FuncRefType:
+		reference = &api.FunctionReference{}
+	case ExternRefType:
+		reference = &api.ExternalReference{}
+	default:
+		return api.Table{}, d.malformed(offset, "malformed reference type")
+	}
+	limits, err := d.limits()
+	return api.Table{Limits: limits, Reference: reference}, err
+}
+
+func (d *decoder) mem() (api.Mem, error) {
+	offset := d.pos
+	if d.pos >= d.end || d.data[d.pos] > LimitsMinMaxCode|LimitsSharedFlag|LimitsMemory64Flag {
+		limits, err := d.limits()
+		return api.Mem{Limits: limits}, err
+	}
+	flags := d.data[d.pos]
+	if flags&LimitsMemory64Flag != 0 {
+		// api.Mem does not represent memories indexed by i64
+		return api.Mem{}, d.unsupported(offset, d.options.Features.Memory64, "memory64", "memories indexed by i64 are")
+	}
+	if flags&LimitsSharedFlag == 0 {
+		limits, err := d.limits()
+		return api.Mem{Limits: limits}, err
+	}
+	if err := d.feature(offset, d.options.Features.Threads, "threads"); err != nil {
+		return api.Mem{}, err
+	}
+	if flags&LimitsMinMaxCode == 0 {
+		return api.Mem{}, d.invalid(offset, "shared memory must have maximum")
+	}
+	d.pos++
+	limits, err := d.bounds(true)
+	return api.Mem{Limits: limits, Shared: true}, err
+}
+
+func (d *decoder) limits() (api.Limits, error) {
+	offset := d.pos
+	code, err := d.byte()
+	if err != nil {
+		return api.Limits{}, err
+	}
+	if code != LimitsMinCode && code != LimitsMinMaxCode {
+		return api.Limits{}, d.malformed(offset, "malformed limits flags")
+	}
+	return d.bounds(code == LimitsMinMaxCode)
+}
+
+// bounds reads the minimum of limits and the maximum when the flags of the limits declare one
+func (d *decoder) bounds(hasMax bool) (api.Limits, error) {
+	min, err := d.u32()
+	if err != nil {
+		return api.Limits{}, err
+	}
+	if !hasMax {
+		return api.Limits{Min: min, Max: option.None[uint32]()}, nil
+	}
+	max, err := d.u32()
+	return api.Limits{Min: min, Max: option.Some(max)}, err
+}
+
+func (d *decoder) globalType() (api.Global, error) {
+	valType, err := d.valType()
+	if err != nil {
+		return api.Global{}, err
+	}
+	offset := d.pos
+	mutable, err := d.byte()
+	if err != nil {
+		return api.Global{}, err
+	}
+	if mutable > 1 {
+		return api.Global{}, d.malformed(offset, "malformed mutability")
+	}
+	return api.Global{Value: valType, Mutable: api.Mutable(mutable)}, nil
+}
+
+func (d *decoder) global() (api.Global, error) {
+	global, err := d.globalType()
+	if err != nil {
+		return global, err
+	}
+	global.Init, _, err = d.expression()
+	return global, err
+}
+
+func (d *decoder) export() (api.Export, error) {
+	name, err := d.name()
+	if err != nil {
+		return api.Export{}, err
+	}
+	offset := d.pos
+	kind, err := d.byte()
+	if err != nil {
+		return api.Export{}, err
+	}
+	index, err := d.u32()
+	if err != nil {
+		return api.Export{}, err
+	}
+	export := api.Export{Name: name}
+	switch ExportKind(kind) {
+	case FuncExportKind:
+		export.Description = &api.FuncExportDescription{FuncIdx: api.FuncIndex(index)}
+	case TableExportKind:
+		export.Description = &api.TableExportDescription{TableIdx: api.TableIndex(index)}
+	case MemoryExportKind:
+		export.Description = &api.MemExportDescription{MemIdx: api.MemoryIndex(index)}
+	case GlobalExportKind:
+		export.Description = &api.GlobalExportDescription{GlobalIdx: api.GlobalIndex(index)}
+	default:
+		return api.Export{}, d.malformed(offset, "malformed export kind")
+	}
+	return export, nil
+}
+
+// elem reads an active element segment of function indices, the encodings with flags 0 and 2 like ReadElem
+func (d *decoder) elem() (api.Elem, error) {
+	offset := d.pos
+	flags, err := d.u32()
+	if err != nil {
+		return api.Elem{}, err
+	}
+	var elem api.Elem
+	switch flags {
+	case 0:
+	case 2:
+		table, err := d.u32()
+		if err != nil {
+			return api.Elem{}, err
+		}
+		elem.Table = api.TableIndex(table)
+	default:
+		return api.Elem{}, d.malformed(offset, "malformed elements segment kind")
+	}
+	if elem.Offset, _, err = d.expression(); err != nil {
+		return api.Elem{}, err
+	}
+	if flags == 2 {
+		offset := d.pos
+		kind, err := d.byte()
+		if err != nil {
+			return api.Elem{}, err
+		}
+		if kind != 0x00 {
+			return api.Elem{}, d.malformed(offset, "malformed elements segment kind")
+		}
+	}
+	elem.Init, err = decodeVector(d, func(d *decoder) (api.FuncIndex, error) {
+		index, err := d.u32()
+		return api.FuncIndex(index), err
+	})
+	return elem, err
+}
+
+// code reads the size of each function body declared by the function section and decodes the bodies as set by the options
+func (d *decoder) code(module *api.Module) ([]BodyOffset, error) {
+	offset := d.pos
+	n, err := d.u32()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) != uint64(len(module.Funcs)) {
+		return nil, d.malformed(offset, "function and code section have inconsistent lengths")
+	}
+	bodies := make([]BodyOffset, 0, len(module.Funcs))
+	for range module.Funcs {
+		size, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, BodyOffset{Start: d.pos, End: d.pos + size})
+		d.pos += size
+	}
+	c := newCodeContext(module, d.options.Features)
+	decode := func(i int) error {
+		instructions, err := c.body(d.data, module.Funcs[i], bodies[i])
+		bodies[i].Instructions = instructions
+		return err
+	}
+	switch d.options.Code {
+	case LazyCode:
+		for i, fn := range module.Funcs {
+			i := i
+			fn.SetLoader(func(*api.Func) error {
+				return decode(i)
+			})
+		}
+	case ParallelCode:
+		err = parallel(len(bodies), d.options.Parallelism, decode)
+	default:
+		for i := range bodies {
+			if err = decode(i); err != nil {
+				break
+			}
+		}
+	}
+	return bodies, err
+}
+
+// parallel calls fn for the indices up to n from the given number of goroutines and
+// returns the error of the lowest index so the result does not depend on scheduling
+func parallel(n int, goroutines int, fn func(int) error) error {
+	if goroutines <= 0 {
+		goroutines = runtime.GOMAXPROCS(0)
+	}
+	if goroutines > n {
+		goroutines = n
+	}
+	errs := make([]error, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeContext holds the parts of the module needed to validate function bodies. Bodies only read
+// the context so they can be decoded concurrently.
+type codeContext struct {
+	types    []*api.FuncType
+	funcs    int
+	tables   int
+	features config.Features
+}
+
+func newCodeContext(module *api.Module, features config.Features) *codeContext {
+	c := &codeContext{
+		types:    module.Types,
+		funcs:    len(module.Funcs),
+		tables:   len(module.Tables),
+		features: features,
+	}
+	for _, imp := range module.Imports {
+		switch imp.Description.(type) {
+		case *api.FuncImportDescription:
+			c.funcs++
+		case *api.TableImportDescription:
+			c.tables++
+		}
+	}
+	return c
+}
+
+// body decodes and validates the locals and instructions of a function and returns the offsets of the instructions
+func (c *codeContext) body(data []byte, fn *api.Func, body BodyOffset) ([]int, error) {
+	d := &decoder{data: data, pos: body.Start, end: body.End, options: DecodeOptions{Features: c.features}}
+	if int(fn.Type) >= len(c.types) {
+		return nil, d.invalid(body.Start, fmt.Sprintf("unknown type %d", fn.Type))
+	}
+	locals, err := d.locals()
+	if err != nil {
+		return nil, err
+	}
+	expression, offsets, err := d.expression()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != d.end {
+		return nil, d.malformed(d.pos, "section size mismatch")
+	}
+	params := len(c.types[fn.Type].Parameters.Types)
+	for i, instruction := range expression.Instructions {
+		if err := c.validate(instruction, params+len(locals)); err != nil {
+			return nil, d.invalid(offsets[i], err.Error())
+		}
+	}
+	fn.Locals = locals
+	fn.Body = expression
+	fn.Offsets = offsets
+	return offsets, nil
+}
+
+// validate checks that the indices of an instruction refer to items of the module
+func (c *codeContext) validate(instruction api.Instruction, locals int) error {
+	switch inst := instruction.(type) {
+	case api.LocalGet:
+		if int(inst.Index) >= locals {
+			return fmt.Errorf("unknown local %d", inst.Index)
+		}
+	case *api.Call:
+		if int(inst.Index) >= c.funcs {
+			return fmt.Errorf("unknown function %d", inst.Index)
+		}
+	case *api.CallIndirect:
+		if int(inst.Type) >= len(c.types) {
+			return fmt.Errorf("unknown type %d", inst.Type)
+		}
+		if int(inst.Table) >= c.tables {
+			return fmt.Errorf("unknown table %d", inst.Table)
+		}
+	}
+	return nil
+}
+
+// locals reads the runs of locals that share a type
+func (d *decoder) locals() ([]api.ValType, error) {
+	offset := d.pos
+	n, capacity, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	type run struct {
+		count   uint32
+		valType api.ValType
+	}
+	runs := make([]run, 0, capacity)
+	var total uint64
+	for i := uint32(0); i < n; i++ {
+		count, err := d.u32()
+		if err != nil {
+			return nil, err
+		}
+		valType, err := d.valType()
+		if err != nil {
+			return nil, err
+		}
+		total += uint64(count)
+		if total > MaxLocals {
+			return nil, d.malformed(offset, "too many locals")
+		}
+		runs = append(runs, run{count, valType})
+	}
+	locals := make([]api.ValType, 0, total)
+	for _, r := range runs {
+		for i := uint32(0); i < r.count; i++ {
+			locals = append(locals, r.valType)
+		}
+	}
+	return locals, nil
+}
+
+// expression reads instructions up to and including the End that terminates the expression and returns their offsets
+func (d *decoder) expression() (*api.Expression, []int, error) {
+	var instructions []api.Instruction
+	var offsets []int
+	for {
+		if d.pos >= d.end {
+			return nil, nil, d.malformed(d.pos, "END opcode expected")
+		}
+		offsets = append(offsets, d.pos)
+		instruction, err := d.instruction()
+		if err != nil {
+			return nil, nil, err
+		}
+		instructions = append(instructions, instruction)
+		if _, ok := instruction.(api.End); ok {
+			return &api.Expression{Instructions: instructions}, offsets, nil
+		}
+	}
+}
+
+// instruction reads the instructions supported by ReadInstruction
+func (d *decoder) instruction() (api.Instruction, error) {
+	offset := d.pos
+	b, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch opcode.Opcode(b) {
+	case opcode.End:
+		return api.End{}, nil
+	case opcode.LocalGet:
+		index, err := d.u32()
+		return api.LocalGet{Index: api.LocalIndex(index)}, err
+	case opcode.I32Add:
+		return api.I32Add{}, nil
+	case opcode.I32Const:
+		value, err := d.s32()
+		return api.I32Const(uint32(value)), err
+	case opcode.Call:
+		index, err := d.u32()
+		return &api.Call{Index: api.FuncIndex(index)}, err
+	case opcode.CallIndirect:
+		typeIndex, err := d.u32()
+		if err != nil {
+			return nil, err
+		}
+		table, err := d.u32()
+		return &api.CallIndirect{Table: api.TableIndex(table), Type: api.TypeIndex(typeIndex)}, err
+	}
+	if err := d.proposalOpcode(offset, b); err != nil {
+		return nil, err
+	}
+	if defined(b) {
+		return nil, &UnsupportedError{Offset: offset, Message: fmt.Sprintf("opcode %02x not supported", b)}
+	}
+	return nil, d.malformed(offset, fmt.Sprintf("illegal opcode %02x", b))
+}
+
+// defined reports whether b is an opcode or an opcode prefix of the core specification
+// https://webassembly.github.io/spec/core/appendix/index-instructions.html
+func defined(b byte) bool {
+	switch {
+	case b <= 0x05, b >= 0x0b && b <= 0x11, b >= 0x1a && b <= 0x1c, b >= 0x20 && b <= 0x26:
+		return true
+	case b >= 0x28 && b <= 0xc4, b >= 0xd0 && b <= 0xd2, b == 0xfc:
+		return true
+	}
+	return false
+}
+
+// proposalOpcode reports the opcodes of proposals, the decoder does not implement their instructions
+func (d *decoder) proposalOpcode(offset int, b byte) error {
+	features := d.options.Features
+	switch b {
+	case 0xfd:
+		return d.unsupported(offset, features.SIMD, "simd", "vector instructions are")
+	case 0xfe:
+		return d.unsupported(offset, features.Threads, "threads", "atomic instructions are")
+	case 0xfb, 0x14, 0xd3, 0xd4, 0xd5, 0xd6:
+		// gc instructions, call_ref, ref.eq, ref.as_non_null, br_on_null and br_on_non_null
+		return d.unsupported(offset, features.GC, "gc", "gc instructions are")
+	case 0x12, 0x13:
+		// return_call and return_call_indirect
+		return d.unsupported(offset, features.TailCalls, "tail calls", "tail calls are")
+	case 0x06, 0x07, 0x08, 0x09, 0x0a, 0x18, 0x19, 0x1f:
+		// try, catch, throw, rethrow, throw_ref, delegate, catch_all and try_table
+		return d.unsupported(offset, features.ExceptionHandling, "exceptions", "exception instructions are")
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package binary_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/leb128"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeModule(t *testing.T) {
+	paths := []string{
+		"../fixtures/empty/empty.wasm",
+		"../fixtures/func/func.wasm",
+		"../fixtures/add/add.wasm",
+		"../fixtures/add/export.wasm",
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			document, err := binary.Read(bytes.NewReader(data))
+			require.NoError(t, err)
+			module, offsets, err := binary.DecodeModule(data)
+			require.NoError(t, err)
+			// Read does not record the offsets of instructions
+			for i, fn := range module.Funcs {
+				require.Equal(t, offsets.Bodies[i].Instructions, fn.Offsets)
+				fn.Offsets = nil
+			}
+			require.Equal(t, document.Directive, module)
+		})
+	}
+}
+
+func TestDecodeOffsets(t *testing.T) {
+	data, err := os.ReadFile("../fixtures/add/add.wasm")
+	require.NoError(t, err)
+	_, offsets, err := binary.DecodeModule(data)
+	require.NoError(t, err)
+	require.Equal(t, []binary.SectionOffset{
+		{ID: binary.TypeSectionID, Offset: 0x08, Start: 0x0a, End: 0x11},
+		{ID: binary.FunctionSectionID, Offset: 0x11, Start: 0x13, End: 0x15},
+		{ID: binary.CodeSectionID, Offset: 0x15, Start: 0x17, End: 0x20},
+	}, offsets.Sections)
+	require.Equal(t, []binary.BodyOffset{
+		{Start: 0x19, End: 0x20, Instructions: []int{0x1a, 0x1c, 0x1e, 0x1f}},
+	}, offsets.Bodies)
+}
+
+func TestDecodeLocals(t *testing.T) {
+	module := &api.Module{
+		Types: []*api.FuncType{
+			{
+				Parameters: api.ResultType{Types: []api.ValType{}},
+				Returns:    api.ResultType{Types: []api.ValType{}},
+			},
+		},
+		Funcs: []*api.Func{
+			{
+				Locals: []api.ValType{api.I32Type, api.I32Type, api.I64Type, api.I32Type},
+				Body: &api.Expression{
+					Instructions: []api.Instruction{api.End{}},
+				},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+	// the locals are written as three runs
+	require.True(t, bytes.Contains(buf.Bytes(), []byte{0x03, 0x02, 0x7f, 0x01, 0x7e, 0x01, 0x7f, 0x0b}))
+
+	decoded, _, err := binary.DecodeModule(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, decoded.Funcs[0].Offsets, 1)
+	require.Equal(t, byte(0x0b), buf.Bytes()[decoded.Funcs[0].Offsets[0]])
+	decoded.Funcs[0].Offsets = nil
+	require.Equal(t, module, decoded)
+
+	document, err := binary.Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, module, document.Directive)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	preamble := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module := func(sections ...byte) []byte {
+		return append(append([]byte{}, preamble...), sections...)
+	}
+	// a type section with the type of a function without parameters or results and a function section that uses it
+	fn := []byte{0x01, 0x04, 0x01, 0x60, 0x00, 0x00, 0x03, 0x02, 0x01, 0x00}
+	tests := []struct {
+		name    string
+		data    []byte
+		offset  int
+		message string
+		err     error
+	}{
+		{"magic", []byte{0x00, 0x61, 0x73, 0x6e, 0x01, 0x00, 0x00, 0x00}, 0, "magic header not detected", nil},
+		{"version", []byte{0x00, 0x61, 0x73, 0x6d, 0x02, 0x00, 0x00, 0x00}, 4, "unknown binary version", nil},
+		{"preamble end", []byte{0x00, 0x61, 0x73, 0x6d, 0x01}, 5, "unexpected end", nil},
+		{"section id", module(0x0e, 0x00), 8, "malformed section id", nil},
+		{"section order", module(0x03, 0x01, 0x00, 0x01, 0x01, 0x00), 11, "unexpected content after last section", nil},
+		{"duplicate section", module(0x01, 0x01, 0x00, 0x01, 0x01, 0x00), 11, "unexpected content after last section", nil},
+		{"section size", module(0x01, 0x02, 0x00, 0x00), 11, "section size mismatch", nil},
+		{"section length", module(0x01, 0x05, 0x00), 9, "length out of bounds", nil},
+		{"end", module(0x01), 9, "unexpected end", nil},
+		{"end of section", module(0x01, 0x01, 0x01, 0x00, 0x01, 0x00), 11, "unexpected end of section or function", nil},
+		{"integer too long", module(0x01, 0x06, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00), 10, "integer representation too long", leb128.ErrTooLong},
+		{"integer too large", module(0x01, 0x05, 0x80, 0x80, 0x80, 0x80, 0x10), 10, "integer too large", leb128.ErrTooLarge},
+		{"utf8", module(0x07, 0x05, 0x01, 0x01, 0xff, 0x00, 0x00), 11, "malformed UTF-8 encoding", nil},
+		{"value type", module(0x01, 0x04, 0x01, 0x60, 0x01, 0x40), 13, "malformed value type", nil},
+		{"function type", module(0x01, 0x04, 0x01, 0x61, 0x00, 0x00), 11, "malformed function type", nil},
+		{"missing code", module(fn...), 18, "function and code section have inconsistent lengths", nil},
+		{"code count", module(append(fn, 0x0a, 0x01, 0x00)...), 20, "function and code section have inconsistent lengths", nil},
+		{"illegal opcode", module(append(fn, 0x0a, 0x04, 0x01, 0x02, 0x00, 0xff)...), 23, "illegal opcode ff", nil},
+		{"end expected", module(append(fn, 0x0a, 0x03, 0x01, 0x01, 0x00)...), 23, "END opcode expected", nil},
+		{"body size", module(append(fn, 0x0a, 0x05, 0x01, 0x03, 0x00, 0x0b, 0x0b)...), 24, "section size mismatch", nil},
+		{"too many locals", module(append(fn, 0x0a, 0x08, 0x01, 0x06, 0x01, 0xd1, 0x86, 0x03, 0x7f, 0x0b)...), 22, "too many locals", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := binary.DecodeModule(test.data)
+			var malformed *binary.MalformedError
+			require.True(t, errors.As(err, &malformed), "%v", err)
+			require.Equal(t, test.message, malformed.Message)
+			require.Equal(t, test.offset, malformed.Offset)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	preamble := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	// a module with one function without parameters or results and a code section with the body
+	module := func(body ...byte) []byte {
+		code := append([]byte{0x00}, body...)
+		data := append([]byte{}, preamble...)
+		data = append(data, 0x01, 0x04, 0x01, 0x60, 0x00, 0x00, 0x03, 0x02, 0x01, 0x00)
+		data = append(data, 0x0a, byte(len(code)+2), 0x01, byte(len(code)))
+		return append(data, code...)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		message string
+	}{
+		{"loop", module(0x03, 0x40, 0x0b, 0x0b), "opcode 03 not supported"},
+		{"br", module(0x0c, 0x00, 0x0b), "opcode 0c not supported"},
+		{"i32.load", module(0x41, 0x00, 0x28, 0x02, 0x00, 0x1a, 0x0b), "opcode 28 not supported"},
+		{"memory.fill", module(0xfc, 0x0b, 0x00, 0x0b), "opcode fc not supported"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := binary.DecodeModule(test.data)
+			var unsupported *binary.UnsupportedError
+			require.True(t, errors.As(err, &unsupported), "%v", err)
+			require.Equal(t, test.message, unsupported.Message)
+			var malformed *binary.MalformedError
+			require.False(t, errors.As(err, &malformed))
+		})
+	}
+}
+
+func TestDecodeFeatures(t *testing.T) {
+	preamble := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module := func(sections ...byte) []byte {
+		return append(append([]byte{}, preamble...), sections...)
+	}
+	message := func(err error) string {
+		var malformed *binary.MalformedError
+		var invalid *binary.InvalidError
+		var unsupported *binary.UnsupportedError
+		switch {
+		case err == nil:
+			return ""
+		case errors.As(err, &malformed):
+			return malformed.Message
+		case errors.As(err, &invalid):
+			return invalid.Message
+		case errors.As(err, &unsupported):
+			return unsupported.Message
+		}
+		return err.Error()
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		features config.Features
+		disabled string
+		// enabled is the error when the feature is enabled, the parts of proposals the decoder does not implement still fail
+		enabled string
+	}{
+		{"simd", module(0x01, 0x05, 0x01, 0x60, 0x01, 0x7b, 0x00), config.Features{SIMD: true}, "simd support is not enabled", ""},
+		{"simd instructions",
+			module(0x01, 0x04, 0x01, 0x60, 0x00, 0x00, 0x03, 0x02, 0x01, 0x00, 0x0a, 0x06, 0x01, 0x04, 0x00, 0xfd, 0x0c, 0x0b),
+			config.Features{SIMD: true}, "simd support is not enabled", "vector instructions are not supported"},
+		{"threads", module(0x05, 0x04, 0x01, 0x03, 0x01, 0x02), config.Features{Threads: true}, "threads support is not enabled", ""},
+		{"shared without maximum", module(0x05, 0x03, 0x01, 0x02, 0x01), config.Features{Threads: true}, "threads support is not enabled", "shared memory must have maximum"},
+		{"multi-memory", module(0x05, 0x05, 0x02, 0x00, 0x01, 0x00, 0x01), config.Features{MultiMemory: true}, "multiple memories", ""},
+		{"memory64", module(0x05, 0x03, 0x01, 0x04, 0x01), config.Features{Memory64: true}, "memory64 support is not enabled", "memories indexed by i64 are not supported"},
+		{"gc", module(0x01, 0x03, 0x01, 0x5f, 0x00), config.Features{GC: true}, "gc support is not enabled", "gc types are not supported"},
+		{"exceptions", module(0x0d, 0x03, 0x01, 0x00, 0x00), config.Features{ExceptionHandling: true}, "exceptions support is not enabled", "tags are not supported"},
+		{"tail calls",
+			module(0x01, 0x04, 0x01, 0x60, 0x00, 0x00, 0x03, 0x02, 0x01, 0x00, 0x0a, 0x06, 0x01, 0x04, 0x00, 0x12, 0x00, 0x0b),
+			config.Features{TailCalls: true}, "tail calls support is not enabled", "tail calls are not supported"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := binary.DecodeModule(test.data)
+			require.Equal(t, test.disabled, message(err))
+			_, _, err = binary.DecodeModuleOptions(test.data, binary.DecodeOptions{Features: test.features})
+			require.Equal(t, test.enabled, message(err))
+
+			// the reader applies the features after the preamble
+			_, err = binary.ReadModuleOptions(bytes.NewReader(test.data[8:]), binary.DecodeOptions{Features: test.features})
+			require.Equal(t, test.enabled, message(err))
+		})
+	}
+}
+
+func TestDecodeSharedMemory(t *testing.T) {
+	module := &api.Module{
+		Mems: []api.Mem{{Limits: api.Limits{Min: 1, Max: option.Some[uint32](2)}, Shared: true}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+	decoded, _, err := binary.DecodeModuleOptions(buf.Bytes(), binary.DecodeOptions{Features: config.Features{Threads: true}})
+	require.NoError(t, err)
+	require.Equal(t, module.Mems, decoded.Mems)
+}
+
+// functions returns a module with n functions that add their parameters and call the next function
+func functions(t testing.TB, n int) []byte {
+	module := &api.Module{
+		Types: []*api.FuncType{
+			{
+				Parameters: api.ResultType{Types: []api.ValType{api.I32Type, api.I32Type}},
+				Returns:    api.ResultType{Types: []api.ValType{api.I32Type}},
+			},
+		},
+	}
+	for i := 0; i < n; i++ {
+		module.Funcs = append(module.Funcs, &api.Func{
+			Locals: []api.ValType{api.I32Type, api.I64Type},
+			Body: &api.Expression{
+				Instructions: []api.Instruction{
+					api.LocalGet{Index: 0},
+					api.LocalGet{Index: 1},
+					api.I32Add{},
+					api.I32Const(uint32(i)),
+					&api.Call{Index: api.FuncIndex((i + 1) % n)},
+					api.End{},
+				},
+			},
+		})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+	return buf.Bytes()
+}
+
+func TestDecodeCode(t *testing.T) {
+	data := functions(t, 100)
+	expected, expectedOffsets, err := binary.DecodeModule(data)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		options binary.DecodeOptions
+	}{
+		{"parallel", binary.DecodeOptions{Code: binary.ParallelCode}},
+		{"parallel one", binary.DecodeOptions{Code: binary.ParallelCode, Parallelism: 1}},
+		{"lazy", binary.DecodeOptions{Code: binary.LazyCode}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			module, offsets, err := binary.DecodeModuleOptions(data, test.options)
+			require.NoError(t, err)
+			require.Len(t, module.Funcs, len(expected.Funcs))
+			for i, fn := range module.Funcs {
+				require.NoError(t, fn.Load())
+				require.Equal(t, expected.Funcs[i].Locals, fn.Locals)
+				require.Equal(t, expected.Funcs[i].Body, fn.Body)
+				require.Equal(t, expected.Funcs[i].Offsets, fn.Offsets)
+			}
+			require.Equal(t, expectedOffsets, offsets)
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	data := functions(t, 3)
+	// bodies decoded before DecodeModuleOptions returns are read without Load
+	for _, code := range []binary.CodeDecoding{binary.EagerCode, binary.ParallelCode} {
+		module, _, err := binary.DecodeModuleOptions(data, binary.DecodeOptions{Code: code})
+		require.NoError(t, err)
+		for i, fn := range module.Funcs {
+			require.Equal(t, []api.ValType{api.I32Type, api.I64Type}, fn.Locals)
+			require.NotNil(t, fn.Body)
+			require.Equal(t, api.I32Const(uint32(i)), fn.Body.Instructions[3])
+		}
+	}
+
+	// lazy bodies are set by Load, writing a module loads its bodies
+	module, _, err := binary.DecodeModuleOptions(data, binary.DecodeOptions{Code: binary.LazyCode})
+	require.NoError(t, err)
+	for _, fn := range module.Funcs {
+		require.Nil(t, fn.Locals)
+		require.Nil(t, fn.Body)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+	require.Equal(t, data, buf.Bytes())
+	require.NotNil(t, module.Funcs[0].Body)
+
+	// functions built directly have no loader
+	fn := &api.Func{Body: &api.Expression{Instructions: []api.Instruction{api.End{}}}}
+	require.NoError(t, fn.Load())
+	require.Equal(t, []api.Instruction{api.End{}}, fn.Body.Instructions)
+}
+
+func TestDecodeLazy(t *testing.T) {
+	// the body of the second function has an illegal opcode
+	data := functions(t, 2)
+	illegal := bytes.LastIndexByte(data, 0x0b)
+	data[illegal] = 0xff
+
+	module, offsets, err := binary.DecodeModuleOptions(data, binary.DecodeOptions{Code: binary.LazyCode})
+	require.NoError(t, err)
+	require.Nil(t, module.Funcs[1].Body)
+	require.Nil(t, offsets.Bodies[1].Instructions)
+
+	require.NoError(t, module.Funcs[0].Load())
+	require.NotNil(t, module.Funcs[0].Body)
+	require.Len(t, offsets.Bodies[0].Instructions, 6)
+
+	var malformed *binary.MalformedError
+	require.ErrorAs(t, module.Funcs[1].Load(), &malformed)
+	require.Equal(t, "illegal opcode ff", malformed.Message)
+	require.Equal(t, illegal, malformed.Offset)
+	// the loader runs once
+	require.Equal(t, malformed, module.Funcs[1].Load())
+}
+
+func TestDecodeCodeFail(t *testing.T) {
+	// every body calls a function that does not exist
+	data := functions(t, 10)
+	first := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] == 0x10 && data[i+2] == 0x0b {
+			data[i+1] = 0x7f
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	for _, code := range []binary.CodeDecoding{binary.EagerCode, binary.ParallelCode} {
+		_, _, err := binary.DecodeModuleOptions(data, binary.DecodeOptions{Code: code})
+		var invalid *binary.InvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Equal(t, "unknown function 127", invalid.Message)
+		// the error of the first body is reported
+		require.Equal(t, first, invalid.Offset)
+	}
+}
+
+func BenchmarkDecodeModule(b *testing.B) {
+	data := functions(b, 10000)
+	tests := []struct {
+		name    string
+		options binary.DecodeOptions
+	}{
+		{"eager", binary.DecodeOptions{Code: binary.EagerCode}},
+		{"parallel", binary.DecodeOptions{Code: binary.ParallelCode}},
+		{"lazy", binary.DecodeOptions{Code: binary.LazyCode}},
+	}
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := binary.DecodeModuleOptions(data, test.options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package binary
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 
 	"encoding/binary"
 
+	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-wasm/api"
 	"github.com/patrickhuber/go-wasm/leb128"
 	"github.com/patrickhuber/go-wasm/opcode"
@@ -68,6 +70,8 @@ func ReadPreamble(reader io.Reader) (api.Preamble, error) {
 	}, nil
 }
 
+// ReadModule reads the sections of a module after the preamble. Custom sections are kept in the order they
+// appear and a valid name section also sets the Names of the module.
 func ReadModule(reader io.Reader) (*api.Module, error) {
 	module := &api.Module{}
 	for {
@@ -85,6 +89,24 @@ func ReadModule(reader io.Reader) (*api.Module, error) {
 				return nil, err
 			}
 			module.Types = types
+		case ImportSectionID:
+			imports, err := readVector(reader, ReadImport)
+			if err != nil {
+				return nil, err
+			}
+			module.Imports = imports
+		case TableSectionID:
+			tables, err := readVector(reader, ReadTable)
+			if err != nil {
+				return nil, err
+			}
+			module.Tables = tables
+		case MemorySectionID:
+			mems, err := readVector(reader, ReadMem)
+			if err != nil {
+				return nil, err
+			}
+			module.Mems = mems
 		case FunctionSectionID:
 			funcs, err := ReadFuncs(size, reader)
 			if err != nil {
@@ -103,6 +125,23 @@ func ReadModule(reader io.Reader) (*api.Module, error) {
 				return nil, err
 			}
 			module.Exports = exports
+		case ElementSectionID:
+			elems, err := readVector(reader, ReadElem)
+			if err != nil {
+				return nil, err
+			}
+			module.Elems = elems
+		case CustomSectionID:
+			data, err := ReadBytes(reader, int(size))
+			if err != nil {
+				return nil, err
+			}
+			custom, err := ReadCustomSection(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			module.Customs = append(module.Customs, custom)
+			names(module, custom)
 		default:
 			// skip unknown sections
 			data := make([]byte, size)
@@ -116,8 +155,21 @@ func ReadModule(reader io.Reader) (*api.Module, error) {
 	return module, nil
 }
 
-func ReadComponent(reader io.Reader) (*api.Component, error) {
-	return &api.Component{}, nil
+// ReadModuleOptions reads the sections of a module after the preamble with the checks of DecodeModuleOptions
+// and the proposals enabled by options. The rest of the reader is read before the module is decoded and the
+// offsets of errors are relative to the start of the module, including the preamble.
+func ReadModuleOptions(reader io.Reader, options DecodeOptions) (*api.Module, error) {
+	sections, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, 8+len(sections))
+	data = append(data, Magic...)
+	data = binary.LittleEndian.AppendUint16(data, ModuleVersion)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = append(data, sections...)
+	module, _, err := DecodeModuleOptions(data, options)
+	return module, err
 }
 
 func ReadSectionHeader(reader io.Reader) (SectionID, uint32, error) {
@@ -199,6 +251,32 @@ func ReadValueTypeVector(reader io.Reader) ([]api.ValType, error) {
 	return valueTypes, nil
 }
 
+// ReadLocals reads runs of locals that share a type and expands them to one type per local
+func ReadLocals(reader io.Reader) ([]api.ValType, error) {
+	size, err := ReadLebU128(reader)
+	if err != nil {
+		return nil, err
+	}
+	locals := []api.ValType{}
+	for i := uint32(0); i < size; i++ {
+		count, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(locals))+uint64(count) > MaxLocals {
+			return nil, fmt.Errorf("too many locals")
+		}
+		vt, err := ReadValueType(reader)
+		if err != nil {
+			return nil, err
+		}
+		for j := uint32(0); j < count; j++ {
+			locals = append(locals, vt)
+		}
+	}
+	return locals, nil
+}
+
 func ReadValueType(reader io.Reader) (api.ValType, error) {
 	b, err := ReadByte(reader)
 	if err != nil {
@@ -289,11 +367,177 @@ func ReadExport(reader io.Reader) (api.Export, error) {
 				FuncIdx: api.FuncIndex(index),
 			},
 		}, nil
+	case TableExportKind:
+		return api.Export{
+			Name: name,
+			Description: &api.TableExportDescription{
+				TableIdx: api.TableIndex(index),
+			},
+		}, nil
+	case MemoryExportKind:
+		return api.Export{
+			Name: name,
+			Description: &api.MemExportDescription{
+				MemIdx: api.MemoryIndex(index),
+			},
+		}, nil
+	case GlobalExportKind:
+		return api.Export{
+			Name: name,
+			Description: &api.GlobalExportDescription{
+				GlobalIdx: api.GlobalIndex(index),
+			},
+		}, nil
 	default:
 		return zero, fmt.Errorf("invalid export kind %d", exportKind)
 	}
 }
 
+func ReadImport(reader io.Reader) (api.Import, error) {
+	var zero api.Import
+	module, err := ReadString(reader)
+	if err != nil {
+		return zero, err
+	}
+	name, err := ReadString(reader)
+	if err != nil {
+		return zero, err
+	}
+	kind, err := ReadByte(reader)
+	if err != nil {
+		return zero, err
+	}
+	imp := api.Import{Module: module, Name: name}
+	switch ExportKind(kind) {
+	case FuncExportKind:
+		index, err := ReadLebU128(reader)
+		if err != nil {
+			return zero, err
+		}
+		imp.Description = &api.FuncImportDescription{TypeIdx: api.TypeIndex(index)}
+	case TableExportKind:
+		table, err := ReadTable(reader)
+		if err != nil {
+			return zero, err
+		}
+		imp.Description = &api.TableImportDescription{Table: table}
+	case MemoryExportKind:
+		mem, err := ReadMem(reader)
+		if err != nil {
+			return zero, err
+		}
+		imp.Description = &api.MemImportDescription{Mem: mem}
+	case GlobalExportKind:
+		valType, err := ReadValueType(reader)
+		if err != nil {
+			return zero, err
+		}
+		mutable, err := ReadByte(reader)
+		if err != nil {
+			return zero, err
+		}
+		if mutable > 1 {
+			return zero, fmt.Errorf("invalid global mutability %d", mutable)
+		}
+		imp.Description = &api.GlobalImportDescription{Global: api.Global{Value: valType, Mutable: api.Mutable(mutable)}}
+	default:
+		return zero, fmt.Errorf("invalid import kind %d", kind)
+	}
+	return imp, nil
+}
+
+func ReadTable(reader io.Reader) (api.Table, error) {
+	code, err := ReadByte(reader)
+	if err != nil {
+		return api.Table{}, err
+	}
+	var reference api.Reference
+	switch code {
+	case FuncRefType:
+		reference = &api.FunctionReference{}
+	case ExternRefType:
+		reference = &api.ExternalReference{}
+	default:
+		return api.Table{}, fmt.Errorf("invalid reference type 0x%02x", code)
+	}
+	limits, err := ReadLimits(reader)
+	if err != nil {
+		return api.Table{}, err
+	}
+	return api.Table{Limits: limits, Reference: reference}, nil
+}
+
+// ReadElem reads an active element segment of function indices, the encodings with flags 0 and 2
+func ReadElem(reader io.Reader) (api.Elem, error) {
+	flags, err := ReadLebU128(reader)
+	if err != nil {
+		return api.Elem{}, err
+	}
+	var elem api.Elem
+	switch flags {
+	case 0:
+	case 2:
+		table, err := ReadLebU128(reader)
+		if err != nil {
+			return api.Elem{}, err
+		}
+		elem.Table = api.TableIndex(table)
+	default:
+		return api.Elem{}, fmt.Errorf("unsupported element segment flags %d", flags)
+	}
+	elem.Offset, err = ReadExpression(reader)
+	if err != nil {
+		return api.Elem{}, err
+	}
+	if flags == 2 {
+		kind, err := ReadByte(reader)
+		if err != nil {
+			return api.Elem{}, err
+		}
+		if kind != 0x00 {
+			return api.Elem{}, fmt.Errorf("invalid element kind 0x%02x", kind)
+		}
+	}
+	elem.Init, err = readVector(reader, func(r io.Reader) (api.FuncIndex, error) {
+		index, err := ReadLebU128(r)
+		return api.FuncIndex(index), err
+	})
+	if err != nil {
+		return api.Elem{}, err
+	}
+	return elem, nil
+}
+
+func ReadMem(reader io.Reader) (api.Mem, error) {
+	limits, err := ReadLimits(reader)
+	if err != nil {
+		return api.Mem{}, err
+	}
+	return api.Mem{Limits: limits}, nil
+}
+
+func ReadLimits(reader io.Reader) (api.Limits, error) {
+	code, err := ReadByte(reader)
+	if err != nil {
+		return api.Limits{}, err
+	}
+	min, err := ReadLebU128(reader)
+	if err != nil {
+		return api.Limits{}, err
+	}
+	switch code {
+	case LimitsMinCode:
+		return api.Limits{Min: min, Max: option.None[uint32]()}, nil
+	case LimitsMinMaxCode:
+		max, err := ReadLebU128(reader)
+		if err != nil {
+			return api.Limits{}, err
+		}
+		return api.Limits{Min: min, Max: option.Some(max)}, nil
+	}
+	return api.Limits{}, fmt.Errorf("invalid limits 0x%02x", code)
+}
+
 func ReadString(reader io.Reader) (string, error) {
 	size, err := ReadLebU128(reader)
 	if err != nil {
@@ -353,7 +597,7 @@ func UpdateFuncsWithCode(module *api.Module, size uint32, reader io.Reader) erro
 		}
 
 		fn := module.Funcs[index]
-		locals, err := ReadValueTypeVector(reader)
+		locals, err := ReadLocals(reader)
 		if err != nil {
 			return err
 		}
@@ -385,6 +629,28 @@ func ReadInstruction(reader io.Reader) (api.Instruction, error) {
 		}, nil
 	case opcode.I32Add:
 		return api.I32Add{}, nil
+	case opcode.I32Const:
+		value, _, err := leb128.DecodeSignedReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return api.I32Const(uint32(value)), nil
+	case opcode.Call:
+		index, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Call{Index: api.FuncIndex(index)}, nil
+	case opcode.CallIndirect:
+		typeIndex, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		table, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &api.CallIndirect{Table: api.TableIndex(table), Type: api.TypeIndex(typeIndex)}, nil
 	}
 	return nil, fmt.Errorf("invalid opcode %d", opCode)
 }
@@ -0,0 +1,813 @@
+package binary
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/patrickhuber/go-wasm/api"
+)
+
+func ReadComponent(reader io.Reader) (*api.Component, error) {
+	component := &api.Component{}
+	for {
+		sectionID, size, err := ReadSectionHeader(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		data, err := ReadBytes(reader, int(size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read section %d: %w", sectionID, err)
+		}
+
+		section, err := ReadComponentSection(sectionID, data)
+		if err != nil {
+			return nil, err
+		}
+		component.Sections = append(component.Sections, section)
+	}
+	return component, nil
+}
+
+// ReadComponentSection decodes the contents of a component section. Sections that are not modelled are returned as an api.RawSection.
+// Core modules are kept as raw sections so that components round trip until the module reader covers every core section.
+func ReadComponentSection(id SectionID, data []byte) (api.ComponentSection, error) {
+	reader := bytes.NewReader(data)
+
+	var section api.ComponentSection
+	var err error
+	switch id {
+	case ComponentCustomSectionID:
+		section, err = ReadCustomSection(reader)
+	case ComponentTypeSectionID:
+		section, err = ReadComponentTypeSection(reader)
+	case ComponentAliasSectionID:
+		section, err = ReadAliasSection(reader)
+	case ComponentImportSectionID:
+		section, err = ReadComponentImportSection(reader)
+	case ComponentExportSectionID:
+		section, err = ReadComponentExportSection(reader)
+	case ComponentComponentSectionID:
+		section, err = ReadNestedComponentSection(reader)
+	case ComponentCoreInstanceSectionID:
+		section, err = ReadCoreInstanceSection(reader)
+	case ComponentInstanceSectionID:
+		section, err = ReadInstanceSection(reader)
+	case ComponentCanonSectionID:
+		section, err = ReadCanonSection(reader)
+	default:
+		return &api.RawSection{ID: uint8(id), Data: data}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("section %d: %w", id, err)
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("section %d: section size mismatch, %d unread bytes", id, reader.Len())
+	}
+	return section, nil
+}
+
+func ReadCustomSection(reader *bytes.Reader) (*api.CustomSection, error) {
+	name, err := ReadString(reader)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadBytes(reader, reader.Len())
+	if err != nil {
+		return nil, err
+	}
+	return &api.CustomSection{
+		Name: name,
+		Data: data,
+	}, nil
+}
+
+func ReadComponentTypeSection(reader io.Reader) (*api.TypeSection, error) {
+	types, err := readVector(reader, ReadDefType)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TypeSection{Types: types}, nil
+}
+
+func ReadAliasSection(reader io.Reader) (*api.AliasSection, error) {
+	aliases, err := readVector(reader, ReadAlias)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AliasSection{Aliases: aliases}, nil
+}
+
+func ReadComponentImportSection(reader io.Reader) (*api.ImportSection, error) {
+	imports, err := readVector(reader, ReadComponentImport)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ImportSection{Imports: imports}, nil
+}
+
+func ReadComponentExportSection(reader io.Reader) (*api.ExportSection, error) {
+	exports, err := readVector(reader, ReadComponentExport)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ExportSection{Exports: exports}, nil
+}
+
+func ReadNestedComponentSection(reader io.Reader) (*api.NestedComponentSection, error) {
+	preamble, err := ReadPreamble(reader)
+	if err != nil {
+		return nil, err
+	}
+	if preamble.Version != ComponentVersion || preamble.Layer != ComponentLayer {
+		return nil, fmt.Errorf("nested component has invalid version %d and layer %d", preamble.Version, preamble.Layer)
+	}
+	component, err := ReadComponent(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &api.NestedComponentSection{Component: component}, nil
+}
+
+func ReadCoreInstanceSection(reader io.Reader) (*api.CoreInstanceSection, error) {
+	instances, err := readVector(reader, ReadCoreInstance)
+	if err != nil {
+		return nil, err
+	}
+	return &api.CoreInstanceSection{Instances: instances}, nil
+}
+
+func ReadCoreInstance(reader io.Reader) (api.CoreInstance, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case InstantiateInstanceCode:
+		module, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		args, err := readVector(reader, readCoreInstantiateArg)
+		if err != nil {
+			return nil, err
+		}
+		return &api.CoreInstantiateInstance{Module: module, Args: args}, nil
+	case ExportsInstanceCode:
+		exports, err := readVector(reader, readCoreInlineExport)
+		if err != nil {
+			return nil, err
+		}
+		return &api.CoreExportsInstance{Exports: exports}, nil
+	}
+	return nil, fmt.Errorf("invalid core instance 0x%02x", b)
+}
+
+func readCoreInstantiateArg(reader io.Reader) (api.CoreInstantiateArg, error) {
+	name, err := ReadString(reader)
+	if err != nil {
+		return api.CoreInstantiateArg{}, err
+	}
+	sort, err := readCoreSort(reader)
+	if err != nil {
+		return api.CoreInstantiateArg{}, err
+	}
+	if sort != api.CoreInstanceSort {
+		return api.CoreInstantiateArg{}, fmt.Errorf("core instantiation argument '%s' must be a core instance", name)
+	}
+	index, err := ReadLebU128(reader)
+	if err != nil {
+		return api.CoreInstantiateArg{}, err
+	}
+	return api.CoreInstantiateArg{Name: name, Instance: index}, nil
+}
+
+func readCoreInlineExport(reader io.Reader) (api.CoreInlineExport, error) {
+	name, err := ReadString(reader)
+	if err != nil {
+		return api.CoreInlineExport{}, err
+	}
+	sort, err := readCoreSort(reader)
+	if err != nil {
+		return api.CoreInlineExport{}, err
+	}
+	index, err := ReadLebU128(reader)
+	if err != nil {
+		return api.CoreInlineExport{}, err
+	}
+	return api.CoreInlineExport{Name: name, Sort: sort, Index: index}, nil
+}
+
+// readCoreSort reads a core sort without the 0x00 prefix used in component sorts
+func readCoreSort(reader io.Reader) (api.Sort, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return 0, err
+	}
+	sort, ok := coreSorts[b]
+	if !ok {
+		return 0, fmt.Errorf("invalid core sort 0x%02x", b)
+	}
+	return sort, nil
+}
+
+func ReadInstanceSection(reader io.Reader) (*api.InstanceSection, error) {
+	instances, err := readVector(reader, ReadComponentInstance)
+	if err != nil {
+		return nil, err
+	}
+	return &api.InstanceSection{Instances: instances}, nil
+}
+
+func ReadComponentInstance(reader io.Reader) (api.ComponentInstance, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case InstantiateInstanceCode:
+		component, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		args, err := readVector(reader, readInstantiateArg)
+		if err != nil {
+			return nil, err
+		}
+		return &api.InstantiateInstance{Component: component, Args: args}, nil
+	case ExportsInstanceCode:
+		exports, err := readVector(reader, readInlineExport)
+		if err != nil {
+			return nil, err
+		}
+		return &api.ExportsInstance{Exports: exports}, nil
+	}
+	return nil, fmt.Errorf("invalid instance 0x%02x", b)
+}
+
+func readInstantiateArg(reader io.Reader) (api.InstantiateArg, error) {
+	name, err := ReadString(reader)
+	if err != nil {
+		return api.InstantiateArg{}, err
+	}
+	sort, index, err := readSortIndex(reader)
+	if err != nil {
+		return api.InstantiateArg{}, err
+	}
+	return api.InstantiateArg{Name: name, Sort: sort, Index: index}, nil
+}
+
+func readInlineExport(reader io.Reader) (api.InlineExport, error) {
+	name, err := ReadExternName(reader)
+	if err != nil {
+		return api.InlineExport{}, err
+	}
+	sort, index, err := readSortIndex(reader)
+	if err != nil {
+		return api.InlineExport{}, err
+	}
+	return api.InlineExport{Name: name, Sort: sort, Index: index}, nil
+}
+
+func readSortIndex(reader io.Reader) (api.Sort, uint32, error) {
+	sort, err := ReadSort(reader)
+	if err != nil {
+		return 0, 0, err
+	}
+	index, err := ReadLebU128(reader)
+	return sort, index, err
+}
+
+func ReadCanonSection(reader io.Reader) (*api.CanonSection, error) {
+	funcs, err := readVector(reader, ReadCanonicalFunction)
+	if err != nil {
+		return nil, err
+	}
+	return &api.CanonSection{Funcs: funcs}, nil
+}
+
+func ReadCanonicalFunction(reader io.Reader) (api.CanonicalFunction, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case CanonLiftCode:
+		if _, err := expectByte(reader, 0x00); err != nil {
+			return nil, err
+		}
+		coreFunc, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		options, err := readVector(reader, ReadCanonOption)
+		if err != nil {
+			return nil, err
+		}
+		ty, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &api.CanonLift{CoreFunc: coreFunc, Options: options, Type: ty}, nil
+	case CanonLowerCode:
+		if _, err := expectByte(reader, 0x00); err != nil {
+			return nil, err
+		}
+		f, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		options, err := readVector(reader, ReadCanonOption)
+		if err != nil {
+			return nil, err
+		}
+		return &api.CanonLower{Func: f, Options: options}, nil
+	case CanonResourceNewCode:
+		resource, err := ReadLebU128(reader)
+		return &api.CanonResourceNew{Resource: resource}, err
+	case CanonResourceDropCode:
+		resource, err := ReadLebU128(reader)
+		return &api.CanonResourceDrop{Resource: resource}, err
+	case CanonResourceRepCode:
+		resource, err := ReadLebU128(reader)
+		return &api.CanonResourceRep{Resource: resource}, err
+	}
+	return nil, fmt.Errorf("invalid canonical function 0x%02x", b)
+}
+
+func ReadCanonOption(reader io.Reader) (api.CanonOption, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	if encoding, ok := stringEncodings[b]; ok {
+		return encoding, nil
+	}
+	switch b {
+	case MemoryOptionCode:
+		memory, err := ReadLebU128(reader)
+		return &api.MemoryOption{Memory: memory}, err
+	case ReallocOptionCode:
+		f, err := ReadLebU128(reader)
+		return &api.ReallocOption{Func: f}, err
+	case PostReturnOptionCode:
+		f, err := ReadLebU128(reader)
+		return &api.PostReturnOption{Func: f}, err
+	}
+	return nil, fmt.Errorf("invalid canonical option 0x%02x", b)
+}
+
+func ReadComponentImport(reader io.Reader) (api.ComponentImport, error) {
+	name, err := ReadExternName(reader)
+	if err != nil {
+		return api.ComponentImport{}, err
+	}
+	desc, err := ReadExternDesc(reader)
+	if err != nil {
+		return api.ComponentImport{}, err
+	}
+	return api.ComponentImport{Name: name, Desc: desc}, nil
+}
+
+func ReadComponentExport(reader io.Reader) (api.ComponentExport, error) {
+	var zero api.ComponentExport
+	name, err := ReadExternName(reader)
+	if err != nil {
+		return zero, err
+	}
+	sort, err := ReadSort(reader)
+	if err != nil {
+		return zero, err
+	}
+	index, err := ReadLebU128(reader)
+	if err != nil {
+		return zero, err
+	}
+	export := api.ComponentExport{
+		Name:  name,
+		Sort:  sort,
+		Index: index,
+	}
+	present, err := readOptional(reader)
+	if err != nil {
+		return zero, err
+	}
+	if present {
+		export.Desc, err = ReadExternDesc(reader)
+		if err != nil {
+			return zero, err
+		}
+	}
+	return export, nil
+}
+
+// ReadExternName reads an importname' or exportname'
+func ReadExternName(reader io.Reader) (string, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return "", err
+	}
+	name, err := ReadString(reader)
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case 0x00:
+	case 0x01:
+		// the version suffix is informational
+		if _, err := ReadString(reader); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("invalid extern name prefix 0x%02x", b)
+	}
+	return name, nil
+}
+
+func ReadSort(reader io.Reader) (api.Sort, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return 0, err
+	}
+	if b == 0x00 {
+		b, err = ReadByte(reader)
+		if err != nil {
+			return 0, err
+		}
+		sort, ok := coreSorts[b]
+		if !ok {
+			return 0, fmt.Errorf("invalid core sort 0x%02x", b)
+		}
+		return sort, nil
+	}
+	sort, ok := sorts[b]
+	if !ok {
+		return 0, fmt.Errorf("invalid sort 0x%02x", b)
+	}
+	return sort, nil
+}
+
+func ReadAlias(reader io.Reader) (api.Alias, error) {
+	sort, err := ReadSort(reader)
+	if err != nil {
+		return api.Alias{}, err
+	}
+	b, err := ReadByte(reader)
+	if err != nil {
+		return api.Alias{}, err
+	}
+	alias := api.Alias{Sort: sort}
+	switch b {
+	case ExportAliasCode, CoreExportAliasCode:
+		instance, err := ReadLebU128(reader)
+		if err != nil {
+			return api.Alias{}, err
+		}
+		name, err := ReadString(reader)
+		if err != nil {
+			return api.Alias{}, err
+		}
+		if b == ExportAliasCode {
+			alias.Target = &api.ExportAlias{Instance: instance, Name: name}
+		} else {
+			alias.Target = &api.CoreExportAlias{Instance: instance, Name: name}
+		}
+	case OuterAliasCode:
+		count, err := ReadLebU128(reader)
+		if err != nil {
+			return api.Alias{}, err
+		}
+		index, err := ReadLebU128(reader)
+		if err != nil {
+			return api.Alias{}, err
+		}
+		alias.Target = &api.OuterAlias{Count: count, Index: index}
+	default:
+		return api.Alias{}, fmt.Errorf("invalid alias target 0x%02x", b)
+	}
+	return alias, nil
+}
+
+func ReadExternDesc(reader io.Reader) (api.ExternDesc, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case CoreModuleExternDescCode:
+		if _, err := expectByte(reader, 0x11); err != nil {
+			return nil, err
+		}
+		index, err := ReadLebU128(reader)
+		return &api.CoreModuleExternDesc{Type: index}, err
+	case FuncExternDescCode:
+		index, err := ReadLebU128(reader)
+		return &api.FuncExternDesc{Type: index}, err
+	case ValueExternDescCode:
+		bound, err := ReadByte(reader)
+		if err != nil {
+			return nil, err
+		}
+		if bound != 0x01 {
+			return nil, fmt.Errorf("unsupported value bound 0x%02x", bound)
+		}
+		t, err := ReadComponentValType(reader)
+		return &api.ValueExternDesc{Type: t}, err
+	case TypeExternDescCode:
+		bound, err := ReadByte(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch bound {
+		case 0x00:
+			index, err := ReadLebU128(reader)
+			return &api.TypeExternDesc{Bound: &api.EqBound{Type: index}}, err
+		case 0x01:
+			return &api.TypeExternDesc{Bound: &api.SubResourceBound{}}, nil
+		}
+		return nil, fmt.Errorf("invalid type bound 0x%02x", bound)
+	case ComponentExternDescCode:
+		index, err := ReadLebU128(reader)
+		return &api.ComponentExternDesc{Type: index}, err
+	case InstanceExternDescCode:
+		index, err := ReadLebU128(reader)
+		return &api.InstanceExternDesc{Type: index}, err
+	}
+	return nil, fmt.Errorf("invalid extern desc 0x%02x", b)
+}
+
+func ReadDefType(reader io.Reader) (api.DefType, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	if prim, ok := primValTypes[b]; ok {
+		return prim, nil
+	}
+	switch b {
+	case RecordTypeCode:
+		fields, err := readVector(reader, readLabelValType)
+		return &api.RecordType{Fields: fields}, err
+	case VariantTypeCode:
+		cases, err := readVector(reader, readVariantCase)
+		return &api.VariantType{Cases: cases}, err
+	case ListTypeCode:
+		element, err := ReadComponentValType(reader)
+		return &api.ListType{Element: element}, err
+	case TupleTypeCode:
+		types, err := readVector(reader, ReadComponentValType)
+		return &api.TupleType{Types: types}, err
+	case FlagsTypeCode:
+		labels, err := readVector(reader, ReadString)
+		return &api.FlagsType{Labels: labels}, err
+	case EnumTypeCode:
+		labels, err := readVector(reader, ReadString)
+		return &api.EnumType{Labels: labels}, err
+	case OptionTypeCode:
+		t, err := ReadComponentValType(reader)
+		return &api.OptionType{Type: t}, err
+	case ResultTypeCode:
+		ok, err := readOptionalValType(reader)
+		if err != nil {
+			return nil, err
+		}
+		e, err := readOptionalValType(reader)
+		return &api.ResultValType{Ok: ok, Error: e}, err
+	case OwnTypeCode:
+		index, err := ReadLebU128(reader)
+		return &api.OwnType{Type: index}, err
+	case BorrowTypeCode:
+		index, err := ReadLebU128(reader)
+		return &api.BorrowType{Type: index}, err
+	case StreamTypeCode:
+		element, err := readOptionalValType(reader)
+		return &api.StreamType{Element: element}, err
+	case FutureTypeCode:
+		element, err := readOptionalValType(reader)
+		return &api.FutureType{Element: element}, err
+	case FuncTypeCode:
+		return readComponentFuncType(reader)
+	case ComponentTypeCode:
+		declarations, err := readVector(reader, ReadDeclaration)
+		return &api.ComponentType{Declarations: declarations}, err
+	case InstanceTypeCode:
+		declarations, err := readVector(reader, ReadDeclaration)
+		if err != nil {
+			return nil, err
+		}
+		for _, declaration := range declarations {
+			if _, ok := declaration.(*api.ImportDeclaration); ok {
+				return nil, fmt.Errorf("import declarations are not allowed in instance types")
+			}
+		}
+		return &api.InstanceType{Declarations: declarations}, nil
+	case ResourceTypeCode:
+		return readResourceType(reader)
+	}
+	return nil, fmt.Errorf("invalid type 0x%02x", b)
+}
+
+func readComponentFuncType(reader io.Reader) (*api.ComponentFuncType, error) {
+	params, err := readVector(reader, readLabelValType)
+	if err != nil {
+		return nil, err
+	}
+	funcType := &api.ComponentFuncType{Params: params}
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case 0x00:
+		funcType.Result, err = ReadComponentValType(reader)
+	case 0x01:
+		funcType.NamedResults, err = readVector(reader, readLabelValType)
+	default:
+		return nil, fmt.Errorf("invalid result list 0x%02x", b)
+	}
+	return funcType, err
+}
+
+func readResourceType(reader io.Reader) (*api.ResourceType, error) {
+	if _, err := expectByte(reader, byte(I32)); err != nil {
+		return nil, err
+	}
+	resourceType := &api.ResourceType{Rep: api.I32Type}
+	present, err := readOptional(reader)
+	if err != nil {
+		return nil, err
+	}
+	if present {
+		dtor, err := ReadLebU128(reader)
+		if err != nil {
+			return nil, err
+		}
+		resourceType.Dtor = &dtor
+	}
+	return resourceType, nil
+}
+
+func ReadDeclaration(reader io.Reader) (api.Declaration, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case TypeDeclarationCode:
+		t, err := ReadDefType(reader)
+		return &api.TypeDeclaration{Type: t}, err
+	case AliasDeclarationCode:
+		alias, err := ReadAlias(reader)
+		return &api.AliasDeclaration{Alias: alias}, err
+	case ImportDeclarationCode:
+		name, err := ReadExternName(reader)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := ReadExternDesc(reader)
+		return &api.ImportDeclaration{Name: name, Desc: desc}, err
+	case ExportDeclarationCode:
+		name, err := ReadExternName(reader)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := ReadExternDesc(reader)
+		return &api.ExportDeclaration{Name: name, Desc: desc}, err
+	case CoreTypeDeclarationCode:
+		return nil, fmt.Errorf("core type declarations are not supported")
+	}
+	return nil, fmt.Errorf("invalid declaration 0x%02x", b)
+}
+
+// ReadComponentValType reads a primitive value type or a type index. Type indices are encoded as non negative s33.
+func ReadComponentValType(reader io.Reader) (api.ComponentValType, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return nil, err
+	}
+	if prim, ok := primValTypes[b]; ok {
+		return prim, nil
+	}
+	index, err := readS33(b, reader)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index > int64(^uint32(0)) {
+		return nil, fmt.Errorf("invalid type index %d", index)
+	}
+	return api.TypeIndexValType(index), nil
+}
+
+func readOptionalValType(reader io.Reader) (api.ComponentValType, error) {
+	present, err := readOptional(reader)
+	if err != nil || !present {
+		return nil, err
+	}
+	return ReadComponentValType(reader)
+}
+
+func readLabelValType(reader io.Reader) (api.LabelValType, error) {
+	label, err := ReadString(reader)
+	if err != nil {
+		return api.LabelValType{}, err
+	}
+	t, err := ReadComponentValType(reader)
+	if err != nil {
+		return api.LabelValType{}, err
+	}
+	return api.LabelValType{Label: label, Type: t}, nil
+}
+
+func readVariantCase(reader io.Reader) (api.VariantCase, error) {
+	label, err := ReadString(reader)
+	if err != nil {
+		return api.VariantCase{}, err
+	}
+	t, err := readOptionalValType(reader)
+	if err != nil {
+		return api.VariantCase{}, err
+	}
+	// older encodings allowed a refines index
+	refines, err := readOptional(reader)
+	if err != nil {
+		return api.VariantCase{}, err
+	}
+	if refines {
+		if _, err := ReadLebU128(reader); err != nil {
+			return api.VariantCase{}, err
+		}
+	}
+	return api.VariantCase{Label: label, Type: t}, nil
+}
+
+func readOptional(reader io.Reader) (bool, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0x00:
+		return false, nil
+	case 0x01:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid optional flag 0x%02x", b)
+}
+
+func readVector[T any](reader io.Reader, read func(io.Reader) (T, error)) ([]T, error) {
+	count, err := ReadLebU128(reader)
+	if err != nil {
+		return nil, err
+	}
+	var items []T
+	for i := uint32(0); i < count; i++ {
+		item, err := read(reader)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func expectByte(reader io.Reader, expected byte) (byte, error) {
+	b, err := ReadByte(reader)
+	if err != nil {
+		return 0, err
+	}
+	if b != expected {
+		return 0, fmt.Errorf("expected byte 0x%02x but found 0x%02x", expected, b)
+	}
+	return b, nil
+}
+
+// readS33 decodes a signed 33 bit leb128 value where first is the already consumed first byte
+func readS33(first byte, reader io.Reader) (int64, error) {
+	var value int64
+	var shift uint
+	b := first
+	for {
+		value |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+		if shift >= 35 {
+			return 0, fmt.Errorf("integer representation too long")
+		}
+		var err error
+		b, err = ReadByte(reader)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		value |= -1 << shift
+	}
+	return value, nil
+}
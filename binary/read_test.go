@@ -114,6 +114,41 @@ func TestRead(t *testing.T) {
 				Directive: &api.Component{},
 			},
 		},
+		{
+			name: "component_bool",
+			path: "../fixtures/component/bool.wasm",
+			document: &api.Document{
+				Preamble: api.Preamble{
+					Version: binary.ComponentVersion,
+					Layer:   binary.ComponentLayer,
+				},
+				Directive: &api.Component{
+					Sections: []api.ComponentSection{
+						&api.TypeSection{
+							Types: []api.DefType{api.BoolType},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "component_name",
+			path: "../fixtures/component/name.wasm",
+			document: &api.Document{
+				Preamble: api.Preamble{
+					Version: binary.ComponentVersion,
+					Layer:   binary.ComponentLayer,
+				},
+				Directive: &api.Component{
+					Sections: []api.ComponentSection{
+						&api.CustomSection{
+							Name: "component-name",
+							Data: []byte{0x00, 0x02, 0x01, 0x43},
+						},
+					},
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -0,0 +1,434 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/leb128"
+	"github.com/patrickhuber/go-wasm/opcode"
+)
+
+func Write(writer io.Writer, document *api.Document) error {
+	err := WritePreamble(writer, document.Preamble)
+	if err != nil {
+		return err
+	}
+	switch d := document.Directive.(type) {
+	case *api.Module:
+		return WriteModule(writer, d)
+	case *api.Component:
+		return WriteComponent(writer, d)
+	}
+	return fmt.Errorf("invalid directive %T", document.Directive)
+}
+
+func WritePreamble(writer io.Writer, preamble api.Preamble) error {
+	if _, err := writer.Write(Magic); err != nil {
+		return err
+	}
+	if err := WriteUInt16(writer, preamble.Version); err != nil {
+		return err
+	}
+	return WriteUInt16(writer, preamble.Layer)
+}
+
+// WriteModule writes the sections of the module that are supported by ReadModule
+func WriteModule(writer io.Writer, module *api.Module) error {
+	if len(module.Types) > 0 {
+		err := WriteSection(writer, TypeSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Types, WriteType)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Imports) > 0 {
+		err := WriteSection(writer, ImportSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Imports, WriteImport)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Funcs) > 0 {
+		err := WriteSection(writer, FunctionSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Funcs, func(w io.Writer, f *api.Func) error {
+				return WriteLebU128(w, uint32(f.Type))
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Tables) > 0 {
+		err := WriteSection(writer, TableSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Tables, WriteTable)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Mems) > 0 {
+		err := WriteSection(writer, MemorySectionID, func(w io.Writer) error {
+			return writeVector(w, module.Mems, WriteMem)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Exports) > 0 {
+		err := WriteSection(writer, ExportSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Exports, WriteExport)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Elems) > 0 {
+		err := WriteSection(writer, ElementSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Elems, WriteElem)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(module.Funcs) > 0 {
+		err := WriteSection(writer, CodeSectionID, func(w io.Writer) error {
+			return writeVector(w, module.Funcs, WriteCode)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	named := false
+	for _, custom := range module.Customs {
+		named = named || custom.Name == NameCustomSection
+		err := WriteSection(writer, CustomSectionID, func(w io.Writer) error {
+			if err := WriteString(w, custom.Name); err != nil {
+				return err
+			}
+			_, err := w.Write(custom.Data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// the names of a module without a name section, such as a module decoded from the text format
+	if module.Names != nil && !named {
+		return WriteSection(writer, CustomSectionID, func(w io.Writer) error {
+			if err := WriteString(w, NameCustomSection); err != nil {
+				return err
+			}
+			return WriteNameSection(w, module.Names)
+		})
+	}
+	return nil
+}
+
+// WriteSection writes the section id and size followed by the content produced by write
+func WriteSection(writer io.Writer, id SectionID, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	if err := WriteByte(writer, byte(id)); err != nil {
+		return err
+	}
+	if err := WriteLebU128(writer, uint32(buf.Len())); err != nil {
+		return err
+	}
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+func WriteType(writer io.Writer, funcType *api.FuncType) error {
+	if err := WriteByte(writer, 0x60); err != nil {
+		return err
+	}
+	if err := writeVector(writer, funcType.Parameters.Types, WriteValueType); err != nil {
+		return err
+	}
+	return writeVector(writer, funcType.Returns.Types, WriteValueType)
+}
+
+func WriteValueType(writer io.Writer, valType api.ValType) error {
+	switch valType {
+	case api.I32Type:
+		return WriteByte(writer, byte(I32))
+	case api.I64Type:
+		return WriteByte(writer, byte(I64))
+	case api.F32Type:
+		return WriteByte(writer, byte(F32))
+	case api.F64Type:
+		return WriteByte(writer, byte(F64))
+	}
+	return fmt.Errorf("invalid ValueType %v", valType)
+}
+
+func WriteExport(writer io.Writer, export api.Export) error {
+	if err := WriteString(writer, export.Name); err != nil {
+		return err
+	}
+	switch d := export.Description.(type) {
+	case *api.FuncExportDescription:
+		if err := WriteByte(writer, byte(FuncExportKind)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(d.FuncIdx))
+	case *api.TableExportDescription:
+		if err := WriteByte(writer, byte(TableExportKind)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(d.TableIdx))
+	case *api.MemExportDescription:
+		if err := WriteByte(writer, byte(MemoryExportKind)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(d.MemIdx))
+	case *api.GlobalExportDescription:
+		if err := WriteByte(writer, byte(GlobalExportKind)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(d.GlobalIdx))
+	}
+	return fmt.Errorf("invalid export description %T", export.Description)
+}
+
+func WriteImport(writer io.Writer, imp api.Import) error {
+	if err := WriteString(writer, imp.Module); err != nil {
+		return err
+	}
+	if err := WriteString(writer, imp.Name); err != nil {
+		return err
+	}
+	switch d := imp.Description.(type) {
+	case *api.FuncImportDescription:
+		if err := WriteByte(writer, byte(FuncExportKind)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(d.TypeIdx))
+	case *api.TableImportDescription:
+		if err := WriteByte(writer, byte(TableExportKind)); err != nil {
+			return err
+		}
+		return WriteTable(writer, d.Table)
+	case *api.MemImportDescription:
+		if err := WriteByte(writer, byte(MemoryExportKind)); err != nil {
+			return err
+		}
+		return WriteMem(writer, d.Mem)
+	case *api.GlobalImportDescription:
+		if err := WriteByte(writer, byte(GlobalExportKind)); err != nil {
+			return err
+		}
+		if err := WriteValueType(writer, d.Global.Value); err != nil {
+			return err
+		}
+		return WriteByte(writer, byte(d.Global.Mutable))
+	}
+	return fmt.Errorf("invalid import description %T", imp.Description)
+}
+
+func WriteMem(writer io.Writer, mem api.Mem) error {
+	if !mem.Shared {
+		return WriteLimits(writer, mem.Limits)
+	}
+	if mem.Limits.Max == nil {
+		return fmt.Errorf("shared memory must have a maximum")
+	}
+	max, ok := mem.Limits.Max.Deconstruct()
+	if !ok {
+		return fmt.Errorf("shared memory must have a maximum")
+	}
+	if err := WriteByte(writer, LimitsMinMaxCode|LimitsSharedFlag); err != nil {
+		return err
+	}
+	if err := WriteLebU128(writer, mem.Limits.Min); err != nil {
+		return err
+	}
+	return WriteLebU128(writer, max)
+}
+
+func WriteTable(writer io.Writer, table api.Table) error {
+	switch table.Reference.(type) {
+	case *api.FunctionReference:
+		if err := WriteByte(writer, FuncRefType); err != nil {
+			return err
+		}
+	case *api.ExternalReference:
+		if err := WriteByte(writer, ExternRefType); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid reference type %T", table.Reference)
+	}
+	return WriteLimits(writer, table.Limits)
+}
+
+func WriteLimits(writer io.Writer, limits api.Limits) error {
+	if limits.Max != nil {
+		if max, ok := limits.Max.Deconstruct(); ok {
+			if err := WriteByte(writer, LimitsMinMaxCode); err != nil {
+				return err
+			}
+			if err := WriteLebU128(writer, limits.Min); err != nil {
+				return err
+			}
+			return WriteLebU128(writer, max)
+		}
+	}
+	if err := WriteByte(writer, LimitsMinCode); err != nil {
+		return err
+	}
+	return WriteLebU128(writer, limits.Min)
+}
+
+// WriteElem writes an active element segment, segments for table 0 use the shorter encoding with flags 0
+func WriteElem(writer io.Writer, elem api.Elem) error {
+	flags := uint32(0)
+	if elem.Table != 0 {
+		flags = 2
+	}
+	if err := WriteLebU128(writer, flags); err != nil {
+		return err
+	}
+	if flags == 2 {
+		if err := WriteLebU128(writer, uint32(elem.Table)); err != nil {
+			return err
+		}
+	}
+	if elem.Offset != nil {
+		for _, inst := range elem.Offset.Instructions {
+			if err := WriteInstruction(writer, inst); err != nil {
+				return err
+			}
+		}
+	}
+	if flags == 2 {
+		// element kind funcref
+		if err := WriteByte(writer, 0x00); err != nil {
+			return err
+		}
+	}
+	return writeVector(writer, elem.Init, func(w io.Writer, index api.FuncIndex) error {
+		return WriteLebU128(w, uint32(index))
+	})
+}
+
+func WriteCode(writer io.Writer, f *api.Func) error {
+	if err := f.Load(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := WriteLocals(&buf, f.Locals); err != nil {
+		return err
+	}
+	if f.Body != nil {
+		for _, inst := range f.Body.Instructions {
+			if err := WriteInstruction(&buf, inst); err != nil {
+				return err
+			}
+		}
+	}
+	if err := WriteLebU128(writer, uint32(buf.Len())); err != nil {
+		return err
+	}
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+// WriteLocals writes locals as runs of consecutive locals that share a type
+func WriteLocals(writer io.Writer, locals []api.ValType) error {
+	type run struct {
+		count   uint32
+		valType api.ValType
+	}
+	var runs []run
+	for _, local := range locals {
+		if len(runs) > 0 && runs[len(runs)-1].valType == local {
+			runs[len(runs)-1].count++
+			continue
+		}
+		runs = append(runs, run{1, local})
+	}
+	return writeVector(writer, runs, func(w io.Writer, r run) error {
+		if err := WriteLebU128(w, r.count); err != nil {
+			return err
+		}
+		return WriteValueType(w, r.valType)
+	})
+}
+
+func WriteInstruction(writer io.Writer, instruction api.Instruction) error {
+	switch inst := instruction.(type) {
+	case api.End:
+		return WriteByte(writer, byte(opcode.End))
+	case api.LocalGet:
+		if err := WriteByte(writer, byte(opcode.LocalGet)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(inst.Index))
+	case api.I32Add:
+		return WriteByte(writer, byte(opcode.I32Add))
+	case api.I32Const:
+		if err := WriteByte(writer, byte(opcode.I32Const)); err != nil {
+			return err
+		}
+		var buf [5]byte
+		_, err := writer.Write(leb128.AppendSigned(buf[:0], int64(int32(inst))))
+		return err
+	case *api.Call:
+		if err := WriteByte(writer, byte(opcode.Call)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(inst.Index))
+	case *api.CallIndirect:
+		if err := WriteByte(writer, byte(opcode.CallIndirect)); err != nil {
+			return err
+		}
+		if err := WriteLebU128(writer, uint32(inst.Type)); err != nil {
+			return err
+		}
+		return WriteLebU128(writer, uint32(inst.Table))
+	}
+	return fmt.Errorf("invalid instruction %T", instruction)
+}
+
+func WriteString(writer io.Writer, value string) error {
+	if err := WriteLebU128(writer, uint32(len(value))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(writer, value)
+	return err
+}
+
+func WriteUInt16(writer io.Writer, value uint16) error {
+	return binary.Write(writer, binary.LittleEndian, value)
+}
+
+func WriteByte(writer io.Writer, value byte) error {
+	_, err := writer.Write([]byte{value})
+	return err
+}
+
+func WriteLebU128(writer io.Writer, value uint32) error {
+	var buf [5]byte
+	_, err := writer.Write(leb128.AppendUnsigned(buf[:0], uint64(value)))
+	return err
+}
+
+func writeVector[T any](writer io.Writer, items []T, write func(io.Writer, T) error) error {
+	if err := WriteLebU128(writer, uint32(len(items))); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := write(writer, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
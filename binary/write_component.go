@@ -0,0 +1,529 @@
+package binary
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/patrickhuber/go-wasm/api"
+)
+
+func WriteComponent(writer io.Writer, component *api.Component) error {
+	for _, section := range component.Sections {
+		if err := WriteComponentSection(writer, section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteComponentSection(writer io.Writer, section api.ComponentSection) error {
+	switch s := section.(type) {
+	case *api.CustomSection:
+		return WriteSection(writer, ComponentCustomSectionID, func(w io.Writer) error {
+			if err := WriteString(w, s.Name); err != nil {
+				return err
+			}
+			_, err := w.Write(s.Data)
+			return err
+		})
+	case *api.RawSection:
+		return WriteSection(writer, SectionID(s.ID), func(w io.Writer) error {
+			_, err := w.Write(s.Data)
+			return err
+		})
+	case *api.TypeSection:
+		return WriteSection(writer, ComponentTypeSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Types, WriteDefType)
+		})
+	case *api.AliasSection:
+		return WriteSection(writer, ComponentAliasSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Aliases, WriteAlias)
+		})
+	case *api.ImportSection:
+		return WriteSection(writer, ComponentImportSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Imports, WriteComponentImport)
+		})
+	case *api.ExportSection:
+		return WriteSection(writer, ComponentExportSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Exports, WriteComponentExport)
+		})
+	case *api.NestedComponentSection:
+		return WriteSection(writer, ComponentComponentSectionID, func(w io.Writer) error {
+			err := WritePreamble(w, api.Preamble{Version: ComponentVersion, Layer: ComponentLayer})
+			if err != nil {
+				return err
+			}
+			return WriteComponent(w, s.Component)
+		})
+	case *api.CoreModuleSection:
+		return WriteSection(writer, ComponentCoreModuleSectionID, func(w io.Writer) error {
+			err := WritePreamble(w, api.Preamble{Version: ModuleVersion})
+			if err != nil {
+				return err
+			}
+			return WriteModule(w, s.Module)
+		})
+	case *api.CoreInstanceSection:
+		return WriteSection(writer, ComponentCoreInstanceSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Instances, WriteCoreInstance)
+		})
+	case *api.InstanceSection:
+		return WriteSection(writer, ComponentInstanceSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Instances, WriteComponentInstance)
+		})
+	case *api.CanonSection:
+		return WriteSection(writer, ComponentCanonSectionID, func(w io.Writer) error {
+			return writeVector(w, s.Funcs, WriteCanonicalFunction)
+		})
+	}
+	return fmt.Errorf("invalid component section %T", section)
+}
+
+func WriteComponentInstance(writer io.Writer, instance api.ComponentInstance) error {
+	switch i := instance.(type) {
+	case *api.InstantiateInstance:
+		return writeBytesThen(writer, []byte{InstantiateInstanceCode}, func() error {
+			if err := WriteLebU128(writer, i.Component); err != nil {
+				return err
+			}
+			return writeVector(writer, i.Args, writeInstantiateArg)
+		})
+	case *api.ExportsInstance:
+		return writeBytesThen(writer, []byte{ExportsInstanceCode}, func() error {
+			return writeVector(writer, i.Exports, writeInlineExport)
+		})
+	}
+	return fmt.Errorf("invalid instance %T", instance)
+}
+
+func WriteCoreInstance(writer io.Writer, instance api.CoreInstance) error {
+	switch i := instance.(type) {
+	case *api.CoreInstantiateInstance:
+		return writeBytesThen(writer, []byte{InstantiateInstanceCode}, func() error {
+			if err := WriteLebU128(writer, i.Module); err != nil {
+				return err
+			}
+			return writeVector(writer, i.Args, writeCoreInstantiateArg)
+		})
+	case *api.CoreExportsInstance:
+		return writeBytesThen(writer, []byte{ExportsInstanceCode}, func() error {
+			return writeVector(writer, i.Exports, writeCoreInlineExport)
+		})
+	}
+	return fmt.Errorf("invalid core instance %T", instance)
+}
+
+func writeCoreInstantiateArg(writer io.Writer, arg api.CoreInstantiateArg) error {
+	if err := WriteString(writer, arg.Name); err != nil {
+		return err
+	}
+	if err := writeCoreSort(writer, api.CoreInstanceSort); err != nil {
+		return err
+	}
+	return WriteLebU128(writer, arg.Instance)
+}
+
+func writeCoreInlineExport(writer io.Writer, export api.CoreInlineExport) error {
+	if err := WriteString(writer, export.Name); err != nil {
+		return err
+	}
+	if err := writeCoreSort(writer, export.Sort); err != nil {
+		return err
+	}
+	return WriteLebU128(writer, export.Index)
+}
+
+// writeCoreSort writes a core sort without the 0x00 prefix used in component sorts
+func writeCoreSort(writer io.Writer, sort api.Sort) error {
+	b, ok := coreSortCodes[sort]
+	if !ok {
+		return fmt.Errorf("invalid core sort %d", sort)
+	}
+	return WriteByte(writer, b)
+}
+
+func writeInstantiateArg(writer io.Writer, arg api.InstantiateArg) error {
+	if err := WriteString(writer, arg.Name); err != nil {
+		return err
+	}
+	return writeSortIndex(writer, arg.Sort, arg.Index)
+}
+
+func writeInlineExport(writer io.Writer, export api.InlineExport) error {
+	if err := WriteExternName(writer, export.Name); err != nil {
+		return err
+	}
+	return writeSortIndex(writer, export.Sort, export.Index)
+}
+
+func writeSortIndex(writer io.Writer, sort api.Sort, index uint32) error {
+	if err := WriteSort(writer, sort); err != nil {
+		return err
+	}
+	return WriteLebU128(writer, index)
+}
+
+func WriteCanonicalFunction(writer io.Writer, function api.CanonicalFunction) error {
+	switch f := function.(type) {
+	case *api.CanonLift:
+		return writeBytesThen(writer, []byte{CanonLiftCode, 0x00}, func() error {
+			if err := WriteLebU128(writer, f.CoreFunc); err != nil {
+				return err
+			}
+			if err := writeVector(writer, f.Options, WriteCanonOption); err != nil {
+				return err
+			}
+			return WriteLebU128(writer, f.Type)
+		})
+	case *api.CanonLower:
+		return writeBytesThen(writer, []byte{CanonLowerCode, 0x00}, func() error {
+			if err := WriteLebU128(writer, f.Func); err != nil {
+				return err
+			}
+			return writeVector(writer, f.Options, WriteCanonOption)
+		})
+	case *api.CanonResourceNew:
+		return writeBytesThen(writer, []byte{CanonResourceNewCode}, func() error {
+			return WriteLebU128(writer, f.Resource)
+		})
+	case *api.CanonResourceDrop:
+		return writeBytesThen(writer, []byte{CanonResourceDropCode}, func() error {
+			return WriteLebU128(writer, f.Resource)
+		})
+	case *api.CanonResourceRep:
+		return writeBytesThen(writer, []byte{CanonResourceRepCode}, func() error {
+			return WriteLebU128(writer, f.Resource)
+		})
+	}
+	return fmt.Errorf("invalid canonical function %T", function)
+}
+
+func WriteCanonOption(writer io.Writer, option api.CanonOption) error {
+	switch o := option.(type) {
+	case api.StringEncodingOption:
+		b, ok := stringEncodingCodes[o]
+		if !ok {
+			return fmt.Errorf("invalid string encoding %d", o)
+		}
+		return WriteByte(writer, b)
+	case *api.MemoryOption:
+		return writeBytesThen(writer, []byte{MemoryOptionCode}, func() error {
+			return WriteLebU128(writer, o.Memory)
+		})
+	case *api.ReallocOption:
+		return writeBytesThen(writer, []byte{ReallocOptionCode}, func() error {
+			return WriteLebU128(writer, o.Func)
+		})
+	case *api.PostReturnOption:
+		return writeBytesThen(writer, []byte{PostReturnOptionCode}, func() error {
+			return WriteLebU128(writer, o.Func)
+		})
+	}
+	return fmt.Errorf("invalid canonical option %T", option)
+}
+
+func WriteComponentImport(writer io.Writer, imp api.ComponentImport) error {
+	if err := WriteExternName(writer, imp.Name); err != nil {
+		return err
+	}
+	return WriteExternDesc(writer, imp.Desc)
+}
+
+func WriteComponentExport(writer io.Writer, export api.ComponentExport) error {
+	if err := WriteExternName(writer, export.Name); err != nil {
+		return err
+	}
+	if err := WriteSort(writer, export.Sort); err != nil {
+		return err
+	}
+	if err := WriteLebU128(writer, export.Index); err != nil {
+		return err
+	}
+	if export.Desc == nil {
+		return WriteByte(writer, 0x00)
+	}
+	if err := WriteByte(writer, 0x01); err != nil {
+		return err
+	}
+	return WriteExternDesc(writer, export.Desc)
+}
+
+func WriteExternName(writer io.Writer, name string) error {
+	if err := WriteByte(writer, 0x00); err != nil {
+		return err
+	}
+	return WriteString(writer, name)
+}
+
+func WriteSort(writer io.Writer, sort api.Sort) error {
+	if b, ok := sortCodes[sort]; ok {
+		return WriteByte(writer, b)
+	}
+	b, ok := coreSortCodes[sort]
+	if !ok {
+		return fmt.Errorf("invalid sort %d", sort)
+	}
+	if err := WriteByte(writer, 0x00); err != nil {
+		return err
+	}
+	return WriteByte(writer, b)
+}
+
+func WriteAlias(writer io.Writer, alias api.Alias) error {
+	if err := WriteSort(writer, alias.Sort); err != nil {
+		return err
+	}
+	switch t := alias.Target.(type) {
+	case *api.ExportAlias:
+		return writeBytesThen(writer, []byte{ExportAliasCode}, func() error {
+			if err := WriteLebU128(writer, t.Instance); err != nil {
+				return err
+			}
+			return WriteString(writer, t.Name)
+		})
+	case *api.CoreExportAlias:
+		return writeBytesThen(writer, []byte{CoreExportAliasCode}, func() error {
+			if err := WriteLebU128(writer, t.Instance); err != nil {
+				return err
+			}
+			return WriteString(writer, t.Name)
+		})
+	case *api.OuterAlias:
+		return writeBytesThen(writer, []byte{OuterAliasCode}, func() error {
+			if err := WriteLebU128(writer, t.Count); err != nil {
+				return err
+			}
+			return WriteLebU128(writer, t.Index)
+		})
+	}
+	return fmt.Errorf("invalid alias target %T", alias.Target)
+}
+
+func WriteExternDesc(writer io.Writer, desc api.ExternDesc) error {
+	switch d := desc.(type) {
+	case *api.CoreModuleExternDesc:
+		return writeBytesThen(writer, []byte{CoreModuleExternDescCode, 0x11}, func() error {
+			return WriteLebU128(writer, d.Type)
+		})
+	case *api.FuncExternDesc:
+		return writeBytesThen(writer, []byte{FuncExternDescCode}, func() error {
+			return WriteLebU128(writer, d.Type)
+		})
+	case *api.ValueExternDesc:
+		return writeBytesThen(writer, []byte{ValueExternDescCode, 0x01}, func() error {
+			return WriteComponentValType(writer, d.Type)
+		})
+	case *api.TypeExternDesc:
+		switch b := d.Bound.(type) {
+		case *api.EqBound:
+			return writeBytesThen(writer, []byte{TypeExternDescCode, 0x00}, func() error {
+				return WriteLebU128(writer, b.Type)
+			})
+		case *api.SubResourceBound:
+			_, err := writer.Write([]byte{TypeExternDescCode, 0x01})
+			return err
+		}
+		return fmt.Errorf("invalid type bound %T", d.Bound)
+	case *api.ComponentExternDesc:
+		return writeBytesThen(writer, []byte{ComponentExternDescCode}, func() error {
+			return WriteLebU128(writer, d.Type)
+		})
+	case *api.InstanceExternDesc:
+		return writeBytesThen(writer, []byte{InstanceExternDescCode}, func() error {
+			return WriteLebU128(writer, d.Type)
+		})
+	}
+	return fmt.Errorf("invalid extern desc %T", desc)
+}
+
+func WriteDefType(writer io.Writer, defType api.DefType) error {
+	switch t := defType.(type) {
+	case api.PrimValType:
+		return WriteComponentValType(writer, t)
+	case *api.RecordType:
+		return writeBytesThen(writer, []byte{RecordTypeCode}, func() error {
+			return writeVector(writer, t.Fields, writeLabelValType)
+		})
+	case *api.VariantType:
+		return writeBytesThen(writer, []byte{VariantTypeCode}, func() error {
+			return writeVector(writer, t.Cases, writeVariantCase)
+		})
+	case *api.ListType:
+		return writeBytesThen(writer, []byte{ListTypeCode}, func() error {
+			return WriteComponentValType(writer, t.Element)
+		})
+	case *api.TupleType:
+		return writeBytesThen(writer, []byte{TupleTypeCode}, func() error {
+			return writeVector(writer, t.Types, WriteComponentValType)
+		})
+	case *api.FlagsType:
+		return writeBytesThen(writer, []byte{FlagsTypeCode}, func() error {
+			return writeVector(writer, t.Labels, WriteString)
+		})
+	case *api.EnumType:
+		return writeBytesThen(writer, []byte{EnumTypeCode}, func() error {
+			return writeVector(writer, t.Labels, WriteString)
+		})
+	case *api.OptionType:
+		return writeBytesThen(writer, []byte{OptionTypeCode}, func() error {
+			return WriteComponentValType(writer, t.Type)
+		})
+	case *api.ResultValType:
+		return writeBytesThen(writer, []byte{ResultTypeCode}, func() error {
+			if err := writeOptionalValType(writer, t.Ok); err != nil {
+				return err
+			}
+			return writeOptionalValType(writer, t.Error)
+		})
+	case *api.OwnType:
+		return writeBytesThen(writer, []byte{OwnTypeCode}, func() error {
+			return WriteLebU128(writer, t.Type)
+		})
+	case *api.BorrowType:
+		return writeBytesThen(writer, []byte{BorrowTypeCode}, func() error {
+			return WriteLebU128(writer, t.Type)
+		})
+	case *api.StreamType:
+		return writeBytesThen(writer, []byte{StreamTypeCode}, func() error {
+			return writeOptionalValType(writer, t.Element)
+		})
+	case *api.FutureType:
+		return writeBytesThen(writer, []byte{FutureTypeCode}, func() error {
+			return writeOptionalValType(writer, t.Element)
+		})
+	case *api.ComponentFuncType:
+		return writeBytesThen(writer, []byte{FuncTypeCode}, func() error {
+			if err := writeVector(writer, t.Params, writeLabelValType); err != nil {
+				return err
+			}
+			if t.Result != nil {
+				if err := WriteByte(writer, 0x00); err != nil {
+					return err
+				}
+				return WriteComponentValType(writer, t.Result)
+			}
+			if err := WriteByte(writer, 0x01); err != nil {
+				return err
+			}
+			return writeVector(writer, t.NamedResults, writeLabelValType)
+		})
+	case *api.ComponentType:
+		return writeBytesThen(writer, []byte{ComponentTypeCode}, func() error {
+			return writeVector(writer, t.Declarations, WriteDeclaration)
+		})
+	case *api.InstanceType:
+		return writeBytesThen(writer, []byte{InstanceTypeCode}, func() error {
+			for _, declaration := range t.Declarations {
+				if _, ok := declaration.(*api.ImportDeclaration); ok {
+					return fmt.Errorf("import declarations are not allowed in instance types")
+				}
+			}
+			return writeVector(writer, t.Declarations, WriteDeclaration)
+		})
+	case *api.ResourceType:
+		return writeBytesThen(writer, []byte{ResourceTypeCode, byte(I32)}, func() error {
+			if t.Dtor == nil {
+				return WriteByte(writer, 0x00)
+			}
+			if err := WriteByte(writer, 0x01); err != nil {
+				return err
+			}
+			return WriteLebU128(writer, *t.Dtor)
+		})
+	}
+	return fmt.Errorf("invalid type %T", defType)
+}
+
+func WriteDeclaration(writer io.Writer, declaration api.Declaration) error {
+	switch d := declaration.(type) {
+	case *api.TypeDeclaration:
+		return writeBytesThen(writer, []byte{TypeDeclarationCode}, func() error {
+			return WriteDefType(writer, d.Type)
+		})
+	case *api.AliasDeclaration:
+		return writeBytesThen(writer, []byte{AliasDeclarationCode}, func() error {
+			return WriteAlias(writer, d.Alias)
+		})
+	case *api.ImportDeclaration:
+		return writeBytesThen(writer, []byte{ImportDeclarationCode}, func() error {
+			if err := WriteExternName(writer, d.Name); err != nil {
+				return err
+			}
+			return WriteExternDesc(writer, d.Desc)
+		})
+	case *api.ExportDeclaration:
+		return writeBytesThen(writer, []byte{ExportDeclarationCode}, func() error {
+			if err := WriteExternName(writer, d.Name); err != nil {
+				return err
+			}
+			return WriteExternDesc(writer, d.Desc)
+		})
+	}
+	return fmt.Errorf("invalid declaration %T", declaration)
+}
+
+func WriteComponentValType(writer io.Writer, valType api.ComponentValType) error {
+	switch t := valType.(type) {
+	case api.PrimValType:
+		b, ok := primValTypeCodes[t]
+		if !ok {
+			return fmt.Errorf("invalid primitive value type %d", t)
+		}
+		return WriteByte(writer, b)
+	case api.TypeIndexValType:
+		return writeS33(writer, int64(t))
+	}
+	return fmt.Errorf("invalid value type %T", valType)
+}
+
+func writeOptionalValType(writer io.Writer, valType api.ComponentValType) error {
+	if valType == nil {
+		return WriteByte(writer, 0x00)
+	}
+	if err := WriteByte(writer, 0x01); err != nil {
+		return err
+	}
+	return WriteComponentValType(writer, valType)
+}
+
+func writeLabelValType(writer io.Writer, labelValType api.LabelValType) error {
+	if err := WriteString(writer, labelValType.Label); err != nil {
+		return err
+	}
+	return WriteComponentValType(writer, labelValType.Type)
+}
+
+func writeVariantCase(writer io.Writer, c api.VariantCase) error {
+	if err := WriteString(writer, c.Label); err != nil {
+		return err
+	}
+	if err := writeOptionalValType(writer, c.Type); err != nil {
+		return err
+	}
+	return WriteByte(writer, 0x00)
+}
+
+func writeBytesThen(writer io.Writer, prefix []byte, then func() error) error {
+	if _, err := writer.Write(prefix); err != nil {
+		return err
+	}
+	return then()
+}
+
+// writeS33 encodes a signed 33 bit leb128 value
+func writeS33(writer io.Writer, value int64) error {
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		done := (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0)
+		if !done {
+			b |= 0x80
+		}
+		if err := WriteByte(writer, b); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
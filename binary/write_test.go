@@ -0,0 +1,179 @@
+package binary_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"empty", "../fixtures/empty/empty.wasm"},
+		{"func", "../fixtures/func/func.wasm"},
+		{"add", "../fixtures/add/add.wasm"},
+		{"component", "../fixtures/component/empty.wasm"},
+		{"component_bool", "../fixtures/component/bool.wasm"},
+		{"component_name", "../fixtures/component/name.wasm"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := os.ReadFile(test.path)
+			require.NoError(t, err)
+
+			document, err := binary.Read(bytes.NewReader(expected))
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, binary.Write(&buf, document))
+			require.Equal(t, expected, buf.Bytes())
+		})
+	}
+}
+
+func TestComponentRoundTrip(t *testing.T) {
+	dtor := uint32(3)
+	component := &api.Component{
+		Sections: []api.ComponentSection{
+			&api.TypeSection{
+				Types: []api.DefType{
+					&api.RecordType{
+						Fields: []api.LabelValType{
+							{Label: "x", Type: api.U32Type},
+							{Label: "y", Type: api.TypeIndexValType(0)},
+						},
+					},
+					&api.VariantType{
+						Cases: []api.VariantCase{
+							{Label: "a"},
+							{Label: "b", Type: api.StringType},
+						},
+					},
+					&api.ResultValType{Ok: api.U8Type},
+					&api.ComponentFuncType{
+						Params: []api.LabelValType{{Label: "a", Type: api.Float64Type}},
+						Result: api.TypeIndexValType(1),
+					},
+					&api.ComponentFuncType{
+						NamedResults: []api.LabelValType{{Label: "r", Type: api.CharType}},
+					},
+					&api.InstanceType{
+						Declarations: []api.Declaration{
+							&api.TypeDeclaration{Type: &api.ResourceType{Rep: api.I32Type, Dtor: &dtor}},
+							&api.AliasDeclaration{Alias: api.Alias{
+								Sort:   api.TypeSort,
+								Target: &api.OuterAlias{Count: 1, Index: 0},
+							}},
+							&api.ExportDeclaration{
+								Name: "r",
+								Desc: &api.TypeExternDesc{Bound: &api.SubResourceBound{}},
+							},
+							&api.ExportDeclaration{
+								Name: "t",
+								Desc: &api.TypeExternDesc{Bound: &api.EqBound{Type: 1}},
+							},
+						},
+					},
+				},
+			},
+			&api.ImportSection{
+				Imports: []api.ComponentImport{
+					{Name: "a:b/c", Desc: &api.InstanceExternDesc{Type: 5}},
+				},
+			},
+			&api.CoreInstanceSection{
+				Instances: []api.CoreInstance{
+					&api.CoreExportsInstance{
+						Exports: []api.CoreInlineExport{
+							{Name: "memory", Sort: api.CoreMemorySort, Index: 0},
+						},
+					},
+					&api.CoreInstantiateInstance{
+						Module: 0,
+						Args:   []api.CoreInstantiateArg{{Name: "env", Instance: 0}},
+					},
+				},
+			},
+			&api.AliasSection{
+				Aliases: []api.Alias{
+					{Sort: api.TypeSort, Target: &api.ExportAlias{Instance: 0, Name: "t"}},
+					{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 0, Name: "f"}},
+				},
+			},
+			&api.ExportSection{
+				Exports: []api.ComponentExport{
+					{Name: "c", Sort: api.InstanceSort, Index: 0},
+					{Name: "f", Sort: api.FuncSort, Index: 0, Desc: &api.FuncExternDesc{Type: 3}},
+				},
+			},
+		},
+	}
+	document := &api.Document{
+		Preamble: api.Preamble{
+			Version: binary.ComponentVersion,
+			Layer:   binary.ComponentLayer,
+		},
+		Directive: component,
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, document))
+
+	actual, err := binary.Read(&buf)
+	require.NoError(t, err)
+	require.Equal(t, document, actual)
+}
+
+func TestModuleRoundTrip(t *testing.T) {
+	module := &api.Module{
+		Types: []*api.FuncType{
+			{Parameters: api.ResultType{Types: []api.ValType{api.I32Type}}, Returns: api.ResultType{Types: []api.ValType{}}},
+		},
+		Imports: []api.Import{
+			{Module: "env", Name: "log", Description: &api.FuncImportDescription{TypeIdx: 0}},
+			{Module: "env", Name: "memory", Description: &api.MemImportDescription{Mem: api.Mem{Limits: api.Limits{Min: 1, Max: option.Some[uint32](2)}}}},
+			{Module: "env", Name: "sp", Description: &api.GlobalImportDescription{Global: api.Global{Mutable: api.Var, Value: api.I32Type}}},
+			{Module: "env", Name: "table", Description: &api.TableImportDescription{Table: api.Table{
+				Limits: api.Limits{Min: 1, Max: option.None[uint32]()}, Reference: &api.FunctionReference{},
+			}}},
+		},
+		Funcs: []*api.Func{
+			{Type: 0, Locals: []api.ValType{}, Body: &api.Expression{Instructions: []api.Instruction{
+				api.LocalGet{Index: 0},
+				api.I32Const(200),
+				&api.CallIndirect{Table: 1, Type: 0},
+				api.I32Const(0xffffffff),
+				&api.Call{Index: 0},
+				api.End{},
+			}}},
+		},
+		Tables: []api.Table{{Limits: api.Limits{Min: 2, Max: option.Some[uint32](2)}, Reference: &api.FunctionReference{}}},
+		Mems:   []api.Mem{{Limits: api.Limits{Min: 1, Max: option.None[uint32]()}}},
+		Exports: []api.Export{
+			{Name: "memory", Description: &api.MemExportDescription{MemIdx: 1}},
+			{Name: "sp", Description: &api.GlobalExportDescription{GlobalIdx: 0}},
+			{Name: "table", Description: &api.TableExportDescription{TableIdx: 1}},
+		},
+		Elems: []api.Elem{
+			{Table: 0, Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(0), api.End{}}}, Init: []api.FuncIndex{1}},
+			{Table: 1, Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(1), api.End{}}}, Init: []api.FuncIndex{0, 1}},
+		},
+		Customs: []*api.CustomSection{{Name: "component-type", Data: []byte{0x01, 0x02}}},
+	}
+	document := &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, document))
+
+	actual, err := binary.Read(&buf)
+	require.NoError(t, err)
+	require.Equal(t, document, actual)
+}
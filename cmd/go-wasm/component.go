@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+)
+
+// componentWit prints the wit of a component like `wasm-tools component wit`
+func componentWit(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c, err := readComponent(flags, stdin)
+	if err != nil {
+		return err
+	}
+	trees, err := component.Extract(c)
+	if err != nil {
+		return err
+	}
+	return printer.Print(stdout, trees[0], trees[1:]...)
+}
+
+// componentPlug composes a component with the components that satisfy its imports like `wac plug`
+func componentPlug(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var plugs files
+	flags.Var(&plugs, "plug", "a component that satisfies imports of the root component, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(plugs) == 0 {
+		return fmt.Errorf("at least one --plug component is required")
+	}
+	root, err := readComponent(flags, stdin)
+	if err != nil {
+		return err
+	}
+	deps := make([]*api.Component, 0, len(plugs))
+	for _, plug := range plugs {
+		dep, err := readComponentFile(plug)
+		if err != nil {
+			return fmt.Errorf("%s: %w", plug, err)
+		}
+		deps = append(deps, dep)
+	}
+	composed, err := component.Plug(root, deps...)
+	if err != nil {
+		return err
+	}
+	return binary.Write(stdout, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: composed,
+	})
+}
+
+// componentNew wraps a core module with a component-type section in a component like `wasm-tools component new`
+func componentNew(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	var adapts files
+	flags.Var(&adapts, "adapt", "an adapter module as [name=]file, the name defaults to the file name without extension, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	reader, err := input(flags, stdin)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	module, err := decodeModule(reader)
+	if err != nil {
+		return err
+	}
+	adapters := make([]component.Adapter, 0, len(adapts))
+	for _, adapt := range adapts {
+		name, file, ok := strings.Cut(adapt, "=")
+		if !ok {
+			file = adapt
+			name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		adapter, err := readModuleFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		adapters = append(adapters, component.Adapter{Name: name, Module: adapter})
+	}
+	c, err := component.Componentize(module, adapters...)
+	if err != nil {
+		return err
+	}
+	return binary.Write(stdout, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: c,
+	})
+}
+
+// files is a repeatable flag of file names
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func readComponent(flags *flag.FlagSet, stdin io.Reader) (*api.Component, error) {
+	reader, err := input(flags, stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return decodeComponent(reader)
+}
+
+func readComponentFile(name string) (*api.Component, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeComponent(file)
+}
+
+func decodeComponent(reader io.Reader) (*api.Component, error) {
+	document, err := binary.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := document.Directive.(*api.Component)
+	if !ok {
+		return nil, fmt.Errorf("input is a core module, expected a component")
+	}
+	return c, nil
+}
+
+func readModuleFile(name string) (*api.Module, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeModule(file)
+}
+
+func decodeModule(reader io.Reader) (*api.Module, error) {
+	document, err := binary.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := document.Directive.(*api.Module)
+	if !ok {
+		return nil, fmt.Errorf("input is a component, expected a core module")
+	}
+	return m, nil
+}
@@ -0,0 +1,88 @@
+// go-wasm is a command line tool for inspecting and transforming wasm modules and components
+//
+// Usage:
+//
+//	go-wasm component wit [file]
+//	go-wasm component plug --plug dep.wasm [--plug dep.wasm ...] [file]
+//	go-wasm component new [--adapt [name=]adapter.wasm ...] [file]
+//	go-wasm module custom [file]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{
+		name:        "component wit",
+		description: "print the wit world imported and exported by a component",
+		run:         componentWit,
+	},
+	{
+		name:        "component plug",
+		description: "compose a component with components that satisfy its imports",
+		run:         componentPlug,
+	},
+	{
+		name:        "component new",
+		description: "wrap a core module with an embedded world in a component",
+		run:         componentNew,
+	},
+	{
+		name:        "module custom",
+		description: "print the custom sections of a core module with the names, producers and target features decoded",
+		run:         moduleCustom,
+	},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		return cmd.run(flags, args[len(words):], stdin, stdout)
+	}
+	return fmt.Errorf("unknown command '%s'\n%s", strings.Join(args, " "), usage())
+}
+
+func usage() string {
+	var builder strings.Builder
+	builder.WriteString("usage: go-wasm <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&builder, "  %-16s %s\n", cmd.name, cmd.description)
+	}
+	return builder.String()
+}
+
+// input opens the file named by the single positional argument, or stdin when there is no argument or it is `-`
+func input(flags *flag.FlagSet, stdin io.Reader) (io.ReadCloser, error) {
+	switch flags.NArg() {
+	case 0:
+		return io.NopCloser(stdin), nil
+	case 1:
+		if flags.Arg(0) == "-" {
+			return io.NopCloser(stdin), nil
+		}
+		return os.Open(flags.Arg(0))
+	}
+	return nil, fmt.Errorf("expected a single input file, found %d", flags.NArg())
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponentWit(t *testing.T) {
+	source := `package a:b;
+
+interface i {
+  f: func(x: u32) -> string;
+}
+
+world w {
+  export i;
+}
+`
+	tree, err := wit.Parse(source)
+	require.NoError(t, err)
+	encoded, err := component.Encode(tree)
+	require.NoError(t, err)
+
+	var stdin bytes.Buffer
+	err = binary.Write(&stdin, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: encoded,
+	})
+	require.NoError(t, err)
+
+	var stdout bytes.Buffer
+	require.NoError(t, run([]string{"component", "wit", "-"}, &stdin, &stdout))
+	require.Equal(t, source, stdout.String())
+}
+
+func TestComponentWitModule(t *testing.T) {
+	var stdout bytes.Buffer
+	err := run([]string{"component", "wit", "../../fixtures/add/add.wasm"}, nil, &stdout)
+	require.Error(t, err)
+}
+
+func TestComponentPlug(t *testing.T) {
+	double := &api.ComponentFuncType{Params: []api.LabelValType{{Label: "x", Type: api.U32Type}}, Result: api.U32Type}
+	// root imports `a:b/math@1.0.0` and exports its function as run
+	root := &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{&api.InstanceType{Declarations: []api.Declaration{
+			&api.TypeDeclaration{Type: double},
+			&api.ExportDeclaration{Name: "double", Desc: &api.FuncExternDesc{Type: 0}},
+		}}}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "a:b/math@1.0.0", Desc: &api.InstanceExternDesc{Type: 0}}}},
+		&api.AliasSection{Aliases: []api.Alias{{Sort: api.FuncSort, Target: &api.ExportAlias{Instance: 0, Name: "double"}}}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "run", Sort: api.FuncSort, Index: 0}}},
+	}}
+	// dep exports the imported function impl as `a:b/math@1.1.0`
+	dep := &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{double}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "impl", Desc: &api.FuncExternDesc{Type: 0}}}},
+		&api.InstanceSection{Instances: []api.ComponentInstance{
+			&api.ExportsInstance{Exports: []api.InlineExport{{Name: "double", Sort: api.FuncSort, Index: 0}}},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "a:b/math@1.1.0", Sort: api.InstanceSort, Index: 0}}},
+	}}
+
+	var stdin, depBinary bytes.Buffer
+	require.NoError(t, binary.Write(&stdin, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: root,
+	}))
+	require.NoError(t, binary.Write(&depBinary, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: dep,
+	}))
+	depFile := filepath.Join(t.TempDir(), "dep.wasm")
+	require.NoError(t, os.WriteFile(depFile, depBinary.Bytes(), 0o644))
+
+	var stdout bytes.Buffer
+	require.NoError(t, run([]string{"component", "plug", "--plug", depFile, "-"}, &stdin, &stdout))
+
+	document, err := binary.Read(&stdout)
+	require.NoError(t, err)
+	trees, err := component.Extract(document.Directive.(*api.Component))
+	require.NoError(t, err)
+	world, err := printer.String(trees[0])
+	require.NoError(t, err)
+	require.Equal(t, `package root:component;
+
+world root {
+  import impl: func(x: u32) -> u32;
+  export run: func(x: u32) -> u32;
+}
+`, world)
+}
+
+func TestComponentPlugMissing(t *testing.T) {
+	var stdout bytes.Buffer
+	err := run([]string{"component", "plug", "-"}, &bytes.Buffer{}, &stdout)
+	require.Error(t, err)
+}
+
+func TestComponentNew(t *testing.T) {
+	tree, err := wit.Parse(`package a:b;
+
+world w {
+  export add: func(x: u32, y: u32) -> u32;
+}
+`)
+	require.NoError(t, err)
+	i32 := []api.ValType{api.I32Type, api.I32Type}
+	module := &api.Module{
+		Types: []*api.FuncType{{Parameters: api.ResultType{Types: i32}, Returns: api.ResultType{Types: i32[:1]}}},
+		Funcs: []*api.Func{
+			{Type: 0, Body: &api.Expression{Instructions: []api.Instruction{api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, api.I32Add{}, api.End{}}}},
+		},
+		Exports: []api.Export{{Name: "add", Description: &api.FuncExportDescription{FuncIdx: 0}}},
+	}
+	require.NoError(t, component.Embed(module, "w", tree))
+
+	var stdin bytes.Buffer
+	require.NoError(t, binary.Write(&stdin, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+
+	var stdout bytes.Buffer
+	require.NoError(t, run([]string{"component", "new", "-"}, &stdin, &stdout))
+
+	document, err := binary.Read(&stdout)
+	require.NoError(t, err)
+	trees, err := component.Extract(document.Directive.(*api.Component))
+	require.NoError(t, err)
+	world, err := printer.String(trees[0])
+	require.NoError(t, err)
+	require.Equal(t, `package root:component;
+
+world root {
+  export add: func(x: u32, y: u32) -> u32;
+}
+`, world)
+}
+
+func TestComponentNewMissingAdapter(t *testing.T) {
+	var stdout bytes.Buffer
+	err := run([]string{"component", "new", "--adapt", filepath.Join(t.TempDir(), "missing.wasm"), "-"}, &bytes.Buffer{}, &stdout)
+	require.Error(t, err)
+}
+
+func TestModuleCustom(t *testing.T) {
+	module := &api.Module{
+		Customs: []*api.CustomSection{
+			{Name: "producers", Data: []byte{0x01, 0x08, 'l', 'a', 'n', 'g', 'u', 'a', 'g', 'e', 0x01, 0x02, 'G', 'o', 0x04, '1', '.', '2', '0'}},
+			{Name: "target_features", Data: []byte{0x01, '+', 0x04, 's', 'i', 'm', 'd'}},
+			{Name: "other", Data: []byte{0x01, 0x02, 0x03}},
+		},
+		Names: &api.NameSection{
+			Module: "example",
+			Funcs:  map[api.FuncIndex]string{0: "add"},
+			Locals: map[api.FuncIndex]map[api.LocalIndex]string{0: {0: "x", 1: "y"}},
+		},
+	}
+	var stdin bytes.Buffer
+	require.NoError(t, binary.Write(&stdin, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: module,
+	}))
+
+	var stdout bytes.Buffer
+	require.NoError(t, run([]string{"module", "custom", "-"}, &stdin, &stdout))
+	require.Equal(t, `producers:
+  language Go 1.20
+target_features:
+  +simd
+other: 3 bytes
+name:
+  module example
+  func 0 add
+  local 0 0 x
+  local 0 1 y
+`, stdout.String())
+}
+
+func TestUnknownCommand(t *testing.T) {
+	err := run([]string{"unknown"}, nil, nil)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "component wit"))
+}
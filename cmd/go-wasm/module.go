@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/patrickhuber/go-wasm/binary"
+)
+
+// moduleCustom prints the custom sections of a module, the name, producers and target_features sections are decoded
+func moduleCustom(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	reader, err := input(flags, stdin)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	module, err := decodeModule(reader)
+	if err != nil {
+		return err
+	}
+	for _, custom := range module.Customs {
+		var lines []string
+		switch custom.Name {
+		case binary.NameCustomSection:
+			names, err := binary.DecodeNameSection(custom.Data)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: %v\n", custom.Name, err)
+				continue
+			}
+			if names.Module != "" {
+				lines = append(lines, "module "+names.Module)
+			}
+			lines = append(lines, nameLines("func", names.Funcs)...)
+			for _, f := range sorted(names.Locals) {
+				lines = append(lines, nameLines(fmt.Sprintf("local %d", f), names.Locals[f])...)
+			}
+			for _, f := range sorted(names.Labels) {
+				lines = append(lines, nameLines(fmt.Sprintf("label %d", f), names.Labels[f])...)
+			}
+			lines = append(lines, nameLines("type", names.Types)...)
+			lines = append(lines, nameLines("table", names.Tables)...)
+			lines = append(lines, nameLines("memory", names.Mems)...)
+			lines = append(lines, nameLines("global", names.Globals)...)
+			lines = append(lines, nameLines("elem", names.Elems)...)
+			lines = append(lines, nameLines("data", names.Datas)...)
+		case binary.ProducersCustomSection:
+			producers, err := binary.DecodeProducersSection(custom.Data)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: %v\n", custom.Name, err)
+				continue
+			}
+			for _, field := range producers.Fields {
+				for _, value := range field.Values {
+					line := field.Name + " " + value.Name
+					if value.Version != "" {
+						line += " " + value.Version
+					}
+					lines = append(lines, line)
+				}
+			}
+		case binary.TargetFeaturesCustomSection:
+			features, err := binary.DecodeTargetFeaturesSection(custom.Data)
+			if err != nil {
+				fmt.Fprintf(stdout, "%s: %v\n", custom.Name, err)
+				continue
+			}
+			for _, feature := range features {
+				lines = append(lines, string(feature.Prefix)+feature.Name)
+			}
+		default:
+			fmt.Fprintf(stdout, "%s: %d bytes\n", custom.Name, len(custom.Data))
+			continue
+		}
+		fmt.Fprintf(stdout, "%s:\n", custom.Name)
+		for _, line := range lines {
+			fmt.Fprintf(stdout, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// nameLines returns a line with the kind, index and name of each name in the order of the indices
+func nameLines[K ~uint32](kind string, names map[K]string) []string {
+	var lines []string
+	for _, index := range sorted(names) {
+		lines = append(lines, fmt.Sprintf("%s %d %s", kind, index, names[index]))
+	}
+	return lines
+}
+
+func sorted[K ~uint32, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
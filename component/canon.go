@@ -0,0 +1,158 @@
+package component
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/abi/io"
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/encoding"
+	"github.com/patrickhuber/go-wasm/values"
+)
+
+// canon defines the function of a canon section entry. Lifted functions are added to the
+// function index space, the other canonical functions define core functions.
+func (s *scope) canon(f api.CanonicalFunction) error {
+	switch c := f.(type) {
+	case *api.CanonLift:
+		return s.lift(c)
+	case *api.CanonLower:
+		return s.lower(c)
+	case *api.CanonResourceNew:
+		return s.resourceFunc(c.Resource, 1, 1, func(ctx context.Context, rt types.ResourceType, arg uint32) ([]values.Value, error) {
+			h, err := io.CanonResourceNew(s.inst, rt, arg)
+			if err != nil {
+				return nil, err
+			}
+			i, ok := h.(uint32)
+			if !ok {
+				return nil, types.NewCastError(h, "uint32")
+			}
+			return []values.Value{values.I32Const(i)}, nil
+		})
+	case *api.CanonResourceDrop:
+		return s.resourceFunc(c.Resource, 1, 0, func(ctx context.Context, rt types.ResourceType, arg uint32) ([]values.Value, error) {
+			return nil, io.CanonResourceDrop(ctx, s.inst, rt, arg)
+		})
+	case *api.CanonResourceRep:
+		return s.resourceFunc(c.Resource, 1, 1, func(ctx context.Context, rt types.ResourceType, arg uint32) ([]values.Value, error) {
+			rep, err := io.CanonResourceRep(s.inst, rt, arg)
+			if err != nil {
+				return nil, err
+			}
+			return []values.Value{values.I32Const(rep)}, nil
+		})
+	}
+	return fmt.Errorf("unsupported canonical function %T", f)
+}
+
+// lift wraps the core function in a component function that lifts its arguments and results with canon lift
+func (s *scope) lift(c *api.CanonLift) error {
+	addr, err := s.coreFuncAt(c.CoreFunc)
+	if err != nil {
+		return err
+	}
+	ft, err := s.funcTypeAt(c.Type)
+	if err != nil {
+		return err
+	}
+	opts, memory, err := s.options(c.Options)
+	if err != nil {
+		return err
+	}
+	callee := io.StoreFunc(s.store, opts, memory, addr)
+	s.funcs = append(s.funcs, &Func{
+		Type: ft,
+		call: func(ctx context.Context, args []any) ([]any, func() error, error) {
+			return io.CanonLift(ctx, opts, s.inst, callee, ft, args, io.MaxFlatParams, io.MaxFlatResults)
+		},
+	})
+	return nil
+}
+
+// lower allocates a core host function that calls the component function with canon lower
+func (s *scope) lower(c *api.CanonLower) error {
+	if int(c.Func) >= len(s.funcs) {
+		return fmt.Errorf("function index %d out of range", c.Func)
+	}
+	f := s.funcs[c.Func]
+	opts, memory, err := s.options(c.Options)
+	if err != nil {
+		return err
+	}
+	addr, err := io.AllocLowered(s.store, opts, memory, s.inst, f.call, f.Type)
+	if err != nil {
+		return err
+	}
+	s.coreFuncs = append(s.coreFuncs, addr)
+	return nil
+}
+
+// resourceFunc allocates a core host function taking an i32 for resource.new, resource.drop and resource.rep
+func (s *scope) resourceFunc(resource uint32, params, results int, fn func(context.Context, types.ResourceType, uint32) ([]values.Value, error)) error {
+	rt, err := s.resourceAt(resource)
+	if err != nil {
+		return err
+	}
+	ft := api.FuncType{
+		Parameters: api.ResultType{Types: i32(params)},
+		Returns:    api.ResultType{Types: i32(results)},
+	}
+	addr := s.store.AllocHostFunction(ft, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+		return fn(ctx, rt, uint32(args[0].(values.I32Const)))
+	})
+	s.coreFuncs = append(s.coreFuncs, addr)
+	return nil
+}
+
+func i32(n int) []api.ValType {
+	ts := make([]api.ValType, n)
+	for i := range ts {
+		ts[i] = api.I32Type
+	}
+	return ts
+}
+
+// options resolves canonical options against the core index spaces
+func (s *scope) options(options []api.CanonOption) (*types.CanonicalOptions, *address.Memory, error) {
+	core := io.CoreAddresses{StringEncoding: encoding.UTF8}
+	for _, option := range options {
+		switch o := option.(type) {
+		case api.StringEncodingOption:
+			switch o {
+			case api.UTF8Encoding:
+				core.StringEncoding = encoding.UTF8
+			case api.UTF16Encoding:
+				core.StringEncoding = encoding.UTF16
+			case api.Latin1UTF16Encoding:
+				core.StringEncoding = encoding.Latin1Utf16
+			default:
+				return nil, nil, fmt.Errorf("unsupported string encoding %d", o)
+			}
+		case *api.MemoryOption:
+			memory, err := s.coreMemAt(o.Memory)
+			if err != nil {
+				return nil, nil, err
+			}
+			core.Memory = memory
+		case *api.ReallocOption:
+			realloc, err := s.coreFuncAt(o.Func)
+			if err != nil {
+				return nil, nil, err
+			}
+			core.Realloc = &realloc
+		case *api.PostReturnOption:
+			postReturn, err := s.coreFuncAt(o.Func)
+			if err != nil {
+				return nil, nil, err
+			}
+			core.PostReturn = &postReturn
+		default:
+			return nil, nil, fmt.Errorf("unsupported canonical option %T", option)
+		}
+	}
+	opts, err := io.NewStoreCanonicalOptions(s.store, core)
+	return opts, core.Memory, err
+}
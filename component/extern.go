@@ -0,0 +1,171 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/patrickhuber/go-wasm/abi/marshal"
+	"github.com/patrickhuber/go-wasm/abi/types"
+)
+
+// Extern is an item imported into or exported from a component instance
+type Extern interface {
+	extern()
+}
+
+// Func is a component function. Exports are lifted from the core functions of an instance,
+// host functions passed as imports are created with NewFunc.
+type Func struct {
+	Type types.FuncType
+	call func(ctx context.Context, args []any) ([]any, func() error, error)
+}
+
+func (*Func) extern() {}
+
+// NewFunc returns a host function of type ft. Arguments and results use the representation of abi/io,
+// ctx is the context of the call that reached the host function.
+func NewFunc(ft types.FuncType, fn func(ctx context.Context, args ...any) ([]any, error)) *Func {
+	return &Func{
+		Type: ft,
+		call: func(ctx context.Context, args []any) ([]any, func() error, error) {
+			results, err := fn(ctx, args...)
+			return results, func() error { return nil }, err
+		},
+	}
+}
+
+// Call calls the function with arguments in the representation of abi/io and returns its results.
+// Post-return runs once the results have been lifted. Cancelling ctx interrupts the core functions it calls.
+func (f *Func) Call(ctx context.Context, args ...any) ([]any, error) {
+	if len(args) != len(f.Type.ParamTypes()) {
+		return nil, fmt.Errorf("expected %d arguments, found %d", len(f.Type.ParamTypes()), len(args))
+	}
+	results, postReturn, err := f.call(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := postReturn(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Invoke marshals the Go values args, calls the function and unmarshals its results into the pointers in results
+func (f *Func) Invoke(ctx context.Context, args []any, results ...any) error {
+	params := f.Type.ParamTypes()
+	if len(args) != len(params) {
+		return fmt.Errorf("expected %d arguments, found %d", len(params), len(args))
+	}
+	resultTypes := f.Type.ResultTypes()
+	if len(results) != len(resultTypes) {
+		return fmt.Errorf("expected %d results, found %d", len(resultTypes), len(results))
+	}
+	values := make([]any, len(args))
+	for i, arg := range args {
+		v, err := marshal.Marshal(params[i], arg)
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", i, err)
+		}
+		values[i] = v
+	}
+	lifted, err := f.Call(ctx, values...)
+	if err != nil {
+		return err
+	}
+	for i, result := range results {
+		if err := marshal.Unmarshal(resultTypes[i], lifted[i], result); err != nil {
+			return fmt.Errorf("result %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Type is a type exported from or imported into an instance, resources are passed as types.ResourceType
+type Type struct {
+	Type types.Type
+}
+
+func (*Type) extern() {}
+
+// Instance is an instantiated component or a collection of host items passed as an import
+type Instance struct {
+	names   []string
+	exports map[string]Extern
+	// inst holds the handle tables of an instantiated component, it is nil for host instances
+	inst *types.ComponentInstance
+}
+
+func (*Instance) extern() {}
+
+// NewInstance returns an instance exporting the given items, exports are listed in name order
+func NewInstance(exports map[string]Extern) *Instance {
+	instance := &Instance{exports: map[string]Extern{}}
+	for name, export := range exports {
+		instance.add(name, export)
+	}
+	sort.Strings(instance.names)
+	return instance
+}
+
+func (i *Instance) add(name string, export Extern) {
+	if _, ok := i.exports[name]; !ok {
+		i.names = append(i.names, name)
+	}
+	i.exports[name] = export
+}
+
+// Exports returns the names of the exports of the instance
+func (i *Instance) Exports() []string {
+	return i.names
+}
+
+// Export returns the export name
+func (i *Instance) Export(name string) (Extern, bool) {
+	export, ok := i.exports[name]
+	return export, ok
+}
+
+// Func returns the exported function name
+func (i *Instance) Func(name string) (*Func, error) {
+	export, ok := i.exports[name]
+	if !ok {
+		return nil, fmt.Errorf("export '%s' not found", name)
+	}
+	f, ok := export.(*Func)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' is not a function", name)
+	}
+	return f, nil
+}
+
+// Instance returns the exported instance name
+func (i *Instance) Instance(name string) (*Instance, error) {
+	export, ok := i.exports[name]
+	if !ok {
+		return nil, fmt.Errorf("export '%s' not found", name)
+	}
+	instance, ok := export.(*Instance)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' is not an instance", name)
+	}
+	return instance, nil
+}
+
+// Call calls the exported function name
+func (i *Instance) Call(ctx context.Context, name string, args ...any) ([]any, error) {
+	f, err := i.Func(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Call(ctx, args...)
+}
+
+// LiveHandles returns the resource handles still held by the instance. Handles left when the
+// instance is torn down are leaks, host instances and instances without resources return none.
+func (i *Instance) LiveHandles() []types.LiveHandle {
+	if i.inst == nil {
+		return nil
+	}
+	return i.inst.Handles.Live()
+}
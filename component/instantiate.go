@@ -0,0 +1,494 @@
+// package component instantiates decoded components on top of the core runtime.
+//
+// Core modules are instantiated in a runtime.Store, canon lift turns their exports into
+// component functions and canon lower turns component functions into core host functions.
+// Values passed to and returned from functions use the representation of abi/io.
+package component
+
+import (
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/runtime"
+)
+
+// nested is an entry in the component index space. Nested components are evaluated when they are instantiated.
+type nested struct {
+	component *api.Component
+	parent    *scope
+}
+
+func (*nested) extern() {}
+
+// scope holds the index spaces of a component being instantiated
+type scope struct {
+	parent *scope
+	store  *runtime.Store
+	inst   *types.ComponentInstance
+
+	coreModules   []*api.Module
+	coreInstances []map[string]address.ExternalValue
+	coreFuncs     []address.Function
+	coreMems      []*address.Memory
+	coreGlobals   []*address.Global
+	coreTables    []*address.Table
+
+	// types holds types.ValType, types.FuncType, types.ResourceType and declared entries
+	types      []any
+	funcs      []*Func
+	instances  []*Instance
+	components []*nested
+}
+
+// Instantiate instantiates the component c in store. Each import of the component is looked
+// up by name in imports, functions are passed as *Func, instances as *Instance and types as *Type.
+func Instantiate(store *runtime.Store, c *api.Component, imports map[string]Extern) (*Instance, error) {
+	s := newScope(store, nil)
+	return s.instantiate(c, func(imp api.ComponentImport) (Extern, error) {
+		extern, ok := imports[imp.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing import")
+		}
+		return extern, nil
+	})
+}
+
+func newScope(store *runtime.Store, parent *scope) *scope {
+	return &scope{
+		parent: parent,
+		store:  store,
+		inst: &types.ComponentInstance{
+			MayEnter: true,
+			MayLeave: true,
+			Handles: types.HandleTables{
+				ResourceTypeToTable: map[types.ResourceType]*types.HandleTable{},
+			},
+		},
+	}
+}
+
+// instantiate evaluates the sections of c in order and returns the instance of its exports
+func (s *scope) instantiate(c *api.Component, resolve func(api.ComponentImport) (Extern, error)) (*Instance, error) {
+	instance := &Instance{exports: map[string]Extern{}, inst: s.inst}
+	for _, section := range c.Sections {
+		switch sec := section.(type) {
+		case *api.CustomSection:
+		case *api.CoreModuleSection:
+			s.coreModules = append(s.coreModules, sec.Module)
+		case *api.RawSection:
+			if err := s.raw(sec); err != nil {
+				return nil, err
+			}
+		case *api.CoreInstanceSection:
+			for _, ci := range sec.Instances {
+				if err := s.coreInstance(ci); err != nil {
+					return nil, err
+				}
+			}
+		case *api.TypeSection:
+			for _, def := range sec.Types {
+				t, err := s.defType(def)
+				if err != nil {
+					return nil, err
+				}
+				s.types = append(s.types, t)
+			}
+		case *api.ImportSection:
+			for _, imp := range sec.Imports {
+				extern, err := resolve(imp)
+				if err == nil {
+					err = s.importExtern(imp, extern)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("import '%s': %w", imp.Name, err)
+				}
+			}
+		case *api.AliasSection:
+			for _, alias := range sec.Aliases {
+				if err := s.alias(alias); err != nil {
+					return nil, err
+				}
+			}
+		case *api.CanonSection:
+			for _, f := range sec.Funcs {
+				if err := s.canon(f); err != nil {
+					return nil, err
+				}
+			}
+		case *api.NestedComponentSection:
+			s.components = append(s.components, &nested{component: sec.Component, parent: s})
+		case *api.InstanceSection:
+			for _, i := range sec.Instances {
+				if err := s.instance(i); err != nil {
+					return nil, err
+				}
+			}
+		case *api.ExportSection:
+			for _, export := range sec.Exports {
+				extern, err := s.export(export)
+				if err != nil {
+					return nil, fmt.Errorf("export '%s': %w", export.Name, err)
+				}
+				if extern != nil {
+					instance.add(export.Name, extern)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported section %T", section)
+		}
+	}
+	return instance, nil
+}
+
+// raw decodes core modules, core type sections only affect the core type index space and are skipped
+func (s *scope) raw(sec *api.RawSection) error {
+	switch binary.SectionID(sec.ID) {
+	case binary.ComponentCoreModuleSectionID:
+		module, _, err := binary.DecodeModuleOptions(sec.Data, binary.DecodeOptions{Features: s.store.Config.Features})
+		if err != nil {
+			return err
+		}
+		s.coreModules = append(s.coreModules, module)
+	case binary.ComponentCoreTypeSectionID:
+	default:
+		return fmt.Errorf("unsupported section %d", sec.ID)
+	}
+	return nil
+}
+
+func (s *scope) coreInstance(ci api.CoreInstance) error {
+	switch i := ci.(type) {
+	case *api.CoreInstantiateInstance:
+		if int(i.Module) >= len(s.coreModules) {
+			return fmt.Errorf("core module index %d out of range", i.Module)
+		}
+		module := s.coreModules[i.Module]
+		args := map[string]map[string]address.ExternalValue{}
+		for _, arg := range i.Args {
+			if int(arg.Instance) >= len(s.coreInstances) {
+				return fmt.Errorf("core instance index %d out of range", arg.Instance)
+			}
+			args[arg.Name] = s.coreInstances[arg.Instance]
+		}
+		var imports []address.ExternalValue
+		for _, imp := range module.Imports {
+			value, ok := args[imp.Module][imp.Name]
+			if !ok {
+				return fmt.Errorf("core import '%s' '%s' not found", imp.Module, imp.Name)
+			}
+			imports = append(imports, value)
+		}
+		m, err := runtime.NewModuleInstance(s.store, module, imports...)
+		if err != nil {
+			return err
+		}
+		exports := map[string]address.ExternalValue{}
+		for _, export := range m.Exports {
+			exports[export.Name] = export.Value
+		}
+		s.coreInstances = append(s.coreInstances, exports)
+	case *api.CoreExportsInstance:
+		exports := map[string]address.ExternalValue{}
+		for _, export := range i.Exports {
+			value, err := s.coreItem(export.Sort, export.Index)
+			if err != nil {
+				return fmt.Errorf("%s: %w", export.Name, err)
+			}
+			exports[export.Name] = value
+		}
+		s.coreInstances = append(s.coreInstances, exports)
+	default:
+		return fmt.Errorf("unsupported core instance %T", ci)
+	}
+	return nil
+}
+
+// coreItem returns the core item of the given sort at index
+func (s *scope) coreItem(sort api.Sort, index uint32) (address.ExternalValue, error) {
+	switch sort {
+	case api.CoreFuncSort:
+		return s.coreFuncAt(index)
+	case api.CoreMemorySort:
+		return s.coreMemAt(index)
+	case api.CoreGlobalSort:
+		if int(index) >= len(s.coreGlobals) {
+			return nil, fmt.Errorf("core global index %d out of range", index)
+		}
+		return s.coreGlobals[index], nil
+	case api.CoreTableSort:
+		if int(index) >= len(s.coreTables) {
+			return nil, fmt.Errorf("core table index %d out of range", index)
+		}
+		return s.coreTables[index], nil
+	}
+	return nil, fmt.Errorf("unsupported core sort %d", sort)
+}
+
+// bindCore adds a core item to the index space of its sort
+func (s *scope) bindCore(sort api.Sort, value address.ExternalValue) error {
+	var ok bool
+	switch sort {
+	case api.CoreFuncSort:
+		var addr address.Function
+		if addr, ok = value.(address.Function); ok {
+			s.coreFuncs = append(s.coreFuncs, addr)
+		}
+	case api.CoreMemorySort:
+		var addr *address.Memory
+		if addr, ok = value.(*address.Memory); ok {
+			s.coreMems = append(s.coreMems, addr)
+		}
+	case api.CoreGlobalSort:
+		var addr *address.Global
+		if addr, ok = value.(*address.Global); ok {
+			s.coreGlobals = append(s.coreGlobals, addr)
+		}
+	case api.CoreTableSort:
+		var addr *address.Table
+		if addr, ok = value.(*address.Table); ok {
+			s.coreTables = append(s.coreTables, addr)
+		}
+	default:
+		return fmt.Errorf("unsupported core sort %d", sort)
+	}
+	if !ok {
+		return fmt.Errorf("core sort %d does not match %T", sort, value)
+	}
+	return nil
+}
+
+func (s *scope) coreFuncAt(index uint32) (address.Function, error) {
+	if int(index) >= len(s.coreFuncs) {
+		return 0, fmt.Errorf("core function index %d out of range", index)
+	}
+	return s.coreFuncs[index], nil
+}
+
+func (s *scope) coreMemAt(index uint32) (*address.Memory, error) {
+	if int(index) >= len(s.coreMems) {
+		return nil, fmt.Errorf("core memory index %d out of range", index)
+	}
+	return s.coreMems[index], nil
+}
+
+// importExtern checks the extern supplied for an import against its description and binds it.
+// Function imports take the declared type, the other imports are matched by kind.
+func (s *scope) importExtern(imp api.ComponentImport, extern Extern) error {
+	switch desc := imp.Desc.(type) {
+	case *api.FuncExternDesc:
+		f, ok := extern.(*Func)
+		if !ok {
+			return fmt.Errorf("expected a function, found %T", extern)
+		}
+		ft, err := s.funcTypeAt(desc.Type)
+		if err != nil {
+			return err
+		}
+		if len(ft.ParamTypes()) != len(f.Type.ParamTypes()) || len(ft.ResultTypes()) != len(f.Type.ResultTypes()) {
+			return fmt.Errorf("function type mismatch")
+		}
+		s.funcs = append(s.funcs, &Func{Type: ft, call: f.call})
+	case *api.InstanceExternDesc:
+		instance, ok := extern.(*Instance)
+		if !ok {
+			return fmt.Errorf("expected an instance, found %T", extern)
+		}
+		s.instances = append(s.instances, instance)
+	case *api.TypeExternDesc:
+		t, ok := extern.(*Type)
+		if !ok {
+			return fmt.Errorf("expected a type, found %T", extern)
+		}
+		s.types = append(s.types, t.Type)
+	default:
+		return fmt.Errorf("unsupported import description %T", imp.Desc)
+	}
+	return nil
+}
+
+func (s *scope) alias(alias api.Alias) error {
+	switch target := alias.Target.(type) {
+	case *api.CoreExportAlias:
+		if int(target.Instance) >= len(s.coreInstances) {
+			return fmt.Errorf("core instance index %d out of range", target.Instance)
+		}
+		value, ok := s.coreInstances[target.Instance][target.Name]
+		if !ok {
+			return fmt.Errorf("core instance %d does not export '%s'", target.Instance, target.Name)
+		}
+		return s.bindCore(alias.Sort, value)
+	case *api.ExportAlias:
+		if int(target.Instance) >= len(s.instances) {
+			return fmt.Errorf("instance index %d out of range", target.Instance)
+		}
+		extern, ok := s.instances[target.Instance].Export(target.Name)
+		if !ok {
+			return fmt.Errorf("instance %d does not export '%s'", target.Instance, target.Name)
+		}
+		return s.bind(alias.Sort, extern)
+	case *api.OuterAlias:
+		outer := s
+		for i := uint32(0); i < target.Count; i++ {
+			if outer.parent == nil {
+				return fmt.Errorf("outer alias count %d out of range", target.Count)
+			}
+			outer = outer.parent
+		}
+		switch alias.Sort {
+		case api.TypeSort:
+			t, err := outer.typeAt(target.Index)
+			if err != nil {
+				return err
+			}
+			s.types = append(s.types, t)
+		case api.CoreModuleSort:
+			if int(target.Index) >= len(outer.coreModules) {
+				return fmt.Errorf("core module index %d out of range", target.Index)
+			}
+			s.coreModules = append(s.coreModules, outer.coreModules[target.Index])
+		case api.ComponentSort:
+			if int(target.Index) >= len(outer.components) {
+				return fmt.Errorf("component index %d out of range", target.Index)
+			}
+			s.components = append(s.components, outer.components[target.Index])
+		default:
+			return fmt.Errorf("unsupported outer alias sort %d", alias.Sort)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported alias target %T", alias.Target)
+}
+
+// item returns the component item of the given sort at index
+func (s *scope) item(sort api.Sort, index uint32) (Extern, error) {
+	switch sort {
+	case api.FuncSort:
+		if int(index) >= len(s.funcs) {
+			return nil, fmt.Errorf("function index %d out of range", index)
+		}
+		return s.funcs[index], nil
+	case api.InstanceSort:
+		if int(index) >= len(s.instances) {
+			return nil, fmt.Errorf("instance index %d out of range", index)
+		}
+		return s.instances[index], nil
+	case api.TypeSort:
+		t, err := s.typeAt(index)
+		if err != nil {
+			return nil, err
+		}
+		typ, ok := t.(types.Type)
+		if !ok {
+			return nil, fmt.Errorf("type %d can not be passed between instances", index)
+		}
+		return &Type{Type: typ}, nil
+	case api.ComponentSort:
+		if int(index) >= len(s.components) {
+			return nil, fmt.Errorf("component index %d out of range", index)
+		}
+		return s.components[index], nil
+	}
+	return nil, fmt.Errorf("unsupported sort %d", sort)
+}
+
+// bind adds a component item to the index space of its sort
+func (s *scope) bind(sort api.Sort, extern Extern) error {
+	var ok bool
+	switch sort {
+	case api.FuncSort:
+		var f *Func
+		if f, ok = extern.(*Func); ok {
+			s.funcs = append(s.funcs, f)
+		}
+	case api.InstanceSort:
+		var instance *Instance
+		if instance, ok = extern.(*Instance); ok {
+			s.instances = append(s.instances, instance)
+		}
+	case api.TypeSort:
+		var t *Type
+		if t, ok = extern.(*Type); ok {
+			s.types = append(s.types, t.Type)
+		}
+	case api.ComponentSort:
+		var c *nested
+		if c, ok = extern.(*nested); ok {
+			s.components = append(s.components, c)
+		}
+	default:
+		return fmt.Errorf("unsupported sort %d", sort)
+	}
+	if !ok {
+		return fmt.Errorf("sort %d does not match %T", sort, extern)
+	}
+	return nil
+}
+
+func (s *scope) instance(i api.ComponentInstance) error {
+	switch inst := i.(type) {
+	case *api.InstantiateInstance:
+		if int(inst.Component) >= len(s.components) {
+			return fmt.Errorf("component index %d out of range", inst.Component)
+		}
+		c := s.components[inst.Component]
+		args := map[string]Extern{}
+		for _, arg := range inst.Args {
+			extern, err := s.item(arg.Sort, arg.Index)
+			if err != nil {
+				return fmt.Errorf("%s: %w", arg.Name, err)
+			}
+			args[arg.Name] = extern
+		}
+		child := newScope(s.store, c.parent)
+		instance, err := child.instantiate(c.component, func(imp api.ComponentImport) (Extern, error) {
+			arg, ok := args[imp.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing instantiation argument")
+			}
+			return arg, nil
+		})
+		if err != nil {
+			return err
+		}
+		s.instances = append(s.instances, instance)
+	case *api.ExportsInstance:
+		instance := &Instance{exports: map[string]Extern{}}
+		for _, export := range inst.Exports {
+			extern, err := s.item(export.Sort, export.Index)
+			if err != nil {
+				return fmt.Errorf("%s: %w", export.Name, err)
+			}
+			instance.add(export.Name, extern)
+		}
+		s.instances = append(s.instances, instance)
+	default:
+		return fmt.Errorf("unsupported instance %T", i)
+	}
+	return nil
+}
+
+// export adds the exported item to its index space and returns it. Core modules and
+// components are not visible outside of the instance so nil is returned for them.
+func (s *scope) export(export api.ComponentExport) (Extern, error) {
+	if export.Sort == api.CoreModuleSort {
+		if int(export.Index) >= len(s.coreModules) {
+			return nil, fmt.Errorf("core module index %d out of range", export.Index)
+		}
+		s.coreModules = append(s.coreModules, s.coreModules[export.Index])
+		return nil, nil
+	}
+	extern, err := s.item(export.Sort, export.Index)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.bind(export.Sort, extern); err != nil {
+		return nil, err
+	}
+	if export.Sort == api.ComponentSort {
+		return nil, nil
+	}
+	return extern, nil
+}
@@ -0,0 +1,375 @@
+package component_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/component"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func I32(n int) []api.ValType {
+	ts := make([]api.ValType, n)
+	for i := range ts {
+		ts[i] = api.I32Type
+	}
+	return ts
+}
+
+func FuncType(params, results int) *api.FuncType {
+	return &api.FuncType{Parameters: api.ResultType{Types: I32(params)}, Returns: api.ResultType{Types: I32(results)}}
+}
+
+func Body(instructions ...api.Instruction) *api.Expression {
+	return &api.Expression{Instructions: instructions}
+}
+
+// Libc exports a memory and a bump allocating cabi_realloc that never frees
+func Libc() *api.Module {
+	return &api.Module{
+		Types: []*api.FuncType{FuncType(4, 1)},
+		Funcs: []*api.Func{
+			{
+				Type:   0,
+				Locals: I32(1),
+				Body: Body(
+					// ptr = (bump + align - 1) & -align
+					api.GlobalGet{Index: 0},
+					api.LocalGet{Index: 2},
+					api.I32Add{},
+					api.I32Const(1),
+					api.I32Sub{},
+					api.I32Const(0),
+					api.LocalGet{Index: 2},
+					api.I32Sub{},
+					api.I32And{},
+					api.LocalTee{Index: 4},
+					api.LocalGet{Index: 3},
+					api.I32Add{},
+					api.GlobalSet{Index: 0},
+					api.LocalGet{Index: 4},
+				),
+			},
+		},
+		Mems:    []api.Mem{{Limits: api.Limits{Min: 1}}},
+		Globals: []api.Global{{Mutable: api.Var, Value: api.I32Type, Init: Body(api.I32Const(64))}},
+		Exports: []api.Export{
+			{Name: "memory", Description: &api.MemExportDescription{MemIdx: 0}},
+			{Name: "cabi_realloc", Description: &api.FuncExportDescription{FuncIdx: 0}},
+		},
+	}
+}
+
+// Main imports the libc memory and a log function. greet logs its argument and returns its length,
+// echo returns its argument through the return area at address 8.
+func Main() *api.Module {
+	return &api.Module{
+		Types: []*api.FuncType{FuncType(2, 0), FuncType(2, 1)},
+		Imports: []api.Import{
+			{Module: "libc", Name: "memory", Description: &api.MemImportDescription{Mem: api.Mem{Limits: api.Limits{Min: 1}}}},
+			{Module: "host", Name: "log", Description: &api.FuncImportDescription{TypeIdx: 0}},
+		},
+		Funcs: []*api.Func{
+			{
+				Type: 1,
+				Body: Body(
+					api.LocalGet{Index: 0},
+					api.LocalGet{Index: 1},
+					&api.Call{Index: 0},
+					api.LocalGet{Index: 1},
+				),
+			},
+			{
+				Type: 1,
+				Body: Body(
+					api.I32Const(8),
+					api.LocalGet{Index: 0},
+					&api.Int32Store{},
+					api.I32Const(12),
+					api.LocalGet{Index: 1},
+					&api.Int32Store{},
+					api.I32Const(8),
+				),
+			},
+		},
+		Exports: []api.Export{
+			{Name: "greet", Description: &api.FuncExportDescription{FuncIdx: 1}},
+			{Name: "echo", Description: &api.FuncExportDescription{FuncIdx: 2}},
+		},
+	}
+}
+
+func Options() []api.CanonOption {
+	return []api.CanonOption{api.UTF8Encoding, &api.MemoryOption{Memory: 0}, &api.ReallocOption{Func: 0}}
+}
+
+// Greeter lowers the imported log function into Main and lifts its exports
+func Greeter() *api.Component {
+	return &api.Component{
+		Sections: []api.ComponentSection{
+			&api.TypeSection{Types: []api.DefType{
+				&api.ComponentFuncType{Params: []api.LabelValType{{Label: "s", Type: api.StringType}}},
+				&api.ComponentFuncType{Params: []api.LabelValType{{Label: "name", Type: api.StringType}}, Result: api.U32Type},
+				&api.ComponentFuncType{Params: []api.LabelValType{{Label: "s", Type: api.StringType}}, Result: api.StringType},
+			}},
+			&api.ImportSection{Imports: []api.ComponentImport{
+				{Name: "log", Desc: &api.FuncExternDesc{Type: 0}},
+			}},
+			&api.CoreModuleSection{Module: Libc()},
+			&api.CoreModuleSection{Module: Main()},
+			&api.CoreInstanceSection{Instances: []api.CoreInstance{
+				&api.CoreInstantiateInstance{Module: 0},
+			}},
+			&api.AliasSection{Aliases: []api.Alias{
+				{Sort: api.CoreMemorySort, Target: &api.CoreExportAlias{Instance: 0, Name: "memory"}},
+				{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 0, Name: "cabi_realloc"}},
+			}},
+			&api.CanonSection{Funcs: []api.CanonicalFunction{
+				&api.CanonLower{Func: 0, Options: Options()},
+			}},
+			&api.CoreInstanceSection{Instances: []api.CoreInstance{
+				&api.CoreExportsInstance{Exports: []api.CoreInlineExport{{Name: "log", Sort: api.CoreFuncSort, Index: 1}}},
+				&api.CoreInstantiateInstance{Module: 1, Args: []api.CoreInstantiateArg{
+					{Name: "libc", Instance: 0},
+					{Name: "host", Instance: 1},
+				}},
+			}},
+			&api.AliasSection{Aliases: []api.Alias{
+				{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 2, Name: "greet"}},
+				{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 2, Name: "echo"}},
+			}},
+			&api.CanonSection{Funcs: []api.CanonicalFunction{
+				&api.CanonLift{CoreFunc: 2, Options: Options(), Type: 1},
+				&api.CanonLift{CoreFunc: 3, Options: Options(), Type: 2},
+			}},
+			&api.ExportSection{Exports: []api.ComponentExport{
+				{Name: "greet", Sort: api.FuncSort, Index: 1},
+				{Name: "echo", Sort: api.FuncSort, Index: 2},
+			}},
+		},
+	}
+}
+
+func Log(logged *[]string) *component.Func {
+	ft := types.NewFuncType([]types.Parameter{{Name: "s", Type: types.NewString()}}, nil)
+	return component.NewFunc(ft, func(ctx context.Context, args ...any) ([]any, error) {
+		*logged = append(*logged, args[0].(string))
+		return nil, nil
+	})
+}
+
+func TestInstantiate(t *testing.T) {
+	var logged []string
+	instance, err := component.Instantiate(&runtime.Store{}, Greeter(), map[string]component.Extern{
+		"log": Log(&logged),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"greet", "echo"}, instance.Exports())
+
+	results, err := instance.Call(context.Background(), "greet", "world")
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(5)}, results)
+	require.Equal(t, []string{"world"}, logged)
+
+	results, err = instance.Call(context.Background(), "echo", "hello")
+	require.NoError(t, err)
+	require.Equal(t, []any{"hello"}, results)
+
+	echo, err := instance.Func("echo")
+	require.NoError(t, err)
+	var s string
+	require.NoError(t, echo.Invoke(context.Background(), []any{"marshal"}, &s))
+	require.Equal(t, "marshal", s)
+}
+
+type contextKey struct{}
+
+func TestInstantiateContext(t *testing.T) {
+	var called []any
+	ft := types.NewFuncType([]types.Parameter{{Name: "s", Type: types.NewString()}}, nil)
+	log := component.NewFunc(ft, func(ctx context.Context, args ...any) ([]any, error) {
+		called = append(called, ctx.Value(contextKey{}))
+		return nil, nil
+	})
+	instance, err := component.Instantiate(&runtime.Store{}, Greeter(), map[string]component.Extern{
+		"log": log,
+	})
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "caller")
+	_, err = instance.Call(ctx, "greet", "world")
+	require.NoError(t, err)
+	require.Equal(t, []any{"caller"}, called)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = instance.Call(cancelled, "greet", "world")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, called, 1)
+}
+
+func TestInstantiateNested(t *testing.T) {
+	outer := &api.Component{
+		Sections: []api.ComponentSection{
+			&api.TypeSection{Types: []api.DefType{
+				&api.ComponentFuncType{Params: []api.LabelValType{{Label: "s", Type: api.StringType}}},
+			}},
+			&api.ImportSection{Imports: []api.ComponentImport{
+				{Name: "log", Desc: &api.FuncExternDesc{Type: 0}},
+			}},
+			&api.NestedComponentSection{Component: Greeter()},
+			&api.InstanceSection{Instances: []api.ComponentInstance{
+				&api.InstantiateInstance{Component: 0, Args: []api.InstantiateArg{
+					{Name: "log", Sort: api.FuncSort, Index: 0},
+				}},
+			}},
+			&api.AliasSection{Aliases: []api.Alias{
+				{Sort: api.FuncSort, Target: &api.ExportAlias{Instance: 0, Name: "greet"}},
+			}},
+			&api.InstanceSection{Instances: []api.ComponentInstance{
+				&api.ExportsInstance{Exports: []api.InlineExport{
+					{Name: "hello", Sort: api.FuncSort, Index: 1},
+				}},
+			}},
+			&api.ExportSection{Exports: []api.ComponentExport{
+				{Name: "greeter", Sort: api.InstanceSort, Index: 1},
+			}},
+		},
+	}
+	var logged []string
+	instance, err := component.Instantiate(&runtime.Store{}, outer, map[string]component.Extern{
+		"log": Log(&logged),
+	})
+	require.NoError(t, err)
+
+	greeter, err := instance.Instance("greeter")
+	require.NoError(t, err)
+	results, err := greeter.Call(context.Background(), "hello", "nested")
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(6)}, results)
+	require.Equal(t, []string{"nested"}, logged)
+}
+
+func TestInstantiateResource(t *testing.T) {
+	module := &api.Module{
+		Types: []*api.FuncType{FuncType(1, 1), FuncType(1, 0)},
+		Imports: []api.Import{
+			{Module: "r", Name: "new", Description: &api.FuncImportDescription{TypeIdx: 0}},
+			{Module: "r", Name: "rep", Description: &api.FuncImportDescription{TypeIdx: 0}},
+			{Module: "r", Name: "drop", Description: &api.FuncImportDescription{TypeIdx: 1}},
+		},
+		Funcs: []*api.Func{
+			{
+				Type:   0,
+				Locals: I32(1),
+				Body: Body(
+					api.LocalGet{Index: 0},
+					&api.Call{Index: 0},
+					api.LocalTee{Index: 1},
+					&api.Call{Index: 1},
+					api.LocalGet{Index: 1},
+					&api.Call{Index: 2},
+				),
+			},
+			{
+				// leak creates a handle that is never dropped
+				Type: 0,
+				Body: Body(api.LocalGet{Index: 0}, &api.Call{Index: 0}),
+			},
+		},
+		Exports: []api.Export{
+			{Name: "roundtrip", Description: &api.FuncExportDescription{FuncIdx: 3}},
+			{Name: "leak", Description: &api.FuncExportDescription{FuncIdx: 4}},
+		},
+	}
+	c := &api.Component{
+		Sections: []api.ComponentSection{
+			&api.TypeSection{Types: []api.DefType{
+				&api.ResourceType{Rep: api.I32Type},
+				&api.ComponentFuncType{Params: []api.LabelValType{{Label: "rep", Type: api.U32Type}}, Result: api.U32Type},
+			}},
+			&api.CoreModuleSection{Module: module},
+			&api.CanonSection{Funcs: []api.CanonicalFunction{
+				&api.CanonResourceNew{Resource: 0},
+				&api.CanonResourceRep{Resource: 0},
+				&api.CanonResourceDrop{Resource: 0},
+			}},
+			&api.CoreInstanceSection{Instances: []api.CoreInstance{
+				&api.CoreExportsInstance{Exports: []api.CoreInlineExport{
+					{Name: "new", Sort: api.CoreFuncSort, Index: 0},
+					{Name: "rep", Sort: api.CoreFuncSort, Index: 1},
+					{Name: "drop", Sort: api.CoreFuncSort, Index: 2},
+				}},
+				&api.CoreInstantiateInstance{Module: 0, Args: []api.CoreInstantiateArg{{Name: "r", Instance: 0}}},
+			}},
+			&api.AliasSection{Aliases: []api.Alias{
+				{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 1, Name: "roundtrip"}},
+				{Sort: api.CoreFuncSort, Target: &api.CoreExportAlias{Instance: 1, Name: "leak"}},
+			}},
+			&api.CanonSection{Funcs: []api.CanonicalFunction{
+				&api.CanonLift{CoreFunc: 3, Type: 1},
+				&api.CanonLift{CoreFunc: 4, Type: 1},
+			}},
+			&api.ExportSection{Exports: []api.ComponentExport{
+				{Name: "roundtrip", Sort: api.FuncSort, Index: 0},
+				{Name: "leak", Sort: api.FuncSort, Index: 1},
+			}},
+		},
+	}
+	instance, err := component.Instantiate(&runtime.Store{}, c, nil)
+	require.NoError(t, err)
+	results, err := instance.Call(context.Background(), "roundtrip", uint32(42))
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(42)}, results)
+	require.Empty(t, instance.LiveHandles())
+
+	results, err = instance.Call(context.Background(), "leak", uint32(7))
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(0)}, results)
+	live := instance.LiveHandles()
+	require.Len(t, live, 1)
+	require.Equal(t, uint32(7), live[0].Handle.Rep)
+	require.True(t, live[0].Handle.Own)
+}
+
+func TestInstantiateFail(t *testing.T) {
+	type test struct {
+		name    string
+		imports map[string]component.Extern
+		message string
+	}
+	tests := []test{
+		{"missing import", nil, "import 'log': missing import"},
+		{"wrong kind", map[string]component.Extern{"log": component.NewInstance(nil)}, "expected a function"},
+		{"type mismatch", map[string]component.Extern{
+			"log": component.NewFunc(types.NewFuncType(nil, nil), func(ctx context.Context, args ...any) ([]any, error) { return nil, nil }),
+		}, "function type mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := component.Instantiate(&runtime.Store{}, Greeter(), test.imports)
+			require.ErrorContains(t, err, test.message)
+		})
+	}
+}
+
+func TestInstantiateFeatures(t *testing.T) {
+	// a core module with two memories needs the multi-memory proposal
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x05, 0x05, 0x02, 0x00, 0x01, 0x00, 0x01}
+	c := &api.Component{
+		Sections: []api.ComponentSection{
+			&api.RawSection{ID: uint8(binary.ComponentCoreModuleSectionID), Data: module},
+		},
+	}
+	_, err := component.Instantiate(&runtime.Store{}, c, nil)
+	require.ErrorContains(t, err, "multiple memories")
+
+	store := &runtime.Store{Config: config.Config{Features: config.Features{MultiMemory: true}}}
+	_, err = component.Instantiate(store, c, nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,238 @@
+package component
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/values"
+)
+
+// declared stands in the type index space for component and instance types. Imports are
+// matched by name so their declarations are not evaluated.
+type declared struct{}
+
+// defType converts a type definition to the types of abi/io
+func (s *scope) defType(def api.DefType) (any, error) {
+	switch t := def.(type) {
+	case api.PrimValType:
+		return primType(t)
+	case *api.RecordType:
+		fields := make([]types.Field, 0, len(t.Fields))
+		for _, field := range t.Fields {
+			vt, err := s.valType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Label, err)
+			}
+			fields = append(fields, types.Field{Label: field.Label, Type: vt})
+		}
+		return types.NewRecord(fields...), nil
+	case *api.VariantType:
+		cases := make([]types.Case, 0, len(t.Cases))
+		for _, c := range t.Cases {
+			var vt types.ValType
+			if c.Type != nil {
+				var err error
+				vt, err = s.valType(c.Type)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", c.Label, err)
+				}
+			}
+			cases = append(cases, types.NewCase(c.Label, vt))
+		}
+		return types.NewVariant(cases...), nil
+	case *api.ListType:
+		vt, err := s.valType(t.Element)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewList(vt), nil
+	case *api.TupleType:
+		ts := make([]types.ValType, 0, len(t.Types))
+		for _, element := range t.Types {
+			vt, err := s.valType(element)
+			if err != nil {
+				return nil, err
+			}
+			ts = append(ts, vt)
+		}
+		return types.NewTuple(ts...), nil
+	case *api.FlagsType:
+		return types.NewFlags(t.Labels...), nil
+	case *api.EnumType:
+		return types.NewEnum(t.Labels...), nil
+	case *api.OptionType:
+		vt, err := s.valType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewOption(vt), nil
+	case *api.ResultValType:
+		ok, err := s.optionalValType(t.Ok)
+		if err != nil {
+			return nil, err
+		}
+		e, err := s.optionalValType(t.Error)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewResult(ok, e), nil
+	case *api.OwnType:
+		rt, err := s.resourceAt(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewOwn(rt), nil
+	case *api.BorrowType:
+		rt, err := s.resourceAt(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewBorrow(rt), nil
+	case *api.ComponentFuncType:
+		return s.funcType(t)
+	case *api.ResourceType:
+		return s.resourceType(t)
+	case *api.ComponentType, *api.InstanceType:
+		return declared{}, nil
+	}
+	return nil, fmt.Errorf("unsupported type definition %T", def)
+}
+
+func primType(t api.PrimValType) (types.ValType, error) {
+	switch t {
+	case api.BoolType:
+		return types.NewBool(), nil
+	case api.S8Type:
+		return types.NewS8(), nil
+	case api.U8Type:
+		return types.NewU8(), nil
+	case api.S16Type:
+		return types.NewS16(), nil
+	case api.U16Type:
+		return types.NewU16(), nil
+	case api.S32Type:
+		return types.NewS32(), nil
+	case api.U32Type:
+		return types.NewU32(), nil
+	case api.S64Type:
+		return types.NewS64(), nil
+	case api.U64Type:
+		return types.NewU64(), nil
+	case api.Float32Type:
+		return types.NewF32(), nil
+	case api.Float64Type:
+		return types.NewF64(), nil
+	case api.CharType:
+		return types.NewChar(), nil
+	case api.StringType:
+		return types.NewString(), nil
+	case api.ErrorContextType:
+		return types.NewErrorContext(), nil
+	}
+	return nil, fmt.Errorf("unsupported primitive type %d", t)
+}
+
+func (s *scope) valType(t api.ComponentValType) (types.ValType, error) {
+	switch vt := t.(type) {
+	case api.PrimValType:
+		return primType(vt)
+	case api.TypeIndexValType:
+		def, err := s.typeAt(uint32(vt))
+		if err != nil {
+			return nil, err
+		}
+		valType, ok := def.(types.ValType)
+		if !ok {
+			return nil, fmt.Errorf("type %d is not a value type", vt)
+		}
+		return valType, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %T", t)
+}
+
+func (s *scope) optionalValType(t api.ComponentValType) (types.ValType, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return s.valType(t)
+}
+
+func (s *scope) funcType(t *api.ComponentFuncType) (types.FuncType, error) {
+	params := make([]types.Parameter, 0, len(t.Params))
+	for _, param := range t.Params {
+		vt, err := s.valType(param.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", param.Label, err)
+		}
+		params = append(params, types.Parameter{Name: param.Label, Type: vt})
+	}
+	var results []types.Parameter
+	if t.Result != nil {
+		vt, err := s.valType(t.Result)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.Parameter{Type: vt})
+	}
+	for _, result := range t.NamedResults {
+		vt, err := s.valType(result.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", result.Label, err)
+		}
+		results = append(results, types.Parameter{Name: result.Label, Type: vt})
+	}
+	return types.NewFuncType(params, results), nil
+}
+
+// resourceType defines a resource implemented by this instance. The destructor calls the core function at Dtor with the representation
+// and the context of the call that dropped the resource.
+func (s *scope) resourceType(t *api.ResourceType) (types.ResourceType, error) {
+	if t.Rep != api.I32Type {
+		return nil, fmt.Errorf("unsupported resource representation %v", t.Rep)
+	}
+	if t.Dtor == nil {
+		return types.NewResourceType(nil, s.inst), nil
+	}
+	addr, err := s.coreFuncAt(*t.Dtor)
+	if err != nil {
+		return nil, err
+	}
+	dtor := func(ctx context.Context, rep uint32) error {
+		_, err := s.store.Invoke(ctx, addr, values.I32Const(rep))
+		return err
+	}
+	return types.NewResourceType(dtor, s.inst), nil
+}
+
+func (s *scope) typeAt(index uint32) (any, error) {
+	if int(index) >= len(s.types) {
+		return nil, fmt.Errorf("type index %d out of range", index)
+	}
+	return s.types[index], nil
+}
+
+func (s *scope) funcTypeAt(index uint32) (types.FuncType, error) {
+	def, err := s.typeAt(index)
+	if err != nil {
+		return nil, err
+	}
+	ft, ok := def.(types.FuncType)
+	if !ok {
+		return nil, fmt.Errorf("type %d is not a function type", index)
+	}
+	return ft, nil
+}
+
+func (s *scope) resourceAt(index uint32) (types.ResourceType, error) {
+	def, err := s.typeAt(index)
+	if err != nil {
+		return nil, err
+	}
+	rt, ok := def.(types.ResourceType)
+	if !ok {
+		return nil, fmt.Errorf("type %d is not a resource type", index)
+	}
+	return rt, nil
+}
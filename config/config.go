@@ -1,8 +1,114 @@
 package config
 
+import "github.com/patrickhuber/go-wasm/api"
+
 func New() *Config {
 	return &Config{}
 }
 
 type Config struct {
+	// Engine selects how module functions run
+	Engine Engine
+	// Features enables proposals the decoder and validator reject by default
+	Features Features
+	// Limits bounds the resources used by modules
+	Limits Limits
+	// Fuel meters the instructions run by module functions
+	Fuel Fuel
+}
+
+// Engine is the way a store runs module functions
+type Engine int
+
+const (
+	// Bytecode compiles functions to bytecode the first time they are called
+	Bytecode Engine = iota
+	// Interpreter runs every function in the interpreter
+	Interpreter
+	// Native compiles functions to machine code on linux/amd64 and linux/arm64 and uses bytecode elsewhere
+	Native
+)
+
+// Features are the proposals a module may use. A module that uses a proposal that is not enabled fails
+// to decode with an error naming the proposal. The decoder implements only part of some proposals, the
+// parts it does not implement fail with a binary.UnsupportedError even when the proposal is enabled.
+type Features struct {
+	// SIMD allows the v128 type, vector instructions are not supported
+	SIMD bool
+	// Threads allows shared memories, atomic instructions are not supported
+	Threads bool
+	// MultiMemory allows more than one memory
+	MultiMemory bool
+	// Memory64 only changes the error of memories indexed by i64, they are not supported
+	Memory64 bool
+	// GC only changes the error of struct and array types, typed references and gc instructions, they are not supported
+	GC bool
+	// ExceptionHandling only changes the error of tags, exnref and the instructions that throw and catch exceptions,
+	// they are not supported
+	ExceptionHandling bool
+	// TailCalls only changes the error of return_call and return_call_indirect, they are not supported
+	TailCalls bool
+}
+
+// defaults of the limits, they follow the implementation limits of the JavaScript API
+// see https://webassembly.github.io/spec/js-api/#limits
+const (
+	DefaultMemoryPages = 65536
+	DefaultTableSize   = 10_000_000
+	DefaultCallDepth   = 10_000
+	DefaultInstances   = 10_000
+	DefaultFunctions   = 1_000_000
+)
+
+// Limits bounds the resources used by modules. A limit that is zero uses its default.
+type Limits struct {
+	// MemoryPages is the largest number of pages of a memory
+	MemoryPages uint32
+	// TableSize is the largest number of elements of a table
+	TableSize uint32
+	// CallDepth is the largest number of nested calls of module functions
+	CallDepth int
+	// Instances is the largest number of module instances in a store
+	Instances int
+	// Functions is the largest number of functions of a module, including imported functions
+	Functions int
+}
+
+// WithDefaults returns the limits with the default of each limit that is zero
+func (l Limits) WithDefaults() Limits {
+	if l.MemoryPages == 0 {
+		l.MemoryPages = DefaultMemoryPages
+	}
+	if l.TableSize == 0 {
+		l.TableSize = DefaultTableSize
+	}
+	if l.CallDepth == 0 {
+		l.CallDepth = DefaultCallDepth
+	}
+	if l.Instances == 0 {
+		l.Instances = DefaultInstances
+	}
+	if l.Functions == 0 {
+		l.Functions = DefaultFunctions
+	}
+	return l
+}
+
+// Fuel meters the instructions run by module functions. Every instruction consumes fuel from the store and
+// a function traps when the store does not have enough fuel left, so the work done with the same fuel
+// does not depend on the speed of the machine.
+type Fuel struct {
+	// Enabled makes instructions consume fuel, a store starts without fuel
+	Enabled bool
+	// Cost returns the fuel consumed by an instruction, DefaultCost is used when it is nil
+	Cost func(api.Instruction) uint64
+}
+
+// DefaultCost is one for every instruction except the ones that do no work at run time
+func DefaultCost(instruction api.Instruction) uint64 {
+	switch instruction.(type) {
+	case api.End, *api.Nop, *api.Drop, *api.Block, *api.Loop:
+		return 0
+	}
+	return 1
 }
@@ -0,0 +1,204 @@
+// package diagnostic describes locations in source text and the errors reported by the text parsers
+package diagnostic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Position is a zero based location in source text
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Advance returns the position after text that starts at p
+func (p Position) Advance(text string) Position {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			p.Line++
+			p.Column = 0
+		} else {
+			p.Column++
+		}
+	}
+	p.Offset += len(text)
+	return p
+}
+
+// Span is the range of source text covered by a node. End is exclusive.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Diagnostic is an error at a location in source text
+type Diagnostic struct {
+	// File is the name of the source file, it is empty when the source did not come from a file
+	File string
+	// Source is the full source text used to render the snippet
+	Source  string
+	Span    Span
+	Message string
+	// Expected describes the tokens that would have been accepted, literal tokens are quoted
+	Expected []string
+}
+
+// New returns a diagnostic for the span
+func New(span Span, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Span:    span,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Error renders the diagnostic with the location, a snippet of the source with the span underlined by carets and the expected tokens
+//
+//	file.wit:3:13: unexpected '}'
+//	  |
+//	3 |   f: func() }
+//	  |             ^
+//	  = expected one of ';', '->'
+func (d *Diagnostic) Error() string {
+	var builder strings.Builder
+	builder.WriteString(d.location())
+	builder.WriteString(": ")
+	builder.WriteString(d.Message)
+
+	line, ok := d.line()
+	if ok {
+		number := fmt.Sprint(d.Span.Start.Line + 1)
+		gutter := strings.Repeat(" ", len(number))
+		width := 1
+		if d.Span.End.Line == d.Span.Start.Line && d.Span.End.Column > d.Span.Start.Column {
+			width = d.Span.End.Column - d.Span.Start.Column
+		}
+		// tabs are preserved in the padding so the carets line up with the snippet
+		padding := []rune{}
+		for i, r := range line {
+			if i >= d.Span.Start.Column {
+				break
+			}
+			if r == '\t' {
+				padding = append(padding, '\t')
+			} else {
+				padding = append(padding, ' ')
+			}
+		}
+		fmt.Fprintf(&builder, "\n%s |\n%s | %s\n%s | %s%s", gutter, number, line, gutter, string(padding), strings.Repeat("^", width))
+	}
+
+	if len(d.Expected) > 0 {
+		if ok {
+			builder.WriteString("\n  = ")
+		} else {
+			builder.WriteString(", ")
+		}
+		if len(d.Expected) == 1 {
+			builder.WriteString("expected " + d.Expected[0])
+		} else {
+			builder.WriteString("expected one of " + strings.Join(d.Expected, ", "))
+		}
+	}
+	return builder.String()
+}
+
+func (d *Diagnostic) location() string {
+	location := fmt.Sprintf("%d:%d", d.Span.Start.Line+1, d.Span.Start.Column+1)
+	if d.File == "" {
+		return location
+	}
+	return d.File + ":" + location
+}
+
+// line returns the source line where the span starts
+func (d *Diagnostic) line() (string, bool) {
+	if d.Source == "" || d.Span.Start.Offset > len(d.Source) {
+		return "", false
+	}
+	start := strings.LastIndexByte(d.Source[:d.Span.Start.Offset], '\n') + 1
+	end := strings.IndexByte(d.Source[d.Span.Start.Offset:], '\n')
+	if end < 0 {
+		end = len(d.Source)
+	} else {
+		end += d.Span.Start.Offset
+	}
+	return strings.TrimSuffix(d.Source[start:end], "\r"), true
+}
+
+// List is the set of diagnostics reported by a parse
+type List []*Diagnostic
+
+func (l List) Error() string {
+	errs := make([]string, 0, len(l))
+	for _, d := range l {
+		errs = append(errs, d.Error())
+	}
+	return strings.Join(errs, "\n")
+}
+
+func (l List) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+	for _, d := range l {
+		errs = append(errs, d)
+	}
+	return errs
+}
+
+// Err returns nil when the list is empty so callers do not return a non nil error interface holding an empty list
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+var spanType = reflect.TypeOf(Span{})
+
+// Clear zeroes every Span reachable from node. Positions are not part of the meaning of a tree, so trees parsed from different sources are compared after clearing their spans.
+func Clear(node any) {
+	value := reflect.ValueOf(node)
+	if value.Kind() != reflect.Pointer {
+		panic(fmt.Sprintf("diagnostic.Clear requires a pointer, found %T", node))
+	}
+	clearSpans(value)
+}
+
+func clearSpans(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if !value.IsNil() {
+			clearSpans(value.Elem())
+		}
+	case reflect.Interface:
+		if value.IsNil() {
+			return
+		}
+		// values held by interfaces are not addressable, so clear a copy and store it back
+		elem := value.Elem()
+		cleared := reflect.New(elem.Type()).Elem()
+		cleared.Set(elem)
+		clearSpans(cleared)
+		if value.CanSet() {
+			value.Set(cleared)
+		}
+	case reflect.Struct:
+		if value.Type() == spanType {
+			if value.CanSet() {
+				value.Set(reflect.Zero(spanType))
+			}
+			return
+		}
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				clearSpans(value.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			clearSpans(value.Index(i))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package diagnostic_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvance(t *testing.T) {
+	position := diagnostic.Position{}.Advance("ab\ncd")
+	require.Equal(t, diagnostic.Position{Offset: 5, Line: 1, Column: 2}, position)
+}
+
+func TestError(t *testing.T) {
+	source := "package a:b;\n\tf: func() }\n"
+	start := diagnostic.Position{}.Advance("package a:b;\n\tf: func() ")
+	span := diagnostic.Span{Start: start, End: start.Advance("}")}
+
+	type test struct {
+		name       string
+		diagnostic *diagnostic.Diagnostic
+		expected   string
+	}
+	tests := []test{
+		{
+			name:       "message",
+			diagnostic: &diagnostic.Diagnostic{Span: span, Message: "unexpected '}'"},
+			expected:   "2:12: unexpected '}'",
+		},
+		{
+			name:       "expected_without_source",
+			diagnostic: &diagnostic.Diagnostic{File: "a.wit", Span: span, Message: "unexpected '}'", Expected: []string{"';'"}},
+			expected:   "a.wit:2:12: unexpected '}', expected ';'",
+		},
+		{
+			name: "snippet",
+			diagnostic: &diagnostic.Diagnostic{
+				File:     "a.wit",
+				Source:   source,
+				Span:     span,
+				Message:  "unexpected '}'",
+				Expected: []string{"';'", "'->'"},
+			},
+			expected: strings.Join([]string{
+				"a.wit:2:12: unexpected '}'",
+				"  |",
+				"2 | \tf: func() }",
+				"  | \t          ^",
+				"  = expected one of ';', '->'",
+			}, "\n"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, test.diagnostic.Error())
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	var list diagnostic.List
+	require.NoError(t, list.Err())
+
+	first := diagnostic.New(diagnostic.Span{}, "first")
+	second := diagnostic.New(diagnostic.Span{}, "second")
+	list = append(list, first, second)
+
+	err := list.Err()
+	require.Error(t, err)
+	require.Equal(t, "1:1: first\n1:1: second", err.Error())
+
+	var d *diagnostic.Diagnostic
+	require.True(t, errors.As(err, &d))
+	require.Same(t, first, d)
+}
+
+type node struct {
+	Span     diagnostic.Span
+	Children []any
+	Next     *node
+}
+
+type leaf struct {
+	Span diagnostic.Span
+}
+
+func TestClear(t *testing.T) {
+	span := diagnostic.Span{End: diagnostic.Position{Offset: 1, Column: 1}}
+	tree := &node{
+		Span:     span,
+		Children: []any{leaf{Span: span}, &leaf{Span: span}},
+		Next:     &node{Span: span},
+	}
+	diagnostic.Clear(tree)
+	require.Equal(t, &node{
+		Children: []any{leaf{}, &leaf{}},
+		Next:     &node{},
+	}, tree)
+}
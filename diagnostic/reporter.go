@@ -0,0 +1,119 @@
+package diagnostic
+
+import "errors"
+
+// Reporter records the diagnostics reported while lexing and parsing a source text.
+// The lexers embed it so every parser reports errors and recovers from them the same way.
+type Reporter struct {
+	file   string
+	source string
+	// end is the position after the last accepted token
+	end         Position
+	diagnostics List
+}
+
+// NewReporter returns a reporter for the source text read from the named file, the name is empty when the source did not come from a file
+func NewReporter(file string, source string) Reporter {
+	return Reporter{file: file, source: source}
+}
+
+// Clone returns a copy of the reporter. Diagnostics reported to the copy are discarded unless the lexer holding it is applied to the original lexer.
+func (r *Reporter) Clone() Reporter {
+	clone := *r
+	clone.diagnostics = r.diagnostics[:len(r.diagnostics):len(r.diagnostics)]
+	return clone
+}
+
+// Rewind moves the end back to the end of a clone. Diagnostics reported since the clone was taken are kept.
+func (r *Reporter) Rewind(clone *Reporter) {
+	r.end = clone.end
+}
+
+// Accept records the span of a token that is not whitespace or a comment
+func (r *Reporter) Accept(span Span) {
+	r.end = span.End
+}
+
+// End returns the position after the last accepted token
+func (r *Reporter) End() Position {
+	return r.end
+}
+
+// SpanFrom returns the span from the start of the first token of a node to the end of the last accepted token
+func (r *Reporter) SpanFrom(start Span) Span {
+	return Span{Start: start.Start, End: r.end}
+}
+
+// Unrecognized returns a diagnostic for text at start that does not match any token
+func (r *Reporter) Unrecognized(start Position, text string) *Diagnostic {
+	d := New(Span{Start: start, End: start.Advance(text)}, "unrecognized token '%s'", text)
+	d.File = r.file
+	d.Source = r.source
+	return d
+}
+
+// Report records a diagnostic for the source
+func (r *Reporter) Report(d *Diagnostic) {
+	d.File = r.file
+	d.Source = r.source
+	r.diagnostics = append(r.diagnostics, d)
+}
+
+// ReportError records the error of a parse. Errors that are not diagnostics are reported at the end of the last accepted token.
+// Errors marked with Reported are dropped, and so is an error that repeats the last diagnostic, this happens when recovery
+// skips over the token that failed to lex.
+func (r *Reporter) ReportError(err error) {
+	if errors.As(err, &reported{}) {
+		return
+	}
+	var d *Diagnostic
+	if !errors.As(err, &d) {
+		d = New(Span{Start: r.end, End: r.end}, "%s", err.Error())
+	}
+	if len(r.diagnostics) > 0 {
+		last := r.diagnostics[len(r.diagnostics)-1]
+		if last.Span.Start == d.Span.Start && last.Message == d.Message {
+			return
+		}
+	}
+	r.Report(d)
+}
+
+// Diagnostics returns the diagnostics reported while parsing the source
+func (r *Reporter) Diagnostics() List {
+	return r.diagnostics
+}
+
+// reported wraps an error that was already added to the diagnostics
+type reported struct {
+	error
+}
+
+// Reported marks an error that was already added to the diagnostics so ReportError does not add it again
+func Reported(err error) error {
+	return reported{err}
+}
+
+// Lexer is a lexer that reports diagnostics and can be rewound to a clone
+type Lexer[L any] interface {
+	ReportError(err error)
+	Rewind(clone L)
+}
+
+// Synchronize reports the error of an item that failed to parse and skips the item so parsing can continue with the next one.
+// The lexer is rewound to start, the clone taken before the item, so skip sees balanced delimiters.
+// skip consumes the tokens of the item and reports whether it consumed any. When it consumes none the error is returned
+// so the enclosing item fails, the returned error is marked with Reported.
+func Synchronize[L Lexer[L]](lexer L, start L, err error, skip func() (bool, error)) error {
+	lexer.ReportError(err)
+	lexer.Rewind(start)
+	skipped, skipErr := skip()
+	if skipErr != nil {
+		lexer.ReportError(skipErr)
+		return Reported(skipErr)
+	}
+	if !skipped {
+		return Reported(err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package diagnostic_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/stretchr/testify/require"
+)
+
+// lexer consumes one token per character of the input
+type lexer struct {
+	diagnostic.Reporter
+	input    string
+	position diagnostic.Position
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{Reporter: diagnostic.NewReporter("test.wit", input), input: input}
+}
+
+func (l *lexer) Clone() *lexer {
+	return &lexer{Reporter: l.Reporter.Clone(), input: l.input, position: l.position}
+}
+
+func (l *lexer) Rewind(clone *lexer) {
+	reporter := l.Reporter
+	reporter.Rewind(&clone.Reporter)
+	*l = *clone
+	l.Reporter = reporter
+}
+
+func (l *lexer) next() {
+	start := l.position
+	l.position = start.Advance(l.input[start.Offset : start.Offset+1])
+	l.Accept(diagnostic.Span{Start: start, End: l.position})
+}
+
+func TestReportError(t *testing.T) {
+	l := newLexer("ab")
+	l.next()
+	l.ReportError(errors.New("plain"))
+	d := diagnostic.New(diagnostic.Span{End: diagnostic.Position{Offset: 1, Column: 1}}, "diagnostic")
+	l.ReportError(d)
+	// repeats and errors marked as reported are dropped
+	l.ReportError(diagnostic.New(d.Span, "diagnostic"))
+	l.ReportError(diagnostic.Reported(errors.New("reported")))
+
+	diagnostics := l.Diagnostics()
+	require.Len(t, diagnostics, 2)
+	require.Equal(t, "plain", diagnostics[0].Message)
+	require.Equal(t, diagnostic.Span{Start: l.End(), End: l.End()}, diagnostics[0].Span)
+	require.Equal(t, "test.wit", diagnostics[0].File)
+	require.Equal(t, "ab", diagnostics[0].Source)
+	require.Same(t, d, diagnostics[1])
+}
+
+func TestClone(t *testing.T) {
+	l := newLexer("abc")
+	l.next()
+	clone := l.Clone()
+	clone.next()
+	clone.Report(diagnostic.New(diagnostic.Span{}, "clone"))
+	require.Empty(t, l.Diagnostics())
+	require.Equal(t, diagnostic.Position{Offset: 1, Column: 1}, l.End())
+
+	l.next()
+	l.Report(diagnostic.New(diagnostic.Span{}, "original"))
+	l.Rewind(clone)
+	require.Equal(t, diagnostic.Position{Offset: 2, Column: 2}, l.End())
+	require.Len(t, l.Diagnostics(), 1)
+	require.Equal(t, "original", l.Diagnostics()[0].Message)
+	require.Equal(t, diagnostic.Span{End: l.End()}, l.SpanFrom(diagnostic.Span{}))
+}
+
+func TestUnrecognized(t *testing.T) {
+	l := newLexer("a\n#")
+	start := diagnostic.Position{Offset: 2, Line: 1}
+	d := l.Unrecognized(start, "#")
+	require.Equal(t, diagnostic.Span{Start: start, End: diagnostic.Position{Offset: 3, Line: 1, Column: 1}}, d.Span)
+	require.Equal(t, "test.wit:2:1: unrecognized token '#'\n  |\n2 | #\n  | ^", d.Error())
+}
+
+func TestSynchronize(t *testing.T) {
+	failed := errors.New("failed")
+	type test struct {
+		name     string
+		skip     func(l *lexer) (bool, error)
+		err      error
+		messages []string
+	}
+	tests := []test{
+		{"skipped", func(l *lexer) (bool, error) { l.next(); return true, nil }, nil, []string{"failed"}},
+		{"not skipped", func(l *lexer) (bool, error) { return false, nil }, failed, []string{"failed"}},
+		{"skip error", func(l *lexer) (bool, error) { return false, errors.New("skip") }, errors.New("skip"), []string{"failed", "skip"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newLexer("abc")
+			start := l.Clone()
+			l.next()
+			l.next()
+			err := diagnostic.Synchronize(l, start, failed, func() (bool, error) { return test.skip(l) })
+			if test.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.err.Error())
+				// the error was reported so it is not reported again
+				l.ReportError(err)
+			}
+			var messages []string
+			for _, d := range l.Diagnostics() {
+				messages = append(messages, d.Message)
+			}
+			require.Equal(t, test.messages, messages)
+			// the failed error is reported at the end of the item before the lexer is rewound
+			require.Equal(t, diagnostic.Position{Offset: 2, Column: 2}, l.Diagnostics()[0].Span.Start)
+		})
+	}
+}
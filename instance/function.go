@@ -1,7 +1,10 @@
 package instance
 
 import (
+	"context"
+
 	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/values"
 )
 
 type Function interface {
@@ -17,9 +20,11 @@ func (*ModuleFunction) instance() {}
 
 type HostCodeFunction struct {
 	Type     api.FuncType
-	HostCode *HostFunction
+	HostCode HostFunction
 }
 
 func (*HostCodeFunction) instance() {}
 
-type HostFunction struct{}
+// HostFunction is implemented by the embedder. It receives the context of the Invoke that
+// called it and the arguments of the call, and returns values matching the results of the function type.
+type HostFunction func(ctx context.Context, args []values.Value) ([]values.Value, error)
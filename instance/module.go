@@ -15,4 +15,6 @@ type Module struct {
 	ElementAddresses  []address.Element
 	DataAddressses    []address.Data
 	Exports           []Export
+	// Names are the names of the module items or nil when the module does not have a name section
+	Names *api.NameSection
 }
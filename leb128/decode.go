@@ -1,67 +1,230 @@
+// Package leb128 encodes and decodes the LEB128 integers of the wasm binary format.
+//
+// Decoders are strict: an integer of N bits may use at most ceil(N/7) bytes and the unused bits
+// of its last byte must be zero for unsigned integers or a sign extension for signed integers.
+// Malformed input fails with the messages used by the spec's assert_malformed tests.
 package leb128
 
 import (
 	"bufio"
-	"fmt"
+	"errors"
 	"io"
 )
 
-func DecodeReader(r io.Reader) (uint32, int, error) {
-	var val uint32
-	shift := 0
-	total := 0
-	buf := make([]byte, 1)
-
-	for {
-		n, err := r.Read(buf)
-		if n == 0 {
-			return 0, 0, fmt.Errorf("expected 1 byte read but read 0")
-		}
+var (
+	// ErrUnexpectedEnd is returned when the input ends before the last byte of an integer
+	ErrUnexpectedEnd = errors.New("unexpected end")
+	// ErrTooLong is returned when an integer uses more bytes than its size allows
+	ErrTooLong = errors.New("integer representation too long")
+	// ErrTooLarge is returned when the unused bits of the last byte of an integer are set
+	ErrTooLarge = errors.New("integer too large")
+)
+
+const (
+	continuation = 0b_1000_0000
+	payload      = 0b_0111_1111
+	signBit      = 0b_0100_0000
+)
+
+// DecodeUnsigned decodes an unsigned integer of the given number of bits, up to 64, and returns the number of bytes read
+func DecodeUnsigned(r io.ByteReader, bits uint) (uint64, int, error) {
+	var value uint64
+	var shift uint
+	for n := 1; ; n++ {
+		b, err := r.ReadByte()
 		if err != nil {
-			return 0, 0, err
+			return 0, n - 1, end(err)
 		}
-		b := buf[0]
-		total++
-		val |= (uint32(b&0b_0111_1111) << shift)
-		if b&0b_1000_0000 == 0 {
-			break
+		if err := checkUnsigned(b, shift, bits); err != nil {
+			return 0, n, err
+		}
+		value |= uint64(b&payload) << shift
+		if b&continuation == 0 {
+			return value, n, nil
 		}
 		shift += 7
 	}
-	return val, total, nil
 }
 
-func Decode(r *bufio.Reader) (uint32, int, error) {
-	var val uint32
-	shift := 0
-	total := 0
-	for {
+// DecodeSigned decodes a signed integer of the given number of bits, up to 64, and returns the number of bytes read
+func DecodeSigned(r io.ByteReader, bits uint) (int64, int, error) {
+	var value int64
+	var shift uint
+	for n := 1; ; n++ {
 		b, err := r.ReadByte()
 		if err != nil {
-			return 0, 0, err
+			return 0, n - 1, end(err)
 		}
-		total++
-		val |= (uint32(b&0b_0111_1111) << shift)
-		if b&0b_1000_0000 == 0 {
-			break
+		if err := checkSigned(b, shift, bits); err != nil {
+			return 0, n, err
+		}
+		value, shift = accumulate(value, shift, b)
+		if b&continuation == 0 {
+			return value, n, nil
 		}
-		shift += 7
 	}
-	return val, total, nil
 }
 
-func DecodeSlice(s []byte) (uint32, int, error) {
-	var val uint32
-	shift := 0
-	total := 0
-	for index := 0; index < len(s); index++ {
-		b := s[index]
-		total++
-		val |= (uint32(b&0b_0111_1111) << shift)
-		if b&0b_1000_0000 == 0 {
-			break
+// DecodeUnsignedSlice decodes an unsigned integer of the given number of bits from the start of s
+func DecodeUnsignedSlice(s []byte, bits uint) (uint64, int, error) {
+	var value uint64
+	var shift uint
+	for i, b := range s {
+		if err := checkUnsigned(b, shift, bits); err != nil {
+			return 0, i + 1, err
+		}
+		value |= uint64(b&payload) << shift
+		if b&continuation == 0 {
+			return value, i + 1, nil
 		}
 		shift += 7
 	}
-	return val, total, nil
+	return 0, len(s), ErrUnexpectedEnd
+}
+
+// DecodeSignedSlice decodes a signed integer of the given number of bits from the start of s
+func DecodeSignedSlice(s []byte, bits uint) (int64, int, error) {
+	var value int64
+	var shift uint
+	for i, b := range s {
+		if err := checkSigned(b, shift, bits); err != nil {
+			return 0, i + 1, err
+		}
+		value, shift = accumulate(value, shift, b)
+		if b&continuation == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, len(s), ErrUnexpectedEnd
+}
+
+// DecodeReader decodes an unsigned 32 bit value
+func DecodeReader(r io.Reader) (uint32, int, error) {
+	value, n, err := DecodeUnsigned(byteReader(r), 32)
+	return uint32(value), n, err
+}
+
+// Decode decodes an unsigned 32 bit value
+func Decode(r *bufio.Reader) (uint32, int, error) {
+	value, n, err := DecodeUnsigned(r, 32)
+	return uint32(value), n, err
+}
+
+// DecodeSlice decodes an unsigned 32 bit value
+func DecodeSlice(s []byte) (uint32, int, error) {
+	value, n, err := DecodeUnsignedSlice(s, 32)
+	return uint32(value), n, err
+}
+
+// DecodeU64Reader decodes an unsigned 64 bit value
+func DecodeU64Reader(r io.Reader) (uint64, int, error) {
+	return DecodeUnsigned(byteReader(r), 64)
+}
+
+// DecodeU64Slice decodes an unsigned 64 bit value
+func DecodeU64Slice(s []byte) (uint64, int, error) {
+	return DecodeUnsignedSlice(s, 64)
+}
+
+// DecodeSignedReader decodes a signed 32 bit value
+func DecodeSignedReader(r io.Reader) (int32, int, error) {
+	value, n, err := DecodeSigned(byteReader(r), 32)
+	return int32(value), n, err
+}
+
+// DecodeS32Slice decodes a signed 32 bit value
+func DecodeS32Slice(s []byte) (int32, int, error) {
+	value, n, err := DecodeSignedSlice(s, 32)
+	return int32(value), n, err
+}
+
+// DecodeS33Reader decodes the signed 33 bit value of a block type
+func DecodeS33Reader(r io.Reader) (int64, int, error) {
+	return DecodeSigned(byteReader(r), 33)
+}
+
+// DecodeS33Slice decodes the signed 33 bit value of a block type
+func DecodeS33Slice(s []byte) (int64, int, error) {
+	return DecodeSignedSlice(s, 33)
+}
+
+// DecodeS64Reader decodes a signed 64 bit value
+func DecodeS64Reader(r io.Reader) (int64, int, error) {
+	return DecodeSigned(byteReader(r), 64)
+}
+
+// DecodeS64Slice decodes a signed 64 bit value
+func DecodeS64Slice(s []byte) (int64, int, error) {
+	return DecodeSignedSlice(s, 64)
+}
+
+// checkUnsigned rejects a continuation or set unused bits in the last byte allowed for bits
+func checkUnsigned(b byte, shift, bits uint) error {
+	if shift+7 < bits {
+		return nil
+	}
+	if b&continuation != 0 {
+		return ErrTooLong
+	}
+	if b&payload>>(bits-shift) != 0 {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// checkSigned rejects a continuation in the last byte allowed for bits and unused bits that are not a sign extension
+func checkSigned(b byte, shift, bits uint) error {
+	if shift+7 < bits {
+		return nil
+	}
+	if b&continuation != 0 {
+		return ErrTooLong
+	}
+	// the sign bit of the value and the bits above it must be equal
+	unused := byte(payload) &^ (1<<(bits-1-shift) - 1)
+	if top := b & unused; top != 0 && top != unused {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// accumulate adds the payload of b to value and sign extends it after the last byte
+func accumulate(value int64, shift uint, b byte) (int64, uint) {
+	value |= int64(b&payload) << shift
+	shift += 7
+	if b&continuation == 0 && shift < 64 && b&signBit != 0 {
+		value |= -1 << shift
+	}
+	return value, shift
+}
+
+func end(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrUnexpectedEnd
+	}
+	return err
+}
+
+// byteReader reads single bytes from r, readers that implement io.ByteReader are used directly
+func byteReader(r io.Reader) io.ByteReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return br
+	}
+	return &singleByteReader{r: r}
+}
+
+type singleByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (s *singleByteReader) ReadByte() (byte, error) {
+	n, err := s.r.Read(s.buf[:])
+	if n == 1 {
+		return s.buf[0], nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return 0, err
 }
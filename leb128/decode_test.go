@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"testing"
+	"testing/iotest"
 
 	"github.com/patrickhuber/go-wasm/leb128"
 	"github.com/stretchr/testify/require"
@@ -51,3 +52,159 @@ func TestLebUint128Decode(t *testing.T) {
 		})
 	}
 }
+
+func TestLebSigned(t *testing.T) {
+	type test struct {
+		name  string
+		buf   []byte
+		value int32
+	}
+	tests := []test{
+		{"zero", []byte{0x00}, 0},
+		{"positive", []byte{0x3f}, 63},
+		{"positive two bytes", []byte{0xc0, 0x00}, 64},
+		{"negative", []byte{0x7f}, -1},
+		{"negative two bytes", []byte{0xbf, 0x7f}, -65},
+		{"min", []byte{0x80, 0x80, 0x80, 0x80, 0x78}, -2147483648},
+		{"max", []byte{0xff, 0xff, 0xff, 0xff, 0x07}, 2147483647},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, n, err := leb128.DecodeSignedReader(bytes.NewReader(test.buf))
+			require.Nil(t, err)
+			require.Equal(t, test.value, result)
+			require.Equal(t, len(test.buf), n)
+
+			var buf bytes.Buffer
+			writer := bufio.NewWriter(&buf)
+			_, err = leb128.EncodeSigned(writer, test.value)
+			require.Nil(t, err)
+			require.Nil(t, writer.Flush())
+			require.Equal(t, test.buf, buf.Bytes())
+		})
+	}
+}
+
+func TestDecodeUnsigned(t *testing.T) {
+	type test struct {
+		name  string
+		bits  uint
+		buf   []byte
+		value uint64
+		err   error
+	}
+	tests := []test{
+		{"u32 zero", 32, []byte{0x00}, 0, nil},
+		{"u32 padded zero", 32, []byte{0x80, 0x80, 0x80, 0x80, 0x00}, 0, nil},
+		{"u32 max", 32, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0xffff_ffff, nil},
+		{"u32 too long", 32, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, leb128.ErrTooLong},
+		{"u32 too large", 32, []byte{0x80, 0x80, 0x80, 0x80, 0x70}, 0, leb128.ErrTooLarge},
+		{"u32 unused bit", 32, []byte{0x82, 0x80, 0x80, 0x80, 0x10}, 0, leb128.ErrTooLarge},
+		{"u32 truncated", 32, []byte{0x80, 0x80}, 0, leb128.ErrUnexpectedEnd},
+		{"u32 empty", 32, nil, 0, leb128.ErrUnexpectedEnd},
+		{"u64 max", 64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, 0xffff_ffff_ffff_ffff, nil},
+		{"u64 above u32", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x10}, 0x1_0000_0000, nil},
+		{"u64 too long", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, leb128.ErrTooLong},
+		{"u64 too large", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02}, 0, leb128.ErrTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, decode := range []func() (uint64, int, error){
+				func() (uint64, int, error) { return leb128.DecodeUnsigned(bytes.NewReader(test.buf), test.bits) },
+				func() (uint64, int, error) { return leb128.DecodeUnsignedSlice(test.buf, test.bits) },
+			} {
+				value, n, err := decode()
+				if test.err != nil {
+					require.ErrorIs(t, err, test.err)
+					require.EqualError(t, err, test.err.Error())
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, test.value, value)
+				require.Equal(t, len(test.buf), n)
+			}
+		})
+	}
+}
+
+func TestDecodeSigned(t *testing.T) {
+	type test struct {
+		name  string
+		bits  uint
+		buf   []byte
+		value int64
+		err   error
+	}
+	tests := []test{
+		{"s32 padded minus one", 32, []byte{0xff, 0xff, 0xff, 0xff, 0x7f}, -1, nil},
+		{"s32 min", 32, []byte{0x80, 0x80, 0x80, 0x80, 0x78}, -2147483648, nil},
+		{"s32 max", 32, []byte{0xff, 0xff, 0xff, 0xff, 0x07}, 2147483647, nil},
+		{"s32 too long", 32, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, 0, leb128.ErrTooLong},
+		{"s32 too large positive", 32, []byte{0x80, 0x80, 0x80, 0x80, 0x70}, 0, leb128.ErrTooLarge},
+		{"s32 too large negative", 32, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0, leb128.ErrTooLarge},
+		{"s32 truncated", 32, []byte{0xff}, 0, leb128.ErrUnexpectedEnd},
+		{"s33 u32 max", 33, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, 0xffff_ffff, nil},
+		{"s33 min", 33, []byte{0x80, 0x80, 0x80, 0x80, 0x70}, -0x1_0000_0000, nil},
+		{"s33 too large", 33, []byte{0x80, 0x80, 0x80, 0x80, 0x10}, 0, leb128.ErrTooLarge},
+		{"s33 too large negative", 33, []byte{0xff, 0xff, 0xff, 0xff, 0x1f}, 0, leb128.ErrTooLarge},
+		{"s64 min", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x7f}, -9223372036854775808, nil},
+		{"s64 max", 64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}, 9223372036854775807, nil},
+		{"s64 too long", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, 0, leb128.ErrTooLong},
+		{"s64 too large", 64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02}, 0, leb128.ErrTooLarge},
+		{"s64 too large negative", 64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7e}, 0, leb128.ErrTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, decode := range []func() (int64, int, error){
+				func() (int64, int, error) { return leb128.DecodeSigned(bytes.NewReader(test.buf), test.bits) },
+				func() (int64, int, error) { return leb128.DecodeSignedSlice(test.buf, test.bits) },
+			} {
+				value, n, err := decode()
+				if test.err != nil {
+					require.ErrorIs(t, err, test.err)
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, test.value, value)
+				require.Equal(t, len(test.buf), n)
+			}
+		})
+	}
+}
+
+func TestDecodeTyped(t *testing.T) {
+	// iotest.OneByteReader does not implement io.ByteReader
+	u64, _, err := leb128.DecodeU64Reader(iotest.OneByteReader(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x10})))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0x1_0000_0000), u64)
+
+	s33, _, err := leb128.DecodeS33Reader(iotest.OneByteReader(bytes.NewReader([]byte{0x40})))
+	require.NoError(t, err)
+	require.Equal(t, int64(-64), s33)
+
+	_, _, err = leb128.DecodeReader(iotest.OneByteReader(bytes.NewReader([]byte{0x80})))
+	require.ErrorIs(t, err, leb128.ErrUnexpectedEnd)
+
+	_, _, err = leb128.DecodeSlice([]byte{0xff, 0xff, 0xff, 0xff, 0x1f})
+	require.ErrorIs(t, err, leb128.ErrTooLarge)
+
+	s32, _, err := leb128.DecodeS32Slice([]byte{0x7f})
+	require.NoError(t, err)
+	require.Equal(t, int32(-1), s32)
+
+	s64, _, err := leb128.DecodeS64Reader(bytes.NewReader([]byte{0xc0, 0xbb, 0x78}))
+	require.NoError(t, err)
+	require.Equal(t, int64(-123456), s64)
+}
+
+func TestDecodeAllocations(t *testing.T) {
+	buf := []byte{0xc0, 0xbb, 0x78}
+	r := bytes.NewReader(buf)
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(buf)
+		_, _, _ = leb128.DecodeSigned(r, 64)
+		_, _, _ = leb128.DecodeS33Slice(buf)
+		_, _, _ = leb128.DecodeU64Slice(buf[2:])
+	})
+	require.Zero(t, allocs)
+}
@@ -1,23 +1,76 @@
 package leb128
 
-import "bufio"
+import "io"
 
-func Encode(w *bufio.Writer, value uint32) (int, error) {
+// Encode encodes an unsigned 32 bit value
+func Encode(w io.ByteWriter, value uint32) (int, error) {
+	return EncodeU64(w, uint64(value))
+}
+
+// EncodeSigned encodes a signed 32 bit value
+func EncodeSigned(w io.ByteWriter, value int32) (int, error) {
+	return EncodeS64(w, int64(value))
+}
+
+// EncodeU64 encodes an unsigned 64 bit value
+func EncodeU64(w io.ByteWriter, value uint64) (int, error) {
 	total := 0
 	for {
-		b := byte(value & 0b_0111_1111)
+		b := byte(value & payload)
 		value >>= 7
 		if value != 0 {
-			b |= 0b_1000_0000
+			b |= continuation
 		}
-		err := w.WriteByte(b)
-		if err != nil {
-			return 0, err
+		if err := w.WriteByte(b); err != nil {
+			return total, err
 		}
 		total++
 		if value == 0 {
-			break
+			return total, nil
+		}
+	}
+}
+
+// EncodeS64 encodes a signed 64 bit value, signed 33 bit block types use the same encoding
+func EncodeS64(w io.ByteWriter, value int64) (int, error) {
+	total := 0
+	for {
+		b := byte(value & payload)
+		value >>= 7
+		done := value == 0 && b&signBit == 0 || value == -1 && b&signBit != 0
+		if !done {
+			b |= continuation
+		}
+		if err := w.WriteByte(b); err != nil {
+			return total, err
+		}
+		total++
+		if done {
+			return total, nil
+		}
+	}
+}
+
+// AppendUnsigned appends the encoding of an unsigned value to dst
+func AppendUnsigned(dst []byte, value uint64) []byte {
+	for {
+		b := byte(value & payload)
+		value >>= 7
+		if value == 0 {
+			return append(dst, b)
+		}
+		dst = append(dst, b|continuation)
+	}
+}
+
+// AppendSigned appends the encoding of a signed value to dst
+func AppendSigned(dst []byte, value int64) []byte {
+	for {
+		b := byte(value & payload)
+		value >>= 7
+		if value == 0 && b&signBit == 0 || value == -1 && b&signBit != 0 {
+			return append(dst, b)
 		}
+		dst = append(dst, b|continuation)
 	}
-	return total, nil
 }
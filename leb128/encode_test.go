@@ -32,3 +32,39 @@ func TestEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestEncode64(t *testing.T) {
+	unsigned := []uint64{0, 127, 128, 624485, 0xffff_ffff, 0x1_0000_0000, 0xffff_ffff_ffff_ffff}
+	for _, value := range unsigned {
+		var buf bytes.Buffer
+		n, err := leb128.EncodeU64(&buf, value)
+		require.NoError(t, err)
+		require.Equal(t, buf.Len(), n)
+		require.Equal(t, buf.Bytes(), leb128.AppendUnsigned(nil, value))
+
+		decoded, _, err := leb128.DecodeU64Slice(buf.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, value, decoded)
+	}
+	signed := []int64{0, -1, 63, 64, -64, -65, -123456, -0x1_0000_0000, 0xffff_ffff, -9223372036854775808, 9223372036854775807}
+	for _, value := range signed {
+		var buf bytes.Buffer
+		n, err := leb128.EncodeS64(&buf, value)
+		require.NoError(t, err)
+		require.Equal(t, buf.Len(), n)
+		require.Equal(t, buf.Bytes(), leb128.AppendSigned(nil, value))
+
+		decoded, _, err := leb128.DecodeS64Slice(buf.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, value, decoded)
+	}
+}
+
+func TestAppendAllocations(t *testing.T) {
+	dst := make([]byte, 0, 10)
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = leb128.AppendSigned(dst[:0], -9223372036854775808)
+		dst = leb128.AppendUnsigned(dst[:0], 0xffff_ffff_ffff_ffff)
+	})
+	require.Zero(t, allocs)
+}
@@ -11,8 +11,9 @@ const (
 
 	End Opcode = 0x0b
 
-	Return Opcode = 0x0f
-	Call   Opcode = 0x10
+	Return       Opcode = 0x0f
+	Call         Opcode = 0x10
+	CallIndirect Opcode = 0x11
 
 	Drop Opcode = 0x1a
 
@@ -0,0 +1,530 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/instance"
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/patrickhuber/go-wasm/values"
+)
+
+// compiled returns the bytecode of the function at addr or nil when the function is not
+// a module function, does not compile or the store runs every function in the interpreter.
+// With the native engine the bytecode is also translated to machine code when the platform supports it,
+// a function that fails to assemble on such a platform is an error instead of running as bytecode.
+func (s *Store) compiled(addr address.Function) (*function, error) {
+	if s.Config.Engine == config.Interpreter {
+		return nil, nil
+	}
+	if int(addr) < len(s.code) && s.code[addr].done {
+		return s.code[addr].function, s.code[addr].err
+	}
+	for len(s.code) <= int(addr) {
+		s.code = append(s.code, compiledFunction{})
+	}
+	s.code[addr].done = true
+	fn, ok := s.Funcs[addr].(*instance.ModuleFunction)
+	if !ok || fn.Code.Load() != nil {
+		return nil, nil
+	}
+	compiled, err := compile(s, fn)
+	if err != nil {
+		return nil, nil
+	}
+	compiled.addr = addr
+	if s.Config.Engine == config.Native {
+		compiled.native, err = assemble(compiled)
+		if err != nil {
+			s.code[addr].err = fmt.Errorf("assemble function %d: %w", addr, err)
+			return nil, s.code[addr].err
+		}
+	}
+	s.code[addr].function = compiled
+	return compiled, nil
+}
+
+type compiledFunction struct {
+	function *function
+	// err is the error of a function that failed to assemble
+	err  error
+	done bool
+}
+
+// reserve grows the slots so they hold at least n values
+func (m *machine) reserve(n int) {
+	if n <= len(m.slots) {
+		return
+	}
+	size := 2 * len(m.slots)
+	if size < n {
+		size = n
+	}
+	if size < 1024 {
+		size = 1024
+	}
+	slots := make([]uint64, size)
+	copy(slots, m.slots)
+	m.slots = slots
+}
+
+// callCompiled runs compiled code with the arguments on the value stack and pushes its results
+func (m *machine) callCompiled(addr address.Function, fn *function) error {
+	params := len(fn.typ.Parameters.Types)
+	if len(m.stack.Values) < params {
+		return trap.New(trap.Unknown, "stack underflow calling function %d", addr)
+	}
+	height := len(m.stack.Values) - params
+	base := m.top
+	m.reserve(base + fn.frame)
+	for i, v := range m.stack.Values[height:] {
+		b, ok := bitsOf(v)
+		if !ok {
+			return fmt.Errorf("argument %d: unsupported value %T", i, v)
+		}
+		m.slots[base+i] = b
+	}
+	m.stack.Values = m.stack.Values[:height]
+	if err := m.run(fn, base); err != nil {
+		return err
+	}
+	for i, t := range fn.typ.Returns.Types {
+		m.push(valueOf(t, m.slots[base+i]))
+	}
+	return nil
+}
+
+// invoke calls the function at addr from compiled code with the arguments in the slots starting at base
+// and leaves its results there. Functions without bytecode are called through the value stack.
+func (m *machine) invoke(addr address.Function, base int) error {
+	fn, err := m.store.compiled(addr)
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		return m.run(fn, base)
+	}
+	ft, err := funcType(m.store.Funcs[addr])
+	if err != nil {
+		return err
+	}
+	height := len(m.stack.Values)
+	for i, t := range ft.Parameters.Types {
+		m.push(valueOf(t, m.slots[base+i]))
+	}
+	top := m.top
+	m.top = base + len(ft.Parameters.Types)
+	err = m.call(addr)
+	m.top = top
+	if err != nil {
+		return err
+	}
+	for i, v := range m.stack.Values[height:] {
+		b, ok := bitsOf(v)
+		if !ok {
+			return fmt.Errorf("result %d: unsupported value %T", i, v)
+		}
+		m.slots[base+i] = b
+	}
+	m.stack.Values = m.stack.Values[:height]
+	return nil
+}
+
+// run executes compiled code in the frame starting at fp
+func (m *machine) run(fn *function, fp int) error {
+	if err := m.enter(); err != nil {
+		return err
+	}
+	top := m.top
+	m.top = fp + fn.frame
+	m.reserve(m.top)
+	params := len(fn.typ.Parameters.Types)
+	for i := fp + params; i < fp+fn.locals; i++ {
+		m.slots[i] = 0
+	}
+	var pc int
+	var err error
+	if fn.native != nil {
+		pc, err = m.native(fn, fp)
+	} else {
+		pc, err = m.execute(fn, fp)
+	}
+	m.top = top
+	m.leave()
+	if err != nil {
+		return m.backtrace(err, fn.addr, int(fn.sources[pc]))
+	}
+	return nil
+}
+
+// execute runs bytecode in the frame starting at fp and returns the position of the instruction that
+// returned or failed
+func (m *machine) execute(fn *function, fp int) (int, error) {
+	s := m.slots[fp:m.top]
+	code := fn.code
+	for pc := 0; pc < len(code); pc++ {
+		in := &code[pc]
+		switch in.op {
+		case opCopy:
+			s[in.a] = s[in.b]
+		case opConst:
+			s[in.a] = in.imm
+		case opUnreachable:
+			return pc, trap.New(trap.Unreachable, "unreachable")
+		case opFuel:
+			if err := m.store.consume(in.imm); err != nil {
+				return pc, err
+			}
+		case opCheck:
+			if err := m.interrupted(); err != nil {
+				return pc, err
+			}
+		case opBr:
+			if in.imm > 0 && in.b != in.c {
+				copy(s[in.c:in.c+uint32(in.imm)], s[in.b:in.b+uint32(in.imm)])
+			}
+			pc = int(in.a) - 1
+		case opBrIf:
+			if uint32(s[in.b]) != 0 {
+				pc = int(in.a) - 1
+			}
+		case opBrUnless:
+			if uint32(s[in.b]) == 0 {
+				pc = int(in.a) - 1
+			}
+		case opBrTable:
+			i := uint32(s[in.b])
+			if i > in.c {
+				i = in.c
+			}
+			pc += int(i)
+		case opReturn:
+			if in.c > 0 && in.b != 0 {
+				copy(s[:in.c], s[in.b:in.b+in.c])
+			}
+			return pc, nil
+		case opCall:
+			if err := m.invoke(address.Function(in.imm), fp+int(in.b)); err != nil {
+				return pc, err
+			}
+			s = m.slots[fp : fp+fn.frame]
+		case opCallIndirect:
+			addr, err := m.element(in.a, uint32(s[in.c]), fn.types[in.imm])
+			if err != nil {
+				return pc, err
+			}
+			if err := m.invoke(addr, fp+int(in.b)); err != nil {
+				return pc, err
+			}
+			s = m.slots[fp : fp+fn.frame]
+		case opSelect:
+			if uint32(s[in.a+2]) == 0 {
+				s[in.a] = s[in.a+1]
+			}
+		case opGlobalGet:
+			s[in.a], _ = bitsOf(m.store.Globals[in.imm].Value)
+		case opGlobalSet:
+			g := &m.store.Globals[in.imm]
+			g.Value = valueOf(g.Type.Value, s[in.b])
+
+		case opI32Load:
+			b, err := m.address(in, uint32(s[in.b]), 4)
+			if err != nil {
+				return pc, err
+			}
+			s[in.a] = uint64(binary.LittleEndian.Uint32(b))
+		case opI32Load8S:
+			b, err := m.address(in, uint32(s[in.b]), 1)
+			if err != nil {
+				return pc, err
+			}
+			s[in.a] = uint64(uint32(int32(int8(b[0]))))
+		case opI32Load8U:
+			b, err := m.address(in, uint32(s[in.b]), 1)
+			if err != nil {
+				return pc, err
+			}
+			s[in.a] = uint64(b[0])
+		case opI32Load16S:
+			b, err := m.address(in, uint32(s[in.b]), 2)
+			if err != nil {
+				return pc, err
+			}
+			s[in.a] = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(b)))))
+		case opI32Load16U:
+			b, err := m.address(in, uint32(s[in.b]), 2)
+			if err != nil {
+				return pc, err
+			}
+			s[in.a] = uint64(binary.LittleEndian.Uint16(b))
+		case opI32Store:
+			b, err := m.address(in, uint32(s[in.a]), 4)
+			if err != nil {
+				return pc, err
+			}
+			binary.LittleEndian.PutUint32(b, uint32(s[in.b]))
+		case opI32Store8:
+			b, err := m.address(in, uint32(s[in.a]), 1)
+			if err != nil {
+				return pc, err
+			}
+			b[0] = byte(s[in.b])
+		case opI32Store16:
+			b, err := m.address(in, uint32(s[in.a]), 2)
+			if err != nil {
+				return pc, err
+			}
+			binary.LittleEndian.PutUint16(b, uint16(s[in.b]))
+		case opMemorySize:
+			s[in.a] = uint64(len(m.store.Mems[in.c].Data) / PageSize)
+		case opMemoryGrow:
+			s[in.a] = uint64(m.store.grow(&m.store.Mems[in.c], uint32(s[in.a])))
+		case opMemoryCopy:
+			mem := m.store.Mems[in.c].Data
+			dst, src, n := uint64(uint32(s[in.a])), uint64(uint32(s[in.a+1])), uint64(uint32(s[in.a+2]))
+			if src+n > uint64(len(mem)) || dst+n > uint64(len(mem)) {
+				return pc, trap.New(trap.OutOfBoundsMemory, "out of bounds memory access")
+			}
+			copy(mem[dst:dst+n], mem[src:src+n])
+
+		case opI32Eqz:
+			s[in.a] = bool64(uint32(s[in.b]) == 0)
+		case opI64Eqz:
+			s[in.a] = bool64(s[in.b] == 0)
+
+		case opI32Eq:
+			s[in.a] = bool64(uint32(s[in.b]) == uint32(s[in.c]))
+		case opI32Ne:
+			s[in.a] = bool64(uint32(s[in.b]) != uint32(s[in.c]))
+		case opI32LtS:
+			s[in.a] = bool64(int32(s[in.b]) < int32(s[in.c]))
+		case opI32LtU:
+			s[in.a] = bool64(uint32(s[in.b]) < uint32(s[in.c]))
+		case opI32GtS:
+			s[in.a] = bool64(int32(s[in.b]) > int32(s[in.c]))
+		case opI32GtU:
+			s[in.a] = bool64(uint32(s[in.b]) > uint32(s[in.c]))
+		case opI32LeS:
+			s[in.a] = bool64(int32(s[in.b]) <= int32(s[in.c]))
+		case opI32LeU:
+			s[in.a] = bool64(uint32(s[in.b]) <= uint32(s[in.c]))
+		case opI32GeS:
+			s[in.a] = bool64(int32(s[in.b]) >= int32(s[in.c]))
+		case opI32GeU:
+			s[in.a] = bool64(uint32(s[in.b]) >= uint32(s[in.c]))
+		case opI32Add:
+			s[in.a] = uint64(uint32(s[in.b]) + uint32(s[in.c]))
+		case opI32AddImm:
+			s[in.a] = uint64(uint32(s[in.b]) + uint32(in.imm))
+		case opI32Sub:
+			s[in.a] = uint64(uint32(s[in.b]) - uint32(s[in.c]))
+		case opI32Mul:
+			s[in.a] = uint64(uint32(s[in.b]) * uint32(s[in.c]))
+		case opI32DivS:
+			x, y := int32(s[in.b]), int32(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			if x == math.MinInt32 && y == -1 {
+				return pc, trap.New(trap.IntegerOverflow, "integer overflow")
+			}
+			s[in.a] = uint64(uint32(x / y))
+		case opI32DivU:
+			x, y := uint32(s[in.b]), uint32(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = uint64(x / y)
+		case opI32RemS:
+			x, y := int32(s[in.b]), int32(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = uint64(uint32(x % y))
+		case opI32RemU:
+			x, y := uint32(s[in.b]), uint32(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = uint64(x % y)
+		case opI32And:
+			s[in.a] = uint64(uint32(s[in.b]) & uint32(s[in.c]))
+		case opI32Or:
+			s[in.a] = uint64(uint32(s[in.b]) | uint32(s[in.c]))
+		case opI32Xor:
+			s[in.a] = uint64(uint32(s[in.b]) ^ uint32(s[in.c]))
+		case opI32Shl:
+			s[in.a] = uint64(uint32(s[in.b]) << (uint32(s[in.c]) % 32))
+		case opI32ShrS:
+			s[in.a] = uint64(uint32(int32(s[in.b]) >> (uint32(s[in.c]) % 32)))
+		case opI32ShrU:
+			s[in.a] = uint64(uint32(s[in.b]) >> (uint32(s[in.c]) % 32))
+		case opI32Rotl:
+			s[in.a] = uint64(bits.RotateLeft32(uint32(s[in.b]), int(uint32(s[in.c])%32)))
+		case opI32Rotr:
+			s[in.a] = uint64(bits.RotateLeft32(uint32(s[in.b]), -int(uint32(s[in.c])%32)))
+
+		case opI64Eq:
+			s[in.a] = bool64(s[in.b] == s[in.c])
+		case opI64Ne:
+			s[in.a] = bool64(s[in.b] != s[in.c])
+		case opI64LtS:
+			s[in.a] = bool64(int64(s[in.b]) < int64(s[in.c]))
+		case opI64LtU:
+			s[in.a] = bool64(s[in.b] < s[in.c])
+		case opI64GtS:
+			s[in.a] = bool64(int64(s[in.b]) > int64(s[in.c]))
+		case opI64GtU:
+			s[in.a] = bool64(s[in.b] > s[in.c])
+		case opI64LeS:
+			s[in.a] = bool64(int64(s[in.b]) <= int64(s[in.c]))
+		case opI64LeU:
+			s[in.a] = bool64(s[in.b] <= s[in.c])
+		case opI64GeS:
+			s[in.a] = bool64(int64(s[in.b]) >= int64(s[in.c]))
+		case opI64GeU:
+			s[in.a] = bool64(s[in.b] >= s[in.c])
+		case opI64Add:
+			s[in.a] = s[in.b] + s[in.c]
+		case opI64Sub:
+			s[in.a] = s[in.b] - s[in.c]
+		case opI64Mul:
+			s[in.a] = s[in.b] * s[in.c]
+		case opI64DivS:
+			x, y := int64(s[in.b]), int64(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			if x == math.MinInt64 && y == -1 {
+				return pc, trap.New(trap.IntegerOverflow, "integer overflow")
+			}
+			s[in.a] = uint64(x / y)
+		case opI64DivU:
+			if s[in.c] == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = s[in.b] / s[in.c]
+		case opI64RemS:
+			x, y := int64(s[in.b]), int64(s[in.c])
+			if y == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = uint64(x % y)
+		case opI64RemU:
+			if s[in.c] == 0 {
+				return pc, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			s[in.a] = s[in.b] % s[in.c]
+		case opI64And:
+			s[in.a] = s[in.b] & s[in.c]
+		case opI64Or:
+			s[in.a] = s[in.b] | s[in.c]
+		case opI64Xor:
+			s[in.a] = s[in.b] ^ s[in.c]
+		case opI64Shl:
+			s[in.a] = s[in.b] << (s[in.c] % 64)
+		case opI64ShrS:
+			s[in.a] = uint64(int64(s[in.b]) >> (s[in.c] % 64))
+		case opI64ShrU:
+			s[in.a] = s[in.b] >> (s[in.c] % 64)
+		case opI64Rotl:
+			s[in.a] = bits.RotateLeft64(s[in.b], int(s[in.c]%64))
+		case opI64Rotr:
+			s[in.a] = bits.RotateLeft64(s[in.b], -int(s[in.c]%64))
+
+		default:
+			return pc, fmt.Errorf("unsupported bytecode %d", in.op)
+		}
+	}
+	return len(code), nil
+}
+
+// address returns the bytes at the effective address of a load or store
+func (m *machine) address(in *instr, base uint32, size uint64) ([]byte, error) {
+	mem := m.store.Mems[in.c].Data
+	ea := uint64(base) + in.imm
+	if ea+size > uint64(len(mem)) {
+		return nil, trap.New(trap.OutOfBoundsMemory, "out of bounds memory access at %d", ea)
+	}
+	return mem[ea : ea+size], nil
+}
+
+// element returns the function referenced by an element of a table after checking its type
+func (m *machine) element(table uint32, index uint32, expected api.FuncType) (address.Function, error) {
+	elements := m.store.Tables[table].Element
+	if int(index) >= len(elements) {
+		return 0, trap.New(trap.UndefinedElement, "undefined element %d", index)
+	}
+	ref, ok := elements[index].(*values.FunctionReference)
+	if !ok {
+		return 0, trap.New(trap.UninitializedElement, "uninitialized element %d", index)
+	}
+	ft, err := funcType(m.store.Funcs[ref.Address])
+	if err != nil {
+		return 0, err
+	}
+	if !sameTypes(ft.Parameters.Types, expected.Parameters.Types) || !sameTypes(ft.Returns.Types, expected.Returns.Types) {
+		return 0, trap.New(trap.IndirectCallTypeMismatch, "indirect call type mismatch")
+	}
+	return ref.Address, nil
+}
+
+// grow adds delta pages to a memory and returns the previous number of pages or -1 when the memory can not grow
+// beyond its maximum or the memory pages limit of the store
+func (s *Store) grow(mem *instance.Memory, delta uint32) uint32 {
+	pages := uint64(len(mem.Data) / PageSize)
+	max := uint64(MaxPages)
+	if limit := uint64(s.Config.Limits.WithDefaults().MemoryPages); limit < max {
+		max = limit
+	}
+	if limit, ok := limitsMax(mem.Type.Limits); ok && uint64(limit) < max {
+		max = uint64(limit)
+	}
+	if pages+uint64(delta) > max {
+		return math.MaxUint32
+	}
+	mem.Data = append(mem.Data, make([]byte, int(delta)*PageSize)...)
+	return uint32(pages)
+}
+
+func bool64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bitsOf returns the representation of a numeric value in a slot
+func bitsOf(v values.Value) (uint64, bool) {
+	switch n := v.(type) {
+	case values.I32Const:
+		return uint64(uint32(n)), true
+	case values.I64Const:
+		return uint64(n), true
+	case values.F32Const:
+		return uint64(math.Float32bits(float32(n))), true
+	case values.F64Const:
+		return math.Float64bits(float64(n)), true
+	}
+	return 0, false
+}
+
+// valueOf returns the numeric value of type t held by a slot
+func valueOf(t api.ValType, b uint64) values.Value {
+	switch t {
+	case api.I32Type:
+		return values.I32Const(uint32(b))
+	case api.I64Type:
+		return values.I64Const(b)
+	case api.F32Type:
+		return values.F32Const(math.Float32frombits(uint32(b)))
+	case api.F64Type:
+		return values.F64Const(math.Float64frombits(b))
+	}
+	return nil
+}
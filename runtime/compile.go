@@ -0,0 +1,924 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/instance"
+)
+
+// op is an operation of the bytecode that function bodies are compiled to. Operands are slots of the frame
+// of the function: the locals followed by the operand stack. The height of the operand stack is known at
+// every instruction so the slots of stack operands are resolved during compilation and nothing is pushed
+// or popped at run time.
+type op uint8
+
+const (
+	// opCopy sets a to b
+	opCopy op = iota
+	// opConst sets a to imm
+	opConst
+	// opUnreachable traps
+	opUnreachable
+	// opFuel consumes imm fuel from the store
+	opFuel
+	// opCheck traps when the call is interrupted, it starts every loop
+	opCheck
+	// opBr copies imm values from b to c and jumps to a
+	opBr
+	// opBrIf jumps to a when b is not zero
+	opBrIf
+	// opBrUnless jumps to a when b is zero
+	opBrUnless
+	// opBrTable skips the i'th of the c+1 opBr that follow, where i is b limited to c
+	opBrTable
+	// opReturn copies c values from b to the first slots of the frame and returns
+	opReturn
+	// opCall calls the function at address imm with the arguments starting at b
+	opCall
+	// opCallIndirect calls the function referenced by the element c of the table at address a
+	// with the arguments starting at b. imm is the index of the expected type.
+	opCallIndirect
+	// opSelect sets a to a+1 when a+2 is zero
+	opSelect
+	// opGlobalGet sets a to the global at address imm
+	opGlobalGet
+	// opGlobalSet sets the global at address imm to b
+	opGlobalSet
+
+	// loads set a to the value at b+imm in the memory at address c
+	opI32Load
+	opI32Load8S
+	opI32Load8U
+	opI32Load16S
+	opI32Load16U
+	// stores write b at a+imm in the memory at address c
+	opI32Store
+	opI32Store8
+	opI32Store16
+	// opMemorySize sets a to the pages of the memory at address c
+	opMemorySize
+	// opMemoryGrow grows the memory at address c by a pages and sets a to the previous size
+	opMemoryGrow
+	// opMemoryCopy copies a+2 bytes from a+1 to a in the memory at address c
+	opMemoryCopy
+
+	// unary operations set a to op b
+	opI32Eqz
+	opI64Eqz
+
+	// binary operations set a to b op c
+	opI32Eq
+	opI32Ne
+	opI32LtS
+	opI32LtU
+	opI32GtS
+	opI32GtU
+	opI32LeS
+	opI32LeU
+	opI32GeS
+	opI32GeU
+	opI32Add
+	opI32Sub
+	opI32Mul
+	opI32DivS
+	opI32DivU
+	opI32RemS
+	opI32RemU
+	opI32And
+	opI32Or
+	opI32Xor
+	opI32Shl
+	opI32ShrS
+	opI32ShrU
+	opI32Rotl
+	opI32Rotr
+	opI64Eq
+	opI64Ne
+	opI64LtS
+	opI64LtU
+	opI64GtS
+	opI64GtU
+	opI64LeS
+	opI64LeU
+	opI64GeS
+	opI64GeU
+	opI64Add
+	opI64Sub
+	opI64Mul
+	opI64DivS
+	opI64DivU
+	opI64RemS
+	opI64RemU
+	opI64And
+	opI64Or
+	opI64Xor
+	opI64Shl
+	opI64ShrS
+	opI64ShrU
+	opI64Rotl
+	opI64Rotr
+
+	// opI32AddImm is the superinstruction for i32.const followed by i32.add, it sets a to b + imm
+	opI32AddImm
+)
+
+// instr is an instruction of the bytecode, the meaning of the operands depends on the op
+type instr struct {
+	op      op
+	a, b, c uint32
+	imm     uint64
+}
+
+// pure returns true for operations that only write a, the slot they write may be changed to a local
+func (o op) pure() bool {
+	return o == opCopy || o == opConst || o >= opI32Eqz
+}
+
+// function is a function body compiled to bytecode
+type function struct {
+	code []instr
+	// sources are the indices of the instructions of the function body that the bytecode was compiled from,
+	// the instructions of blocks are counted after the block in the order they appear in the code
+	sources []uint32
+	// addr is the address of the function in the store
+	addr address.Function
+	// types are the expected types of indirect calls
+	types  []api.FuncType
+	typ    api.FuncType
+	locals int
+	// frame is the number of slots used by the locals and the operand stack
+	frame int
+	// native is the machine code of the function when it runs in the native engine
+	native *native
+}
+
+// label is the target of a branch
+type label struct {
+	// height is the height of the operand stack below the parameters of the block
+	height  int
+	params  int
+	results int
+	loop    bool
+	// start is the position of the first instruction of a loop
+	start int
+	// branches are the positions of the branches to the end of a block
+	branches []int
+}
+
+// arity is the number of values passed by a branch to the label
+func (l *label) arity() int {
+	if l.loop {
+		return l.params
+	}
+	return l.results
+}
+
+type compiler struct {
+	store    *Store
+	module   *instance.Module
+	function *function
+	labels   []*label
+	height   int
+	// barrier is the last position targeted by a branch, instructions before it can not be combined with later ones
+	barrier int
+	// cost is the fuel consumed by each instruction, it is nil when fuel is not enabled
+	cost func(api.Instruction) uint64
+	// fuel is the position of the opFuel that consumes the fuel of the current sequence or -1 when there is none
+	fuel int
+	// source is the index of the instruction being compiled, next is the index of the following one
+	source, next uint32
+}
+
+// compile translates the body of a module function to bytecode. Bodies that use instructions or
+// value types the bytecode does not support fail to compile and run in the interpreter.
+func compile(store *Store, fn *instance.ModuleFunction) (*function, error) {
+	locals := append(append([]api.ValType{}, fn.Type.Parameters.Types...), fn.Code.Locals...)
+	for _, t := range append(locals, fn.Type.Returns.Types...) {
+		if !numeric(t) {
+			return nil, fmt.Errorf("unsupported value type %v", t)
+		}
+	}
+	c := &compiler{
+		store:    store,
+		module:   fn.Module,
+		function: &function{typ: fn.Type, locals: len(locals)},
+		height:   len(locals),
+		fuel:     -1,
+	}
+	if store.Config.Fuel.Enabled {
+		c.cost = store.fuelCost()
+	}
+	c.function.frame = c.height
+	// the body of the function is a block, a branch to its label returns
+	c.labels = []*label{{height: c.height, results: len(fn.Type.Returns.Types)}}
+	var instructions []api.Instruction
+	if fn.Code.Body != nil {
+		instructions = fn.Code.Body.Instructions
+	}
+	terminated, err := c.sequence(instructions)
+	if err != nil {
+		return nil, err
+	}
+	if !terminated {
+		if err := c.ret(); err != nil {
+			return nil, err
+		}
+	}
+	return c.function, nil
+}
+
+func numeric(t api.ValType) bool {
+	switch t {
+	case api.I32Type, api.I64Type, api.F32Type, api.F64Type:
+		return true
+	}
+	return false
+}
+
+func (c *compiler) emit(in instr) {
+	c.function.code = append(c.function.code, in)
+	c.function.sources = append(c.function.sources, c.source)
+}
+
+func (c *compiler) pc() int {
+	return len(c.function.code)
+}
+
+// mark records that a branch targets the current position
+func (c *compiler) mark() int {
+	c.barrier = c.pc()
+	c.fuel = -1
+	return c.barrier
+}
+
+// charge adds the cost of an instruction to the opFuel at the start of the sequence that contains it.
+// Sequences end at branches, calls and the targets of branches, so the fuel consumed is the cost of the
+// instructions that run, as in the interpreter, unless an instruction traps.
+func (c *compiler) charge(instruction api.Instruction) {
+	if c.cost == nil {
+		return
+	}
+	cost := c.cost(instruction)
+	if cost == 0 {
+		return
+	}
+	if c.fuel < 0 {
+		c.fuel = c.pc()
+		c.emit(instr{op: opFuel})
+	}
+	c.function.code[c.fuel].imm += cost
+}
+
+// last returns the last instruction when it can be combined with the next one
+func (c *compiler) last() *instr {
+	if c.pc() == 0 || c.pc()-1 < c.barrier {
+		return nil
+	}
+	return &c.function.code[c.pc()-1]
+}
+
+func (c *compiler) drop() {
+	c.function.code = c.function.code[:c.pc()-1]
+	c.function.sources = c.function.sources[:c.pc()]
+}
+
+// pop removes n values from the operand stack and returns the slot of the first
+func (c *compiler) pop(n int) (uint32, error) {
+	if c.height-n < c.labels[len(c.labels)-1].height {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	c.height -= n
+	return uint32(c.height), nil
+}
+
+// push adds n values to the operand stack and returns the slot of the first
+func (c *compiler) push(n int) uint32 {
+	slot := c.height
+	c.height += n
+	if c.height > c.function.frame {
+		c.function.frame = c.height
+	}
+	return uint32(slot)
+}
+
+// operand returns the slot that holds the value at slot. When the value was copied from a local by the
+// last instruction, the copy is removed and the slot of the local is returned.
+func (c *compiler) operand(slot uint32) uint32 {
+	if last := c.last(); last != nil && last.op == opCopy && last.a == slot {
+		local := last.b
+		c.drop()
+		return local
+	}
+	return slot
+}
+
+// sequence compiles instructions and returns true when the end of the sequence is unreachable
+func (c *compiler) sequence(instructions []api.Instruction) (bool, error) {
+	for i, instruction := range instructions {
+		c.source = c.next
+		c.next++
+		c.charge(instruction)
+		terminated, err := c.instruction(instruction)
+		if err != nil {
+			return false, err
+		}
+		switch instruction.(type) {
+		case *api.BranchIf, *api.Call, *api.CallIndirect:
+			// the instructions that follow run when the branch is not taken or the call returns
+			c.fuel = -1
+		}
+		if terminated {
+			// the rest of the sequence can not be reached
+			c.next += uint32(count(instructions[i+1:]))
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *compiler) instruction(instruction api.Instruction) (bool, error) {
+	switch inst := instruction.(type) {
+
+	// control
+	case api.End, *api.Nop:
+	case *api.Unreachable:
+		c.emit(instr{op: opUnreachable})
+		return true, nil
+	case *api.Block:
+		return false, c.block(inst.Type, inst.Instructions, false)
+	case *api.Loop:
+		return false, c.block(inst.Type, inst.Instructions, true)
+	case *api.If:
+		return false, c.ifElse(inst)
+	case *api.Branch:
+		return true, c.jump(inst.Index)
+	case *api.BranchIf:
+		return false, c.branchIf(inst.Index)
+	case *api.BranchTable:
+		return true, c.branchTable(inst)
+	case *api.Return:
+		return true, c.ret()
+	case *api.Call:
+		return false, c.call(inst)
+	case *api.CallIndirect:
+		return false, c.callIndirect(inst)
+
+	// parametric
+	case *api.Drop:
+		_, err := c.pop(1)
+		return false, err
+	case *api.Select:
+		slot, err := c.pop(3)
+		if err != nil {
+			return false, err
+		}
+		c.emit(instr{op: opSelect, a: slot})
+		c.push(1)
+
+	// variable
+	case api.LocalGet:
+		if int(inst.Index) >= c.function.locals {
+			return false, fmt.Errorf("local index %d out of range", inst.Index)
+		}
+		c.emit(instr{op: opCopy, a: c.push(1), b: uint32(inst.Index)})
+	case api.LocalSet:
+		return false, c.setLocal(inst.Index, false)
+	case api.LocalTee:
+		return false, c.setLocal(inst.Index, true)
+	case api.GlobalGet:
+		global, err := c.global(inst.Index)
+		if err != nil {
+			return false, err
+		}
+		c.emit(instr{op: opGlobalGet, a: c.push(1), imm: uint64(global)})
+	case api.GlobalSet:
+		global, err := c.global(inst.Index)
+		if err != nil {
+			return false, err
+		}
+		if c.store.Globals[global].Type.Mutable != api.Var {
+			return false, fmt.Errorf("global %d is immutable", inst.Index)
+		}
+		slot, err := c.pop(1)
+		if err != nil {
+			return false, err
+		}
+		c.emit(instr{op: opGlobalSet, b: slot, imm: uint64(global)})
+
+	// memory
+	case *api.Int32Load:
+		return false, c.load(opI32Load, inst.MemoryArg)
+	case *api.I32Load8:
+		return false, c.load(opI32Load8S, inst.MemoryArg)
+	case *api.U32Load8u:
+		return false, c.load(opI32Load8U, inst.MemoryArg)
+	case *api.I32Load16:
+		return false, c.load(opI32Load16S, inst.MemoryArg)
+	case *api.U32Load16:
+		return false, c.load(opI32Load16U, inst.MemoryArg)
+	case *api.Int32Store:
+		return false, c.store32(opI32Store, inst.MemoryArg)
+	case *api.I32Store8:
+		return false, c.store32(opI32Store8, inst.MemoryArg)
+	case *api.U32Store8:
+		return false, c.store32(opI32Store8, inst.MemoryArg)
+	case *api.I32Store16:
+		return false, c.store32(opI32Store16, inst.MemoryArg)
+	case *api.U32Store16:
+		return false, c.store32(opI32Store16, inst.MemoryArg)
+	case *api.MemorySize:
+		mem, err := c.memory()
+		if err != nil {
+			return false, err
+		}
+		c.emit(instr{op: opMemorySize, a: c.push(1), c: mem})
+	case *api.MemoryGrow:
+		return false, c.memoryOp(opMemoryGrow, 1, 1)
+	case *api.MemoryCopy:
+		return false, c.memoryOp(opMemoryCopy, 3, 0)
+
+	// numeric
+	case api.I32Const:
+		c.emit(instr{op: opConst, a: c.push(1), imm: uint64(uint32(inst))})
+	case api.I64Const:
+		c.emit(instr{op: opConst, a: c.push(1), imm: uint64(inst)})
+	case api.F32Const:
+		c.emit(instr{op: opConst, a: c.push(1), imm: uint64(math.Float32bits(float32(inst)))})
+	case api.F64Const:
+		c.emit(instr{op: opConst, a: c.push(1), imm: math.Float64bits(float64(inst))})
+	case api.I32Eqz:
+		return false, c.unary(opI32Eqz)
+	case api.I64Eqz:
+		return false, c.unary(opI64Eqz)
+	case api.I32Add:
+		return false, c.add()
+	default:
+		o, ok := binaryOp(instruction)
+		if !ok {
+			return false, fmt.Errorf("unsupported instruction %T", instruction)
+		}
+		return false, c.binary(o)
+	}
+	return false, nil
+}
+
+// block compiles a block or loop
+func (c *compiler) block(bt api.BlockType, instructions []api.Instruction, loop bool) error {
+	params, results, err := blockArity(c.module, bt)
+	if err != nil {
+		return err
+	}
+	if _, err := c.pop(params); err != nil {
+		return err
+	}
+	l := &label{height: c.height, params: params, results: results, loop: loop}
+	c.push(params)
+	if loop {
+		l.start = c.mark()
+		c.emit(instr{op: opCheck})
+	}
+	c.labels = append(c.labels, l)
+	if err := c.body(l, instructions); err != nil {
+		return err
+	}
+	c.labels = c.labels[:len(c.labels)-1]
+	for _, branch := range l.branches {
+		c.function.code[branch].a = uint32(c.pc())
+	}
+	if len(l.branches) > 0 {
+		c.mark()
+	}
+	c.height = l.height
+	c.push(results)
+	return nil
+}
+
+// body compiles the instructions of a block and checks the results left on the operand stack
+func (c *compiler) body(l *label, instructions []api.Instruction) error {
+	terminated, err := c.sequence(instructions)
+	if err != nil {
+		return err
+	}
+	if !terminated && c.height != l.height+l.results {
+		return fmt.Errorf("block leaves %d values, expected %d", c.height-l.height, l.results)
+	}
+	return nil
+}
+
+func (c *compiler) ifElse(inst *api.If) error {
+	cond, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	params, results, err := blockArity(c.module, inst.Type)
+	if err != nil {
+		return err
+	}
+	if inst.Else == nil && params != results {
+		return fmt.Errorf("if without else must have as many results as parameters")
+	}
+	if _, err := c.pop(params); err != nil {
+		return err
+	}
+	l := &label{height: c.height, params: params, results: results}
+	c.push(params)
+	c.labels = append(c.labels, l)
+	skip := c.branchUnless(cond)
+	c.fuel = -1
+	if err := c.body(l, inst.Instructions); err != nil {
+		return err
+	}
+	if inst.Else != nil {
+		l.branches = append(l.branches, c.pc())
+		c.emit(instr{op: opBr})
+		c.function.code[skip].a = uint32(c.mark())
+		c.height = l.height + params
+		if err := c.body(l, inst.Else.Instructions); err != nil {
+			return err
+		}
+	} else {
+		l.branches = append(l.branches, skip)
+	}
+	c.labels = c.labels[:len(c.labels)-1]
+	for _, branch := range l.branches {
+		c.function.code[branch].a = uint32(c.pc())
+	}
+	c.mark()
+	c.height = l.height
+	c.push(results)
+	return nil
+}
+
+// branchUnless emits a branch taken when cond is zero and returns its position. A preceding eqz is
+// combined with the branch.
+func (c *compiler) branchUnless(cond uint32) int {
+	if last := c.last(); last != nil && last.op == opI32Eqz && last.a == cond {
+		last.op = opBrIf
+		last.a = 0
+		return c.pc() - 1
+	}
+	c.emit(instr{op: opBrUnless, b: cond})
+	return c.pc() - 1
+}
+
+func (c *compiler) target(index api.LabelIndex) (*label, error) {
+	if int(index) >= len(c.labels) {
+		return nil, fmt.Errorf("label index %d out of range", index)
+	}
+	return c.labels[len(c.labels)-1-int(index)], nil
+}
+
+// jump emits a branch to a label that moves the values passed to the label to the height of the label
+func (c *compiler) jump(index api.LabelIndex) error {
+	l, err := c.target(index)
+	if err != nil {
+		return err
+	}
+	if l == c.labels[0] {
+		return c.ret()
+	}
+	arity := l.arity()
+	if c.height-arity < l.height {
+		return fmt.Errorf("stack underflow")
+	}
+	in := instr{op: opBr, b: uint32(c.height - arity), c: uint32(l.height), imm: uint64(arity)}
+	if l.loop {
+		in.a = uint32(l.start)
+	} else {
+		l.branches = append(l.branches, c.pc())
+	}
+	c.emit(in)
+	return nil
+}
+
+func (c *compiler) branchIf(index api.LabelIndex) error {
+	cond, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	l, err := c.target(index)
+	if err != nil {
+		return err
+	}
+	arity := l.arity()
+	if l != c.labels[0] && (arity == 0 || c.height-arity == l.height) {
+		// no values are moved so the branch is a single instruction
+		in := instr{op: opBrIf, b: cond}
+		if last := c.last(); last != nil && last.op == opI32Eqz && last.a == cond {
+			in.op = opBrUnless
+			in.b = last.b
+			c.drop()
+		}
+		if l.loop {
+			in.a = uint32(l.start)
+		} else {
+			l.branches = append(l.branches, c.pc())
+		}
+		c.emit(in)
+		return nil
+	}
+	skip := c.branchUnless(cond)
+	if err := c.jump(index); err != nil {
+		return err
+	}
+	c.function.code[skip].a = uint32(c.mark())
+	return nil
+}
+
+func (c *compiler) branchTable(inst *api.BranchTable) error {
+	index, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	c.emit(instr{op: opBrTable, b: index, c: uint32(len(inst.Indicies))})
+	for _, label := range append(inst.Indicies, inst.Index) {
+		if err := c.jump(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) ret() error {
+	results := len(c.function.typ.Returns.Types)
+	if c.height-results < c.labels[0].height {
+		return fmt.Errorf("stack underflow")
+	}
+	c.emit(instr{op: opReturn, b: uint32(c.height - results), c: uint32(results)})
+	return nil
+}
+
+func (c *compiler) call(inst *api.Call) error {
+	if int(inst.Index) >= len(c.module.FunctionAddresses) {
+		return fmt.Errorf("function index %d out of range", inst.Index)
+	}
+	addr := c.module.FunctionAddresses[inst.Index]
+	ft, err := funcType(c.store.Funcs[addr])
+	if err != nil {
+		return err
+	}
+	base, err := c.pop(len(ft.Parameters.Types))
+	if err != nil {
+		return err
+	}
+	c.emit(instr{op: opCall, b: base, imm: uint64(addr)})
+	c.push(len(ft.Returns.Types))
+	return nil
+}
+
+func (c *compiler) callIndirect(inst *api.CallIndirect) error {
+	if int(inst.Table) >= len(c.module.TableAddresses) {
+		return fmt.Errorf("table index %d out of range", inst.Table)
+	}
+	if int(inst.Type) >= len(c.module.Types) {
+		return fmt.Errorf("type index %d out of range", inst.Type)
+	}
+	ft := c.module.Types[inst.Type]
+	index, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	base, err := c.pop(len(ft.Parameters.Types))
+	if err != nil {
+		return err
+	}
+	c.emit(instr{
+		op:  opCallIndirect,
+		a:   c.module.TableAddresses[inst.Table].Address,
+		b:   base,
+		c:   index,
+		imm: uint64(len(c.function.types)),
+	})
+	c.function.types = append(c.function.types, ft)
+	c.push(len(ft.Returns.Types))
+	return nil
+}
+
+// setLocal writes the top of the operand stack to a local. The instruction that computed the value
+// writes the local directly when possible.
+func (c *compiler) setLocal(index api.LocalIndex, tee bool) error {
+	if int(index) >= c.function.locals {
+		return fmt.Errorf("local index %d out of range", index)
+	}
+	slot, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	if tee {
+		c.emit(instr{op: opCopy, a: uint32(index), b: slot})
+		c.push(1)
+		return nil
+	}
+	if last := c.last(); last != nil && last.op.pure() && last.a == slot {
+		last.a = uint32(index)
+		return nil
+	}
+	c.emit(instr{op: opCopy, a: uint32(index), b: slot})
+	return nil
+}
+
+// global returns the address of a global with a numeric type
+func (c *compiler) global(index api.GlobalIndex) (uint32, error) {
+	if int(index) >= len(c.module.GlobalAddresses) {
+		return 0, fmt.Errorf("global index %d out of range", index)
+	}
+	global := c.module.GlobalAddresses[index].Address
+	if t := c.store.Globals[global].Type.Value; !numeric(t) {
+		return 0, fmt.Errorf("unsupported global type %v", t)
+	}
+	return global, nil
+}
+
+func (c *compiler) memory() (uint32, error) {
+	if len(c.module.MemoryAddresses) == 0 {
+		return 0, fmt.Errorf("module has no memory")
+	}
+	return c.module.MemoryAddresses[0].Address, nil
+}
+
+func (c *compiler) load(o op, arg api.MemoryArg) error {
+	mem, err := c.memory()
+	if err != nil {
+		return err
+	}
+	base, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	c.emit(instr{op: o, a: c.push(1), b: c.operand(base), c: mem, imm: uint64(arg.Offset)})
+	return nil
+}
+
+func (c *compiler) store32(o op, arg api.MemoryArg) error {
+	mem, err := c.memory()
+	if err != nil {
+		return err
+	}
+	base, err := c.pop(2)
+	if err != nil {
+		return err
+	}
+	value := c.operand(base + 1)
+	c.emit(instr{op: o, a: c.operand(base), b: value, c: mem, imm: uint64(arg.Offset)})
+	return nil
+}
+
+// memoryOp compiles a memory instruction with operands on the stack that are replaced by results
+func (c *compiler) memoryOp(o op, operands, results int) error {
+	mem, err := c.memory()
+	if err != nil {
+		return err
+	}
+	slot, err := c.pop(operands)
+	if err != nil {
+		return err
+	}
+	c.emit(instr{op: o, a: slot, c: mem})
+	c.push(results)
+	return nil
+}
+
+func (c *compiler) unary(o op) error {
+	slot, err := c.pop(1)
+	if err != nil {
+		return err
+	}
+	c.emit(instr{op: o, a: c.push(1), b: c.operand(slot)})
+	return nil
+}
+
+// add compiles i32.add, a constant operand is folded into the instruction
+func (c *compiler) add() error {
+	slot, err := c.pop(2)
+	if err != nil {
+		return err
+	}
+	if last := c.last(); last != nil && last.op == opConst && last.a == slot+1 {
+		imm := last.imm
+		c.drop()
+		c.emit(instr{op: opI32AddImm, a: c.push(1), b: c.operand(slot), imm: imm})
+		return nil
+	}
+	y := c.operand(slot + 1)
+	x := c.operand(slot)
+	c.emit(instr{op: opI32Add, a: c.push(1), b: x, c: y})
+	return nil
+}
+
+func (c *compiler) binary(o op) error {
+	slot, err := c.pop(2)
+	if err != nil {
+		return err
+	}
+	y := c.operand(slot + 1)
+	x := c.operand(slot)
+	c.emit(instr{op: o, a: c.push(1), b: x, c: y})
+	return nil
+}
+
+func binaryOp(instruction api.Instruction) (op, bool) {
+	switch instruction.(type) {
+	case api.I32Eq:
+		return opI32Eq, true
+	case api.I32Ne:
+		return opI32Ne, true
+	case api.I32Lt:
+		return opI32LtS, true
+	case api.U32Lt:
+		return opI32LtU, true
+	case api.I32Gt:
+		return opI32GtS, true
+	case api.U32Gt:
+		return opI32GtU, true
+	case api.I32Le:
+		return opI32LeS, true
+	case api.U32Le:
+		return opI32LeU, true
+	case api.I32Ge:
+		return opI32GeS, true
+	case api.U32Ge:
+		return opI32GeU, true
+	case api.I32Sub:
+		return opI32Sub, true
+	case api.I32Mul:
+		return opI32Mul, true
+	case api.I32Div:
+		return opI32DivS, true
+	case api.U32Div:
+		return opI32DivU, true
+	case api.I32Rem:
+		return opI32RemS, true
+	case api.U32Rem:
+		return opI32RemU, true
+	case api.I32And:
+		return opI32And, true
+	case api.I32Or:
+		return opI32Or, true
+	case api.I32Xor:
+		return opI32Xor, true
+	case api.I32Shl:
+		return opI32Shl, true
+	case api.I32Shr:
+		return opI32ShrS, true
+	case api.U32Shr:
+		return opI32ShrU, true
+	case api.I32Rotl:
+		return opI32Rotl, true
+	case api.I32Rotr:
+		return opI32Rotr, true
+	case api.I64Eq:
+		return opI64Eq, true
+	case api.I64Ne:
+		return opI64Ne, true
+	case api.I64Lt:
+		return opI64LtS, true
+	case api.U64Lt:
+		return opI64LtU, true
+	case api.I64Gt:
+		return opI64GtS, true
+	case api.U64Gt:
+		return opI64GtU, true
+	case api.I64Le:
+		return opI64LeS, true
+	case api.U64Le:
+		return opI64LeU, true
+	case api.I64Ge:
+		return opI64GeS, true
+	case api.U64Ge:
+		return opI64GeU, true
+	case api.I64Add:
+		return opI64Add, true
+	case api.I64Sub:
+		return opI64Sub, true
+	case api.I64Mul:
+		return opI64Mul, true
+	case api.I64Div:
+		return opI64DivS, true
+	case api.U64Div:
+		return opI64DivU, true
+	case api.I64Rem:
+		return opI64RemS, true
+	case api.U64Rem:
+		return opI64RemU, true
+	case api.I64And:
+		return opI64And, true
+	case api.I64Or:
+		return opI64Or, true
+	case api.I64Xor:
+		return opI64Xor, true
+	case api.I64Shl:
+		return opI64Shl, true
+	case api.I64Shr:
+		return opI64ShrS, true
+	case api.U64Shr:
+		return opI64ShrU, true
+	case api.I64Rotl:
+		return opI64Rotl, true
+	case api.I64Rotr:
+		return opI64Rotr, true
+	}
+	return 0, false
+}
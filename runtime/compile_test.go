@@ -0,0 +1,511 @@
+package runtime_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	goruntime "runtime"
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/values"
+	"github.com/stretchr/testify/require"
+)
+
+// engines are the ways a store runs module functions
+var engines = []struct {
+	name   string
+	engine config.Engine
+}{
+	{"bytecode", config.Bytecode},
+	{"interpreter", config.Interpreter},
+	{"native", config.Native},
+}
+
+func get(i api.LocalIndex) api.Instruction { return api.LocalGet{Index: i} }
+func set(i api.LocalIndex) api.Instruction { return api.LocalSet{Index: i} }
+func i32(v uint32) api.Instruction         { return api.I32Const(v) }
+
+// loop runs body while the local i is less than n, incrementing i after each iteration.
+// The body is a block, a branch to its label continues with the next iteration.
+func loop(i api.LocalIndex, n api.Instruction, body ...api.Instruction) []api.Instruction {
+	instructions := []api.Instruction{get(i), n, api.U32Ge{}, &api.BranchIf{Index: 1}}
+	instructions = append(instructions, &api.Block{Instructions: body})
+	instructions = append(instructions, get(i), i32(1), api.I32Add{}, set(i), &api.Branch{Index: 0})
+	return []api.Instruction{
+		i32(0), set(i),
+		&api.Block{Instructions: []api.Instruction{&api.Loop{Instructions: instructions}}},
+	}
+}
+
+func join(sequences ...[]api.Instruction) []api.Instruction {
+	var instructions []api.Instruction
+	for _, sequence := range sequences {
+		instructions = append(instructions, sequence...)
+	}
+	return instructions
+}
+
+func TestCompile(t *testing.T) {
+	i32x2 := &api.BlockTypeIndex{Index: api.TypeIndex(1)}
+	tests := []struct {
+		name     string
+		module   *api.Module
+		args     []values.Value
+		expected []values.Value
+	}{
+		{
+			name: "block_params",
+			module: Module(0, 1, nil,
+				i32(10), i32(2), i32(3),
+				&api.Block{Type: i32x2, Instructions: []api.Instruction{api.I32Mul{}, i32(4), &api.Branch{Index: 0}}},
+				api.I32Sub{}),
+			expected: []values.Value{values.I32Const(6)},
+		},
+		{
+			name: "branch_values",
+			module: Module(1, 1, nil,
+				i32(100),
+				&api.Block{Type: &api.BlockTypeValue{ValueType: api.I32Type}, Instructions: []api.Instruction{
+					i32(1), i32(2), get(0), &api.BranchIf{Index: 0}, api.I32Add{},
+				}},
+				api.I32Add{}),
+			args:     []values.Value{values.I32Const(1)},
+			expected: []values.Value{values.I32Const(102)},
+		},
+		{
+			name: "branch_values_fallthrough",
+			module: Module(1, 1, nil,
+				i32(100),
+				&api.Block{Type: &api.BlockTypeValue{ValueType: api.I32Type}, Instructions: []api.Instruction{
+					i32(1), i32(2), get(0), &api.BranchIf{Index: 0}, api.I32Add{},
+				}},
+				api.I32Add{}),
+			args:     []values.Value{values.I32Const(0)},
+			expected: []values.Value{values.I32Const(103)},
+		},
+		{
+			name: "branch_table",
+			module: Module(1, 1, nil,
+				&api.Block{Instructions: []api.Instruction{
+					&api.Block{Instructions: []api.Instruction{
+						&api.Block{Instructions: []api.Instruction{
+							get(0), &api.BranchTable{Indicies: []api.LabelIndex{0, 1}, Index: 2},
+						}},
+						i32(10), &api.Return{},
+					}},
+					i32(11), &api.Return{},
+				}},
+				i32(12)),
+			args:     []values.Value{values.I32Const(1)},
+			expected: []values.Value{values.I32Const(11)},
+		},
+		{
+			name: "branch_table_default",
+			module: Module(1, 1, nil,
+				&api.Block{Instructions: []api.Instruction{
+					i32(5), get(0), &api.BranchTable{Indicies: []api.LabelIndex{0}, Index: 1},
+				}},
+				i32(1)),
+			args:     []values.Value{values.I32Const(7)},
+			expected: []values.Value{values.I32Const(5)},
+		},
+		{
+			// count down with the counter as a loop parameter
+			name: "loop_params",
+			module: Module(1, 1, nil,
+				get(0),
+				&api.Loop{Type: &api.BlockTypeIndex{Index: api.TypeIndex(2)}, Instructions: []api.Instruction{
+					i32(1), api.I32Sub{}, api.LocalTee{Index: 0}, get(0), &api.BranchIf{Index: 0},
+				}},
+			),
+			args:     []values.Value{values.I32Const(5)},
+			expected: []values.Value{values.I32Const(0)},
+		},
+		{
+			name: "eqz_branch",
+			module: Module(1, 1, nil,
+				&api.Block{Instructions: []api.Instruction{get(0), api.I32Eqz{}, &api.BranchIf{Index: 0}, i32(1), &api.Return{}}},
+				i32(2)),
+			args:     []values.Value{values.I32Const(0)},
+			expected: []values.Value{values.I32Const(2)},
+		},
+		{
+			name: "eqz_if",
+			module: Module(1, 1, nil,
+				get(0), api.I32Eqz{},
+				&api.If{
+					Type:         &api.BlockTypeValue{ValueType: api.I32Type},
+					Instructions: []api.Instruction{i32(1)},
+					Else:         &api.Else{Instructions: []api.Instruction{i32(2)}},
+				}),
+			args:     []values.Value{values.I32Const(3)},
+			expected: []values.Value{values.I32Const(2)},
+		},
+		{
+			// the operands of the add are read before the local they come from is written
+			name: "local_operands",
+			module: Module(2, 1, nil,
+				get(0), get(1), api.I32Add{}, set(0),
+				get(1), get(0), set(1), set(0),
+				get(0), i32(10), api.I32Mul{}, get(1), api.I32Add{}),
+			args:     []values.Value{values.I32Const(3), values.I32Const(4)},
+			expected: []values.Value{values.I32Const(47)},
+		},
+		{
+			name:     "select",
+			module:   Module(1, 1, nil, i32(1), i32(2), get(0), &api.Select{}),
+			args:     []values.Value{values.I32Const(0)},
+			expected: []values.Value{values.I32Const(2)},
+		},
+		{
+			name: "i64",
+			module: Module(0, 1, nil,
+				api.I64Const(1<<40), api.I64Const(3), api.I64Mul{}, api.I64Const(1<<40), api.I64Div{},
+				api.I64Const(3), api.I64Eq{}),
+			expected: []values.Value{values.I32Const(1)},
+		},
+		{
+			// v128 locals are not supported by the bytecode so the function runs in the interpreter
+			name:     "fallback",
+			module:   Module(0, 1, []api.ValType{api.V128Type}, i32(3)),
+			expected: []values.Value{values.I32Const(3)},
+		},
+	}
+	for _, test := range tests {
+		test.module.Types = append(test.module.Types,
+			&api.FuncType{Parameters: api.ResultType{Types: I32(2)}, Returns: api.ResultType{Types: I32(1)}},
+			&api.FuncType{Parameters: api.ResultType{Types: I32(1)}, Returns: api.ResultType{Types: I32(1)}})
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				m, err := runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, test.module)
+				require.NoError(t, err)
+				results, err := m.Invoke(context.Background(), "f", test.args...)
+				require.NoError(t, err)
+				require.Equal(t, test.expected, results)
+			})
+		}
+	}
+}
+
+func TestCompileCalls(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+			ft := api.FuncType{Parameters: api.ResultType{Types: I32(1)}, Returns: api.ResultType{Types: I32(1)}}
+			double := store.AllocHostFunction(ft, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+				return []values.Value{args[0].(values.I32Const) * 2}, nil
+			})
+			// fib calls itself, the host function and a function that runs in the interpreter
+			module := &api.Module{
+				Types: []*api.FuncType{&ft},
+				Imports: []api.Import{
+					{Module: "", Name: "double", Description: &api.FuncImportDescription{TypeIdx: 0}},
+				},
+				Funcs: []*api.Func{
+					{Body: &api.Expression{Instructions: []api.Instruction{
+						get(0), i32(2), api.U32Lt{},
+						&api.If{
+							Type:         &api.BlockTypeValue{ValueType: api.I32Type},
+							Instructions: []api.Instruction{get(0), &api.Call{Index: 2}},
+							Else: &api.Else{Instructions: []api.Instruction{
+								get(0), i32(0xffff_ffff), api.I32Add{}, &api.Call{Index: 1},
+								get(0), i32(0xffff_fffe), api.I32Add{}, &api.Call{Index: 1},
+								api.I32Add{},
+							}},
+						},
+					}}},
+					{Locals: []api.ValType{api.V128Type}, Body: &api.Expression{Instructions: []api.Instruction{
+						get(0), &api.Call{Index: 0}, i32(2), api.U32Div{},
+					}}},
+				},
+				Exports: []api.Export{{Name: "fib", Description: &api.FuncExportDescription{FuncIdx: 1}}},
+			}
+			m, err := runtime.NewModuleInstance(store, module, double)
+			require.NoError(t, err)
+			results, err := m.Invoke(context.Background(), "fib", values.I32Const(20))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(6765)}, results)
+		})
+	}
+}
+
+func TestCompileTrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  *api.Module
+		message string
+	}{
+		{"unreachable", Module(0, 0, nil, &api.Unreachable{}), "trap: unreachable"},
+		{"divide_by_zero", Module(0, 1, nil, i32(1), i32(0), api.I32Div{}), "trap: integer divide by zero"},
+		{"overflow", Module(0, 1, nil, i32(0x8000_0000), i32(0xffff_ffff), api.I32Div{}), "trap: integer overflow"},
+		{"out_of_bounds", Module(0, 1, nil, i32(65534), &api.Int32Load{}), "trap: out of bounds memory access at 65534"},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				m, err := runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, test.module)
+				require.NoError(t, err)
+				_, err = m.Invoke(context.Background(), "f")
+				require.EqualError(t, err, test.message)
+			})
+		}
+	}
+}
+
+// TestCompileOperations compares the results and traps of the engines with the interpreter
+func TestCompileOperations(t *testing.T) {
+	i32s := []uint64{0, 1, 2, 7, 31, 32, 33, 0x7fff_ffff, 0x8000_0000, 0xffff_ffff}
+	i64s := []uint64{0, 1, 2, 63, 64, 65, 0xffff_ffff, 1 << 32, math.MaxInt64, 1 << 63, math.MaxUint64}
+	i32 := func(v uint64) values.Value { return values.I32Const(v) }
+	i64 := func(v uint64) values.Value { return values.I64Const(v) }
+	tests := []struct {
+		name       string
+		typ        api.ValType
+		result     api.ValType
+		operations []api.Instruction
+		inputs     []uint64
+		value      func(uint64) values.Value
+	}{
+		{"i32", api.I32Type, api.I32Type, []api.Instruction{
+			api.I32Eq{}, api.I32Ne{}, api.I32Lt{}, api.U32Lt{}, api.I32Gt{}, api.U32Gt{}, api.I32Le{}, api.U32Le{}, api.I32Ge{}, api.U32Ge{},
+			api.I32Add{}, api.I32Sub{}, api.I32Mul{}, api.I32Div{}, api.U32Div{}, api.I32Rem{}, api.U32Rem{},
+			api.I32And{}, api.I32Or{}, api.I32Xor{}, api.I32Shl{}, api.I32Shr{}, api.U32Shr{}, api.I32Rotl{}, api.I32Rotr{},
+		}, i32s, i32},
+		{"i64_compare", api.I64Type, api.I32Type, []api.Instruction{
+			api.I64Eq{}, api.I64Ne{}, api.I64Lt{}, api.U64Lt{}, api.I64Gt{}, api.U64Gt{}, api.I64Le{}, api.U64Le{}, api.I64Ge{}, api.U64Ge{},
+		}, i64s, i64},
+		{"i64", api.I64Type, api.I64Type, []api.Instruction{
+			api.I64Add{}, api.I64Sub{}, api.I64Mul{}, api.I64Div{}, api.U64Div{}, api.I64Rem{}, api.U64Rem{},
+			api.I64And{}, api.I64Or{}, api.I64Xor{}, api.I64Shl{}, api.I64Shr{}, api.U64Shr{}, api.I64Rotl{}, api.I64Rotr{},
+		}, i64s, i64},
+	}
+	for _, test := range tests {
+		for _, operation := range test.operations {
+			module := Module(0, 0, nil, get(0), get(1), operation)
+			module.Types[0] = &api.FuncType{
+				Parameters: api.ResultType{Types: []api.ValType{test.typ, test.typ}},
+				Returns:    api.ResultType{Types: []api.ValType{test.result}},
+			}
+			t.Run(fmt.Sprintf("%s/%T", test.name, operation), func(t *testing.T) {
+				invoke := engineInvoker(t, module)
+				for _, x := range test.inputs {
+					for _, y := range test.inputs {
+						invoke(test.value(x), test.value(y))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompileMemory(t *testing.T) {
+	loads := []api.Instruction{
+		&api.Int32Load{MemoryArg: api.MemoryArg{Offset: 1}},
+		&api.I32Load8{MemoryArg: api.MemoryArg{Offset: 2}},
+		&api.U32Load8u{MemoryArg: api.MemoryArg{Offset: 3}},
+		&api.I32Load16{},
+		&api.U32Load16{MemoryArg: api.MemoryArg{Offset: 0xffff_ffff}},
+	}
+	stores := []api.Instruction{
+		&api.Int32Store{},
+		&api.I32Store8{MemoryArg: api.MemoryArg{Offset: 1}},
+		&api.I32Store16{MemoryArg: api.MemoryArg{Offset: 3}},
+	}
+	addresses := []uint64{0, 7, 65531, 65532, 65533, 65535, 65536, 0xffff_ffff}
+	for _, store := range stores {
+		for _, load := range loads {
+			// stores the second parameter at the first and loads from the first
+			module := Module(2, 1, nil, get(0), get(1), store, get(0), load)
+			t.Run(fmt.Sprintf("%T/%T", store, load), func(t *testing.T) {
+				invoke := engineInvoker(t, module)
+				for _, address := range addresses {
+					invoke(values.I32Const(address), values.I32Const(0x8081_f2f3))
+				}
+			})
+		}
+	}
+}
+
+// engineInvoker instantiates the module in every engine and returns a function that invokes f
+// with arguments and requires the results or the trap of every engine to match the interpreter
+func engineInvoker(t *testing.T, module *api.Module) func(args ...values.Value) {
+	instances := make([]*runtime.ModuleInstance, len(engines))
+	for i, engine := range engines {
+		m, err := runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, module)
+		require.NoError(t, err)
+		instances[i] = m
+	}
+	return func(args ...values.Value) {
+		var expected []values.Value
+		var expectedErr error
+		for i, engine := range engines {
+			if engine.engine == config.Interpreter {
+				expected, expectedErr = instances[i].Invoke(context.Background(), "f", args...)
+			}
+		}
+		for i, engine := range engines {
+			if engine.engine == config.Interpreter {
+				continue
+			}
+			results, err := instances[i].Invoke(context.Background(), "f", args...)
+			if expectedErr != nil {
+				require.EqualError(t, err, expectedErr.Error(), "%s %v", engine.name, args)
+				continue
+			}
+			require.NoError(t, err, "%s %v", engine.name, args)
+			require.Equal(t, expected, results, "%s %v", engine.name, args)
+		}
+	}
+}
+
+// coreMark returns a module with a CoreMark style workload: a matrix multiplication, a crc over
+// memory and a state machine driven by a branch table. The exported function runs the workload
+// the number of times given by its parameter.
+func coreMark() *api.Module {
+	const (
+		n      = 16
+		a      = 0
+		b      = a + n*n*4
+		c      = b + n*n*4
+		buffer = 256
+	)
+	// element returns the address of element (row, column) of the matrix at base
+	element := func(base uint32, row, column api.LocalIndex) []api.Instruction {
+		return []api.Instruction{get(row), i32(n), api.I32Mul{}, get(column), api.I32Add{}, i32(4), api.I32Mul{}, i32(base), api.I32Add{}}
+	}
+	// locals i, j, k, sum, result
+	matrix := join(
+		loop(0, i32(n), loop(1, i32(n),
+			join(
+				[]api.Instruction{i32(0), set(3)},
+				loop(2, i32(n), join(
+					[]api.Instruction{get(3)},
+					element(a, 0, 2), []api.Instruction{&api.Int32Load{}},
+					element(b, 2, 1), []api.Instruction{&api.Int32Load{}},
+					[]api.Instruction{api.I32Mul{}, api.I32Add{}, set(3)},
+				)...),
+				element(c, 0, 1),
+				[]api.Instruction{get(3), &api.Int32Store{}, get(4), get(3), api.I32Xor{}, set(4)},
+			)...,
+		)...),
+		[]api.Instruction{get(4)},
+	)
+	// locals i, bit, crc
+	crc := join(
+		[]api.Instruction{i32(0xffff), set(2)},
+		loop(0, i32(buffer), join(
+			[]api.Instruction{get(2), get(0), &api.U32Load8u{}, api.I32Xor{}, set(2)},
+			loop(1, i32(8),
+				get(2), i32(1), api.I32And{},
+				&api.If{
+					Instructions: []api.Instruction{get(2), i32(1), api.U32Shr{}, i32(0xa001), api.I32Xor{}, set(2)},
+					Else:         &api.Else{Instructions: []api.Instruction{get(2), i32(1), api.U32Shr{}, set(2)}},
+				},
+			),
+		)...),
+		[]api.Instruction{get(2)},
+	)
+	// locals i, state
+	state := join(
+		loop(0, i32(buffer),
+			&api.Block{Instructions: []api.Instruction{
+				&api.Block{Instructions: []api.Instruction{
+					&api.Block{Instructions: []api.Instruction{
+						&api.Block{Instructions: []api.Instruction{
+							&api.Block{Instructions: []api.Instruction{
+								get(0), &api.U32Load8u{}, i32(4), api.U32Rem{},
+								&api.BranchTable{Indicies: []api.LabelIndex{0, 1, 2}, Index: 3},
+							}},
+							get(1), i32(1), api.I32Add{}, set(1), &api.Branch{Index: 3},
+						}},
+						get(1), i32(3), api.I32Mul{}, set(1), &api.Branch{Index: 2},
+					}},
+					get(1), get(0), api.I32Xor{}, set(1), &api.Branch{Index: 1},
+				}},
+				get(1), i32(7), api.I32Sub{}, set(1),
+			}},
+		),
+		[]api.Instruction{get(1)},
+	)
+	// fill the buffer with a pseudo random sequence, locals i, x
+	fill := loop(0, i32(buffer),
+		get(0),
+		get(1), i32(1103515245), api.I32Mul{}, i32(12345), api.I32Add{}, api.LocalTee{Index: 1},
+		i32(16), api.U32Shr{},
+		&api.I32Store8{},
+	)
+	// locals iterations, i, result
+	run := join(
+		[]api.Instruction{&api.Call{Index: 3}},
+		loop(1, get(0),
+			get(2), &api.Call{Index: 0}, api.I32Add{},
+			&api.Call{Index: 1}, api.I32Xor{},
+			&api.Call{Index: 2}, api.I32Add{},
+			set(2),
+		),
+		[]api.Instruction{get(2)},
+	)
+	return &api.Module{
+		Types: []*api.FuncType{
+			{Parameters: api.ResultType{Types: I32(0)}, Returns: api.ResultType{Types: I32(1)}},
+			{Parameters: api.ResultType{Types: I32(1)}, Returns: api.ResultType{Types: I32(1)}},
+			{Parameters: api.ResultType{Types: I32(0)}, Returns: api.ResultType{Types: I32(0)}},
+		},
+		Funcs: []*api.Func{
+			{Type: 0, Locals: I32(5), Body: &api.Expression{Instructions: matrix}},
+			{Type: 0, Locals: I32(3), Body: &api.Expression{Instructions: crc}},
+			{Type: 0, Locals: I32(2), Body: &api.Expression{Instructions: state}},
+			{Type: 2, Locals: I32(2), Body: &api.Expression{Instructions: fill}},
+			{Type: 1, Locals: I32(2), Body: &api.Expression{Instructions: run}},
+		},
+		Mems:    []api.Mem{{Limits: api.Limits{Min: 1, Max: option.None[uint32]()}}},
+		Exports: []api.Export{{Name: "run", Description: &api.FuncExportDescription{FuncIdx: 4}}},
+	}
+}
+
+func TestCoreMark(t *testing.T) {
+	// two iterations of ((result + matrix) ^ crc) + state over the filled buffer. The matrix product
+	// is zero because the second matrix is never written, the crc is 0x05b6 and the state machine
+	// ends at 0xff7e7c9b, so the first iteration returns 0xff7e8251 and the second 0xfefd0482.
+	expected := []values.Value{values.I32Const(0xfefd0482)}
+	for _, engine := range engines {
+		m, err := runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, coreMark())
+		require.NoError(t, err)
+		results, err := m.Invoke(context.Background(), "run", values.I32Const(2))
+		require.NoError(t, err)
+		require.Equal(t, expected, results, engine.name)
+	}
+}
+
+func TestNative(t *testing.T) {
+	// the native backend exists for linux/amd64 and linux/arm64, other platforms run bytecode
+	expected := goruntime.GOOS == "linux" && (goruntime.GOARCH == "amd64" || goruntime.GOARCH == "arm64")
+	store := &runtime.Store{Config: config.Config{Engine: config.Native}}
+	m, err := runtime.NewModuleInstance(store, coreMark())
+	require.NoError(t, err)
+	export, ok := m.GetExport("run")
+	require.True(t, ok)
+	native, err := runtime.Native(store, export.Value.(address.Function))
+	require.NoError(t, err)
+	require.Equal(t, expected, native)
+}
+
+func BenchmarkCoreMark(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			m, err := runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, coreMark())
+			require.NoError(b, err)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.Invoke(context.Background(), "run", values.I32Const(1)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package runtime
+
+import "github.com/patrickhuber/go-wasm/address"
+
+// Native reports whether the function at addr runs as machine code
+func Native(s *Store, addr address.Function) (bool, error) {
+	fn, err := s.compiled(addr)
+	return fn != nil && fn.native != nil, err
+}
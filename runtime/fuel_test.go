@@ -0,0 +1,168 @@
+package runtime_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/values"
+	"github.com/patrickhuber/go-wasm/wat"
+	"github.com/stretchr/testify/require"
+)
+
+// count loops n times, an iteration costs 9 and leaving the loop 5 with the default costs
+const count = `(module
+  (func (export "count") (param $n i32) (result i32) (local $i i32)
+    (block $done
+      (loop $next
+        (br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $next)))
+    (local.get $i)))`
+
+// refuel calls the host in every iteration, an iteration costs 10 and leaving the loop 5
+const refuel = `(module
+  (func $refuel (import "env" "refuel"))
+  (func (export "count") (param $n i32) (result i32) (local $i i32)
+    (block $done
+      (loop $next
+        (br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+        (call $refuel)
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $next)))
+    (local.get $i)))`
+
+func decodeWat(t testing.TB, source string) *api.Module {
+	directive, err := wat.NewDecoder(nil).Decode(strings.NewReader(source))
+	require.NoError(t, err)
+	module, ok := directive.(*api.Module)
+	require.True(t, ok)
+	return module
+}
+
+func TestFuel(t *testing.T) {
+	type test struct {
+		name     string
+		fuel     uint64
+		cost     func(api.Instruction) uint64
+		message  string
+		consumed uint64
+	}
+	tests := []test{
+		{name: "enough", fuel: 1000, consumed: 95},
+		{name: "exact", fuel: 95, consumed: 95},
+		{name: "exhausted", fuel: 94, message: "trap: all fuel consumed"},
+		{name: "none", message: "trap: all fuel consumed"},
+		{
+			// only the branches to the start of the loop cost fuel
+			name: "cost",
+			fuel: 10,
+			cost: func(instruction api.Instruction) uint64 {
+				if _, ok := instruction.(*api.Branch); ok {
+					return 1
+				}
+				return 0
+			},
+			consumed: 10,
+		},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				store := &runtime.Store{Config: config.Config{
+					Engine: engine.engine,
+					Fuel:   config.Fuel{Enabled: true, Cost: test.cost},
+				}}
+				store.AddFuel(test.fuel)
+				m, err := runtime.NewModuleInstance(store, decodeWat(t, count))
+				require.NoError(t, err)
+
+				results, err := m.Invoke(context.Background(), "count", values.I32Const(10))
+				if test.message != "" {
+					require.EqualError(t, err, test.message)
+					require.LessOrEqual(t, store.ConsumedFuel(), test.fuel)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, []values.Value{values.I32Const(10)}, results)
+				require.Equal(t, test.consumed, store.ConsumedFuel())
+				require.Equal(t, test.fuel-test.consumed, store.RemainingFuel())
+			})
+		}
+	}
+}
+
+func TestFuelAdd(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine, Fuel: config.Fuel{Enabled: true}}}
+			store.AddFuel(50)
+			m, err := runtime.NewModuleInstance(store, decodeWat(t, count))
+			require.NoError(t, err)
+
+			_, err = m.Invoke(context.Background(), "count", values.I32Const(10))
+			require.EqualError(t, err, "trap: all fuel consumed")
+
+			// the store runs functions again once it has fuel
+			store.AddFuel(95)
+			consumed := store.ConsumedFuel()
+			results, err := m.Invoke(context.Background(), "count", values.I32Const(10))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(10)}, results)
+			require.Equal(t, consumed+95, store.ConsumedFuel())
+		})
+	}
+}
+
+func TestFuelHost(t *testing.T) {
+	type test struct {
+		name    string
+		add     uint64
+		message string
+	}
+	tests := []test{
+		{name: "refuel", add: 10},
+		{name: "no_refuel", message: "trap: all fuel consumed"},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				store := &runtime.Store{Config: config.Config{Engine: engine.engine, Fuel: config.Fuel{Enabled: true}}}
+				host := store.AllocHostFunction(api.FuncType{}, func(context.Context, []values.Value) ([]values.Value, error) {
+					// the caller continues with the fuel added by the host
+					store.AddFuel(test.add)
+					return nil, nil
+				})
+				store.AddFuel(10)
+				m, err := runtime.NewModuleInstance(store, decodeWat(t, refuel), host)
+				require.NoError(t, err)
+
+				results, err := m.Invoke(context.Background(), "count", values.I32Const(100))
+				if test.message != "" {
+					require.EqualError(t, err, test.message)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, []values.Value{values.I32Const(100)}, results)
+				require.Equal(t, uint64(1005), store.ConsumedFuel())
+			})
+		}
+	}
+}
+
+func TestFuelDisabled(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+			m, err := runtime.NewModuleInstance(store, decodeWat(t, count))
+			require.NoError(t, err)
+			results, err := m.Invoke(context.Background(), "count", values.I32Const(10))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(10)}, results)
+			require.Equal(t, uint64(0), store.ConsumedFuel())
+		})
+	}
+}
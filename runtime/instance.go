@@ -1,39 +1,364 @@
 package runtime
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/patrickhuber/go-wasm/address"
 	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/instance"
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/patrickhuber/go-wasm/values"
 )
 
-type ModuleInstance struct {
-	store             *Store
-	Types             []api.FuncType
-	FunctionAddresses []address.Function
-	Exports           []ExportInstance
-}
+// PageSize is the size of a wasm memory page in bytes
+const PageSize = 65536
 
-type ExportInstance struct {
-	Name  string
-	Value address.ExternalValue
+// ModuleInstance is a module that has been allocated in a store
+type ModuleInstance struct {
+	*instance.Module
+	store *Store
 }
 
-func NewModuleInstance(store *Store, module *api.Module) (*ModuleInstance, error) {
+// NewModuleInstance allocates the functions, memories and globals of module in store
+// and resolves its exports. imports supplies an external value for each import of the
+// module in order, imported items precede the module's own items in their index space.
+// The module must be within the limits of the store's configuration.
+// see https://webassembly.github.io/spec/core/exec/modules.html#alloc-module
+func NewModuleInstance(store *Store, module *api.Module, imports ...address.ExternalValue) (*ModuleInstance, error) {
+	if err := checkLimits(store.Config.Limits.WithDefaults(), store, module); err != nil {
+		return nil, err
+	}
 	moduleInstance := &ModuleInstance{
-		store: store,
+		Module: &instance.Module{Names: module.Names},
+		store:  store,
+	}
+	for _, t := range module.Types {
+		moduleInstance.Types = append(moduleInstance.Types, *t)
+	}
+	if len(imports) != len(module.Imports) {
+		return nil, fmt.Errorf("module has %d imports, found %d external values", len(module.Imports), len(imports))
+	}
+	for i, imp := range module.Imports {
+		if err := moduleInstance.resolveImport(imp, imports[i]); err != nil {
+			return nil, fmt.Errorf("import '%s' '%s': %w", imp.Module, imp.Name, err)
+		}
 	}
 	for _, fn := range module.Funcs {
+		if int(fn.Type) >= len(moduleInstance.Types) {
+			return nil, fmt.Errorf("function type index %d out of range", fn.Type)
+		}
 		funcAddr := len(store.Funcs)
-		store.Funcs = append(store.Funcs, fn)
+		store.Funcs = append(store.Funcs, &instance.ModuleFunction{
+			Type:   moduleInstance.Types[fn.Type],
+			Module: moduleInstance.Module,
+			Code:   fn,
+		})
 		moduleInstance.FunctionAddresses = append(moduleInstance.FunctionAddresses, address.Function(funcAddr))
 	}
+	for _, table := range module.Tables {
+		if max, ok := limitsMax(table.Limits); ok && max < table.Limits.Min {
+			return nil, fmt.Errorf("table minimum %d is greater than maximum %d", table.Limits.Min, max)
+		}
+		tableAddr := len(store.Tables)
+		store.Tables = append(store.Tables, instance.Table{
+			Type:    table,
+			Element: nullReferences(table.Limits.Min),
+		})
+		moduleInstance.TableAddresses = append(moduleInstance.TableAddresses, address.Table{Address: uint32(tableAddr)})
+	}
+	for _, mem := range module.Mems {
+		if max, ok := limitsMax(mem.Limits); ok && max < mem.Limits.Min {
+			return nil, fmt.Errorf("memory minimum %d is greater than maximum %d", mem.Limits.Min, max)
+		}
+		memAddr := len(store.Mems)
+		store.Mems = append(store.Mems, instance.Memory{
+			Type: mem,
+			Data: make([]byte, int(mem.Limits.Min)*PageSize),
+		})
+		moduleInstance.MemoryAddresses = append(moduleInstance.MemoryAddresses, address.Memory{Address: uint32(memAddr)})
+	}
+	for _, global := range module.Globals {
+		value, err := moduleInstance.evalConst(global)
+		if err != nil {
+			return nil, err
+		}
+		globalAddr := len(store.Globals)
+		store.Globals = append(store.Globals, instance.Global{
+			Type:  global,
+			Value: value,
+		})
+		moduleInstance.GlobalAddresses = append(moduleInstance.GlobalAddresses, address.Global{Address: uint32(globalAddr)})
+	}
+	for i, elem := range module.Elems {
+		if err := moduleInstance.initElem(elem); err != nil {
+			return nil, fmt.Errorf("element segment %d: %w", i, err)
+		}
+	}
+	for _, export := range module.Exports {
+		var value address.ExternalValue
+		switch desc := export.Description.(type) {
+		case *api.FuncExportDescription:
+			if int(desc.FuncIdx) >= len(moduleInstance.FunctionAddresses) {
+				return nil, fmt.Errorf("export '%s' function index %d out of range", export.Name, desc.FuncIdx)
+			}
+			value = moduleInstance.FunctionAddresses[desc.FuncIdx]
+		case *api.TableExportDescription:
+			if int(desc.TableIdx) >= len(moduleInstance.TableAddresses) {
+				return nil, fmt.Errorf("export '%s' table index %d out of range", export.Name, desc.TableIdx)
+			}
+			value = &moduleInstance.TableAddresses[desc.TableIdx]
+		case *api.MemExportDescription:
+			if int(desc.MemIdx) >= len(moduleInstance.MemoryAddresses) {
+				return nil, fmt.Errorf("export '%s' memory index %d out of range", export.Name, desc.MemIdx)
+			}
+			value = &moduleInstance.MemoryAddresses[desc.MemIdx]
+		case *api.GlobalExportDescription:
+			if int(desc.GlobalIdx) >= len(moduleInstance.GlobalAddresses) {
+				return nil, fmt.Errorf("export '%s' global index %d out of range", export.Name, desc.GlobalIdx)
+			}
+			value = &moduleInstance.GlobalAddresses[desc.GlobalIdx]
+		default:
+			return nil, fmt.Errorf("export '%s' has unsupported description %T", export.Name, desc)
+		}
+		moduleInstance.Exports = append(moduleInstance.Exports, instance.Export{Name: export.Name, Value: value})
+	}
+	store.Modules = append(store.Modules, moduleInstance.Module)
 	return moduleInstance, nil
 }
 
-func (m *ModuleInstance) GetExport(name string) (ExportInstance, bool) {
+// checkLimits checks the number of instances of the store and the functions, tables and memories of the module
+func checkLimits(limits config.Limits, store *Store, module *api.Module) error {
+	if len(store.Modules) >= limits.Instances {
+		return fmt.Errorf("store has reached the limit of %d instances", limits.Instances)
+	}
+	functions := len(module.Funcs)
+	for _, imp := range module.Imports {
+		if _, ok := imp.Description.(*api.FuncImportDescription); ok {
+			functions++
+		}
+	}
+	if functions > limits.Functions {
+		return fmt.Errorf("module has %d functions, the limit is %d", functions, limits.Functions)
+	}
+	for _, table := range module.Tables {
+		if table.Limits.Min > limits.TableSize {
+			return fmt.Errorf("table minimum %d exceeds the limit of %d elements", table.Limits.Min, limits.TableSize)
+		}
+	}
+	pages := uint32(MaxPages)
+	if limits.MemoryPages < pages {
+		pages = limits.MemoryPages
+	}
+	for _, mem := range module.Mems {
+		if mem.Limits.Min > pages {
+			return fmt.Errorf("memory minimum %d exceeds the limit of %d pages", mem.Limits.Min, pages)
+		}
+	}
+	return nil
+}
+
+// resolveImport checks the external value against the import description and appends it to its index space
+// see https://webassembly.github.io/spec/core/exec/modules.html#import-matching
+func (m *ModuleInstance) resolveImport(imp api.Import, value address.ExternalValue) error {
+	switch desc := imp.Description.(type) {
+	case *api.FuncImportDescription:
+		addr, ok := value.(address.Function)
+		if !ok {
+			return fmt.Errorf("expected a function, found %T", value)
+		}
+		if int(desc.TypeIdx) >= len(m.Types) {
+			return fmt.Errorf("function type index %d out of range", desc.TypeIdx)
+		}
+		if int(addr) >= len(m.store.Funcs) {
+			return fmt.Errorf("function address %d out of range", addr)
+		}
+		ft, err := funcType(m.store.Funcs[addr])
+		if err != nil {
+			return err
+		}
+		if !sameTypes(ft.Parameters.Types, m.Types[desc.TypeIdx].Parameters.Types) ||
+			!sameTypes(ft.Returns.Types, m.Types[desc.TypeIdx].Returns.Types) {
+			return fmt.Errorf("function type mismatch")
+		}
+		m.FunctionAddresses = append(m.FunctionAddresses, addr)
+	case *api.TableImportDescription:
+		addr, ok := value.(*address.Table)
+		if !ok {
+			return fmt.Errorf("expected a table, found %T", value)
+		}
+		if int(addr.Address) >= len(m.store.Tables) {
+			return fmt.Errorf("table address %d out of range", addr.Address)
+		}
+		table := m.store.Tables[addr.Address]
+		if size := uint32(len(table.Element)); size < desc.Table.Limits.Min {
+			return fmt.Errorf("table has %d elements, expected at least %d", size, desc.Table.Limits.Min)
+		}
+		if max, ok := limitsMax(desc.Table.Limits); ok {
+			actual, bounded := limitsMax(table.Type.Limits)
+			if !bounded || actual > max {
+				return fmt.Errorf("table maximum exceeds %d elements", max)
+			}
+		}
+		m.TableAddresses = append(m.TableAddresses, *addr)
+	case *api.MemImportDescription:
+		addr, ok := value.(*address.Memory)
+		if !ok {
+			return fmt.Errorf("expected a memory, found %T", value)
+		}
+		if int(addr.Address) >= len(m.store.Mems) {
+			return fmt.Errorf("memory address %d out of range", addr.Address)
+		}
+		mem := m.store.Mems[addr.Address]
+		if pages := uint32(len(mem.Data) / PageSize); pages < desc.Mem.Limits.Min {
+			return fmt.Errorf("memory has %d pages, expected at least %d", pages, desc.Mem.Limits.Min)
+		}
+		if max, ok := limitsMax(desc.Mem.Limits); ok {
+			actual, bounded := limitsMax(mem.Type.Limits)
+			if !bounded || actual > max {
+				return fmt.Errorf("memory maximum exceeds %d pages", max)
+			}
+		}
+		m.MemoryAddresses = append(m.MemoryAddresses, *addr)
+	case *api.GlobalImportDescription:
+		addr, ok := value.(*address.Global)
+		if !ok {
+			return fmt.Errorf("expected a global, found %T", value)
+		}
+		if int(addr.Address) >= len(m.store.Globals) {
+			return fmt.Errorf("global address %d out of range", addr.Address)
+		}
+		global := m.store.Globals[addr.Address]
+		if global.Type.Value != desc.Global.Value || global.Type.Mutable != desc.Global.Mutable {
+			return fmt.Errorf("global type mismatch")
+		}
+		m.GlobalAddresses = append(m.GlobalAddresses, *addr)
+	default:
+		return fmt.Errorf("unsupported import description %T", desc)
+	}
+	return nil
+}
+
+func nullReferences(size uint32) []values.Reference {
+	refs := make([]values.Reference, size)
+	for i := range refs {
+		refs[i] = &values.NullReference{}
+	}
+	return refs
+}
+
+// initElem writes the functions of an active element segment into its table
+// see https://webassembly.github.io/spec/core/exec/modules.html#exec-instantiation
+func (m *ModuleInstance) initElem(elem api.Elem) error {
+	if int(elem.Table) >= len(m.TableAddresses) {
+		return fmt.Errorf("table index %d out of range", elem.Table)
+	}
+	var offset uint32
+	if elem.Offset != nil {
+		results, err := m.store.eval(m.Module, elem.Offset.Instructions, nil)
+		if err != nil {
+			return err
+		}
+		if len(results) != 1 {
+			return fmt.Errorf("offset produced %d values, expected 1", len(results))
+		}
+		value, ok := results[0].(values.I32Const)
+		if !ok {
+			return fmt.Errorf("offset must be an i32, found %T", results[0])
+		}
+		offset = uint32(value)
+	}
+	table := &m.store.Tables[m.TableAddresses[elem.Table].Address]
+	if uint64(offset)+uint64(len(elem.Init)) > uint64(len(table.Element)) {
+		return trap.New(trap.OutOfBoundsTable, "out of bounds table access")
+	}
+	for i, index := range elem.Init {
+		if int(index) >= len(m.FunctionAddresses) {
+			return fmt.Errorf("function index %d out of range", index)
+		}
+		table.Element[offset+uint32(i)] = &values.FunctionReference{Address: m.FunctionAddresses[index]}
+	}
+	return nil
+}
+
+func sameTypes(a, b []api.ValType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Store returns the store the module was allocated in
+func (m *ModuleInstance) Store() *Store {
+	return m.store
+}
+
+// evalConst evaluates the constant initializer of a global
+func (m *ModuleInstance) evalConst(global api.Global) (values.Value, error) {
+	if global.Init == nil {
+		return zero(global.Value)
+	}
+	results, err := m.store.eval(m.Module, global.Init.Instructions, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("global initializer produced %d values, expected 1", len(results))
+	}
+	return results[0], nil
+}
+
+func (m *ModuleInstance) GetExport(name string) (instance.Export, bool) {
 	for _, export := range m.Exports {
 		if export.Name == name {
 			return export, true
 		}
 	}
-	return ExportInstance{}, false
+	return instance.Export{}, false
+}
+
+// Invoke calls the exported function name with args and returns its results. The call traps when the
+// context is done before the function returns.
+func (m *ModuleInstance) Invoke(ctx context.Context, name string, args ...values.Value) ([]values.Value, error) {
+	export, ok := m.GetExport(name)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' not found", name)
+	}
+	addr, ok := export.Value.(address.Function)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' is not a function", name)
+	}
+	return m.store.Invoke(ctx, addr, args...)
+}
+
+// Memory returns the exported memory name
+func (m *ModuleInstance) Memory(name string) (*instance.Memory, error) {
+	export, ok := m.GetExport(name)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' not found", name)
+	}
+	addr, ok := export.Value.(*address.Memory)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' is not a memory", name)
+	}
+	return &m.store.Mems[addr.Address], nil
+}
+
+// Global returns the exported global name
+func (m *ModuleInstance) Global(name string) (*instance.Global, error) {
+	export, ok := m.GetExport(name)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' not found", name)
+	}
+	addr, ok := export.Value.(*address.Global)
+	if !ok {
+		return nil, fmt.Errorf("export '%s' is not a global", name)
+	}
+	return &m.store.Globals[addr.Address], nil
 }
@@ -0,0 +1,915 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/instance"
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/patrickhuber/go-wasm/values"
+)
+
+const (
+	// next continues with the following instruction
+	next = -1
+	// ret unwinds to the caller of the current function
+	ret = -2
+)
+
+// MaxPages is the maximum number of pages a 32 bit memory can hold
+const MaxPages = 65536
+
+// Invoke calls the function at addr with args and returns its results. The call traps when the
+// context is done before the function returns.
+// see https://webassembly.github.io/spec/core/exec/modules.html#invocation
+func (s *Store) Invoke(ctx context.Context, addr address.Function, args ...values.Value) ([]values.Value, error) {
+	if int(addr) >= len(s.Funcs) {
+		return nil, fmt.Errorf("function address %d out of range", addr)
+	}
+	ft, err := funcType(s.Funcs[addr])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(ft.Parameters.Types) {
+		return nil, fmt.Errorf("expected %d arguments, found %d", len(ft.Parameters.Types), len(args))
+	}
+	for i, arg := range args {
+		if typeOf(arg) != ft.Parameters.Types[i] {
+			return nil, fmt.Errorf("argument %d: expected %v, found %T", i, ft.Parameters.Types[i], arg)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, trap.New(trap.Interrupted, "interrupted: %w", err)
+	}
+	m := newMachine(s)
+	defer m.watch(ctx)()
+	m.stack.Values = append(m.stack.Values, args...)
+	if err := m.call(addr); err != nil {
+		return nil, err
+	}
+	return m.stack.Values, nil
+}
+
+// eval runs instructions outside of a function body, as for constant expressions
+func (s *Store) eval(module *instance.Module, instructions []api.Instruction, locals []values.Value) ([]values.Value, error) {
+	m := newMachine(s)
+	// constant expressions do not consume fuel
+	m.cost = nil
+	frame := &FrameState{Locals: locals, Module: module}
+	if _, err := m.exec(frame, instructions); err != nil {
+		return nil, err
+	}
+	return m.stack.Values, nil
+}
+
+func funcType(fn instance.Function) (api.FuncType, error) {
+	switch f := fn.(type) {
+	case *instance.ModuleFunction:
+		return f.Type, nil
+	case *instance.HostCodeFunction:
+		return f.Type, nil
+	}
+	return api.FuncType{}, fmt.Errorf("unsupported function %T", fn)
+}
+
+type machine struct {
+	store *Store
+	stack *Stack
+	// slots hold the frames of compiled functions, top is the end of the innermost frame
+	slots []uint64
+	top   int
+	// depth is the number of module functions being called, it is limited by the call depth of the store
+	depth    int
+	maxDepth int
+	// cost is the fuel consumed by each instruction, it is nil when fuel is not enabled
+	cost func(api.Instruction) uint64
+	// source is the index of the failed instruction in the function body, it is added up as the error is returned
+	// by the blocks that contain the instruction
+	source int
+	// ctx is the context of the call, cancelled is set by another goroutine when it is done
+	ctx       context.Context
+	cancelled atomic.Uint32
+}
+
+func newMachine(s *Store) *machine {
+	m := &machine{store: s, stack: &Stack{}, maxDepth: s.Config.Limits.WithDefaults().CallDepth}
+	if s.Config.Fuel.Enabled {
+		m.cost = s.fuelCost()
+	}
+	return m
+}
+
+// enter records the call of a module function, leave must be called when it returns
+func (m *machine) enter() error {
+	if m.depth >= m.maxDepth {
+		return trap.New(trap.StackExhausted, "call stack exhausted")
+	}
+	if err := m.interrupted(); err != nil {
+		return err
+	}
+	m.depth++
+	return nil
+}
+
+func (m *machine) leave() {
+	m.depth--
+}
+
+func (m *machine) call(addr address.Function) error {
+	var fn *instance.ModuleFunction
+	switch f := m.store.Funcs[addr].(type) {
+	case *instance.ModuleFunction:
+		fn = f
+	case *instance.HostCodeFunction:
+		return m.callHost(addr, f)
+	default:
+		return fmt.Errorf("unsupported function %T", m.store.Funcs[addr])
+	}
+	if err := fn.Code.Load(); err != nil {
+		return err
+	}
+	compiled, err := m.store.compiled(addr)
+	if err != nil {
+		return err
+	}
+	if compiled != nil {
+		return m.callCompiled(addr, compiled)
+	}
+	params := len(fn.Type.Parameters.Types)
+	results := len(fn.Type.Returns.Types)
+	if len(m.stack.Values) < params {
+		return trap.New(trap.Unknown, "stack underflow calling function %d", addr)
+	}
+
+	height := len(m.stack.Values) - params
+	locals := make([]values.Value, 0, params+len(fn.Code.Locals))
+	locals = append(locals, m.stack.Values[height:]...)
+	for _, t := range fn.Code.Locals {
+		v, err := zero(t)
+		if err != nil {
+			return err
+		}
+		locals = append(locals, v)
+	}
+	m.stack.Values = m.stack.Values[:height]
+
+	if err := m.enter(); err != nil {
+		return err
+	}
+	frame := &FrameState{Locals: locals, Module: fn.Module}
+	m.stack.Activations = append(m.stack.Activations, Frame{FrameState: frame})
+	defer func() {
+		m.stack.Activations = m.stack.Activations[:len(m.stack.Activations)-1]
+		m.leave()
+	}()
+
+	var instructions []api.Instruction
+	if fn.Code.Body != nil {
+		instructions = fn.Code.Body.Instructions
+	}
+	if _, err := m.exec(frame, instructions); err != nil {
+		err = m.backtrace(err, addr, m.source)
+		m.source = 0
+		return err
+	}
+	return m.unwind(height, results)
+}
+
+// callIndirect calls the function referenced by the table element at the index on the stack
+// see https://webassembly.github.io/spec/core/exec/instructions.html#exec-call-indirect
+func (m *machine) callIndirect(f *FrameState, inst *api.CallIndirect) error {
+	if int(inst.Table) >= len(f.Module.TableAddresses) {
+		return fmt.Errorf("table index %d out of range", inst.Table)
+	}
+	if int(inst.Type) >= len(f.Module.Types) {
+		return fmt.Errorf("type index %d out of range", inst.Type)
+	}
+	index, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	table := &m.store.Tables[f.Module.TableAddresses[inst.Table].Address]
+	if int(index) >= len(table.Element) {
+		return trap.New(trap.UndefinedElement, "undefined element %d", index)
+	}
+	ref, ok := table.Element[index].(*values.FunctionReference)
+	if !ok {
+		return trap.New(trap.UninitializedElement, "uninitialized element %d", index)
+	}
+	ft, err := funcType(m.store.Funcs[ref.Address])
+	if err != nil {
+		return err
+	}
+	expected := f.Module.Types[inst.Type]
+	if !sameTypes(ft.Parameters.Types, expected.Parameters.Types) || !sameTypes(ft.Returns.Types, expected.Returns.Types) {
+		return trap.New(trap.IndirectCallTypeMismatch, "indirect call type mismatch")
+	}
+	return m.call(ref.Address)
+}
+
+// callHost passes the arguments on the stack to a host function and pushes its results
+// see https://webassembly.github.io/spec/core/exec/instructions.html#exec-invoke
+func (m *machine) callHost(addr address.Function, fn *instance.HostCodeFunction) error {
+	params := len(fn.Type.Parameters.Types)
+	if len(m.stack.Values) < params {
+		return trap.New(trap.Unknown, "stack underflow calling function %d", addr)
+	}
+	height := len(m.stack.Values) - params
+	args := make([]values.Value, params)
+	copy(args, m.stack.Values[height:])
+	m.stack.Values = m.stack.Values[:height]
+
+	results, err := fn.HostCode(m.ctx, args)
+	if err != nil {
+		return err
+	}
+	if len(results) != len(fn.Type.Returns.Types) {
+		return fmt.Errorf("host function %d returned %d values, expected %d", addr, len(results), len(fn.Type.Returns.Types))
+	}
+	for i, result := range results {
+		if typeOf(result) != fn.Type.Returns.Types[i] {
+			return fmt.Errorf("host function %d result %d: expected %v, found %T", addr, i, fn.Type.Returns.Types[i], result)
+		}
+	}
+	m.stack.Values = append(m.stack.Values, results...)
+	return nil
+}
+
+// unwind drops everything above height except the top arity values
+func (m *machine) unwind(height, arity int) error {
+	top := len(m.stack.Values) - arity
+	if top < height {
+		return trap.New(trap.Unknown, "stack underflow, expected %d values", arity)
+	}
+	m.stack.Values = append(m.stack.Values[:height], m.stack.Values[top:]...)
+	return nil
+}
+
+// exec runs the instructions in sequence. The result is next when the sequence completes,
+// ret when returning from the function or the relative depth of the label being branched to.
+func (m *machine) exec(f *FrameState, instructions []api.Instruction) (int, error) {
+	for i, instruction := range instructions {
+		br, err := m.step(f, instruction)
+		if err != nil {
+			m.source += count(instructions[:i])
+			return 0, err
+		}
+		if br != next {
+			return br, nil
+		}
+	}
+	return next, nil
+}
+
+func (m *machine) step(f *FrameState, instruction api.Instruction) (int, error) {
+	if m.cost != nil {
+		if err := m.store.consume(m.cost(instruction)); err != nil {
+			return 0, err
+		}
+	}
+	var err error
+	switch inst := instruction.(type) {
+
+	// control
+	case api.End, *api.Nop:
+	case *api.Unreachable:
+		return 0, trap.New(trap.Unreachable, "unreachable")
+	case *api.Block:
+		return m.block(f, inst.Type, inst.Instructions, false)
+	case *api.Loop:
+		return m.block(f, inst.Type, inst.Instructions, true)
+	case *api.If:
+		c, err := m.popI32()
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return m.block(f, inst.Type, inst.Instructions, false)
+		}
+		if inst.Else != nil {
+			br, err := m.block(f, inst.Type, inst.Else.Instructions, false)
+			if err != nil {
+				// the instructions of the else follow the instructions of the if
+				m.source += count(inst.Instructions)
+			}
+			return br, err
+		}
+	case *api.Branch:
+		return int(inst.Index), nil
+	case *api.BranchIf:
+		c, err := m.popI32()
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return int(inst.Index), nil
+		}
+	case *api.BranchTable:
+		i, err := m.popI32()
+		if err != nil {
+			return 0, err
+		}
+		if int(i) < len(inst.Indicies) {
+			return int(inst.Indicies[i]), nil
+		}
+		return int(inst.Index), nil
+	case *api.Return:
+		return ret, nil
+	case *api.Call:
+		if int(inst.Index) >= len(f.Module.FunctionAddresses) {
+			return 0, fmt.Errorf("function index %d out of range", inst.Index)
+		}
+		err = m.call(f.Module.FunctionAddresses[inst.Index])
+	case *api.CallIndirect:
+		err = m.callIndirect(f, inst)
+
+	// parametric
+	case *api.Drop:
+		_, err = m.pop()
+	case *api.Select:
+		err = m.selectValue()
+
+	// variable
+	case api.LocalGet:
+		if int(inst.Index) >= len(f.Locals) {
+			return 0, fmt.Errorf("local index %d out of range", inst.Index)
+		}
+		m.push(f.Locals[inst.Index])
+	case api.LocalSet:
+		err = m.setLocal(f, inst.Index, false)
+	case api.LocalTee:
+		err = m.setLocal(f, inst.Index, true)
+	case api.GlobalGet:
+		var g *instance.Global
+		g, err = m.global(f, inst.Index)
+		if err == nil {
+			m.push(g.Value)
+		}
+	case api.GlobalSet:
+		err = m.setGlobal(f, inst.Index)
+
+	// memory
+	case *api.Int32Load:
+		err = m.load(f, inst.MemoryArg, 4, func(b []byte) values.Value {
+			return values.I32Const(binary.LittleEndian.Uint32(b))
+		})
+	case *api.I32Load8:
+		err = m.load(f, inst.MemoryArg, 1, func(b []byte) values.Value {
+			return values.I32Const(uint32(int32(int8(b[0]))))
+		})
+	case *api.U32Load8u:
+		err = m.load(f, inst.MemoryArg, 1, func(b []byte) values.Value {
+			return values.I32Const(uint32(b[0]))
+		})
+	case *api.I32Load16:
+		err = m.load(f, inst.MemoryArg, 2, func(b []byte) values.Value {
+			return values.I32Const(uint32(int32(int16(binary.LittleEndian.Uint16(b)))))
+		})
+	case *api.U32Load16:
+		err = m.load(f, inst.MemoryArg, 2, func(b []byte) values.Value {
+			return values.I32Const(uint32(binary.LittleEndian.Uint16(b)))
+		})
+	case *api.Int32Store:
+		err = m.store32(f, inst.MemoryArg, 4)
+	case *api.I32Store8:
+		err = m.store32(f, inst.MemoryArg, 1)
+	case *api.U32Store8:
+		err = m.store32(f, inst.MemoryArg, 1)
+	case *api.I32Store16:
+		err = m.store32(f, inst.MemoryArg, 2)
+	case *api.U32Store16:
+		err = m.store32(f, inst.MemoryArg, 2)
+	case *api.MemorySize:
+		var mem *instance.Memory
+		mem, err = m.memory(f)
+		if err == nil {
+			m.push(values.I32Const(uint32(len(mem.Data) / PageSize)))
+		}
+	case *api.MemoryGrow:
+		err = m.memoryGrow(f)
+	case *api.MemoryCopy:
+		err = m.memoryCopy(f)
+
+	// numeric
+	case api.I32Const:
+		m.push(values.I32Const(inst))
+	case api.I64Const:
+		m.push(values.I64Const(inst))
+	case api.F32Const:
+		m.push(values.F32Const(inst))
+	case api.F64Const:
+		m.push(values.F64Const(inst))
+
+	case api.I32Eqz:
+		err = m.unaryI32(func(a uint32) uint32 { return boolI32(a == 0) })
+	case api.I32Eq:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a == b), nil })
+	case api.I32Ne:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a != b), nil })
+	case api.I32Lt:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(int32(a) < int32(b)), nil })
+	case api.U32Lt:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a < b), nil })
+	case api.I32Gt:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(int32(a) > int32(b)), nil })
+	case api.U32Gt:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a > b), nil })
+	case api.I32Le:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(int32(a) <= int32(b)), nil })
+	case api.U32Le:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a <= b), nil })
+	case api.I32Ge:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(int32(a) >= int32(b)), nil })
+	case api.U32Ge:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return boolI32(a >= b), nil })
+	case api.I32Add:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a + b, nil })
+	case api.I32Sub:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a - b, nil })
+	case api.I32Mul:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a * b, nil })
+	case api.I32Div:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			if int32(a) == math.MinInt32 && int32(b) == -1 {
+				return 0, trap.New(trap.IntegerOverflow, "integer overflow")
+			}
+			return uint32(int32(a) / int32(b)), nil
+		})
+	case api.U32Div:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return a / b, nil
+		})
+	case api.I32Rem:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return uint32(int32(a) % int32(b)), nil
+		})
+	case api.U32Rem:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return a % b, nil
+		})
+	case api.I32And:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a & b, nil })
+	case api.I32Or:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a | b, nil })
+	case api.I32Xor:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a ^ b, nil })
+	case api.I32Shl:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a << (b % 32), nil })
+	case api.I32Shr:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return uint32(int32(a) >> (b % 32)), nil })
+	case api.U32Shr:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return a >> (b % 32), nil })
+	case api.I32Rotl:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return bits.RotateLeft32(a, int(b%32)), nil })
+	case api.I32Rotr:
+		err = m.binaryI32(func(a, b uint32) (uint32, error) { return bits.RotateLeft32(a, -int(b%32)), nil })
+
+	case api.I64Eqz:
+		var a uint64
+		a, err = m.popI64()
+		if err == nil {
+			m.push(values.I32Const(boolI32(a == 0)))
+		}
+	case api.I64Eq:
+		err = m.compareI64(func(a, b uint64) bool { return a == b })
+	case api.I64Ne:
+		err = m.compareI64(func(a, b uint64) bool { return a != b })
+	case api.I64Lt:
+		err = m.compareI64(func(a, b uint64) bool { return int64(a) < int64(b) })
+	case api.U64Lt:
+		err = m.compareI64(func(a, b uint64) bool { return a < b })
+	case api.I64Gt:
+		err = m.compareI64(func(a, b uint64) bool { return int64(a) > int64(b) })
+	case api.U64Gt:
+		err = m.compareI64(func(a, b uint64) bool { return a > b })
+	case api.I64Le:
+		err = m.compareI64(func(a, b uint64) bool { return int64(a) <= int64(b) })
+	case api.U64Le:
+		err = m.compareI64(func(a, b uint64) bool { return a <= b })
+	case api.I64Ge:
+		err = m.compareI64(func(a, b uint64) bool { return int64(a) >= int64(b) })
+	case api.U64Ge:
+		err = m.compareI64(func(a, b uint64) bool { return a >= b })
+	case api.I64Add:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a + b, nil })
+	case api.I64Sub:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a - b, nil })
+	case api.I64Mul:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a * b, nil })
+	case api.I64Div:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			if int64(a) == math.MinInt64 && int64(b) == -1 {
+				return 0, trap.New(trap.IntegerOverflow, "integer overflow")
+			}
+			return uint64(int64(a) / int64(b)), nil
+		})
+	case api.U64Div:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return a / b, nil
+		})
+	case api.I64Rem:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return uint64(int64(a) % int64(b)), nil
+		})
+	case api.U64Rem:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) {
+			if b == 0 {
+				return 0, trap.New(trap.IntegerDivideByZero, "integer divide by zero")
+			}
+			return a % b, nil
+		})
+	case api.I64And:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a & b, nil })
+	case api.I64Or:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a | b, nil })
+	case api.I64Xor:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a ^ b, nil })
+	case api.I64Shl:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a << (b % 64), nil })
+	case api.I64Shr:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return uint64(int64(a) >> (b % 64)), nil })
+	case api.U64Shr:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return a >> (b % 64), nil })
+	case api.I64Rotl:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return bits.RotateLeft64(a, int(b%64)), nil })
+	case api.I64Rotr:
+		err = m.binaryI64(func(a, b uint64) (uint64, error) { return bits.RotateLeft64(a, -int(b%64)), nil })
+
+	default:
+		return 0, fmt.Errorf("unsupported instruction %T", instruction)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// block runs a block, loop or if body. A branch to the block's own label
+// exits a block and restarts a loop.
+func (m *machine) block(f *FrameState, bt api.BlockType, instructions []api.Instruction, loop bool) (int, error) {
+	params, results, err := blockArity(f.Module, bt)
+	if err != nil {
+		return 0, err
+	}
+	arity := results
+	if loop {
+		arity = params
+	}
+	for {
+		height := len(m.stack.Values) - params
+		if height < 0 {
+			return 0, trap.New(trap.Unknown, "stack underflow entering block")
+		}
+		br, err := m.exec(f, instructions)
+		if err != nil {
+			// the instructions of the block follow the block
+			m.source++
+			return 0, err
+		}
+		switch {
+		case br == next || br == ret:
+			return br, nil
+		case br > 0:
+			return br - 1, nil
+		}
+		if err := m.unwind(height, arity); err != nil {
+			return 0, err
+		}
+		if !loop {
+			return next, nil
+		}
+		if err := m.interrupted(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func blockArity(module *instance.Module, bt api.BlockType) (int, int, error) {
+	switch t := bt.(type) {
+	case nil:
+		return 0, 0, nil
+	case *api.BlockTypeValue:
+		return 0, 1, nil
+	case *api.BlockTypeIndex:
+		index, ok := t.Index.(api.TypeIndex)
+		if !ok || int(index) >= len(module.Types) {
+			return 0, 0, fmt.Errorf("invalid block type index %v", t.Index)
+		}
+		ft := module.Types[index]
+		return len(ft.Parameters.Types), len(ft.Returns.Types), nil
+	}
+	return 0, 0, fmt.Errorf("unsupported block type %T", bt)
+}
+
+func (m *machine) push(v values.Value) {
+	m.stack.Values = append(m.stack.Values, v)
+}
+
+func (m *machine) pop() (values.Value, error) {
+	if len(m.stack.Values) == 0 {
+		return nil, trap.New(trap.Unknown, "stack underflow")
+	}
+	v := m.stack.Values[len(m.stack.Values)-1]
+	m.stack.Values = m.stack.Values[:len(m.stack.Values)-1]
+	return v, nil
+}
+
+func (m *machine) popI32() (uint32, error) {
+	v, err := m.pop()
+	if err != nil {
+		return 0, err
+	}
+	i, ok := v.(values.I32Const)
+	if !ok {
+		return 0, fmt.Errorf("expected i32 on the stack, found %T", v)
+	}
+	return uint32(i), nil
+}
+
+func (m *machine) popI64() (uint64, error) {
+	v, err := m.pop()
+	if err != nil {
+		return 0, err
+	}
+	i, ok := v.(values.I64Const)
+	if !ok {
+		return 0, fmt.Errorf("expected i64 on the stack, found %T", v)
+	}
+	return uint64(i), nil
+}
+
+func (m *machine) unaryI32(op func(uint32) uint32) error {
+	a, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	m.push(values.I32Const(op(a)))
+	return nil
+}
+
+func (m *machine) binaryI32(op func(a, b uint32) (uint32, error)) error {
+	b, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	a, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	c, err := op(a, b)
+	if err != nil {
+		return err
+	}
+	m.push(values.I32Const(c))
+	return nil
+}
+
+func (m *machine) binaryI64(op func(a, b uint64) (uint64, error)) error {
+	b, err := m.popI64()
+	if err != nil {
+		return err
+	}
+	a, err := m.popI64()
+	if err != nil {
+		return err
+	}
+	c, err := op(a, b)
+	if err != nil {
+		return err
+	}
+	m.push(values.I64Const(c))
+	return nil
+}
+
+func (m *machine) compareI64(op func(a, b uint64) bool) error {
+	b, err := m.popI64()
+	if err != nil {
+		return err
+	}
+	a, err := m.popI64()
+	if err != nil {
+		return err
+	}
+	m.push(values.I32Const(boolI32(op(a, b))))
+	return nil
+}
+
+func (m *machine) selectValue() error {
+	c, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	v2, err := m.pop()
+	if err != nil {
+		return err
+	}
+	v1, err := m.pop()
+	if err != nil {
+		return err
+	}
+	if c != 0 {
+		m.push(v1)
+	} else {
+		m.push(v2)
+	}
+	return nil
+}
+
+func (m *machine) setLocal(f *FrameState, index api.LocalIndex, tee bool) error {
+	if int(index) >= len(f.Locals) {
+		return fmt.Errorf("local index %d out of range", index)
+	}
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	f.Locals[index] = v
+	if tee {
+		m.push(v)
+	}
+	return nil
+}
+
+func (m *machine) global(f *FrameState, index api.GlobalIndex) (*instance.Global, error) {
+	if int(index) >= len(f.Module.GlobalAddresses) {
+		return nil, fmt.Errorf("global index %d out of range", index)
+	}
+	return &m.store.Globals[f.Module.GlobalAddresses[index].Address], nil
+}
+
+func (m *machine) setGlobal(f *FrameState, index api.GlobalIndex) error {
+	g, err := m.global(f, index)
+	if err != nil {
+		return err
+	}
+	if g.Type.Mutable != api.Var {
+		return fmt.Errorf("global %d is immutable", index)
+	}
+	v, err := m.pop()
+	if err != nil {
+		return err
+	}
+	g.Value = v
+	return nil
+}
+
+func (m *machine) memory(f *FrameState) (*instance.Memory, error) {
+	if len(f.Module.MemoryAddresses) == 0 {
+		return nil, fmt.Errorf("module has no memory")
+	}
+	return &m.store.Mems[f.Module.MemoryAddresses[0].Address], nil
+}
+
+// effective returns the bytes at the effective address of a memory instruction
+func (m *machine) effective(f *FrameState, arg api.MemoryArg, size int) ([]byte, error) {
+	mem, err := m.memory(f)
+	if err != nil {
+		return nil, err
+	}
+	base, err := m.popI32()
+	if err != nil {
+		return nil, err
+	}
+	ea := uint64(base) + uint64(arg.Offset)
+	if ea+uint64(size) > uint64(len(mem.Data)) {
+		return nil, trap.New(trap.OutOfBoundsMemory, "out of bounds memory access at %d", ea)
+	}
+	return mem.Data[ea : ea+uint64(size)], nil
+}
+
+func (m *machine) load(f *FrameState, arg api.MemoryArg, size int, decode func([]byte) values.Value) error {
+	b, err := m.effective(f, arg, size)
+	if err != nil {
+		return err
+	}
+	m.push(decode(b))
+	return nil
+}
+
+func (m *machine) store32(f *FrameState, arg api.MemoryArg, size int) error {
+	v, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	b, err := m.effective(f, arg, size)
+	if err != nil {
+		return err
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	copy(b, buf[:size])
+	return nil
+}
+
+func (m *machine) memoryGrow(f *FrameState) error {
+	mem, err := m.memory(f)
+	if err != nil {
+		return err
+	}
+	delta, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	m.push(values.I32Const(m.store.grow(mem, delta)))
+	return nil
+}
+
+func (m *machine) memoryCopy(f *FrameState) error {
+	mem, err := m.memory(f)
+	if err != nil {
+		return err
+	}
+	n, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	src, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	dst, err := m.popI32()
+	if err != nil {
+		return err
+	}
+	length := uint64(len(mem.Data))
+	if uint64(src)+uint64(n) > length || uint64(dst)+uint64(n) > length {
+		return trap.New(trap.OutOfBoundsMemory, "out of bounds memory access")
+	}
+	copy(mem.Data[dst:dst+n], mem.Data[src:src+n])
+	return nil
+}
+
+func limitsMax(limits api.Limits) (uint32, bool) {
+	if limits.Max == nil {
+		return 0, false
+	}
+	return limits.Max.Deconstruct()
+}
+
+func boolI32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func zero(t api.ValType) (values.Value, error) {
+	switch t {
+	case api.I32Type:
+		return values.I32Const(0), nil
+	case api.I64Type:
+		return values.I64Const(0), nil
+	case api.F32Type:
+		return values.F32Const(0), nil
+	case api.F64Type:
+		return values.F64Const(0), nil
+	case api.V128Type:
+		return &values.V128Const{}, nil
+	case api.FuncRefType, api.ExternRefType:
+		return &values.NullReference{}, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %v", t)
+}
+
+func typeOf(v values.Value) api.ValType {
+	switch v.(type) {
+	case values.I32Const:
+		return api.I32Type
+	case values.I64Const:
+		return api.I64Type
+	case values.F32Const:
+		return api.F32Type
+	case values.F64Const:
+		return api.F64Type
+	case *values.V128Const:
+		return api.V128Type
+	}
+	return nil
+}
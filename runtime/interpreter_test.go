@@ -0,0 +1,381 @@
+package runtime_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/values"
+	"github.com/stretchr/testify/require"
+)
+
+func I32(n int) []api.ValType {
+	ts := make([]api.ValType, n)
+	for i := range ts {
+		ts[i] = api.I32Type
+	}
+	return ts
+}
+
+func Module(params, results int, locals []api.ValType, body ...api.Instruction) *api.Module {
+	return &api.Module{
+		Types: []*api.FuncType{
+			{Parameters: api.ResultType{Types: I32(params)}, Returns: api.ResultType{Types: I32(results)}},
+		},
+		Funcs: []*api.Func{
+			{Type: 0, Locals: locals, Body: &api.Expression{Instructions: body}},
+		},
+		Mems: []api.Mem{{Limits: api.Limits{Min: 1, Max: option.Some[uint32](2)}}},
+		Exports: []api.Export{
+			{Name: "f", Description: &api.FuncExportDescription{FuncIdx: 0}},
+			{Name: "memory", Description: &api.MemExportDescription{MemIdx: 0}},
+		},
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	type test struct {
+		name     string
+		module   *api.Module
+		args     []values.Value
+		expected []values.Value
+	}
+	tests := []test{
+		{
+			name:     "add",
+			module:   Module(2, 1, nil, api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, api.I32Add{}),
+			args:     []values.Value{values.I32Const(1), values.I32Const(2)},
+			expected: []values.Value{values.I32Const(3)},
+		},
+		{
+			name:     "signed_div",
+			module:   Module(2, 1, nil, api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, api.I32Div{}),
+			args:     []values.Value{values.I32Const(0xffff_fff8), values.I32Const(2)},
+			expected: []values.Value{values.I32Const(0xffff_fffc)},
+		},
+		{
+			// sum 1..n
+			name: "loop",
+			module: Module(1, 1, I32(1),
+				&api.Block{Instructions: []api.Instruction{
+					&api.Loop{Instructions: []api.Instruction{
+						api.LocalGet{Index: 0},
+						api.I32Eqz{},
+						&api.BranchIf{Index: 1},
+						api.LocalGet{Index: 1},
+						api.LocalGet{Index: 0},
+						api.I32Add{},
+						api.LocalSet{Index: 1},
+						api.LocalGet{Index: 0},
+						api.I32Const(1),
+						api.I32Sub{},
+						api.LocalSet{Index: 0},
+						&api.Branch{Index: 0},
+					}},
+				}},
+				api.LocalGet{Index: 1}),
+			args:     []values.Value{values.I32Const(10)},
+			expected: []values.Value{values.I32Const(55)},
+		},
+		{
+			name: "if_else",
+			module: Module(1, 1, nil,
+				api.LocalGet{Index: 0},
+				&api.If{
+					Type:         &api.BlockTypeValue{ValueType: api.I32Type},
+					Instructions: []api.Instruction{api.I32Const(1)},
+					Else:         &api.Else{Instructions: []api.Instruction{api.I32Const(2)}},
+				}),
+			args:     []values.Value{values.I32Const(0)},
+			expected: []values.Value{values.I32Const(2)},
+		},
+		{
+			name: "return",
+			module: Module(0, 1, nil,
+				api.I32Const(7),
+				&api.Block{Instructions: []api.Instruction{api.I32Const(8), &api.Return{}}},
+				&api.Unreachable{}),
+			expected: []values.Value{values.I32Const(8)},
+		},
+		{
+			name: "memory",
+			module: Module(0, 1, nil,
+				api.I32Const(8),
+				api.I32Const(0x1234_5678),
+				&api.Int32Store{MemoryArg: api.MemoryArg{Offset: 4}},
+				api.I32Const(12),
+				&api.U32Load16{}),
+			expected: []values.Value{values.I32Const(0x5678)},
+		},
+		{
+			name: "memory_grow",
+			module: Module(0, 2, nil,
+				api.I32Const(1),
+				&api.MemoryGrow{},
+				api.I32Const(1),
+				&api.MemoryGrow{}),
+			expected: []values.Value{values.I32Const(1), values.I32Const(0xffff_ffff)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := runtime.NewModuleInstance(&runtime.Store{}, test.module)
+			require.NoError(t, err)
+			results, err := m.Invoke(context.Background(), "f", test.args...)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, results)
+		})
+	}
+}
+
+func TestInvokeTrap(t *testing.T) {
+	type test struct {
+		name   string
+		module *api.Module
+	}
+	tests := []test{
+		{"unreachable", Module(0, 0, nil, &api.Unreachable{})},
+		{"divide_by_zero", Module(0, 1, nil, api.I32Const(1), api.I32Const(0), api.U32Div{})},
+		{"out_of_bounds", Module(0, 1, nil, api.I32Const(65534), &api.Int32Load{})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := runtime.NewModuleInstance(&runtime.Store{}, test.module)
+			require.NoError(t, err)
+			_, err = m.Invoke(context.Background(), "f")
+			require.ErrorContains(t, err, "trap")
+		})
+	}
+}
+
+func TestInvokeBinary(t *testing.T) {
+	f, err := os.Open("../fixtures/add/add.wasm")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = binary.ReadPreamble(f)
+	require.NoError(t, err)
+	module, err := binary.ReadModule(f)
+	require.NoError(t, err)
+
+	store := &runtime.Store{}
+	m, err := runtime.NewModuleInstance(store, module)
+	require.NoError(t, err)
+
+	results, err := store.Invoke(context.Background(), m.FunctionAddresses[0], values.I32Const(40), values.I32Const(2))
+	require.NoError(t, err)
+	require.Equal(t, []values.Value{values.I32Const(42)}, results)
+}
+
+func TestInvokeLazy(t *testing.T) {
+	data, err := os.ReadFile("../fixtures/add/add.wasm")
+	require.NoError(t, err)
+	module, _, err := binary.DecodeModuleOptions(data, binary.DecodeOptions{Code: binary.LazyCode})
+	require.NoError(t, err)
+	require.Nil(t, module.Funcs[0].Body)
+
+	store := &runtime.Store{}
+	m, err := runtime.NewModuleInstance(store, module)
+	require.NoError(t, err)
+
+	results, err := store.Invoke(context.Background(), m.FunctionAddresses[0], values.I32Const(40), values.I32Const(2))
+	require.NoError(t, err)
+	require.Equal(t, []values.Value{values.I32Const(42)}, results)
+}
+
+type contextKey struct{}
+
+func TestInvokeHost(t *testing.T) {
+	store := &runtime.Store{}
+	ft := api.FuncType{Parameters: api.ResultType{Types: I32(1)}, Returns: api.ResultType{Types: I32(1)}}
+	var called any
+	double := store.AllocHostFunction(ft, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+		called = ctx.Value(contextKey{})
+		return []values.Value{args[0].(values.I32Const) * 2}, nil
+	})
+
+	module := Module(1, 1, nil, api.LocalGet{Index: 0}, &api.Call{Index: 0}, api.I32Const(1), api.I32Add{})
+	module.Imports = []api.Import{
+		{Module: "env", Name: "double", Description: &api.FuncImportDescription{TypeIdx: 0}},
+	}
+	module.Exports[0].Description = &api.FuncExportDescription{FuncIdx: 1}
+
+	m, err := runtime.NewModuleInstance(store, module, double)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), contextKey{}, "caller")
+	results, err := m.Invoke(ctx, "f", values.I32Const(20))
+	require.NoError(t, err)
+	require.Equal(t, []values.Value{values.I32Const(41)}, results)
+	require.Equal(t, "caller", called)
+}
+
+func TestImportMemory(t *testing.T) {
+	store := &runtime.Store{}
+	exporter, err := runtime.NewModuleInstance(store, Module(0, 0, nil))
+	require.NoError(t, err)
+	export, ok := exporter.GetExport("memory")
+	require.True(t, ok)
+
+	module := Module(0, 1, nil, api.I32Const(8), api.I32Const(7), &api.Int32Store{}, api.I32Const(8), &api.Int32Load{})
+	module.Mems = nil
+	module.Imports = []api.Import{
+		{Module: "env", Name: "memory", Description: &api.MemImportDescription{Mem: api.Mem{Limits: api.Limits{Min: 1}}}},
+	}
+	m, err := runtime.NewModuleInstance(store, module, export.Value)
+	require.NoError(t, err)
+	results, err := m.Invoke(context.Background(), "f")
+	require.NoError(t, err)
+	require.Equal(t, []values.Value{values.I32Const(7)}, results)
+
+	mem, err := exporter.Memory("memory")
+	require.NoError(t, err)
+	require.Equal(t, byte(7), mem.Data[8])
+}
+
+func TestImportFail(t *testing.T) {
+	store := &runtime.Store{}
+	ft := api.FuncType{Parameters: api.ResultType{Types: I32(2)}}
+	host := store.AllocHostFunction(ft, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+		return nil, nil
+	})
+
+	module := Module(1, 1, nil, api.LocalGet{Index: 0})
+	module.Imports = []api.Import{
+		{Module: "env", Name: "f", Description: &api.FuncImportDescription{TypeIdx: 0}},
+	}
+	_, err := runtime.NewModuleInstance(store, module)
+	require.ErrorContains(t, err, "1 imports")
+	_, err = runtime.NewModuleInstance(store, module, host)
+	require.ErrorContains(t, err, "function type mismatch")
+}
+
+func TestCallIndirect(t *testing.T) {
+	store := &runtime.Store{}
+	ft := api.FuncType{Parameters: api.ResultType{Types: I32(1)}, Returns: api.ResultType{Types: I32(1)}}
+	double := store.AllocHostFunction(ft, func(ctx context.Context, args []values.Value) ([]values.Value, error) {
+		return []values.Value{args[0].(values.I32Const) * 2}, nil
+	})
+
+	table := api.Table{Limits: api.Limits{Min: 1, Max: option.Some[uint32](1)}, Reference: &api.FunctionReference{}}
+	shim := Module(1, 1, nil, api.LocalGet{Index: 0}, api.I32Const(0), &api.CallIndirect{Table: 0, Type: 0})
+	shim.Tables = []api.Table{table}
+	shim.Exports = append(shim.Exports, api.Export{Name: "table", Description: &api.TableExportDescription{TableIdx: 0}})
+	m, err := runtime.NewModuleInstance(store, shim)
+	require.NoError(t, err)
+	_, err = m.Invoke(context.Background(), "f", values.I32Const(21))
+	require.ErrorContains(t, err, "uninitialized element 0")
+
+	export, ok := m.GetExport("table")
+	require.True(t, ok)
+	fixup := &api.Module{
+		Types: []*api.FuncType{&ft},
+		Imports: []api.Import{
+			{Module: "", Name: "table", Description: &api.TableImportDescription{Table: table}},
+			{Module: "", Name: "double", Description: &api.FuncImportDescription{TypeIdx: 0}},
+		},
+		Elems: []api.Elem{
+			{Table: 0, Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(0)}}, Init: []api.FuncIndex{0}},
+		},
+	}
+	_, err = runtime.NewModuleInstance(store, fixup, export.Value, double)
+	require.NoError(t, err)
+
+	results, err := m.Invoke(context.Background(), "f", values.I32Const(21))
+	require.NoError(t, err)
+	require.Equal(t, []values.Value{values.I32Const(42)}, results)
+
+	fixup.Elems[0].Offset = &api.Expression{Instructions: []api.Instruction{api.I32Const(1)}}
+	_, err = runtime.NewModuleInstance(store, fixup, export.Value, double)
+	require.ErrorContains(t, err, "out of bounds table access")
+}
+
+func TestCallDepth(t *testing.T) {
+	// f returns its parameter after calling itself that many times
+	module := Module(1, 1, nil,
+		get(0), api.I32Eqz{},
+		&api.If{
+			Type:         &api.BlockTypeValue{ValueType: api.I32Type},
+			Instructions: []api.Instruction{i32(0)},
+			Else:         &api.Else{Instructions: []api.Instruction{get(0), i32(1), api.I32Sub{}, &api.Call{Index: 0}, i32(1), api.I32Add{}}},
+		})
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine, Limits: config.Limits{CallDepth: 10}}}
+			m, err := runtime.NewModuleInstance(store, module)
+			require.NoError(t, err)
+			results, err := m.Invoke(context.Background(), "f", values.I32Const(9))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(9)}, results)
+			_, err = m.Invoke(context.Background(), "f", values.I32Const(10))
+			require.EqualError(t, err, "trap: call stack exhausted")
+
+			// the default limit stops infinite recursion
+			m, err = runtime.NewModuleInstance(&runtime.Store{Config: config.Config{Engine: engine.engine}}, module)
+			require.NoError(t, err)
+			_, err = m.Invoke(context.Background(), "f", values.I32Const(0xffff_ffff))
+			require.EqualError(t, err, "trap: call stack exhausted")
+		})
+	}
+}
+
+func TestMemoryPagesLimit(t *testing.T) {
+	module := Module(1, 1, nil, get(0), &api.MemoryGrow{})
+	module.Mems[0].Limits.Max = option.None[uint32]()
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine, Limits: config.Limits{MemoryPages: 3}}}
+			m, err := runtime.NewModuleInstance(store, module)
+			require.NoError(t, err)
+			results, err := m.Invoke(context.Background(), "f", values.I32Const(3))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(0xffff_ffff)}, results)
+			results, err = m.Invoke(context.Background(), "f", values.I32Const(2))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(1)}, results)
+		})
+	}
+}
+
+func TestInstantiateLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits config.Limits
+		module func() *api.Module
+		// instances are instantiated before the module
+		instances int
+		message   string
+	}{
+		{"instances", config.Limits{Instances: 1}, func() *api.Module { return Module(0, 0, nil) }, 1, "store has reached the limit of 1 instances"},
+		{"functions", config.Limits{Functions: 1}, func() *api.Module {
+			module := Module(0, 0, nil)
+			module.Funcs = append(module.Funcs, module.Funcs[0])
+			return module
+		}, 0, "module has 2 functions, the limit is 1"},
+		{"table size", config.Limits{TableSize: 10}, func() *api.Module {
+			module := Module(0, 0, nil)
+			module.Tables = []api.Table{{Limits: api.Limits{Min: 11, Max: option.None[uint32]()}, Reference: &api.FunctionReference{}}}
+			return module
+		}, 0, "table minimum 11 exceeds the limit of 10 elements"},
+		{"memory pages", config.Limits{MemoryPages: 1}, func() *api.Module {
+			module := Module(0, 0, nil)
+			module.Mems[0].Limits.Min = 2
+			return module
+		}, 0, "memory minimum 2 exceeds the limit of 1 pages"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Limits: test.limits}}
+			for i := 0; i < test.instances; i++ {
+				_, err := runtime.NewModuleInstance(store, test.module())
+				require.NoError(t, err)
+			}
+			_, err := runtime.NewModuleInstance(store, test.module())
+			require.EqualError(t, err, test.message)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package runtime
+
+import (
+	"context"
+	"math"
+
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// IncrementEpoch advances the epoch of the store. It is safe to call from other goroutines while module
+// functions run, a ticker that increments the epoch bounds how long functions run with SetEpochDeadline.
+func (s *Store) IncrementEpoch() {
+	s.epoch.Add(1)
+}
+
+// Epoch returns the number of times the epoch of the store was incremented
+func (s *Store) Epoch() uint64 {
+	return s.epoch.Load()
+}
+
+// SetEpochDeadline makes module functions trap once the epoch is incremented ticks times after the call.
+// Functions check the epoch when they are called and at the start of every loop iteration.
+func (s *Store) SetEpochDeadline(ticks uint64) {
+	s.deadline = s.epoch.Load() + ticks
+	s.hasDeadline = true
+}
+
+// ClearEpochDeadline removes the deadline set with SetEpochDeadline, module functions run regardless of the epoch
+func (s *Store) ClearEpochDeadline() {
+	s.deadline = 0
+	s.hasDeadline = false
+}
+
+// epochDeadline returns the epoch at which module functions trap
+func (s *Store) epochDeadline() uint64 {
+	if !s.hasDeadline {
+		return math.MaxUint64
+	}
+	return s.deadline
+}
+
+// watch sets cancelled when the context is done, until the returned function is called
+func (m *machine) watch(ctx context.Context) func() {
+	m.ctx = ctx
+	done := ctx.Done()
+	if done == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			m.cancelled.Store(1)
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// interrupted returns a trap when the context of the call is done or the epoch of the store reached the
+// deadline. It is checked when module functions are called and at the start of every loop iteration.
+func (m *machine) interrupted() error {
+	if m.cancelled.Load() != 0 {
+		return trap.New(trap.Interrupted, "interrupted: %w", m.ctx.Err())
+	}
+	if m.store.epoch.Load() >= m.store.epochDeadline() {
+		return trap.New(trap.EpochDeadline, "epoch deadline exceeded")
+	}
+	return nil
+}
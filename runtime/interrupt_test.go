@@ -0,0 +1,149 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/values"
+	"github.com/stretchr/testify/require"
+)
+
+// spin never returns
+const spin = `(module
+  (func (export "spin") (loop $forever (br $forever)))
+  (func (export "add") (param i32 i32) (result i32) (i32.add (local.get 0) (local.get 1))))`
+
+func TestInterruptContext(t *testing.T) {
+	type test struct {
+		name    string
+		context func() (context.Context, context.CancelFunc)
+		message string
+		target  error
+	}
+	tests := []test{
+		{
+			name: "deadline",
+			context: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			message: "trap: interrupted: context deadline exceeded",
+			target:  context.DeadlineExceeded,
+		},
+		{
+			name: "cancel",
+			context: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			message: "trap: interrupted: context canceled",
+			target:  context.Canceled,
+		},
+		{
+			name: "cancelled",
+			context: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			message: "trap: interrupted: context canceled",
+			target:  context.Canceled,
+		},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.name+"/"+engine.name, func(t *testing.T) {
+				store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+				m, err := runtime.NewModuleInstance(store, decodeWat(t, spin))
+				require.NoError(t, err)
+
+				ctx, cancel := test.context()
+				defer cancel()
+				_, err = m.Invoke(ctx, "spin")
+				require.EqualError(t, err, test.message)
+				require.True(t, errors.Is(err, test.target))
+
+				// the store is not affected by the interrupted call
+				results, err := m.Invoke(context.Background(), "add", values.I32Const(1), values.I32Const(2))
+				require.NoError(t, err)
+				require.Equal(t, []values.Value{values.I32Const(3)}, results)
+			})
+		}
+	}
+}
+
+func TestInterruptEpoch(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+			m, err := runtime.NewModuleInstance(store, decodeWat(t, spin))
+			require.NoError(t, err)
+
+			// the loop is interrupted by the epoch incremented by another goroutine
+			store.SetEpochDeadline(2)
+			ticker := time.NewTicker(time.Millisecond)
+			done := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-ticker.C:
+						store.IncrementEpoch()
+					case <-done:
+						return
+					}
+				}
+			}()
+			_, err = m.Invoke(context.Background(), "spin")
+			ticker.Stop()
+			close(done)
+			<-stopped
+			require.EqualError(t, err, "trap: epoch deadline exceeded")
+			require.GreaterOrEqual(t, store.Epoch(), uint64(2))
+
+			// functions are interrupted when they are called
+			store.SetEpochDeadline(0)
+			_, err = m.Invoke(context.Background(), "add", values.I32Const(1), values.I32Const(2))
+			require.EqualError(t, err, "trap: epoch deadline exceeded")
+
+			store.ClearEpochDeadline()
+			results, err := m.Invoke(context.Background(), "add", values.I32Const(1), values.I32Const(2))
+			require.NoError(t, err)
+			require.Equal(t, []values.Value{values.I32Const(3)}, results)
+		})
+	}
+}
+
+// BenchmarkInterrupt measures the overhead of the checks in a loop with a context that can be cancelled
+// and an epoch deadline
+func BenchmarkInterrupt(b *testing.B) {
+	for _, engine := range engines {
+		for _, interruptible := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/interruptible=%t", engine.name, interruptible), func(b *testing.B) {
+				store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+				m, err := runtime.NewModuleInstance(store, decodeWat(b, count))
+				require.NoError(b, err)
+
+				ctx := context.Background()
+				if interruptible {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithCancel(ctx)
+					defer cancel()
+					store.SetEpochDeadline(1)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := m.Invoke(ctx, "count", values.I32Const(100_000)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
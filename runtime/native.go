@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	goruntime "runtime"
+	"unsafe"
+)
+
+// nativeBudget is the number of loop iterations after which machine code returns to Go. Go can not preempt
+// machine code, returning lets the scheduler run other goroutines, the garbage collector stop the world and
+// the goroutine watching the context of the call set the flag checked by loops.
+const nativeBudget = 1 << 16
+
+// native is the machine code of a function compiled to bytecode. The machine code runs the instructions it
+// supports on the slots of the frame and exits to Go for the others: calls, globals, fuel, memory.size,
+// memory.grow, memory.copy and every instruction that traps. Go runs the instruction as bytecode and enters
+// the machine code again at the next instruction, so host functions and traps behave as they do in the other
+// engines.
+type native struct {
+	code []byte
+	// entries are the offsets of the machine code of each instruction
+	entries []uint32
+	// memory is the address of the memory accessed by the machine code, loads and stores of other memories exit
+	memory uint32
+}
+
+// nativeContext is shared with the machine code, the offsets of its fields are used by the assembly
+type nativeContext struct {
+	// frame is the address of the first slot of the frame
+	frame unsafe.Pointer
+	// memory is the address of the data of the memory and size its length in bytes
+	memory unsafe.Pointer
+	size   uint64
+	// pc is the instruction the machine code exited at, the length of the code when the function returned
+	pc uint64
+	// epoch points to the epoch of the store, loops exit when it reaches deadline
+	epoch    *uint64
+	deadline uint64
+	// cancelled points to the flag set when the context of the call is done, loops exit when it is not zero
+	cancelled *uint32
+	// budget is decremented by every loop iteration, loops exit when it reaches zero
+	budget uint64
+}
+
+// memory returns the address of the memory accessed by loads and stores or false when there are none
+func memory(fn *function) (uint32, bool) {
+	for _, in := range fn.code {
+		if in.op >= opI32Load && in.op <= opI32Store16 {
+			return in.c, true
+		}
+	}
+	return 0, false
+}
+
+// native runs machine code in the frame starting at fp and returns the position of the instruction that
+// returned or failed
+func (m *machine) native(fn *function, fp int) (int, error) {
+	code := fn.native
+	// the atomic values hold a single integer at their address
+	ctx := nativeContext{
+		epoch:     (*uint64)(unsafe.Pointer(&m.store.epoch)),
+		cancelled: (*uint32)(unsafe.Pointer(&m.cancelled)),
+		budget:    nativeBudget,
+	}
+	for pc := 0; pc < len(fn.code); pc++ {
+		// the slots and the memory move when they grow, which only happens while Go runs an instruction
+		ctx.frame = unsafe.Add(unsafe.Pointer(unsafe.SliceData(m.slots)), fp*8)
+		// the deadline may be changed by host functions
+		ctx.deadline = m.store.epochDeadline()
+		ctx.memory, ctx.size = nil, 0
+		if int(code.memory) < len(m.store.Mems) {
+			data := m.store.Mems[code.memory].Data
+			ctx.memory, ctx.size = unsafe.Pointer(unsafe.SliceData(data)), uint64(len(data))
+		}
+		enter(uintptr(unsafe.Pointer(&code.code[code.entries[pc]])), &ctx)
+		pc = int(ctx.pc)
+		if pc >= len(fn.code) {
+			return pc, nil
+		}
+		if ctx.budget == 0 {
+			ctx.budget = nativeBudget
+			goruntime.Gosched()
+		}
+		// the instruction at pc runs as bytecode
+		one := function{code: fn.code[pc : pc+1], types: fn.types, frame: fn.frame}
+		if _, err := m.execute(&one, fp); err != nil {
+			return pc, err
+		}
+	}
+	return len(fn.code), nil
+}
+
+// assembler places labels and patches the branches to them
+type assembler struct {
+	buf []byte
+	// labels are the offsets of the instructions, the end of the function and the exits of the instructions
+	labels []int
+	fixups []fixup
+	// exits are the instructions that exit conditionally
+	exits []bool
+}
+
+// fixup is a branch at offset at to a label
+type fixup struct {
+	at    int
+	label int
+}
+
+func newAssembler(fn *function) *assembler {
+	n := len(fn.code)
+	a := &assembler{labels: make([]int, 2*n+1), exits: make([]bool, n)}
+	for i := range a.labels {
+		a.labels[i] = -1
+	}
+	return a
+}
+
+func (a *assembler) emit(b ...byte) {
+	a.buf = append(a.buf, b...)
+}
+
+func (a *assembler) place(label int) {
+	a.labels[label] = len(a.buf)
+}
+
+// end is the label after the last instruction
+func (a *assembler) end() int {
+	return len(a.exits)
+}
+
+// exit returns the label of the code that exits at the instruction pc
+func (a *assembler) exit(pc int) int {
+	a.exits[pc] = true
+	return len(a.exits) + 1 + pc
+}
+
+// entries returns the offsets of the instructions
+func (a *assembler) entries() []uint32 {
+	entries := make([]uint32, len(a.exits))
+	for i := range entries {
+		entries[i] = uint32(a.labels[i])
+	}
+	return entries
+}
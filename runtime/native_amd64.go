@@ -0,0 +1,357 @@
+//go:build linux
+
+package runtime
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// registers of the machine code. r8 holds the address of the frame, r9 the address of the memory,
+// r10 the size of the memory and r11 the address of the context. rax, rcx and rdx are scratch registers.
+const (
+	rax = 0
+	rcx = 1
+	rdx = 2
+	r10 = 10
+)
+
+// condition codes of jcc, setcc is jcc+0x10
+const (
+	ccE  = 0x84
+	ccNE = 0x85
+	ccB  = 0x82
+	ccAE = 0x83
+	ccBE = 0x86
+	ccA  = 0x87
+	ccL  = 0x8c
+	ccGE = 0x8d
+	ccLE = 0x8e
+	ccG  = 0x8f
+)
+
+var amd64Compares = map[op]struct {
+	wide bool
+	cc   byte
+}{
+	opI32Eq: {false, ccE}, opI32Ne: {false, ccNE},
+	opI32LtS: {false, ccL}, opI32LtU: {false, ccB}, opI32GtS: {false, ccG}, opI32GtU: {false, ccA},
+	opI32LeS: {false, ccLE}, opI32LeU: {false, ccBE}, opI32GeS: {false, ccGE}, opI32GeU: {false, ccAE},
+	opI64Eq: {true, ccE}, opI64Ne: {true, ccNE},
+	opI64LtS: {true, ccL}, opI64LtU: {true, ccB}, opI64GtS: {true, ccG}, opI64GtU: {true, ccA},
+	opI64LeS: {true, ccLE}, opI64LeU: {true, ccBE}, opI64GeS: {true, ccGE}, opI64GeU: {true, ccAE},
+}
+
+// amd64Arithmetic are the opcodes of the operations of a register with a slot
+var amd64Arithmetic = map[op]struct {
+	wide   bool
+	opcode []byte
+}{
+	opI32Add: {false, []byte{0x03}}, opI32Sub: {false, []byte{0x2b}}, opI32Mul: {false, []byte{0x0f, 0xaf}},
+	opI32And: {false, []byte{0x23}}, opI32Or: {false, []byte{0x0b}}, opI32Xor: {false, []byte{0x33}},
+	opI64Add: {true, []byte{0x03}}, opI64Sub: {true, []byte{0x2b}}, opI64Mul: {true, []byte{0x0f, 0xaf}},
+	opI64And: {true, []byte{0x23}}, opI64Or: {true, []byte{0x0b}}, opI64Xor: {true, []byte{0x33}},
+}
+
+// amd64Shifts are the opcode extensions of the shifts and rotations by cl
+var amd64Shifts = map[op]struct {
+	wide bool
+	ext  int
+}{
+	opI32Shl: {false, 4}, opI32ShrS: {false, 7}, opI32ShrU: {false, 5}, opI32Rotl: {false, 0}, opI32Rotr: {false, 1},
+	opI64Shl: {true, 4}, opI64ShrS: {true, 7}, opI64ShrU: {true, 5}, opI64Rotl: {true, 0}, opI64Rotr: {true, 1},
+}
+
+// amd64Divisions are the signedness and the register holding the result of divisions
+var amd64Divisions = map[op]struct {
+	wide, signed bool
+	result       int
+}{
+	opI32DivS: {false, true, rax}, opI32DivU: {false, false, rax}, opI32RemS: {false, true, rdx}, opI32RemU: {false, false, rdx},
+	opI64DivS: {true, true, rax}, opI64DivU: {true, false, rax}, opI64RemS: {true, true, rdx}, opI64RemU: {true, false, rdx},
+}
+
+type amd64 struct {
+	*assembler
+}
+
+// translate returns the machine code of the bytecode and the offsets of its instructions
+func translate(fn *function, memory uint32) ([]byte, []uint32, error) {
+	a := amd64{newAssembler(fn)}
+	for pc, in := range fn.code {
+		a.place(pc)
+		if !a.instruction(pc, in, memory) {
+			a.ret(pc)
+		}
+	}
+	a.place(a.end())
+	a.ret(a.end())
+	for pc, exit := range a.exits {
+		if exit {
+			a.place(a.end() + 1 + pc)
+			a.ret(pc)
+		}
+	}
+	for _, f := range a.fixups {
+		binary.LittleEndian.PutUint32(a.buf[f.at:], uint32(a.labels[f.label]-(f.at+4)))
+	}
+	return a.buf, a.entries(), nil
+}
+
+// instruction translates an instruction and returns false when it runs in Go
+func (a amd64) instruction(pc int, in instr, memory uint32) bool {
+	switch in.op {
+	case opCopy:
+		a.load(true, rax, in.b)
+		a.store(rax, in.a)
+	case opConst:
+		a.emit(0x48, 0xb8)
+		a.emit(binary.LittleEndian.AppendUint64(nil, in.imm)...)
+		a.store(rax, in.a)
+	case opBr:
+		a.move(in.c, in.b, uint32(in.imm))
+		a.jump(0, int(in.a))
+	case opBrIf, opBrUnless:
+		a.load(false, rax, in.b)
+		a.rr(false, rax, rax, 0x85)
+		if in.op == opBrIf {
+			a.jump(ccNE, int(in.a))
+		} else {
+			a.jump(ccE, int(in.a))
+		}
+	case opBrTable:
+		a.load(false, rax, in.b)
+		for i := uint32(0); i < in.c; i++ {
+			// cmp eax, i
+			a.emit(0x3d)
+			a.emit(binary.LittleEndian.AppendUint32(nil, i)...)
+			a.jump(ccE, pc+1+int(i))
+		}
+		a.jump(0, pc+1+int(in.c))
+	case opReturn:
+		a.move(0, in.b, in.c)
+		a.jump(0, a.end())
+	case opCheck:
+		// dec qword [r11+56]
+		a.emit(0x49, 0xff, 0x4b, 0x38)
+		a.jump(ccE, a.exit(pc))
+		// mov rax, [r11+32]; mov rax, [rax]; cmp rax, [r11+40]
+		a.emit(0x49, 0x8b, 0x43, 0x20, 0x48, 0x8b, 0x00, 0x49, 0x3b, 0x43, 0x28)
+		a.jump(ccAE, a.exit(pc))
+		// mov rax, [r11+48]; cmp dword [rax], 0
+		a.emit(0x49, 0x8b, 0x43, 0x30, 0x83, 0x38, 0x00)
+		a.jump(ccNE, a.exit(pc))
+	case opSelect:
+		a.load(true, rcx, in.a+1)
+		a.load(false, rdx, in.a+2)
+		a.rr(false, rdx, rdx, 0x85)
+		a.load(true, rax, in.a)
+		// cmove rax, rcx
+		a.rr(true, rax, rcx, 0x0f, 0x44)
+		a.store(rax, in.a)
+	case opI32Load, opI32Load8S, opI32Load8U, opI32Load16S, opI32Load16U:
+		if in.c != memory {
+			return false
+		}
+		switch in.op {
+		case opI32Load:
+			a.address(pc, in.b, in.imm, 4)
+			a.mem(rax, 0x8b)
+		case opI32Load8S:
+			a.address(pc, in.b, in.imm, 1)
+			a.mem(rax, 0x0f, 0xbe)
+		case opI32Load8U:
+			a.address(pc, in.b, in.imm, 1)
+			a.mem(rax, 0x0f, 0xb6)
+		case opI32Load16S:
+			a.address(pc, in.b, in.imm, 2)
+			a.mem(rax, 0x0f, 0xbf)
+		case opI32Load16U:
+			a.address(pc, in.b, in.imm, 2)
+			a.mem(rax, 0x0f, 0xb7)
+		}
+		a.store(rax, in.a)
+	case opI32Store, opI32Store8, opI32Store16:
+		if in.c != memory {
+			return false
+		}
+		switch in.op {
+		case opI32Store:
+			a.address(pc, in.a, in.imm, 4)
+			a.load(false, rcx, in.b)
+			a.mem(rcx, 0x89)
+		case opI32Store8:
+			a.address(pc, in.a, in.imm, 1)
+			a.load(false, rcx, in.b)
+			a.mem(rcx, 0x88)
+		case opI32Store16:
+			a.address(pc, in.a, in.imm, 2)
+			a.load(false, rcx, in.b)
+			a.emit(0x66)
+			a.mem(rcx, 0x89)
+		}
+	case opI32Eqz, opI64Eqz:
+		wide := in.op == opI64Eqz
+		a.load(wide, rax, in.b)
+		a.rr(wide, rax, rax, 0x85)
+		a.set(ccE, in.a)
+	case opI32AddImm:
+		a.load(false, rax, in.b)
+		a.emit(0x05)
+		a.emit(binary.LittleEndian.AppendUint32(nil, uint32(in.imm))...)
+		a.store(rax, in.a)
+	default:
+		if c, ok := amd64Compares[in.op]; ok {
+			a.load(c.wide, rax, in.b)
+			a.slot(c.wide, rax, in.c, 0x3b)
+			a.set(c.cc, in.a)
+		} else if o, ok := amd64Arithmetic[in.op]; ok {
+			a.load(o.wide, rax, in.b)
+			a.slot(o.wide, rax, in.c, o.opcode...)
+			a.store(rax, in.a)
+		} else if s, ok := amd64Shifts[in.op]; ok {
+			// the count is masked like the wasm operations
+			a.load(s.wide, rax, in.b)
+			a.load(false, rcx, in.c)
+			a.rr(s.wide, s.ext, rax, 0xd3)
+			a.store(rax, in.a)
+		} else if d, ok := amd64Divisions[in.op]; ok {
+			a.division(pc, in, d.wide, d.signed, d.result)
+		} else {
+			return false
+		}
+	}
+	return true
+}
+
+// division exits when the divisor is zero or -1, which traps or overflows the idiv instruction
+func (a amd64) division(pc int, in instr, wide, signed bool, result int) {
+	a.load(wide, rax, in.b)
+	a.load(wide, rcx, in.c)
+	a.rr(wide, rcx, rcx, 0x85)
+	a.jump(ccE, a.exit(pc))
+	if signed {
+		// cmp rcx, -1
+		a.rr(wide, 7, rcx, 0x83)
+		a.emit(0xff)
+		a.jump(ccE, a.exit(pc))
+		// cdq or cqo
+		if wide {
+			a.emit(0x48)
+		}
+		a.emit(0x99)
+		a.rr(wide, 7, rcx, 0xf7)
+	} else {
+		a.rr(false, rdx, rdx, 0x31)
+		a.rr(wide, 6, rcx, 0xf7)
+	}
+	a.store(result, in.a)
+}
+
+// address sets rax to the effective address of a load or store and exits when the access is out of bounds
+func (a amd64) address(pc int, slot uint32, offset uint64, size byte) {
+	a.load(false, rax, slot)
+	if offset > math.MaxInt32 {
+		// mov rdx, offset; add rax, rdx
+		a.emit(0x48, 0xba)
+		a.emit(binary.LittleEndian.AppendUint64(nil, offset)...)
+		a.rr(true, rdx, rax, 0x01)
+	} else if offset > 0 {
+		// add rax, offset
+		a.emit(0x48, 0x05)
+		a.emit(binary.LittleEndian.AppendUint32(nil, uint32(offset))...)
+	}
+	// lea rdx, [rax+size]; cmp rdx, r10
+	a.emit(0x48, 0x8d, 0x50, size)
+	a.rr(true, r10, rdx, 0x39)
+	a.jump(ccA, a.exit(pc))
+}
+
+// move copies n slots from src to dst
+func (a amd64) move(dst, src, n uint32) {
+	if dst == src {
+		return
+	}
+	for i := uint32(0); i < n; i++ {
+		j := i
+		if dst > src {
+			j = n - 1 - i
+		}
+		a.load(true, rax, src+j)
+		a.store(rax, dst+j)
+	}
+}
+
+// rex returns the prefix for the register reg in the reg field and the register rm in the r/m field
+func rex(wide bool, reg, rm int) byte {
+	b := byte(0x40) | byte(reg>>3)<<2 | byte(rm>>3)
+	if wide {
+		b |= 0x08
+	}
+	return b
+}
+
+// rr emits an instruction with two register operands
+func (a amd64) rr(wide bool, reg, rm int, opcode ...byte) {
+	if prefix := rex(wide, reg, rm); prefix != 0x40 {
+		a.emit(prefix)
+	}
+	a.emit(opcode...)
+	a.emit(0xc0 | byte(reg&7)<<3 | byte(rm&7))
+}
+
+// slot emits an instruction with a register and a slot of the frame as operands
+func (a amd64) slot(wide bool, reg int, slot uint32, opcode ...byte) {
+	// [r8+disp32]
+	a.emit(rex(wide, reg, 8))
+	a.emit(opcode...)
+	a.emit(0x80 | byte(reg&7)<<3)
+	a.emit(binary.LittleEndian.AppendUint32(nil, slot*8)...)
+}
+
+// mem emits an instruction with a register and the memory at rax as operands
+func (a amd64) mem(reg int, opcode ...byte) {
+	// [r9+rax]
+	a.emit(rex(false, reg, 8))
+	a.emit(opcode...)
+	a.emit(0x04|byte(reg&7)<<3, 0x01)
+}
+
+func (a amd64) load(wide bool, reg int, slot uint32) {
+	a.slot(wide, reg, slot, 0x8b)
+}
+
+func (a amd64) store(reg int, slot uint32) {
+	a.slot(true, reg, slot, 0x89)
+}
+
+// set sets a slot to 1 when the condition holds and to 0 otherwise
+func (a amd64) set(cc byte, slot uint32) {
+	// setcc al; movzx eax, al
+	a.emit(0x0f, cc+0x10, 0xc0, 0x0f, 0xb6, 0xc0)
+	a.store(rax, slot)
+}
+
+// jump emits a jump to a label, the condition code 0 jumps unconditionally
+func (a amd64) jump(cc byte, label int) {
+	if cc == 0 {
+		a.emit(0xe9)
+	} else {
+		a.emit(0x0f, cc)
+	}
+	a.fixups = append(a.fixups, fixup{at: len(a.buf), label: label})
+	a.emit(0, 0, 0, 0)
+}
+
+// ret stores pc in the context and returns to Go
+func (a amd64) ret(pc int) {
+	// mov qword [r11+24], pc; ret
+	a.emit(0x49, 0xc7, 0x43, 0x18)
+	a.emit(binary.LittleEndian.AppendUint32(nil, uint32(pc))...)
+	a.emit(0xc3)
+}
+
+// enter calls the machine code at entry with the context
+//
+//go:noescape
+func enter(entry uintptr, ctx *nativeContext)
@@ -0,0 +1,13 @@
+//go:build linux
+
+#include "textflag.h"
+
+// func enter(entry uintptr, ctx *nativeContext)
+TEXT ·enter(SB), NOSPLIT, $0-16
+	MOVQ ctx+8(FP), R11
+	MOVQ 0(R11), R8
+	MOVQ 8(R11), R9
+	MOVQ 16(R11), R10
+	MOVQ entry+0(FP), AX
+	CALL AX
+	RET
@@ -0,0 +1,380 @@
+//go:build linux
+
+package runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// registers of the machine code. x9 holds the address of the frame, x10 the address of the memory,
+// x11 the size of the memory and x12 the address of the context. x0 to x2 are scratch registers.
+const (
+	x0  = 0
+	x1  = 1
+	x2  = 2
+	x9  = 9
+	x10 = 10
+	x11 = 11
+	x12 = 12
+	xzr = 31
+)
+
+// condition codes
+const (
+	condEQ = 0x0
+	condNE = 0x1
+	condHS = 0x2
+	condLO = 0x3
+	condHI = 0x8
+	condLS = 0x9
+	condGE = 0xa
+	condLT = 0xb
+	condGT = 0xc
+	condLE = 0xd
+)
+
+// sf is the bit that selects the 64 bit variant of an instruction
+const sf = 1 << 31
+
+// maxSlot is the largest slot addressed by the unsigned offset of a load or store
+const maxSlot = 4095
+
+var arm64Compares = map[op]struct {
+	wide bool
+	cond uint32
+}{
+	opI32Eq: {false, condEQ}, opI32Ne: {false, condNE},
+	opI32LtS: {false, condLT}, opI32LtU: {false, condLO}, opI32GtS: {false, condGT}, opI32GtU: {false, condHI},
+	opI32LeS: {false, condLE}, opI32LeU: {false, condLS}, opI32GeS: {false, condGE}, opI32GeU: {false, condHS},
+	opI64Eq: {true, condEQ}, opI64Ne: {true, condNE},
+	opI64LtS: {true, condLT}, opI64LtU: {true, condLO}, opI64GtS: {true, condGT}, opI64GtU: {true, condHI},
+	opI64LeS: {true, condLE}, opI64LeU: {true, condLS}, opI64GeS: {true, condGE}, opI64GeU: {true, condHS},
+}
+
+// arm64Arithmetic are the instructions of the operations of two registers
+var arm64Arithmetic = map[op]struct {
+	wide        bool
+	instruction uint32
+}{
+	opI32Add: {false, 0x0b000000}, opI32Sub: {false, 0x4b000000}, opI32Mul: {false, 0x1b007c00},
+	opI32And: {false, 0x0a000000}, opI32Or: {false, 0x2a000000}, opI32Xor: {false, 0x4a000000},
+	opI32Shl: {false, 0x1ac02000}, opI32ShrS: {false, 0x1ac02800}, opI32ShrU: {false, 0x1ac02400}, opI32Rotr: {false, 0x1ac02c00},
+	opI64Add: {true, 0x0b000000}, opI64Sub: {true, 0x4b000000}, opI64Mul: {true, 0x1b007c00},
+	opI64And: {true, 0x0a000000}, opI64Or: {true, 0x2a000000}, opI64Xor: {true, 0x4a000000},
+	opI64Shl: {true, 0x1ac02000}, opI64ShrS: {true, 0x1ac02800}, opI64ShrU: {true, 0x1ac02400}, opI64Rotr: {true, 0x1ac02c00},
+}
+
+// arm64Divisions are the signedness of divisions and whether they compute the remainder
+var arm64Divisions = map[op]struct {
+	wide, signed, remainder bool
+}{
+	opI32DivS: {false, true, false}, opI32DivU: {false, false, false}, opI32RemS: {false, true, true}, opI32RemU: {false, false, true},
+	opI64DivS: {true, true, false}, opI64DivU: {true, false, false}, opI64RemS: {true, true, true}, opI64RemU: {true, false, true},
+}
+
+type arm64 struct {
+	*assembler
+}
+
+// translate returns the machine code of the bytecode and the offsets of its instructions
+func translate(fn *function, memory uint32) ([]byte, []uint32, error) {
+	if fn.frame > maxSlot+1 {
+		return nil, nil, fmt.Errorf("frame of %d slots is too large", fn.frame)
+	}
+	a := arm64{newAssembler(fn)}
+	for pc, in := range fn.code {
+		a.place(pc)
+		if !a.instruction(pc, in, memory) {
+			a.ret(pc)
+		}
+	}
+	a.place(a.end())
+	a.ret(a.end())
+	for pc, exit := range a.exits {
+		if exit {
+			a.place(a.end() + 1 + pc)
+			a.ret(pc)
+		}
+	}
+	for _, f := range a.fixups {
+		offset := (a.labels[f.label] - f.at) / 4
+		word := binary.LittleEndian.Uint32(a.buf[f.at:])
+		if word&0xfc000000 == 0x14000000 {
+			word |= uint32(offset) & 0x3ffffff
+		} else {
+			if offset < -(1<<18) || offset >= 1<<18 {
+				return nil, nil, fmt.Errorf("branch out of range")
+			}
+			word |= (uint32(offset) & 0x7ffff) << 5
+		}
+		binary.LittleEndian.PutUint32(a.buf[f.at:], word)
+	}
+	return a.buf, a.entries(), nil
+}
+
+// instruction translates an instruction and returns false when it runs in Go
+func (a arm64) instruction(pc int, in instr, memory uint32) bool {
+	switch in.op {
+	case opCopy:
+		a.load(x0, in.b)
+		a.store(x0, in.a)
+	case opConst:
+		a.constant(x0, in.imm)
+		a.store(x0, in.a)
+	case opBr:
+		a.move(in.c, in.b, uint32(in.imm))
+		a.jump(int(in.a))
+	case opBrIf, opBrUnless:
+		a.load(x0, in.b)
+		if in.op == opBrIf {
+			// cbnz w0
+			a.branch(0x35000000|x0, int(in.a))
+		} else {
+			// cbz w0
+			a.branch(0x34000000|x0, int(in.a))
+		}
+	case opBrTable:
+		a.load(x0, in.b)
+		for i := uint32(0); i < in.c; i++ {
+			a.compare(false, x0, uint64(i))
+			a.branch(0x54000000|condEQ, pc+1+int(i))
+		}
+		a.jump(pc + 1 + int(in.c))
+	case opReturn:
+		a.move(0, in.b, in.c)
+		a.jump(a.end())
+	case opCheck:
+		// ldr x0, [x12, #56]; subs x0, x0, #1; str x0, [x12, #56]; b.eq exit
+		a.word(0xf9400000 | 7<<10 | x12<<5 | x0)
+		a.word(0xf1000400 | x0<<5 | x0)
+		a.word(0xf9000000 | 7<<10 | x12<<5 | x0)
+		a.branch(0x54000000|condEQ, a.exit(pc))
+		// ldr x0, [x12, #32]; ldr x0, [x0]; ldr x1, [x12, #40]; cmp x0, x1; b.hs exit
+		a.word(0xf9400000 | 4<<10 | x12<<5 | x0)
+		a.word(0xf9400000 | x0<<5 | x0)
+		a.word(0xf9400000 | 5<<10 | x12<<5 | x1)
+		a.word(sf | 0x6b000000 | x1<<16 | x0<<5 | xzr)
+		a.branch(0x54000000|condHS, a.exit(pc))
+		// ldr x0, [x12, #48]; ldr w0, [x0]; cbnz w0, exit
+		a.word(0xf9400000 | 6<<10 | x12<<5 | x0)
+		a.word(0xb9400000 | x0<<5 | x0)
+		a.branch(0x35000000|x0, a.exit(pc))
+	case opSelect:
+		a.load(x0, in.a)
+		a.load(x1, in.a+1)
+		a.load(x2, in.a+2)
+		a.compare(false, x2, 0)
+		// csel x0, x1, x0, eq
+		a.word(0x9a800000 | x0<<16 | condEQ<<12 | x1<<5 | x0)
+		a.store(x0, in.a)
+	case opI32Load, opI32Load8S, opI32Load8U, opI32Load16S, opI32Load16U:
+		if in.c != memory {
+			return false
+		}
+		// ldr w0, [x10, x0] and the byte and half word variants
+		switch in.op {
+		case opI32Load:
+			a.address(pc, in.b, in.imm, 4)
+			a.word(0xb8606800 | x0<<16 | x10<<5 | x0)
+		case opI32Load8S:
+			a.address(pc, in.b, in.imm, 1)
+			a.word(0x38e06800 | x0<<16 | x10<<5 | x0)
+		case opI32Load8U:
+			a.address(pc, in.b, in.imm, 1)
+			a.word(0x38606800 | x0<<16 | x10<<5 | x0)
+		case opI32Load16S:
+			a.address(pc, in.b, in.imm, 2)
+			a.word(0x78e06800 | x0<<16 | x10<<5 | x0)
+		case opI32Load16U:
+			a.address(pc, in.b, in.imm, 2)
+			a.word(0x78606800 | x0<<16 | x10<<5 | x0)
+		}
+		a.store(x0, in.a)
+	case opI32Store, opI32Store8, opI32Store16:
+		if in.c != memory {
+			return false
+		}
+		// str w1, [x10, x0] and the byte and half word variants
+		switch in.op {
+		case opI32Store:
+			a.address(pc, in.a, in.imm, 4)
+			a.load(x1, in.b)
+			a.word(0xb8206800 | x0<<16 | x10<<5 | x1)
+		case opI32Store8:
+			a.address(pc, in.a, in.imm, 1)
+			a.load(x1, in.b)
+			a.word(0x38206800 | x0<<16 | x10<<5 | x1)
+		case opI32Store16:
+			a.address(pc, in.a, in.imm, 2)
+			a.load(x1, in.b)
+			a.word(0x78206800 | x0<<16 | x10<<5 | x1)
+		}
+	case opI32Eqz, opI64Eqz:
+		a.load(x0, in.b)
+		a.compare(in.op == opI64Eqz, x0, 0)
+		a.set(condEQ, in.a)
+	case opI32AddImm:
+		a.load(x0, in.b)
+		a.constant(x1, uint64(uint32(in.imm)))
+		// add w0, w0, w1
+		a.word(0x0b000000 | x1<<16 | x0<<5 | x0)
+		a.store(x0, in.a)
+	case opI32Rotl, opI64Rotl:
+		// rotating left is rotating right by the negated count
+		wide := in.op == opI64Rotl
+		a.load(x0, in.b)
+		a.load(x1, in.c)
+		// neg w1, w1; rorv w0, w0, w1
+		a.word(0x4b000000 | xzr<<5 | x1<<16 | x1)
+		a.word(size(wide) | 0x1ac02c00 | x1<<16 | x0<<5 | x0)
+		a.store(x0, in.a)
+	default:
+		if c, ok := arm64Compares[in.op]; ok {
+			a.load(x0, in.b)
+			a.load(x1, in.c)
+			// cmp w0, w1
+			a.word(size(c.wide) | 0x6b000000 | x1<<16 | x0<<5 | xzr)
+			a.set(c.cond, in.a)
+		} else if o, ok := arm64Arithmetic[in.op]; ok {
+			// the count of shifts and rotations is masked like the wasm operations
+			a.load(x0, in.b)
+			a.load(x1, in.c)
+			a.word(size(o.wide) | o.instruction | x1<<16 | x0<<5 | x0)
+			a.store(x0, in.a)
+		} else if d, ok := arm64Divisions[in.op]; ok {
+			a.division(pc, in, d.wide, d.signed, d.remainder)
+		} else {
+			return false
+		}
+	}
+	return true
+}
+
+// division exits when the divisor is zero or -1, Go traps or computes the result without overflowing
+func (a arm64) division(pc int, in instr, wide, signed, remainder bool) {
+	a.load(x0, in.b)
+	a.load(x1, in.c)
+	// cbz w1 or cbz x1
+	a.branch(size(wide)|0x34000000|x1, a.exit(pc))
+	if signed {
+		// cmn w1, #1; b.eq exit; sdiv w2, w0, w1
+		a.word(size(wide) | 0x3100001f | 1<<10 | x1<<5)
+		a.branch(0x54000000|condEQ, a.exit(pc))
+		a.word(size(wide) | 0x1ac00c00 | x1<<16 | x0<<5 | x2)
+	} else {
+		// udiv w2, w0, w1
+		a.word(size(wide) | 0x1ac00800 | x1<<16 | x0<<5 | x2)
+	}
+	if remainder {
+		// msub w2, w2, w1, w0
+		a.word(size(wide) | 0x1b008000 | x1<<16 | x0<<10 | x2<<5 | x2)
+	}
+	a.store(x2, in.a)
+}
+
+// address sets x0 to the effective address of a load or store and exits when the access is out of bounds
+func (a arm64) address(pc int, slot uint32, offset uint64, size uint32) {
+	a.load(x0, slot)
+	// mov w0, w0
+	a.word(0x2a000000 | x0<<16 | xzr<<5 | x0)
+	if offset > 0 {
+		// add x0, x0, x1
+		a.constant(x1, offset)
+		a.word(sf | 0x0b000000 | x1<<16 | x0<<5 | x0)
+	}
+	// add x1, x0, #size; cmp x1, x11; b.hi exit
+	a.word(0x91000000 | size<<10 | x0<<5 | x1)
+	a.word(sf | 0x6b000000 | x11<<16 | x1<<5 | xzr)
+	a.branch(0x54000000|condHI, a.exit(pc))
+}
+
+// move copies n slots from src to dst
+func (a arm64) move(dst, src, n uint32) {
+	if dst == src {
+		return
+	}
+	for i := uint32(0); i < n; i++ {
+		j := i
+		if dst > src {
+			j = n - 1 - i
+		}
+		a.load(x0, src+j)
+		a.store(x0, dst+j)
+	}
+}
+
+func size(wide bool) uint32 {
+	if wide {
+		return sf
+	}
+	return 0
+}
+
+func (a arm64) word(w uint32) {
+	a.emit(binary.LittleEndian.AppendUint32(nil, w)...)
+}
+
+// load sets a register to a slot of the frame
+func (a arm64) load(reg uint32, slot uint32) {
+	// ldr x, [x9, #slot*8]
+	a.word(0xf9400000 | slot<<10 | x9<<5 | reg)
+}
+
+// store sets a slot of the frame to a register
+func (a arm64) store(reg uint32, slot uint32) {
+	// str x, [x9, #slot*8]
+	a.word(0xf9000000 | slot<<10 | x9<<5 | reg)
+}
+
+// constant sets a register to a value with movz and movk
+func (a arm64) constant(reg uint32, value uint64) {
+	a.word(sf | 0x52800000 | uint32(value&0xffff)<<5 | reg)
+	for shift := uint32(1); shift < 4; shift++ {
+		if part := uint32(value>>(16*shift)) & 0xffff; part != 0 {
+			a.word(sf | 0x72800000 | shift<<21 | part<<5 | reg)
+		}
+	}
+}
+
+// compare compares a register with a value
+func (a arm64) compare(wide bool, reg uint32, value uint64) {
+	if value < 1<<12 {
+		// cmp w, #value
+		a.word(size(wide) | 0x7100001f | uint32(value)<<10 | reg<<5)
+		return
+	}
+	a.constant(x2, value)
+	a.word(size(wide) | 0x6b000000 | x2<<16 | reg<<5 | xzr)
+}
+
+// set sets a slot to 1 when the condition holds and to 0 otherwise
+func (a arm64) set(cond uint32, slot uint32) {
+	// cset w0, cond
+	a.word(0x1a9f07e0 | (cond^1)<<12 | x0)
+	a.store(x0, slot)
+}
+
+// jump emits an unconditional branch to a label
+func (a arm64) jump(label int) {
+	a.branch(0x14000000, label)
+}
+
+// branch emits a branch to a label, the offset is added when the labels are placed
+func (a arm64) branch(word uint32, label int) {
+	a.fixups = append(a.fixups, fixup{at: len(a.buf), label: label})
+	a.word(word)
+}
+
+// ret stores pc in the context and returns to Go
+func (a arm64) ret(pc int) {
+	// str x0, [x12, #24]; ret
+	a.constant(x0, uint64(pc))
+	a.word(0xf9000000 | 3<<10 | x12<<5 | x0)
+	a.word(0xd65f03c0)
+}
+
+// enter calls the machine code at entry with the context
+//
+//go:noescape
+func enter(entry uintptr, ctx *nativeContext)
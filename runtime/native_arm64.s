@@ -0,0 +1,13 @@
+//go:build linux
+
+#include "textflag.h"
+
+// func enter(entry uintptr, ctx *nativeContext)
+TEXT ·enter(SB), NOSPLIT, $16-16
+	MOVD ctx+8(FP), R12
+	MOVD 0(R12), R9
+	MOVD 8(R12), R10
+	MOVD 16(R12), R11
+	MOVD entry+0(FP), R4
+	CALL (R4)
+	RET
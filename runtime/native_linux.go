@@ -0,0 +1,31 @@
+//go:build linux && (amd64 || arm64)
+
+package runtime
+
+import (
+	goruntime "runtime"
+	"syscall"
+)
+
+// assemble translates bytecode to machine code
+func assemble(fn *function) (*native, error) {
+	memory, _ := memory(fn)
+	code, entries, err := translate(fn, memory)
+	if err != nil {
+		return nil, err
+	}
+	executable, err := syscall.Mmap(-1, 0, len(code), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	copy(executable, code)
+	if err := syscall.Mprotect(executable, syscall.PROT_READ|syscall.PROT_EXEC); err != nil {
+		_ = syscall.Munmap(executable)
+		return nil, err
+	}
+	n := &native{code: executable, entries: entries, memory: memory}
+	goruntime.SetFinalizer(n, func(n *native) {
+		_ = syscall.Munmap(n.code)
+	})
+	return n, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux || !(amd64 || arm64)
+
+package runtime
+
+// assemble returns no machine code on platforms without a native backend, functions run as bytecode instead
+func assemble(fn *function) (*native, error) {
+	return nil, nil
+}
+
+func enter(entry uintptr, ctx *nativeContext) {
+	panic("native code is not supported")
+}
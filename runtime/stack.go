@@ -21,5 +21,5 @@ type Frame struct {
 
 type FrameState struct {
 	Locals []values.Value
-	Module instance.Module
+	Module *instance.Module
 }
@@ -1,6 +1,14 @@
 package runtime
 
-import "github.com/patrickhuber/go-wasm/instance"
+import (
+	"sync/atomic"
+
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/instance"
+	"github.com/patrickhuber/go-wasm/trap"
+)
 
 // Store represents all global state
 // see https://webassembly.github.io/spec/core/exec/runtime.html#store
@@ -11,5 +19,58 @@ type Store struct {
 	Globals []instance.Global
 	Elems   []instance.Element
 	Datas   []instance.Data
-	Modules []instance.Module
+	Modules []*instance.Module
+	// Config selects the engine that runs module functions
+	Config config.Config
+	// code holds the compiled module functions by address, they are compiled on the first call
+	code []compiledFunction
+	// fuel is the fuel left for module functions and consumed the fuel they used when fuel is enabled
+	fuel     uint64
+	consumed uint64
+	// epoch is incremented by other goroutines, functions trap when it reaches the deadline
+	epoch       atomic.Uint64
+	deadline    uint64
+	hasDeadline bool
+}
+
+// AllocHostFunction adds a function implemented by the embedder to the store
+// see https://webassembly.github.io/spec/core/exec/modules.html#alloc-hostfunc
+func (s *Store) AllocHostFunction(ft api.FuncType, fn instance.HostFunction) address.Function {
+	addr := address.Function(len(s.Funcs))
+	s.Funcs = append(s.Funcs, &instance.HostCodeFunction{Type: ft, HostCode: fn})
+	return addr
+}
+
+// AddFuel adds fuel for module functions to consume when fuel is enabled. Host functions may add fuel
+// while module functions run, the functions that called them continue with the new fuel.
+func (s *Store) AddFuel(fuel uint64) {
+	s.fuel += fuel
+}
+
+// ConsumedFuel returns the fuel consumed by module functions
+func (s *Store) ConsumedFuel() uint64 {
+	return s.consumed
+}
+
+// RemainingFuel returns the fuel left for module functions
+func (s *Store) RemainingFuel() uint64 {
+	return s.fuel
+}
+
+// fuelCost returns the cost of instructions configured for the store
+func (s *Store) fuelCost() func(api.Instruction) uint64 {
+	if s.Config.Fuel.Cost != nil {
+		return s.Config.Fuel.Cost
+	}
+	return config.DefaultCost
+}
+
+// consume takes fuel from the store, it traps without taking fuel when the store does not have enough
+func (s *Store) consume(fuel uint64) error {
+	if fuel > s.fuel {
+		return trap.New(trap.OutOfFuel, "all fuel consumed")
+	}
+	s.fuel -= fuel
+	s.consumed += fuel
+	return nil
 }
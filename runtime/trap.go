@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"errors"
+
+	"github.com/patrickhuber/go-wasm/address"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/instance"
+	"github.com/patrickhuber/go-wasm/trap"
+)
+
+// backtrace adds the function at addr to the backtrace when err is a trap, source is the index of the
+// instruction that failed. The callers of the function add their frames as the trap is returned to them.
+func (m *machine) backtrace(err error, addr address.Function, source int) error {
+	var t *trap.Trap
+	if errors.As(err, &t) {
+		t.Backtrace = append(t.Backtrace, m.frame(addr, source))
+	}
+	return err
+}
+
+// frame returns the frame of the module function at addr. The offset of the frame is the position of the
+// instruction in the binary module and is left zero for functions that were not decoded with offsets.
+func (m *machine) frame(addr address.Function, source int) trap.Frame {
+	var frame trap.Frame
+	fn, ok := m.store.Funcs[addr].(*instance.ModuleFunction)
+	if !ok {
+		return frame
+	}
+	if source < len(fn.Code.Offsets) {
+		frame.Offset = fn.Code.Offsets[source]
+	}
+	for i, a := range fn.Module.FunctionAddresses {
+		if a == addr {
+			frame.Func = api.FuncIndex(i)
+			frame.Name = fn.Module.Names.Func(frame.Func)
+			break
+		}
+	}
+	return frame
+}
+
+// count returns the number of instructions including the instructions of blocks
+func count(instructions []api.Instruction) int {
+	n := len(instructions)
+	for _, instruction := range instructions {
+		switch inst := instruction.(type) {
+		case *api.Block:
+			n += count(inst.Instructions)
+		case *api.Loop:
+			n += count(inst.Instructions)
+		case *api.If:
+			n += count(inst.Instructions)
+			if inst.Else != nil {
+				n += count(inst.Else.Instructions)
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,172 @@
+package runtime_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/config"
+	"github.com/patrickhuber/go-wasm/opcode"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/patrickhuber/go-wasm/values"
+	"github.com/stretchr/testify/require"
+)
+
+// traps has a function for most trap codes
+const traps = `(module
+  (type $unary (func (param i32) (result i32)))
+  (memory 1)
+  (table funcref (elem $div))
+  (func $div (export "div") (param i32 i32) (result i32) (i32.div_s (local.get 0) (local.get 1)))
+  (func (export "load") (param i32) (result i32) (i32.load (local.get 0)))
+  (func (export "indirect") (param i32) (result i32) (call_indirect (type $unary) (i32.const 1) (local.get 0)))
+  (func $runaway (export "runaway") (call $runaway)))`
+
+// nested traps in inner when called with zero, the exported function does not have a name
+const nested = `(module
+  (func $inner (param i32) (result i32) (i32.div_u (i32.const 1) (local.get 0)))
+  (func $middle (param i32) (result i32) (block (result i32) (call $inner (local.get 0))))
+  (func (export "outer") (param i32) (result i32)
+    (if (result i32) (local.get 0) (then (i32.const 0)) (else (call $middle (local.get 0))))))`
+
+func TestTrapCode(t *testing.T) {
+	type test struct {
+		name    string
+		args    []values.Value
+		code    trap.Code
+		message string
+	}
+	tests := []test{
+		{"div", []values.Value{values.I32Const(1), values.I32Const(0)}, trap.IntegerDivideByZero, "trap: integer divide by zero"},
+		{"div", []values.Value{values.I32Const(0x8000_0000), values.I32Const(0xffff_ffff)}, trap.IntegerOverflow, "trap: integer overflow"},
+		{"load", []values.Value{values.I32Const(65535)}, trap.OutOfBoundsMemory, "trap: out of bounds memory access at 65535"},
+		{"indirect", []values.Value{values.I32Const(0)}, trap.IndirectCallTypeMismatch, "trap: indirect call type mismatch"},
+		{"indirect", []values.Value{values.I32Const(1)}, trap.UndefinedElement, "trap: undefined element 1"},
+		{"runaway", nil, trap.StackExhausted, "trap: call stack exhausted"},
+	}
+	for _, test := range tests {
+		for _, engine := range engines {
+			t.Run(test.code.String()+"/"+engine.name, func(t *testing.T) {
+				store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+				m, err := runtime.NewModuleInstance(store, decodeWat(t, traps))
+				require.NoError(t, err)
+
+				_, err = m.Invoke(context.Background(), test.name, test.args...)
+				require.EqualError(t, err, test.message)
+				require.True(t, errors.Is(err, &trap.Trap{Code: test.code}))
+				require.True(t, errors.Is(err, &trap.Trap{}))
+				require.False(t, errors.Is(err, &trap.Trap{Code: trap.Unreachable}))
+			})
+		}
+	}
+}
+
+func TestTrapBacktrace(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			module := decodeWat(t, nested)
+			// the instructions of function i are at 0x100*(i+1) with the instructions of blocks after the block
+			for i, fn := range module.Funcs {
+				for j := 0; j < 8; j++ {
+					fn.Offsets = append(fn.Offsets, 0x100*(i+1)+j)
+				}
+			}
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+			m, err := runtime.NewModuleInstance(store, module)
+			require.NoError(t, err)
+
+			_, err = m.Invoke(context.Background(), "outer", values.I32Const(0))
+			var trapped *trap.Trap
+			require.True(t, errors.As(err, &trapped))
+			require.Equal(t, trap.IntegerDivideByZero, trapped.Code)
+			require.Equal(t, []trap.Frame{
+				{Func: 0, Name: "inner", Offset: 0x102},
+				{Func: 1, Name: "middle", Offset: 0x202},
+				{Func: 2, Offset: 0x304},
+			}, trapped.Backtrace)
+			require.Equal(t, "trap: integer divide by zero\n  inner (func 0) @ 0x102\n  middle (func 1) @ 0x202\n  func 2 @ 0x304", trapped.Trace())
+		})
+	}
+}
+
+// indirect traps in inner with the binary instructions the decoder supports
+const indirect = `(module
+  (type $unary (func (param i32) (result i32)))
+  (table 1 funcref)
+  (func $inner (param i32) (result i32) (call_indirect (type $unary) (local.get 0) (local.get 0)))
+  (func $middle (param i32) (result i32) (call $inner (local.get 0)))
+  (func (export "outer") (param i32) (result i32) (i32.add (i32.const 1) (call $middle (local.get 0)))))`
+
+func TestTrapBacktraceBinary(t *testing.T) {
+	// the text format does not end bodies with an end instruction like the binary format
+	text := decodeWat(t, indirect)
+	for _, fn := range text.Funcs {
+		fn.Body.Instructions = append(fn.Body.Instructions, api.End{})
+	}
+	var buf bytes.Buffer
+	err := binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ModuleVersion},
+		Directive: text,
+	})
+	require.NoError(t, err)
+	data := buf.Bytes()
+	module, _, err := binary.DecodeModule(data)
+	require.NoError(t, err)
+
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine}}
+			m, err := runtime.NewModuleInstance(store, module)
+			require.NoError(t, err)
+
+			_, err = m.Invoke(context.Background(), "outer", values.I32Const(0))
+			var trapped *trap.Trap
+			require.True(t, errors.As(err, &trapped))
+			require.Equal(t, trap.UninitializedElement, trapped.Code)
+			require.Equal(t, []trap.Frame{
+				{Func: 0, Name: "inner", Offset: 0x30},
+				{Func: 1, Name: "middle", Offset: 0x38},
+				{Func: 2, Offset: 0x41},
+			}, trapped.Backtrace)
+			// the offsets are the positions of the opcodes of the calls
+			require.Equal(t, byte(opcode.CallIndirect), data[0x30])
+			require.Equal(t, byte(opcode.Call), data[0x38])
+			require.Equal(t, byte(opcode.Call), data[0x41])
+		})
+	}
+}
+
+func TestTrapExhaustionBacktrace(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			store := &runtime.Store{Config: config.Config{Engine: engine.engine, Limits: config.Limits{CallDepth: 10}}}
+			m, err := runtime.NewModuleInstance(store, decodeWat(t, traps))
+			require.NoError(t, err)
+
+			_, err = m.Invoke(context.Background(), "runaway")
+			var trapped *trap.Trap
+			require.True(t, errors.As(err, &trapped))
+			require.Equal(t, trap.StackExhausted, trapped.Code)
+			require.Len(t, trapped.Backtrace, 10)
+			for _, frame := range trapped.Backtrace {
+				require.Equal(t, trap.Frame{Func: 3, Name: "runaway"}, frame)
+			}
+		})
+	}
+}
+
+func TestTrapCause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store := &runtime.Store{}
+	m, err := runtime.NewModuleInstance(store, decodeWat(t, spin))
+	require.NoError(t, err)
+
+	_, err = m.Invoke(ctx, "spin")
+	require.True(t, errors.Is(err, &trap.Trap{Code: trap.Interrupted}))
+	require.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,150 @@
+// Package trap defines the error returned when the execution of a module function or a
+// canonical ABI operation traps. It only depends on api so every layer can return traps.
+package trap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/patrickhuber/go-wasm/api"
+)
+
+// Code is the reason of a trap
+type Code int
+
+const (
+	// Unknown is the code of traps without a specific reason, such as the traps of host functions
+	Unknown Code = iota
+	Unreachable
+	IntegerDivideByZero
+	IntegerOverflow
+	OutOfBoundsMemory
+	OutOfBoundsTable
+	UndefinedElement
+	UninitializedElement
+	IndirectCallTypeMismatch
+	StackExhausted
+	OutOfFuel
+	Interrupted
+	EpochDeadline
+
+	// the codes of the canonical ABI
+	// see https://github.com/WebAssembly/component-model/blob/main/design/mvp/CanonicalABI.md
+
+	// UnalignedPointer is a pointer that is not aligned to the alignment of the value it points to
+	UnalignedPointer
+	// InvalidChar is a char that is not a unicode scalar value
+	InvalidChar
+	// InvalidDiscriminant is a case index outside the cases of a variant
+	InvalidDiscriminant
+	// InvalidHandle is a handle or table index without an element of the expected type
+	InvalidHandle
+	// OutstandingBorrow is a handle dropped or a call returned while a borrow is still live
+	OutstandingBorrow
+	// LengthOverflow is a string, list or table longer than the canonical ABI allows
+	LengthOverflow
+	// TypeMismatch is a value that does not match its type
+	TypeMismatch
+	// CannotLeave is a call from a component instance that may not leave
+	CannotLeave
+	// CannotEnter is a call into a component instance that may not be entered
+	CannotEnter
+	// InvalidState is an operation on a stream, future, waitable or task in a state that does not allow it
+	InvalidState
+	// Deadlock is an async call where no task is able to make progress
+	Deadlock
+)
+
+var codes = []string{
+	Unknown:                  "unknown",
+	Unreachable:              "unreachable",
+	IntegerDivideByZero:      "integer divide by zero",
+	IntegerOverflow:          "integer overflow",
+	OutOfBoundsMemory:        "out of bounds memory access",
+	OutOfBoundsTable:         "out of bounds table access",
+	UndefinedElement:         "undefined element",
+	UninitializedElement:     "uninitialized element",
+	IndirectCallTypeMismatch: "indirect call type mismatch",
+	StackExhausted:           "call stack exhausted",
+	OutOfFuel:                "all fuel consumed",
+	Interrupted:              "interrupted",
+	EpochDeadline:            "epoch deadline exceeded",
+	UnalignedPointer:         "unaligned pointer",
+	InvalidChar:              "invalid char",
+	InvalidDiscriminant:      "invalid discriminant",
+	InvalidHandle:            "invalid handle",
+	OutstandingBorrow:        "outstanding borrow",
+	LengthOverflow:           "length overflow",
+	TypeMismatch:             "type mismatch",
+	CannotLeave:              "cannot leave component instance",
+	CannotEnter:              "cannot enter component instance",
+	InvalidState:             "invalid state",
+	Deadlock:                 "deadlock",
+}
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codes) {
+		return codes[Unknown]
+	}
+	return codes[c]
+}
+
+// Trap is the error returned when execution traps
+type Trap struct {
+	Code    Code
+	Message string
+	// Backtrace holds the module functions being called when the trap occurred, the innermost first
+	Backtrace []Frame
+	// Err is the cause of the trap, such as the error of the context of an interrupted call
+	Err error
+}
+
+// Frame is a module function being called when a trap occurred
+type Frame struct {
+	// Func is the index of the function in its module
+	Func api.FuncIndex
+	// Name is the name of the function or empty when the module does not name it
+	Name string
+	// Offset is the position of the instruction being run, relative to the start of the binary module.
+	// It is zero when the function was not decoded from the binary format.
+	Offset int
+}
+
+// New returns a trap with the formatted message, a %w verb sets the cause of the trap
+func New(code Code, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &Trap{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+func (t *Trap) Error() string {
+	return "trap: " + t.Message
+}
+
+func (t *Trap) Unwrap() error {
+	return t.Err
+}
+
+// Is returns true when target is a trap with the same code, a trap with Unknown matches every trap.
+// Use errors.Is(err, &trap.Trap{Code: trap.StackExhausted}) to check the reason of a trap.
+func (t *Trap) Is(target error) bool {
+	other, ok := target.(*Trap)
+	return ok && (other.Code == Unknown || other.Code == t.Code)
+}
+
+// Trace returns the message of the trap followed by a line for each frame of the backtrace
+func (t *Trap) Trace() string {
+	var sb strings.Builder
+	sb.WriteString(t.Error())
+	for _, frame := range t.Backtrace {
+		fmt.Fprintf(&sb, "\n  %v", frame)
+	}
+	return sb.String()
+}
+
+func (f Frame) String() string {
+	if f.Name == "" {
+		return fmt.Sprintf("func %d @ 0x%x", f.Func, f.Offset)
+	}
+	return fmt.Sprintf("%s (func %d) @ 0x%x", f.Name, f.Func, f.Offset)
+}
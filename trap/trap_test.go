@@ -0,0 +1,37 @@
+package trap_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/trap"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrap(t *testing.T) {
+	err := trap.New(trap.Interrupted, "interrupted: %w", context.Canceled)
+	require.EqualError(t, err, "trap: interrupted: context canceled")
+	require.True(t, errors.Is(err, &trap.Trap{Code: trap.Interrupted}))
+	require.True(t, errors.Is(err, &trap.Trap{}))
+	require.False(t, errors.Is(err, &trap.Trap{Code: trap.EpochDeadline}))
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestCodeString(t *testing.T) {
+	type test struct {
+		code trap.Code
+		text string
+	}
+	tests := []test{
+		{trap.Unknown, "unknown"},
+		{trap.IntegerDivideByZero, "integer divide by zero"},
+		{trap.InvalidChar, "invalid char"},
+		{trap.Deadlock, "deadlock"},
+		{trap.Code(-1), "unknown"},
+		{trap.Deadlock + 1, "unknown"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.text, test.code.String())
+	}
+}
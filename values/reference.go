@@ -17,6 +17,14 @@ type AddressReference struct{}
 func (*AddressReference) reference() {}
 func (*AddressReference) value()     {}
 
+// FunctionReference refers to a function in the store
+type FunctionReference struct {
+	Address address.Function
+}
+
+func (*FunctionReference) reference() {}
+func (*FunctionReference) value()     {}
+
 type ExternalReference struct {
 	Address address.External
 }
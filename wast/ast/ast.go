@@ -2,6 +2,7 @@ package ast
 
 import (
 	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	wat "github.com/patrickhuber/go-wasm/wat/ast"
 )
 
@@ -11,6 +12,7 @@ type Directive interface {
 
 type Wast struct {
 	Directives []Directive
+	Span       diagnostic.Span
 }
 
 type QuoteWat interface {
@@ -19,46 +21,61 @@ type QuoteWat interface {
 
 type WatDirective struct {
 	Directive
-	Wat QuoteWat
+	Wat  QuoteWat
+	Span diagnostic.Span
 }
 
 type Wat struct {
 	QuoteWat
-	Wat wat.Directive
+	Wat  wat.Directive
+	Span diagnostic.Span
 }
 
 type QuoteModule struct {
 	QuoteWat
 	Quote string
+	Span  diagnostic.Span
 }
 
 type QuoteComponent struct {
 	QuoteWat
 	Quote string
+	Span  diagnostic.Span
 }
 
 type AssertInvalid struct {
 	Directive
 	Module  QuoteWat
 	Failure string
+	Span    diagnostic.Span
 }
 
 type AssertMalformed struct {
 	Directive
 	Module  QuoteWat
 	Failure string
+	Span    diagnostic.Span
 }
 
 type AssertTrap struct {
 	Directive
 	Action  Action
 	Failure string
+	Span    diagnostic.Span
+}
+
+type AssertExhaustion struct {
+	Directive
+	Action  Action
+	Failure string
+	Span    diagnostic.Span
 }
 
 type AssertReturn struct {
 	Directive
 	Action  Action
 	Results []Result
+	Span    diagnostic.Span
 }
 
 type Action interface {
@@ -71,10 +88,12 @@ type Invoke struct {
 	Name   types.Option[string]
 	String string
 	Const  []Const
+	Span   diagnostic.Span
 }
 
 type Get struct {
 	Action
+	Span diagnostic.Span
 }
 
 type Const interface {
@@ -89,22 +108,26 @@ type I32Const struct {
 	Const
 	Result
 	Value int32
+	Span  diagnostic.Span
 }
 
 type I64Const struct {
 	Const
 	Result
 	Value int64
+	Span  diagnostic.Span
 }
 
 type F32Const struct {
 	Const
 	Result
 	Value float32
+	Span  diagnostic.Span
 }
 
 type F64Const struct {
 	Const
 	Result
 	Value float64
+	Span  diagnostic.Span
 }
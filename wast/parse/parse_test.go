@@ -2,12 +2,14 @@ package parse_test
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wast/ast"
 	"github.com/patrickhuber/go-wasm/wast/parse"
 	wat "github.com/patrickhuber/go-wasm/wat/ast"
@@ -85,6 +87,15 @@ func TestParse(t *testing.T) {
 					},
 					Failure: "integer divide by zero",
 				}}}},
+		{"assert_exhaustion", `(assert_exhaustion (invoke "runaway") "call stack exhausted")`,
+			&ast.Wast{
+				Directives: []ast.Directive{ast.AssertExhaustion{
+					Action: ast.Invoke{
+						String: "runaway",
+						Name:   option.None[string](),
+					},
+					Failure: "call stack exhausted",
+				}}}},
 		{"assert_invalid", `(assert_invalid
 			(module
 			  (func $type-unary-operand-empty
@@ -136,7 +147,33 @@ func TestParse(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			directives, err := parse.Parse(test.input)
 			require.NoError(t, err)
+			diagnostic.Clear(directives)
 			require.Equal(t, test.expected, directives)
 		})
 	}
 }
+
+func TestParseDiagnostics(t *testing.T) {
+	input := `(module (func (param i33)))
+(assert_return (invoke "add" (i32.const 1)) (i32.const 1))
+(assert_unknown "x")
+(assert_return (invoke "sub" (i32.const x)) (i32.const 2))
+(assert_malformed (module quote "") "malformed")`
+	wast, err := parse.ParseFile("test.wast", input)
+	require.Error(t, err)
+
+	var diagnostics diagnostic.List
+	require.True(t, errors.As(err, &diagnostics))
+	require.Equal(t, 3, len(diagnostics))
+	require.Equal(t, "unexpected 'i33'", diagnostics[0].Message)
+	require.Equal(t, "unrecognized directive 'assert_unknown'", diagnostics[1].Message)
+	require.Equal(t, "unexpected 'x'", diagnostics[2].Message)
+	require.Equal(t, []string{"integer"}, diagnostics[2].Expected)
+	require.Equal(t, "test.wast", diagnostics[2].File)
+	require.Equal(t, 3, diagnostics[2].Span.Start.Line)
+
+	// the directives that failed are skipped and the rest of the script is kept
+	require.Equal(t, 2, len(wast.Directives))
+	require.IsType(t, ast.AssertReturn{}, wast.Directives[0])
+	require.IsType(t, ast.AssertMalformed{}, wast.Directives[1])
+}
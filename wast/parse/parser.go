@@ -1,12 +1,11 @@
 package parse
 
 import (
-	"fmt"
-
 	"github.com/patrickhuber/go-types"
 	"github.com/patrickhuber/go-types/handle"
 	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wast/ast"
 	"github.com/patrickhuber/go-wasm/wat/lex"
 	watparse "github.com/patrickhuber/go-wasm/wat/parse"
@@ -14,9 +13,23 @@ import (
 )
 
 // Parse parses the wast spec https://github.com/WebAssembly/spec/tree/master/interpreter/#scripts
+// Directives that fail to parse are skipped so every error in the script is reported.
+// The error is a diagnostic.List and the script holds the directives that parsed successfully.
 func Parse(input string) (*ast.Wast, error) {
-	lexer := lex.New(input)
-	return parseWast(lexer).Deconstruct()
+	return parse(lex.New(input))
+}
+
+// ParseFile parses a wast script read from the named file. The name is used in diagnostics.
+func ParseFile(name string, input string) (*ast.Wast, error) {
+	return parse(lex.NewFile(name, input))
+}
+
+func parse(lexer *lex.Lexer) (*ast.Wast, error) {
+	wast, err := parseWast(lexer).Deconstruct()
+	if err != nil {
+		lexer.ReportError(err)
+	}
+	return wast, lexer.Diagnostics().Err()
 }
 
 func parseWast(lexer *lex.Lexer) (res types.Result[*ast.Wast]) {
@@ -27,11 +40,19 @@ func parseWast(lexer *lex.Lexer) (res types.Result[*ast.Wast]) {
 		if tok.Type == token.EndOfStream {
 			break
 		}
-		directive := parseDirective(lexer).Unwrap()
-		directives = append(directives, directive)
+		start := lexer.Clone()
+		directive, err := parseDirective(lexer).Deconstruct()
+		if err == nil {
+			directives = append(directives, directive)
+			continue
+		}
+		if synchronize(lexer, start, err) != nil {
+			break
+		}
 	}
 	return result.Ok(&ast.Wast{
 		Directives: directives,
+		Span:       diagnostic.Span{End: lexer.End()},
 	})
 }
 
@@ -50,8 +71,10 @@ func parseDirective(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 
 	switch tok.Capture {
 	case "module", "component":
+		wat := parseQuoteWat(lexer).Unwrap()
 		dir = ast.WatDirective{
-			Wat: parseQuoteWat(lexer).Unwrap(),
+			Wat:  wat,
+			Span: lexer.SpanFrom(tok.Span()),
 		}
 		// exit early as wat parse will eat the last close paren
 		return result.Ok(dir)
@@ -67,8 +90,13 @@ func parseDirective(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	case "assert_trap":
 		*lexer = *clone
 		dir = parseAssertTrap(lexer).Unwrap()
+	case "assert_exhaustion":
+		*lexer = *clone
+		dir = parseAssertExhaustion(lexer).Unwrap()
 	default:
-		return result.Error[ast.Directive](parseError(tok))
+		d := diagnostic.New(tok.Span(), "unrecognized directive %s", found(tok))
+		d.Expected = keywords("module", "component", "assert_return", "assert_invalid", "assert_malformed", "assert_trap", "assert_exhaustion")
+		return result.Error[ast.Directive](d)
 	}
 
 	expect(lexer, token.CloseParen).Unwrap()
@@ -81,6 +109,7 @@ func parseAssertReturn(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	// ( assert_return <action> <result>* )
 
 	// assert_return
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "assert_return").Unwrap()
 
 	// <action>
@@ -91,6 +120,7 @@ func parseAssertReturn(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	return result.Ok[ast.Directive](ast.AssertReturn{
 		Action:  action,
 		Results: results,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -99,6 +129,7 @@ func parseAssertInvalid(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	defer handle.Error(&res)
 
 	// assert_invalid
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "assert_invalid").Unwrap()
 
 	module := parseQuoteWat(lexer).Unwrap()
@@ -107,6 +138,7 @@ func parseAssertInvalid(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	return result.Ok[ast.Directive](ast.AssertInvalid{
 		Module:  module,
 		Failure: failure,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -115,6 +147,7 @@ func parseAssertMalformed(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	// (assert_malformed <module> <failure> )
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "assert_malformed").Unwrap()
 
 	module := parseQuoteWat(lexer).Unwrap()
@@ -124,6 +157,7 @@ func parseAssertMalformed(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 		ast.AssertMalformed{
 			Module:  module,
 			Failure: failure,
+			Span:    lexer.SpanFrom(start.Span()),
 		},
 	)
 }
@@ -136,14 +170,14 @@ func parseQuoteWat(lexer *lex.Lexer) (res types.Result[ast.QuoteWat]) {
 
 	expect(clone, token.OpenParen).Unwrap()
 
+	start := peek(clone).Unwrap()
 	var ty token.Type
 	if eat(clone, token.Component).Unwrap() {
 		ty = token.Component
 	} else if eat(clone, token.Module).Unwrap() {
 		ty = token.Module
 	} else {
-		tok := next(clone).Unwrap()
-		return result.Errorf[ast.QuoteWat]("error parsing QuoteWat : %w", parseError(tok))
+		return result.Error[ast.QuoteWat](unexpected(start, keywords("module", "component")...))
 	}
 
 	// 'quote'
@@ -158,18 +192,20 @@ func parseQuoteWat(lexer *lex.Lexer) (res types.Result[ast.QuoteWat]) {
 	// so we need to use the clone as the new lexer
 	*lexer = *clone
 
+	quote := parseString(lexer).Unwrap()
+
 	var quoteWat ast.QuoteWat
 	switch ty {
 	case token.Component:
 		quoteWat = &ast.QuoteComponent{
-			Quote: parseString(lexer).Unwrap(),
+			Quote: quote,
+			Span:  lexer.SpanFrom(start.Span()),
 		}
 	case token.Module:
 		quoteWat = &ast.QuoteModule{
-			Quote: parseString(lexer).Unwrap(),
+			Quote: quote,
+			Span:  lexer.SpanFrom(start.Span()),
 		}
-	default:
-		return result.Errorf[ast.QuoteWat]("error parsing QuoteWat : unrecognized directive '%s'", ty)
 	}
 
 	expect(lexer, token.CloseParen).Unwrap()
@@ -179,20 +215,26 @@ func parseQuoteWat(lexer *lex.Lexer) (res types.Result[ast.QuoteWat]) {
 }
 
 func parseWat(lexer *lex.Lexer) (res types.Result[*ast.Wat]) {
+	start := lexer.Clone()
 	wat, err := watparse.Parse(lexer)
 	if err != nil {
-		return result.Error[*ast.Wat](err)
+		// the wat parser reports its diagnostics to the lexer
+		return result.Error[*ast.Wat](diagnostic.Reported(err))
 	}
+	// the wat directive starts at the keyword after the open paren
+	expect(start, token.OpenParen).Unwrap()
 	return result.Ok(&ast.Wat{
-		Wat: wat,
+		Wat:  wat,
+		Span: lexer.SpanFrom(peek(start).Unwrap().Span()),
 	})
 }
 
 func parseAssertTrap(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	defer handle.Error(&res)
 
-	// assert_return
-	expect(lexer, token.Reserved).Unwrap()
+	// assert_trap
+	start := peek(lexer).Unwrap()
+	expectValue(lexer, token.Reserved, "assert_trap").Unwrap()
 
 	// ( assert_trap <module> <failure> )
 	action := parseAction(lexer).Unwrap()
@@ -201,6 +243,25 @@ func parseAssertTrap(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	return result.Ok[ast.Directive](ast.AssertTrap{
 		Action:  action,
 		Failure: failure,
+		Span:    lexer.SpanFrom(start.Span()),
+	})
+}
+
+func parseAssertExhaustion(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
+	defer handle.Error(&res)
+
+	// assert_exhaustion
+	start := peek(lexer).Unwrap()
+	expectValue(lexer, token.Reserved, "assert_exhaustion").Unwrap()
+
+	// ( assert_exhaustion <action> <failure> )
+	action := parseAction(lexer).Unwrap()
+	failure := parseString(lexer).Unwrap()
+
+	return result.Ok[ast.Directive](ast.AssertExhaustion{
+		Action:  action,
+		Failure: failure,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -215,15 +276,17 @@ func parseAction(lexer *lex.Lexer) (res types.Result[ast.Action]) {
 
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Reserved {
-		return result.Errorf[ast.Action]("%w : unrecognized token", parseError(tok))
+		return result.Error[ast.Action](unexpected(tok, keywords("invoke", "get")...))
 	}
 
 	var action ast.Action
 	switch tok.Capture {
 	case "invoke":
-		action = parseInvoke(lexer).Unwrap()
+		action = parseInvoke(lexer, tok).Unwrap()
 	case "get":
 		action = parseGet(lexer).Unwrap()
+	default:
+		return result.Error[ast.Action](unexpected(tok, keywords("invoke", "get")...))
 	}
 
 	expect(lexer, token.CloseParen).Unwrap()
@@ -231,7 +294,7 @@ func parseAction(lexer *lex.Lexer) (res types.Result[ast.Action]) {
 	return result.Ok(action)
 }
 
-func parseInvoke(lexer *lex.Lexer) (res types.Result[ast.Invoke]) {
+func parseInvoke(lexer *lex.Lexer, start *token.Token) (res types.Result[ast.Invoke]) {
 	defer handle.Error(&res)
 
 	tok := peek(lexer).Unwrap()
@@ -252,6 +315,7 @@ func parseInvoke(lexer *lex.Lexer) (res types.Result[ast.Invoke]) {
 		Name:   name,
 		String: str,
 		Const:  consts,
+		Span:   lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -275,20 +339,25 @@ func parseConst(lexer *lex.Lexer) (res types.Result[ast.Const]) {
 		  ( ref.null <ref_kind> )                    ;; null reference
 		  ( ref.extern <nat> )                       ;; host reference
 	*/
+	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Reserved {
-		return result.Error[ast.Const](parseError(tok))
+		return result.Error[ast.Const](unexpected(tok, keywords("i32.const", "i64.const", "f32.const", "f64.const", "ref.null", "ref.extern")...))
 	}
 
 	var c ast.Const
 	switch tok.Capture {
 	case "i32.const":
+		value := parseInt32(lexer).Unwrap()
 		c = ast.I32Const{
-			Value: parseInt32(lexer).Unwrap(),
+			Value: value,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "i64.const":
+		value := parseInt64(lexer).Unwrap()
 		c = ast.I64Const{
-			Value: parseInt64(lexer).Unwrap(),
+			Value: value,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "f32.const":
 		// some times constants can be ambiguous like '0'
@@ -300,6 +369,7 @@ func parseConst(lexer *lex.Lexer) (res types.Result[ast.Const]) {
 		}
 		c = ast.F32Const{
 			Value: f32,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "f64.const":
 		// some times constants can be ambiguous like '0'
@@ -311,11 +381,12 @@ func parseConst(lexer *lex.Lexer) (res types.Result[ast.Const]) {
 		}
 		c = ast.F64Const{
 			Value: f64,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "ref.null":
 	case "ref.extern":
 	default:
-		return result.Error[ast.Const](parseError(tok))
+		return result.Error[ast.Const](unexpected(tok, keywords("i32.const", "i64.const", "f32.const", "f64.const", "ref.null", "ref.extern")...))
 	}
 
 	return result.Ok(c)
@@ -373,11 +444,8 @@ func eat(lexer *lex.Lexer, ty token.Type) (res types.Result[bool]) {
 func expectValue(lexer *lex.Lexer, ty token.Type, value string) (res types.Result[any]) {
 	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
-	if tok.Type != ty {
-		return result.Errorf[any]("%w. expected '%v' but found '%v'", parseError(tok), ty, tok.Type)
-	}
-	if tok.Capture != value {
-		return result.Errorf[any]("%w. expected '%v' value '%s' but found '%v' value '%s' ", parseError(tok), ty, value, tok, tok.Capture)
+	if tok.Type != ty || tok.Capture != value {
+		return result.Error[any](unexpected(tok, keywords(value)...))
 	}
 	return result.Ok[any](nil)
 }
@@ -388,7 +456,7 @@ func expect(lexer *lex.Lexer, ty token.Type) (res types.Result[any]) {
 	if tok.Type == ty {
 		return result.Ok[any](nil)
 	}
-	return result.Errorf[any]("%w. expected '%v' but found '%v'", parseError(tok), ty, tok.Type)
+	return result.Error[any](unexpected(tok, describe(ty)))
 }
 
 func next(lexer *lex.Lexer) (res types.Result[*token.Token]) {
@@ -426,14 +494,77 @@ func peek(lexer *lex.Lexer) (res types.Result[*token.Token]) {
 	}
 }
 
-func parseError(tok *token.Token) error {
-	line := tok.Line + 1
-	col := tok.Column + 1
-	return fmt.Errorf(
-		"error parsing at line %d, column %d, position %d",
-		line,
-		col,
-		tok.Position)
+// unexpected returns a diagnostic for a token that does not match the expected descriptions
+func unexpected(tok *token.Token, expected ...string) *diagnostic.Diagnostic {
+	d := diagnostic.New(tok.Span(), "unexpected %s", found(tok))
+	d.Expected = expected
+	return d
+}
+
+// found describes the token in diagnostics
+func found(tok *token.Token) string {
+	if tok.Type == token.EndOfStream {
+		return "end of input"
+	}
+	return "'" + tok.Capture + "'"
+}
+
+// describe returns the text used for a token type in diagnostics
+func describe(ty token.Type) string {
+	switch ty {
+	case token.OpenParen:
+		return "'('"
+	case token.CloseParen:
+		return "')'"
+	case token.Module, token.Component:
+		return "'" + string(ty) + "'"
+	case token.Id:
+		return "identifier"
+	case token.EndOfStream:
+		return "end of input"
+	}
+	return string(ty)
+}
+
+// keywords quotes the keywords for use as expected descriptions
+func keywords(values ...string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, "'"+value+"'")
+	}
+	return quoted
+}
+
+// synchronize skips the directive that failed to parse, see diagnostic.Synchronize
+func synchronize(lexer *lex.Lexer, start *lex.Lexer, err error) error {
+	return diagnostic.Synchronize(lexer, start, err, func() (bool, error) {
+		return skip(lexer).Deconstruct()
+	})
+}
+
+// skip consumes tokens through the ')' that closes the current directive. An unbalanced ')' is skipped on its own.
+func skip(lexer *lex.Lexer) (res types.Result[bool]) {
+	defer handle.Error(&res)
+
+	depth := 0
+	skipped := false
+	for {
+		tok := peek(lexer).Unwrap()
+		switch tok.Type {
+		case token.EndOfStream:
+			return result.Ok(skipped)
+		case token.OpenParen:
+			depth++
+		case token.CloseParen:
+			if depth <= 1 {
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+			depth--
+		}
+		next(lexer).Unwrap()
+		skipped = true
+	}
 }
 
 func parseString(lexer *lex.Lexer) types.Result[string] {
@@ -1,6 +1,9 @@
 package ast
 
-import "github.com/patrickhuber/go-types"
+import (
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-wasm/diagnostic"
+)
 
 type Directive interface {
 	directive()
@@ -8,6 +11,7 @@ type Directive interface {
 
 type Component struct {
 	Directive
+	Span diagnostic.Span
 }
 
 type Module struct {
@@ -17,6 +21,7 @@ type Module struct {
 	Types     []Type
 	Tables    []Table
 	Globals   []Global
+	Span      diagnostic.Span
 }
 
 type Section interface {
@@ -25,11 +30,13 @@ type Section interface {
 
 type Function struct {
 	ID           types.Option[string]
+	Import       types.Option[InlineImport]
 	Locals       []Local
 	Exports      []InlineExport
 	Parameters   []Parameter
 	Results      []Result
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 func (f *Function) section() {}
@@ -37,71 +44,88 @@ func (f *Function) section() {}
 type Memory struct {
 	ID     types.Option[string]
 	Limits Limits
+	Span   diagnostic.Span
 }
 
 type Type struct {
 	ID       types.Option[string]
 	FuncType FuncType
+	Span     diagnostic.Span
 }
 
 type FuncType struct {
 	Parameters []Parameter
 	Results    []Result
+	Span       diagnostic.Span
 }
 
 type Table struct {
 	ID        types.Option[string]
 	TableType TableType
 	Elements  []Element
+	Span      diagnostic.Span
 }
 
 type TableType struct {
 	Limits  Limits
 	RefType RefType
+	Span    diagnostic.Span
 }
 
 type Global struct {
 	ID           types.Option[string]
 	Type         GlobalType
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 type GlobalType struct {
 	Mutable bool
 	Type    ValType
+	Span    diagnostic.Span
 }
 
 type Element struct {
-	ID string
+	ID   string
+	Span diagnostic.Span
 }
 
 type Limits struct {
-	Min uint32
-	Max types.Option[uint32]
+	Min  uint32
+	Max  types.Option[uint32]
+	Span diagnostic.Span
 }
 
 type Parameter struct {
 	ID    types.Option[string]
 	Types []ValType
+	Span  diagnostic.Span
 }
 
 type Local struct {
+	ID   types.Option[string]
 	Type ValType
+	Span diagnostic.Span
 }
 
 type Result struct {
 	Types []ValType
+	Span  diagnostic.Span
 }
 
 type RefType interface {
 	refType()
 }
 
-type FuncRef struct{}
+type FuncRef struct {
+	Span diagnostic.Span
+}
 
 func (FuncRef) refType() {}
 
-type ExternRef struct{}
+type ExternRef struct {
+	Span diagnostic.Span
+}
 
 func (ExternRef) refType() {}
 
@@ -109,19 +133,27 @@ type ValType interface {
 	valType()
 }
 
-type I32 struct{}
+type I32 struct {
+	Span diagnostic.Span
+}
 
 func (I32) valType() {}
 
-type I64 struct{}
+type I64 struct {
+	Span diagnostic.Span
+}
 
 func (I64) valType() {}
 
-type F32 struct{}
+type F32 struct {
+	Span diagnostic.Span
+}
 
 func (F32) valType() {}
 
-type F64 struct{}
+type F64 struct {
+	Span diagnostic.Span
+}
 
 func (F64) valType() {}
 
@@ -131,148 +163,349 @@ type Instruction interface {
 
 type I32Const struct {
 	Value int32
+	Span  diagnostic.Span
 }
 
 func (I32Const) inst() {}
 
 type I64Const struct {
 	Value int64
+	Span  diagnostic.Span
 }
 
 func (I64Const) inst() {}
 
 type F32Const struct {
 	Value float32
+	Span  diagnostic.Span
 }
 
 func (F32Const) inst() {}
 
 type F64Const struct {
 	Value float64
+	Span  diagnostic.Span
 }
 
 func (F64Const) inst() {}
 
-type F32Add struct{}
+type F32Add struct {
+	Span diagnostic.Span
+}
 
 func (F32Add) inst() {}
 
-type F32Sub struct{}
+type F32Sub struct {
+	Span diagnostic.Span
+}
 
 func (F32Sub) inst() {}
 
-type F32Mul struct{}
+type F32Mul struct {
+	Span diagnostic.Span
+}
 
 func (F32Mul) inst() {}
 
-type F32Div struct{}
+type F32Div struct {
+	Span diagnostic.Span
+}
 
 func (F32Div) inst() {}
 
-type F32Sqrt struct{}
+type F32Sqrt struct {
+	Span diagnostic.Span
+}
 
 func (F32Sqrt) inst() {}
 
-type F32Min struct{}
+type F32Min struct {
+	Span diagnostic.Span
+}
 
 func (F32Min) inst() {}
 
-type F32Max struct{}
+type F32Max struct {
+	Span diagnostic.Span
+}
 
 func (F32Max) inst() {}
 
-type F32Ceil struct{}
+type F32Ceil struct {
+	Span diagnostic.Span
+}
 
 func (F32Ceil) inst() {}
 
-type F32Floor struct{}
+type F32Floor struct {
+	Span diagnostic.Span
+}
 
 func (F32Floor) inst() {}
 
-type F32Trunc struct{}
+type F32Trunc struct {
+	Span diagnostic.Span
+}
 
 func (F32Trunc) inst() {}
 
-type F32Nearest struct{}
+type F32Nearest struct {
+	Span diagnostic.Span
+}
 
 func (F32Nearest) inst() {}
 
 type I32Eqz struct {
 	Value int32
+	Span  diagnostic.Span
 }
 
 func (I32Eqz) inst() {}
 
-type I32Add struct{}
+type I32Add struct {
+	Span diagnostic.Span
+}
 
 func (I32Add) inst() {}
 
-type I32Sub struct{}
+type I32Sub struct {
+	Span diagnostic.Span
+}
 
 func (I32Sub) inst() {}
 
-type I32Mul struct{}
+type I32Mul struct {
+	Span diagnostic.Span
+}
 
 func (I32Mul) inst() {}
 
-type I32DivS struct{}
+type I32DivS struct {
+	Span diagnostic.Span
+}
 
 func (I32DivS) inst() {}
 
-type I32DivU struct{}
+type I32DivU struct {
+	Span diagnostic.Span
+}
 
 func (I32DivU) inst() {}
 
+type I32RemS struct {
+	Span diagnostic.Span
+}
+
+func (I32RemS) inst() {}
+
+type I32RemU struct {
+	Span diagnostic.Span
+}
+
+func (I32RemU) inst() {}
+
+type I32And struct {
+	Span diagnostic.Span
+}
+
+func (I32And) inst() {}
+
+type I32Or struct {
+	Span diagnostic.Span
+}
+
+func (I32Or) inst() {}
+
+type I32Xor struct {
+	Span diagnostic.Span
+}
+
+func (I32Xor) inst() {}
+
+type I32Shl struct {
+	Span diagnostic.Span
+}
+
+func (I32Shl) inst() {}
+
+type I32ShrS struct {
+	Span diagnostic.Span
+}
+
+func (I32ShrS) inst() {}
+
+type I32ShrU struct {
+	Span diagnostic.Span
+}
+
+func (I32ShrU) inst() {}
+
+type I32Rotl struct {
+	Span diagnostic.Span
+}
+
+func (I32Rotl) inst() {}
+
+type I32Rotr struct {
+	Span diagnostic.Span
+}
+
+func (I32Rotr) inst() {}
+
+type I32Clz struct {
+	Span diagnostic.Span
+}
+
+func (I32Clz) inst() {}
+
+type I32Ctz struct {
+	Span diagnostic.Span
+}
+
+func (I32Ctz) inst() {}
+
+type I32Popcnt struct {
+	Span diagnostic.Span
+}
+
+func (I32Popcnt) inst() {}
+
+type I32Extend8S struct {
+	Span diagnostic.Span
+}
+
+func (I32Extend8S) inst() {}
+
+type I32Extend16S struct {
+	Span diagnostic.Span
+}
+
+func (I32Extend16S) inst() {}
+
+type I32Eq struct {
+	Span diagnostic.Span
+}
+
+func (I32Eq) inst() {}
+
+type I32Ne struct {
+	Span diagnostic.Span
+}
+
+func (I32Ne) inst() {}
+
+type I32LtS struct {
+	Span diagnostic.Span
+}
+
+func (I32LtS) inst() {}
+
+type I32LtU struct {
+	Span diagnostic.Span
+}
+
+func (I32LtU) inst() {}
+
+type I32LeS struct {
+	Span diagnostic.Span
+}
+
+func (I32LeS) inst() {}
+
+type I32LeU struct {
+	Span diagnostic.Span
+}
+
+func (I32LeU) inst() {}
+
+type I32GtS struct {
+	Span diagnostic.Span
+}
+
+func (I32GtS) inst() {}
+
+type I32GtU struct {
+	Span diagnostic.Span
+}
+
+func (I32GtU) inst() {}
+
+type I32GeS struct {
+	Span diagnostic.Span
+}
+
+func (I32GeS) inst() {}
+
+type I32GeU struct {
+	Span diagnostic.Span
+}
+
+func (I32GeU) inst() {}
+
 type Folded struct {
 	Instruction Instruction
 	Parameters  []Instruction
+	Span        diagnostic.Span
 }
 
 func (Folded) inst() {}
 
 type LocalGet struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (LocalGet) inst() {}
 
 type LocalSet struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (LocalSet) inst() {}
 
 type LocalTee struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (LocalTee) inst() {}
 
 type GlobalGet struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (GlobalGet) inst() {}
 
 type GlobalSet struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (GlobalSet) inst() {}
 
-type MemoryGrow struct{}
+type MemoryGrow struct {
+	Span diagnostic.Span
+}
 
 func (MemoryGrow) inst() {}
 
-type I32Load struct{}
+type I32Load struct {
+	Span diagnostic.Span
+}
 
 func (I32Load) inst() {}
 
-type I32Store struct{}
+type I32Store struct {
+	Span diagnostic.Span
+}
 
 func (I32Store) inst() {}
 
-type Drop struct{}
+type Drop struct {
+	Span diagnostic.Span
+}
 
 func (Drop) inst() {}
 
@@ -281,42 +514,49 @@ type Index interface {
 }
 
 type IDIndex struct {
-	ID string
+	ID   string
+	Span diagnostic.Span
 }
 
 func (IDIndex) index() {}
 
 type RawIndex struct {
 	Index uint32
+	Span  diagnostic.Span
 }
 
 func (RawIndex) index() {}
 
 type InlineExport struct {
 	Name string
+	Span diagnostic.Span
 }
 
 type InlineImport struct {
 	Module string
 	Field  string
+	Span   diagnostic.Span
 }
 
 type Block struct {
 	Name         types.Option[string]
 	BlockType    BlockType
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 func (Block) inst() {}
 
 type BlockType struct {
 	Results []Result
+	Span    diagnostic.Span
 }
 
 type Loop struct {
 	Name         types.Option[string]
 	BlockType    BlockType
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 func (Loop) inst() {}
@@ -327,56 +567,69 @@ type If struct {
 	BlockType BlockType
 	Then      Then
 	Else      types.Option[Else]
+	Span      diagnostic.Span
 }
 
 func (If) inst() {}
 
 type Then struct {
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 type Else struct {
 	Instructions []Instruction
+	Span         diagnostic.Span
 }
 
 type Br struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (Br) inst() {}
 
 type BrIf struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (BrIf) inst() {}
 
 type BrTable struct {
 	Indicies []Index
+	Span     diagnostic.Span
 }
 
 func (BrTable) inst() {}
 
-type Return struct{}
+type Return struct {
+	Span diagnostic.Span
+}
 
 func (Return) inst() {}
 
-type Select struct{}
+type Select struct {
+	Span diagnostic.Span
+}
 
 func (Select) inst() {}
 
 type Call struct {
 	Index Index
+	Span  diagnostic.Span
 }
 
 func (Call) inst() {}
 
 type CallIndirect struct {
 	Type TypeUse
+	Span diagnostic.Span
 }
 
 func (CallIndirect) inst() {}
 
 type TypeUse struct {
 	Index string
+	Span  diagnostic.Span
 }
@@ -52,5 +52,5 @@ func (decoder *decoder) component(component *ast.Component) (*api.Component, err
 }
 
 func (decoder *decoder) module(module *ast.Module) (*api.Module, error) {
-	return &api.Module{}, nil
+	return lower(module)
 }
@@ -0,0 +1,195 @@
+package wat_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/wat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeModule(t *testing.T) {
+	type test struct {
+		name     string
+		text     string
+		expected *api.Module
+	}
+	i32 := []api.ValType{api.I32Type}
+	tests := []test{
+		{"empty", "(module)", &api.Module{}},
+		{
+			name: "add",
+			text: `(module (func (export "add") (param $x i32) (param $y i32) (result i32)
+				(i32.add (local.get $x) (local.get 1))))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Parameters: api.ResultType{Types: []api.ValType{api.I32Type, api.I32Type}}, Returns: api.ResultType{Types: i32}}},
+				Funcs: []*api.Func{{Body: &api.Expression{Instructions: []api.Instruction{
+					api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, api.I32Add{},
+				}}}},
+				Exports: []api.Export{{Name: "add", Description: &api.FuncExportDescription{FuncIdx: 0}}},
+				Names:   &api.NameSection{Locals: map[api.FuncIndex]map[api.LocalIndex]string{0: {0: "x", 1: "y"}}},
+			},
+		},
+		{
+			name: "loop",
+			text: `(module (func (param $n i32) (local $i i32)
+				(block $done
+					(loop $next
+						(br_if $done (i32.ge_u (local.get $i) (local.get $n)))
+						(local.set $i (i32.add (local.get $i) (i32.const 1)))
+						(br $next)))))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Parameters: api.ResultType{Types: i32}}},
+				Funcs: []*api.Func{{Locals: i32, Body: &api.Expression{Instructions: []api.Instruction{
+					&api.Block{Instructions: []api.Instruction{
+						&api.Loop{Instructions: []api.Instruction{
+							api.LocalGet{Index: 1}, api.LocalGet{Index: 0}, api.U32Ge{}, &api.BranchIf{Index: 1},
+							api.LocalGet{Index: 1}, api.I32Const(1), api.I32Add{}, api.LocalSet{Index: 1},
+							&api.Branch{Index: 0},
+						}},
+					}},
+				}}}},
+				Names: &api.NameSection{
+					Locals: map[api.FuncIndex]map[api.LocalIndex]string{0: {0: "n", 1: "i"}},
+					Labels: map[api.FuncIndex]map[uint32]string{0: {0: "done", 1: "next"}},
+				},
+			},
+		},
+		{
+			name: "import",
+			text: `(module
+				(memory 1 2)
+				(func $main (call $log (i32.const 7)))
+				(func $log (import "env" "log") (param i32)))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Parameters: api.ResultType{Types: i32}}, {}},
+				Imports: []api.Import{
+					{Module: "env", Name: "log", Description: &api.FuncImportDescription{TypeIdx: 0}},
+				},
+				Funcs: []*api.Func{{Type: 1, Body: &api.Expression{Instructions: []api.Instruction{
+					api.I32Const(7), &api.Call{Index: 0},
+				}}}},
+				Mems:  []api.Mem{{Limits: api.Limits{Min: 1, Max: option.Some[uint32](2)}}},
+				Names: &api.NameSection{Funcs: map[api.FuncIndex]string{0: "log", 1: "main"}},
+			},
+		},
+		{
+			name: "if",
+			text: `(module (func (param i32) (result i32)
+				(if (result i32) (local.get 0) (then (i32.const 1)) (else (i32.const 2)))))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Parameters: api.ResultType{Types: i32}, Returns: api.ResultType{Types: i32}}},
+				Funcs: []*api.Func{{Body: &api.Expression{Instructions: []api.Instruction{
+					api.LocalGet{Index: 0},
+					&api.If{
+						Type:         &api.BlockTypeValue{ValueType: api.I32Type},
+						Instructions: []api.Instruction{api.I32Const(1)},
+						Else:         &api.Else{Instructions: []api.Instruction{api.I32Const(2)}},
+					},
+				}}}},
+			},
+		},
+		{
+			name: "table",
+			text: `(module
+				(type $unary (func (result i32)))
+				(table funcref (elem $one) (elem $two))
+				(func $one (result i32) (i32.const 1))
+				(func $two (result i32) (i32.const 2))
+				(func (export "dispatch") (param i32) (result i32)
+					(call_indirect (type $unary) (local.get 0))))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{
+					{Returns: api.ResultType{Types: i32}},
+					{Parameters: api.ResultType{Types: i32}, Returns: api.ResultType{Types: i32}},
+				},
+				Funcs: []*api.Func{
+					{Body: &api.Expression{Instructions: []api.Instruction{api.I32Const(1)}}},
+					{Body: &api.Expression{Instructions: []api.Instruction{api.I32Const(2)}}},
+					{Type: 1, Body: &api.Expression{Instructions: []api.Instruction{
+						api.LocalGet{Index: 0}, &api.CallIndirect{Type: 0},
+					}}},
+				},
+				Tables: []api.Table{{Limits: api.Limits{Min: 2, Max: option.Some[uint32](2)}, Reference: &api.FunctionReference{}}},
+				Elems: []api.Elem{{
+					Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(0)}},
+					Init:   []api.FuncIndex{0, 1},
+				}},
+				Exports: []api.Export{{Name: "dispatch", Description: &api.FuncExportDescription{FuncIdx: 2}}},
+				Names: &api.NameSection{
+					Funcs: map[api.FuncIndex]string{0: "one", 1: "two"},
+					Types: map[api.TypeIndex]string{0: "unary"},
+				},
+			},
+		},
+		{
+			name: "br_table",
+			text: `(module (func (param i32) (result i32)
+				(block $b (block $a (br_table $a $b (local.get 0))) (return (i32.const 1)))
+				(i32.const 2)))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Parameters: api.ResultType{Types: i32}, Returns: api.ResultType{Types: i32}}},
+				Funcs: []*api.Func{{Body: &api.Expression{Instructions: []api.Instruction{
+					&api.Block{Instructions: []api.Instruction{
+						&api.Block{Instructions: []api.Instruction{
+							api.LocalGet{Index: 0}, &api.BranchTable{Indicies: []api.LabelIndex{0}, Index: 1},
+						}},
+						api.I32Const(1), &api.Return{},
+					}},
+					api.I32Const(2),
+				}}}},
+				Names: &api.NameSection{Labels: map[api.FuncIndex]map[uint32]string{0: {0: "b", 1: "a"}}},
+			},
+		},
+		{
+			name: "exports",
+			text: `(module
+				(global $count (mut i32) (i32.const 0))
+				(func (export "next") (export "increment") (result i32)
+					(global.set $count (i32.add (global.get $count) (i32.const 1)))
+					(global.get $count)))`,
+			expected: &api.Module{
+				Types: []*api.FuncType{{Returns: api.ResultType{Types: i32}}},
+				Funcs: []*api.Func{{Body: &api.Expression{Instructions: []api.Instruction{
+					api.GlobalGet{Index: 0}, api.I32Const(1), api.I32Add{}, api.GlobalSet{Index: 0},
+					api.GlobalGet{Index: 0},
+				}}}},
+				Globals: []api.Global{{Mutable: api.Var, Value: api.I32Type, Init: &api.Expression{Instructions: []api.Instruction{api.I32Const(0)}}}},
+				Exports: []api.Export{
+					{Name: "next", Description: &api.FuncExportDescription{FuncIdx: 0}},
+					{Name: "increment", Description: &api.FuncExportDescription{FuncIdx: 0}},
+				},
+				Names: &api.NameSection{Globals: map[api.GlobalIndex]string{0: "count"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directive, err := wat.NewDecoder(nil).Decode(strings.NewReader(test.text))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, directive)
+		})
+	}
+}
+
+func TestDecodeModuleFail(t *testing.T) {
+	type test struct {
+		name    string
+		text    string
+		message string
+	}
+	tests := []test{
+		{"label", "(module (func (block (br $missing))))", "unknown label '$missing'"},
+		{"local", "(module (func (local.get $x)))", "unknown local '$x'"},
+		{"function", "(module (func (call $f)))", "unknown function '$f'"},
+		{"unsupported", "(module (func (i32.clz (i32.const 1))))", "unsupported instruction ast.I32Clz"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := wat.NewDecoder(nil).Decode(strings.NewReader(test.text))
+			require.ErrorContains(t, err, test.message)
+		})
+	}
+}
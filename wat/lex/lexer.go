@@ -1,13 +1,13 @@
 package lex
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/patrickhuber/go-types"
 	"github.com/patrickhuber/go-types/handle"
 	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wat/token"
 )
 
@@ -22,6 +22,9 @@ type Lexer struct {
 	column    int
 	line      int
 	peekToken *token.Token
+	// Reporter records the diagnostics of the input, its end is the end of the last token returned by Next
+	// that is not whitespace or a comment
+	diagnostic.Reporter
 }
 
 var runeMap = map[byte]token.Type{
@@ -48,8 +51,9 @@ func New(input string) *Lexer {
 		})
 	}
 	return &Lexer{
-		input: input,
-		Rules: rules,
+		input:    input,
+		Rules:    rules,
+		Reporter: diagnostic.NewReporter("", input),
 	}
 }
 
@@ -61,6 +65,7 @@ func (l *Lexer) Clone() *Lexer {
 		column:    l.column,
 		line:      l.line,
 		peekToken: l.peekToken,
+		Reporter:  l.Reporter.Clone(),
 		Rules:     l.Rules,
 	}
 }
@@ -77,16 +82,39 @@ func (l *Lexer) Peek() (*token.Token, error) {
 
 func (l *Lexer) Next() (*token.Token, error) {
 	// any peek token?
-	if l.peekToken == nil {
-		return l.next().Deconstruct()
-	}
-
 	tok := l.peekToken
 	l.peekToken = nil
+	if tok == nil {
+		var err error
+		tok, err = l.next().Deconstruct()
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	switch tok.Type {
+	case token.Whitespace, token.LineComment, token.BlockComment:
+	default:
+		l.Accept(tok.Span())
+	}
 	return tok, nil
 }
 
+// NewFile returns a lexer for the input read from the named file. The name is used in diagnostics.
+func NewFile(name string, input string) *Lexer {
+	l := New(input)
+	l.Reporter = diagnostic.NewReporter(name, input)
+	return l
+}
+
+// Rewind moves the lexer back to the position of a clone. Diagnostics reported since the clone was taken are kept.
+func (l *Lexer) Rewind(clone *Lexer) {
+	reporter := l.Reporter
+	reporter.Rewind(&clone.Reporter)
+	*l = *clone
+	l.Reporter = reporter
+}
+
 func (l *Lexer) next() (res types.Result[*token.Token]) {
 	defer handle.Error(&res)
 
@@ -708,5 +736,6 @@ func not(chars ...byte) func(ch byte) bool {
 }
 
 func (l *Lexer) lexerError() error {
-	return fmt.Errorf("error parsing at line: %d column: %d position: %d, '%s'", l.line, l.column, l.position, string(l.input[l.offset:l.position]))
+	start := diagnostic.Position{Offset: l.offset, Line: l.line, Column: l.column}
+	return l.Unrecognized(start, l.input[l.offset:l.position])
 }
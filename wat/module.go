@@ -0,0 +1,570 @@
+package wat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/patrickhuber/go-wasm/wat/ast"
+)
+
+// scope resolves the identifiers of a module to indices
+type scope struct {
+	module  *api.Module
+	types   map[string]api.TypeIndex
+	funcs   map[string]api.FuncIndex
+	globals map[string]api.GlobalIndex
+	// names are the identifiers of the module items without the $
+	names api.NameSection
+}
+
+// body resolves the identifiers of a function body, the labels are ordered from the outermost block
+type body struct {
+	*scope
+	locals map[string]api.LocalIndex
+	labels []types.Option[string]
+	// blocks is the number of blocks, loops and ifs before the current instruction, it is the index of the next label name
+	blocks     uint32
+	labelNames map[uint32]string
+}
+
+// lower translates a module in the text format to the structure of a module.
+// see https://webassembly.github.io/spec/core/text/modules.html
+func lower(module *ast.Module) (*api.Module, error) {
+	s := &scope{
+		module:  &api.Module{},
+		types:   map[string]api.TypeIndex{},
+		funcs:   map[string]api.FuncIndex{},
+		globals: map[string]api.GlobalIndex{},
+	}
+	for _, t := range module.Types {
+		index := api.TypeIndex(len(s.module.Types))
+		s.module.Types = append(s.module.Types, funcType(t.FuncType.Parameters, t.FuncType.Results))
+		if id, ok := some(t.ID); ok {
+			s.types[id] = index
+		}
+		name(&s.names.Types, index, t.ID)
+	}
+
+	// imported functions precede the functions defined by the module in the index space
+	var functions []*ast.Function
+	for i := range module.Functions {
+		if _, ok := some(module.Functions[i].Import); ok {
+			functions = append(functions, &module.Functions[i])
+		}
+	}
+	imports := len(functions)
+	for i := range module.Functions {
+		if _, ok := some(module.Functions[i].Import); !ok {
+			functions = append(functions, &module.Functions[i])
+		}
+	}
+	for i, function := range functions {
+		if id, ok := some(function.ID); ok {
+			s.funcs[id] = api.FuncIndex(i)
+		}
+		name(&s.names.Funcs, api.FuncIndex(i), function.ID)
+	}
+	for i, global := range module.Globals {
+		if id, ok := some(global.ID); ok {
+			s.globals[id] = api.GlobalIndex(i)
+		}
+		name(&s.names.Globals, api.GlobalIndex(i), global.ID)
+	}
+
+	for i, function := range functions {
+		typeIndex := s.typeUse(funcType(function.Parameters, function.Results))
+		if i < imports {
+			imp, _ := some(function.Import)
+			s.module.Imports = append(s.module.Imports, api.Import{
+				Module:      imp.Module,
+				Name:        imp.Field,
+				Description: &api.FuncImportDescription{TypeIdx: typeIndex},
+			})
+		} else {
+			fn, err := s.function(api.FuncIndex(i), function)
+			if err != nil {
+				return nil, err
+			}
+			fn.Type = typeIndex
+			s.module.Funcs = append(s.module.Funcs, fn)
+		}
+		for _, export := range function.Exports {
+			s.module.Exports = append(s.module.Exports, api.Export{
+				Name:        export.Name,
+				Description: &api.FuncExportDescription{FuncIdx: api.FuncIndex(i)},
+			})
+		}
+	}
+	for i, table := range module.Tables {
+		if err := s.table(api.TableIndex(i), table); err != nil {
+			return nil, err
+		}
+	}
+	for _, memory := range module.Memory {
+		s.module.Mems = append(s.module.Mems, api.Mem{Limits: limits(memory.Limits)})
+	}
+	for _, global := range module.Globals {
+		b := &body{scope: s}
+		instructions, err := b.instructions(nil, global.Instructions)
+		if err != nil {
+			return nil, err
+		}
+		mutable := api.Const
+		if global.Type.Mutable {
+			mutable = api.Var
+		}
+		s.module.Globals = append(s.module.Globals, api.Global{
+			Mutable: mutable,
+			Value:   valType(global.Type.Type),
+			Init:    &api.Expression{Instructions: instructions},
+		})
+	}
+	if s.names.Funcs != nil || s.names.Locals != nil || s.names.Labels != nil || s.names.Types != nil || s.names.Globals != nil {
+		s.module.Names = &s.names
+	}
+	return s.module, nil
+}
+
+// typeUse returns the index of a type equal to ft, the type is added when the module does not have one
+func (s *scope) typeUse(ft *api.FuncType) api.TypeIndex {
+	for i, t := range s.module.Types {
+		if sameTypes(t.Parameters.Types, ft.Parameters.Types) && sameTypes(t.Returns.Types, ft.Returns.Types) {
+			return api.TypeIndex(i)
+		}
+	}
+	s.module.Types = append(s.module.Types, ft)
+	return api.TypeIndex(len(s.module.Types) - 1)
+}
+
+func (s *scope) function(funcIndex api.FuncIndex, function *ast.Function) (*api.Func, error) {
+	b := &body{scope: s, locals: map[string]api.LocalIndex{}}
+	var localNames map[api.LocalIndex]string
+	var index api.LocalIndex
+	for _, parameter := range function.Parameters {
+		if id, ok := some(parameter.ID); ok {
+			b.locals[id] = index
+		}
+		name(&localNames, index, parameter.ID)
+		index += api.LocalIndex(len(parameter.Types))
+	}
+	fn := &api.Func{}
+	for _, local := range function.Locals {
+		if id, ok := some(local.ID); ok {
+			b.locals[id] = index
+		}
+		name(&localNames, index, local.ID)
+		fn.Locals = append(fn.Locals, valType(local.Type))
+		index++
+	}
+	instructions, err := b.instructions(nil, function.Instructions)
+	if err != nil {
+		return nil, err
+	}
+	fn.Body = &api.Expression{Instructions: instructions}
+	if localNames != nil {
+		if s.names.Locals == nil {
+			s.names.Locals = map[api.FuncIndex]map[api.LocalIndex]string{}
+		}
+		s.names.Locals[funcIndex] = localNames
+	}
+	if b.labelNames != nil {
+		if s.names.Labels == nil {
+			s.names.Labels = map[api.FuncIndex]map[uint32]string{}
+		}
+		s.names.Labels[funcIndex] = b.labelNames
+	}
+	return fn, nil
+}
+
+// table adds a table, inline elements initialize a table with exactly as many elements
+func (s *scope) table(index api.TableIndex, table ast.Table) error {
+	t := api.Table{Limits: limits(table.TableType.Limits), Reference: &api.FunctionReference{}}
+	if _, ok := table.TableType.RefType.(ast.ExternRef); ok {
+		t.Reference = &api.ExternalReference{}
+	}
+	if len(table.Elements) > 0 {
+		size := uint32(len(table.Elements))
+		t.Limits = api.Limits{Min: size, Max: option.Some(size)}
+		elem := api.Elem{
+			Table:  index,
+			Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(0)}},
+		}
+		for _, element := range table.Elements {
+			fn, ok := s.funcs[element.ID]
+			if !ok {
+				return diagnostic.New(element.Span, "unknown function '%s'", element.ID)
+			}
+			elem.Init = append(elem.Init, fn)
+		}
+		s.module.Elems = append(s.module.Elems, elem)
+	}
+	s.module.Tables = append(s.module.Tables, t)
+	return nil
+}
+
+// instructions appends the instructions to out, folded instructions are unfolded so their operands come first
+func (b *body) instructions(out []api.Instruction, instructions []ast.Instruction) ([]api.Instruction, error) {
+	for _, instruction := range instructions {
+		var err error
+		out, err = b.instruction(out, instruction)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (b *body) instruction(out []api.Instruction, instruction ast.Instruction) ([]api.Instruction, error) {
+	var inst api.Instruction
+	switch i := instruction.(type) {
+	case ast.Folded:
+		out, err := b.instructions(out, i.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		return b.instruction(out, i.Instruction)
+
+	// control
+	case ast.Block:
+		b.labelName(i.Name)
+		instructions, err := b.block(i.Name, i.Instructions)
+		if err != nil {
+			return nil, err
+		}
+		inst = &api.Block{Type: b.blockType(i.BlockType), Instructions: instructions}
+	case ast.Loop:
+		b.labelName(i.Name)
+		instructions, err := b.block(i.Name, i.Instructions)
+		if err != nil {
+			return nil, err
+		}
+		inst = &api.Loop{Type: b.blockType(i.BlockType), Instructions: instructions}
+	case ast.If:
+		// the condition is folded into the if
+		out, err := b.instructions(out, i.Clause)
+		if err != nil {
+			return nil, err
+		}
+		b.labelName(i.Name)
+		then, err := b.block(i.Name, i.Then.Instructions)
+		if err != nil {
+			return nil, err
+		}
+		inst := &api.If{Type: b.blockType(i.BlockType), Instructions: then}
+		if e, ok := some(i.Else); ok {
+			instructions, err := b.block(i.Name, e.Instructions)
+			if err != nil {
+				return nil, err
+			}
+			inst.Else = &api.Else{Instructions: instructions}
+		}
+		return append(out, inst), nil
+	case ast.Br:
+		index, err := b.label(i.Index)
+		if err != nil {
+			return nil, err
+		}
+		inst = &api.Branch{Index: index}
+	case ast.BrIf:
+		index, err := b.label(i.Index)
+		if err != nil {
+			return nil, err
+		}
+		inst = &api.BranchIf{Index: index}
+	case ast.BrTable:
+		var indices []api.LabelIndex
+		for _, label := range i.Indicies {
+			index, err := b.label(label)
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, index)
+		}
+		// the last label is the default
+		inst = &api.BranchTable{Indicies: indices[:len(indices)-1], Index: indices[len(indices)-1]}
+	case ast.Return:
+		inst = &api.Return{}
+	case ast.Call:
+		index, err := resolve(b.funcs, i.Index, "function")
+		if err != nil {
+			return nil, err
+		}
+		inst = &api.Call{Index: api.FuncIndex(index)}
+	case ast.CallIndirect:
+		index, ok := b.types[i.Type.Index]
+		if !ok {
+			return nil, diagnostic.New(i.Type.Span, "unknown type '%s'", i.Type.Index)
+		}
+		inst = &api.CallIndirect{Type: index}
+
+	// parametric
+	case ast.Drop:
+		inst = &api.Drop{}
+	case ast.Select:
+		inst = &api.Select{}
+
+	// variable
+	case ast.LocalGet:
+		index, err := resolve(b.locals, i.Index, "local")
+		if err != nil {
+			return nil, err
+		}
+		inst = api.LocalGet{Index: api.LocalIndex(index)}
+	case ast.LocalSet:
+		index, err := resolve(b.locals, i.Index, "local")
+		if err != nil {
+			return nil, err
+		}
+		inst = api.LocalSet{Index: api.LocalIndex(index)}
+	case ast.LocalTee:
+		index, err := resolve(b.locals, i.Index, "local")
+		if err != nil {
+			return nil, err
+		}
+		inst = api.LocalTee{Index: api.LocalIndex(index)}
+	case ast.GlobalGet:
+		index, err := resolve(b.globals, i.Index, "global")
+		if err != nil {
+			return nil, err
+		}
+		inst = api.GlobalGet{Index: api.GlobalIndex(index)}
+	case ast.GlobalSet:
+		index, err := resolve(b.globals, i.Index, "global")
+		if err != nil {
+			return nil, err
+		}
+		inst = api.GlobalSet{Index: api.GlobalIndex(index)}
+
+	// memory
+	case ast.MemoryGrow:
+		inst = &api.MemoryGrow{}
+	case ast.I32Load:
+		inst = &api.Int32Load{}
+	case ast.I32Store:
+		inst = &api.Int32Store{}
+
+	// numeric
+	case ast.I32Const:
+		inst = api.I32Const(uint32(i.Value))
+	case ast.I64Const:
+		inst = api.I64Const(uint64(i.Value))
+	case ast.F32Const:
+		inst = api.F32Const(i.Value)
+	case ast.F64Const:
+		inst = api.F64Const(i.Value)
+	default:
+		var ok bool
+		inst, ok = numeric(instruction)
+		if !ok {
+			return nil, fmt.Errorf("unsupported instruction %T", instruction)
+		}
+	}
+	return append(out, inst), nil
+}
+
+// numeric returns the numeric instructions without immediates
+func numeric(instruction ast.Instruction) (api.Instruction, bool) {
+	switch instruction.(type) {
+	case ast.F32Add:
+		return api.F32Add{}, true
+	case ast.F32Sub:
+		return api.F32Sub{}, true
+	case ast.F32Mul:
+		return api.F32Mul{}, true
+	case ast.F32Div:
+		return api.F32Div{}, true
+	case ast.F32Sqrt:
+		return api.F32Sqrt{}, true
+	case ast.F32Min:
+		return api.F32Min{}, true
+	case ast.F32Max:
+		return api.F32Max{}, true
+	case ast.F32Ceil:
+		return api.F32Ceil{}, true
+	case ast.F32Floor:
+		return api.F32Floor{}, true
+	case ast.F32Trunc:
+		return api.F32Trunc{}, true
+	case ast.F32Nearest:
+		return api.F32Nearest{}, true
+	case ast.I32Eqz:
+		return api.I32Eqz{}, true
+	case ast.I32Eq:
+		return api.I32Eq{}, true
+	case ast.I32Ne:
+		return api.I32Ne{}, true
+	case ast.I32LtS:
+		return api.I32Lt{}, true
+	case ast.I32LtU:
+		return api.U32Lt{}, true
+	case ast.I32GtS:
+		return api.I32Gt{}, true
+	case ast.I32GtU:
+		return api.U32Gt{}, true
+	case ast.I32LeS:
+		return api.I32Le{}, true
+	case ast.I32LeU:
+		return api.U32Le{}, true
+	case ast.I32GeS:
+		return api.I32Ge{}, true
+	case ast.I32GeU:
+		return api.U32Ge{}, true
+	case ast.I32Add:
+		return api.I32Add{}, true
+	case ast.I32Sub:
+		return api.I32Sub{}, true
+	case ast.I32Mul:
+		return api.I32Mul{}, true
+	case ast.I32DivS:
+		return api.I32Div{}, true
+	case ast.I32DivU:
+		return api.U32Div{}, true
+	case ast.I32RemS:
+		return api.I32Rem{}, true
+	case ast.I32RemU:
+		return api.U32Rem{}, true
+	case ast.I32And:
+		return api.I32And{}, true
+	case ast.I32Or:
+		return api.I32Or{}, true
+	case ast.I32Xor:
+		return api.I32Xor{}, true
+	case ast.I32Shl:
+		return api.I32Shl{}, true
+	case ast.I32ShrS:
+		return api.I32Shr{}, true
+	case ast.I32ShrU:
+		return api.U32Shr{}, true
+	case ast.I32Rotl:
+		return api.I32Rotl{}, true
+	case ast.I32Rotr:
+		return api.I32Rotr{}, true
+	}
+	return nil, false
+}
+
+// block lowers the instructions of a block with a label of the name
+func (b *body) block(name types.Option[string], instructions []ast.Instruction) ([]api.Instruction, error) {
+	b.labels = append(b.labels, name)
+	defer func() { b.labels = b.labels[:len(b.labels)-1] }()
+	return b.instructions(nil, instructions)
+}
+
+// labelName records the name of the label of the next block, loop or if
+func (b *body) labelName(id types.Option[string]) {
+	name(&b.labelNames, b.blocks, id)
+	b.blocks++
+}
+
+// label resolves a label to its depth, identifiers refer to the innermost block with the name
+func (b *body) label(index ast.Index) (api.LabelIndex, error) {
+	switch i := index.(type) {
+	case *ast.RawIndex:
+		return api.LabelIndex(i.Index), nil
+	case *ast.IDIndex:
+		for depth := 0; depth < len(b.labels); depth++ {
+			if name, ok := some(b.labels[len(b.labels)-1-depth]); ok && name == i.ID {
+				return api.LabelIndex(depth), nil
+			}
+		}
+		return 0, diagnostic.New(i.Span, "unknown label '%s'", i.ID)
+	}
+	return 0, fmt.Errorf("unsupported index %T", index)
+}
+
+// blockType returns the block type of the results, several results use the index of a function type
+func (b *body) blockType(bt ast.BlockType) api.BlockType {
+	results := funcType(nil, bt.Results)
+	switch len(results.Returns.Types) {
+	case 0:
+		return nil
+	case 1:
+		return &api.BlockTypeValue{ValueType: results.Returns.Types[0]}
+	}
+	return &api.BlockTypeIndex{Index: b.typeUse(results)}
+}
+
+// resolve returns the index of a raw index or of an identifier in ids
+func resolve[T ~uint32](ids map[string]T, index ast.Index, kind string) (uint32, error) {
+	switch i := index.(type) {
+	case *ast.RawIndex:
+		return i.Index, nil
+	case *ast.IDIndex:
+		if value, ok := ids[i.ID]; ok {
+			return uint32(value), nil
+		}
+		return 0, diagnostic.New(i.Span, "unknown %s '%s'", kind, i.ID)
+	}
+	return 0, fmt.Errorf("unsupported index %T", index)
+}
+
+func funcType(parameters []ast.Parameter, results []ast.Result) *api.FuncType {
+	ft := &api.FuncType{}
+	for _, parameter := range parameters {
+		for _, t := range parameter.Types {
+			ft.Parameters.Types = append(ft.Parameters.Types, valType(t))
+		}
+	}
+	for _, result := range results {
+		for _, t := range result.Types {
+			ft.Returns.Types = append(ft.Returns.Types, valType(t))
+		}
+	}
+	return ft
+}
+
+func valType(t ast.ValType) api.ValType {
+	switch t.(type) {
+	case ast.I64:
+		return api.I64Type
+	case ast.F32:
+		return api.F32Type
+	case ast.F64:
+		return api.F64Type
+	}
+	return api.I32Type
+}
+
+func limits(l ast.Limits) api.Limits {
+	if max, ok := some(l.Max); ok {
+		return api.Limits{Min: l.Min, Max: option.Some(max)}
+	}
+	return api.Limits{Min: l.Min, Max: option.None[uint32]()}
+}
+
+func sameTypes(a, b []api.ValType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// some returns the value of an option, options the parser did not set are none
+// name adds the name of the item at index to names when the item has an identifier
+func name[K comparable](names *map[K]string, index K, identifier types.Option[string]) {
+	id, ok := some(identifier)
+	if !ok {
+		return
+	}
+	if *names == nil {
+		*names = map[K]string{}
+	}
+	(*names)[index] = strings.TrimPrefix(id, "$")
+}
+
+func some[T any](o types.Option[T]) (T, bool) {
+	if o == nil {
+		var zero T
+		return zero, false
+	}
+	return o.Deconstruct()
+}
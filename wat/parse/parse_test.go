@@ -1,9 +1,12 @@
 package parse_test
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wat/ast"
 	"github.com/patrickhuber/go-wasm/wat/lex"
 	"github.com/patrickhuber/go-wasm/wat/parse"
@@ -39,6 +42,7 @@ func TestParse(t *testing.T) {
 			n, err := parse.Parse(lexer)
 			require.NoError(t, err)
 			require.NotNil(t, n)
+			diagnostic.Clear(&n)
 			require.EqualValues(t, test.expected, n)
 		})
 	}
@@ -52,3 +56,52 @@ func TestParse(t *testing.T) {
 		require.NotNil(t, n)
 	})
 }
+
+func TestParseSpans(t *testing.T) {
+	text := "(module\n  (func $add (param $x i32) (result i32)\n    (i32.add (local.get $x) (i32.const 1))))"
+	n, err := parse.Parse(lex.New(text))
+	require.NoError(t, err)
+
+	source := func(span diagnostic.Span) string {
+		return text[span.Start.Offset:span.End.Offset]
+	}
+
+	module := n.(*ast.Module)
+	require.Equal(t, text[1:len(text)-1], source(module.Span))
+
+	function := module.Functions[0]
+	require.Equal(t, 1, function.Span.Start.Line)
+	require.Equal(t, 3, function.Span.Start.Column)
+	require.Equal(t, "param $x i32", source(function.Parameters[0].Span))
+	require.Equal(t, "result i32", source(function.Results[0].Span))
+
+	folded := function.Instructions[0].(ast.Folded)
+	require.Equal(t, "i32.add (local.get $x) (i32.const 1)", source(folded.Span))
+	require.Equal(t, "local.get $x", source(folded.Parameters[0].(ast.LocalGet).Span))
+	require.Equal(t, "i32.const 1", source(folded.Parameters[1].(ast.I32Const).Span))
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	text := "(module\n  (func (param i33))\n  (memory 1)\n  (tabel funcref)\n  (func))"
+	n, err := parse.Parse(lex.NewFile("test.wat", text))
+	require.Error(t, err)
+
+	var diagnostics diagnostic.List
+	require.True(t, errors.As(err, &diagnostics))
+	require.Equal(t, 2, len(diagnostics))
+
+	expected := strings.Join([]string{
+		"test.wat:2:16: unexpected 'i33'",
+		"  |",
+		"2 |   (func (param i33))",
+		"  |                ^^^",
+		"  = expected one of 'i32', 'i64', 'f32', 'f64'",
+	}, "\n")
+	require.Equal(t, expected, diagnostics[0].Error())
+	require.Equal(t, "unexpected 'tabel'", diagnostics[1].Message)
+
+	// the fields that failed are skipped and the rest of the module is kept
+	module := n.(*ast.Module)
+	require.Equal(t, 1, len(module.Memory))
+	require.Equal(t, 1, len(module.Functions))
+}
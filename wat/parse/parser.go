@@ -1,7 +1,6 @@
 package parse
 
 import (
-	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -10,14 +9,23 @@ import (
 	"github.com/patrickhuber/go-types/handle"
 	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wat/ast"
 	"github.com/patrickhuber/go-wasm/wat/lex"
 
 	"github.com/patrickhuber/go-wasm/wat/token"
 )
 
+// Parse parses a module or component. Module fields that fail to parse are skipped so every error is reported.
+// The error is a diagnostic.List of the diagnostics reported while parsing the directive.
+// Spans of parenthesized forms start at the keyword and end at the last token before the closing parenthesis.
 func Parse(lexer *lex.Lexer) (ast.Directive, error) {
-	return parse(lexer).Deconstruct()
+	count := len(lexer.Diagnostics())
+	directive, err := parse(lexer).Deconstruct()
+	if err != nil {
+		lexer.ReportError(err)
+	}
+	return directive, lexer.Diagnostics()[count:].Err()
 }
 
 func Peek(lexer *lex.Lexer) (*token.Token, error) {
@@ -35,9 +43,7 @@ func parse(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 	case token.Component:
 		root = parseComponent(lexer).Unwrap()
 	default:
-		return result.Errorf[ast.Directive](
-			"%w : expected module, component but found '%s'",
-			parseError(tok), tok.Capture)
+		return result.Error[ast.Directive](unexpected(tok, describe(token.Module), describe(token.Component)))
 	}
 	expect(lexer, token.CloseParen).Unwrap()
 	return result.Ok(root)
@@ -45,43 +51,63 @@ func parse(lexer *lex.Lexer) (res types.Result[ast.Directive]) {
 
 func parseModule(lexer *lex.Lexer) (res types.Result[*ast.Module]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Module).Unwrap()
 
 	m := &ast.Module{}
-	for eat(lexer, token.OpenParen).Unwrap() {
-		tok := peek(lexer).Unwrap()
-		switch tok.Capture {
-		case "func":
-			f := parseFunc(lexer).Unwrap()
-			m.Functions = append(m.Functions, *f)
-		case "type":
-			t := parseType(lexer).Unwrap()
-			m.Types = append(m.Types, t)
-		case "table":
-			t := parseTable(lexer).Unwrap()
-			m.Tables = append(m.Tables, t)
-		case "global":
-			g := parseGlobal(lexer).Unwrap()
-			m.Globals = append(m.Globals, g)
-		case "memory":
-			mem := parseMemory(lexer).Unwrap()
-			m.Memory = append(m.Memory, mem)
-		default:
-			return result.Errorf[*ast.Module]("unrecognized module section '%s'", tok.Capture)
+	for peek(lexer).Unwrap().Type == token.OpenParen {
+		clone := lexer.Clone()
+		if _, err := parseModuleField(lexer, m).Deconstruct(); err != nil {
+			if err := synchronize(lexer, clone, err, true); err != nil {
+				return result.Error[*ast.Module](err)
+			}
 		}
-		expect(lexer, token.CloseParen).Unwrap()
 	}
+	m.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(m)
 }
 
+func parseModuleField(lexer *lex.Lexer, m *ast.Module) (res types.Result[any]) {
+	defer handle.Error(&res)
+	expect(lexer, token.OpenParen).Unwrap()
+	tok := peek(lexer).Unwrap()
+	switch tok.Capture {
+	case "func":
+		f := parseFunc(lexer).Unwrap()
+		m.Functions = append(m.Functions, *f)
+	case "type":
+		t := parseType(lexer).Unwrap()
+		m.Types = append(m.Types, t)
+	case "table":
+		t := parseTable(lexer).Unwrap()
+		m.Tables = append(m.Tables, t)
+	case "global":
+		g := parseGlobal(lexer).Unwrap()
+		m.Globals = append(m.Globals, g)
+	case "memory":
+		mem := parseMemory(lexer).Unwrap()
+		m.Memory = append(m.Memory, mem)
+	default:
+		return result.Error[any](unexpected(tok, keywords("func", "type", "table", "global", "memory")...))
+	}
+	expect(lexer, token.CloseParen).Unwrap()
+	return result.Ok[any](nil)
+}
+
 func parseComponent(lexer *lex.Lexer) (res types.Result[*ast.Component]) {
 	defer handle.Error(&res)
-	expect(lexer, token.Component).Unwrap()
-	return result.Ok(&ast.Component{})
+	tok := next(lexer).Unwrap()
+	if tok.Type != token.Component {
+		return result.Error[*ast.Component](unexpected(tok, describe(token.Component)))
+	}
+	return result.Ok(&ast.Component{
+		Span: tok.Span(),
+	})
 }
 
 func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.Function]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "func").Unwrap()
 
 	function := &ast.Function{}
@@ -109,7 +135,7 @@ func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.Function]) {
 			export := parseExport(lexer).Unwrap()
 			function.Exports = append(function.Exports, export)
 		case "import":
-			_ = parseImport(lexer).Unwrap()
+			function.Import = option.Some(parseImport(lexer).Unwrap())
 		default:
 			inst := parseInstruction(lexer).Unwrap()
 			function.Instructions = append(function.Instructions, inst)
@@ -124,21 +150,27 @@ func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.Function]) {
 		instruction := parseInstruction(lexer).Unwrap()
 		function.Instructions = append(function.Instructions, instruction)
 	}
+	function.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(function)
 }
 
 func parseLocal(lexer *lex.Lexer) (res types.Result[ast.Local]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "local").Unwrap()
+	id := parseOptionalId(lexer).Unwrap()
 	ty := parseValType(lexer).Unwrap()
 	return result.Ok(ast.Local{
+		ID:   id,
 		Type: ty,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseParameter(lexer *lex.Lexer) (res types.Result[*ast.Parameter]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "param").Unwrap()
 
 	id := parseOptionalId(lexer).Unwrap()
@@ -157,22 +189,26 @@ func parseParameter(lexer *lex.Lexer) (res types.Result[*ast.Parameter]) {
 	return result.Ok(&ast.Parameter{
 		ID:    id,
 		Types: types,
+		Span:  lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseResult(lexer *lex.Lexer) (res types.Result[*ast.Result]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "result").Unwrap()
 
 	ty := parseValType(lexer).Unwrap()
 	return result.Ok(&ast.Result{
 		Types: []ast.ValType{ty},
+		Span:  lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseType(lexer *lex.Lexer) (res types.Result[ast.Type]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "type").Unwrap()
 
 	id := parseOptionalId(lexer).Unwrap()
@@ -186,12 +222,14 @@ func parseType(lexer *lex.Lexer) (res types.Result[ast.Type]) {
 	return result.Ok(ast.Type{
 		ID:       id,
 		FuncType: funcType,
+		Span:     lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseFuncType(lexer *lex.Lexer) (res types.Result[ast.FuncType]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "func").Unwrap()
 	var parameters []ast.Parameter
 	var results []ast.Result
@@ -204,6 +242,8 @@ func parseFuncType(lexer *lex.Lexer) (res types.Result[ast.FuncType]) {
 		case "result":
 			result := parseResult(lexer).Unwrap()
 			results = append(results, *result)
+		default:
+			return result.Error[ast.FuncType](unexpected(tok, keywords("param", "result")...))
 		}
 		expect(lexer, token.CloseParen).Unwrap()
 	}
@@ -211,66 +251,66 @@ func parseFuncType(lexer *lex.Lexer) (res types.Result[ast.FuncType]) {
 	return result.Ok(ast.FuncType{
 		Parameters: parameters,
 		Results:    results,
+		Span:       lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseTable(lexer *lex.Lexer) (res types.Result[ast.Table]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "table").Unwrap()
 	id := parseOptionalId(lexer).Unwrap()
 	tableType := parseTableType(lexer).Unwrap()
 	var elements []ast.Element
 	for eat(lexer, token.OpenParen).Unwrap() {
 		tok := next(lexer).Unwrap()
-		if tok.Type != token.Reserved {
-			return result.Errorf[ast.Table]("%w", parseError(tok))
-		}
-		switch tok.Capture {
-		case "elem":
-			id := parseId(lexer).Unwrap()
-			elements = append(elements, ast.Element{
-				ID: id,
-			})
-		default:
-			return result.Errorf[ast.Table]("%w", parseError(tok))
+		if tok.Type != token.Reserved || tok.Capture != "elem" {
+			return result.Error[ast.Table](unexpected(tok, keywords("elem")...))
 		}
+		id := parseId(lexer).Unwrap()
+		elements = append(elements, ast.Element{
+			ID:   id,
+			Span: lexer.SpanFrom(tok.Span()),
+		})
 		expect(lexer, token.CloseParen).Unwrap()
 	}
 	return result.Ok(ast.Table{
 		ID:        id,
 		TableType: tableType,
 		Elements:  elements,
+		Span:      lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseTableType(lexer *lex.Lexer) (res types.Result[ast.TableType]) {
 	defer handle.Error(&res)
 
-	tok := peek(lexer).Unwrap()
+	start := peek(lexer).Unwrap()
 	var limits ast.Limits
-	if tok.Type == token.Integer {
+	if start.Type == token.Integer {
 		limits = parseLimits(lexer).Unwrap()
 	}
-	tok = next(lexer).Unwrap()
-	if tok.Type != token.Reserved {
-		return result.Errorf[ast.TableType]("expected 'externref' or 'funcref': %w", parseError(tok))
-	}
+	tok := next(lexer).Unwrap()
 	var refType ast.RefType
-	switch tok.Capture {
-	case "externref":
-		refType = ast.ExternRef{}
-	case "funcref":
-		refType = ast.FuncRef{}
+	switch {
+	case tok.Type == token.Reserved && tok.Capture == "externref":
+		refType = ast.ExternRef{Span: tok.Span()}
+	case tok.Type == token.Reserved && tok.Capture == "funcref":
+		refType = ast.FuncRef{Span: tok.Span()}
+	default:
+		return result.Error[ast.TableType](unexpected(tok, keywords("externref", "funcref")...))
 	}
 
 	return result.Ok(ast.TableType{
 		Limits:  limits,
 		RefType: refType,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseGlobal(lexer *lex.Lexer) (res types.Result[ast.Global]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "global").Unwrap()
 	id := parseOptionalId(lexer).Unwrap()
 	globalType := parseGlobalType(lexer).Unwrap()
@@ -279,11 +319,13 @@ func parseGlobal(lexer *lex.Lexer) (res types.Result[ast.Global]) {
 		ID:           id,
 		Type:         globalType,
 		Instructions: instructions,
+		Span:         lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseGlobalType(lexer *lex.Lexer) (res types.Result[ast.GlobalType]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	var mutable bool
 	var valType ast.ValType
 	if eat(lexer, token.OpenParen).Unwrap() {
@@ -297,20 +339,26 @@ func parseGlobalType(lexer *lex.Lexer) (res types.Result[ast.GlobalType]) {
 	return result.Ok(ast.GlobalType{
 		Type:    valType,
 		Mutable: mutable,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseMemory(lexer *lex.Lexer) (res types.Result[ast.Memory]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "memory").Unwrap()
+	id := parseOptionalId(lexer).Unwrap()
+	limits := parseLimits(lexer).Unwrap()
 	return result.Ok(ast.Memory{
-		ID:     parseOptionalId(lexer).Unwrap(),
-		Limits: parseLimits(lexer).Unwrap(),
+		ID:     id,
+		Limits: limits,
+		Span:   lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseLimits(lexer *lex.Lexer) (res types.Result[ast.Limits]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	min := parseInt32(lexer).Unwrap()
 	max := option.None[uint32]()
 	tok := peek(lexer).Unwrap()
@@ -319,28 +367,33 @@ func parseLimits(lexer *lex.Lexer) (res types.Result[ast.Limits]) {
 		max = option.Some(uint32(n))
 	}
 	return result.Ok(ast.Limits{
-		Min: uint32(min),
-		Max: max,
+		Min:  uint32(min),
+		Max:  max,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseExport(lexer *lex.Lexer) (res types.Result[ast.InlineExport]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "export").Unwrap()
 	name := parseString(lexer).Unwrap()
 	return result.Ok(ast.InlineExport{
 		Name: name,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseImport(lexer *lex.Lexer) (res types.Result[ast.InlineImport]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "import").Unwrap()
 	name := parseString(lexer).Unwrap()
 	alias := parseString(lexer).Unwrap()
 	return result.Ok(ast.InlineImport{
 		Module: name,
 		Field:  alias,
+		Span:   lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -360,72 +413,90 @@ func parseInstruction(lexer *lex.Lexer) (res types.Result[ast.Instruction]) {
 	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Reserved {
-		return result.Error[ast.Instruction](parseError(tok))
+		return result.Error[ast.Instruction](unexpected(tok, "instruction"))
 	}
 	var inst ast.Instruction
 	switch tok.Capture {
 	case "br":
 		inst = ast.Br{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "br_if":
 		inst = ast.BrIf{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "br_table":
+		// the labels are followed by the default label
+		indices := []ast.Index{parseIndex(lexer).Unwrap()}
+		for {
+			p := peek(lexer).Unwrap()
+			if p.Type != token.Integer && p.Type != token.Id {
+				break
+			}
+			indices = append(indices, parseIndex(lexer).Unwrap())
+		}
 		inst = ast.BrTable{
-			Indicies: []ast.Index{
-				parseIndex(lexer).Unwrap(),
-			},
+			Indicies: indices,
+			Span:     lexer.SpanFrom(tok.Span()),
 		}
 	case "return":
-		inst = ast.Return{}
+		inst = ast.Return{Span: tok.Span()}
 	case "call":
 		inst = ast.Call{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 
 	case "drop":
-		inst = ast.Drop{}
+		inst = ast.Drop{Span: tok.Span()}
 	case "select":
-		inst = ast.Select{}
+		inst = ast.Select{Span: tok.Span()}
 	case "local.get":
 		inst = ast.LocalGet{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "local.set":
 		inst = ast.LocalSet{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "local.tee":
 		inst = ast.LocalTee{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "global.get":
 		inst = ast.GlobalGet{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "global.set":
 		inst = ast.GlobalSet{
 			Index: parseIndex(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 
 	// memory instructions
 	case "memory.grow":
-		inst = ast.MemoryGrow{}
+		inst = ast.MemoryGrow{Span: tok.Span()}
 	case "i32.load":
-		inst = ast.I32Load{}
+		inst = ast.I32Load{Span: tok.Span()}
 	case "i32.store":
-		inst = ast.I32Store{}
+		inst = ast.I32Store{Span: tok.Span()}
 
 	// numeric instructions
 	case "i32.const":
 		inst = ast.I32Const{
 			Value: parseInt32(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "i64.const":
 		inst = ast.I64Const{
 			Value: parseInt64(lexer).Unwrap(),
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "f32.const":
 		var f32 float32
@@ -436,6 +507,7 @@ func parseInstruction(lexer *lex.Lexer) (res types.Result[ast.Instruction]) {
 		}
 		inst = ast.F32Const{
 			Value: f32,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	case "f64.const":
 		// some times constants can be ambiguous like '0'
@@ -447,80 +519,106 @@ func parseInstruction(lexer *lex.Lexer) (res types.Result[ast.Instruction]) {
 		}
 		inst = ast.F64Const{
 			Value: f64,
+			Span:  lexer.SpanFrom(tok.Span()),
 		}
 	// f32 math instructions
 	case "f32.add":
-		inst = ast.F32Add{}
+		inst = ast.F32Add{Span: tok.Span()}
 	case "f32.sub":
-		inst = ast.F32Sub{}
+		inst = ast.F32Sub{Span: tok.Span()}
 	case "f32.mul":
-		inst = ast.F32Mul{}
+		inst = ast.F32Mul{Span: tok.Span()}
 	case "f32.div":
-		inst = ast.F32Div{}
+		inst = ast.F32Div{Span: tok.Span()}
 	case "f32.sqrt":
-		inst = ast.F32Sqrt{}
+		inst = ast.F32Sqrt{Span: tok.Span()}
 	case "f32.min":
-		inst = ast.F32Min{}
+		inst = ast.F32Min{Span: tok.Span()}
 	case "f32.max":
-		inst = ast.F32Max{}
+		inst = ast.F32Max{Span: tok.Span()}
 	case "f32.ceil":
-		inst = ast.F32Ceil{}
+		inst = ast.F32Ceil{Span: tok.Span()}
 	case "f32.floor":
-		inst = ast.F32Floor{}
+		inst = ast.F32Floor{Span: tok.Span()}
 	case "f32.trunc":
-		inst = ast.F32Trunc{}
+		inst = ast.F32Trunc{Span: tok.Span()}
 	case "f32.nearest":
-		inst = ast.F32Nearest{}
+		inst = ast.F32Nearest{Span: tok.Span()}
 
 	// i32 math instructions
 	case "i32.add":
-		inst = ast.I32Add{}
+		inst = ast.I32Add{Span: tok.Span()}
 	case "i32.sub":
-		inst = ast.I32Sub{}
+		inst = ast.I32Sub{Span: tok.Span()}
 	case "i32.mul":
-		inst = ast.I32Mul{}
+		inst = ast.I32Mul{Span: tok.Span()}
 	case "i32.div_s":
-		inst = ast.I32DivS{}
+		inst = ast.I32DivS{Span: tok.Span()}
 	case "i32.div_u":
-		inst = ast.I32DivU{}
+		inst = ast.I32DivU{Span: tok.Span()}
 	case "i32.rem_s":
+		inst = ast.I32RemS{Span: tok.Span()}
 	case "i32.rem_u":
+		inst = ast.I32RemU{Span: tok.Span()}
 	case "i32.and":
+		inst = ast.I32And{Span: tok.Span()}
 	case "i32.or":
+		inst = ast.I32Or{Span: tok.Span()}
 	case "i32.xor":
+		inst = ast.I32Xor{Span: tok.Span()}
 	case "i32.shl":
+		inst = ast.I32Shl{Span: tok.Span()}
 	case "i32.shr_s":
+		inst = ast.I32ShrS{Span: tok.Span()}
 	case "i32.shr_u":
+		inst = ast.I32ShrU{Span: tok.Span()}
 	case "i32.rotl":
+		inst = ast.I32Rotl{Span: tok.Span()}
 	case "i32.rotr":
+		inst = ast.I32Rotr{Span: tok.Span()}
 	case "i32.clz":
+		inst = ast.I32Clz{Span: tok.Span()}
 	case "i32.ctz":
+		inst = ast.I32Ctz{Span: tok.Span()}
 	case "i32.popcnt":
+		inst = ast.I32Popcnt{Span: tok.Span()}
 	case "i32.extend8_s":
+		inst = ast.I32Extend8S{Span: tok.Span()}
 	case "i32.extend16_s":
+		inst = ast.I32Extend16S{Span: tok.Span()}
 	case "i32.eqz":
-		inst = ast.I32Eqz{}
+		inst = ast.I32Eqz{Span: tok.Span()}
 	case "i32.eq":
+		inst = ast.I32Eq{Span: tok.Span()}
 	case "i32.ne":
+		inst = ast.I32Ne{Span: tok.Span()}
 	case "i32.lt_s":
+		inst = ast.I32LtS{Span: tok.Span()}
 	case "i32.lt_u":
+		inst = ast.I32LtU{Span: tok.Span()}
 	case "i32.le_s":
+		inst = ast.I32LeS{Span: tok.Span()}
 	case "i32.le_u":
+		inst = ast.I32LeU{Span: tok.Span()}
 	case "i32.gt_s":
+		inst = ast.I32GtS{Span: tok.Span()}
 	case "i32.gt_u":
+		inst = ast.I32GtU{Span: tok.Span()}
 	case "i32.ge_s":
+		inst = ast.I32GeS{Span: tok.Span()}
 	case "i32.ge_u":
+		inst = ast.I32GeU{Span: tok.Span()}
 	case "block":
-		inst = parseBlock(lexer).Unwrap()
+		inst = parseBlock(lexer, tok).Unwrap()
 	case "loop":
-		inst = parseLoop(lexer).Unwrap()
+		inst = parseLoop(lexer, tok).Unwrap()
 	case "if":
-		inst = parseIf(lexer).Unwrap()
+		inst = parseIf(lexer, tok).Unwrap()
 
 	case "call_indirect":
-		inst = parseCallIndirect(lexer).Unwrap()
+		inst = parseCallIndirect(lexer, tok).Unwrap()
 	default:
-		return result.Errorf[ast.Instruction]("%w : error parsing instruction. Unrecognized instruction %v : %s", parseError(tok), tok.Type, tok.Capture)
+		return result.Error[ast.Instruction](diagnostic.New(tok.Span(), "unrecognized instruction '%s'", tok.Capture))
 	}
 	peekTok := peek(lexer).Unwrap()
 	if peekTok.Type != token.OpenParen {
@@ -534,6 +632,7 @@ func parseInstruction(lexer *lex.Lexer) (res types.Result[ast.Instruction]) {
 		folded.Parameters = append(folded.Parameters, inst)
 		expect(lexer, token.CloseParen).Unwrap()
 	}
+	folded.Span = lexer.SpanFrom(tok.Span())
 	return result.Ok[ast.Instruction](folded)
 }
 
@@ -544,16 +643,21 @@ func parseIndex(lexer *lex.Lexer) (res types.Result[ast.Index]) {
 	var index ast.Index
 	switch tok.Type {
 	case token.Integer:
-		i := result.New(strconv.Atoi(tok.Capture)).Unwrap()
+		i, err := strconv.ParseUint(tok.Capture, 0, 32)
+		if err != nil {
+			return result.Error[ast.Index](diagnostic.New(tok.Span(), "invalid index '%s'", tok.Capture))
+		}
 		index = &ast.RawIndex{
 			Index: uint32(i),
+			Span:  tok.Span(),
 		}
 	case token.Id:
 		index = &ast.IDIndex{
-			ID: tok.Capture,
+			ID:   tok.Capture,
+			Span: tok.Span(),
 		}
 	default:
-		return result.Errorf[ast.Index]("%w : error parsing index", parseError(tok))
+		return result.Error[ast.Index](unexpected(tok, describe(token.Integer), describe(token.Id)))
 	}
 	return result.Ok(index)
 }
@@ -566,20 +670,20 @@ func parseValType(lexer *lex.Lexer) (res types.Result[ast.ValType]) {
 	// todo: enhance the lexer to parse these as tokens
 	switch tok.Capture {
 	case "i32":
-		ty = ast.I32{}
+		ty = ast.I32{Span: tok.Span()}
 	case "i64":
-		ty = ast.I64{}
+		ty = ast.I64{Span: tok.Span()}
 	case "f32":
-		ty = ast.F32{}
+		ty = ast.F32{Span: tok.Span()}
 	case "f64":
-		ty = ast.F64{}
+		ty = ast.F64{Span: tok.Span()}
 	default:
-		return result.Errorf[ast.ValType]("%w : error parsing type. expected (i32, i64, f32, f64) but found %s", parseError(tok), tok.Capture)
+		return result.Error[ast.ValType](unexpected(tok, keywords("i32", "i64", "f32", "f64")...))
 	}
 	return result.Ok(ty)
 }
 
-func parseBlock(lexer *lex.Lexer) (res types.Result[ast.Block]) {
+func parseBlock(lexer *lex.Lexer, start *token.Token) (res types.Result[ast.Block]) {
 	defer handle.Error(&res)
 	tok := peek(lexer).Unwrap()
 
@@ -596,10 +700,11 @@ func parseBlock(lexer *lex.Lexer) (res types.Result[ast.Block]) {
 		Name:         name,
 		BlockType:    blockType,
 		Instructions: instructions,
+		Span:         lexer.SpanFrom(start.Span()),
 	})
 }
 
-func parseLoop(lexer *lex.Lexer) (res types.Result[ast.Loop]) {
+func parseLoop(lexer *lex.Lexer, start *token.Token) (res types.Result[ast.Loop]) {
 	defer handle.Error(&res)
 	tok := peek(lexer).Unwrap()
 
@@ -616,10 +721,11 @@ func parseLoop(lexer *lex.Lexer) (res types.Result[ast.Loop]) {
 		Name:         name,
 		BlockType:    blockType,
 		Instructions: instructions,
+		Span:         lexer.SpanFrom(start.Span()),
 	})
 }
 
-func parseIf(lexer *lex.Lexer) (res types.Result[ast.If]) {
+func parseIf(lexer *lex.Lexer, start *token.Token) (res types.Result[ast.If]) {
 	defer handle.Error(&res)
 	tok := peek(lexer).Unwrap()
 
@@ -652,50 +758,59 @@ func parseIf(lexer *lex.Lexer) (res types.Result[ast.If]) {
 	}
 
 	return result.Ok(ast.If{
-		Name: name,
-		BlockType: ast.BlockType{
-			Results: results,
-		},
-		Clause: instructions,
-		Then:   then,
-		Else:   _else,
+		Name:      name,
+		BlockType: newBlockType(results),
+		Clause:    instructions,
+		Then:      then,
+		Else:      _else,
+		Span:      lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseElse(lexer *lex.Lexer) (res types.Result[ast.Else]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "else").Unwrap()
+	instructions := parseInstructions(lexer).Unwrap()
 	return result.Ok(ast.Else{
-		Instructions: parseInstructions(lexer).Unwrap(),
+		Instructions: instructions,
+		Span:         lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseThen(lexer *lex.Lexer) (res types.Result[ast.Then]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "then").Unwrap()
+	instructions := parseInstructions(lexer).Unwrap()
 	return result.Ok(ast.Then{
-		Instructions: parseInstructions(lexer).Unwrap(),
+		Instructions: instructions,
+		Span:         lexer.SpanFrom(start.Span()),
 	})
 }
 
-func parseCallIndirect(lexer *lex.Lexer) (res types.Result[ast.CallIndirect]) {
+func parseCallIndirect(lexer *lex.Lexer, start *token.Token) (res types.Result[ast.CallIndirect]) {
 	defer handle.Error(&res)
 
 	typeUse := parseTypeUse(lexer).Unwrap()
 	return result.Ok(ast.CallIndirect{
 		Type: typeUse,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseTypeUse(lexer *lex.Lexer) (res types.Result[ast.TypeUse]) {
 	defer handle.Error(&res)
 	expect(lexer, token.OpenParen).Unwrap()
+	start := peek(lexer).Unwrap()
 	expectValue(lexer, token.Reserved, "type").Unwrap()
 	index := parseId(lexer).Unwrap()
-	expect(lexer, token.CloseParen).Unwrap()
-	return result.Ok(ast.TypeUse{
+	typeUse := ast.TypeUse{
 		Index: index,
-	})
+		Span:  lexer.SpanFrom(start.Span()),
+	}
+	expect(lexer, token.CloseParen).Unwrap()
+	return result.Ok(typeUse)
 }
 
 func parseBlockType(lexer *lex.Lexer) (res types.Result[ast.BlockType]) {
@@ -717,6 +832,7 @@ func parseBlockType(lexer *lex.Lexer) (res types.Result[ast.BlockType]) {
 		// merge the lexer back because we know we are parsing a result
 		*lexer = *clone
 
+		resultStart := peek(lexer).Unwrap()
 		expectValue(lexer, token.Reserved, "result").Unwrap()
 
 		var types []ast.ValType
@@ -726,6 +842,7 @@ func parseBlockType(lexer *lex.Lexer) (res types.Result[ast.BlockType]) {
 		}
 		result := ast.Result{
 			Types: types,
+			Span:  lexer.SpanFrom(resultStart.Span()),
 		}
 		results = append(results, result)
 		expect(lexer, token.CloseParen).Unwrap()
@@ -733,12 +850,25 @@ func parseBlockType(lexer *lex.Lexer) (res types.Result[ast.BlockType]) {
 		// create a new clone and continue parsing
 		clone = lexer.Clone()
 	}
-	return result.Ok(ast.BlockType{
+	return result.Ok(newBlockType(results))
+}
+
+// newBlockType returns the block type of the results. The span covers the results, an empty block type covers no tokens.
+func newBlockType(results []ast.Result) ast.BlockType {
+	blockType := ast.BlockType{
 		Results: results,
-	})
+	}
+	if len(results) > 0 {
+		blockType.Span = diagnostic.Span{
+			Start: results[0].Span.Start,
+			End:   results[len(results)-1].Span.End,
+		}
+	}
+	return blockType
 }
 
 func parseOptionalId(lexer *lex.Lexer) (res types.Result[types.Option[string]]) {
+	defer handle.Error(&res)
 	tok := peek(lexer).Unwrap()
 	if tok.Type == token.Id {
 		id := parseId(lexer).Unwrap()
@@ -748,9 +878,10 @@ func parseOptionalId(lexer *lex.Lexer) (res types.Result[types.Option[string]])
 }
 
 func parseId(lexer *lex.Lexer) (res types.Result[string]) {
+	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Id {
-		return result.Errorf[string]("%w", parseError(tok))
+		return result.Error[string](unexpected(tok, describe(token.Id)))
 	}
 	return result.Ok(tok.Capture)
 }
@@ -760,9 +891,10 @@ func ParseString(lexer *lex.Lexer) (string, error) {
 }
 
 func parseString(lexer *lex.Lexer) (res types.Result[string]) {
+	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.String {
-		return result.Errorf[string]("%w", parseError(tok))
+		return result.Error[string](unexpected(tok, describe(token.String)))
 	}
 	return result.Ok(strings.Trim(tok.Capture, "\""))
 }
@@ -776,7 +908,7 @@ func parseInt32(lexer *lex.Lexer) (res types.Result[int32]) {
 
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Integer {
-		return result.Errorf[int32]("expected integer %w", parseError(tok))
+		return result.Error[int32](unexpected(tok, describe(token.Integer)))
 	}
 	if strings.HasPrefix(tok.Capture, "-") {
 		i, err := strconv.ParseInt(tok.Capture, 0, 32)
@@ -795,7 +927,7 @@ func parseInt64(lexer *lex.Lexer) (res types.Result[int64]) {
 
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Integer {
-		return result.Errorf[int64]("expected integer %w", parseError(tok))
+		return result.Error[int64](unexpected(tok, describe(token.Integer)))
 	}
 	if strings.HasPrefix(tok.Capture, "-") {
 		i, err := strconv.ParseInt(tok.Capture, 0, 32)
@@ -819,7 +951,7 @@ func parseFloat32(lexer *lex.Lexer) (res types.Result[float32]) {
 	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Float {
-		return result.Errorf[float32]("expected float %w", parseError(tok))
+		return result.Error[float32](unexpected(tok, describe(token.Float)))
 	}
 	negative := false
 	capture := tok.Capture
@@ -874,7 +1006,7 @@ func parseFloat64(lexer *lex.Lexer) (res types.Result[float64]) {
 	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
 	if tok.Type != token.Float {
-		return result.Errorf[float64]("expected float %w", parseError(tok))
+		return result.Error[float64](unexpected(tok, describe(token.Float)))
 	}
 	f, err := strconv.ParseFloat(tok.Capture, 32)
 	return result.New(f, err)
@@ -895,12 +1027,8 @@ func eat(lexer *lex.Lexer, ty token.Type) (res types.Result[bool]) {
 func expectValue(lexer *lex.Lexer, ty token.Type, capture string) (res types.Result[any]) {
 	defer handle.Error(&res)
 	tok := next(lexer).Unwrap()
-	if tok.Type != ty {
-		return result.Errorf[any]("%w. expected '%v' but found '%v'", parseError(tok), ty, tok.Type)
-	}
-	if tok.Capture != capture {
-		return result.Errorf[any]("%w. expected type:'%v' value:'%s' but found type:'%v' value:'%s'",
-			parseError(tok), ty, capture, tok.Type, tok.Capture)
+	if tok.Type != ty || tok.Capture != capture {
+		return result.Error[any](unexpected(tok, keywords(capture)...))
 	}
 	return result.Ok[any](nil)
 }
@@ -911,7 +1039,7 @@ func expect(lexer *lex.Lexer, ty token.Type) (res types.Result[any]) {
 	if tok.Type == ty {
 		return result.Ok[any](nil)
 	}
-	return result.Errorf[any]("%w. expected '%v' but found '%v'", parseError(tok), ty, tok.Type)
+	return result.Error[any](unexpected(tok, describe(ty)))
 }
 
 func next(lexer *lex.Lexer) (res types.Result[*token.Token]) {
@@ -951,12 +1079,80 @@ func peek(lexer *lex.Lexer) (res types.Result[*token.Token]) {
 	}
 }
 
-func parseError(tok *token.Token) error {
-	line := tok.Line + 1
-	col := tok.Column + 1
-	return fmt.Errorf(
-		"error parsing at line %d, column %d, position %d",
-		line,
-		col,
-		tok.Position)
+// unexpected returns a diagnostic for a token that does not match the expected descriptions
+func unexpected(tok *token.Token, expected ...string) *diagnostic.Diagnostic {
+	found := "end of input"
+	if tok.Type != token.EndOfStream {
+		found = "'" + tok.Capture + "'"
+	}
+	d := diagnostic.New(tok.Span(), "unexpected %s", found)
+	d.Expected = expected
+	return d
+}
+
+// describe returns the text used for a token type in diagnostics
+func describe(ty token.Type) string {
+	switch ty {
+	case token.OpenParen:
+		return "'('"
+	case token.CloseParen:
+		return "')'"
+	case token.Module, token.Component:
+		return "'" + string(ty) + "'"
+	case token.Id:
+		return "identifier"
+	case token.EndOfStream:
+		return "end of input"
+	}
+	return string(ty)
+}
+
+// keywords quotes the keywords for use as expected descriptions
+func keywords(values ...string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, "'"+value+"'")
+	}
+	return quoted
+}
+
+// synchronize skips the item that failed to parse, see diagnostic.Synchronize
+func synchronize(lexer *lex.Lexer, start *lex.Lexer, err error, enclosed bool) error {
+	return diagnostic.Synchronize(lexer, start, err, func() (bool, error) {
+		return skip(lexer, enclosed).Deconstruct()
+	})
+}
+
+// skip consumes tokens through the ')' that closes the current form.
+// The end of input and, for enclosed forms, the ')' that closes the enclosing form are not consumed.
+func skip(lexer *lex.Lexer, enclosed bool) (res types.Result[bool]) {
+	defer handle.Error(&res)
+
+	depth := 0
+	skipped := false
+	for {
+		tok := peek(lexer).Unwrap()
+		switch tok.Type {
+		case token.EndOfStream:
+			return result.Ok(skipped)
+		case token.OpenParen:
+			depth++
+		case token.CloseParen:
+			if depth == 0 {
+				if enclosed {
+					return result.Ok(skipped)
+				}
+				// an unbalanced ')' is skipped on its own
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+			depth--
+			if depth == 0 {
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+		}
+		next(lexer).Unwrap()
+		skipped = true
+	}
 }
@@ -2,17 +2,20 @@ package ast
 
 import (
 	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 )
 
 type Ast struct {
 	PackageDeclaration types.Option[PackageDeclaration]
 	Items              []AstItem
+	Span               diagnostic.Span
 }
 
 type PackageDeclaration struct {
 	Namespace string
 	Name      string
 	Version   types.Option[Version]
+	Span      diagnostic.Span
 }
 
 type Version struct {
@@ -21,6 +24,7 @@ type Version struct {
 	Patch uint64
 	Pre   string
 	Build string
+	Span  diagnostic.Span
 }
 
 type AstItem struct {
@@ -31,7 +35,9 @@ type AstItem struct {
 
 type Interface struct {
 	Name  string
+	Gates []Gate
 	Items []InterfaceItem
+	Span  diagnostic.Span
 }
 
 type InterfaceItem interface {
@@ -40,28 +46,35 @@ type InterfaceItem interface {
 
 type FuncItem struct {
 	InterfaceItem
+	Gates    []Gate
 	ID       string
 	FuncType *FuncType
+	Span     diagnostic.Span
 }
 
 type FuncType struct {
 	Params  []Parameter
 	Results *ResultList
+	Span    diagnostic.Span
 }
 
 type ResultList struct {
 	Named     []Parameter
 	Anonymous Type
+	Span      diagnostic.Span
 }
 
 type Parameter struct {
 	Id   string
 	Type Type
+	Span diagnostic.Span
 }
 
 type World struct {
 	Id    string
+	Gates []Gate
 	Items []WorldItem
+	Span  diagnostic.Span
 }
 
 type WorldItem interface {
@@ -70,12 +83,16 @@ type WorldItem interface {
 
 type Export struct {
 	WorldItem
+	Gates      []Gate
 	ExternType ExternType
+	Span       diagnostic.Span
 }
 
 type Import struct {
 	WorldItem
+	Gates      []Gate
 	ExternType ExternType
+	Span       diagnostic.Span
 }
 
 type ExternType interface {
@@ -86,24 +103,29 @@ type ExternTypeFunc struct {
 	ExternType
 	ID   string
 	Func *FuncType
+	Span diagnostic.Span
 }
 
 type ExternTypeInterface struct {
 	ExternType
 	ID             string
 	InterfaceItems []InterfaceItem
+	Span           diagnostic.Span
 }
 
 type ExternTypeUsePath struct {
 	ExternType
 	UsePath *UsePath
+	Span    diagnostic.Span
 }
 
 type Use struct {
 	WorldItem
 	InterfaceItem
+	Gates []Gate
 	From  *UsePath
 	Names []UseName
+	Span  diagnostic.Span
 }
 
 type UsePath struct {
@@ -112,11 +134,13 @@ type UsePath struct {
 		Id   *PackageDeclaration
 		Name string
 	}
+	Span diagnostic.Span
 }
 
 type UseName struct {
 	Name string
 	As   types.Option[string]
+	Span diagnostic.Span
 }
 
 type TypeDef interface {
@@ -127,56 +151,115 @@ type TypeDef interface {
 
 type Include struct {
 	WorldItem
+	Gates []Gate
 	From  *UsePath
 	Names []IncludeName
+	Span  diagnostic.Span
 }
 
 type IncludeName struct {
 	Name string
 	As   string
+	Span diagnostic.Span
 }
 
 type TopLevelUse struct {
 	Item *UsePath
 	As   types.Option[string]
+	Span diagnostic.Span
 }
 
 type Type interface {
 	ty()
 }
 
-type U8 struct{ Type }
-type U16 struct{ Type }
-type U32 struct{ Type }
-type U64 struct{ Type }
-type S8 struct{ Type }
-type S16 struct{ Type }
-type S32 struct{ Type }
-type S64 struct{ Type }
-type Float32 struct{ Type }
-type Float64 struct{ Type }
-type Char struct{ Type }
-type Bool struct{ Type }
-type String struct{ Type }
+type U8 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type U16 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type U32 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type U64 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type S8 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type S16 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type S32 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type S64 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type Float32 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type Float64 struct {
+	Type
+	Span diagnostic.Span
+}
+
+type Char struct {
+	Type
+	Span diagnostic.Span
+}
+
+type Bool struct {
+	Type
+	Span diagnostic.Span
+}
+
+type String struct {
+	Type
+	Span diagnostic.Span
+}
 
 type Tuple struct {
 	Type
 	Types []Type
+	Span  diagnostic.Span
 }
 
 type List struct {
 	Type
 	ItemType Type
+	Span     diagnostic.Span
 }
 
 type Option struct {
 	Type
 	ItemType Type
+	Span     diagnostic.Span
 }
 type Result struct {
 	Type
 	Ok    types.Option[Type]
 	Error types.Option[Type]
+	Span  diagnostic.Span
 }
 
 type Handle interface {
@@ -186,30 +269,36 @@ type Handle interface {
 type Own struct {
 	Handle
 	Type
-	Id string
+	Id   string
+	Span diagnostic.Span
 }
 
 type Borrow struct {
 	Handle
 	Type
-	Id string
+	Id   string
+	Span diagnostic.Span
 }
 
 type Id struct {
 	Type
 	Value string
+	Span  diagnostic.Span
 }
 
 type Stream struct {
 	Type
 	Element types.Option[Type]
 	End     types.Option[Type]
+	Span    diagnostic.Span
 }
 
 type Resource struct {
 	TypeDef
+	Gates   []Gate
 	ID      string
 	Methods []ResourceMethod
+	Span    diagnostic.Span
 }
 
 type ResourceMethod interface {
@@ -218,70 +307,118 @@ type ResourceMethod interface {
 
 type Static struct {
 	ResourceMethod
+	Gates    []Gate
 	ID       string
 	FuncType *FuncType
+	Span     diagnostic.Span
 }
 
 type Constructor struct {
 	ResourceMethod
+	Gates         []Gate
 	ParameterList []Parameter
+	Span          diagnostic.Span
 }
 
 type Method struct {
 	ResourceMethod
 	ID   string
 	Func *FuncItem
+	Span diagnostic.Span
 }
 
 type Record struct {
 	TypeDef
+	Gates  []Gate
 	ID     string
 	Fields []Field
+	Span   diagnostic.Span
 }
 
 type Field struct {
 	Name string
 	Type Type
+	Span diagnostic.Span
 }
 
 type Flags struct {
 	TypeDef
+	Gates []Gate
 	ID    string
 	Flags []Flag
+	Span  diagnostic.Span
 }
 
 type Flag struct {
-	Id string
+	Id   string
+	Span diagnostic.Span
 }
 
 type Variant struct {
 	TypeDef
+	Gates []Gate
 	ID    string
 	Cases []Case
+	Span  diagnostic.Span
 }
 
 type Case struct {
 	Name string
 	Type types.Option[Type]
+	Span diagnostic.Span
 }
 
 type Enum struct {
 	TypeDef
+	Gates []Gate
 	ID    string
 	Cases []EnumCase
+	Span  diagnostic.Span
 }
 
 type EnumCase struct {
 	Name string
+	Span diagnostic.Span
 }
 
 type TypeItem struct {
 	TypeDef
-	ID   string
-	Type Type
+	Gates []Gate
+	ID    string
+	Type  Type
+	Span  diagnostic.Span
 }
 
 type Future struct {
 	Type
 	ItemType types.Option[Type]
+	Span     diagnostic.Span
+}
+
+// Gate is a feature gate attribute that controls when an item is part of a package
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/WIT.md#feature-gates
+type Gate interface {
+	gate()
+}
+
+// Since is the `@since(version = x.y.z)` gate
+type Since struct {
+	Gate
+	Version Version
+	Feature types.Option[string]
+	Span    diagnostic.Span
+}
+
+// Unstable is the `@unstable(feature = id)` gate
+type Unstable struct {
+	Gate
+	Feature string
+	Span    diagnostic.Span
+}
+
+// Deprecated is the `@deprecated(version = x.y.z)` gate
+type Deprecated struct {
+	Gate
+	Version Version
+	Span    diagnostic.Span
 }
@@ -0,0 +1,101 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// String returns the semver representation of the version
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// ParseVersion parses a semver string of the form major.minor.patch[-pre][+build]
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	core, build, _ := strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version '%s'. Expected major.minor.patch", s)
+	}
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid version '%s': %w", s, err)
+		}
+		numbers[i] = n
+	}
+	v.Major, v.Minor, v.Patch = numbers[0], numbers[1], numbers[2]
+	v.Pre = pre
+	v.Build = build
+	return v, nil
+}
+
+// Compare returns -1 if v < other, 0 if v == other and 1 if v > other using semver precedence.
+// Build metadata is ignored.
+// https://semver.org/#spec-item-11
+func (v Version) Compare(other Version) int {
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+
+	// a version without a pre release has higher precedence
+	switch {
+	case v.Pre == "" && other.Pre == "":
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	}
+
+	left := strings.Split(v.Pre, ".")
+	right := strings.Split(other.Pre, ".")
+	for i := 0; i < len(left) && i < len(right); i++ {
+		if c := comparePreRelease(left[i], right[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(left)), uint64(len(right)))
+}
+
+func comparePreRelease(left, right string) int {
+	l, lerr := strconv.ParseUint(left, 10, 64)
+	r, rerr := strconv.ParseUint(right, 10, 64)
+	switch {
+	// numeric identifiers always have lower precedence than non-numeric identifiers
+	case lerr == nil && rerr == nil:
+		return compareUint(l, r)
+	case lerr == nil:
+		return -1
+	case rerr == nil:
+		return 1
+	}
+	return strings.Compare(left, right)
+}
+
+func compareUint(left, right uint64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,186 @@
+package component_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	type test struct {
+		name  string
+		input string
+	}
+	tests := []test{
+		{"empty_interface", `package a:b; interface i {}`},
+		{"versioned", `package a:b@1.2.3-rc.1; interface i { f: func(); }`},
+		{"func", `package a:b; interface i { f: func(a: u32, b: string) -> bool; g: func() -> (x: u8, y: s64); }`},
+		{"primitives", `package a:b; interface i { f: func(a: u8, b: u16, c: u32, d: u64, e: s8, f: s16, g: s32, h: s64, i: f32, j: f64, k: char, l: bool, m: string); }`},
+		{"compound", `package a:b; interface i { f: func(a: list<u8>, b: option<string>, c: tuple<u32, f64>, d: result<u32, string>, e: result, f: result<_, u8>); }`},
+		{"record", `package a:b; interface i { record r { x: u32, y: list<string> } f: func(r: r) -> r; }`},
+		{"variant", `package a:b; interface i { variant v { a, b(u32), c(string) } enum e { x, y } flags f { p, q } }`},
+		{"alias", `package a:b; interface i { type t = u32; type l = list<t>; record r { a: t } type s = r; }`},
+		{"resource", `package a:b; interface i { resource r { constructor(x: u32); get: func() -> u32; make: static func() -> r; } f: func(a: borrow<r>) -> r; }`},
+		{"use", `package a:b; interface i { record r { x: u32 } } interface j { use i.{r, r as s}; f: func(a: r, b: s); }`},
+		{"world", `package a:b; interface i { f: func(); } interface j { g: func(); } world w { import i; export j; import h: func(x: u32); export k: interface { z: func(); } }`},
+		{"world_types", `package a:b; interface i { record r { x: u32 } } world w { import i; use i.{r}; import h: func(x: r); }`},
+		{"world_resource", `package a:b; world w { resource r { constructor(); m: func(); } import h: func(x: r); }`},
+		{"stream", `package a:b; interface i { f: func(a: stream<u8>, b: future<string>, c: future); }`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := wit.Parse(test.input)
+			require.NoError(t, err)
+
+			encoded, err := component.Encode(tree)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = binary.Write(&buf, &api.Document{
+				Preamble: api.Preamble{
+					Version: binary.ComponentVersion,
+					Layer:   binary.ComponentLayer,
+				},
+				Directive: encoded,
+			})
+			require.NoError(t, err)
+
+			document, err := binary.Read(&buf)
+			require.NoError(t, err)
+			require.Equal(t, encoded, document.Directive)
+
+			decoded, err := component.Decode(document.Directive.(*api.Component))
+			require.NoError(t, err)
+
+			// decoded trees have no source so the spans of the parsed tree are cleared
+			diagnostic.Clear(tree)
+			require.Equal(t, tree, decoded)
+		})
+	}
+}
+
+func TestForeignPackage(t *testing.T) {
+	dep, err := wit.Parse(`package wasi:io@0.2.0; interface error { resource error; } interface streams { use error.{error}; resource input-stream { read: func(len: u64) -> result<list<u8>, error>; } }`)
+	require.NoError(t, err)
+
+	tree, err := wit.Parse(`package a:b; interface i { use wasi:io/streams@0.2.0.{input-stream}; f: func(s: borrow<input-stream>); } world w { import wasi:io/streams@0.2.0; export i; }`)
+	require.NoError(t, err)
+
+	encoded, err := component.Encode(tree, dep)
+	require.NoError(t, err)
+
+	decoded, err := component.Decode(encoded)
+	require.NoError(t, err)
+
+	diagnostic.Clear(tree)
+	require.Equal(t, tree.Items[0], decoded.Items[0])
+
+	world := decoded.Items[1].World
+	require.NotNil(t, world)
+	// the dependency of streams is imported before it
+	names := []string{}
+	for _, item := range world.Items {
+		switch i := item.(type) {
+		case *ast.Import:
+			path := i.ExternType.(*ast.ExternTypeUsePath).UsePath
+			names = append(names, "import "+path.Id)
+		case *ast.Export:
+			path := i.ExternType.(*ast.ExternTypeUsePath).UsePath
+			names = append(names, "export "+path.Id)
+		}
+	}
+	require.Equal(t, []string{"import error", "import streams", "export i"}, names)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	type test struct {
+		name  string
+		input string
+	}
+	tests := []test{
+		{"missing_package", `interface i {}`},
+		{"missing_type", `package a:b; interface i { f: func(x: t); }`},
+		{"missing_interface", `package a:b; interface i { use j.{t}; }`},
+		{"missing_dependency", `package a:b; interface i { use c:d/j.{t}; }`},
+		{"recursive", `package a:b; interface i { type t = list<t>; }`},
+		{"borrow_record", `package a:b; interface i { record r {} f: func(x: borrow<r>); }`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := wit.Parse(test.input)
+			require.NoError(t, err)
+			_, err = component.Encode(tree)
+			require.Error(t, err)
+		})
+	}
+}
+
+// TestDecodeFixture decodes the package of testdata/wit.wit from the binary written by this package and from
+// testdata/wit.wasm, written by `wasm-tools component wit --wasm testdata/wit.wit -o testdata/wit.wasm`
+func TestDecodeFixture(t *testing.T) {
+	source, err := os.ReadFile("testdata/wit.wit")
+	require.NoError(t, err)
+	tree, err := wit.Parse(string(source))
+	require.NoError(t, err)
+	diagnostic.Clear(tree)
+
+	encoded, err := component.Encode(tree)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	err = binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: encoded,
+	})
+	require.NoError(t, err)
+
+	type test struct {
+		name string
+		data func() ([]byte, error)
+	}
+	tests := []test{
+		{"encode", func() ([]byte, error) { return buf.Bytes(), nil }},
+		{"wasm_tools", func() ([]byte, error) { return os.ReadFile("testdata/wit.wasm") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.data()
+			if errors.Is(err, os.ErrNotExist) {
+				t.Skip("testdata/wit.wasm has not been generated, run `wasm-tools component wit --wasm testdata/wit.wit -o testdata/wit.wasm` in wit/component")
+			}
+			require.NoError(t, err)
+
+			document, err := binary.Read(bytes.NewReader(data))
+			require.NoError(t, err)
+			c, ok := document.Directive.(*api.Component)
+			require.True(t, ok)
+			decoded, err := component.Decode(c)
+			require.NoError(t, err)
+
+			require.Equal(t, tree.PackageDeclaration, decoded.PackageDeclaration)
+			require.ElementsMatch(t, itemNames(tree), itemNames(decoded))
+		})
+	}
+}
+
+// itemNames returns the names of the interfaces and worlds of a package
+func itemNames(tree *ast.Ast) []string {
+	var names []string
+	for _, item := range tree.Items {
+		switch {
+		case item.Interface != nil:
+			names = append(names, "interface "+item.Interface.Name)
+		case item.World != nil:
+			names = append(names, "world "+item.World.Id)
+		}
+	}
+	return names
+}
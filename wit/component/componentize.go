@@ -0,0 +1,601 @@
+package component
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// ComponentTypeSection is the name of the custom section that embeds the world of a core module.
+// Sections named `component-type:<world>` are recognized as well.
+const ComponentTypeSection = "component-type"
+
+// MainModule is the import module adapters use to import the exports of the main module
+const MainModule = "__main_module__"
+
+// Adapter is a core module that implements the imports of the main module from the module Name,
+// like the WASI preview1 adapter. The adapter imports the memory of the main module as `env.memory`
+// and other exports of the main module from `__main_module__`. Its component-type section describes
+// the component imports it uses.
+type Adapter struct {
+	Name   string
+	Module *api.Module
+}
+
+// Embed adds the world of tree to module in a component-type custom section like `wasm-tools component embed`
+func Embed(module *api.Module, world string, tree *ast.Ast, deps ...*ast.Ast) error {
+	found := false
+	for _, item := range tree.Items {
+		found = found || item.World != nil && item.World.Id == world
+	}
+	if !found {
+		return fmt.Errorf("world '%s' not found", world)
+	}
+	encoded, err := Encode(tree, deps...)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: encoded,
+	})
+	if err != nil {
+		return err
+	}
+	module.Customs = append(module.Customs, &api.CustomSection{Name: ComponentTypeSection + ":" + world, Data: buf.Bytes()})
+	return nil
+}
+
+// Componentize wraps a core module that follows the canonical ABI in a component like `wasm-tools component new`.
+// The world is read from the component-type section of the module. Core imports from an interface of the world
+// or from `$root` for world functions are lowered, and the exports of the world are lifted from the core exports
+// named `<func>` and `<interface>#<func>`. The canonical options use the exported `memory`, `cabi_realloc` and
+// `cabi_post_<export>` of the module when present.
+//
+// Imports lowered with a memory are routed through a shim module whose functions call through a table, the
+// table is filled by a fixup module once the memory and realloc exist. Adapters are instantiated after the
+// main module and are reached through the shim the same way.
+func Componentize(module *api.Module, adapters ...Adapter) (*api.Component, error) {
+	z := &componentizer{composer: newComposer(), aliases: map[string]uint32{}}
+	main, body, err := embedded(module)
+	if err != nil {
+		return nil, err
+	}
+	z.main = newCore("", main)
+	for _, adapter := range adapters {
+		adapted, adapterBody, err := embedded(adapter.Module)
+		if err != nil {
+			return nil, fmt.Errorf("adapter '%s': %w", adapter.Name, err)
+		}
+		z.adapters = append(z.adapters, newCore(adapter.Name, adapted))
+		if err := z.world(adapterBody, nil); err != nil {
+			return nil, fmt.Errorf("adapter '%s': %w", adapter.Name, err)
+		}
+	}
+	// the exports are lifted once the imports are added and the core modules are instantiated
+	type export struct {
+		d *api.ExportDeclaration
+		x indices
+	}
+	var exports []export
+	err = z.world(body, func(d *api.ExportDeclaration, x indices) error {
+		exports = append(exports, export{d, x})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := z.instantiate(); err != nil {
+		return nil, err
+	}
+	for _, e := range exports {
+		if err := z.export(e.d, e.x); err != nil {
+			return nil, fmt.Errorf("export '%s': %w", e.d.Name, err)
+		}
+	}
+	if len(z.exports) > 0 {
+		z.add(&api.ExportSection{Exports: z.exports})
+	}
+	return z.component, nil
+}
+
+// embedded returns a copy of module without its component-type sections and the body of the world they describe
+func embedded(module *api.Module) (*api.Module, *api.ComponentType, error) {
+	stripped := *module
+	stripped.Customs = nil
+	var body *api.ComponentType
+	for _, custom := range module.Customs {
+		if custom.Name != ComponentTypeSection && !strings.HasPrefix(custom.Name, ComponentTypeSection+":") {
+			stripped.Customs = append(stripped.Customs, custom)
+			continue
+		}
+		if body != nil {
+			return nil, nil, fmt.Errorf("module has more than one %s section", ComponentTypeSection)
+		}
+		var err error
+		body, err = worldBody(custom)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", custom.Name, err)
+		}
+	}
+	if body == nil {
+		return nil, nil, fmt.Errorf("module does not have a %s section", ComponentTypeSection)
+	}
+	return &stripped, body, nil
+}
+
+// worldBody decodes the component-type section and returns the body of its world. The world named
+// by the section is used, a section without a name must describe a single world.
+func worldBody(custom *api.CustomSection) (*api.ComponentType, error) {
+	document, err := binary.Read(bytes.NewReader(custom.Data))
+	if err != nil {
+		return nil, err
+	}
+	c, ok := document.Directive.(*api.Component)
+	if !ok {
+		return nil, fmt.Errorf("expected a component")
+	}
+	exports, err := typeExports(c)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(custom.Name, ComponentTypeSection), ":")
+	var worlds []*api.ComponentType
+	for _, export := range exports {
+		last, ok := lastExport(export.ty)
+		if !ok {
+			continue
+		}
+		desc, ok := last.Desc.(*api.ComponentExternDesc)
+		if !ok {
+			continue
+		}
+		q, ok := parseQualifiedName(last.Name)
+		if !ok || name != "" && q.name != name {
+			continue
+		}
+		body, err := componentTypeAt(export.ty, desc.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", last.Name, err)
+		}
+		worlds = append(worlds, body)
+	}
+	switch len(worlds) {
+	case 0:
+		return nil, fmt.Errorf("world not found")
+	case 1:
+		return worlds[0], nil
+	}
+	return nil, fmt.Errorf("expected a single world, found %d", len(worlds))
+}
+
+// componentTypeAt returns the component type defined at index in the type index space of ty
+func componentTypeAt(ty *api.ComponentType, index uint32) (*api.ComponentType, error) {
+	var count uint32
+	for _, declaration := range ty.Declarations {
+		switch d := declaration.(type) {
+		case *api.TypeDeclaration:
+			if count == index {
+				body, ok := d.Type.(*api.ComponentType)
+				if !ok {
+					return nil, fmt.Errorf("type %d is not a component type", index)
+				}
+				return body, nil
+			}
+			count++
+		case *api.AliasDeclaration:
+			if d.Alias.Sort == api.TypeSort {
+				count++
+			}
+		}
+	}
+	return nil, fmt.Errorf("type index %d out of range", index)
+}
+
+// core is a core module of the component and the indices of its instance and canonical options
+type core struct {
+	name     string
+	module   *api.Module
+	instance uint32
+	memory   types.Option[uint32]
+	realloc  types.Option[uint32]
+}
+
+func newCore(name string, module *api.Module) *core {
+	return &core{name: name, module: module, memory: option.None[uint32](), realloc: option.None[uint32]()}
+}
+
+func (c *core) exports(name string) bool {
+	for _, export := range c.module.Exports {
+		if export.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lowering is a core function imported by the main module or an adapter
+type lowering struct {
+	imp api.Import
+	// ty is the core type of the import
+	ty api.FuncType
+	// owner provides the canonical options of the lowering
+	owner *core
+	// adapter exports the function when the import is satisfied by an adapter
+	adapter *core
+	// fn is the component function to lower
+	fn uint32
+	// direct lowerings do not need a memory and are lowered before the owner is instantiated
+	direct bool
+}
+
+type componentizer struct {
+	*composer
+	main     *core
+	adapters []*core
+	// aliases are the component functions aliased from imported instances by `<instance>#<func>`
+	aliases map[string]uint32
+	exports []api.ComponentExport
+}
+
+// instantiate adds the core modules and instantiates them with the lowered imports
+func (z *componentizer) instantiate() error {
+	cores := append([]*core{z.main}, z.adapters...)
+	imports := map[*core][]*lowering{}
+	var indirect []*lowering
+	for _, c := range cores {
+		for _, imp := range c.module.Imports {
+			if c != z.main && imp.Module == "env" {
+				if _, ok := imp.Description.(*api.MemImportDescription); ok {
+					continue
+				}
+			}
+			if c != z.main && imp.Module == MainModule {
+				continue
+			}
+			l, err := z.lowering(c, imp)
+			if err != nil {
+				return fmt.Errorf("import '%s' '%s': %w", imp.Module, imp.Name, err)
+			}
+			imports[c] = append(imports[c], l)
+			if !l.direct {
+				indirect = append(indirect, l)
+			}
+		}
+	}
+
+	for _, c := range cores {
+		z.add(&api.CoreModuleSection{Module: c.module})
+		z.next(api.CoreModuleSort)
+	}
+	var shim, fixup, shimInstance uint32
+	if len(indirect) > 0 {
+		z.add(&api.CoreModuleSection{Module: shimModule(indirect)})
+		shim = z.next(api.CoreModuleSort)
+		z.add(&api.CoreModuleSection{Module: fixupModule(indirect)})
+		fixup = z.next(api.CoreModuleSort)
+		shimInstance = z.coreInstance(&api.CoreInstantiateInstance{Module: shim})
+	}
+	shimFuncs := map[*lowering]uint32{}
+	for i, l := range indirect {
+		shimFuncs[l] = z.coreAlias(api.CoreFuncSort, shimInstance, strconv.Itoa(i))
+	}
+
+	for i, c := range cores {
+		// core funcs of the import modules in the order they are first imported
+		var modules []string
+		items := map[string][]api.CoreInlineExport{}
+		add := func(module string, export api.CoreInlineExport) {
+			if _, ok := items[module]; !ok {
+				modules = append(modules, module)
+			}
+			items[module] = append(items[module], export)
+		}
+		for _, imp := range c.module.Imports {
+			switch {
+			case c != z.main && imp.Module == "env":
+				memory, ok := z.main.memory.Deconstruct()
+				if !ok {
+					return fmt.Errorf("adapter '%s' imports a memory but the main module does not export one", c.name)
+				}
+				add(imp.Module, api.CoreInlineExport{Name: imp.Name, Sort: api.CoreMemorySort, Index: memory})
+			case c != z.main && imp.Module == MainModule:
+				if _, ok := imp.Description.(*api.FuncImportDescription); !ok || !z.main.exports(imp.Name) {
+					return fmt.Errorf("adapter '%s' imports '%s' which is not a function exported by the main module", c.name, imp.Name)
+				}
+				add(imp.Module, api.CoreInlineExport{Name: imp.Name, Sort: api.CoreFuncSort, Index: z.coreAlias(api.CoreFuncSort, z.main.instance, imp.Name)})
+			}
+		}
+		for _, l := range imports[c] {
+			fn, ok := shimFuncs[l]
+			if !ok {
+				var err error
+				if fn, err = z.lower(l); err != nil {
+					return err
+				}
+			}
+			add(l.imp.Module, api.CoreInlineExport{Name: l.imp.Name, Sort: api.CoreFuncSort, Index: fn})
+		}
+		var args []api.CoreInstantiateArg
+		for _, module := range modules {
+			instance := z.coreInstance(&api.CoreExportsInstance{Exports: items[module]})
+			args = append(args, api.CoreInstantiateArg{Name: module, Instance: instance})
+		}
+		c.instance = z.coreInstance(&api.CoreInstantiateInstance{Module: uint32(i), Args: args})
+		if c.exports("memory") {
+			c.memory = option.Some(z.coreAlias(api.CoreMemorySort, c.instance, "memory"))
+		}
+		for _, realloc := range []string{"cabi_import_realloc", "cabi_realloc"} {
+			if c.exports(realloc) && c.realloc.IsNone() {
+				c.realloc = option.Some(z.coreAlias(api.CoreFuncSort, c.instance, realloc))
+			}
+		}
+	}
+
+	if len(indirect) == 0 {
+		return nil
+	}
+	exports := []api.CoreInlineExport{
+		{Name: "$imports", Sort: api.CoreTableSort, Index: z.coreAlias(api.CoreTableSort, shimInstance, "$imports")},
+	}
+	for i, l := range indirect {
+		fn, err := z.lower(l)
+		if err != nil {
+			return err
+		}
+		exports = append(exports, api.CoreInlineExport{Name: strconv.Itoa(i), Sort: api.CoreFuncSort, Index: fn})
+	}
+	instance := z.coreInstance(&api.CoreExportsInstance{Exports: exports})
+	z.coreInstance(&api.CoreInstantiateInstance{Module: fixup, Args: []api.CoreInstantiateArg{{Name: "", Instance: instance}}})
+	return nil
+}
+
+// lowering resolves a core function import of c to the component function or adapter export that implements it
+func (z *componentizer) lowering(c *core, imp api.Import) (*lowering, error) {
+	desc, ok := imp.Description.(*api.FuncImportDescription)
+	if !ok {
+		return nil, fmt.Errorf("unsupported import %T", imp.Description)
+	}
+	if int(desc.TypeIdx) >= len(c.module.Types) {
+		return nil, fmt.Errorf("type index %d out of range", desc.TypeIdx)
+	}
+	l := &lowering{imp: imp, ty: *c.module.Types[desc.TypeIdx], owner: c}
+	for _, adapter := range z.adapters {
+		if adapter.name != imp.Module {
+			continue
+		}
+		if c != z.main {
+			return nil, fmt.Errorf("adapters can not import from other adapters")
+		}
+		if !adapter.exports(imp.Name) {
+			return nil, fmt.Errorf("adapter '%s' does not export '%s'", adapter.name, imp.Name)
+		}
+		l.adapter = adapter
+		return l, nil
+	}
+	if imp.Module == "$root" {
+		arg, ok := z.imports[imp.Name]
+		if !ok || arg.Sort != api.FuncSort {
+			return nil, fmt.Errorf("world does not import the function '%s'", imp.Name)
+		}
+		l.fn = arg.Index
+	} else {
+		arg, ok := z.imports[imp.Module]
+		if !ok || arg.Sort != api.InstanceSort {
+			return nil, fmt.Errorf("world does not import the interface '%s'", imp.Module)
+		}
+		key := imp.Module + "#" + imp.Name
+		fn, ok := z.aliases[key]
+		if !ok {
+			z.add(&api.AliasSection{Aliases: []api.Alias{
+				{Sort: api.FuncSort, Target: &api.ExportAlias{Instance: arg.Index, Name: imp.Name}},
+			}})
+			fn = z.next(api.FuncSort)
+			z.aliases[key] = fn
+		}
+		l.fn = fn
+	}
+	// without a memory the options can not refer to the instance so the import is lowered directly
+	l.direct = !z.hasMemory(c)
+	return l, nil
+}
+
+func (z *componentizer) hasMemory(c *core) bool {
+	return c.exports("memory") || z.main.exports("memory")
+}
+
+// lower returns the core function for the lowering once its owner and adapter are instantiated
+func (z *componentizer) lower(l *lowering) (uint32, error) {
+	if l.adapter != nil {
+		return z.coreAlias(api.CoreFuncSort, l.adapter.instance, l.imp.Name), nil
+	}
+	var options []api.CanonOption
+	if !l.direct {
+		options = z.options(l.owner)
+	}
+	z.add(&api.CanonSection{Funcs: []api.CanonicalFunction{&api.CanonLower{Func: l.fn, Options: options}}})
+	return z.next(api.CoreFuncSort), nil
+}
+
+// options are the canonical options of a core instance, adapters without a memory or realloc use those of the main module
+func (z *componentizer) options(c *core) []api.CanonOption {
+	options := []api.CanonOption{api.UTF8Encoding}
+	memory, ok := c.memory.Deconstruct()
+	if !ok {
+		memory, ok = z.main.memory.Deconstruct()
+	}
+	if ok {
+		options = append(options, &api.MemoryOption{Memory: memory})
+	}
+	realloc, ok := c.realloc.Deconstruct()
+	if !ok {
+		realloc, ok = z.main.realloc.Deconstruct()
+	}
+	if ok {
+		options = append(options, &api.ReallocOption{Func: realloc})
+	}
+	return options
+}
+
+// export lifts the core exports that implement a function or interface exported by the world
+func (z *componentizer) export(d *api.ExportDeclaration, x indices) error {
+	var sort api.Sort
+	var index uint32
+	switch desc := d.Desc.(type) {
+	case *api.FuncExternDesc:
+		ty, err := x.of(api.TypeSort, desc.Type)
+		if err != nil {
+			return err
+		}
+		sort = api.FuncSort
+		if index, err = z.lift(d.Name, ty); err != nil {
+			return err
+		}
+	case *api.InstanceExternDesc:
+		ty, err := x.of(api.TypeSort, desc.Type)
+		if err != nil {
+			return err
+		}
+		instanceType, ok := z.types[ty].(*api.InstanceType)
+		if !ok {
+			return fmt.Errorf("type %d is not an instance type", ty)
+		}
+		sort = api.InstanceSort
+		if index, err = z.exportInstance(d.Name, instanceType); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported export %T", d.Desc)
+	}
+	z.exports = append(z.exports, api.ComponentExport{Name: d.Name, Sort: sort, Index: index})
+	return nil
+}
+
+// exportInstance defines the types of an exported interface in the component and returns an instance of
+// its types and lifted functions
+func (z *componentizer) exportInstance(name string, ty *api.InstanceType) (uint32, error) {
+	local := indices{}
+	var exports []api.InlineExport
+	for _, declaration := range ty.Declarations {
+		switch d := declaration.(type) {
+		case *api.TypeDeclaration:
+			def, err := local.defType(d.Type)
+			if err != nil {
+				return 0, err
+			}
+			z.add(&api.TypeSection{Types: []api.DefType{def}})
+			local.add(api.TypeSort, z.next(api.TypeSort))
+		case *api.AliasDeclaration:
+			// the outer aliases were mapped to the component when the type was added
+			outer, ok := d.Alias.Target.(*api.OuterAlias)
+			if !ok || outer.Count != 1 || d.Alias.Sort != api.TypeSort {
+				return 0, fmt.Errorf("unsupported alias in the type of an exported interface")
+			}
+			local.add(api.TypeSort, outer.Index)
+		case *api.ExportDeclaration:
+			switch desc := d.Desc.(type) {
+			case *api.TypeExternDesc:
+				eq, ok := desc.Bound.(*api.EqBound)
+				if !ok {
+					return 0, fmt.Errorf("exported resource '%s' is not supported", d.Name)
+				}
+				index, err := local.of(api.TypeSort, eq.Type)
+				if err != nil {
+					return 0, err
+				}
+				local.add(api.TypeSort, index)
+				exports = append(exports, api.InlineExport{Name: d.Name, Sort: api.TypeSort, Index: index})
+			case *api.FuncExternDesc:
+				index, err := local.of(api.TypeSort, desc.Type)
+				if err != nil {
+					return 0, err
+				}
+				fn, err := z.lift(name+"#"+d.Name, index)
+				if err != nil {
+					return 0, err
+				}
+				exports = append(exports, api.InlineExport{Name: d.Name, Sort: api.FuncSort, Index: fn})
+			default:
+				return 0, fmt.Errorf("unsupported export '%s' %T", d.Name, d.Desc)
+			}
+		default:
+			return 0, fmt.Errorf("unexpected declaration %T", declaration)
+		}
+	}
+	z.add(&api.InstanceSection{Instances: []api.ComponentInstance{&api.ExportsInstance{Exports: exports}}})
+	return z.next(api.InstanceSort), nil
+}
+
+// lift lifts the core export name of the main module with the component function type at index ty
+func (z *componentizer) lift(name string, ty uint32) (uint32, error) {
+	if !z.main.exports(name) {
+		return 0, fmt.Errorf("module does not export '%s'", name)
+	}
+	fn := z.coreAlias(api.CoreFuncSort, z.main.instance, name)
+	options := z.options(z.main)
+	if postReturn := "cabi_post_" + name; z.main.exports(postReturn) {
+		options = append(options, &api.PostReturnOption{Func: z.coreAlias(api.CoreFuncSort, z.main.instance, postReturn)})
+	}
+	z.add(&api.CanonSection{Funcs: []api.CanonicalFunction{&api.CanonLift{CoreFunc: fn, Options: options, Type: ty}}})
+	return z.next(api.FuncSort), nil
+}
+
+func (z *componentizer) coreInstance(instance api.CoreInstance) uint32 {
+	z.add(&api.CoreInstanceSection{Instances: []api.CoreInstance{instance}})
+	return z.next(api.CoreInstanceSort)
+}
+
+func (z *componentizer) coreAlias(sort api.Sort, instance uint32, name string) uint32 {
+	z.add(&api.AliasSection{Aliases: []api.Alias{{Sort: sort, Target: &api.CoreExportAlias{Instance: instance, Name: name}}}})
+	return z.next(sort)
+}
+
+// shimTable is the table of the shim module
+func shimTable(size int) api.Table {
+	return api.Table{
+		Limits:    api.Limits{Min: uint32(size), Max: option.Some(uint32(size))},
+		Reference: &api.FunctionReference{},
+	}
+}
+
+// shimModule exports a function for each lowering that calls the function at the same index of the table `$imports`
+func shimModule(lowerings []*lowering) *api.Module {
+	module := &api.Module{Tables: []api.Table{shimTable(len(lowerings))}}
+	for i, l := range lowerings {
+		ty := l.ty
+		module.Types = append(module.Types, &ty)
+		var body []api.Instruction
+		for p := range ty.Parameters.Types {
+			body = append(body, api.LocalGet{Index: api.LocalIndex(p)})
+		}
+		body = append(body, api.I32Const(i), &api.CallIndirect{Table: 0, Type: api.TypeIndex(i)}, api.End{})
+		module.Funcs = append(module.Funcs, &api.Func{Type: api.TypeIndex(i), Body: &api.Expression{Instructions: body}})
+		module.Exports = append(module.Exports, api.Export{Name: strconv.Itoa(i), Description: &api.FuncExportDescription{FuncIdx: api.FuncIndex(i)}})
+	}
+	module.Exports = append(module.Exports, api.Export{Name: "$imports", Description: &api.TableExportDescription{TableIdx: 0}})
+	return module
+}
+
+// fixupModule imports the table of the shim module and the lowered functions and fills the table with an element segment
+func fixupModule(lowerings []*lowering) *api.Module {
+	module := &api.Module{
+		Imports: []api.Import{{Module: "", Name: "$imports", Description: &api.TableImportDescription{Table: shimTable(len(lowerings))}}},
+	}
+	elem := api.Elem{Offset: &api.Expression{Instructions: []api.Instruction{api.I32Const(0), api.End{}}}}
+	for i, l := range lowerings {
+		ty := l.ty
+		module.Types = append(module.Types, &ty)
+		module.Imports = append(module.Imports, api.Import{Module: "", Name: strconv.Itoa(i), Description: &api.FuncImportDescription{TypeIdx: api.TypeIndex(i)}})
+		elem.Init = append(elem.Init, api.FuncIndex(i))
+	}
+	module.Elems = []api.Elem{elem}
+	return module
+}
@@ -0,0 +1,237 @@
+package component_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	engine "github.com/patrickhuber/go-wasm/component"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+	"github.com/stretchr/testify/require"
+)
+
+const guestWit = `package a:b;
+
+interface host {
+  log: func(s: string);
+}
+
+interface greeter {
+  hello: func(name: string) -> u32;
+}
+
+world guest {
+  import host;
+  import print: func(s: string);
+  export greet: func(name: string) -> u32;
+  export greeter;
+}
+
+world adapted {
+  export greet: func(name: string) -> u32;
+}
+
+world adapter {
+  import host;
+}
+`
+
+func i32s(n int) []api.ValType {
+	ts := make([]api.ValType, n)
+	for i := range ts {
+		ts[i] = api.I32Type
+	}
+	return ts
+}
+
+func coreFuncType(params, results int) *api.FuncType {
+	return &api.FuncType{Parameters: api.ResultType{Types: i32s(params)}, Returns: api.ResultType{Types: i32s(results)}}
+}
+
+func expression(instructions ...api.Instruction) *api.Expression {
+	return &api.Expression{Instructions: instructions}
+}
+
+// forward passes its string argument to the imported function at index and returns its length
+func forward(index api.FuncIndex) *api.Func {
+	return &api.Func{Type: 1, Body: expression(api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, &api.Call{Index: index}, api.LocalGet{Index: 1}, api.End{})}
+}
+
+// guest imports the string functions in imports and exports a memory, a cabi_realloc that returns the
+// same address for every allocation and the functions in exports that forward to an import
+func guest(imports []api.Import, exports map[string]api.FuncIndex) *api.Module {
+	module := &api.Module{
+		Types:   []*api.FuncType{coreFuncType(2, 0), coreFuncType(2, 1), coreFuncType(4, 1)},
+		Imports: imports,
+		Funcs: []*api.Func{
+			{Type: 2, Body: expression(api.I32Const(64), api.End{})},
+		},
+		Mems: []api.Mem{{Limits: api.Limits{Min: 1}}},
+		Exports: []api.Export{
+			{Name: "memory", Description: &api.MemExportDescription{MemIdx: 0}},
+			{Name: "cabi_realloc", Description: &api.FuncExportDescription{FuncIdx: api.FuncIndex(len(imports))}},
+		},
+	}
+	for _, name := range []string{"greet", "a:b/greeter#hello"} {
+		index, ok := exports[name]
+		if !ok {
+			continue
+		}
+		module.Exports = append(module.Exports, api.Export{
+			Name:        name,
+			Description: &api.FuncExportDescription{FuncIdx: api.FuncIndex(len(imports) + len(module.Funcs))},
+		})
+		module.Funcs = append(module.Funcs, forward(index))
+	}
+	return module
+}
+
+func stringImport(module, name string) api.Import {
+	return api.Import{Module: module, Name: name, Description: &api.FuncImportDescription{TypeIdx: 0}}
+}
+
+func embed(t *testing.T, module *api.Module, world string) *api.Module {
+	tree, err := wit.Parse(guestWit)
+	require.NoError(t, err)
+	require.NoError(t, component.Embed(module, world, tree))
+	return module
+}
+
+func logger(logged *[]string) *engine.Func {
+	ft := types.NewFuncType([]types.Parameter{{Name: "s", Type: types.NewString()}}, nil)
+	return engine.NewFunc(ft, func(ctx context.Context, args ...any) ([]any, error) {
+		*logged = append(*logged, args[0].(string))
+		return nil, nil
+	})
+}
+
+func TestComponentize(t *testing.T) {
+	module := embed(t, guest(
+		[]api.Import{stringImport("a:b/host", "log"), stringImport("$root", "print")},
+		map[string]api.FuncIndex{"greet": 0, "a:b/greeter#hello": 1},
+	), "guest")
+
+	componentized, err := component.Componentize(module)
+	require.NoError(t, err)
+
+	// the core modules are read back as raw sections so the decoded component is extracted and instantiated
+	var buf bytes.Buffer
+	err = binary.Write(&buf, &api.Document{
+		Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+		Directive: componentized,
+	})
+	require.NoError(t, err)
+	document, err := binary.Read(&buf)
+	require.NoError(t, err)
+	c, ok := document.Directive.(*api.Component)
+	require.True(t, ok)
+
+	trees, err := component.Extract(c)
+	require.NoError(t, err)
+	world, err := printer.String(trees[0])
+	require.NoError(t, err)
+	require.Equal(t, `package root:component;
+
+world root {
+  import a:b/host;
+  import print: func(s: string);
+  export greet: func(name: string) -> u32;
+  export a:b/greeter;
+}
+`, world)
+
+	var logged, printed []string
+	instance, err := engine.Instantiate(&runtime.Store{}, c, map[string]engine.Extern{
+		"a:b/host": engine.NewInstance(map[string]engine.Extern{"log": logger(&logged)}),
+		"print":    logger(&printed),
+	})
+	require.NoError(t, err)
+
+	results, err := instance.Call(context.Background(), "greet", "world")
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(5)}, results)
+	require.Equal(t, []string{"world"}, logged)
+
+	greeter, err := instance.Instance("a:b/greeter")
+	require.NoError(t, err)
+	results, err = greeter.Call(context.Background(), "hello", "printer")
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(7)}, results)
+	require.Equal(t, []string{"printer"}, printed)
+}
+
+func TestComponentizeAdapter(t *testing.T) {
+	module := embed(t, guest(
+		[]api.Import{stringImport("wasi_snapshot_preview1", "fd_write")},
+		map[string]api.FuncIndex{"greet": 0},
+	), "adapted")
+
+	// the adapter uses the memory of the main module and forwards fd_write to the log function of host
+	adapter := embed(t, &api.Module{
+		Types: []*api.FuncType{coreFuncType(2, 0)},
+		Imports: []api.Import{
+			{Module: "env", Name: "memory", Description: &api.MemImportDescription{Mem: api.Mem{Limits: api.Limits{Min: 1}}}},
+			stringImport("a:b/host", "log"),
+		},
+		Funcs: []*api.Func{
+			{Type: 0, Body: expression(api.LocalGet{Index: 0}, api.LocalGet{Index: 1}, &api.Call{Index: 0}, api.End{})},
+		},
+		Exports: []api.Export{
+			{Name: "fd_write", Description: &api.FuncExportDescription{FuncIdx: 1}},
+		},
+	}, "adapter")
+
+	c, err := component.Componentize(module, component.Adapter{Name: "wasi_snapshot_preview1", Module: adapter})
+	require.NoError(t, err)
+
+	var logged []string
+	instance, err := engine.Instantiate(&runtime.Store{}, c, map[string]engine.Extern{
+		"a:b/host": engine.NewInstance(map[string]engine.Extern{"log": logger(&logged)}),
+	})
+	require.NoError(t, err)
+
+	results, err := instance.Call(context.Background(), "greet", "adapter")
+	require.NoError(t, err)
+	require.Equal(t, []any{uint32(7)}, results)
+	require.Equal(t, []string{"adapter"}, logged)
+}
+
+func TestComponentizeFail(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   *api.Module
+		adapters []component.Adapter
+	}{
+		{
+			name:   "no_component_type",
+			module: guest(nil, map[string]api.FuncIndex{"greet": 0}),
+		},
+		{
+			name:   "missing_export",
+			module: embed(t, guest(nil, nil), "adapted"),
+		},
+		{
+			name:   "missing_interface",
+			module: embed(t, guest([]api.Import{stringImport("a:b/other", "log")}, map[string]api.FuncIndex{"greet": 0}), "adapted"),
+		},
+		{
+			name:   "missing_adapter_export",
+			module: embed(t, guest([]api.Import{stringImport("wasi_snapshot_preview1", "fd_read")}, map[string]api.FuncIndex{"greet": 0}), "adapted"),
+			adapters: []component.Adapter{
+				{Name: "wasi_snapshot_preview1", Module: embed(t, &api.Module{}, "adapter")},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := component.Componentize(test.module, test.adapters...)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,788 @@
+package component
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+)
+
+// Plug composes root with its dependencies like `wac plug`. Each instance import of root that is
+// exported by a dependency is satisfied by an instance of that dependency. Exports match imports
+// with the same name, or the same interface at a semver compatible version. The imports of the
+// dependencies and the imports of root that are not satisfied become imports of the composition
+// and the exports of root are its exports.
+//
+// The composition has the shape
+//
+//	(import ...)                 ;; the remaining imports, encoded from their wit
+//	(component $dep ...)         ;; each dependency
+//	(component $root ...)
+//	(instance $d (instantiate $dep (with ...)))
+//	(alias export $d "ns:pkg/i" (instance))
+//	(instance $r (instantiate $root (with ...)))
+//	(export ...)                 ;; aliases of the exports of $r
+func Plug(root *api.Component, deps ...*api.Component) (*api.Component, error) {
+	rootTrees, err := Extract(root)
+	if err != nil {
+		return nil, fmt.Errorf("root: %w", err)
+	}
+	plugs := map[string]plug{}
+	used := make([]bool, len(deps))
+	depTrees := make([][]*ast.Ast, len(deps))
+	for i, dep := range deps {
+		depTrees[i], err = Extract(dep)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %d: %w", i, err)
+		}
+	}
+	for _, imp := range imports(root) {
+		if _, ok := imp.Desc.(*api.InstanceExternDesc); !ok {
+			continue
+		}
+		p, ok, err := match(imp.Name, deps)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := compatible(imp.Name, rootTrees, p.export, depTrees[p.dep]); err != nil {
+			return nil, fmt.Errorf("dependency %d: %w", p.dep, err)
+		}
+		plugs[imp.Name] = p
+		used[p.dep] = true
+	}
+	for i := range deps {
+		if !used[i] {
+			return nil, fmt.Errorf("dependency %d does not satisfy any import of the root component", i)
+		}
+	}
+
+	// the imports of the composition are encoded from a world of the remaining imports
+	w := &world{packages: map[string]*ast.Ast{}, seen: map[string]string{}}
+	if err := w.add(rootTrees, plugs); err != nil {
+		return nil, err
+	}
+	for i := range deps {
+		if err := w.add(depTrees[i], nil); err != nil {
+			return nil, fmt.Errorf("dependency %d: %w", i, err)
+		}
+	}
+	c := newComposer()
+	if err := c.importWorld(w); err != nil {
+		return nil, err
+	}
+
+	for _, dep := range deps {
+		c.add(&api.NestedComponentSection{Component: dep})
+	}
+	c.add(&api.NestedComponentSection{Component: root})
+
+	instances := make([]uint32, len(deps))
+	for i, dep := range deps {
+		args, err := c.args(imports(dep), nil)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %d: %w", i, err)
+		}
+		instances[i] = c.instantiate(uint32(i), args)
+	}
+	plugged := map[string]uint32{}
+	for _, imp := range imports(root) {
+		p, ok := plugs[imp.Name]
+		if !ok {
+			continue
+		}
+		c.add(&api.AliasSection{Aliases: []api.Alias{
+			{Sort: api.InstanceSort, Target: &api.ExportAlias{Instance: instances[p.dep], Name: p.export}},
+		}})
+		plugged[imp.Name] = c.next(api.InstanceSort)
+	}
+	args, err := c.args(imports(root), plugged)
+	if err != nil {
+		return nil, fmt.Errorf("root: %w", err)
+	}
+	instance := c.instantiate(uint32(len(deps)), args)
+
+	var exports []api.ComponentExport
+	for _, export := range exportsOf(root) {
+		if export.Sort == api.CoreModuleSort || export.Sort == api.ComponentSort {
+			continue
+		}
+		c.add(&api.AliasSection{Aliases: []api.Alias{
+			{Sort: export.Sort, Target: &api.ExportAlias{Instance: instance, Name: export.Name}},
+		}})
+		exports = append(exports, api.ComponentExport{Name: export.Name, Sort: export.Sort, Index: c.next(export.Sort)})
+	}
+	if len(exports) > 0 {
+		c.add(&api.ExportSection{Exports: exports})
+	}
+	return c.component, nil
+}
+
+// plug is the export of a dependency that satisfies an import
+type plug struct {
+	dep    int
+	export string
+}
+
+// match returns the dependency export that satisfies the import name. An export with the same name is
+// preferred over one at a compatible version, more than one dependency satisfying the import is an error.
+func match(name string, deps []*api.Component) (plug, bool, error) {
+	var exact, compatible []plug
+	for i, dep := range deps {
+		for _, export := range exportsOf(dep) {
+			if export.Sort != api.InstanceSort {
+				continue
+			}
+			switch {
+			case export.Name == name:
+				exact = append(exact, plug{dep: i, export: export.Name})
+			case semverCompatible(name, export.Name):
+				compatible = append(compatible, plug{dep: i, export: export.Name})
+			}
+		}
+	}
+	candidates := exact
+	if len(candidates) == 0 {
+		candidates = compatible
+	}
+	switch len(candidates) {
+	case 0:
+		return plug{}, false, nil
+	case 1:
+		return candidates[0], true, nil
+	}
+	return plug{}, false, fmt.Errorf("import '%s' is satisfied by more than one dependency", name)
+}
+
+// semverCompatible returns true when both names are the same interface and the export version can be used
+// for the import version. Versions are compatible when the first non zero of major and minor match and the
+// export version is not lower.
+func semverCompatible(imp, export string) bool {
+	qi, ok := parseQualifiedName(imp)
+	if !ok || qi.version == "" {
+		return false
+	}
+	qe, ok := parseQualifiedName(export)
+	if !ok || qe.version == "" {
+		return false
+	}
+	if qi.namespace != qe.namespace || qi.pkg != qe.pkg || qi.name != qe.name {
+		return false
+	}
+	vi, err := ast.ParseVersion(qi.version)
+	if err != nil {
+		return false
+	}
+	ve, err := ast.ParseVersion(qe.version)
+	if err != nil {
+		return false
+	}
+	if vi.Pre != "" || ve.Pre != "" || vi.Major != ve.Major {
+		return false
+	}
+	if vi.Major == 0 {
+		return vi.Minor == ve.Minor && ve.Patch >= vi.Patch
+	}
+	return ve.Minor > vi.Minor || ve.Minor == vi.Minor && ve.Patch >= vi.Patch
+}
+
+// compatible checks that every item of the imported interface is provided by the exported interface.
+// Items are matched by name and their types are compared after resolving type names to their definitions,
+// so an export provides an item when the types have the same structure even if they are written differently.
+func compatible(imp string, impTrees []*ast.Ast, export string, exportTrees []*ast.Ast) error {
+	impIface, impEncoder, err := resolveInterface(impTrees, imp)
+	if err != nil {
+		return err
+	}
+	exportIface, exportEncoder, err := resolveInterface(exportTrees, export)
+	if err != nil {
+		return err
+	}
+	exportTypes, err := exportEncoder.typesOf(exportIface)
+	if err != nil {
+		return err
+	}
+	exportFuncs := map[string]*ast.FuncItem{}
+	for _, item := range exportIface.items {
+		if f, ok := item.(*ast.FuncItem); ok {
+			exportFuncs[f.ID] = f
+		}
+	}
+	c := &comparison{imp: impEncoder, export: exportEncoder}
+	for _, item := range impIface.items {
+		var names []string
+		switch it := item.(type) {
+		case *ast.FuncItem:
+			f, ok := exportFuncs[it.ID]
+			if !ok {
+				return fmt.Errorf("export '%s' does not provide func '%s' imported by '%s'", export, it.ID, imp)
+			}
+			equal, err := c.funcTypes(impIface, it.FuncType, exportIface, f.FuncType)
+			if err != nil {
+				return err
+			}
+			if !equal {
+				return fmt.Errorf("export '%s' has a different type for func '%s' imported by '%s'", export, it.ID, imp)
+			}
+			continue
+		case *ast.Use:
+			for _, name := range it.Names {
+				names = append(names, localName(name))
+			}
+		case ast.Resource:
+			names = append(names, it.ID)
+		case *ast.Record:
+			names = append(names, it.ID)
+		case *ast.Variant:
+			names = append(names, it.ID)
+		case *ast.Enum:
+			names = append(names, it.ID)
+		case *ast.Flags:
+			names = append(names, it.ID)
+		case *ast.TypeItem:
+			names = append(names, it.ID)
+		}
+		for _, name := range names {
+			if _, ok := exportTypes[name]; !ok {
+				return fmt.Errorf("export '%s' does not provide type '%s' imported by '%s'", export, name, imp)
+			}
+			equal, err := c.named(impIface, name, exportIface, name)
+			if err != nil {
+				return err
+			}
+			if equal {
+				equal, err = c.resourceMethods(impIface, name, exportIface)
+				if err != nil {
+					return err
+				}
+			}
+			if !equal {
+				return fmt.Errorf("export '%s' has a different definition for type '%s' imported by '%s'", export, name, imp)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveInterface finds the extracted interface with the qualified name and an encoder that resolves its type names
+func resolveInterface(trees []*ast.Ast, name string) (*iface, *encoder, error) {
+	q, ok := parseQualifiedName(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("'%s' is not a qualified interface name", name)
+	}
+	decl, err := packageDeclaration(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := newEncoder(trees[0], trees[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	p, ok := e.deps[versioned(packageName(decl.Namespace, decl.Name), decl.Version)]
+	if !ok {
+		return nil, nil, fmt.Errorf("interface '%s' not found", name)
+	}
+	i, ok := p.interfaces[q.name]
+	if !ok {
+		return nil, nil, fmt.Errorf("interface '%s' not found", name)
+	}
+	// an exported interface that re-exports the types of an inline import uses the import by its plain name
+	for _, item := range trees[0].Items[0].World.Items {
+		imp, ok := item.(*ast.Import)
+		if !ok {
+			continue
+		}
+		inline, ok := imp.ExternType.(*ast.ExternTypeInterface)
+		if !ok {
+			continue
+		}
+		if _, exists := p.interfaces[inline.ID]; !exists {
+			p.interfaces[inline.ID] = &ast.Interface{Name: inline.ID, Items: inline.InterfaceItems}
+		}
+	}
+	return e.iface(p, i), e, nil
+}
+
+// comparison compares the types of an imported interface with the types of an exported interface.
+// Value types are equal when they have the same structure and resources are equal when they have the
+// same name, the methods of the resources are compared for the items of the interface.
+type comparison struct {
+	imp    *encoder
+	export *encoder
+}
+
+// named compares the definitions of two type names
+func (c *comparison) named(i *iface, name string, j *iface, other string) (bool, error) {
+	definedIn, def, err := c.imp.origin(i, name)
+	if err != nil {
+		return false, err
+	}
+	otherDefinedIn, otherDef, err := c.export.origin(j, other)
+	if err != nil {
+		return false, err
+	}
+	// aliases are compared by the type they refer to
+	if alias, ok := def.(*ast.TypeItem); ok {
+		return c.types(definedIn, alias.Type, j, &ast.Id{Value: other})
+	}
+	if alias, ok := otherDef.(*ast.TypeItem); ok {
+		return c.types(i, &ast.Id{Value: name}, otherDefinedIn, alias.Type)
+	}
+	switch d := def.(type) {
+	case ast.Resource:
+		o, ok := otherDef.(ast.Resource)
+		return ok && d.ID == o.ID, nil
+	case *ast.Record:
+		o, ok := otherDef.(*ast.Record)
+		if !ok || len(d.Fields) != len(o.Fields) {
+			return false, nil
+		}
+		for k := range d.Fields {
+			if d.Fields[k].Name != o.Fields[k].Name {
+				return false, nil
+			}
+			if equal, err := c.types(definedIn, d.Fields[k].Type, otherDefinedIn, o.Fields[k].Type); err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	case *ast.Variant:
+		o, ok := otherDef.(*ast.Variant)
+		if !ok || len(d.Cases) != len(o.Cases) {
+			return false, nil
+		}
+		for k := range d.Cases {
+			if d.Cases[k].Name != o.Cases[k].Name {
+				return false, nil
+			}
+			if equal, err := c.optionalTypes(definedIn, d.Cases[k].Type, otherDefinedIn, o.Cases[k].Type); err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	case *ast.Enum:
+		o, ok := otherDef.(*ast.Enum)
+		if !ok || len(d.Cases) != len(o.Cases) {
+			return false, nil
+		}
+		for k := range d.Cases {
+			if d.Cases[k].Name != o.Cases[k].Name {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *ast.Flags:
+		o, ok := otherDef.(*ast.Flags)
+		if !ok || len(d.Flags) != len(o.Flags) {
+			return false, nil
+		}
+		for k := range d.Flags {
+			if d.Flags[k].Id != o.Flags[k].Id {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported type definition %T", def)
+}
+
+// resourceMethods checks that the exported resource provides every method of the imported resource.
+// Methods are compared separately from the resource itself because their types may refer to the resource.
+func (c *comparison) resourceMethods(i *iface, name string, j *iface) (bool, error) {
+	i, def, err := c.imp.origin(i, name)
+	if err != nil {
+		return false, err
+	}
+	resource, ok := def.(ast.Resource)
+	if !ok {
+		return true, nil
+	}
+	j, otherDef, err := c.export.origin(j, name)
+	if err != nil {
+		return false, err
+	}
+	provided := map[string]*ast.FuncType{}
+	for _, method := range otherDef.(ast.Resource).Methods {
+		name, funcType := resourceMethod(method)
+		provided[name] = funcType
+	}
+	for _, method := range resource.Methods {
+		name, funcType := resourceMethod(method)
+		otherFuncType, ok := provided[name]
+		if !ok {
+			return false, nil
+		}
+		if equal, err := c.funcTypes(i, funcType, j, otherFuncType); err != nil || !equal {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// resourceMethod returns the name a resource method is encoded with and its function type
+func resourceMethod(method ast.ResourceMethod) (string, *ast.FuncType) {
+	switch m := method.(type) {
+	case *ast.Constructor:
+		return "[constructor]", &ast.FuncType{Params: m.ParameterList}
+	case ast.Method:
+		return "[method]" + m.Func.ID, m.Func.FuncType
+	case ast.Static:
+		return "[static]" + m.ID, m.FuncType
+	}
+	return "", nil
+}
+
+func (c *comparison) funcTypes(i *iface, f *ast.FuncType, j *iface, other *ast.FuncType) (bool, error) {
+	if equal, err := c.parameters(i, f.Params, j, other.Params); err != nil || !equal {
+		return false, err
+	}
+	results, otherResults := resultsOf(f), resultsOf(other)
+	if results == nil || otherResults == nil {
+		return results == nil && otherResults == nil, nil
+	}
+	if results.Anonymous != nil || otherResults.Anonymous != nil {
+		if results.Anonymous == nil || otherResults.Anonymous == nil {
+			return false, nil
+		}
+		return c.types(i, results.Anonymous, j, otherResults.Anonymous)
+	}
+	return c.parameters(i, results.Named, j, otherResults.Named)
+}
+
+// resultsOf returns the results of a function or nil when it has none
+func resultsOf(f *ast.FuncType) *ast.ResultList {
+	if f.Results == nil || f.Results.Anonymous == nil && len(f.Results.Named) == 0 {
+		return nil
+	}
+	return f.Results
+}
+
+func (c *comparison) parameters(i *iface, params []ast.Parameter, j *iface, other []ast.Parameter) (bool, error) {
+	if len(params) != len(other) {
+		return false, nil
+	}
+	for k := range params {
+		if params[k].Id != other[k].Id {
+			return false, nil
+		}
+		if equal, err := c.types(i, params[k].Type, j, other[k].Type); err != nil || !equal {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c *comparison) optionalTypes(i *iface, t types.Option[ast.Type], j *iface, other types.Option[ast.Type]) (bool, error) {
+	ty, ok := t.Deconstruct()
+	otherTy, otherOk := other.Deconstruct()
+	if !ok || !otherOk {
+		return ok == otherOk, nil
+	}
+	return c.types(i, ty, j, otherTy)
+}
+
+// types compares two value types, t is resolved in the imported interface i and other in the exported interface j
+func (c *comparison) types(i *iface, t ast.Type, j *iface, other ast.Type) (bool, error) {
+	id, ok := t.(*ast.Id)
+	otherID, otherOk := other.(*ast.Id)
+	switch {
+	case ok && otherOk:
+		return c.named(i, id.Value, j, otherID.Value)
+	case ok:
+		// a name equals an anonymous type when it is an alias of it
+		i, def, err := c.imp.origin(i, id.Value)
+		if err != nil {
+			return false, err
+		}
+		alias, isAlias := def.(*ast.TypeItem)
+		if !isAlias {
+			return false, nil
+		}
+		return c.types(i, alias.Type, j, other)
+	case otherOk:
+		j, def, err := c.export.origin(j, otherID.Value)
+		if err != nil {
+			return false, err
+		}
+		alias, isAlias := def.(*ast.TypeItem)
+		if !isAlias {
+			return false, nil
+		}
+		return c.types(i, t, j, alias.Type)
+	}
+	switch ty := t.(type) {
+	case *ast.Own:
+		o, ok := other.(*ast.Own)
+		if !ok {
+			return false, nil
+		}
+		return c.named(i, ty.Id, j, o.Id)
+	case *ast.Borrow:
+		o, ok := other.(*ast.Borrow)
+		if !ok {
+			return false, nil
+		}
+		return c.named(i, ty.Id, j, o.Id)
+	case *ast.List:
+		o, ok := other.(*ast.List)
+		if !ok {
+			return false, nil
+		}
+		return c.types(i, ty.ItemType, j, o.ItemType)
+	case *ast.Option:
+		o, ok := other.(*ast.Option)
+		if !ok {
+			return false, nil
+		}
+		return c.types(i, ty.ItemType, j, o.ItemType)
+	case *ast.Tuple:
+		o, ok := other.(*ast.Tuple)
+		if !ok || len(ty.Types) != len(o.Types) {
+			return false, nil
+		}
+		for k := range ty.Types {
+			if equal, err := c.types(i, ty.Types[k], j, o.Types[k]); err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	case *ast.Result:
+		o, ok := other.(*ast.Result)
+		if !ok {
+			return false, nil
+		}
+		if equal, err := c.optionalTypes(i, ty.Ok, j, o.Ok); err != nil || !equal {
+			return false, err
+		}
+		return c.optionalTypes(i, ty.Error, j, o.Error)
+	case *ast.Stream:
+		o, ok := other.(*ast.Stream)
+		if !ok {
+			return false, nil
+		}
+		if equal, err := c.optionalTypes(i, ty.Element, j, o.Element); err != nil || !equal {
+			return false, err
+		}
+		return c.optionalTypes(i, ty.End, j, o.End)
+	case *ast.Future:
+		o, ok := other.(*ast.Future)
+		if !ok {
+			return false, nil
+		}
+		return c.optionalTypes(i, ty.ItemType, j, o.ItemType)
+	}
+	// the primitive types have no structure besides their kind
+	return reflect.TypeOf(t) == reflect.TypeOf(other), nil
+}
+
+// world collects the import items of the composed components
+type world struct {
+	items    []ast.WorldItem
+	packages map[string]*ast.Ast
+	order    []string
+	// seen maps the key of an item to its printed form so duplicate imports can be compared
+	seen map[string]string
+}
+
+// add adds the imports of an extracted world, skipping the imports satisfied by plugs
+func (w *world) add(trees []*ast.Ast, plugs map[string]plug) error {
+	for _, item := range trees[0].Items[0].World.Items {
+		key := ""
+		switch i := item.(type) {
+		case *ast.Export:
+			continue
+		case *ast.Import:
+			key = importName(i)
+			if _, ok := plugs[key]; ok {
+				continue
+			}
+		}
+		text, err := worldItemString(item)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			key = text
+		}
+		if previous, ok := w.seen[key]; ok {
+			if previous != text {
+				return fmt.Errorf("import '%s' has conflicting types", key)
+			}
+			continue
+		}
+		w.seen[key] = text
+		w.items = append(w.items, item)
+	}
+	for _, tree := range trees[1:] {
+		decl, _ := tree.PackageDeclaration.Deconstruct()
+		key := versioned(packageName(decl.Namespace, decl.Name), decl.Version)
+		existing, ok := w.packages[key]
+		if !ok {
+			existing = &ast.Ast{PackageDeclaration: tree.PackageDeclaration}
+			w.packages[key] = existing
+			w.order = append(w.order, key)
+		}
+		for _, item := range tree.Items {
+			if item.Interface == nil || hasInterface(existing, item.Interface.Name) {
+				continue
+			}
+			existing.Items = append(existing.Items, item)
+		}
+	}
+	return nil
+}
+
+func hasInterface(tree *ast.Ast, name string) bool {
+	for _, item := range tree.Items {
+		if item.Interface != nil && item.Interface.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importName returns the name an import item is encoded with
+func importName(imp *ast.Import) string {
+	switch et := imp.ExternType.(type) {
+	case *ast.ExternTypeFunc:
+		return et.ID
+	case *ast.ExternTypeInterface:
+		return et.ID
+	case *ast.ExternTypeUsePath:
+		path := et.UsePath
+		if path.Package.Id == nil {
+			return path.Id
+		}
+		decl := path.Package.Id
+		return versioned(packageName(decl.Namespace, decl.Name)+"/"+path.Id, decl.Version)
+	}
+	return ""
+}
+
+func worldItemString(item ast.WorldItem) (string, error) {
+	return printer.String(&ast.Ast{PackageDeclaration: option.None[ast.PackageDeclaration](), Items: []ast.AstItem{{World: &ast.World{Items: []ast.WorldItem{item}}}}})
+}
+
+// composer appends sections to the composition and tracks its index spaces
+type composer struct {
+	component *api.Component
+	counts    map[api.Sort]uint32
+	// imports are the items imported by the composition by name
+	imports map[string]api.InstantiateArg
+	// types are the type definitions added by world
+	types map[uint32]api.DefType
+}
+
+func newComposer() *composer {
+	return &composer{
+		component: &api.Component{},
+		imports:   map[string]api.InstantiateArg{},
+		types:     map[uint32]api.DefType{},
+	}
+}
+
+func (c *composer) add(section api.ComponentSection) {
+	c.component.Sections = append(c.component.Sections, section)
+}
+
+// next returns the index of the item just added to the index space of sort
+func (c *composer) next(sort api.Sort) uint32 {
+	if c.counts == nil {
+		c.counts = map[api.Sort]uint32{}
+	}
+	c.counts[sort]++
+	return c.counts[sort] - 1
+}
+
+// importWorld encodes the collected world and adds its imports to the composition
+func (c *composer) importWorld(w *world) error {
+	if len(w.items) == 0 {
+		return nil
+	}
+	decl, _ := parseQualifiedName(RootPackage + "/" + RootWorld)
+	pkg, err := packageDeclaration(decl)
+	if err != nil {
+		return err
+	}
+	tree := &ast.Ast{
+		PackageDeclaration: option.Some(pkg),
+		Items:              []ast.AstItem{{World: &ast.World{Id: RootWorld, Items: w.items}}},
+	}
+	var deps []*ast.Ast
+	for _, key := range w.order {
+		deps = append(deps, w.packages[key])
+	}
+	encoded, err := Encode(tree, deps...)
+	if err != nil {
+		return err
+	}
+	// the world is encoded as (type (component (type (component <body>)) (export ...)))
+	outer := encoded.Sections[0].(*api.TypeSection).Types[0].(*api.ComponentType)
+	body := outer.Declarations[0].(*api.TypeDeclaration).Type.(*api.ComponentType)
+	return c.world(body, nil)
+}
+
+func externSort(desc api.ExternDesc) (api.Sort, error) {
+	switch desc.(type) {
+	case *api.InstanceExternDesc:
+		return api.InstanceSort, nil
+	case *api.FuncExternDesc:
+		return api.FuncSort, nil
+	case *api.TypeExternDesc:
+		return api.TypeSort, nil
+	case *api.ComponentExternDesc:
+		return api.ComponentSort, nil
+	}
+	return 0, fmt.Errorf("unsupported import description %T", desc)
+}
+
+// args returns the instantiation arguments for the imports of a nested component, plugged imports
+// are passed the dependency instance and the others the import of the composition with the same name
+func (c *composer) args(imps []api.ComponentImport, plugged map[string]uint32) ([]api.InstantiateArg, error) {
+	var args []api.InstantiateArg
+	for _, imp := range imps {
+		if index, ok := plugged[imp.Name]; ok {
+			args = append(args, api.InstantiateArg{Name: imp.Name, Sort: api.InstanceSort, Index: index})
+			continue
+		}
+		arg, ok := c.imports[imp.Name]
+		if !ok {
+			return nil, fmt.Errorf("import '%s' is not imported by the composition", imp.Name)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (c *composer) instantiate(component uint32, args []api.InstantiateArg) uint32 {
+	c.add(&api.InstanceSection{Instances: []api.ComponentInstance{
+		&api.InstantiateInstance{Component: component, Args: args},
+	}})
+	return c.next(api.InstanceSort)
+}
+
+func imports(c *api.Component) []api.ComponentImport {
+	var imps []api.ComponentImport
+	for _, section := range c.Sections {
+		if s, ok := section.(*api.ImportSection); ok {
+			imps = append(imps, s.Imports...)
+		}
+	}
+	return imps
+}
+
+func exportsOf(c *api.Component) []api.ComponentExport {
+	var exports []api.ComponentExport
+	for _, section := range c.Sections {
+		if s, ok := section.(*api.ExportSection); ok {
+			exports = append(exports, s.Exports...)
+		}
+	}
+	return exports
+}
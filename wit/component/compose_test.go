@@ -0,0 +1,179 @@
+package component_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/abi/types"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	engine "github.com/patrickhuber/go-wasm/component"
+	"github.com/patrickhuber/go-wasm/runtime"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+	"github.com/stretchr/testify/require"
+)
+
+// mathInstance is the type of the interface `a:b/math` with the function `double: func(x: u32) -> u32`
+var mathInstance = &api.InstanceType{
+	Declarations: []api.Declaration{
+		&api.TypeDeclaration{Type: &api.ComponentFuncType{Params: []api.LabelValType{{Label: "x", Type: api.U32Type}}, Result: api.U32Type}},
+		&api.ExportDeclaration{Name: "double", Desc: &api.FuncExternDesc{Type: 0}},
+	},
+}
+
+// plugRoot imports math at version and exports its double function as run
+func plugRoot(version string) *api.Component {
+	return &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{mathInstance}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "a:b/math@" + version, Desc: &api.InstanceExternDesc{Type: 0}}}},
+		&api.AliasSection{Aliases: []api.Alias{{Sort: api.FuncSort, Target: &api.ExportAlias{Instance: 0, Name: "double"}}}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "run", Sort: api.FuncSort, Index: 0}}},
+	}}
+}
+
+// plugDep imports the function impl of type ft and exports it as `double` of math at version
+func plugDep(version string, ft *api.ComponentFuncType) *api.Component {
+	return &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{ft}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "impl", Desc: &api.FuncExternDesc{Type: 0}}}},
+		&api.InstanceSection{Instances: []api.ComponentInstance{
+			&api.ExportsInstance{Exports: []api.InlineExport{{Name: "double", Sort: api.FuncSort, Index: 0}}},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "a:b/math@" + version, Sort: api.InstanceSort, Index: 0}}},
+	}}
+}
+
+var doubleType = &api.ComponentFuncType{Params: []api.LabelValType{{Label: "x", Type: api.U32Type}}, Result: api.U32Type}
+
+const expectedPlugWorld = `package root:component;
+
+world root {
+  import impl: func(x: u32) -> u32;
+  export run: func(x: u32) -> u32;
+}
+`
+
+func TestPlug(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		version string
+	}{
+		{"exact", "1.0.0", "1.0.0"},
+		{"compatible", "1.0.0", "1.2.1"},
+		{"pre_1_0", "0.2.0", "0.2.3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			composed, err := component.Plug(plugRoot(test.root), plugDep(test.version, doubleType))
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = binary.Write(&buf, &api.Document{
+				Preamble:  api.Preamble{Version: binary.ComponentVersion, Layer: binary.ComponentLayer},
+				Directive: composed,
+			})
+			require.NoError(t, err)
+			document, err := binary.Read(&buf)
+			require.NoError(t, err)
+			require.Equal(t, composed, document.Directive)
+
+			trees, err := component.Extract(composed)
+			require.NoError(t, err)
+			var builder strings.Builder
+			require.NoError(t, printer.Print(&builder, trees[0], trees[1:]...))
+			require.Equal(t, expectedPlugWorld, builder.String())
+
+			u32 := types.NewU32()
+			impl := engine.NewFunc(
+				types.NewFuncType([]types.Parameter{{Name: "x", Type: u32}}, []types.Parameter{{Type: u32}}),
+				func(ctx context.Context, args ...any) ([]any, error) { return []any{args[0].(uint32) * 2}, nil },
+			)
+			instance, err := engine.Instantiate(&runtime.Store{}, composed, map[string]engine.Extern{"impl": impl})
+			require.NoError(t, err)
+			results, err := instance.Call(context.Background(), "run", uint32(21))
+			require.NoError(t, err)
+			require.Equal(t, []any{uint32(42)}, results)
+		})
+	}
+}
+
+func TestPlugFail(t *testing.T) {
+	stringType := &api.ComponentFuncType{Params: []api.LabelValType{{Label: "x", Type: api.StringType}}, Result: api.U32Type}
+	tests := []struct {
+		name string
+		root *api.Component
+		deps []*api.Component
+	}{
+		{"unused", plugRoot("1.0.0"), []*api.Component{plugDep("2.0.0", doubleType)}},
+		{"older", plugRoot("1.2.0"), []*api.Component{plugDep("1.1.0", doubleType)}},
+		{"minor_pre_1_0", plugRoot("0.1.0"), []*api.Component{plugDep("0.2.0", doubleType)}},
+		{"ambiguous", plugRoot("1.0.0"), []*api.Component{plugDep("1.0.0", doubleType), plugDep("1.0.0", doubleType)}},
+		{"type_mismatch", plugRoot("1.0.0"), []*api.Component{plugDep("1.0.0", stringType)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := component.Plug(test.root, test.deps...)
+			require.Error(t, err)
+		})
+	}
+}
+
+// pointInstance is the type of the interface `a:b/math` with `record point { x: field }`, `type p2 = point`
+// and `norm: func(p: param) -> u32` where param is 1 for point and 2 for p2
+func pointInstance(field api.ComponentValType, param uint32) *api.InstanceType {
+	return &api.InstanceType{
+		Declarations: []api.Declaration{
+			&api.TypeDeclaration{Type: &api.RecordType{Fields: []api.LabelValType{{Label: "x", Type: field}}}},
+			&api.ExportDeclaration{Name: "point", Desc: &api.TypeExternDesc{Bound: &api.EqBound{Type: 0}}},
+			&api.ExportDeclaration{Name: "p2", Desc: &api.TypeExternDesc{Bound: &api.EqBound{Type: 1}}},
+			&api.TypeDeclaration{Type: &api.ComponentFuncType{Params: []api.LabelValType{{Label: "p", Type: api.TypeIndexValType(param)}}, Result: api.U32Type}},
+			&api.ExportDeclaration{Name: "norm", Desc: &api.FuncExternDesc{Type: 3}},
+		},
+	}
+}
+
+// pointRoot imports math with the instance type and exports its norm function as run
+func pointRoot(instance *api.InstanceType) *api.Component {
+	return &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{instance}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "a:b/math@1.0.0", Desc: &api.InstanceExternDesc{Type: 0}}}},
+		&api.AliasSection{Aliases: []api.Alias{{Sort: api.FuncSort, Target: &api.ExportAlias{Instance: 0, Name: "norm"}}}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "run", Sort: api.FuncSort, Index: 0}}},
+	}}
+}
+
+// pointDep imports an instance impl with the instance type and exports it as math
+func pointDep(instance *api.InstanceType) *api.Component {
+	return &api.Component{Sections: []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{instance}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "impl", Desc: &api.InstanceExternDesc{Type: 0}}}},
+		&api.ExportSection{Exports: []api.ComponentExport{{Name: "a:b/math@1.0.0", Sort: api.InstanceSort, Index: 0}}},
+	}}
+}
+
+func TestPlugStructural(t *testing.T) {
+	tests := []struct {
+		name   string
+		root   *api.InstanceType
+		dep    *api.InstanceType
+		errMsg string
+	}{
+		{"alias", pointInstance(api.U32Type, 2), pointInstance(api.U32Type, 1), ""},
+		{"field_type", pointInstance(api.U32Type, 1), pointInstance(api.U64Type, 1), "dependency 0: export 'a:b/math@1.0.0' has a different definition for type 'point' imported by 'a:b/math@1.0.0'"},
+		{"missing", pointInstance(api.U32Type, 1), mathInstance, "dependency 0: export 'a:b/math@1.0.0' does not provide type 'point' imported by 'a:b/math@1.0.0'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := component.Plug(pointRoot(test.root), pointDep(test.dep))
+			if test.errMsg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, test.errMsg)
+		})
+	}
+}
@@ -0,0 +1,777 @@
+package component
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// Decode converts a component produced by Encode back into the wit ast of the package.
+// Interfaces from other packages are referenced by their qualified names.
+func Decode(component *api.Component) (*ast.Ast, error) {
+	exports, err := typeExports(component)
+	if err != nil {
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return nil, fmt.Errorf("component does not export any wit interfaces or worlds")
+	}
+
+	d := &decoder{}
+	tree := &ast.Ast{}
+	for i, export := range exports {
+		last, ok := lastExport(export.ty)
+		if !ok {
+			return nil, fmt.Errorf("export '%s' is not a wit interface or world", export.name)
+		}
+		q, ok := parseQualifiedName(last.Name)
+		if !ok {
+			return nil, fmt.Errorf("export '%s' has invalid qualified name '%s'", export.name, last.Name)
+		}
+		decl, err := packageDeclaration(q)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			d.pkg = decl
+			tree.PackageDeclaration = option.Some(decl)
+		} else if versioned(packageName(decl.Namespace, decl.Name), decl.Version) != d.key() {
+			return nil, fmt.Errorf("export '%s' belongs to a different package than '%s'", last.Name, d.key())
+		}
+
+		switch last.Desc.(type) {
+		case *api.InstanceExternDesc:
+			entries, _, err := d.component(nil, export.ty)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", export.name, err)
+			}
+			entry := entries[len(entries)-1]
+			tree.Items = append(tree.Items, ast.AstItem{
+				Interface: &ast.Interface{
+					Name:  q.name,
+					Items: entry.items,
+				},
+			})
+		case *api.ComponentExternDesc:
+			world, err := d.world(q.name, export.ty)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", export.name, err)
+			}
+			tree.Items = append(tree.Items, ast.AstItem{World: world})
+		default:
+			return nil, fmt.Errorf("export '%s' is not a wit interface or world", export.name)
+		}
+	}
+	return tree, nil
+}
+
+type typeExport struct {
+	name string
+	ty   *api.ComponentType
+}
+
+// typeExports returns the component types exported by the component
+func typeExports(component *api.Component) ([]typeExport, error) {
+	var types []api.DefType
+	var exports []typeExport
+	for _, section := range component.Sections {
+		switch s := section.(type) {
+		case *api.TypeSection:
+			types = append(types, s.Types...)
+		case *api.ExportSection:
+			for _, export := range s.Exports {
+				if export.Sort != api.TypeSort {
+					continue
+				}
+				if int(export.Index) >= len(types) {
+					return nil, fmt.Errorf("export '%s' type index %d out of range", export.Name, export.Index)
+				}
+				ty := types[export.Index]
+				// exports add to the type index space
+				types = append(types, ty)
+				componentType, ok := ty.(*api.ComponentType)
+				if !ok {
+					return nil, fmt.Errorf("export '%s' is not a component type", export.Name)
+				}
+				exports = append(exports, typeExport{name: export.Name, ty: componentType})
+			}
+		case *api.ImportSection:
+			for _, imp := range s.Imports {
+				if _, ok := imp.Desc.(*api.TypeExternDesc); ok {
+					types = append(types, nil)
+				}
+			}
+		case *api.AliasSection:
+			for _, alias := range s.Aliases {
+				if alias.Sort == api.TypeSort {
+					types = append(types, nil)
+				}
+			}
+		}
+	}
+	return exports, nil
+}
+
+func lastExport(ty *api.ComponentType) (*api.ExportDeclaration, bool) {
+	if len(ty.Declarations) == 0 {
+		return nil, false
+	}
+	export, ok := ty.Declarations[len(ty.Declarations)-1].(*api.ExportDeclaration)
+	return export, ok
+}
+
+func packageDeclaration(q qualifiedName) (ast.PackageDeclaration, error) {
+	decl := ast.PackageDeclaration{
+		Namespace: q.namespace,
+		Name:      q.pkg,
+		Version:   option.None[ast.Version](),
+	}
+	if q.version != "" {
+		version, err := ast.ParseVersion(q.version)
+		if err != nil {
+			return decl, err
+		}
+		decl.Version = option.Some(version)
+	}
+	return decl, nil
+}
+
+type decoder struct {
+	pkg ast.PackageDeclaration
+}
+
+func (d *decoder) key() string {
+	return versioned(packageName(d.pkg.Namespace, d.pkg.Name), d.pkg.Version)
+}
+
+// dtype is an entry in a decoded type index space
+type dtype struct {
+	// def is set for type definitions
+	def api.DefType
+	// scope is the scope the definition was declared in
+	scope *dscope
+	// name is set for named types, the name is local to the instance or component that declares it
+	name string
+	// owner is the name of the imported instance that exports the type
+	owner    string
+	resource bool
+}
+
+// in returns the scope used to decode the definition, which defaults to s for types without a recorded scope
+func (t *dtype) in(s *dscope) *dscope {
+	if t.scope != nil {
+		return t.scope
+	}
+	return s
+}
+
+// dfunc is an entry in a decoded function index space
+type dfunc struct {
+	scope *dscope
+	ty    *api.ComponentFuncType
+}
+
+type dinstance struct {
+	name    string
+	exports map[string]*dtype
+	funcs   map[string]*dfunc
+	// instances are the exported instances of an instantiated component, they are not part of its interface
+	instances map[string]*dinstance
+	// names is the order of the exports
+	names []string
+}
+
+type dscope struct {
+	parent     *dscope
+	types      []*dtype
+	funcs      []*dfunc
+	instances  []*dinstance
+	components []*dcomponent
+}
+
+func (s *dscope) define(def api.DefType) {
+	_, resource := def.(*api.ResourceType)
+	s.types = append(s.types, &dtype{def: def, scope: s, resource: resource})
+}
+
+func (s *dscope) typeAt(index uint32) (*dtype, error) {
+	if int(index) >= len(s.types) {
+		return nil, fmt.Errorf("type index %d out of range", index)
+	}
+	return s.types[index], nil
+}
+
+func (s *dscope) alias(alias api.Alias) (*dtype, error) {
+	if alias.Sort != api.TypeSort {
+		return nil, fmt.Errorf("unsupported alias sort %d", alias.Sort)
+	}
+	switch target := alias.Target.(type) {
+	case *api.OuterAlias:
+		outer := s
+		for i := uint32(0); i < target.Count; i++ {
+			if outer.parent == nil {
+				return nil, fmt.Errorf("outer alias count %d out of range", target.Count)
+			}
+			outer = outer.parent
+		}
+		return outer.typeAt(target.Index)
+	case *api.ExportAlias:
+		if int(target.Instance) >= len(s.instances) {
+			return nil, fmt.Errorf("instance index %d out of range", target.Instance)
+		}
+		instance := s.instances[target.Instance]
+		t, ok := instance.exports[target.Name]
+		if !ok {
+			return nil, fmt.Errorf("instance '%s' does not export '%s'", instance.name, target.Name)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported alias target %T", alias.Target)
+}
+
+// entry is an import or export of a component type
+type entry struct {
+	imp   bool
+	name  string
+	item  ast.WorldItem
+	items []ast.InterfaceItem
+	// typeItem is the position of a world level type in the type items
+	typeItem int
+}
+
+// component decodes the declarations of a component type into imports and exports.
+// World level types are returned separately because resource functions are added to them after they are declared.
+func (d *decoder) component(parent *dscope, ty *api.ComponentType) ([]entry, []ast.InterfaceItem, error) {
+	s := &dscope{parent: parent}
+	var entries []entry
+	typeItems := itemList{d: d}
+	for _, declaration := range ty.Declarations {
+		switch decl := declaration.(type) {
+		case *api.TypeDeclaration:
+			s.define(decl.Type)
+		case *api.AliasDeclaration:
+			t, err := s.alias(decl.Alias)
+			if err != nil {
+				return nil, nil, err
+			}
+			s.types = append(s.types, t)
+		case *api.ImportDeclaration, *api.ExportDeclaration:
+			imp, name, desc := externDeclaration(decl)
+			count := len(typeItems.items)
+			e, err := d.extern(s, imp, name, desc, &typeItems)
+			if err != nil {
+				return nil, nil, err
+			}
+			if e != nil {
+				entries = append(entries, *e)
+			}
+			for i := count; i < len(typeItems.items); i++ {
+				entries = append(entries, entry{imp: imp, typeItem: i + 1})
+			}
+		}
+	}
+	return entries, typeItems.items, nil
+}
+
+func externDeclaration(declaration api.Declaration) (bool, string, api.ExternDesc) {
+	switch decl := declaration.(type) {
+	case *api.ImportDeclaration:
+		return true, decl.Name, decl.Desc
+	case *api.ExportDeclaration:
+		return false, decl.Name, decl.Desc
+	}
+	return false, "", nil
+}
+
+func (d *decoder) extern(s *dscope, imp bool, name string, desc api.ExternDesc, typeItems *itemList) (*entry, error) {
+	switch ed := desc.(type) {
+	case *api.InstanceExternDesc:
+		t, err := s.typeAt(ed.Type)
+		if err != nil {
+			return nil, err
+		}
+		instanceType, ok := t.def.(*api.InstanceType)
+		if !ok {
+			return nil, fmt.Errorf("'%s' does not refer to an instance type", name)
+		}
+		items, instance, err := d.instance(s, instanceType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if imp {
+			instance.own(name)
+			s.instances = append(s.instances, instance)
+		}
+		var externType ast.ExternType
+		if _, ok := parseQualifiedName(name); ok {
+			externType = &ast.ExternTypeUsePath{UsePath: d.usePath(name)}
+		} else {
+			externType = &ast.ExternTypeInterface{ID: name, InterfaceItems: items}
+		}
+		return &entry{imp: imp, name: name, item: worldItem(imp, externType), items: items}, nil
+	case *api.FuncExternDesc:
+		f, err := s.funcAt(ed.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		s.funcs = append(s.funcs, f)
+		if strings.HasPrefix(name, "[") {
+			// resource functions are part of the world level resource
+			return nil, typeItems.function(name, f)
+		}
+		funcType, err := d.funcType(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		externType := &ast.ExternTypeFunc{ID: name, Func: funcType}
+		return &entry{imp: imp, name: name, item: worldItem(imp, externType)}, nil
+	case *api.TypeExternDesc:
+		return nil, typeItems.namedType(s, name, ed)
+	}
+	return nil, fmt.Errorf("unsupported extern desc %T for '%s'", desc, name)
+}
+
+func worldItem(imp bool, externType ast.ExternType) ast.WorldItem {
+	if imp {
+		return &ast.Import{ExternType: externType}
+	}
+	return &ast.Export{ExternType: externType}
+}
+
+// funcAt returns the function type at index as an entry in the function index space
+func (s *dscope) funcAt(index uint32) (*dfunc, error) {
+	t, err := s.typeAt(index)
+	if err != nil {
+		return nil, err
+	}
+	ft, ok := t.def.(*api.ComponentFuncType)
+	if !ok {
+		return nil, fmt.Errorf("type index %d is not a function type", index)
+	}
+	return &dfunc{scope: t.in(s), ty: ft}, nil
+}
+
+// own marks the types exported by the instance as owned by the interface name unless they are owned by another interface
+func (i *dinstance) own(name string) {
+	i.name = name
+	for _, export := range i.exports {
+		if export.owner == "" {
+			export.owner = name
+		}
+	}
+}
+
+// instance decodes an instance type into interface items and its exports
+func (d *decoder) instance(parent *dscope, ty *api.InstanceType) ([]ast.InterfaceItem, *dinstance, error) {
+	s := &dscope{parent: parent}
+	list := &itemList{d: d}
+	instance := &dinstance{exports: map[string]*dtype{}, funcs: map[string]*dfunc{}}
+	for _, declaration := range ty.Declarations {
+		switch decl := declaration.(type) {
+		case *api.TypeDeclaration:
+			s.define(decl.Type)
+		case *api.AliasDeclaration:
+			t, err := s.alias(decl.Alias)
+			if err != nil {
+				return nil, nil, err
+			}
+			s.types = append(s.types, t)
+		case *api.ExportDeclaration:
+			switch desc := decl.Desc.(type) {
+			case *api.TypeExternDesc:
+				if err := list.namedType(s, decl.Name, desc); err != nil {
+					return nil, nil, err
+				}
+				instance.exports[decl.Name] = s.types[len(s.types)-1]
+			case *api.FuncExternDesc:
+				f, err := s.funcAt(desc.Type)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: %w", decl.Name, err)
+				}
+				if err := list.function(decl.Name, f); err != nil {
+					return nil, nil, err
+				}
+				instance.funcs[decl.Name] = f
+			default:
+				return nil, nil, fmt.Errorf("unsupported instance export %T for '%s'", decl.Desc, decl.Name)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unsupported instance declaration %T", declaration)
+		}
+		if decl, ok := declaration.(*api.ExportDeclaration); ok {
+			instance.names = append(instance.names, decl.Name)
+		}
+	}
+	return list.items, instance, nil
+}
+
+// itemList accumulates the items of an interface or the types and resource functions of a world
+type itemList struct {
+	d         *decoder
+	items     []ast.InterfaceItem
+	resources map[string]int
+	// owners tracks the interface each use item refers to
+	owners map[*ast.Use]string
+}
+
+func (l *itemList) namedType(s *dscope, name string, desc *api.TypeExternDesc) error {
+	if l.resources == nil {
+		l.resources = map[string]int{}
+	}
+	switch bound := desc.Bound.(type) {
+	case *api.SubResourceBound:
+		s.types = append(s.types, &dtype{name: name, resource: true})
+		l.resources[name] = len(l.items)
+		l.items = append(l.items, ast.Resource{ID: name})
+		return nil
+	case *api.EqBound:
+		target, err := s.typeAt(bound.Type)
+		if err != nil {
+			return err
+		}
+		s.types = append(s.types, &dtype{name: name, resource: target.resource})
+		return l.export(s, name, target)
+	}
+	return fmt.Errorf("unsupported type bound %T", desc.Bound)
+}
+
+// export adds the item for a type exported with name that is equal to target
+func (l *itemList) export(s *dscope, name string, target *dtype) error {
+	if l.resources == nil {
+		l.resources = map[string]int{}
+	}
+
+	// types from other interfaces are brought into scope with use
+	if target.owner != "" {
+		l.use(target.owner, target.name, name)
+		return nil
+	}
+
+	// aliases of named types in the same interface
+	if target.name != "" {
+		l.items = append(l.items, &ast.TypeItem{ID: name, Type: &ast.Id{Value: target.name}})
+		return nil
+	}
+
+	// later references to the definition use the exported name
+	target.name = name
+	if target.resource {
+		l.resources[name] = len(l.items)
+		l.items = append(l.items, ast.Resource{ID: name})
+		return nil
+	}
+
+	item, err := l.d.typeDef(target.in(s), name, target.def)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	l.items = append(l.items, item)
+	return nil
+}
+
+func (l *itemList) use(owner, name, as string) {
+	useName := ast.UseName{Name: name, As: option.None[string]()}
+	if as != name {
+		useName.As = option.Some(as)
+	}
+	// consecutive uses of the same interface are merged
+	if len(l.items) > 0 {
+		if previous, ok := l.items[len(l.items)-1].(*ast.Use); ok && l.owners[previous] == owner {
+			previous.Names = append(previous.Names, useName)
+			return
+		}
+	}
+	if l.owners == nil {
+		l.owners = map[*ast.Use]string{}
+	}
+	use := &ast.Use{From: l.d.usePath(owner), Names: []ast.UseName{useName}}
+	l.owners[use] = owner
+	l.items = append(l.items, use)
+}
+
+func (l *itemList) function(name string, f *dfunc) error {
+	funcType, err := l.d.funcType(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	kind, rest, ok := strings.Cut(strings.TrimPrefix(name, "["), "]")
+	if !strings.HasPrefix(name, "[") || !ok {
+		l.items = append(l.items, &ast.FuncItem{ID: name, FuncType: funcType})
+		return nil
+	}
+
+	resourceName, method, _ := strings.Cut(rest, ".")
+	position, ok := l.resources[resourceName]
+	if !ok {
+		return fmt.Errorf("%s: resource '%s' not found", name, resourceName)
+	}
+	resource := l.items[position].(ast.Resource)
+	switch kind {
+	case "constructor":
+		resource.Methods = append(resource.Methods, &ast.Constructor{ParameterList: funcType.Params})
+	case "method":
+		if len(funcType.Params) == 0 {
+			return fmt.Errorf("%s: method is missing self parameter", name)
+		}
+		funcType.Params = funcType.Params[1:]
+		if len(funcType.Params) == 0 {
+			funcType.Params = nil
+		}
+		resource.Methods = append(resource.Methods, ast.Method{Func: &ast.FuncItem{ID: method, FuncType: funcType}})
+	case "static":
+		resource.Methods = append(resource.Methods, ast.Static{ID: method, FuncType: funcType})
+	default:
+		return fmt.Errorf("%s: unrecognized function kind '%s'", name, kind)
+	}
+	l.items[position] = resource
+	return nil
+}
+
+// usePath converts a qualified interface name into a use path relative to the decoded package
+func (d *decoder) usePath(name string) *ast.UsePath {
+	q, ok := parseQualifiedName(name)
+	if !ok {
+		return &ast.UsePath{Id: name}
+	}
+	decl, err := packageDeclaration(q)
+	if err == nil && versioned(packageName(decl.Namespace, decl.Name), decl.Version) == d.key() {
+		return &ast.UsePath{Id: q.name}
+	}
+	path := &ast.UsePath{Id: q.name}
+	path.Package.Id = &decl
+	path.Package.Name = q.name
+	return path
+}
+
+// world decodes the component type of a world
+func (d *decoder) world(name string, ty *api.ComponentType) (*ast.World, error) {
+	if len(ty.Declarations) != 2 {
+		return nil, fmt.Errorf("expected a world component type and export")
+	}
+	decl, ok := ty.Declarations[0].(*api.TypeDeclaration)
+	if !ok {
+		return nil, fmt.Errorf("expected a world component type")
+	}
+	body, ok := decl.Type.(*api.ComponentType)
+	if !ok {
+		return nil, fmt.Errorf("expected a world component type")
+	}
+	entries, typeItems, err := d.component(nil, body)
+	if err != nil {
+		return nil, err
+	}
+	world := &ast.World{Id: name}
+	for _, e := range entries {
+		if e.item != nil {
+			world.Items = append(world.Items, e.item)
+			continue
+		}
+		worldItem, ok := typeItems[e.typeItem-1].(ast.WorldItem)
+		if !ok {
+			return nil, fmt.Errorf("unexpected world item %T", typeItems[e.typeItem-1])
+		}
+		world.Items = append(world.Items, worldItem)
+	}
+	return world, nil
+}
+
+func (d *decoder) typeDef(s *dscope, name string, def api.DefType) (ast.InterfaceItem, error) {
+	switch t := def.(type) {
+	case *api.RecordType:
+		record := &ast.Record{ID: name}
+		for _, field := range t.Fields {
+			ty, err := d.valType(s, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			record.Fields = append(record.Fields, ast.Field{Name: field.Label, Type: ty})
+		}
+		return record, nil
+	case *api.VariantType:
+		variant := &ast.Variant{ID: name}
+		for _, c := range t.Cases {
+			astCase := ast.Case{Name: c.Label, Type: option.None[ast.Type]()}
+			if c.Type != nil {
+				ty, err := d.valType(s, c.Type)
+				if err != nil {
+					return nil, err
+				}
+				astCase.Type = option.Some(ty)
+			}
+			variant.Cases = append(variant.Cases, astCase)
+		}
+		return variant, nil
+	case *api.EnumType:
+		enum := &ast.Enum{ID: name}
+		for _, label := range t.Labels {
+			enum.Cases = append(enum.Cases, ast.EnumCase{Name: label})
+		}
+		return enum, nil
+	case *api.FlagsType:
+		flags := &ast.Flags{ID: name}
+		for _, label := range t.Labels {
+			flags.Flags = append(flags.Flags, ast.Flag{Id: label})
+		}
+		return flags, nil
+	}
+	ty, err := d.defValType(s, def)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.TypeItem{ID: name, Type: ty}, nil
+}
+
+func (d *decoder) funcType(f *dfunc) (*ast.FuncType, error) {
+	s, ft := f.scope, f.ty
+	var err error
+	funcType := &ast.FuncType{Results: &ast.ResultList{}}
+	for _, param := range ft.Params {
+		ty, err := d.valType(s, param.Type)
+		if err != nil {
+			return nil, err
+		}
+		funcType.Params = append(funcType.Params, ast.Parameter{Id: param.Label, Type: ty})
+	}
+	if ft.Result != nil {
+		funcType.Results.Anonymous, err = d.valType(s, ft.Result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, result := range ft.NamedResults {
+		ty, err := d.valType(s, result.Type)
+		if err != nil {
+			return nil, err
+		}
+		funcType.Results.Named = append(funcType.Results.Named, ast.Parameter{Id: result.Label, Type: ty})
+	}
+	return funcType, nil
+}
+
+func (d *decoder) valType(s *dscope, valType api.ComponentValType) (ast.Type, error) {
+	switch t := valType.(type) {
+	case api.PrimValType:
+		return primType(t)
+	case api.TypeIndexValType:
+		entry, err := s.typeAt(uint32(t))
+		if err != nil {
+			return nil, err
+		}
+		if entry.name != "" {
+			return &ast.Id{Value: entry.name}, nil
+		}
+		return d.defValType(entry.in(s), entry.def)
+	}
+	return nil, fmt.Errorf("unsupported value type %T", valType)
+}
+
+func (d *decoder) optionalValType(s *dscope, valType api.ComponentValType) (types.Option[ast.Type], error) {
+	if valType == nil {
+		return option.None[ast.Type](), nil
+	}
+	ty, err := d.valType(s, valType)
+	if err != nil {
+		return nil, err
+	}
+	return option.Some(ty), nil
+}
+
+func (d *decoder) defValType(s *dscope, def api.DefType) (ast.Type, error) {
+	switch t := def.(type) {
+	case api.PrimValType:
+		return primType(t)
+	case *api.ListType:
+		element, err := d.valType(s, t.Element)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.List{ItemType: element}, nil
+	case *api.OptionType:
+		item, err := d.valType(s, t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Option{ItemType: item}, nil
+	case *api.TupleType:
+		tuple := &ast.Tuple{}
+		for _, valType := range t.Types {
+			ty, err := d.valType(s, valType)
+			if err != nil {
+				return nil, err
+			}
+			tuple.Types = append(tuple.Types, ty)
+		}
+		return tuple, nil
+	case *api.ResultValType:
+		ok, err := d.optionalValType(s, t.Ok)
+		if err != nil {
+			return nil, err
+		}
+		e, err := d.optionalValType(s, t.Error)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Result{Ok: ok, Error: e}, nil
+	case *api.StreamType:
+		element, err := d.optionalValType(s, t.Element)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Stream{Element: element, End: option.None[ast.Type]()}, nil
+	case *api.FutureType:
+		item, err := d.optionalValType(s, t.Element)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Future{ItemType: item}, nil
+	case *api.OwnType:
+		resource, err := s.typeAt(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Id{Value: resource.name}, nil
+	case *api.BorrowType:
+		resource, err := s.typeAt(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Borrow{Id: resource.name}, nil
+	}
+	return nil, fmt.Errorf("unsupported type definition %T", def)
+}
+
+func primType(t api.PrimValType) (ast.Type, error) {
+	switch t {
+	case api.BoolType:
+		return &ast.Bool{}, nil
+	case api.S8Type:
+		return &ast.S8{}, nil
+	case api.U8Type:
+		return &ast.U8{}, nil
+	case api.S16Type:
+		return &ast.S16{}, nil
+	case api.U16Type:
+		return &ast.U16{}, nil
+	case api.S32Type:
+		return &ast.S32{}, nil
+	case api.U32Type:
+		return &ast.U32{}, nil
+	case api.S64Type:
+		return &ast.S64{}, nil
+	case api.U64Type:
+		return &ast.U64{}, nil
+	case api.Float32Type:
+		return &ast.Float32{}, nil
+	case api.Float64Type:
+		return &ast.Float64{}, nil
+	case api.CharType:
+		return &ast.Char{}, nil
+	case api.StringType:
+		return &ast.String{}, nil
+	}
+	return nil, fmt.Errorf("unsupported primitive type %d", t)
+}
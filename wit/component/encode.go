@@ -0,0 +1,1197 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// Encode converts a wit package into a component that exports one component type per interface and world.
+// Interfaces from other packages that are referenced by `use` or world imports are resolved from deps.
+//
+// Each interface is encoded as
+//
+//	(type (component
+//	  (import "ns:dep/i" (instance ...)) ;; dependencies
+//	  (type (instance ...))
+//	  (export "ns:pkg/name" (instance (type N)))))
+//	(export "name" (type M))
+//
+// and each world as
+//
+//	(type (component
+//	  (type (component ...)) ;; the world imports and exports
+//	  (export "ns:pkg/name" (component (type 0)))))
+//	(export "name" (type M))
+//
+// Feature gates are not encoded, use the resolve package to filter the package before encoding.
+func Encode(tree *ast.Ast, deps ...*ast.Ast) (*api.Component, error) {
+	e, err := newEncoder(tree, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	component := &api.Component{}
+	var index uint32
+	for _, item := range tree.Items {
+		var ty *api.ComponentType
+		var name string
+		switch {
+		case item.Interface != nil:
+			name = item.Interface.Name
+			ty, err = e.interfaceType(e.iface(e.main, item.Interface))
+		case item.World != nil:
+			name = item.World.Id
+			ty, err = e.worldType(item.World)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		component.Sections = append(component.Sections,
+			&api.TypeSection{
+				Types: []api.DefType{ty},
+			},
+			&api.ExportSection{
+				Exports: []api.ComponentExport{
+					{Name: name, Sort: api.TypeSort, Index: index},
+				},
+			})
+		// both the type definition and the type export add to the type index space
+		index += 2
+	}
+	return component, nil
+}
+
+type encoder struct {
+	main   *pkg
+	deps   map[string]*pkg
+	ifaces map[string]*iface
+}
+
+func newEncoder(tree *ast.Ast, deps []*ast.Ast) (*encoder, error) {
+	main, err := newPkg(tree)
+	if err != nil {
+		return nil, err
+	}
+	e := &encoder{
+		main:   main,
+		deps:   map[string]*pkg{main.key(): main},
+		ifaces: map[string]*iface{},
+	}
+	for _, dep := range deps {
+		p, err := newPkg(dep)
+		if err != nil {
+			return nil, err
+		}
+		e.deps[p.key()] = p
+	}
+	return e, nil
+}
+
+// iface is an interface with its type names resolved
+type iface struct {
+	// key is the import and export name of the interface
+	key   string
+	pkg   *pkg
+	items []ast.InterfaceItem
+	types map[string]typeDecl
+	// resolved is true once the types have been populated from the items
+	resolved bool
+}
+
+// typeDecl is either a type definition or a type brought into scope with `use`
+type typeDecl struct {
+	def  ast.TypeDef
+	from *iface
+	name string
+}
+
+func (e *encoder) iface(p *pkg, i *ast.Interface) *iface {
+	key := p.qualify(i.Name)
+	if existing, ok := e.ifaces[key]; ok {
+		return existing
+	}
+	resolved := &iface{
+		key:   key,
+		pkg:   p,
+		items: i.Items,
+		types: map[string]typeDecl{},
+	}
+	// register before resolving uses so cycles terminate
+	e.ifaces[key] = resolved
+	return resolved
+}
+
+// inline creates an interface that is not part of the package index, for example `import x: interface { ... }`
+func (e *encoder) inline(key string, items []ast.InterfaceItem) *iface {
+	return &iface{
+		key:   key,
+		pkg:   e.main,
+		items: items,
+		types: map[string]typeDecl{},
+	}
+}
+
+// resolveTypes populates the type names of the interface from its items
+func (e *encoder) resolveTypes(i *iface, items []any) error {
+	for _, item := range items {
+		switch it := item.(type) {
+		case *ast.Use:
+			from, err := e.resolvePath(i.pkg, it.From)
+			if err != nil {
+				return err
+			}
+			for _, name := range it.Names {
+				as := localName(name)
+				if err := i.declare(as, typeDecl{from: from, name: name.Name}); err != nil {
+					return err
+				}
+			}
+		case ast.Resource:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		case *ast.Record:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		case *ast.Variant:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		case *ast.Enum:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		case *ast.Flags:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		case *ast.TypeItem:
+			if err := i.declare(it.ID, typeDecl{def: it}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *iface) declare(name string, decl typeDecl) error {
+	if _, ok := i.types[name]; ok {
+		return fmt.Errorf("type '%s' is defined more than once", name)
+	}
+	i.types[name] = decl
+	return nil
+}
+
+// typesOf resolves the type names of the interface on first use
+func (e *encoder) typesOf(i *iface) (map[string]typeDecl, error) {
+	if i.resolved {
+		return i.types, nil
+	}
+	i.resolved = true
+	items := make([]any, 0, len(i.items))
+	for _, item := range i.items {
+		items = append(items, item)
+	}
+	return i.types, e.resolveTypes(i, items)
+}
+
+// localName returns the name a use item brings into scope
+func localName(name ast.UseName) string {
+	if as, ok := name.As.Deconstruct(); ok {
+		return as
+	}
+	return name.Name
+}
+
+func (e *encoder) resolvePath(from *pkg, path *ast.UsePath) (*iface, error) {
+	p := from
+	name := path.Id
+	if path.Package.Id != nil {
+		decl := path.Package.Id
+		key := versioned(packageName(decl.Namespace, decl.Name), decl.Version)
+		dep, ok := e.deps[key]
+		if !ok {
+			return nil, fmt.Errorf("package '%s' not found", key)
+		}
+		p = dep
+		name = path.Package.Name
+	}
+	i, ok := p.interfaces[name]
+	if !ok {
+		return nil, fmt.Errorf("interface '%s' not found in package '%s'", name, p.key())
+	}
+	return e.iface(p, i), nil
+}
+
+func (e *encoder) resolveWorld(from *pkg, path *ast.UsePath) (*pkg, *ast.World, error) {
+	p := from
+	name := path.Id
+	if path.Package.Id != nil {
+		decl := path.Package.Id
+		key := versioned(packageName(decl.Namespace, decl.Name), decl.Version)
+		dep, ok := e.deps[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("package '%s' not found", key)
+		}
+		p = dep
+		name = path.Package.Name
+	}
+	w, ok := p.worlds[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("world '%s' not found in package '%s'", name, p.key())
+	}
+	return p, w, nil
+}
+
+// origin follows uses until the type definition is found and returns the interface that defines it
+func (e *encoder) origin(i *iface, name string) (*iface, ast.TypeDef, error) {
+	seen := map[string]bool{}
+	for {
+		key := i.key + "." + name
+		if seen[key] {
+			return nil, nil, fmt.Errorf("cycle in use of type '%s'", name)
+		}
+		seen[key] = true
+
+		types, err := e.typesOf(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		decl, ok := types[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("type '%s' not found in interface '%s'", name, i.key)
+		}
+		if decl.from == nil {
+			return i, decl.def, nil
+		}
+		i, name = decl.from, decl.name
+	}
+}
+
+type typeRef struct {
+	iface *iface
+	name  string
+}
+
+// typeDeps returns the types a named type refers to
+func (e *encoder) typeDeps(i *iface, name string) ([]typeRef, error) {
+	types, err := e.typesOf(i)
+	if err != nil {
+		return nil, err
+	}
+	decl, ok := types[name]
+	if !ok {
+		return nil, fmt.Errorf("type '%s' not found in interface '%s'", name, i.key)
+	}
+	if decl.from != nil {
+		return []typeRef{{iface: decl.from, name: decl.name}}, nil
+	}
+	var names []string
+	switch d := decl.def.(type) {
+	case *ast.Record:
+		for _, field := range d.Fields {
+			names = referencedNames(field.Type, names)
+		}
+	case *ast.Variant:
+		for _, c := range d.Cases {
+			if t, ok := c.Type.Deconstruct(); ok {
+				names = referencedNames(t, names)
+			}
+		}
+	case *ast.TypeItem:
+		names = referencedNames(d.Type, names)
+	}
+	var refs []typeRef
+	for _, n := range names {
+		refs = append(refs, typeRef{iface: i, name: n})
+	}
+	return refs, nil
+}
+
+func referencedNames(t ast.Type, names []string) []string {
+	switch ty := t.(type) {
+	case *ast.Id:
+		return append(names, ty.Value)
+	case *ast.Own:
+		return append(names, ty.Id)
+	case *ast.Borrow:
+		return append(names, ty.Id)
+	case *ast.List:
+		return referencedNames(ty.ItemType, names)
+	case *ast.Option:
+		return referencedNames(ty.ItemType, names)
+	case *ast.Tuple:
+		for _, t := range ty.Types {
+			names = referencedNames(t, names)
+		}
+	case *ast.Result:
+		if ok, exists := ty.Ok.Deconstruct(); exists {
+			names = referencedNames(ok, names)
+		}
+		if err, exists := ty.Error.Deconstruct(); exists {
+			names = referencedNames(err, names)
+		}
+	case *ast.Stream:
+		if element, exists := ty.Element.Deconstruct(); exists {
+			names = referencedNames(element, names)
+		}
+	case *ast.Future:
+		if item, exists := ty.ItemType.Deconstruct(); exists {
+			names = referencedNames(item, names)
+		}
+	}
+	return names
+}
+
+// needs tracks the interfaces, and the types within them, that must be imported into a scope
+type needs struct {
+	e     *encoder
+	seen  map[string]bool
+	order []*iface
+	names map[*iface][]string
+	full  map[*iface]bool
+	edges map[*iface][]*iface
+}
+
+func newNeeds(e *encoder) *needs {
+	return &needs{
+		e:     e,
+		seen:  map[string]bool{},
+		names: map[*iface][]string{},
+		full:  map[*iface]bool{},
+		edges: map[*iface][]*iface{},
+	}
+}
+
+func (n *needs) include(i *iface) {
+	if _, ok := n.names[i]; ok {
+		return
+	}
+	n.names[i] = nil
+	n.order = append(n.order, i)
+}
+
+// add requires the type and everything it refers to
+func (n *needs) add(i *iface, name string) error {
+	key := i.key + "." + name
+	if n.seen[key] {
+		return nil
+	}
+	n.seen[key] = true
+	n.include(i)
+
+	deps, err := n.e.typeDeps(i, name)
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		if dep.iface != i {
+			n.edges[i] = append(n.edges[i], dep.iface)
+		}
+		if err := n.add(dep.iface, dep.name); err != nil {
+			return err
+		}
+	}
+	n.names[i] = append(n.names[i], name)
+	return nil
+}
+
+// addUses requires the types brought into scope by the use items
+func (n *needs) addUses(i *iface) error {
+	types, err := n.e.typesOf(i)
+	if err != nil {
+		return err
+	}
+	for _, item := range i.items {
+		use, ok := item.(*ast.Use)
+		if !ok {
+			continue
+		}
+		for _, name := range use.Names {
+			decl := types[localName(name)]
+			if err := n.add(decl.from, decl.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addFull requires the entire interface
+func (n *needs) addFull(i *iface) error {
+	n.include(i)
+	n.full[i] = true
+	types, err := n.e.typesOf(i)
+	if err != nil {
+		return err
+	}
+	for name := range types {
+		if err := n.add(i, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the interfaces with dependencies first
+func (n *needs) sorted() ([]*iface, error) {
+	var sorted []*iface
+	state := map[*iface]int{}
+	var visit func(i *iface) error
+	visit = func(i *iface) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("cycle in interface dependencies at '%s'", i.key)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, dep := range n.edges[i] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		sorted = append(sorted, i)
+		return nil
+	}
+	for _, i := range n.order {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// scope is a component or instance type under construction along with its index spaces
+type scope struct {
+	parent        *scope
+	declarations  []api.Declaration
+	typeCount     uint32
+	instances     map[string]uint32
+	instanceCount uint32
+	types         map[string]uint32
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		parent:    parent,
+		instances: map[string]uint32{},
+		types:     map[string]uint32{},
+	}
+}
+
+func (s *scope) defType(t api.DefType) uint32 {
+	s.declarations = append(s.declarations, &api.TypeDeclaration{Type: t})
+	return s.nextType()
+}
+
+func (s *scope) nextType() uint32 {
+	index := s.typeCount
+	s.typeCount++
+	return index
+}
+
+func (s *scope) declare(imp bool, name string, desc api.ExternDesc) {
+	if imp {
+		s.declarations = append(s.declarations, &api.ImportDeclaration{Name: name, Desc: desc})
+	} else {
+		s.declarations = append(s.declarations, &api.ExportDeclaration{Name: name, Desc: desc})
+	}
+}
+
+// lookup finds the type exported by an interface in this or an enclosing scope, adding aliases as needed
+func (s *scope) lookup(i *iface, name string) (uint32, bool) {
+	key := i.key + "." + name
+	if index, ok := s.types[key]; ok {
+		return index, true
+	}
+	if instance, ok := s.instances[i.key]; ok {
+		s.declarations = append(s.declarations, &api.AliasDeclaration{
+			Alias: api.Alias{
+				Sort:   api.TypeSort,
+				Target: &api.ExportAlias{Instance: instance, Name: name},
+			},
+		})
+		index := s.nextType()
+		s.types[key] = index
+		return index, true
+	}
+	var count uint32
+	for p := s.parent; p != nil; p = p.parent {
+		count++
+		outer, ok := p.lookup(i, name)
+		if !ok {
+			continue
+		}
+		s.declarations = append(s.declarations, &api.AliasDeclaration{
+			Alias: api.Alias{
+				Sort:   api.TypeSort,
+				Target: &api.OuterAlias{Count: count, Index: outer},
+			},
+		})
+		index := s.nextType()
+		s.types[key] = index
+		return index, true
+	}
+	return 0, false
+}
+
+// items encodes the items of an interface into a scope
+type items struct {
+	e        *encoder
+	scope    *scope
+	iface    *iface
+	imports  bool
+	defining map[string]bool
+}
+
+func (e *encoder) items(s *scope, i *iface, imports bool) *items {
+	return &items{
+		e:        e,
+		scope:    s,
+		iface:    i,
+		imports:  imports,
+		defining: map[string]bool{},
+	}
+}
+
+func (it *items) encode(interfaceItems []ast.InterfaceItem) error {
+	for _, item := range interfaceItems {
+		var err error
+		switch i := item.(type) {
+		case *ast.Use:
+			for _, name := range i.Names {
+				if _, err = it.define(localName(name)); err != nil {
+					break
+				}
+			}
+		case ast.Resource:
+			err = it.resource(i)
+		case *ast.Record:
+			_, err = it.define(i.ID)
+		case *ast.Variant:
+			_, err = it.define(i.ID)
+		case *ast.Enum:
+			_, err = it.define(i.ID)
+		case *ast.Flags:
+			_, err = it.define(i.ID)
+		case *ast.TypeItem:
+			_, err = it.define(i.ID)
+		case *ast.FuncItem:
+			err = it.function(it.imports, i.ID, i.FuncType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *items) resource(resource ast.Resource) error {
+	if _, err := it.define(resource.ID); err != nil {
+		return err
+	}
+	for _, method := range resource.Methods {
+		var err error
+		switch m := method.(type) {
+		case *ast.Constructor:
+			err = it.method(fmt.Sprintf("[constructor]%s", resource.ID), resource.ID, &ast.FuncType{Params: m.ParameterList}, false, true)
+		case ast.Method:
+			err = it.method(fmt.Sprintf("[method]%s.%s", resource.ID, m.Func.ID), resource.ID, m.Func.FuncType, true, false)
+		case ast.Static:
+			err = it.method(fmt.Sprintf("[static]%s.%s", resource.ID, m.ID), resource.ID, m.FuncType, false, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// define declares the named type in the scope if it has not already been declared
+func (it *items) define(name string) (uint32, error) {
+	key := it.iface.key + "." + name
+	if index, ok := it.scope.types[key]; ok {
+		return index, nil
+	}
+	if it.defining[name] {
+		return 0, fmt.Errorf("type '%s' refers to itself", name)
+	}
+	it.defining[name] = true
+	defer delete(it.defining, name)
+
+	types, err := it.e.typesOf(it.iface)
+	if err != nil {
+		return 0, err
+	}
+	decl, ok := types[name]
+	if !ok {
+		return 0, fmt.Errorf("type '%s' not found", name)
+	}
+
+	var bound api.TypeBound
+	if decl.from != nil {
+		index, ok := it.scope.lookup(decl.from, decl.name)
+		if !ok {
+			return 0, fmt.Errorf("type '%s' from '%s' is not imported", decl.name, decl.from.key)
+		}
+		bound = &api.EqBound{Type: index}
+	} else {
+		bound, err = it.bound(decl.def)
+		if err != nil {
+			return 0, fmt.Errorf("type '%s': %w", name, err)
+		}
+	}
+
+	it.scope.declare(it.imports, name, &api.TypeExternDesc{Bound: bound})
+	index := it.scope.nextType()
+	it.scope.types[key] = index
+	return index, nil
+}
+
+func (it *items) bound(def ast.TypeDef) (api.TypeBound, error) {
+	var defType api.DefType
+	switch d := def.(type) {
+	case ast.Resource:
+		return &api.SubResourceBound{}, nil
+	case *ast.TypeItem:
+		// aliases of named types refer to the named type directly
+		if id, ok := d.Type.(*ast.Id); ok {
+			index, err := it.define(id.Value)
+			if err != nil {
+				return nil, err
+			}
+			return &api.EqBound{Type: index}, nil
+		}
+		valType, err := it.valType(d.Type)
+		if err != nil {
+			return nil, err
+		}
+		if index, ok := valType.(api.TypeIndexValType); ok {
+			return &api.EqBound{Type: uint32(index)}, nil
+		}
+		defType = valType.(api.PrimValType)
+	case *ast.Record:
+		record := &api.RecordType{}
+		for _, field := range d.Fields {
+			valType, err := it.valType(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			record.Fields = append(record.Fields, api.LabelValType{Label: field.Name, Type: valType})
+		}
+		defType = record
+	case *ast.Variant:
+		variant := &api.VariantType{}
+		for _, c := range d.Cases {
+			var valType api.ComponentValType
+			if t, ok := c.Type.Deconstruct(); ok {
+				var err error
+				valType, err = it.valType(t)
+				if err != nil {
+					return nil, err
+				}
+			}
+			variant.Cases = append(variant.Cases, api.VariantCase{Label: c.Name, Type: valType})
+		}
+		defType = variant
+	case *ast.Enum:
+		enum := &api.EnumType{}
+		for _, c := range d.Cases {
+			enum.Labels = append(enum.Labels, c.Name)
+		}
+		defType = enum
+	case *ast.Flags:
+		flags := &api.FlagsType{}
+		for _, f := range d.Flags {
+			flags.Labels = append(flags.Labels, f.Id)
+		}
+		defType = flags
+	default:
+		return nil, fmt.Errorf("unsupported type definition %T", def)
+	}
+	return &api.EqBound{Type: it.scope.defType(defType)}, nil
+}
+
+// named returns the index of a named type and whether it is a resource
+func (it *items) named(name string) (uint32, bool, error) {
+	index, err := it.define(name)
+	if err != nil {
+		return 0, false, err
+	}
+	_, def, err := it.e.origin(it.iface, name)
+	if err != nil {
+		return 0, false, err
+	}
+	_, resource := def.(ast.Resource)
+	return index, resource, nil
+}
+
+func (it *items) handle(name string, borrow bool) (api.ComponentValType, error) {
+	index, resource, err := it.named(name)
+	if err != nil {
+		return nil, err
+	}
+	if !resource {
+		return nil, fmt.Errorf("type '%s' is not a resource", name)
+	}
+	if borrow {
+		return api.TypeIndexValType(it.scope.defType(&api.BorrowType{Type: index})), nil
+	}
+	return api.TypeIndexValType(it.scope.defType(&api.OwnType{Type: index})), nil
+}
+
+func (it *items) valType(t ast.Type) (api.ComponentValType, error) {
+	switch ty := t.(type) {
+	case *ast.Bool:
+		return api.BoolType, nil
+	case *ast.S8:
+		return api.S8Type, nil
+	case *ast.U8:
+		return api.U8Type, nil
+	case *ast.S16:
+		return api.S16Type, nil
+	case *ast.U16:
+		return api.U16Type, nil
+	case *ast.S32:
+		return api.S32Type, nil
+	case *ast.U32:
+		return api.U32Type, nil
+	case *ast.S64:
+		return api.S64Type, nil
+	case *ast.U64:
+		return api.U64Type, nil
+	case *ast.Float32:
+		return api.Float32Type, nil
+	case *ast.Float64:
+		return api.Float64Type, nil
+	case *ast.Char:
+		return api.CharType, nil
+	case *ast.String:
+		return api.StringType, nil
+	case *ast.Id:
+		index, resource, err := it.named(ty.Value)
+		if err != nil {
+			return nil, err
+		}
+		if resource {
+			return api.TypeIndexValType(it.scope.defType(&api.OwnType{Type: index})), nil
+		}
+		return api.TypeIndexValType(index), nil
+	case *ast.Own:
+		return it.handle(ty.Id, false)
+	case *ast.Borrow:
+		return it.handle(ty.Id, true)
+	case *ast.List:
+		element, err := it.valType(ty.ItemType)
+		if err != nil {
+			return nil, err
+		}
+		return api.TypeIndexValType(it.scope.defType(&api.ListType{Element: element})), nil
+	case *ast.Option:
+		item, err := it.valType(ty.ItemType)
+		if err != nil {
+			return nil, err
+		}
+		return api.TypeIndexValType(it.scope.defType(&api.OptionType{Type: item})), nil
+	case *ast.Tuple:
+		tuple := &api.TupleType{}
+		for _, t := range ty.Types {
+			valType, err := it.valType(t)
+			if err != nil {
+				return nil, err
+			}
+			tuple.Types = append(tuple.Types, valType)
+		}
+		return api.TypeIndexValType(it.scope.defType(tuple)), nil
+	case *ast.Result:
+		ok, err := it.optionalValType(ty.Ok.Deconstruct())
+		if err != nil {
+			return nil, err
+		}
+		e, err := it.optionalValType(ty.Error.Deconstruct())
+		if err != nil {
+			return nil, err
+		}
+		return api.TypeIndexValType(it.scope.defType(&api.ResultValType{Ok: ok, Error: e})), nil
+	case *ast.Stream:
+		if _, ok := ty.End.Deconstruct(); ok {
+			return nil, fmt.Errorf("stream end types are not supported")
+		}
+		element, err := it.optionalValType(ty.Element.Deconstruct())
+		if err != nil {
+			return nil, err
+		}
+		return api.TypeIndexValType(it.scope.defType(&api.StreamType{Element: element})), nil
+	case *ast.Future:
+		element, err := it.optionalValType(ty.ItemType.Deconstruct())
+		if err != nil {
+			return nil, err
+		}
+		return api.TypeIndexValType(it.scope.defType(&api.FutureType{Element: element})), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", t)
+}
+
+func (it *items) optionalValType(t ast.Type, ok bool) (api.ComponentValType, error) {
+	if !ok {
+		return nil, nil
+	}
+	return it.valType(t)
+}
+
+func (it *items) function(imp bool, name string, funcType *ast.FuncType) error {
+	ty, err := it.funcType(funcType)
+	if err != nil {
+		return fmt.Errorf("func '%s': %w", name, err)
+	}
+	it.scope.declare(imp, name, &api.FuncExternDesc{Type: it.scope.defType(ty)})
+	return nil
+}
+
+// method encodes a resource method where self adds a borrowed self parameter and constructor returns an owned handle
+func (it *items) method(name string, resource string, funcType *ast.FuncType, self bool, constructor bool) error {
+	ty := &api.ComponentFuncType{}
+	if self {
+		handle, err := it.handle(resource, true)
+		if err != nil {
+			return err
+		}
+		ty.Params = append(ty.Params, api.LabelValType{Label: "self", Type: handle})
+	}
+	rest, err := it.funcType(funcType)
+	if err != nil {
+		return fmt.Errorf("func '%s': %w", name, err)
+	}
+	ty.Params = append(ty.Params, rest.Params...)
+	ty.Result = rest.Result
+	ty.NamedResults = rest.NamedResults
+	if constructor {
+		handle, err := it.handle(resource, false)
+		if err != nil {
+			return err
+		}
+		ty.Result = handle
+	}
+	it.scope.declare(it.imports, name, &api.FuncExternDesc{Type: it.scope.defType(ty)})
+	return nil
+}
+
+func (it *items) funcType(funcType *ast.FuncType) (*api.ComponentFuncType, error) {
+	ty := &api.ComponentFuncType{}
+	for _, param := range funcType.Params {
+		valType, err := it.valType(param.Type)
+		if err != nil {
+			return nil, err
+		}
+		ty.Params = append(ty.Params, api.LabelValType{Label: param.Id, Type: valType})
+	}
+	if funcType.Results == nil {
+		return ty, nil
+	}
+	if funcType.Results.Anonymous != nil {
+		valType, err := it.valType(funcType.Results.Anonymous)
+		if err != nil {
+			return nil, err
+		}
+		ty.Result = valType
+		return ty, nil
+	}
+	for _, result := range funcType.Results.Named {
+		valType, err := it.valType(result.Type)
+		if err != nil {
+			return nil, err
+		}
+		ty.NamedResults = append(ty.NamedResults, api.LabelValType{Label: result.Id, Type: valType})
+	}
+	return ty, nil
+}
+
+// importNeeds imports the required interfaces into the scope with dependencies first
+func (e *encoder) importNeeds(s *scope, n *needs) error {
+	sorted, err := n.sorted()
+	if err != nil {
+		return err
+	}
+	for _, i := range sorted {
+		instance := newScope(s)
+		it := e.items(instance, i, false)
+		if n.full[i] {
+			err = it.encode(i.items)
+		} else {
+			for _, name := range n.names[i] {
+				if _, err = it.define(name); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", i.key, err)
+		}
+		index := s.defType(&api.InstanceType{Declarations: instance.declarations})
+		s.declare(true, i.key, &api.InstanceExternDesc{Type: index})
+		s.instances[i.key] = s.instanceCount
+		s.instanceCount++
+	}
+	return nil
+}
+
+func (e *encoder) interfaceType(i *iface) (*api.ComponentType, error) {
+	s := newScope(nil)
+
+	n := newNeeds(e)
+	if err := n.addUses(i); err != nil {
+		return nil, err
+	}
+	if err := e.importNeeds(s, n); err != nil {
+		return nil, err
+	}
+
+	instance := newScope(s)
+	if err := e.items(instance, i, false).encode(i.items); err != nil {
+		return nil, err
+	}
+	index := s.defType(&api.InstanceType{Declarations: instance.declarations})
+	s.declare(false, i.key, &api.InstanceExternDesc{Type: index})
+	return &api.ComponentType{Declarations: s.declarations}, nil
+}
+
+func (e *encoder) worldType(w *ast.World) (*api.ComponentType, error) {
+	worldItems, err := e.flatten(e.main, w, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	// world level types behave like an interface whose names are imported
+	world := e.inline("", nil)
+	var typeItems []any
+	for _, item := range worldItems {
+		typeItems = append(typeItems, item)
+	}
+	world.resolved = true
+	if err := e.resolveTypes(world, typeItems); err != nil {
+		return nil, err
+	}
+
+	n := newNeeds(e)
+	type inlineItem struct {
+		iface *iface
+		imp   bool
+	}
+	inlines := map[ast.WorldItem]inlineItem{}
+	for _, item := range worldItems {
+		imp, externType := externOf(item)
+		switch et := externType.(type) {
+		case *ast.ExternTypeUsePath:
+			i, err := e.resolvePath(e.main, et.UsePath)
+			if err != nil {
+				return nil, err
+			}
+			if imp {
+				err = n.addFull(i)
+			} else {
+				err = n.addUses(i)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case *ast.ExternTypeInterface:
+			i := e.inline(et.ID, et.InterfaceItems)
+			if err := n.addUses(i); err != nil {
+				return nil, err
+			}
+			inlines[item] = inlineItem{iface: i, imp: imp}
+		}
+		if use, ok := item.(*ast.Use); ok {
+			for _, name := range use.Names {
+				decl := world.types[localName(name)]
+				if err := n.add(decl.from, decl.name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	body := newScope(nil)
+	if err := e.importNeeds(body, n); err != nil {
+		return nil, err
+	}
+
+	it := e.items(body, world, true)
+	for _, item := range worldItems {
+		imp, externType := externOf(item)
+		switch et := externType.(type) {
+		case nil:
+			var interfaceItem ast.InterfaceItem
+			switch i := item.(type) {
+			case *ast.Use:
+				interfaceItem = i
+			case ast.TypeDef:
+				interfaceItem = i
+			default:
+				continue
+			}
+			err = it.encode([]ast.InterfaceItem{interfaceItem})
+		case *ast.ExternTypeUsePath:
+			// imports were added with the dependencies
+			if imp {
+				continue
+			}
+			var i *iface
+			i, err = e.resolvePath(e.main, et.UsePath)
+			if err != nil {
+				return nil, err
+			}
+			instance := newScope(body)
+			if err = e.items(instance, i, false).encode(i.items); err != nil {
+				break
+			}
+			index := body.defType(&api.InstanceType{Declarations: instance.declarations})
+			body.declare(false, i.key, &api.InstanceExternDesc{Type: index})
+		case *ast.ExternTypeInterface:
+			inline := inlines[item]
+			instance := newScope(body)
+			if err = e.items(instance, inline.iface, false).encode(inline.iface.items); err != nil {
+				break
+			}
+			index := body.defType(&api.InstanceType{Declarations: instance.declarations})
+			body.declare(imp, et.ID, &api.InstanceExternDesc{Type: index})
+			if imp {
+				body.instanceCount++
+			}
+		case *ast.ExternTypeFunc:
+			err = it.function(imp, et.ID, et.Func)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	outer := newScope(nil)
+	index := outer.defType(&api.ComponentType{Declarations: body.declarations})
+	outer.declarations = append(outer.declarations, &api.ExportDeclaration{
+		Name: e.main.qualify(w.Id),
+		Desc: &api.ComponentExternDesc{Type: index},
+	})
+	return &api.ComponentType{Declarations: outer.declarations}, nil
+}
+
+// externOf returns the extern type of import and export world items
+func externOf(item ast.WorldItem) (bool, ast.ExternType) {
+	switch i := item.(type) {
+	case *ast.Import:
+		return true, i.ExternType
+	case *ast.Export:
+		return false, i.ExternType
+	}
+	return false, nil
+}
+
+// flatten expands world includes and removes duplicate interface imports and exports
+func (e *encoder) flatten(p *pkg, w *ast.World, visiting map[string]bool) ([]ast.WorldItem, error) {
+	key := p.qualify(w.Id)
+	if visiting[key] {
+		return nil, fmt.Errorf("world '%s' includes itself", key)
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	var flattened []ast.WorldItem
+	seen := map[string]bool{}
+	add := func(item ast.WorldItem) error {
+		imp, externType := externOf(item)
+		if usePath, ok := externType.(*ast.ExternTypeUsePath); ok {
+			i, err := e.resolvePath(p, usePath.UsePath)
+			if err != nil {
+				return err
+			}
+			key := fmt.Sprintf("%t:%s", imp, i.key)
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+			// paths are made absolute so included worlds from other packages resolve
+			if i.pkg != e.main {
+				q, _ := parseQualifiedName(i.key)
+				item = rewritePath(imp, q, i.pkg)
+			}
+		}
+		flattened = append(flattened, item)
+		return nil
+	}
+
+	for _, item := range w.Items {
+		include, ok := item.(*ast.Include)
+		if !ok {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		includedPkg, included, err := e.resolveWorld(p, include.From)
+		if err != nil {
+			return nil, err
+		}
+		items, err := e.flatten(includedPkg, included, visiting)
+		if err != nil {
+			return nil, err
+		}
+		renames := map[string]string{}
+		for _, name := range include.Names {
+			renames[name.Name] = name.As
+		}
+		for _, item := range items {
+			if err := add(rename(item, renames)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return flattened, nil
+}
+
+func rewritePath(imp bool, q qualifiedName, p *pkg) ast.WorldItem {
+	decl := p.decl
+	path := &ast.UsePath{Id: q.name}
+	path.Package.Id = &decl
+	path.Package.Name = q.name
+	externType := &ast.ExternTypeUsePath{UsePath: path}
+	if imp {
+		return &ast.Import{ExternType: externType}
+	}
+	return &ast.Export{ExternType: externType}
+}
+
+// rename applies `include ... with { a as b }` to named imports and exports
+func rename(item ast.WorldItem, renames map[string]string) ast.WorldItem {
+	if len(renames) == 0 {
+		return item
+	}
+	imp, externType := externOf(item)
+	var renamed ast.ExternType
+	switch et := externType.(type) {
+	case *ast.ExternTypeFunc:
+		as, ok := renames[et.ID]
+		if !ok {
+			return item
+		}
+		renamed = &ast.ExternTypeFunc{ID: as, Func: et.Func}
+	case *ast.ExternTypeInterface:
+		as, ok := renames[et.ID]
+		if !ok {
+			return item
+		}
+		renamed = &ast.ExternTypeInterface{ID: as, InterfaceItems: et.InterfaceItems}
+	default:
+		return item
+	}
+	if imp {
+		return &ast.Import{ExternType: renamed}
+	}
+	return &ast.Export{ExternType: renamed}
+}
@@ -0,0 +1,479 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// RootPackage and RootWorld name the world that describes a compiled component
+const (
+	RootPackage = "root:component"
+	RootWorld   = "root"
+)
+
+// Extract returns the wit of a compiled component.
+// The first ast is the `root:component` package containing the `root` world with the imports and exports of the component.
+// It is followed by one ast for each package of the interfaces the world imports and exports, in the order they are first referenced.
+// Components that encode a wit package are decoded with Decode.
+func Extract(component *api.Component) ([]*ast.Ast, error) {
+	if isPackage(component) {
+		tree, err := Decode(component)
+		if err != nil {
+			return nil, err
+		}
+		return []*ast.Ast{tree}, nil
+	}
+
+	root, _ := parseQualifiedName(RootPackage + "/" + RootWorld)
+	decl, err := packageDeclaration(root)
+	if err != nil {
+		return nil, err
+	}
+	x := &extractor{
+		d:        &decoder{pkg: decl},
+		packages: map[string]*ast.Ast{},
+		seen:     map[string]bool{},
+	}
+	world, err := x.world(component)
+	if err != nil {
+		return nil, err
+	}
+	trees := []*ast.Ast{{
+		PackageDeclaration: option.Some(decl),
+		Items:              []ast.AstItem{{World: world}},
+	}}
+	for _, key := range x.order {
+		trees = append(trees, x.packages[key])
+	}
+	return trees, nil
+}
+
+// isPackage returns true if the component only defines and exports types, which is how wit packages are encoded
+func isPackage(component *api.Component) bool {
+	exports := 0
+	for _, section := range component.Sections {
+		switch s := section.(type) {
+		case *api.CustomSection, *api.TypeSection:
+		case *api.ExportSection:
+			for _, export := range s.Exports {
+				if export.Sort != api.TypeSort {
+					return false
+				}
+				exports++
+			}
+		default:
+			return false
+		}
+	}
+	return exports > 0
+}
+
+// dcomponent is an entry in the component index space. Nested components are evaluated when they are instantiated.
+type dcomponent struct {
+	component *api.Component
+	parent    *dscope
+}
+
+// ditem is an item passed to or exported from a component
+type ditem struct {
+	sort      api.Sort
+	ty        *dtype
+	fn        *dfunc
+	instance  *dinstance
+	component *dcomponent
+}
+
+type dexport struct {
+	name string
+	item ditem
+}
+
+type extractor struct {
+	d        *decoder
+	packages map[string]*ast.Ast
+	order    []string
+	// seen tracks the interfaces that have been added to packages
+	seen map[string]bool
+}
+
+// world converts the imports and exports of the top level component into a world
+func (x *extractor) world(component *api.Component) (*ast.World, error) {
+	s := &dscope{}
+	typeItems := itemList{d: x.d}
+	var entries []entry
+
+	imports := func(imp api.ComponentImport) error {
+		count := len(typeItems.items)
+		e, err := x.d.extern(s, true, imp.Name, imp.Desc, &typeItems)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			entries = append(entries, *e)
+			if _, ok := imp.Desc.(*api.InstanceExternDesc); ok {
+				x.addInterface(imp.Name, e.items)
+			}
+		}
+		for i := count; i < len(typeItems.items); i++ {
+			entries = append(entries, entry{imp: true, typeItem: i + 1})
+		}
+		return nil
+	}
+
+	exports, err := x.evaluate(s, component, imports)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, export := range exports {
+		switch export.item.sort {
+		case api.InstanceSort:
+			items, err := x.interfaceItems(s, export.item.instance)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", export.name, err)
+			}
+			export.item.instance.own(export.name)
+			var externType ast.ExternType
+			if _, ok := parseQualifiedName(export.name); ok {
+				x.addInterface(export.name, items)
+				externType = &ast.ExternTypeUsePath{UsePath: x.d.usePath(export.name)}
+			} else {
+				externType = &ast.ExternTypeInterface{ID: export.name, InterfaceItems: items}
+			}
+			entries = append(entries, entry{name: export.name, item: &ast.Export{ExternType: externType}})
+		case api.FuncSort:
+			funcType, err := x.d.funcType(export.item.fn)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", export.name, err)
+			}
+			entries = append(entries, entry{name: export.name, item: &ast.Export{
+				ExternType: &ast.ExternTypeFunc{ID: export.name, Func: funcType},
+			}})
+		}
+	}
+
+	world := &ast.World{Id: RootWorld}
+	for _, e := range entries {
+		if e.item != nil {
+			world.Items = append(world.Items, e.item)
+			continue
+		}
+		worldItem, ok := typeItems.items[e.typeItem-1].(ast.WorldItem)
+		if !ok {
+			return nil, fmt.Errorf("unexpected world item %T", typeItems.items[e.typeItem-1])
+		}
+		world.Items = append(world.Items, worldItem)
+	}
+	return world, nil
+}
+
+// interfaceItems converts the exports of an instance into interface items
+func (x *extractor) interfaceItems(s *dscope, instance *dinstance) ([]ast.InterfaceItem, error) {
+	list := &itemList{d: x.d}
+	for _, name := range instance.names {
+		if t, ok := instance.exports[name]; ok {
+			if err := list.export(s, name, t); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if f, ok := instance.funcs[name]; ok {
+			if err := list.function(name, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return list.items, nil
+}
+
+// addInterface adds the items of a qualified interface to the ast of its package
+func (x *extractor) addInterface(name string, items []ast.InterfaceItem) {
+	q, ok := parseQualifiedName(name)
+	if !ok || x.seen[name] {
+		return
+	}
+	x.seen[name] = true
+	decl, err := packageDeclaration(q)
+	if err != nil {
+		return
+	}
+	key := versioned(packageName(decl.Namespace, decl.Name), decl.Version)
+	tree, ok := x.packages[key]
+	if !ok {
+		tree = &ast.Ast{PackageDeclaration: option.Some(decl)}
+		x.packages[key] = tree
+		x.order = append(x.order, key)
+	}
+	tree.Items = append(tree.Items, ast.AstItem{
+		Interface: &ast.Interface{Name: q.name, Items: localize(items, key)},
+	})
+}
+
+// localize rewrites uses of interfaces in the package identified by key to local paths
+func localize(items []ast.InterfaceItem, key string) []ast.InterfaceItem {
+	for _, item := range items {
+		use, ok := item.(*ast.Use)
+		if !ok || use.From.Package.Id == nil {
+			continue
+		}
+		decl := use.From.Package.Id
+		if versioned(packageName(decl.Namespace, decl.Name), decl.Version) != key {
+			continue
+		}
+		use.From = &ast.UsePath{Id: use.From.Id}
+	}
+	return items
+}
+
+// evaluate tracks the index spaces of a component and returns its exports.
+// Imports of the top level component are passed to imports, nested components bind their imports to the instantiation arguments.
+func (x *extractor) evaluate(s *dscope, component *api.Component, imports func(api.ComponentImport) error) ([]dexport, error) {
+	var exports []dexport
+	for _, section := range component.Sections {
+		switch sec := section.(type) {
+		case *api.TypeSection:
+			for _, def := range sec.Types {
+				s.define(def)
+			}
+		case *api.ImportSection:
+			for _, imp := range sec.Imports {
+				if err := imports(imp); err != nil {
+					return nil, fmt.Errorf("%s: %w", imp.Name, err)
+				}
+			}
+		case *api.AliasSection:
+			for _, alias := range sec.Aliases {
+				if err := x.alias(s, alias); err != nil {
+					return nil, err
+				}
+			}
+		case *api.CanonSection:
+			for _, f := range sec.Funcs {
+				lift, ok := f.(*api.CanonLift)
+				if !ok {
+					// the other canonical functions define core functions
+					continue
+				}
+				fn, err := s.funcAt(lift.Type)
+				if err != nil {
+					return nil, err
+				}
+				s.funcs = append(s.funcs, fn)
+			}
+		case *api.NestedComponentSection:
+			s.components = append(s.components, &dcomponent{component: sec.Component, parent: s})
+		case *api.InstanceSection:
+			for _, instance := range sec.Instances {
+				i, err := x.instance(s, instance)
+				if err != nil {
+					return nil, err
+				}
+				s.instances = append(s.instances, i)
+			}
+		case *api.ExportSection:
+			for _, export := range sec.Exports {
+				item, err := x.export(s, export)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", export.Name, err)
+				}
+				exports = append(exports, dexport{name: export.Name, item: item})
+			}
+		}
+	}
+	return exports, nil
+}
+
+func (x *extractor) alias(s *dscope, alias api.Alias) error {
+	switch alias.Sort {
+	case api.TypeSort:
+		t, err := s.alias(alias)
+		if err != nil {
+			return err
+		}
+		s.types = append(s.types, t)
+		return nil
+	case api.FuncSort:
+		target, ok := alias.Target.(*api.ExportAlias)
+		if !ok {
+			return fmt.Errorf("unsupported function alias target %T", alias.Target)
+		}
+		instance, err := s.instanceAt(target.Instance)
+		if err != nil {
+			return err
+		}
+		f, ok := instance.funcs[target.Name]
+		if !ok {
+			return fmt.Errorf("instance '%s' does not export function '%s'", instance.name, target.Name)
+		}
+		s.funcs = append(s.funcs, f)
+		return nil
+	case api.ComponentSort:
+		target, ok := alias.Target.(*api.OuterAlias)
+		if !ok {
+			return fmt.Errorf("unsupported component alias target %T", alias.Target)
+		}
+		outer := s
+		for i := uint32(0); i < target.Count; i++ {
+			if outer.parent == nil {
+				return fmt.Errorf("outer alias count %d out of range", target.Count)
+			}
+			outer = outer.parent
+		}
+		if int(target.Index) >= len(outer.components) {
+			return fmt.Errorf("component index %d out of range", target.Index)
+		}
+		s.components = append(s.components, outer.components[target.Index])
+		return nil
+	case api.InstanceSort:
+		target, ok := alias.Target.(*api.ExportAlias)
+		if !ok {
+			return fmt.Errorf("unsupported instance alias target %T", alias.Target)
+		}
+		instance, err := s.instanceAt(target.Instance)
+		if err != nil {
+			return err
+		}
+		exported, ok := instance.instances[target.Name]
+		if !ok {
+			return fmt.Errorf("instance '%s' does not export instance '%s'", instance.name, target.Name)
+		}
+		s.instances = append(s.instances, exported)
+		return nil
+	}
+	// core items do not affect the component level index spaces
+	return nil
+}
+
+func (s *dscope) instanceAt(index uint32) (*dinstance, error) {
+	if int(index) >= len(s.instances) {
+		return nil, fmt.Errorf("instance index %d out of range", index)
+	}
+	return s.instances[index], nil
+}
+
+// item returns the item of the given sort at index
+func (s *dscope) item(sort api.Sort, index uint32) (ditem, error) {
+	item := ditem{sort: sort}
+	var err error
+	switch sort {
+	case api.TypeSort:
+		item.ty, err = s.typeAt(index)
+	case api.FuncSort:
+		if int(index) >= len(s.funcs) {
+			return item, fmt.Errorf("function index %d out of range", index)
+		}
+		item.fn = s.funcs[index]
+	case api.InstanceSort:
+		item.instance, err = s.instanceAt(index)
+	case api.ComponentSort:
+		if int(index) >= len(s.components) {
+			return item, fmt.Errorf("component index %d out of range", index)
+		}
+		item.component = s.components[index]
+	default:
+		return item, fmt.Errorf("unsupported sort %d", sort)
+	}
+	return item, err
+}
+
+func (x *extractor) instance(s *dscope, instance api.ComponentInstance) (*dinstance, error) {
+	switch i := instance.(type) {
+	case *api.ExportsInstance:
+		exports := make([]dexport, 0, len(i.Exports))
+		for _, export := range i.Exports {
+			item, err := s.item(export.Sort, export.Index)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", export.Name, err)
+			}
+			exports = append(exports, dexport{name: export.Name, item: item})
+		}
+		return newDinstance(exports), nil
+	case *api.InstantiateInstance:
+		if int(i.Component) >= len(s.components) {
+			return nil, fmt.Errorf("component index %d out of range", i.Component)
+		}
+		c := s.components[i.Component]
+		args := map[string]ditem{}
+		for _, arg := range i.Args {
+			item, err := s.item(arg.Sort, arg.Index)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg.Name, err)
+			}
+			args[arg.Name] = item
+		}
+		nested := &dscope{parent: c.parent}
+		exports, err := x.evaluate(nested, c.component, func(imp api.ComponentImport) error {
+			arg, ok := args[imp.Name]
+			if !ok {
+				return fmt.Errorf("missing instantiation argument")
+			}
+			return nested.bind(arg)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newDinstance(exports), nil
+	}
+	return nil, fmt.Errorf("unsupported instance %T", instance)
+}
+
+// bind adds an instantiation argument to the index space of its sort
+func (s *dscope) bind(item ditem) error {
+	switch item.sort {
+	case api.TypeSort:
+		s.types = append(s.types, item.ty)
+	case api.FuncSort:
+		s.funcs = append(s.funcs, item.fn)
+	case api.InstanceSort:
+		s.instances = append(s.instances, item.instance)
+	case api.ComponentSort:
+		s.components = append(s.components, item.component)
+	default:
+		return fmt.Errorf("unsupported sort %d", item.sort)
+	}
+	return nil
+}
+
+// export adds the exported item to its index space. Function exports with a type ascription use the ascribed type.
+func (x *extractor) export(s *dscope, export api.ComponentExport) (ditem, error) {
+	if export.Sort == api.CoreModuleSort {
+		// core modules are not part of the world
+		return ditem{sort: export.Sort}, nil
+	}
+	item, err := s.item(export.Sort, export.Index)
+	if err != nil {
+		return item, err
+	}
+	if desc, ok := export.Desc.(*api.FuncExternDesc); ok {
+		item.fn, err = s.funcAt(desc.Type)
+		if err != nil {
+			return item, err
+		}
+	}
+	return item, s.bind(item)
+}
+
+func newDinstance(exports []dexport) *dinstance {
+	instance := &dinstance{exports: map[string]*dtype{}, funcs: map[string]*dfunc{}}
+	for _, export := range exports {
+		switch export.item.sort {
+		case api.TypeSort:
+			instance.exports[export.name] = export.item.ty
+		case api.FuncSort:
+			instance.funcs[export.name] = export.item.fn
+		case api.InstanceSort:
+			if instance.instances == nil {
+				instance.instances = map[string]*dinstance{}
+			}
+			instance.instances[export.name] = export.item.instance
+			continue
+		default:
+			continue
+		}
+		instance.names = append(instance.names, export.name)
+	}
+	return instance
+}
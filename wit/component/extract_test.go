@@ -0,0 +1,212 @@
+package component_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/api"
+	"github.com/patrickhuber/go-wasm/binary"
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/patrickhuber/go-wasm/wit/component"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+	"github.com/stretchr/testify/require"
+)
+
+// importedInstance is the type of the imported interface `a:b/i` with a record t and a function f
+var importedInstance = &api.InstanceType{
+	Declarations: []api.Declaration{
+		&api.TypeDeclaration{Type: &api.RecordType{Fields: []api.LabelValType{{Label: "x", Type: api.U32Type}}}},
+		&api.ExportDeclaration{Name: "t", Desc: &api.TypeExternDesc{Bound: &api.EqBound{Type: 0}}},
+		&api.TypeDeclaration{Type: &api.ComponentFuncType{Params: []api.LabelValType{{Label: "x", Type: api.TypeIndexValType(1)}}}},
+		&api.ExportDeclaration{Name: "f", Desc: &api.FuncExternDesc{Type: 2}},
+	},
+}
+
+const expectedWorld = `package root:component;
+
+world root {
+  import a:b/i;
+  import log: func(msg: string);
+  export a:b/e;
+  export run: func() -> result<_, string>;
+}
+
+package a:b {
+  interface i {
+    record t {
+      x: u32,
+    }
+    f: func(x: t);
+  }
+
+  interface e {
+    use i.{t};
+    record r {
+      y: u32,
+    }
+    resource h {
+      get: func() -> t;
+    }
+    g: func(v: r) -> t;
+  }
+}
+`
+
+func TestExtract(t *testing.T) {
+	core := &api.RawSection{ID: uint8(binary.ComponentCoreModuleSectionID), Data: []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}}
+	prefix := []api.ComponentSection{
+		&api.TypeSection{Types: []api.DefType{importedInstance}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "a:b/i", Desc: &api.InstanceExternDesc{Type: 0}}}},
+		&api.AliasSection{Aliases: []api.Alias{{Sort: api.TypeSort, Target: &api.ExportAlias{Instance: 0, Name: "t"}}}},
+		&api.TypeSection{Types: []api.DefType{
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "msg", Type: api.StringType}}},
+		}},
+		&api.ImportSection{Imports: []api.ComponentImport{{Name: "log", Desc: &api.FuncExternDesc{Type: 2}}}},
+		core,
+		&api.TypeSection{Types: []api.DefType{
+			// 3
+			&api.RecordType{Fields: []api.LabelValType{{Label: "y", Type: api.U32Type}}},
+			// 4
+			&api.ResourceType{Rep: api.I32Type},
+			// 5
+			&api.BorrowType{Type: 4},
+			// 6
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "self", Type: api.TypeIndexValType(5)}}, Result: api.TypeIndexValType(1)},
+			// 7
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "v", Type: api.TypeIndexValType(3)}}, Result: api.TypeIndexValType(1)},
+			// 8
+			&api.ResultValType{Error: api.StringType},
+			// 9
+			&api.ComponentFuncType{Result: api.TypeIndexValType(8)},
+		}},
+		&api.CanonSection{Funcs: []api.CanonicalFunction{
+			&api.CanonLower{Func: 0, Options: []api.CanonOption{api.UTF8Encoding, &api.MemoryOption{Memory: 0}}},
+			&api.CanonResourceNew{Resource: 4},
+			// func 1
+			&api.CanonLift{CoreFunc: 0, Type: 6},
+			// func 2
+			&api.CanonLift{CoreFunc: 1, Type: 7},
+			// func 3
+			&api.CanonLift{CoreFunc: 2, Type: 9, Options: []api.CanonOption{&api.ReallocOption{Func: 3}, &api.PostReturnOption{Func: 4}}},
+		}},
+	}
+
+	flat := &api.Component{Sections: append(append([]api.ComponentSection{}, prefix...),
+		&api.InstanceSection{Instances: []api.ComponentInstance{
+			&api.ExportsInstance{Exports: []api.InlineExport{
+				{Name: "t", Sort: api.TypeSort, Index: 1},
+				{Name: "r", Sort: api.TypeSort, Index: 3},
+				{Name: "h", Sort: api.TypeSort, Index: 4},
+				{Name: "[method]h.get", Sort: api.FuncSort, Index: 1},
+				{Name: "g", Sort: api.FuncSort, Index: 2},
+			}},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{
+			{Name: "a:b/e", Sort: api.InstanceSort, Index: 1},
+			{Name: "run", Sort: api.FuncSort, Index: 3},
+		}},
+	)}
+
+	// the nested form mirrors the shim components that give exported interfaces their names
+	shim := &api.Component{Sections: []api.ComponentSection{
+		&api.ImportSection{Imports: []api.ComponentImport{
+			{Name: "import-type-t", Desc: &api.TypeExternDesc{Bound: &api.SubResourceBound{}}},
+			{Name: "import-type-r", Desc: &api.TypeExternDesc{Bound: &api.SubResourceBound{}}},
+			{Name: "import-type-h", Desc: &api.TypeExternDesc{Bound: &api.SubResourceBound{}}},
+		}},
+		&api.TypeSection{Types: []api.DefType{
+			// 3
+			&api.BorrowType{Type: 2},
+			// 4
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "self", Type: api.TypeIndexValType(3)}}, Result: api.TypeIndexValType(0)},
+			// 5
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "v", Type: api.TypeIndexValType(1)}}, Result: api.TypeIndexValType(0)},
+		}},
+		&api.ImportSection{Imports: []api.ComponentImport{
+			{Name: "import-method-h-get", Desc: &api.FuncExternDesc{Type: 4}},
+			{Name: "import-func-g", Desc: &api.FuncExternDesc{Type: 5}},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{
+			{Name: "t", Sort: api.TypeSort, Index: 0},
+			{Name: "r", Sort: api.TypeSort, Index: 1},
+			{Name: "h", Sort: api.TypeSort, Index: 2},
+		}},
+		&api.TypeSection{Types: []api.DefType{
+			// 9
+			&api.BorrowType{Type: 8},
+			// 10
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "self", Type: api.TypeIndexValType(9)}}, Result: api.TypeIndexValType(6)},
+			// 11
+			&api.ComponentFuncType{Params: []api.LabelValType{{Label: "v", Type: api.TypeIndexValType(7)}}, Result: api.TypeIndexValType(6)},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{
+			{Name: "[method]h.get", Sort: api.FuncSort, Index: 0, Desc: &api.FuncExternDesc{Type: 10}},
+			{Name: "g", Sort: api.FuncSort, Index: 1, Desc: &api.FuncExternDesc{Type: 11}},
+		}},
+	}}
+	nested := &api.Component{Sections: append(append([]api.ComponentSection{}, prefix...),
+		&api.NestedComponentSection{Component: shim},
+		&api.InstanceSection{Instances: []api.ComponentInstance{
+			&api.InstantiateInstance{Component: 0, Args: []api.InstantiateArg{
+				{Name: "import-type-t", Sort: api.TypeSort, Index: 1},
+				{Name: "import-type-r", Sort: api.TypeSort, Index: 3},
+				{Name: "import-type-h", Sort: api.TypeSort, Index: 4},
+				{Name: "import-method-h-get", Sort: api.FuncSort, Index: 1},
+				{Name: "import-func-g", Sort: api.FuncSort, Index: 2},
+			}},
+		}},
+		&api.ExportSection{Exports: []api.ComponentExport{
+			{Name: "a:b/e", Sort: api.InstanceSort, Index: 1},
+			{Name: "run", Sort: api.FuncSort, Index: 3},
+		}},
+	)}
+
+	tests := []struct {
+		name      string
+		component *api.Component
+	}{
+		{"flat", flat},
+		{"nested", nested},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := binary.Write(&buf, &api.Document{
+				Preamble: api.Preamble{
+					Version: binary.ComponentVersion,
+					Layer:   binary.ComponentLayer,
+				},
+				Directive: test.component,
+			})
+			require.NoError(t, err)
+
+			document, err := binary.Read(&buf)
+			require.NoError(t, err)
+			require.Equal(t, test.component, document.Directive)
+
+			trees, err := component.Extract(document.Directive.(*api.Component))
+			require.NoError(t, err)
+			require.Len(t, trees, 2)
+
+			var builder strings.Builder
+			require.NoError(t, printer.Print(&builder, trees[0], trees[1:]...))
+			require.Equal(t, expectedWorld, builder.String())
+		})
+	}
+}
+
+func TestExtractPackage(t *testing.T) {
+	tree, err := wit.Parse(`package a:b; interface i { f: func(); } world w { export i; }`)
+	require.NoError(t, err)
+
+	encoded, err := component.Encode(tree)
+	require.NoError(t, err)
+
+	trees, err := component.Extract(encoded)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(trees))
+	diagnostic.Clear(tree)
+	require.Equal(t, tree, trees[0])
+}
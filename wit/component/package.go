@@ -0,0 +1,97 @@
+// package component encodes wit packages as binary component types and decodes them back into the wit ast
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/WIT.md#package-format
+package component
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// pkg indexes the interfaces and worlds of a parsed package
+type pkg struct {
+	decl       ast.PackageDeclaration
+	interfaces map[string]*ast.Interface
+	worlds     map[string]*ast.World
+}
+
+func newPkg(tree *ast.Ast) (*pkg, error) {
+	decl, ok := tree.PackageDeclaration.Deconstruct()
+	if !ok {
+		return nil, fmt.Errorf("package declaration is required")
+	}
+	p := &pkg{
+		decl:       decl,
+		interfaces: map[string]*ast.Interface{},
+		worlds:     map[string]*ast.World{},
+	}
+	for _, item := range tree.Items {
+		switch {
+		case item.Interface != nil:
+			if _, ok := p.interfaces[item.Interface.Name]; ok {
+				return nil, fmt.Errorf("duplicate interface '%s'", item.Interface.Name)
+			}
+			p.interfaces[item.Interface.Name] = item.Interface
+		case item.World != nil:
+			if _, ok := p.worlds[item.World.Id]; ok {
+				return nil, fmt.Errorf("duplicate world '%s'", item.World.Id)
+			}
+			p.worlds[item.World.Id] = item.World
+		}
+	}
+	return p, nil
+}
+
+// name returns the package name without the version, for example `wasi:io`
+func (p *pkg) name() string {
+	return packageName(p.decl.Namespace, p.decl.Name)
+}
+
+func (p *pkg) key() string {
+	return versioned(p.name(), p.decl.Version)
+}
+
+// qualify returns the fully qualified name of an item in the package, for example `wasi:io/streams@0.2.0`
+func (p *pkg) qualify(name string) string {
+	return versioned(p.name()+"/"+name, p.decl.Version)
+}
+
+func packageName(namespace, name string) string {
+	return namespace + ":" + name
+}
+
+func versioned(name string, version types.Option[ast.Version]) string {
+	v, ok := version.Deconstruct()
+	if !ok {
+		return name
+	}
+	return name + "@" + v.String()
+}
+
+// qualifiedName is the parsed form of `namespace:package/name@version`
+type qualifiedName struct {
+	namespace string
+	pkg       string
+	name      string
+	version   string
+}
+
+func parseQualifiedName(s string) (qualifiedName, bool) {
+	var q qualifiedName
+	namespace, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return q, false
+	}
+	pkgName, rest, ok := strings.Cut(rest, "/")
+	if !ok {
+		return q, false
+	}
+	name, version, _ := strings.Cut(rest, "@")
+	q.namespace = namespace
+	q.pkg = pkgName
+	q.name = name
+	q.version = version
+	return q, true
+}
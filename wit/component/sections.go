@@ -0,0 +1,259 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/patrickhuber/go-wasm/api"
+)
+
+// indices maps the index spaces of the body of a world type to the index spaces of the component it is declared in
+type indices map[api.Sort][]uint32
+
+func (x indices) add(sort api.Sort, index uint32) {
+	x[sort] = append(x[sort], index)
+}
+
+func (x indices) of(sort api.Sort, index uint32) (uint32, error) {
+	if int(index) >= len(x[sort]) {
+		return 0, fmt.Errorf("index %d of sort %d out of range", index, sort)
+	}
+	return x[sort][index], nil
+}
+
+func (x indices) valType(t api.ComponentValType) (api.ComponentValType, error) {
+	index, ok := t.(api.TypeIndexValType)
+	if !ok {
+		return t, nil
+	}
+	mapped, err := x.of(api.TypeSort, uint32(index))
+	return api.TypeIndexValType(mapped), err
+}
+
+func (x indices) labelValTypes(ts []api.LabelValType) ([]api.LabelValType, error) {
+	var mapped []api.LabelValType
+	for _, t := range ts {
+		vt, err := x.valType(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		mapped = append(mapped, api.LabelValType{Label: t.Label, Type: vt})
+	}
+	return mapped, nil
+}
+
+// defType returns a copy of the type definition with its references mapped. Component and instance types
+// have their own index spaces, only their outer aliases to the enclosing component are mapped.
+func (x indices) defType(def api.DefType) (api.DefType, error) {
+	var err error
+	switch t := def.(type) {
+	case api.PrimValType, *api.FlagsType, *api.EnumType:
+		return def, nil
+	case *api.RecordType:
+		fields, err := x.labelValTypes(t.Fields)
+		return &api.RecordType{Fields: fields}, err
+	case *api.VariantType:
+		cases := make([]api.VariantCase, 0, len(t.Cases))
+		for _, c := range t.Cases {
+			vt, err := x.valType(c.Type)
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, api.VariantCase{Label: c.Label, Type: vt})
+		}
+		return &api.VariantType{Cases: cases}, nil
+	case *api.ListType:
+		mapped := &api.ListType{}
+		mapped.Element, err = x.valType(t.Element)
+		return mapped, err
+	case *api.TupleType:
+		mapped := &api.TupleType{}
+		for _, element := range t.Types {
+			vt, err := x.valType(element)
+			if err != nil {
+				return nil, err
+			}
+			mapped.Types = append(mapped.Types, vt)
+		}
+		return mapped, nil
+	case *api.OptionType:
+		mapped := &api.OptionType{}
+		mapped.Type, err = x.valType(t.Type)
+		return mapped, err
+	case *api.ResultValType:
+		mapped := &api.ResultValType{}
+		if mapped.Ok, err = x.valType(t.Ok); err != nil {
+			return nil, err
+		}
+		mapped.Error, err = x.valType(t.Error)
+		return mapped, err
+	case *api.OwnType:
+		index, err := x.of(api.TypeSort, t.Type)
+		return &api.OwnType{Type: index}, err
+	case *api.BorrowType:
+		index, err := x.of(api.TypeSort, t.Type)
+		return &api.BorrowType{Type: index}, err
+	case *api.StreamType:
+		mapped := &api.StreamType{}
+		mapped.Element, err = x.valType(t.Element)
+		return mapped, err
+	case *api.FutureType:
+		mapped := &api.FutureType{}
+		mapped.Element, err = x.valType(t.Element)
+		return mapped, err
+	case *api.ComponentFuncType:
+		mapped := &api.ComponentFuncType{}
+		if mapped.Params, err = x.labelValTypes(t.Params); err != nil {
+			return nil, err
+		}
+		if mapped.Result, err = x.valType(t.Result); err != nil {
+			return nil, err
+		}
+		mapped.NamedResults, err = x.labelValTypes(t.NamedResults)
+		return mapped, err
+	case *api.ResourceType:
+		if t.Dtor != nil {
+			return nil, fmt.Errorf("resource destructors can not be declared in a world")
+		}
+		return def, nil
+	case *api.InstanceType:
+		declarations, err := x.declarations(t.Declarations, 1)
+		return &api.InstanceType{Declarations: declarations}, err
+	case *api.ComponentType:
+		declarations, err := x.declarations(t.Declarations, 1)
+		return &api.ComponentType{Declarations: declarations}, err
+	}
+	return nil, fmt.Errorf("unsupported type definition %T", def)
+}
+
+// declarations copies the declarations of a type nested depth levels below the mapped component
+func (x indices) declarations(declarations []api.Declaration, depth uint32) ([]api.Declaration, error) {
+	mapped := make([]api.Declaration, 0, len(declarations))
+	for _, declaration := range declarations {
+		switch d := declaration.(type) {
+		case *api.AliasDeclaration:
+			if outer, ok := d.Alias.Target.(*api.OuterAlias); ok && outer.Count == depth {
+				index, err := x.of(d.Alias.Sort, outer.Index)
+				if err != nil {
+					return nil, err
+				}
+				declaration = &api.AliasDeclaration{Alias: api.Alias{
+					Sort:   d.Alias.Sort,
+					Target: &api.OuterAlias{Count: outer.Count, Index: index},
+				}}
+			}
+		case *api.TypeDeclaration:
+			switch t := d.Type.(type) {
+			case *api.InstanceType:
+				nested, err := x.declarations(t.Declarations, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				declaration = &api.TypeDeclaration{Type: &api.InstanceType{Declarations: nested}}
+			case *api.ComponentType:
+				nested, err := x.declarations(t.Declarations, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				declaration = &api.TypeDeclaration{Type: &api.ComponentType{Declarations: nested}}
+			}
+		}
+		mapped = append(mapped, declaration)
+	}
+	return mapped, nil
+}
+
+func (x indices) externDesc(desc api.ExternDesc) (api.ExternDesc, error) {
+	switch d := desc.(type) {
+	case *api.InstanceExternDesc:
+		index, err := x.of(api.TypeSort, d.Type)
+		return &api.InstanceExternDesc{Type: index}, err
+	case *api.FuncExternDesc:
+		index, err := x.of(api.TypeSort, d.Type)
+		return &api.FuncExternDesc{Type: index}, err
+	case *api.ComponentExternDesc:
+		index, err := x.of(api.TypeSort, d.Type)
+		return &api.ComponentExternDesc{Type: index}, err
+	case *api.TypeExternDesc:
+		eq, ok := d.Bound.(*api.EqBound)
+		if !ok {
+			return desc, nil
+		}
+		index, err := x.of(api.TypeSort, eq.Type)
+		return &api.TypeExternDesc{Bound: &api.EqBound{Type: index}}, err
+	}
+	return nil, fmt.Errorf("unsupported extern description %T", desc)
+}
+
+func (x indices) alias(alias api.Alias) (api.Alias, error) {
+	target, ok := alias.Target.(*api.ExportAlias)
+	if !ok {
+		return alias, fmt.Errorf("unsupported alias target %T", alias.Target)
+	}
+	instance, err := x.of(api.InstanceSort, target.Instance)
+	if err != nil {
+		return alias, err
+	}
+	return api.Alias{Sort: alias.Sort, Target: &api.ExportAlias{Instance: instance, Name: target.Name}}, nil
+}
+
+// world adds the declarations of the body of a world type to the component. Imports become imports of the
+// component unless an earlier world imported the same name. Exports do not add to the index spaces of the
+// body, so they are passed to export once the other declarations have been added. A nil export rejects
+// worlds with exports.
+func (c *composer) world(body *api.ComponentType, export func(d *api.ExportDeclaration, x indices) error) error {
+	x := indices{}
+	var exports []*api.ExportDeclaration
+	for _, declaration := range body.Declarations {
+		switch d := declaration.(type) {
+		case *api.TypeDeclaration:
+			def, err := x.defType(d.Type)
+			if err != nil {
+				return err
+			}
+			c.add(&api.TypeSection{Types: []api.DefType{def}})
+			index := c.next(api.TypeSort)
+			c.types[index] = def
+			x.add(api.TypeSort, index)
+		case *api.AliasDeclaration:
+			alias, err := x.alias(d.Alias)
+			if err != nil {
+				return err
+			}
+			c.add(&api.AliasSection{Aliases: []api.Alias{alias}})
+			x.add(alias.Sort, c.next(alias.Sort))
+		case *api.ImportDeclaration:
+			sort, err := externSort(d.Desc)
+			if err != nil {
+				return fmt.Errorf("import '%s': %w", d.Name, err)
+			}
+			if arg, ok := c.imports[d.Name]; ok {
+				if arg.Sort != sort {
+					return fmt.Errorf("import '%s' is imported with different kinds", d.Name)
+				}
+				x.add(sort, arg.Index)
+				continue
+			}
+			desc, err := x.externDesc(d.Desc)
+			if err != nil {
+				return fmt.Errorf("import '%s': %w", d.Name, err)
+			}
+			c.add(&api.ImportSection{Imports: []api.ComponentImport{{Name: d.Name, Desc: desc}}})
+			arg := api.InstantiateArg{Name: d.Name, Sort: sort, Index: c.next(sort)}
+			c.imports[d.Name] = arg
+			x.add(sort, arg.Index)
+		case *api.ExportDeclaration:
+			if export == nil {
+				return fmt.Errorf("unexpected export '%s'", d.Name)
+			}
+			exports = append(exports, d)
+		default:
+			return fmt.Errorf("unexpected world declaration %T", declaration)
+		}
+	}
+	for _, d := range exports {
+		if err := export(d, x); err != nil {
+			return fmt.Errorf("export '%s': %w", d.Name, err)
+		}
+	}
+	return nil
+}
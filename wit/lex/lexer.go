@@ -1,7 +1,6 @@
 package lex
 
 import (
-	"fmt"
 	"unicode"
 	"unicode/utf8"
 
@@ -11,6 +10,7 @@ import (
 	"github.com/patrickhuber/go-types/handle"
 	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 )
 
 type Lexer struct {
@@ -20,6 +20,9 @@ type Lexer struct {
 	column    int
 	line      int
 	peekToken *token.Token
+	// Reporter records the diagnostics of the input, its end is the end of the last token returned by Next
+	// that is not whitespace or a comment
+	diagnostic.Reporter
 }
 
 func (l *Lexer) Line() int {
@@ -36,6 +39,7 @@ func New(input string) *Lexer {
 		position: 0,
 		column:   0,
 		line:     0,
+		Reporter: diagnostic.NewReporter("", input),
 	}
 }
 
@@ -49,21 +53,45 @@ func (l *Lexer) Clone() *Lexer {
 		column:    l.column,
 		line:      l.line,
 		peekToken: l.peekToken,
+		Reporter:  l.Reporter.Clone(),
 	}
 }
 
 func (l *Lexer) Next() (*token.Token, error) {
 	// any peek token?
-	if l.peekToken == nil {
-		return l.next().Deconstruct()
-	}
-
 	tok := l.peekToken
 	l.peekToken = nil
+	if tok == nil {
+		var err error
+		tok, err = l.next().Deconstruct()
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	switch tok.Type {
+	case token.Whitespace, token.LineComment, token.BlockComment:
+	default:
+		l.Accept(tok.Span())
+	}
 	return tok, nil
 }
 
+// NewFile returns a lexer for the input read from the named file. The name is used in diagnostics.
+func NewFile(name string, input string) *Lexer {
+	l := New(input)
+	l.Reporter = diagnostic.NewReporter(name, input)
+	return l
+}
+
+// Rewind moves the lexer back to the position of a clone. Diagnostics reported since the clone was taken are kept.
+func (l *Lexer) Rewind(clone *Lexer) {
+	reporter := l.Reporter
+	reporter.Rewind(&clone.Reporter)
+	*l = *clone
+	l.Reporter = reporter
+}
+
 func (l *Lexer) Peek() (*token.Token, error) {
 
 	// always return the peek token if it exists
@@ -177,7 +205,7 @@ func (l *Lexer) next() (res types.Result[*token.Token]) {
 		return l.token(token.Integer)
 	}
 
-	return result.Errorf[*token.Token]("%w : unrecognized character %c", l.lexerError(), r)
+	return result.Error[*token.Token](l.lexerError())
 }
 
 var keywordMap = map[string]token.TokenType{
@@ -194,6 +222,8 @@ var keywordMap = map[string]token.TokenType{
 	"s64":         token.S64,
 	"float32":     token.Float32,
 	"float64":     token.Float64,
+	"f32":         token.Float32,
+	"f64":         token.Float64,
 	"char":        token.Char,
 	"resource":    token.Resource,
 	"own":         token.Own,
@@ -225,6 +255,12 @@ var keywordMap = map[string]token.TokenType{
 	"with":        token.With,
 }
 
+// IsKeyword returns true if the identifier is a keyword and must be written as an explicit id with a `%` prefix
+func IsKeyword(id string) bool {
+	_, ok := keywordMap[id]
+	return ok
+}
+
 func (l *Lexer) token(ty token.TokenType) types.Result[*token.Token] {
 
 	// snapshot the state for the current token
@@ -323,7 +359,8 @@ func (l *Lexer) readRune() (res types.Option[rune]) {
 }
 
 func (l *Lexer) lexerError() error {
-	return fmt.Errorf("error parsing at line: %d column: %d position: %d", l.line, l.column, l.position)
+	start := diagnostic.Position{Offset: l.offset, Line: l.line, Column: l.column}
+	return l.Unrecognized(start, l.input[l.offset:l.position])
 }
 
 func isKeyLikeStart(ch rune) bool {
@@ -3,61 +3,104 @@
 package wit
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/patrickhuber/go-types"
 	"github.com/patrickhuber/go-types/handle"
 	"github.com/patrickhuber/go-types/option"
 	"github.com/patrickhuber/go-types/result"
+	"github.com/patrickhuber/go-wasm/diagnostic"
 	"github.com/patrickhuber/go-wasm/wit/ast"
 	"github.com/patrickhuber/go-wasm/wit/lex"
 	"github.com/patrickhuber/go-wasm/wit/token"
 )
 
+// Parse parses the wit source. Items that fail to parse are skipped so every error in the source is reported.
+// The error is a diagnostic.List and the tree holds the items that parsed successfully.
 func Parse(input string) (*ast.Ast, error) {
-	lexer := lex.New(input)
-	return parseAst(lexer).Deconstruct()
+	return parse(lex.New(input))
+}
+
+// ParseFile parses wit source read from the named file. The name is used in diagnostics.
+func ParseFile(name string, input string) (*ast.Ast, error) {
+	return parse(lex.NewFile(name, input))
+}
+
+func parse(lexer *lex.Lexer) (*ast.Ast, error) {
+	tree, err := parseAst(lexer).Deconstruct()
+	if err != nil {
+		lexer.ReportError(err)
+	}
+	return tree, lexer.Diagnostics().Err()
 }
 
 func parseAst(lexer *lex.Lexer) (res types.Result[*ast.Ast]) {
 	defer handle.Error(&res)
 
-	tok := next(lexer).Unwrap()
-	n := &ast.Ast{}
-
-	switch tok.Type {
-	case token.Package:
-		packageDeclaration := parsePackageDeclaration(lexer).Unwrap()
-		n.PackageDeclaration = option.Some(*packageDeclaration)
-		tok = next(lexer).Unwrap()
-	default:
-		n.PackageDeclaration = option.None[ast.PackageDeclaration]()
+	n := &ast.Ast{
+		PackageDeclaration: option.None[ast.PackageDeclaration](),
 	}
 
-	for tok.Type != token.EndOfStream {
-		item := &ast.AstItem{}
-		switch tok.Type {
-		case token.Use:
-			item.Use = parseTopLevelUse(lexer).Unwrap()
-		case token.World:
-			item.World = parseWorld(lexer).Unwrap()
-		case token.Interface:
-			item.Interface = parseInterface(lexer).Unwrap()
+	if peek(lexer).Unwrap().Type == token.Package {
+		start := lexer.Clone()
+		packageDeclaration, err := parsePackageDeclaration(lexer).Deconstruct()
+		if err == nil {
+			n.PackageDeclaration = option.Some(*packageDeclaration)
+		} else if synchronize(lexer, start, err, false) != nil {
+			n.Span = diagnostic.Span{End: lexer.End()}
+			return result.Ok(n)
 		}
-		n.Items = append(n.Items, *item)
+	}
 
-		tok = next(lexer).Unwrap()
+	for peek(lexer).Unwrap().Type != token.EndOfStream {
+		start := lexer.Clone()
+		item, err := parseAstItem(lexer).Deconstruct()
+		if err == nil {
+			n.Items = append(n.Items, *item)
+			continue
+		}
+		if synchronize(lexer, start, err, false) != nil {
+			break
+		}
 	}
+	n.Span = diagnostic.Span{End: lexer.End()}
 	return result.Ok(n)
 }
 
+func parseAstItem(lexer *lex.Lexer) (res types.Result[*ast.AstItem]) {
+	defer handle.Error(&res)
+
+	gates := parseGates(lexer).Unwrap()
+	tok := peek(lexer).Unwrap()
+	item := &ast.AstItem{}
+	switch tok.Type {
+	case token.Use:
+		if len(gates) > 0 {
+			return result.Error[*ast.AstItem](diagnostic.New(tok.Span(), "feature gates are not allowed on top level use"))
+		}
+		item.Use = parseTopLevelUse(lexer).Unwrap()
+	case token.World:
+		item.World = parseWorld(lexer).Unwrap()
+		item.World.Gates = gates
+	case token.Interface:
+		item.Interface = parseInterface(lexer).Unwrap()
+		item.Interface.Gates = gates
+	default:
+		return result.Error[*ast.AstItem](unexpected(tok, token.Use, token.World, token.Interface))
+	}
+	return result.Ok(item)
+}
+
 func parsePackageDeclaration(lexer *lex.Lexer) (res types.Result[*ast.PackageDeclaration]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Package).Unwrap()
+
 	// id
 	packageName := &ast.PackageDeclaration{}
-	packageName.Namespace = next(lexer).Unwrap().Capture
+	packageName.Namespace = parseId(lexer).Unwrap()
 
 	// ':'
 	expect(lexer, token.Colon).Unwrap()
@@ -74,12 +117,14 @@ func parsePackageDeclaration(lexer *lex.Lexer) (res types.Result[*ast.PackageDec
 	}
 	// ;
 	expect(lexer, token.Semicolon).Unwrap()
+	packageName.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(packageName)
 }
 
 func parseVersion(lexer *lex.Lexer) (res types.Result[*ast.Version]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	major := parseInteger(lexer).Unwrap()
 	expect(lexer, token.Period).Unwrap()
 
@@ -88,16 +133,192 @@ func parseVersion(lexer *lex.Lexer) (res types.Result[*ast.Version]) {
 
 	patch := parseInteger(lexer).Unwrap()
 
-	return result.Ok(&ast.Version{
+	version := &ast.Version{
 		Major: uint64(major),
 		Minor: uint64(minor),
 		Patch: uint64(patch),
-	})
+	}
+
+	// pre release and build metadata must immediately follow the patch
+	if eatAdjacent(lexer, token.Minus).Unwrap() {
+		version.Pre = parseVersionSuffix(lexer).Unwrap()
+	}
+	if eatAdjacent(lexer, token.Plus).Unwrap() {
+		version.Build = parseVersionSuffix(lexer).Unwrap()
+	}
+	version.Span = lexer.SpanFrom(start.Span())
+	return result.Ok(version)
+}
+
+// parseVersionSuffix parses the dot separated identifiers of a semver pre release or build
+// a trailing '.' that is not followed by an identifier is left for the caller. This allows
+// `use a:b/c@1.0.0-rc.{d}` to parse
+func parseVersionSuffix(lexer *lex.Lexer) (res types.Result[string]) {
+	defer handle.Error(&res)
+
+	suffix := ""
+	for {
+		tok := result.New(lexer.Peek()).Unwrap()
+		switch tok.Type {
+		case token.Id, token.Integer, token.Minus:
+			suffix += result.New(lexer.Next()).Unwrap().Capture
+			continue
+		case token.Period:
+			clone := lexer.Clone()
+			_ = result.New(clone.Next()).Unwrap()
+			following := result.New(clone.Peek()).Unwrap()
+			if following.Type == token.Id || following.Type == token.Integer {
+				suffix += result.New(lexer.Next()).Unwrap().Capture
+				continue
+			}
+		}
+		break
+	}
+	if suffix == "" {
+		tok := peek(lexer).Unwrap()
+		d := diagnostic.New(tok.Span(), "expected version identifier but found %s", found(tok))
+		return result.Error[string](d)
+	}
+	return result.Ok(suffix)
+}
+
+// gate ::= '@since' '(' 'version' '=' valid-semver ( ',' 'feature' '=' id )? ')'
+//
+//	| '@unstable' '(' 'feature' '=' id ')'
+//	| '@deprecated' '(' 'version' '=' valid-semver ')'
+func parseGates(lexer *lex.Lexer) (res types.Result[[]ast.Gate]) {
+	defer handle.Error(&res)
+
+	var gates []ast.Gate
+	for peek(lexer).Unwrap().Type == token.At {
+		gates = append(gates, parseGate(lexer).Unwrap())
+	}
+	return result.Ok(gates)
+}
+
+func parseGate(lexer *lex.Lexer) (res types.Result[ast.Gate]) {
+	defer handle.Error(&res)
+
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.At).Unwrap()
+
+	tok := next(lexer).Unwrap()
+	if tok.Type != token.Id {
+		return result.Error[ast.Gate](unexpected(tok, "since", "unstable", "deprecated"))
+	}
+
+	expect(lexer, token.OpenParen).Unwrap()
+
+	var gate ast.Gate
+	switch tok.Capture {
+	case "since":
+		since := &ast.Since{
+			Version: *parseGateVersion(lexer).Unwrap(),
+			Feature: option.None[string](),
+		}
+		if eat(lexer, token.Comma).Unwrap() {
+			since.Feature = option.Some(parseGateFeature(lexer).Unwrap())
+		}
+		gate = since
+	case "unstable":
+		gate = &ast.Unstable{
+			Feature: parseGateFeature(lexer).Unwrap(),
+		}
+	case "deprecated":
+		gate = &ast.Deprecated{
+			Version: *parseGateVersion(lexer).Unwrap(),
+		}
+	default:
+		d := diagnostic.New(tok.Span(), "unrecognized feature gate '@%s'", tok.Capture)
+		d.Expected = describe("since", "unstable", "deprecated")
+		return result.Error[ast.Gate](d)
+	}
+
+	expect(lexer, token.CloseParen).Unwrap()
+
+	switch g := gate.(type) {
+	case *ast.Since:
+		g.Span = lexer.SpanFrom(start.Span())
+	case *ast.Unstable:
+		g.Span = lexer.SpanFrom(start.Span())
+	case *ast.Deprecated:
+		g.Span = lexer.SpanFrom(start.Span())
+	}
+	return result.Ok(gate)
+}
+
+// 'version' '=' valid-semver
+func parseGateVersion(lexer *lex.Lexer) (res types.Result[*ast.Version]) {
+	defer handle.Error(&res)
+	parseGateArgument(lexer, "version").Unwrap()
+	return parseVersion(lexer)
+}
+
+// 'feature' '=' id
+func parseGateFeature(lexer *lex.Lexer) (res types.Result[string]) {
+	defer handle.Error(&res)
+	parseGateArgument(lexer, "feature").Unwrap()
+	return parseId(lexer)
+}
+
+func parseGateArgument(lexer *lex.Lexer, name string) (res types.Result[any]) {
+	defer handle.Error(&res)
+	tok := next(lexer).Unwrap()
+	if tok.Type != token.Id || tok.Capture != name {
+		return result.Error[any](unexpected(tok, token.TokenType(name)))
+	}
+	expect(lexer, token.Equal).Unwrap()
+	return result.Ok[any](nil)
+}
+
+// applyGates assigns the gates to items that carry them
+func applyGates[T any](item T, gates []ast.Gate) T {
+	if len(gates) == 0 {
+		return item
+	}
+	var gated any = item
+	switch i := gated.(type) {
+	case *ast.FuncItem:
+		i.Gates = gates
+	case *ast.Use:
+		i.Gates = gates
+	case ast.Resource:
+		i.Gates = gates
+		gated = i
+	case *ast.Record:
+		i.Gates = gates
+	case *ast.Flags:
+		i.Gates = gates
+	case *ast.Variant:
+		i.Gates = gates
+	case *ast.Enum:
+		i.Gates = gates
+	case *ast.TypeItem:
+		i.Gates = gates
+	case *ast.Import:
+		i.Gates = gates
+	case *ast.Export:
+		i.Gates = gates
+	case *ast.Include:
+		i.Gates = gates
+	case *ast.Constructor:
+		i.Gates = gates
+	case ast.Static:
+		i.Gates = gates
+		gated = i
+	case ast.Method:
+		i.Func.Gates = gates
+		gated = i
+	}
+	return gated.(T)
 }
 
 func parseTopLevelUse(lexer *lex.Lexer) (res types.Result[*ast.TopLevelUse]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Use).Unwrap()
+
 	topLevelUse := &ast.TopLevelUse{
 		Item: parseUsePath(lexer).Unwrap(),
 	}
@@ -106,6 +327,8 @@ func parseTopLevelUse(lexer *lex.Lexer) (res types.Result[*ast.TopLevelUse]) {
 	} else {
 		topLevelUse.As = option.None[string]()
 	}
+	expect(lexer, token.Semicolon).Unwrap()
+	topLevelUse.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(topLevelUse)
 }
 
@@ -114,12 +337,16 @@ func parseInterface(lexer *lex.Lexer) (res types.Result[*ast.Interface]) {
 	defer handle.Error(&res)
 	inter := &ast.Interface{}
 
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Interface).Unwrap()
+
 	// id
 	inter.Name = parseId(lexer).Unwrap()
 
 	// '{' interface-items '}'
 	inter.Items = parseInterfaceItems(lexer).Unwrap()
 
+	inter.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(inter)
 }
 
@@ -128,7 +355,15 @@ func parseInterfaceItems(lexer *lex.Lexer) (res types.Result[[]ast.InterfaceItem
 	var items []ast.InterfaceItem
 	expect(lexer, token.OpenBrace).Unwrap()
 	for !eat(lexer, token.CloseBrace).Unwrap() {
-		items = append(items, parseInterfaceItem(lexer).Unwrap())
+		start := lexer.Clone()
+		item, err := parseInterfaceItem(lexer).Deconstruct()
+		if err == nil {
+			items = append(items, item)
+			continue
+		}
+		if err := synchronize(lexer, start, err, true); err != nil {
+			return result.Error[[]ast.InterfaceItem](err)
+		}
 	}
 	return result.Ok(items)
 }
@@ -136,6 +371,7 @@ func parseInterfaceItems(lexer *lex.Lexer) (res types.Result[[]ast.InterfaceItem
 func parseInterfaceItem(lexer *lex.Lexer) (res types.Result[ast.InterfaceItem]) {
 	defer handle.Error(&res)
 
+	gates := parseGates(lexer).Unwrap()
 	itemType := peek(lexer).Unwrap()
 	var item ast.InterfaceItem
 
@@ -154,12 +390,13 @@ func parseInterfaceItem(lexer *lex.Lexer) (res types.Result[ast.InterfaceItem])
 		item = parseEnum(lexer).Unwrap()
 	case token.Type:
 		item = parseTypeDef(lexer).Unwrap()
-
-	default:
-		// tok == id
+	case token.Id, token.ExplicitId:
 		item = parseFuncItem(lexer).Unwrap()
+	default:
+		return result.Error[ast.InterfaceItem](unexpected(itemType,
+			token.Use, token.Resource, token.Record, token.Flags, token.Variant, token.Enum, token.Type, token.Id))
 	}
-	return result.Ok(item)
+	return result.Ok(applyGates(item, gates))
 }
 
 func parseTypeDef(lexer *lex.Lexer) (res types.Result[ast.TypeDef]) {
@@ -183,7 +420,8 @@ func parseTypeDef(lexer *lex.Lexer) (res types.Result[ast.TypeDef]) {
 	case token.Type:
 		typeDef = parseTypeItem(lexer).Unwrap()
 	default:
-		return result.Errorf[ast.TypeDef]("error parsing TypeDef %w", parseError(ty))
+		return result.Error[ast.TypeDef](unexpected(ty,
+			token.Resource, token.Variant, token.Record, token.Flags, token.Enum, token.Type))
 	}
 	return result.Ok(typeDef)
 }
@@ -191,6 +429,7 @@ func parseTypeDef(lexer *lex.Lexer) (res types.Result[ast.TypeDef]) {
 func parseResource(lexer *lex.Lexer) (res types.Result[ast.Resource]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Resource).Unwrap()
 
 	id := parseId(lexer).Unwrap()
@@ -211,26 +450,34 @@ func parseResource(lexer *lex.Lexer) (res types.Result[ast.Resource]) {
 			tok = peek(lexer).Unwrap()
 		}
 		expect(lexer, token.CloseBrace).Unwrap()
+	default:
+		return result.Error[ast.Resource](unexpected(tok, token.Semicolon, token.OpenBrace))
 	}
 
 	return result.Ok(ast.Resource{
 		ID:      id,
 		Methods: methods,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseResourceMethod(lexer *lex.Lexer) (res types.Result[ast.ResourceMethod]) {
+	defer handle.Error(&res)
 
 	var resourceMethod ast.ResourceMethod
 
+	gates := parseGates(lexer).Unwrap()
+	start := peek(lexer).Unwrap()
+
 	// resource-method ::= 'constructor' param-list ';'
 	if eat(lexer, token.Constructor).Unwrap() {
 		parameters := parseParameters(lexer).Unwrap()
 		expect(lexer, token.Semicolon).Unwrap()
 		resourceMethod = &ast.Constructor{
 			ParameterList: parameters,
+			Span:          lexer.SpanFrom(start.Span()),
 		}
-		return result.Ok(resourceMethod)
+		return result.Ok(applyGates(resourceMethod, gates))
 	}
 
 	// the resource-method with func-item overlaps with the resource item static for the first two tokens
@@ -251,6 +498,7 @@ func parseResourceMethod(lexer *lex.Lexer) (res types.Result[ast.ResourceMethod]
 		funcItem := parseFuncItem(lexer).Unwrap()
 		resourceMethod = ast.Method{
 			Func: funcItem,
+			Span: funcItem.Span,
 		}
 	} else {
 		// resource-method ::= id ':' 'static' func-type ';'
@@ -260,15 +508,17 @@ func parseResourceMethod(lexer *lex.Lexer) (res types.Result[ast.ResourceMethod]
 		resourceMethod = ast.Static{
 			ID:       id,
 			FuncType: funcType,
+			Span:     lexer.SpanFrom(start.Span()),
 		}
 	}
-	return result.Ok(resourceMethod)
+	return result.Ok(applyGates(resourceMethod, gates))
 }
 
 func parseUse(lexer *lex.Lexer) (res types.Result[*ast.Use]) {
 	defer handle.Error(&res)
 
 	// 'use'
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Use).Unwrap()
 
 	// use-path
@@ -288,10 +538,12 @@ func parseUse(lexer *lex.Lexer) (res types.Result[*ast.Use]) {
 	return result.Ok(&ast.Use{
 		From:  from,
 		Names: names,
+		Span:  lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseUseName(lexer *lex.Lexer) types.Result[ast.UseName] {
+	start := peek(lexer).Unwrap()
 	name := ast.UseName{
 		Name: parseId(lexer).Unwrap(),
 		As:   option.None[string](),
@@ -301,6 +553,7 @@ func parseUseName(lexer *lex.Lexer) types.Result[ast.UseName] {
 	if eat(lexer, token.As).Unwrap() {
 		name.As = option.Some(parseId(lexer).Unwrap())
 	}
+	name.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(name)
 }
 
@@ -329,20 +582,22 @@ func parseItemList[T any](
 
 func parseUsePath(lexer *lex.Lexer) (res types.Result[*ast.UsePath]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	id := parseId(lexer).Unwrap()
 
 	// `foo`
 	if !eat(lexer, token.Colon).Unwrap() {
 		return result.Ok(&ast.UsePath{
-			Id: id,
+			Id:   id,
+			Span: lexer.SpanFrom(start.Span()),
 		})
 	}
 
 	// `foo:bar/baz@1.0`
-	return parsePath(lexer, id)
+	return parsePath(lexer, start, id)
 }
 
-func parsePath(lexer *lex.Lexer, namespace string) (res types.Result[*ast.UsePath]) {
+func parsePath(lexer *lex.Lexer, start *token.Token, namespace string) (res types.Result[*ast.UsePath]) {
 	defer handle.Error(&res)
 
 	pkgName := parseId(lexer).Unwrap()
@@ -350,7 +605,7 @@ func parsePath(lexer *lex.Lexer, namespace string) (res types.Result[*ast.UsePat
 	name := parseId(lexer).Unwrap()
 	version := parseOptionalVersion(lexer).Unwrap()
 	usePath := &ast.UsePath{
-		Id: "string",
+		Id: name,
 		Package: struct {
 			Id   *ast.PackageDeclaration
 			Name string
@@ -359,21 +614,29 @@ func parsePath(lexer *lex.Lexer, namespace string) (res types.Result[*ast.UsePat
 				Namespace: namespace,
 				Name:      pkgName,
 				Version:   version,
+				Span:      lexer.SpanFrom(start.Span()),
 			},
 			Name: name,
 		},
+		Span: lexer.SpanFrom(start.Span()),
 	}
 	return result.Ok(usePath)
 }
 
 func parseOptionalVersion(lexer *lex.Lexer) (res types.Result[types.Option[ast.Version]]) {
-	return result.Errorf[types.Option[ast.Version]]("not implemented")
+	defer handle.Error(&res)
+	if !eat(lexer, token.At).Unwrap() {
+		return result.Ok(option.None[ast.Version]())
+	}
+	version := parseVersion(lexer).Unwrap()
+	return result.Ok(option.Some(*version))
 }
 
 func parseFuncItem(lexer *lex.Lexer) (res types.Result[*ast.FuncItem]) {
 	defer handle.Error(&res)
 
 	// func-item ::= id ':' func-type ';'
+	start := peek(lexer).Unwrap()
 	id := parseId(lexer).Unwrap()
 	expect(lexer, token.Colon).Unwrap()
 	funcType := parseFunc(lexer).Unwrap()
@@ -382,6 +645,7 @@ func parseFuncItem(lexer *lex.Lexer) (res types.Result[*ast.FuncItem]) {
 	return result.Ok(&ast.FuncItem{
 		ID:       id,
 		FuncType: funcType,
+		Span:     lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -389,10 +653,12 @@ func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.FuncType]) {
 
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Func).Unwrap()
 
 	parameters := parseParameters(lexer).Unwrap()
 	results := &ast.ResultList{}
+	arrow := peek(lexer).Unwrap()
 	if eat(lexer, token.RightArrow).Unwrap() {
 		tok := peek(lexer).Unwrap()
 		if tok.Type == token.OpenParen {
@@ -400,6 +666,7 @@ func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.FuncType]) {
 		} else {
 			results.Anonymous = parseType(lexer).Unwrap()
 		}
+		results.Span = lexer.SpanFrom(arrow.Span())
 	} else {
 		results.Named = nil // ? []ast.Parameter{}
 	}
@@ -407,10 +674,12 @@ func parseFunc(lexer *lex.Lexer) (res types.Result[*ast.FuncType]) {
 	return result.Ok(&ast.FuncType{
 		Params:  parameters,
 		Results: results,
+		Span:    lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseParameters(lexer *lex.Lexer) (res types.Result[[]ast.Parameter]) {
+	defer handle.Error(&res)
 	var parameters []ast.Parameter
 
 	expect(lexer, token.OpenParen).Unwrap()
@@ -434,7 +703,7 @@ func parseParameters(lexer *lex.Lexer) (res types.Result[[]ast.Parameter]) {
 			expect(lexer, token.CloseParen).Unwrap()
 			break
 		} else {
-			return result.Errorf[[]ast.Parameter]("%w. expected ',' or ')' but found %s", parseError(peekTok), peekTok.Capture)
+			return result.Error[[]ast.Parameter](unexpected(peekTok, token.Comma, token.CloseParen))
 		}
 	}
 	return result.Ok(parameters)
@@ -443,12 +712,14 @@ func parseParameters(lexer *lex.Lexer) (res types.Result[[]ast.Parameter]) {
 func parseParameter(lexer *lex.Lexer) (res types.Result[*ast.Parameter]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	parameter := &ast.Parameter{}
 	parameter.Id = parseId(lexer).Unwrap()
 
 	expect(lexer, token.Colon).Unwrap()
 
 	parameter.Type = parseType(lexer).Unwrap()
+	parameter.Span = lexer.SpanFrom(start.Span())
 
 	return result.Ok(parameter)
 }
@@ -456,6 +727,7 @@ func parseParameter(lexer *lex.Lexer) (res types.Result[*ast.Parameter]) {
 func parseTypeItem(lexer *lex.Lexer) (res types.Result[*ast.TypeItem]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Type).Unwrap()
 
 	id := parseId(lexer).Unwrap()
@@ -467,24 +739,17 @@ func parseTypeItem(lexer *lex.Lexer) (res types.Result[*ast.TypeItem]) {
 	return result.Ok(&ast.TypeItem{
 		ID:   id,
 		Type: ty,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseType(lexer *lex.Lexer) (res types.Result[ast.Type]) {
 	defer handle.Error(&res)
 
-	name := next(lexer).Unwrap()
+	name := peek(lexer).Unwrap()
 
 	var ty ast.Type
 	switch name.Type {
-	case token.U32:
-		ty = &ast.U32{}
-	case token.String:
-		ty = &ast.String{}
-	case token.Float32:
-		ty = &ast.Float32{}
-	case token.Float64:
-		ty = &ast.Float64{}
 	case token.Stream:
 		ty = parseStream(lexer).Unwrap()
 	case token.Future:
@@ -498,30 +763,100 @@ func parseType(lexer *lex.Lexer) (res types.Result[ast.Type]) {
 	case token.Tuple:
 		ty = parseTuple(lexer).Unwrap()
 	case token.Own:
-		expect(lexer, token.Less).Unwrap()
-		ty = &ast.Own{
-			Id: parseId(lexer).Unwrap(),
-		}
-		expect(lexer, token.Greater).Unwrap()
+		ty = parseOwn(lexer).Unwrap()
 	case token.Borrow:
-		expect(lexer, token.Less).Unwrap()
-		ty = &ast.Borrow{
-			Id: parseId(lexer).Unwrap(),
-		}
-		expect(lexer, token.Greater).Unwrap()
+		ty = parseBorrow(lexer).Unwrap()
 	default:
-		ty = &ast.Id{Value: name.Capture}
+		ty = parsePrimitive(lexer).Unwrap()
 	}
 
 	return result.Ok(ty)
 }
 
+// parsePrimitive parses the single token types and type references
+func parsePrimitive(lexer *lex.Lexer) (res types.Result[ast.Type]) {
+	defer handle.Error(&res)
+
+	name := next(lexer).Unwrap()
+	span := name.Span()
+
+	var ty ast.Type
+	switch name.Type {
+	case token.U8:
+		ty = &ast.U8{Span: span}
+	case token.U16:
+		ty = &ast.U16{Span: span}
+	case token.U32:
+		ty = &ast.U32{Span: span}
+	case token.U64:
+		ty = &ast.U64{Span: span}
+	case token.S8:
+		ty = &ast.S8{Span: span}
+	case token.S16:
+		ty = &ast.S16{Span: span}
+	case token.S32:
+		ty = &ast.S32{Span: span}
+	case token.S64:
+		ty = &ast.S64{Span: span}
+	case token.Bool:
+		ty = &ast.Bool{Span: span}
+	case token.Char:
+		ty = &ast.Char{Span: span}
+	case token.String:
+		ty = &ast.String{Span: span}
+	case token.Float32:
+		ty = &ast.Float32{Span: span}
+	case token.Float64:
+		ty = &ast.Float64{Span: span}
+	case token.Id, token.ExplicitId:
+		ty = &ast.Id{Value: strings.TrimPrefix(name.Capture, "%"), Span: span}
+	default:
+		return result.Error[ast.Type](unexpected(name,
+			token.U8, token.U16, token.U32, token.U64,
+			token.S8, token.S16, token.S32, token.S64,
+			"f32", "f64", token.Char, token.Bool, token.String,
+			token.List, token.Option, token.Result, token.Tuple,
+			token.Future, token.Stream, token.Own, token.Borrow, token.Id))
+	}
+	return result.Ok(ty)
+}
+
+// own<T>
+func parseOwn(lexer *lex.Lexer) (res types.Result[*ast.Own]) {
+	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Own).Unwrap()
+	expect(lexer, token.Less).Unwrap()
+	id := parseId(lexer).Unwrap()
+	expect(lexer, token.Greater).Unwrap()
+	return result.Ok(&ast.Own{
+		Id:   id,
+		Span: lexer.SpanFrom(start.Span()),
+	})
+}
+
+// borrow<T>
+func parseBorrow(lexer *lex.Lexer) (res types.Result[*ast.Borrow]) {
+	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Borrow).Unwrap()
+	expect(lexer, token.Less).Unwrap()
+	id := parseId(lexer).Unwrap()
+	expect(lexer, token.Greater).Unwrap()
+	return result.Ok(&ast.Borrow{
+		Id:   id,
+		Span: lexer.SpanFrom(start.Span()),
+	})
+}
+
 // stream<T, Z>
 // stream<_, Z>
 // stream<T>
 // stream
 func parseStream(lexer *lex.Lexer) (res types.Result[*ast.Stream]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Stream).Unwrap()
 	stream := &ast.Stream{
 		End:     option.None[ast.Type](),
 		Element: option.None[ast.Type](),
@@ -538,12 +873,16 @@ func parseStream(lexer *lex.Lexer) (res types.Result[*ast.Stream]) {
 		}
 		expect(lexer, token.Greater).Unwrap()
 	}
+	stream.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(stream)
 }
 
 func parseFuture(lexer *lex.Lexer) (res types.Result[*ast.Future]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Future).Unwrap()
+
 	future := &ast.Future{
 		ItemType: option.None[ast.Type](),
 	}
@@ -554,34 +893,44 @@ func parseFuture(lexer *lex.Lexer) (res types.Result[*ast.Future]) {
 		expect(lexer, token.Greater).Unwrap()
 	}
 
+	future.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(future)
 }
 
 func parseList(lexer *lex.Lexer) (res types.Result[*ast.List]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.List).Unwrap()
 	expect(lexer, token.Less).Unwrap()
 	ty := parseType(lexer).Unwrap()
 	expect(lexer, token.Greater).Unwrap()
 	return result.Ok(&ast.List{
-		Type: ty,
+		ItemType: ty,
+		Span:     lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseOption(lexer *lex.Lexer) (res types.Result[*ast.Option]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Option).Unwrap()
 	expect(lexer, token.Less).Unwrap()
 	ty := parseType(lexer).Unwrap()
 	expect(lexer, token.Greater).Unwrap()
 	return result.Ok(&ast.Option{
-		Type: ty,
+		ItemType: ty,
+		Span:     lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseTuple(lexer *lex.Lexer) (res types.Result[*ast.Tuple]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Tuple).Unwrap()
 	tuple := &ast.Tuple{
 		Types: parseItemList[ast.Type](lexer, token.Less, token.Greater, parseType).Unwrap(),
 	}
+	tuple.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(tuple)
 }
 
@@ -591,6 +940,8 @@ func parseTuple(lexer *lex.Lexer) (res types.Result[*ast.Tuple]) {
 // result
 func parseResult(lexer *lex.Lexer) (res types.Result[*ast.Result]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.Result).Unwrap()
 	r := &ast.Result{
 		Ok:    option.None[ast.Type](),
 		Error: option.None[ast.Type](),
@@ -607,12 +958,16 @@ func parseResult(lexer *lex.Lexer) (res types.Result[*ast.Result]) {
 		}
 		expect(lexer, token.Greater).Unwrap()
 	}
+	r.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(r)
 }
 
 func parseWorld(lexer *lex.Lexer) (res types.Result[*ast.World]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
+	expect(lexer, token.World).Unwrap()
+
 	id := parseId(lexer).Unwrap()
 
 	expect(lexer, token.OpenBrace).Unwrap()
@@ -621,6 +976,7 @@ func parseWorld(lexer *lex.Lexer) (res types.Result[*ast.World]) {
 	world := &ast.World{
 		Id:    id,
 		Items: worldItems,
+		Span:  lexer.SpanFrom(start.Span()),
 	}
 	return result.Ok(world)
 }
@@ -629,7 +985,15 @@ func parseWorldItems(lexer *lex.Lexer) (res types.Result[[]ast.WorldItem]) {
 	defer handle.Error(&res)
 	var worldItems []ast.WorldItem
 	for !eat(lexer, token.CloseBrace).Unwrap() {
-		worldItems = append(worldItems, parseWorldItem(lexer).Unwrap())
+		start := lexer.Clone()
+		item, err := parseWorldItem(lexer).Deconstruct()
+		if err == nil {
+			worldItems = append(worldItems, item)
+			continue
+		}
+		if err := synchronize(lexer, start, err, true); err != nil {
+			return result.Error[[]ast.WorldItem](err)
+		}
 	}
 	return result.Ok(worldItems)
 }
@@ -637,6 +1001,7 @@ func parseWorldItems(lexer *lex.Lexer) (res types.Result[[]ast.WorldItem]) {
 func parseWorldItem(lexer *lex.Lexer) (res types.Result[ast.WorldItem]) {
 	defer handle.Error(&res)
 
+	gates := parseGates(lexer).Unwrap()
 	itemType := peek(lexer).Unwrap()
 	var worldItem ast.WorldItem
 	switch itemType.Type {
@@ -652,41 +1017,49 @@ func parseWorldItem(lexer *lex.Lexer) (res types.Result[ast.WorldItem]) {
 		worldItem = parseRecord(lexer).Unwrap()
 	case token.Variant:
 		worldItem = parseVariant(lexer).Unwrap()
+	case token.Flags:
+		worldItem = parseFlags(lexer).Unwrap()
+	case token.Enum:
+		worldItem = parseEnum(lexer).Unwrap()
 	case token.Resource:
 		worldItem = parseResource(lexer).Unwrap()
 	case token.Include:
 		worldItem = parseInclude(lexer).Unwrap()
 
 	default:
-		return result.Errorf[ast.WorldItem]("%w : Unrecognized world item '%s'. Expected (export, import, resource, use, type, include). Found token.%v",
-			parseErrorFromLexer(lexer),
-			itemType.Capture,
-			itemType.Type)
+		return result.Error[ast.WorldItem](unexpected(itemType,
+			token.Export, token.Import, token.Use, token.Type, token.Record, token.Variant,
+			token.Flags, token.Enum, token.Resource, token.Include))
 	}
-	return result.Ok(worldItem)
+	return result.Ok(applyGates(worldItem, gates))
 }
 
 func parseExport(lexer *lex.Lexer) (res types.Result[*ast.Export]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Export).Unwrap()
 	ty := parseExternType(lexer).Unwrap()
 	return result.Ok(&ast.Export{
 		ExternType: ty,
+		Span:       lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseImport(lexer *lex.Lexer) (res types.Result[*ast.Import]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Import).Unwrap()
 	ty := parseExternType(lexer).Unwrap()
 	return result.Ok(&ast.Import{
 		ExternType: ty,
+		Span:       lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseInclude(lexer *lex.Lexer) (res types.Result[ast.WorldItem]) {
 	defer handle.Error(&res)
 
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Include).Unwrap()
 
 	// include-item = 'include' use-path ';'
@@ -698,18 +1071,25 @@ func parseInclude(lexer *lex.Lexer) (res types.Result[ast.WorldItem]) {
 	if eat(lexer, token.With).Unwrap() {
 		expect(lexer, token.OpenBrace).Unwrap()
 		for !eat(lexer, token.CloseBrace).Unwrap() {
+			nameStart := peek(lexer).Unwrap()
 			id := parseId(lexer).Unwrap()
 			expect(lexer, token.As).Unwrap()
 			as := parseId(lexer).Unwrap()
 			include.Names = append(include.Names, ast.IncludeName{
 				Name: id,
 				As:   as,
+				Span: lexer.SpanFrom(nameStart.Span()),
 			})
+			if !eat(lexer, token.Comma).Unwrap() {
+				expect(lexer, token.CloseBrace).Unwrap()
+				break
+			}
 		}
 	} else {
 		expect(lexer, token.Semicolon).Unwrap()
 	}
 
+	include.Span = lexer.SpanFrom(start.Span())
 	return result.Ok[ast.WorldItem](include)
 }
 
@@ -720,16 +1100,11 @@ func parseExternType(lexer *lex.Lexer) (res types.Result[ast.ExternType]) {
 	// Clone the lexer and try to make progress with interface and function import/export
 	// if successful, apply the clone's progress to the input lexer and continue parsing
 	// if failed, try to parse using a use path
+	start := peek(lexer).Unwrap()
 	clone := lexer.Clone()
 	id := parseId(clone).Unwrap()
 	if !eat(clone, token.Colon).Unwrap() {
-
-		usePath := parseUsePath(lexer).Unwrap()
-		expect(lexer, token.Semicolon).Unwrap()
-
-		return result.Ok[ast.ExternType](&ast.ExternTypeUsePath{
-			UsePath: usePath,
-		})
+		return parseExternTypeUsePath(lexer)
 	}
 
 	tok := peek(clone).Unwrap()
@@ -742,18 +1117,37 @@ func parseExternType(lexer *lex.Lexer) (res types.Result[ast.ExternType]) {
 		return result.Ok[ast.ExternType](&ast.ExternTypeFunc{
 			ID:   id,
 			Func: function,
+			Span: lexer.SpanFrom(start.Span()),
 		})
 	case token.Interface:
 		*lexer = *clone
 
 		expect(lexer, token.Interface).Unwrap()
+		items := parseInterfaceItems(lexer).Unwrap()
 		return result.Ok[ast.ExternType](&ast.ExternTypeInterface{
 			ID:             id,
-			InterfaceItems: parseInterfaceItems(lexer).Unwrap(),
+			InterfaceItems: items,
+			Span:           lexer.SpanFrom(start.Span()),
 		})
+	case token.Id, token.ExplicitId:
+		// `foo:bar/baz@1.0`
+		return parseExternTypeUsePath(lexer)
 	}
 
-	return result.Errorf[ast.ExternType]("unable to parse ExternType %w", parseError(tok))
+	return result.Error[ast.ExternType](unexpected(tok, token.Func, token.Interface, token.Id))
+}
+
+func parseExternTypeUsePath(lexer *lex.Lexer) (res types.Result[ast.ExternType]) {
+	defer handle.Error(&res)
+
+	start := peek(lexer).Unwrap()
+	usePath := parseUsePath(lexer).Unwrap()
+	expect(lexer, token.Semicolon).Unwrap()
+
+	return result.Ok[ast.ExternType](&ast.ExternTypeUsePath{
+		UsePath: usePath,
+		Span:    lexer.SpanFrom(start.Span()),
+	})
 }
 
 // record-item ::= 'record' id '{' record-fields '}'
@@ -763,6 +1157,7 @@ func parseRecord(lexer *lex.Lexer) (res types.Result[*ast.Record]) {
 	defer handle.Error(&res)
 
 	// 'record'
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Record).Unwrap()
 
 	name := parseId(lexer).Unwrap()
@@ -775,15 +1170,17 @@ func parseRecord(lexer *lex.Lexer) (res types.Result[*ast.Record]) {
 	return result.Ok(&ast.Record{
 		ID:     name,
 		Fields: fields,
+		Span:   lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseRecordField(lexer *lex.Lexer) (res types.Result[ast.Field]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	id := parseId(lexer).Unwrap()
 	expect(lexer, token.Colon).Unwrap()
 	ty := parseType(lexer).Unwrap()
-	return result.Ok(ast.Field{Name: id, Type: ty})
+	return result.Ok(ast.Field{Name: id, Type: ty, Span: lexer.SpanFrom(start.Span())})
 }
 
 // flags-items ::= 'flags' id '{' flags-fields '}'
@@ -792,19 +1189,23 @@ func parseFlags(lexer *lex.Lexer) (res types.Result[*ast.Flags]) {
 	defer handle.Error(&res)
 
 	// 'flags'
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Flags).Unwrap()
 
 	name := parseId(lexer).Unwrap()
 	flagList := parseItemList(lexer, token.OpenBrace, token.CloseBrace, func(l *lex.Lexer) types.Result[ast.Flag] {
+		start := peek(lexer).Unwrap()
 		id := parseId(lexer).Unwrap()
 		return result.Ok(ast.Flag{
-			Id: id,
+			Id:   id,
+			Span: lexer.SpanFrom(start.Span()),
 		})
 	}).Unwrap()
 
 	return result.Ok(&ast.Flags{
 		ID:    name,
 		Flags: flagList,
+		Span:  lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -815,6 +1216,7 @@ func parseVariant(lexer *lex.Lexer) (res types.Result[*ast.Variant]) {
 	defer handle.Error(&res)
 
 	// 'variant'
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Variant).Unwrap()
 
 	// id
@@ -830,11 +1232,13 @@ func parseVariant(lexer *lex.Lexer) (res types.Result[*ast.Variant]) {
 		&ast.Variant{
 			ID:    name,
 			Cases: cases,
+			Span:  lexer.SpanFrom(start.Span()),
 		})
 }
 
 func parseVariantCase(lexer *lex.Lexer) (res types.Result[ast.Case]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	name := parseId(lexer).Unwrap()
 	c := &ast.Case{
 		Name: name,
@@ -845,6 +1249,7 @@ func parseVariantCase(lexer *lex.Lexer) (res types.Result[ast.Case]) {
 		expect(lexer, token.CloseParen).Unwrap()
 		c.Type = option.Some(ty)
 	}
+	c.Span = lexer.SpanFrom(start.Span())
 	return result.Ok(*c)
 }
 
@@ -854,6 +1259,7 @@ func parseEnum(lexer *lex.Lexer) (res types.Result[*ast.Enum]) {
 	defer handle.Error(&res)
 
 	// 'enum'
+	start := peek(lexer).Unwrap()
 	expect(lexer, token.Enum).Unwrap()
 
 	// id
@@ -868,14 +1274,17 @@ func parseEnum(lexer *lex.Lexer) (res types.Result[*ast.Enum]) {
 	return result.Ok(&ast.Enum{
 		Cases: cases,
 		ID:    id,
+		Span:  lexer.SpanFrom(start.Span()),
 	})
 }
 
 func parseEnumCase(lexer *lex.Lexer) (res types.Result[ast.EnumCase]) {
 	defer handle.Error(&res)
+	start := peek(lexer).Unwrap()
 	id := parseId(lexer).Unwrap()
 	return result.Ok(ast.EnumCase{
 		Name: id,
+		Span: lexer.SpanFrom(start.Span()),
 	})
 }
 
@@ -886,9 +1295,10 @@ func parseId(lexer *lex.Lexer) (res types.Result[string]) {
 	case token.Id:
 		return result.Ok(tok.Capture)
 	case token.ExplicitId:
-		return result.Ok(tok.Capture)
+		// %id allows keywords to be used as identifiers
+		return result.Ok(strings.TrimPrefix(tok.Capture, "%"))
 	default:
-		return result.Errorf[string]("%w : found value '%s', type '%v' but expected (id, explicit_id)", parseError(tok), tok.Capture, tok.Type)
+		return result.Error[string](unexpected(tok, token.Id))
 	}
 }
 
@@ -898,11 +1308,27 @@ func parseInteger(lexer *lex.Lexer) (res types.Result[int64]) {
 	switch tok.Type {
 	case token.Integer:
 		i, err := strconv.ParseInt(tok.Capture, 0, 32)
-		return result.New(i, err)
+		if err != nil {
+			return result.Error[int64](diagnostic.New(tok.Span(), "invalid integer '%s'", tok.Capture))
+		}
+		return result.Ok(i)
 	default:
-		return result.Errorf[int64]("%w: found value '%s', type '%v' but expected (integer) ", parseError(tok), tok.Capture, tok.Type)
+		return result.Error[int64](unexpected(tok, token.Integer))
+	}
+}
+
+// eatAdjacent consumes the next token only if it has the given type and is not preceded by whitespace or comments
+func eatAdjacent(lexer *lex.Lexer, tokenType token.TokenType) (res types.Result[bool]) {
+	defer handle.Error(&res)
+
+	tok := result.New(lexer.Peek()).Unwrap()
+	if !is(tok, tokenType) {
+		return result.Ok(false)
 	}
+	_ = result.New(lexer.Next()).Unwrap()
+	return result.Ok(true)
 }
+
 func eat(lexer *lex.Lexer, tokenType token.TokenType) (res types.Result[bool]) {
 	defer handle.Error(&res)
 
@@ -921,7 +1347,7 @@ func expect(lexer *lex.Lexer, tokenType token.TokenType) (res types.Result[any])
 	if tok.Type == tokenType {
 		return result.Ok[any](nil)
 	}
-	return result.Errorf[any]("%w. expected '%v' but found '%v'", parseError(tok), tokenType, tok.Type)
+	return result.Error[any](unexpected(tok, tokenType))
 }
 
 func peek(lexer *lex.Lexer) (res types.Result[*token.Token]) {
@@ -965,21 +1391,81 @@ func is(tok *token.Token, tokenType token.TokenType) bool {
 	return tok.Type == tokenType
 }
 
-func parseError(tok *token.Token) error {
-	line := tok.Line + 1
-	col := tok.Column + 1
-	return fmt.Errorf(
-		"error parsing at line %d, column %d, position %d",
-		line,
-		col,
-		tok.Position)
+// unexpected returns a diagnostic for a token that is not one of the expected token types
+func unexpected(tok *token.Token, expected ...token.TokenType) *diagnostic.Diagnostic {
+	d := diagnostic.New(tok.Span(), "unexpected %s", found(tok))
+	d.Expected = describe(expected...)
+	return d
+}
+
+// found describes the token in diagnostics
+func found(tok *token.Token) string {
+	if tok.Type == token.EndOfStream {
+		return "end of input"
+	}
+	return "'" + tok.Capture + "'"
+}
+
+// describe returns the text used for token types in diagnostics, keywords and punctuation are quoted
+func describe(tokenTypes ...token.TokenType) []string {
+	descriptions := make([]string, 0, len(tokenTypes))
+	for _, tokenType := range tokenTypes {
+		switch tokenType {
+		case token.Id, token.ExplicitId:
+			descriptions = append(descriptions, "identifier")
+		case token.Integer:
+			descriptions = append(descriptions, "integer")
+		case token.EndOfStream:
+			descriptions = append(descriptions, "end of input")
+		default:
+			descriptions = append(descriptions, "'"+string(tokenType)+"'")
+		}
+	}
+	return descriptions
+}
+
+// synchronize skips the item that failed to parse, see diagnostic.Synchronize
+func synchronize(lexer *lex.Lexer, start *lex.Lexer, err error, enclosed bool) error {
+	return diagnostic.Synchronize(lexer, start, err, func() (bool, error) {
+		return skip(lexer, enclosed).Deconstruct()
+	})
 }
 
-func parseErrorFromLexer(lexer *lex.Lexer) error {
-	line := lexer.Line() + 1
-	col := lexer.Column() + 1
-	return fmt.Errorf(
-		"error parsing at line %d, column %d",
-		line,
-		col)
+// skip consumes tokens through the ';' or the closing brace that ends the current item.
+// The end of input and, for enclosed items, the '}' that closes the enclosing block are not consumed.
+func skip(lexer *lex.Lexer, enclosed bool) (res types.Result[bool]) {
+	defer handle.Error(&res)
+
+	depth := 0
+	skipped := false
+	for {
+		tok := peek(lexer).Unwrap()
+		switch tok.Type {
+		case token.EndOfStream:
+			return result.Ok(skipped)
+		case token.OpenBrace:
+			depth++
+		case token.CloseBrace:
+			if depth == 0 {
+				if enclosed {
+					return result.Ok(skipped)
+				}
+				// an unbalanced '}' is skipped on its own
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+			depth--
+			if depth == 0 {
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+		case token.Semicolon:
+			if depth == 0 {
+				next(lexer).Unwrap()
+				return result.Ok(true)
+			}
+		}
+		next(lexer).Unwrap()
+		skipped = true
+	}
 }
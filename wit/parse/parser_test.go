@@ -1,11 +1,15 @@
 package wit_test
 
 import (
+	"errors"
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	"github.com/patrickhuber/go-wasm/wit/ast"
 	wit "github.com/patrickhuber/go-wasm/wit/parse"
 	"github.com/stretchr/testify/require"
 )
@@ -59,3 +63,116 @@ func TestParseFail(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGates(t *testing.T) {
+	type test struct {
+		name  string
+		input string
+	}
+	tests := []test{
+		{"interface", "package a:b; @since(version = 0.2.0) interface i {}"},
+		{"world", "package a:b; @unstable(feature = f) world w {}"},
+		{"func", "package a:b@0.2.0; interface i { @since(version = 0.2.0) @deprecated(version = 0.2.1) f: func(); }"},
+		{"since_feature", "package a:b; interface i { @since(version = 0.2.0, feature = f) type t = u32; }"},
+		{"resource", "package a:b; interface i { @since(version = 1.0.0) resource r { @unstable(feature = f) constructor(); @since(version = 1.0.0) m: func(); } }"},
+		{"world_items", "package a:b; world w { @since(version = 0.2.0) import i; @unstable(feature = f) export f: func(); }"},
+		{"pre_release", "package a:b@0.2.0-rc-2023-11-10; @since(version = 0.2.0-rc.1+build.5) interface i {}"},
+		{"use_version", "package a:b; interface i { use wasi:io/error@0.2.0.{error}; }"},
+		{"use_pre_release", "package a:b; interface i { use wasi:io/error@0.2.0-rc.1.{error}; }"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := wit.Parse(test.input)
+			require.NoError(t, err)
+			require.NotNil(t, node)
+		})
+	}
+}
+
+func TestParseGatesFail(t *testing.T) {
+	type test struct {
+		name  string
+		input string
+	}
+	tests := []test{
+		{"unknown_gate", "package a:b; @other(version = 0.2.0) interface i {}"},
+		{"missing_version", "package a:b; @since(feature = f) interface i {}"},
+		{"missing_item", "package a:b; @since(version = 0.2.0)"},
+		{"toplevel_use", "package a:b; @since(version = 0.2.0) use a:b/c;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := wit.Parse(test.input)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	input := "package a:b;\n\ninterface i {\n  f: func(x: list<u32>) -> string;\n}\n"
+	tree, err := wit.Parse(input)
+	require.NoError(t, err)
+
+	text := func(span diagnostic.Span) string {
+		return input[span.Start.Offset:span.End.Offset]
+	}
+
+	decl, ok := tree.PackageDeclaration.Deconstruct()
+	require.True(t, ok)
+	require.Equal(t, "package a:b;", text(decl.Span))
+
+	inter := tree.Items[0].Interface
+	require.Equal(t, "interface i {\n  f: func(x: list<u32>) -> string;\n}", text(inter.Span))
+	require.Equal(t, 2, inter.Span.Start.Line)
+	require.Equal(t, 0, inter.Span.Start.Column)
+
+	f := inter.Items[0].(*ast.FuncItem)
+	require.Equal(t, "f: func(x: list<u32>) -> string;", text(f.Span))
+	require.Equal(t, 3, f.Span.Start.Line)
+	require.Equal(t, 2, f.Span.Start.Column)
+	require.Equal(t, "func(x: list<u32>) -> string", text(f.FuncType.Span))
+	require.Equal(t, "x: list<u32>", text(f.FuncType.Params[0].Span))
+	require.Equal(t, "list<u32>", text(f.FuncType.Params[0].Type.(*ast.List).Span))
+	require.Equal(t, "-> string", text(f.FuncType.Results.Span))
+	require.Equal(t, "string", text(f.FuncType.Results.Anonymous.(*ast.String).Span))
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	input := "package a:b;\n\ninterface i {\n  f: func(x: ) -> u32;\n  g: func();\n}\n\nworld w {\n  import i:;\n  export j;\n}\n\ninterface k {}\n"
+	tree, err := wit.ParseFile("test.wit", input)
+	require.Error(t, err)
+
+	var diagnostics diagnostic.List
+	require.True(t, errors.As(err, &diagnostics))
+	require.Equal(t, 2, len(diagnostics))
+
+	expected := strings.Join([]string{
+		"test.wit:4:14: unexpected ')'",
+		"  |",
+		"4 |   f: func(x: ) -> u32;",
+		"  |              ^",
+		"  = expected one of 'u8', 'u16', 'u32', 'u64', 's8', 's16', 's32', 's64', 'f32', 'f64', 'char', 'bool', 'string', 'list', 'option', 'result', 'tuple', 'future', 'stream', 'own', 'borrow', identifier",
+	}, "\n")
+	require.Equal(t, expected, diagnostics[0].Error())
+
+	require.Equal(t, 8, diagnostics[1].Span.Start.Line)
+	require.Equal(t, 11, diagnostics[1].Span.Start.Column)
+	require.Equal(t, []string{"'func'", "'interface'", "identifier"}, diagnostics[1].Expected)
+
+	// the items that failed are skipped and the rest of the tree is kept
+	require.Equal(t, 3, len(tree.Items))
+	require.Equal(t, 1, len(tree.Items[0].Interface.Items))
+	require.Equal(t, "g", tree.Items[0].Interface.Items[0].(*ast.FuncItem).ID)
+	require.Equal(t, 1, len(tree.Items[1].World.Items))
+	require.Equal(t, "k", tree.Items[2].Interface.Name)
+}
+
+func TestParseLexerError(t *testing.T) {
+	_, err := wit.Parse("package a:b; interface i { f: func() -> $; }")
+	require.Error(t, err)
+
+	var d *diagnostic.Diagnostic
+	require.True(t, errors.As(err, &d))
+	require.Equal(t, "unrecognized token '$'", d.Message)
+	require.Equal(t, 40, d.Span.Start.Column)
+}
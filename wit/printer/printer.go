@@ -0,0 +1,415 @@
+// package printer writes the wit ast as wit text
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/WIT.md
+package printer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+	"github.com/patrickhuber/go-wasm/wit/lex"
+)
+
+const indentation = "  "
+
+// Print writes the package in tree followed by the packages in deps.
+// Dependencies are written with the nested package syntax `package ns:name { ... }`.
+func Print(writer io.Writer, tree *ast.Ast, deps ...*ast.Ast) error {
+	p := &printer{writer: writer}
+	p.ast(tree)
+	for _, dep := range deps {
+		p.newline()
+		p.nested(dep)
+	}
+	return p.err
+}
+
+// String returns the wit text of the package in tree
+func String(tree *ast.Ast) (string, error) {
+	var builder strings.Builder
+	err := Print(&builder, tree)
+	return builder.String(), err
+}
+
+type printer struct {
+	writer io.Writer
+	indent int
+	err    error
+}
+
+func (p *printer) write(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.writer, format, args...)
+}
+
+// line writes an indented line
+func (p *printer) line(format string, args ...any) {
+	p.write("%s", strings.Repeat(indentation, p.indent))
+	p.write(format, args...)
+	p.newline()
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+}
+
+func (p *printer) fail(format string, args ...any) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+// block writes the header followed by the body in braces. Empty blocks are written on a single line.
+func (p *printer) block(header string, empty bool, body func()) {
+	if empty {
+		p.line("%s {}", header)
+		return
+	}
+	p.line("%s {", header)
+	p.indent++
+	body()
+	p.indent--
+	p.line("}")
+}
+
+func (p *printer) ast(tree *ast.Ast) {
+	if decl, ok := tree.PackageDeclaration.Deconstruct(); ok {
+		p.line("package %s;", packageName(decl))
+		if len(tree.Items) > 0 {
+			p.newline()
+		}
+	}
+	p.items(tree.Items)
+}
+
+func (p *printer) nested(tree *ast.Ast) {
+	decl, ok := tree.PackageDeclaration.Deconstruct()
+	if !ok {
+		p.fail("nested packages require a package declaration")
+		return
+	}
+	p.block("package "+packageName(decl), len(tree.Items) == 0, func() {
+		p.items(tree.Items)
+	})
+}
+
+func (p *printer) items(items []ast.AstItem) {
+	for i, item := range items {
+		if i > 0 {
+			p.newline()
+		}
+		switch {
+		case item.Interface != nil:
+			p.gates(item.Interface.Gates)
+			p.block("interface "+id(item.Interface.Name), len(item.Interface.Items) == 0, func() {
+				p.interfaceItems(item.Interface.Items)
+			})
+		case item.World != nil:
+			p.gates(item.World.Gates)
+			p.block("world "+id(item.World.Id), len(item.World.Items) == 0, func() {
+				p.worldItems(item.World.Items)
+			})
+		case item.Use != nil:
+			if as, ok := item.Use.As.Deconstruct(); ok {
+				p.line("use %s as %s;", usePath(item.Use.Item), id(as))
+			} else {
+				p.line("use %s;", usePath(item.Use.Item))
+			}
+		}
+	}
+}
+
+func (p *printer) interfaceItems(items []ast.InterfaceItem) {
+	for _, item := range items {
+		switch i := item.(type) {
+		case *ast.FuncItem:
+			p.gates(i.Gates)
+			p.line("%s: %s;", id(i.ID), p.funcType(i.FuncType))
+		case *ast.Use:
+			p.use(i)
+		case ast.TypeDef:
+			p.typeDef(i)
+		default:
+			p.fail("unsupported interface item %T", item)
+		}
+	}
+}
+
+func (p *printer) worldItems(items []ast.WorldItem) {
+	for _, item := range items {
+		switch i := item.(type) {
+		case *ast.Import:
+			p.gates(i.Gates)
+			p.extern("import", i.ExternType)
+		case *ast.Export:
+			p.gates(i.Gates)
+			p.extern("export", i.ExternType)
+		case *ast.Use:
+			p.use(i)
+		case *ast.Include:
+			p.include(i)
+		case ast.TypeDef:
+			p.typeDef(i)
+		default:
+			p.fail("unsupported world item %T", item)
+		}
+	}
+}
+
+func (p *printer) extern(keyword string, externType ast.ExternType) {
+	switch e := externType.(type) {
+	case *ast.ExternTypeFunc:
+		p.line("%s %s: %s;", keyword, id(e.ID), p.funcType(e.Func))
+	case *ast.ExternTypeInterface:
+		p.block(fmt.Sprintf("%s %s: interface", keyword, id(e.ID)), len(e.InterfaceItems) == 0, func() {
+			p.interfaceItems(e.InterfaceItems)
+		})
+	case *ast.ExternTypeUsePath:
+		p.line("%s %s;", keyword, usePath(e.UsePath))
+	default:
+		p.fail("unsupported extern type %T", externType)
+	}
+}
+
+func (p *printer) use(use *ast.Use) {
+	p.gates(use.Gates)
+	names := make([]string, 0, len(use.Names))
+	for _, name := range use.Names {
+		if as, ok := name.As.Deconstruct(); ok {
+			names = append(names, id(name.Name)+" as "+id(as))
+		} else {
+			names = append(names, id(name.Name))
+		}
+	}
+	p.line("use %s.{%s};", usePath(use.From), strings.Join(names, ", "))
+}
+
+func (p *printer) include(include *ast.Include) {
+	p.gates(include.Gates)
+	if len(include.Names) == 0 {
+		p.line("include %s;", usePath(include.From))
+		return
+	}
+	names := make([]string, 0, len(include.Names))
+	for _, name := range include.Names {
+		names = append(names, id(name.Name)+" as "+id(name.As))
+	}
+	p.line("include %s with { %s }", usePath(include.From), strings.Join(names, ", "))
+}
+
+func (p *printer) typeDef(typeDef ast.TypeDef) {
+	switch t := typeDef.(type) {
+	case *ast.TypeItem:
+		p.gates(t.Gates)
+		p.line("type %s = %s;", id(t.ID), p.ty(t.Type))
+	case *ast.Record:
+		p.gates(t.Gates)
+		p.block("record "+id(t.ID), len(t.Fields) == 0, func() {
+			for _, field := range t.Fields {
+				p.line("%s: %s,", id(field.Name), p.ty(field.Type))
+			}
+		})
+	case *ast.Variant:
+		p.gates(t.Gates)
+		p.block("variant "+id(t.ID), len(t.Cases) == 0, func() {
+			for _, c := range t.Cases {
+				if ty, ok := c.Type.Deconstruct(); ok {
+					p.line("%s(%s),", id(c.Name), p.ty(ty))
+				} else {
+					p.line("%s,", id(c.Name))
+				}
+			}
+		})
+	case *ast.Enum:
+		p.gates(t.Gates)
+		p.block("enum "+id(t.ID), len(t.Cases) == 0, func() {
+			for _, c := range t.Cases {
+				p.line("%s,", id(c.Name))
+			}
+		})
+	case *ast.Flags:
+		p.gates(t.Gates)
+		p.block("flags "+id(t.ID), len(t.Flags) == 0, func() {
+			for _, flag := range t.Flags {
+				p.line("%s,", id(flag.Id))
+			}
+		})
+	case ast.Resource:
+		p.resource(&t)
+	case *ast.Resource:
+		p.resource(t)
+	default:
+		p.fail("unsupported type definition %T", typeDef)
+	}
+}
+
+func (p *printer) resource(resource *ast.Resource) {
+	p.gates(resource.Gates)
+	if len(resource.Methods) == 0 {
+		p.line("resource %s;", id(resource.ID))
+		return
+	}
+	p.block("resource "+id(resource.ID), false, func() {
+		for _, method := range resource.Methods {
+			switch m := method.(type) {
+			case *ast.Constructor:
+				p.gates(m.Gates)
+				p.line("constructor(%s);", p.params(m.ParameterList))
+			case ast.Method:
+				p.gates(m.Func.Gates)
+				p.line("%s: %s;", id(m.Func.ID), p.funcType(m.Func.FuncType))
+			case ast.Static:
+				p.gates(m.Gates)
+				p.line("%s: static %s;", id(m.ID), p.funcType(m.FuncType))
+			default:
+				p.fail("unsupported resource method %T", method)
+			}
+		}
+	})
+}
+
+func (p *printer) gates(gates []ast.Gate) {
+	for _, gate := range gates {
+		switch g := gate.(type) {
+		case *ast.Since:
+			if feature, ok := g.Feature.Deconstruct(); ok {
+				p.line("@since(version = %s, feature = %s)", g.Version.String(), id(feature))
+			} else {
+				p.line("@since(version = %s)", g.Version.String())
+			}
+		case *ast.Unstable:
+			p.line("@unstable(feature = %s)", id(g.Feature))
+		case *ast.Deprecated:
+			p.line("@deprecated(version = %s)", g.Version.String())
+		default:
+			p.fail("unsupported gate %T", gate)
+		}
+	}
+}
+
+func (p *printer) funcType(funcType *ast.FuncType) string {
+	text := "func(" + p.params(funcType.Params) + ")"
+	if funcType.Results == nil {
+		return text
+	}
+	if funcType.Results.Anonymous != nil {
+		return text + " -> " + p.ty(funcType.Results.Anonymous)
+	}
+	if len(funcType.Results.Named) > 0 {
+		return text + " -> (" + p.params(funcType.Results.Named) + ")"
+	}
+	return text
+}
+
+func (p *printer) params(params []ast.Parameter) string {
+	texts := make([]string, 0, len(params))
+	for _, param := range params {
+		texts = append(texts, id(param.Id)+": "+p.ty(param.Type))
+	}
+	return strings.Join(texts, ", ")
+}
+
+func (p *printer) ty(ty ast.Type) string {
+	switch t := ty.(type) {
+	case *ast.U8:
+		return "u8"
+	case *ast.U16:
+		return "u16"
+	case *ast.U32:
+		return "u32"
+	case *ast.U64:
+		return "u64"
+	case *ast.S8:
+		return "s8"
+	case *ast.S16:
+		return "s16"
+	case *ast.S32:
+		return "s32"
+	case *ast.S64:
+		return "s64"
+	case *ast.Float32:
+		return "f32"
+	case *ast.Float64:
+		return "f64"
+	case *ast.Char:
+		return "char"
+	case *ast.Bool:
+		return "bool"
+	case *ast.String:
+		return "string"
+	case *ast.List:
+		return "list<" + p.ty(t.ItemType) + ">"
+	case *ast.Option:
+		return "option<" + p.ty(t.ItemType) + ">"
+	case *ast.Tuple:
+		texts := make([]string, 0, len(t.Types))
+		for _, item := range t.Types {
+			texts = append(texts, p.ty(item))
+		}
+		return "tuple<" + strings.Join(texts, ", ") + ">"
+	case *ast.Result:
+		return "result" + p.pair(t.Ok, t.Error)
+	case *ast.Stream:
+		return "stream" + p.pair(t.Element, t.End)
+	case *ast.Future:
+		if item, ok := t.ItemType.Deconstruct(); ok {
+			return "future<" + p.ty(item) + ">"
+		}
+		return "future"
+	case *ast.Own:
+		return "own<" + id(t.Id) + ">"
+	case *ast.Borrow:
+		return "borrow<" + id(t.Id) + ">"
+	case *ast.Id:
+		return id(t.Value)
+	}
+	p.fail("unsupported type %T", ty)
+	return ""
+}
+
+// pair writes the optional type parameters of result and stream
+func (p *printer) pair(first, second types.Option[ast.Type]) string {
+	f, hasFirst := first.Deconstruct()
+	s, hasSecond := second.Deconstruct()
+	switch {
+	case hasFirst && hasSecond:
+		return "<" + p.ty(f) + ", " + p.ty(s) + ">"
+	case hasFirst:
+		return "<" + p.ty(f) + ">"
+	case hasSecond:
+		return "<_, " + p.ty(s) + ">"
+	}
+	return ""
+}
+
+func packageName(decl ast.PackageDeclaration) string {
+	name := id(decl.Namespace) + ":" + id(decl.Name)
+	if version, ok := decl.Version.Deconstruct(); ok {
+		name += "@" + version.String()
+	}
+	return name
+}
+
+func usePath(path *ast.UsePath) string {
+	if path.Package.Id == nil {
+		return id(path.Id)
+	}
+	decl := *path.Package.Id
+	name := id(decl.Namespace) + ":" + id(decl.Name) + "/" + id(path.Id)
+	if version, ok := decl.Version.Deconstruct(); ok {
+		name += "@" + version.String()
+	}
+	return name
+}
+
+// id escapes identifiers that collide with keywords
+func id(name string) string {
+	if lex.IsKeyword(name) {
+		return "%" + name
+	}
+	return name
+}
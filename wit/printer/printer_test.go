@@ -0,0 +1,81 @@
+package printer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patrickhuber/go-wasm/diagnostic"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/patrickhuber/go-wasm/wit/printer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	type test struct {
+		name  string
+		input string
+	}
+	tests := []test{
+		{"empty", `package a:b;`},
+		{"interface", `package a:b@1.0.0; interface i {}`},
+		{"func", `package a:b; interface i { f: func(a: u32, b: string) -> bool; g: func() -> (x: u8, y: s64); h: func(); }`},
+		{"primitives", `package a:b; interface i { f: func(a: u8, b: u16, c: u32, d: u64, e: s8, f: s16, g: s32, h: s64, i: f32, j: f64, k: char, l: bool, m: string); }`},
+		{"compound", `package a:b; interface i { f: func(a: list<u8>, b: option<string>, c: tuple<u32, f64>, d: result<u32, string>, e: result, f: result<_, u8>, g: result<u8>); }`},
+		{"async", `package a:b; interface i { f: func(a: stream<u8>, b: future<string>, c: future, d: stream); }`},
+		{"typedefs", `package a:b; interface i { record r { x: u32, y: list<string> } variant v { a, b(u32) } enum e { x, y } flags f { p, q } type t = r; record empty {} }`},
+		{"resource", `package a:b; interface i { resource r { constructor(x: u32); get: func() -> u32; make: static func() -> r; } resource s; f: func(a: borrow<r>, b: own<s>); }`},
+		{"use", `package a:b; interface i { use j.{r, s as t}; use c:d/e@0.2.0.{x}; }`},
+		{"world", `package a:b; world w { import i; export c:d/e@1.0.0; import h: func(x: u32); export k: interface { z: func(); } use i.{r}; type t = u32; include v; include c:d/w with { a as b, c as d } }`},
+		{"gates", `package a:b@1.0.0; @since(version = 0.2.0) interface i { @since(version = 0.2.0, feature = f) f: func(); @unstable(feature = g) @deprecated(version = 1.0.0) type t = u32; resource r { @since(version = 0.2.0) constructor(); @unstable(feature = x) m: func(); } } @unstable(feature = f) world w { @since(version = 1.0.0) import i; }`},
+		{"keywords", `package a:b; interface %interface { record %record { %type: %list } type %list = u8; }`},
+		{"top_level_use", `package a:b; use c:d/e as f; use c:d/g;`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := wit.Parse(test.input)
+			require.NoError(t, err)
+
+			text, err := printer.String(expected)
+			require.NoError(t, err)
+
+			actual, err := wit.Parse(text)
+			require.NoError(t, err, text)
+
+			// spans differ because the printed text is formatted differently than the input
+			diagnostic.Clear(expected)
+			diagnostic.Clear(actual)
+			require.Equal(t, expected, actual, text)
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	tree, err := wit.Parse(`package a:b@1.0.0; interface i { record r { x: u32 } f: func(r: r) -> result<_, string>; } world w { export i; }`)
+	require.NoError(t, err)
+	dep, err := wit.Parse(`package c:d; interface e { resource x; }`)
+	require.NoError(t, err)
+
+	var builder strings.Builder
+	require.NoError(t, printer.Print(&builder, tree, dep))
+
+	expected := `package a:b@1.0.0;
+
+interface i {
+  record r {
+    x: u32,
+  }
+  f: func(r: r) -> result<_, string>;
+}
+
+world w {
+  export i;
+}
+
+package c:d {
+  interface e {
+    resource x;
+  }
+}
+`
+	require.Equal(t, expected, builder.String())
+}
@@ -0,0 +1,243 @@
+// package resolve filters a parsed wit ast down to the items that are part of the package
+// for a given set of enabled features and target version
+// https://github.com/WebAssembly/component-model/blob/main/design/mvp/WIT.md#feature-gates
+package resolve
+
+import (
+	"fmt"
+
+	"github.com/patrickhuber/go-types"
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+)
+
+// Options controls which gated items are kept by Resolve
+type Options struct {
+	// Features is the set of enabled `@unstable` features
+	Features []string
+	// AllFeatures enables every `@unstable` feature
+	AllFeatures bool
+	// Version is the target version. Items with a `@since` version greater than the target are removed.
+	// When None, every `@since` item is kept.
+	Version types.Option[ast.Version]
+}
+
+// Resolve returns a copy of the ast with every item that is not enabled by the options removed
+func Resolve(tree *ast.Ast, options Options) (*ast.Ast, error) {
+	return newResolver(options).ast(tree)
+}
+
+// Enabled returns true if the gates allow an item under the options
+func Enabled(gates []ast.Gate, options Options) bool {
+	return newResolver(options).enabled(gates)
+}
+
+func newResolver(options Options) *resolver {
+	if options.Version == nil {
+		options.Version = option.None[ast.Version]()
+	}
+	r := &resolver{
+		options:  options,
+		features: map[string]struct{}{},
+	}
+	for _, feature := range options.Features {
+		r.features[feature] = struct{}{}
+	}
+	return r
+}
+
+type resolver struct {
+	options  Options
+	features map[string]struct{}
+}
+
+func (r *resolver) featureEnabled(feature string) bool {
+	if r.options.AllFeatures {
+		return true
+	}
+	_, ok := r.features[feature]
+	return ok
+}
+
+func (r *resolver) enabled(gates []ast.Gate) bool {
+	for _, gate := range gates {
+		switch g := gate.(type) {
+		case *ast.Unstable:
+			if !r.featureEnabled(g.Feature) {
+				return false
+			}
+		case *ast.Since:
+			// a since gate with a feature is enabled early when the feature is enabled
+			if feature, ok := g.Feature.Deconstruct(); ok && r.featureEnabled(feature) {
+				continue
+			}
+			target, ok := r.options.Version.Deconstruct()
+			if ok && g.Version.Compare(target) > 0 {
+				return false
+			}
+		case *ast.Deprecated:
+			// deprecation is informational and does not remove the item
+		}
+	}
+	return true
+}
+
+func (r *resolver) ast(tree *ast.Ast) (*ast.Ast, error) {
+	resolved := &ast.Ast{
+		PackageDeclaration: tree.PackageDeclaration,
+	}
+	interfaces := map[string]struct{}{}
+	worlds := map[string]struct{}{}
+	for _, item := range tree.Items {
+		switch {
+		case item.Interface != nil:
+			if !r.enabled(item.Interface.Gates) {
+				continue
+			}
+			if _, ok := interfaces[item.Interface.Name]; ok {
+				return nil, fmt.Errorf("duplicate interface '%s'", item.Interface.Name)
+			}
+			interfaces[item.Interface.Name] = struct{}{}
+			resolved.Items = append(resolved.Items, ast.AstItem{
+				Interface: r.iface(item.Interface),
+			})
+		case item.World != nil:
+			if !r.enabled(item.World.Gates) {
+				continue
+			}
+			if _, ok := worlds[item.World.Id]; ok {
+				return nil, fmt.Errorf("duplicate world '%s'", item.World.Id)
+			}
+			worlds[item.World.Id] = struct{}{}
+			resolved.Items = append(resolved.Items, ast.AstItem{
+				World: r.world(item.World),
+			})
+		default:
+			resolved.Items = append(resolved.Items, item)
+		}
+	}
+	return resolved, nil
+}
+
+func (r *resolver) iface(i *ast.Interface) *ast.Interface {
+	copy := *i
+	copy.Items = r.interfaceItems(i.Items)
+	return &copy
+}
+
+func (r *resolver) interfaceItems(items []ast.InterfaceItem) []ast.InterfaceItem {
+	var resolved []ast.InterfaceItem
+	for _, item := range items {
+		if !r.enabled(interfaceItemGates(item)) {
+			continue
+		}
+		if resource, ok := item.(ast.Resource); ok {
+			item = r.resource(resource)
+		}
+		resolved = append(resolved, item)
+	}
+	return resolved
+}
+
+func (r *resolver) world(w *ast.World) *ast.World {
+	copy := *w
+	copy.Items = nil
+	for _, item := range w.Items {
+		if !r.enabled(worldItemGates(item)) {
+			continue
+		}
+		switch i := item.(type) {
+		case ast.Resource:
+			item = r.resource(i)
+		case *ast.Import:
+			item = &ast.Import{Gates: i.Gates, ExternType: r.externType(i.ExternType)}
+		case *ast.Export:
+			item = &ast.Export{Gates: i.Gates, ExternType: r.externType(i.ExternType)}
+		}
+		copy.Items = append(copy.Items, item)
+	}
+	return &copy
+}
+
+func (r *resolver) externType(externType ast.ExternType) ast.ExternType {
+	i, ok := externType.(*ast.ExternTypeInterface)
+	if !ok {
+		return externType
+	}
+	return &ast.ExternTypeInterface{
+		ID:             i.ID,
+		InterfaceItems: r.interfaceItems(i.InterfaceItems),
+	}
+}
+
+func (r *resolver) resource(resource ast.Resource) ast.Resource {
+	methods := resource.Methods
+	resource.Methods = nil
+	for _, method := range methods {
+		if !r.enabled(resourceMethodGates(method)) {
+			continue
+		}
+		resource.Methods = append(resource.Methods, method)
+	}
+	return resource
+}
+
+func interfaceItemGates(item ast.InterfaceItem) []ast.Gate {
+	switch i := item.(type) {
+	case *ast.FuncItem:
+		return i.Gates
+	case *ast.Use:
+		return i.Gates
+	case ast.TypeDef:
+		return typeDefGates(i)
+	}
+	return nil
+}
+
+func worldItemGates(item ast.WorldItem) []ast.Gate {
+	switch i := item.(type) {
+	case *ast.Import:
+		return i.Gates
+	case *ast.Export:
+		return i.Gates
+	case *ast.Use:
+		return i.Gates
+	case *ast.Include:
+		return i.Gates
+	case ast.TypeDef:
+		return typeDefGates(i)
+	}
+	return nil
+}
+
+func typeDefGates(typeDef ast.TypeDef) []ast.Gate {
+	switch t := typeDef.(type) {
+	case ast.Resource:
+		return t.Gates
+	case *ast.Record:
+		return t.Gates
+	case *ast.Flags:
+		return t.Gates
+	case *ast.Variant:
+		return t.Gates
+	case *ast.Enum:
+		return t.Gates
+	case *ast.TypeItem:
+		return t.Gates
+	}
+	return nil
+}
+
+func resourceMethodGates(method ast.ResourceMethod) []ast.Gate {
+	switch m := method.(type) {
+	case *ast.Constructor:
+		return m.Gates
+	case ast.Static:
+		return m.Gates
+	case ast.Method:
+		if m.Func != nil {
+			return m.Func.Gates
+		}
+	}
+	return nil
+}
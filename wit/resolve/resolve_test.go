@@ -0,0 +1,187 @@
+package resolve_test
+
+import (
+	"testing"
+
+	"github.com/patrickhuber/go-types/option"
+	"github.com/patrickhuber/go-wasm/wit/ast"
+	wit "github.com/patrickhuber/go-wasm/wit/parse"
+	"github.com/patrickhuber/go-wasm/wit/resolve"
+	"github.com/stretchr/testify/require"
+)
+
+const input = `
+package wasi:test@0.3.0;
+
+@since(version = 0.2.0)
+interface stable {
+	@since(version = 0.2.0)
+	a: func();
+	@since(version = 0.3.0-rc.1)
+	b: func();
+	@unstable(feature = fancy)
+	c: func();
+	@since(version = 0.3.0, feature = early)
+	d: func();
+	@deprecated(version = 0.2.1)
+	e: func();
+	resource r {
+		@since(version = 0.2.0)
+		constructor();
+		@unstable(feature = fancy)
+		m: func();
+	}
+}
+
+@unstable(feature = fancy)
+interface experimental {
+	f: func();
+}
+
+world w {
+	@since(version = 0.2.0)
+	import stable;
+	@unstable(feature = fancy)
+	import experimental;
+}
+`
+
+func TestResolve(t *testing.T) {
+	type test struct {
+		name       string
+		options    resolve.Options
+		interfaces []string
+		funcs      []string
+		methods    int
+		imports    int
+	}
+	v := func(major, minor, patch uint64, pre string) ast.Version {
+		return ast.Version{Major: major, Minor: minor, Patch: patch, Pre: pre}
+	}
+	tests := []test{
+		{
+			name:       "none",
+			options:    resolve.Options{},
+			interfaces: []string{"stable"},
+			funcs:      []string{"a", "b", "d", "e"},
+			methods:    1,
+			imports:    1,
+		},
+		{
+			name:       "version",
+			options:    resolve.Options{Version: option.Some(v(0, 2, 5, ""))},
+			interfaces: []string{"stable"},
+			funcs:      []string{"a", "e"},
+			methods:    1,
+			imports:    1,
+		},
+		{
+			name:       "pre_release",
+			options:    resolve.Options{Version: option.Some(v(0, 3, 0, "rc.2"))},
+			interfaces: []string{"stable"},
+			funcs:      []string{"a", "b", "e"},
+			methods:    1,
+			imports:    1,
+		},
+		{
+			name:       "since_feature",
+			options:    resolve.Options{Version: option.Some(v(0, 2, 0, "")), Features: []string{"early"}},
+			interfaces: []string{"stable"},
+			funcs:      []string{"a", "d", "e"},
+			methods:    1,
+			imports:    1,
+		},
+		{
+			name:       "features",
+			options:    resolve.Options{Features: []string{"fancy"}},
+			interfaces: []string{"stable", "experimental"},
+			funcs:      []string{"a", "b", "c", "d", "e", "f"},
+			methods:    2,
+			imports:    2,
+		},
+		{
+			name:       "all_features",
+			options:    resolve.Options{AllFeatures: true, Version: option.Some(v(0, 1, 0, ""))},
+			interfaces: []string{"experimental"},
+			funcs:      []string{"f"},
+			methods:    0,
+			imports:    1,
+		},
+	}
+	tree, err := wit.Parse(input)
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved, err := resolve.Resolve(tree, test.options)
+			require.NoError(t, err)
+
+			var interfaces []string
+			var funcs []string
+			methods := 0
+			imports := 0
+			for _, item := range resolved.Items {
+				if item.Interface != nil {
+					interfaces = append(interfaces, item.Interface.Name)
+					for _, interfaceItem := range item.Interface.Items {
+						switch i := interfaceItem.(type) {
+						case *ast.FuncItem:
+							funcs = append(funcs, i.ID)
+						case ast.Resource:
+							methods += len(i.Methods)
+						}
+					}
+				}
+				if item.World != nil {
+					imports += len(item.World.Items)
+				}
+			}
+			require.Equal(t, test.interfaces, interfaces)
+			require.Equal(t, test.funcs, funcs)
+			require.Equal(t, test.methods, methods)
+			require.Equal(t, test.imports, imports)
+		})
+	}
+}
+
+func TestResolveDoesNotModifyAst(t *testing.T) {
+	tree, err := wit.Parse(input)
+	require.NoError(t, err)
+
+	_, err = resolve.Resolve(tree, resolve.Options{Version: option.Some(ast.Version{})})
+	require.NoError(t, err)
+
+	require.Len(t, tree.Items, 3)
+	require.Len(t, tree.Items[0].Interface.Items, 6)
+}
+
+func TestResolveDuplicate(t *testing.T) {
+	tree, err := wit.Parse(`
+package a:b;
+@unstable(feature = x)
+interface i {}
+interface i {}`)
+	require.NoError(t, err)
+
+	_, err = resolve.Resolve(tree, resolve.Options{})
+	require.NoError(t, err)
+
+	_, err = resolve.Resolve(tree, resolve.Options{Features: []string{"x"}})
+	require.Error(t, err)
+}
+
+func TestParseGateValues(t *testing.T) {
+	tree, err := wit.Parse(`package a:b; @since(version = 0.2.0-rc.1+build.5, feature = f) @deprecated(version = 1.0.0) interface i {}`)
+	require.NoError(t, err)
+	gates := tree.Items[0].Interface.Gates
+	require.Len(t, gates, 2)
+
+	since, ok := gates[0].(*ast.Since)
+	require.True(t, ok)
+	require.Equal(t, "0.2.0-rc.1+build.5", since.Version.String())
+	require.Equal(t, option.Some("f"), since.Feature)
+
+	deprecated, ok := gates[1].(*ast.Deprecated)
+	require.True(t, ok)
+	require.Equal(t, "1.0.0", deprecated.Version.String())
+}
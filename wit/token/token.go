@@ -1,5 +1,7 @@
 package token
 
+import "github.com/patrickhuber/go-wasm/diagnostic"
+
 type Token struct {
 	Type     TokenType
 	Position int
@@ -7,3 +9,9 @@ type Token struct {
 	Line     int
 	Capture  string
 }
+
+// Span returns the source range of the token
+func (t *Token) Span() diagnostic.Span {
+	start := diagnostic.Position{Offset: t.Position, Line: t.Line, Column: t.Column}
+	return diagnostic.Span{Start: start, End: start.Advance(t.Capture)}
+}